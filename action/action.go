@@ -6,10 +6,18 @@ package action
 
 import (
 	"errors"
+	"fmt"
 	"github.com/globocom/tsuru/log"
+	"labix.org/v2/mgo/bson"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
+// ErrTimeout is the error of the attempts that don't finish before the
+// timeout of the action.
+var ErrTimeout = errors.New("Timed out running the action.")
+
 // Result is the value returned by Forward. It is used in the call of the next
 // action, and also when rolling back the actions.
 type Result interface{}
@@ -34,6 +42,11 @@ type FWContext struct {
 
 	// List of parameters given to the executor.
 	Params []interface{}
+
+	// Attempt is the number of the current call to the Forward function,
+	// starting at 1. Forward functions that aren't idempotent use it to
+	// detect that a previous attempt may have succeeded.
+	Attempt int
 }
 
 // BWContext is the context used in calls to Backward functions (backward
@@ -66,6 +79,27 @@ type Action struct {
 	// Minimum number of parameters that this action requires to run.
 	MinParams int
 
+	// Retry defines how the Forward function is retried when it fails. The
+	// zero value calls it only once.
+	Retry RetryPolicy
+
+	// Maximum duration of each call to the Forward function. When it
+	// expires, the attempt fails with ErrTimeout. The call can't be
+	// interrupted, so it keeps running in the background while the
+	// pipeline retries or rolls back, and it's undone with the Backward
+	// function if it succeeds late. Zero means no timeout.
+	Timeout time.Duration
+
+	// Function that converts the result of Forward to the value stored in
+	// the database, in persistent pipelines. When it's nil, the result is
+	// stored as is.
+	EncodeResult func(Result) (interface{}, error)
+
+	// Function that rebuilds the result of Forward from the value stored in
+	// the database, when recovering a persistent pipeline. When it's nil,
+	// the stored value is decoded into a generic value (like bson.M).
+	DecodeResult func(raw bson.Raw) (Result, error)
+
 	// Result of the action. Stored for use in the backward phase.
 	result Result
 
@@ -78,6 +112,69 @@ type Action struct {
 // that all actions are really small and atomic.
 type Pipeline struct {
 	actions []*Action
+	// name of the persistent pipeline, empty for in-memory pipelines.
+	name string
+	// failure of the last execution.
+	failure *Failure
+	// observers of the steps of the pipeline.
+	observers []Observer
+}
+
+// RetryPolicy defines how the pipeline executor retries the Forward function
+// of an action.
+type RetryPolicy struct {
+	// Maximum number of calls to the Forward function. Zero and one mean
+	// that the function is called only once.
+	Attempts int
+
+	// Delay before the second attempt. It doubles after each attempt.
+	Backoff time.Duration
+
+	// Maximum delay between two attempts. Zero means no limit.
+	MaxBackoff time.Duration
+
+	// Retryable reports whether an attempt that failed with the given error
+	// should be retried. When it's nil, all errors are retried.
+	Retryable func(err error) bool
+}
+
+func (p *RetryPolicy) retryable(err error) bool {
+	return p.Retryable == nil || p.Retryable(err)
+}
+
+func (p *RetryPolicy) next(delay time.Duration) time.Duration {
+	delay *= 2
+	if p.MaxBackoff > 0 && delay > p.MaxBackoff {
+		delay = p.MaxBackoff
+	}
+	return delay
+}
+
+// Failure describes the action that made a pipeline fail.
+type Failure struct {
+	// Name of the action.
+	Action string
+
+	// Attempt that failed, starting at 1. It's zero when the Forward
+	// function was not called.
+	Attempt int
+
+	// Error returned by the last attempt.
+	Err error
+}
+
+func (f *Failure) Error() string {
+	return fmt.Sprintf("The %s action failed on attempt %d: %s", f.Action, f.Attempt, f.Err)
+}
+
+// running is the number of pipelines being executed in the process.
+var running int32
+
+// Running returns the number of pipelines being executed in the process,
+// including the ones rolling back. It's used to wait for the pipelines before
+// shutting down.
+func Running() int {
+	return int(atomic.LoadInt32(&running))
 }
 
 // NewPipeline creates a new pipeline instance with the given list of actions.
@@ -92,56 +189,186 @@ func (p *Pipeline) Result() Result {
 	return action.result
 }
 
+// Failure returns the failure of the last execution of the pipeline, or nil
+// if it succeeded.
+func (p *Pipeline) Failure() *Failure {
+	return p.failure
+}
+
+// DryRun validates the parameters against the actions of the pipeline, without
+// executing them. It returns the names of the actions that Execute would run,
+// in order. Errors in actions are reported as a *Failure.
+func (p *Pipeline) DryRun(params ...interface{}) ([]string, error) {
+	if len(p.actions) == 0 {
+		return nil, errors.New("No actions to execute.")
+	}
+	steps := make([]string, len(p.actions))
+	for i, a := range p.actions {
+		var err error
+		if a.Forward == nil {
+			err = errors.New("All actions must define the forward function.")
+		} else if len(params) < a.MinParams {
+			err = errors.New("Not enough parameters to call Action.Forward.")
+		}
+		if err != nil {
+			return nil, &Failure{Action: a.Name, Err: err}
+		}
+		steps[i] = a.Name
+	}
+	return steps, nil
+}
+
 // Execute executes the pipeline.
 //
 // The execution starts in the forward phase, calling the Forward function of
 // all actions. If none of the Forward calls return error, the pipeline
 // execution ends in the forward phase and is "committed".
 //
+// The Forward function of each action is retried according to the Retry
+// policy of the action, and each call is limited by its Timeout.
+//
 // If any of the Forward call fail, the executor switches to the backward phase
 // (roll back) and call the Backward function for each action completed. It
 // does not call the Backward function of the action that has failed.
 //
 // After rolling back all completed actions, it returns the original error
-// returned by the action that failed.
+// returned by the action that failed. The action and the attempt that failed
+// are available through the Failure method.
 func (p *Pipeline) Execute(params ...interface{}) error {
-	var (
-		r   Result
-		err error
-	)
 	if len(p.actions) == 0 {
 		return errors.New("No actions to execute.")
 	}
-	fwCtx := FWContext{Params: params}
-	for i, a := range p.actions {
+	p.failure = nil
+	atomic.AddInt32(&running, 1)
+	defer atomic.AddInt32(&running, -1)
+	var pr *progress
+	if p.name != "" {
+		var err error
+		pr, err = newProgress(p.name, p.actions, params)
+		if err != nil {
+			return err
+		}
+		defer pr.finish()
+	}
+	results := make([]Result, len(p.actions))
+	return p.run(0, FWContext{Params: params}, results, pr)
+}
+
+// run executes the actions of the pipeline from the given index, storing
+// their results in results, and recording the progress in pr, when the
+// pipeline is persistent.
+func (p *Pipeline) run(start int, fwCtx FWContext, results []Result, pr *progress) error {
+	var (
+		r       Result
+		err     error
+		attempt int
+	)
+	for i := start; i < len(p.actions); i++ {
+		a := p.actions[i]
 		log.Printf("[pipeline] running the Forward for the %s action", a.Name)
+		attempt = 0
+		start := time.Now()
 		if a.Forward == nil {
 			err = errors.New("All actions must define the forward function.")
 		} else if len(fwCtx.Params) < a.MinParams {
 			err = errors.New("Not enough parameters to call Action.Forward.")
 		} else {
-			r, err = a.Forward(fwCtx)
+			r, attempt, err = a.forward(fwCtx)
 			a.rMutex.Lock()
 			a.result = r
 			a.rMutex.Unlock()
 			fwCtx.Previous = r
 		}
+		p.notifyForward(StepEvent{Action: a.Name, Attempts: attempt, Duration: time.Since(start), Err: err})
 		if err != nil {
-			log.Printf("[pipeline] error running the Forward for the %s action - %s", a.Name, err.Error())
-			p.rollback(i-1, params)
+			p.failure = &Failure{Action: a.Name, Attempt: attempt, Err: err}
+			log.Printf("[pipeline] error running the Forward for the %s action - %s", a.Name, p.failure)
+			pr.rollingBack()
+			p.rollback(i-1, fwCtx.Params, results, pr)
 			return err
 		}
+		results[i] = r
+		pr.step(a, r)
 	}
 	return nil
 }
 
-func (p *Pipeline) rollback(index int, params []interface{}) {
+// forward calls the Forward function of the action, retrying it according to
+// the retry policy of the action. It returns the result and the error of the
+// last attempt, and the number of attempts.
+func (a *Action) forward(ctx FWContext) (Result, int, error) {
+	delay := a.Retry.Backoff
+	for attempt := 1; ; attempt++ {
+		ctx.Attempt = attempt
+		r, err := a.call(ctx)
+		if err == nil || attempt >= a.Retry.Attempts || !a.Retry.retryable(err) {
+			return r, attempt, err
+		}
+		log.Printf("[pipeline] attempt %d of the Forward for the %s action failed, retrying in %s - %s", attempt, a.Name, delay, err)
+		time.Sleep(delay)
+		delay = a.Retry.next(delay)
+	}
+}
+
+// call calls the Forward function of the action once, limited by the timeout
+// of the action. Panics in the Forward function are propagated to the caller.
+//
+// When the timeout expires, call returns ErrTimeout right away. The abandoned
+// call keeps running in the background, and the Backward function is called
+// with its result if it succeeds, so late successes are not left behind.
+func (a *Action) call(ctx FWContext) (Result, error) {
+	if a.Timeout <= 0 {
+		return a.Forward(ctx)
+	}
+	type outcome struct {
+		result Result
+		err    error
+		panic  interface{}
+	}
+	ch := make(chan outcome, 1)
+	go func() {
+		var o outcome
+		defer func() {
+			if v := recover(); v != nil {
+				o.panic = v
+			}
+			ch <- o
+		}()
+		o.result, o.err = a.Forward(ctx)
+	}()
+	timer := time.NewTimer(a.Timeout)
+	defer timer.Stop()
+	select {
+	case o := <-ch:
+		if o.panic != nil {
+			panic(o.panic)
+		}
+		return o.result, o.err
+	case <-timer.C:
+		log.Printf("[pipeline] the Forward for the %s action timed out", a.Name)
+		go func() {
+			o := <-ch
+			if o.panic != nil {
+				log.Errorf("[pipeline] the Forward for the %s action panicked after timing out: %v", a.Name, o.panic)
+			} else if o.err == nil && a.Backward != nil {
+				log.Printf("[pipeline] running Backward for the %s action, which succeeded after timing out", a.Name)
+				a.Backward(BWContext{FWResult: o.result, Params: ctx.Params})
+			}
+		}()
+		return nil, ErrTimeout
+	}
+}
+
+func (p *Pipeline) rollback(index int, params []interface{}, results []Result, pr *progress) {
 	bwCtx := BWContext{Params: params}
 	for i := index; i >= 0; i-- {
 		log.Printf("[pipeline] running Backward for %s action", p.actions[i].Name)
 		if p.actions[i].Backward != nil {
-			bwCtx.FWResult = p.actions[i].result
+			start := time.Now()
+			bwCtx.FWResult = results[i]
 			p.actions[i].Backward(bwCtx)
+			p.notifyBackward(StepEvent{Action: p.actions[i].Name, Duration: time.Since(start)})
 		}
+		pr.undone()
 	}
 }
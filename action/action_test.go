@@ -134,3 +134,28 @@ func (s *S) TestResult(c *gocheck.C) {
 	r := pipeline.Result()
 	c.Assert(r, gocheck.Equals, "ok")
 }
+
+func (s *S) TestRunning(c *gocheck.C) {
+	started := make(chan bool)
+	finish := make(chan bool)
+	actions := []*Action{
+		{
+			Forward: func(ctx FWContext) (Result, error) {
+				started <- true
+				<-finish
+				return nil, nil
+			},
+		},
+	}
+	c.Assert(Running(), gocheck.Equals, 0)
+	done := make(chan bool)
+	go func() {
+		NewPipeline(actions...).Execute()
+		done <- true
+	}()
+	<-started
+	c.Assert(Running(), gocheck.Equals, 1)
+	finish <- true
+	<-done
+	c.Assert(Running(), gocheck.Equals, 0)
+}
@@ -32,6 +32,11 @@ executor:
 Besides the Context, the Backward function will also receive the result of the
 Forward call.
 
+An action may define a retry policy and a timeout. The executor retries the
+Forward function while it fails with retryable errors, and gives up on each call
+that takes longer than the timeout. After a failure, the Failure method of the
+pipeline reports which action failed, on which attempt, and why.
+
 For more details, check the documentation of the Execute method in the Pipeline
 type.
 */
@@ -0,0 +1,75 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package action
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// StepEvent describes a step of the execution of a pipeline: the call to the
+// Forward or to the Backward function of an action.
+type StepEvent struct {
+	// Name of the action.
+	Action string
+
+	// Number of calls to the Forward function. It's zero in backward
+	// steps, and when the Forward function was not called.
+	Attempts int
+
+	// Time spent in the step, including the delay between attempts.
+	Duration time.Duration
+
+	// Error of the step. Backward steps never fail.
+	Err error
+}
+
+// Observer receives the steps of the execution of a pipeline, as they finish.
+// Observers are called synchronously, in the goroutine that executes the
+// pipeline.
+type Observer interface {
+	Forward(e StepEvent)
+	Backward(e StepEvent)
+}
+
+// Observe adds an observer to the pipeline.
+func (p *Pipeline) Observe(o Observer) {
+	p.observers = append(p.observers, o)
+}
+
+func (p *Pipeline) notifyForward(e StepEvent) {
+	for _, o := range p.observers {
+		o.Forward(e)
+	}
+}
+
+func (p *Pipeline) notifyBackward(e StepEvent) {
+	for _, o := range p.observers {
+		o.Backward(e)
+	}
+}
+
+type writerObserver struct {
+	w io.Writer
+}
+
+// NewWriterObserver returns an observer that reports the progress of the
+// pipeline to the given writer, in the format used by the output of deploys.
+func NewWriterObserver(w io.Writer) Observer {
+	return writerObserver{w: w}
+}
+
+func (o writerObserver) Forward(e StepEvent) {
+	if e.Err != nil {
+		fmt.Fprintf(o.w, " ---> %s failed after %d attempt(s) in %s: %s\n", e.Action, e.Attempts, e.Duration, e.Err)
+		return
+	}
+	fmt.Fprintf(o.w, " ---> %s done in %s\n", e.Action, e.Duration)
+}
+
+func (o writerObserver) Backward(e StepEvent) {
+	fmt.Fprintf(o.w, " ---> %s rolled back in %s\n", e.Action, e.Duration)
+}
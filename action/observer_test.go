@@ -0,0 +1,127 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package action
+
+import (
+	"bytes"
+	"errors"
+	"launchpad.net/gocheck"
+	"strings"
+	"time"
+)
+
+type recordingObserver struct {
+	forward  []StepEvent
+	backward []StepEvent
+}
+
+func (o *recordingObserver) Forward(e StepEvent) {
+	o.forward = append(o.forward, e)
+}
+
+func (o *recordingObserver) Backward(e StepEvent) {
+	o.backward = append(o.backward, e)
+}
+
+func (s *S) TestObserverReceivesSteps(c *gocheck.C) {
+	failure := errors.New("failed")
+	actions := []*Action{
+		{
+			Name: "first",
+			Forward: func(ctx FWContext) (Result, error) {
+				time.Sleep(10 * time.Millisecond)
+				return "ok", nil
+			},
+			Backward: func(ctx BWContext) {},
+		},
+		{
+			Name: "not-undoable",
+			Forward: func(ctx FWContext) (Result, error) {
+				return "ok", nil
+			},
+		},
+		{
+			Name: "broken",
+			Forward: func(ctx FWContext) (Result, error) {
+				return nil, failure
+			},
+		},
+	}
+	var o recordingObserver
+	pipeline := NewPipeline(actions...)
+	pipeline.Observe(&o)
+	err := pipeline.Execute()
+	c.Assert(err, gocheck.Equals, failure)
+	c.Assert(o.forward, gocheck.HasLen, 3)
+	c.Assert(o.forward[0].Action, gocheck.Equals, "first")
+	c.Assert(o.forward[0].Attempts, gocheck.Equals, 1)
+	c.Assert(o.forward[0].Err, gocheck.IsNil)
+	c.Assert(o.forward[0].Duration >= 10*time.Millisecond, gocheck.Equals, true)
+	c.Assert(o.forward[1].Action, gocheck.Equals, "not-undoable")
+	c.Assert(o.forward[2].Action, gocheck.Equals, "broken")
+	c.Assert(o.forward[2].Err, gocheck.Equals, failure)
+	c.Assert(o.backward, gocheck.HasLen, 1)
+	c.Assert(o.backward[0].Action, gocheck.Equals, "first")
+	c.Assert(o.backward[0].Attempts, gocheck.Equals, 0)
+}
+
+func (s *S) TestWriterObserver(c *gocheck.C) {
+	var buf bytes.Buffer
+	o := NewWriterObserver(&buf)
+	o.Forward(StepEvent{Action: "create-container", Attempts: 1, Duration: time.Second})
+	o.Forward(StepEvent{Action: "check-health", Attempts: 3, Duration: time.Minute, Err: errors.New("unhealthy")})
+	o.Backward(StepEvent{Action: "create-container", Duration: time.Second})
+	expected := []string{
+		" ---> create-container done in 1s",
+		" ---> check-health failed after 3 attempt(s) in 1m0s: unhealthy",
+		" ---> create-container rolled back in 1s",
+		"",
+	}
+	c.Assert(buf.String(), gocheck.Equals, strings.Join(expected, "\n"))
+}
+
+func (s *S) TestDryRun(c *gocheck.C) {
+	var called bool
+	forward := func(ctx FWContext) (Result, error) {
+		called = true
+		return nil, nil
+	}
+	actions := []*Action{
+		{Name: "first", Forward: forward},
+		{Name: "second", Forward: forward, MinParams: 2},
+	}
+	steps, err := NewPipeline(actions...).DryRun("hello", "world")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(steps, gocheck.DeepEquals, []string{"first", "second"})
+	c.Assert(called, gocheck.Equals, false)
+}
+
+func (s *S) TestDryRunNotEnoughParams(c *gocheck.C) {
+	forward := func(ctx FWContext) (Result, error) {
+		return nil, nil
+	}
+	actions := []*Action{
+		{Name: "first", Forward: forward},
+		{Name: "second", Forward: forward, MinParams: 2},
+	}
+	steps, err := NewPipeline(actions...).DryRun("hello")
+	c.Assert(steps, gocheck.IsNil)
+	f, ok := err.(*Failure)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(f.Action, gocheck.Equals, "second")
+	c.Assert(f.Err.Error(), gocheck.Equals, "Not enough parameters to call Action.Forward.")
+}
+
+func (s *S) TestDryRunNilForward(c *gocheck.C) {
+	_, err := NewPipeline(&Action{Name: "empty"}).DryRun()
+	c.Assert(err, gocheck.NotNil)
+	c.Assert(err.(*Failure).Err.Error(), gocheck.Equals, "All actions must define the forward function.")
+}
+
+func (s *S) TestDryRunNoActions(c *gocheck.C) {
+	_, err := NewPipeline().DryRun()
+	c.Assert(err, gocheck.NotNil)
+	c.Assert(err.Error(), gocheck.Equals, "No actions to execute.")
+}
@@ -0,0 +1,392 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package action
+
+import (
+	"fmt"
+	"github.com/globocom/tsuru/db"
+	"github.com/globocom/tsuru/log"
+	"labix.org/v2/mgo"
+	"labix.org/v2/mgo/bson"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Recovery describes how to rebuild a persistent pipeline that was left
+// unfinished, because the process died while executing it.
+type Recovery struct {
+	// Actions that may be part of the pipeline. The actions of an
+	// unfinished pipeline are looked up by name.
+	Actions []*Action
+
+	// EncodeParams converts the parameters given to Execute to the value
+	// stored in the database.
+	EncodeParams func(params []interface{}) (interface{}, error)
+
+	// DecodeParams rebuilds the parameters from the value stored in the
+	// database.
+	DecodeParams func(raw bson.Raw) ([]interface{}, error)
+
+	// Resume indicates whether unfinished pipelines should be resumed from
+	// the action where they stopped. Otherwise, they're rolled back.
+	Resume bool
+}
+
+var recoveries = struct {
+	sync.RWMutex
+	m map[string]*Recovery
+}{m: make(map[string]*Recovery)}
+
+// RegisterRecovery registers the recovery of the persistent pipelines with
+// the given name.
+func RegisterRecovery(name string, r *Recovery) {
+	recoveries.Lock()
+	recoveries.m[name] = r
+	recoveries.Unlock()
+}
+
+func getRecovery(name string) (*Recovery, bool) {
+	recoveries.RLock()
+	defer recoveries.RUnlock()
+	r, ok := recoveries.m[name]
+	return r, ok
+}
+
+// NewPersistentPipeline creates a pipeline that stores its progress in the
+// database: the parameters, and the result of each action executed. If the
+// process dies while executing it, the pipeline is recovered by Recover.
+//
+// The name must be registered with RegisterRecovery.
+func NewPersistentPipeline(name string, actions ...*Action) *Pipeline {
+	return &Pipeline{actions: actions, name: name}
+}
+
+// leaseDuration is how long a process owns the persistent pipelines it's
+// executing. The process renews the lease while executing them: pipelines
+// whose lease expired were left unfinished by a process that died, and are
+// taken over by the recovery of any process.
+var leaseDuration = time.Minute
+
+// processID identifies this process as the owner of the persistent pipelines
+// it's executing.
+var processID = bson.NewObjectId().Hex()
+
+// maxRecoveries is the number of attempts to recover a pipeline before
+// marking it as failed.
+const maxRecoveries = 5
+
+// leases holds the persistent pipelines executed by this process, whose
+// leases are renewed by renewLeases.
+var leases = struct {
+	sync.Mutex
+	ids  map[bson.ObjectId]bool
+	once sync.Once
+}{ids: make(map[bson.ObjectId]bool)}
+
+func hold(id bson.ObjectId) {
+	leases.Lock()
+	leases.ids[id] = true
+	leases.Unlock()
+	leases.once.Do(func() {
+		go func() {
+			for {
+				time.Sleep(leaseDuration / 3)
+				renewLeases()
+			}
+		}()
+	})
+}
+
+func release(id bson.ObjectId) {
+	leases.Lock()
+	delete(leases.ids, id)
+	leases.Unlock()
+}
+
+// renewLeases extends the leases of the pipelines being executed by this
+// process.
+func renewLeases() {
+	leases.Lock()
+	ids := make([]bson.ObjectId, 0, len(leases.ids))
+	for id := range leases.ids {
+		ids = append(ids, id)
+	}
+	leases.Unlock()
+	if len(ids) == 0 {
+		return
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		log.Errorf("Failed to renew the leases of the pipelines: %s", err)
+		return
+	}
+	defer conn.Close()
+	_, err = conn.Pipelines().UpdateAll(
+		bson.M{"_id": bson.M{"$in": ids}, "owner": processID},
+		bson.M{"$set": bson.M{"lease": time.Now().In(time.UTC).Add(leaseDuration)}},
+	)
+	if err != nil {
+		log.Errorf("Failed to renew the leases of the pipelines: %s", err)
+	}
+}
+
+// storedPipeline is the progress of a persistent pipeline, as stored in the
+// database.
+type storedPipeline struct {
+	ID          bson.ObjectId `bson:"_id"`
+	Name        string
+	Owner       string
+	Lease       time.Time
+	Params      bson.Raw
+	Actions     []string
+	Results     []bson.Raw
+	RollingBack bool
+	StartTime   time.Time
+	Recoveries  int
+	Failed      bool
+	Error       string
+}
+
+// progress records the progress of a persistent pipeline. All methods are
+// no-ops on a nil progress, used by in-memory pipelines.
+type progress struct {
+	id bson.ObjectId
+}
+
+func newProgress(name string, actions []*Action, params []interface{}) (*progress, error) {
+	r, ok := getRecovery(name)
+	if !ok {
+		return nil, fmt.Errorf("Unknown pipeline %q.", name)
+	}
+	encoded, err := r.EncodeParams(params)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(actions))
+	for i, a := range actions {
+		names[i] = a.Name
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	p := progress{id: bson.NewObjectId()}
+	now := time.Now().In(time.UTC)
+	err = conn.Pipelines().Insert(bson.M{
+		"_id":         p.id,
+		"name":        name,
+		"owner":       processID,
+		"lease":       now.Add(leaseDuration),
+		"params":      encoded,
+		"actions":     names,
+		"results":     []interface{}{},
+		"rollingback": false,
+		"starttime":   now,
+	})
+	if err != nil {
+		return nil, err
+	}
+	hold(p.id)
+	return &p, nil
+}
+
+func (p *progress) update(change bson.M) {
+	if p == nil {
+		return
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		log.Errorf("Failed to record the progress of the pipeline %s: %s", p.id.Hex(), err)
+		return
+	}
+	defer conn.Close()
+	if err := conn.Pipelines().UpdateId(p.id, change); err != nil {
+		log.Errorf("Failed to record the progress of the pipeline %s: %s", p.id.Hex(), err)
+	}
+}
+
+// step records the result of an action.
+func (p *progress) step(a *Action, r Result) {
+	if p == nil {
+		return
+	}
+	var value interface{} = r
+	if a.EncodeResult != nil {
+		var err error
+		if value, err = a.EncodeResult(r); err != nil {
+			log.Errorf("Failed to encode the result of the %s action: %s", a.Name, err)
+			value = nil
+		}
+	}
+	p.update(bson.M{"$push": bson.M{"results": value}})
+}
+
+// undone records that the last action with a result was rolled back, so it's
+// not rolled back again if the process dies during the rollback.
+func (p *progress) undone() {
+	p.update(bson.M{"$pop": bson.M{"results": 1}})
+}
+
+// rollingBack records that the pipeline is rolling back.
+func (p *progress) rollingBack() {
+	p.update(bson.M{"$set": bson.M{"rollingback": true}})
+}
+
+// finish removes the progress of the pipeline from the database.
+func (p *progress) finish() {
+	if p == nil {
+		return
+	}
+	defer release(p.id)
+	conn, err := db.Conn()
+	if err != nil {
+		log.Errorf("Failed to remove the pipeline %s: %s", p.id.Hex(), err)
+		return
+	}
+	defer conn.Close()
+	conn.Pipelines().RemoveId(p.id)
+}
+
+// decodeResult rebuilds the result of the action from the stored value.
+func decodeResult(a *Action, raw bson.Raw) (Result, error) {
+	if raw.Kind == 0x0A {
+		return nil, nil
+	}
+	if a.DecodeResult != nil {
+		return a.DecodeResult(raw)
+	}
+	var r interface{}
+	err := raw.Unmarshal(&r)
+	return r, err
+}
+
+// Recover resumes or rolls back the persistent pipelines left unfinished by
+// processes that died, the ones whose lease expired. Each pipeline is taken
+// over by a single process.
+//
+// The action that was running when the process died can't be rolled back,
+// because its result is unknown.
+//
+// Pipelines that can't be recovered, because their actions or parameters
+// can't be rebuilt, are marked as failed after maxRecoveries attempts, and
+// are kept in the database for inspection.
+func Recover() error {
+	recoveries.RLock()
+	names := make([]string, 0, len(recoveries.m))
+	for name := range recoveries.m {
+		names = append(names, name)
+	}
+	recoveries.RUnlock()
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	for {
+		now := time.Now().In(time.UTC)
+		query := bson.M{
+			"name":   bson.M{"$in": names},
+			"failed": bson.M{"$ne": true},
+			"$or": []bson.M{
+				{"lease": bson.M{"$lt": now}},
+				{"lease": bson.M{"$exists": false}},
+			},
+		}
+		change := mgo.Change{
+			Update: bson.M{
+				"$set": bson.M{"owner": processID, "lease": now.Add(leaseDuration)},
+				"$inc": bson.M{"recoveries": 1},
+			},
+			ReturnNew: true,
+		}
+		var s storedPipeline
+		_, err := conn.Pipelines().Find(query).Apply(change, &s)
+		if err == mgo.ErrNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		hold(s.ID)
+		if err := recoverPipeline(&s); err != nil {
+			log.Errorf("Failed to recover the pipeline %s (%s): %s", s.Name, s.ID.Hex(), err)
+			if s.Recoveries >= maxRecoveries {
+				log.Errorf("Giving up the pipeline %s (%s) after %d attempts", s.Name, s.ID.Hex(), s.Recoveries)
+				conn.Pipelines().UpdateId(s.ID, bson.M{"$set": bson.M{"failed": true, "error": err.Error()}})
+			}
+		} else {
+			conn.Pipelines().RemoveId(s.ID)
+		}
+		release(s.ID)
+	}
+}
+
+// KeepRecovering calls Recover when the process starts and then periodically,
+// taking over the pipelines of processes that die while this one is running.
+func KeepRecovering() {
+	for {
+		if err := Recover(); err != nil {
+			log.Errorf("Failed to recover unfinished pipelines: %s", err)
+		}
+		time.Sleep(leaseDuration)
+	}
+}
+
+func recoverPipeline(s *storedPipeline) error {
+	r, ok := getRecovery(s.Name)
+	if !ok {
+		return fmt.Errorf("Unknown pipeline %q.", s.Name)
+	}
+	params, err := r.DecodeParams(s.Params)
+	if err != nil {
+		return err
+	}
+	p := Pipeline{actions: make([]*Action, len(s.Actions))}
+	for i, name := range s.Actions {
+		for _, a := range r.Actions {
+			if a.Name == name {
+				p.actions[i] = a
+				break
+			}
+		}
+		if p.actions[i] == nil {
+			return fmt.Errorf("Unknown action %q.", name)
+		}
+	}
+	if len(s.Results) > len(p.actions) {
+		return fmt.Errorf("Found %d results for %d actions.", len(s.Results), len(p.actions))
+	}
+	results := make([]Result, len(p.actions))
+	for i, raw := range s.Results {
+		if results[i], err = decodeResult(p.actions[i], raw); err != nil {
+			return err
+		}
+	}
+	done := len(s.Results)
+	if done >= len(p.actions) && !s.RollingBack {
+		// All actions were executed, the process died before removing
+		// the pipeline.
+		return nil
+	}
+	atomic.AddInt32(&running, 1)
+	defer atomic.AddInt32(&running, -1)
+	if s.RollingBack || !r.Resume {
+		log.Warnf("[pipeline] rolling back the %s pipeline, interrupted after %d of %d actions", s.Name, done, len(p.actions))
+		p.rollback(done-1, params, results, &progress{id: s.ID})
+		return nil
+	}
+	log.Warnf("[pipeline] resuming the %s pipeline, interrupted after %d of %d actions", s.Name, done, len(p.actions))
+	fwCtx := FWContext{Params: params}
+	if done > 0 {
+		fwCtx.Previous = results[done-1]
+	}
+	err = p.run(done, fwCtx, results, &progress{id: s.ID})
+	if err != nil {
+		log.Errorf("[pipeline] failed to resume the %s pipeline: %s", s.Name, err)
+	}
+	return nil
+}
@@ -0,0 +1,358 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package action
+
+import (
+	"errors"
+	"github.com/globocom/config"
+	"github.com/globocom/tsuru/db"
+	"labix.org/v2/mgo/bson"
+	"launchpad.net/gocheck"
+	"time"
+)
+
+type PersistSuite struct {
+	conn *db.Storage
+}
+
+var _ = gocheck.Suite(&PersistSuite{})
+
+func (s *PersistSuite) SetUpSuite(c *gocheck.C) {
+	config.Set("database:url", "127.0.0.1:27017")
+	config.Set("database:name", "tsuru_action_test")
+	var err error
+	s.conn, err = db.Conn()
+	c.Assert(err, gocheck.IsNil)
+}
+
+func (s *PersistSuite) TearDownSuite(c *gocheck.C) {
+	s.conn.Pipelines().Database.DropDatabase()
+	s.conn.Close()
+}
+
+func (s *PersistSuite) TearDownTest(c *gocheck.C) {
+	s.conn.Pipelines().RemoveAll(nil)
+}
+
+func encodeName(params []interface{}) (interface{}, error) {
+	return bson.M{"name": params[0]}, nil
+}
+
+func decodeName(raw bson.Raw) ([]interface{}, error) {
+	var p struct{ Name string }
+	err := raw.Unmarshal(&p)
+	return []interface{}{p.Name}, err
+}
+
+type counter struct {
+	N int
+}
+
+func decodeCounter(raw bson.Raw) (Result, error) {
+	var c counter
+	err := raw.Unmarshal(&c)
+	return &c, err
+}
+
+// insertPipeline stores a pipeline as if the process had died while running
+// it, its lease expiring at the given time.
+func (s *PersistSuite) insertPipeline(c *gocheck.C, name string, lease time.Time, results []interface{}, rollingBack bool) bson.ObjectId {
+	id := bson.NewObjectId()
+	err := s.conn.Pipelines().Insert(bson.M{
+		"_id":         id,
+		"name":        name,
+		"owner":       "otherprocess",
+		"lease":       lease,
+		"params":      bson.M{"name": "myapp"},
+		"actions":     []string{"first", "second", "third"},
+		"results":     results,
+		"rollingback": rollingBack,
+		"starttime":   time.Now(),
+	})
+	c.Assert(err, gocheck.IsNil)
+	return id
+}
+
+// expired is the lease of a pipeline whose process died.
+var expired = time.Now().Add(-time.Minute)
+
+func (s *PersistSuite) TestPersistentPipelineRecordsProgress(c *gocheck.C) {
+	RegisterRecovery("test-progress", &Recovery{EncodeParams: encodeName, DecodeParams: decodeName})
+	var stored storedPipeline
+	actions := []*Action{
+		{
+			Name: "first",
+			Forward: func(ctx FWContext) (Result, error) {
+				return &counter{N: 1}, nil
+			},
+		},
+		{
+			Name: "second",
+			Forward: func(ctx FWContext) (Result, error) {
+				err := s.conn.Pipelines().Find(nil).One(&stored)
+				return nil, err
+			},
+		},
+	}
+	err := NewPersistentPipeline("test-progress", actions...).Execute("myapp")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(stored.Name, gocheck.Equals, "test-progress")
+	c.Assert(stored.Owner, gocheck.Equals, processID)
+	c.Assert(stored.Lease.After(time.Now()), gocheck.Equals, true)
+	c.Assert(stored.Actions, gocheck.DeepEquals, []string{"first", "second"})
+	c.Assert(stored.RollingBack, gocheck.Equals, false)
+	params, err := decodeName(stored.Params)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(params, gocheck.DeepEquals, []interface{}{"myapp"})
+	c.Assert(stored.Results, gocheck.HasLen, 1)
+	r, err := decodeCounter(stored.Results[0])
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(r, gocheck.DeepEquals, &counter{N: 1})
+	count, err := s.conn.Pipelines().Count()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(count, gocheck.Equals, 0)
+}
+
+func (s *PersistSuite) TestPersistentPipelineFailureRemovesProgress(c *gocheck.C) {
+	RegisterRecovery("test-failure", &Recovery{EncodeParams: encodeName, DecodeParams: decodeName})
+	var rolledBack bool
+	actions := []*Action{
+		{
+			Name: "first",
+			Forward: func(ctx FWContext) (Result, error) {
+				return "ok", nil
+			},
+			Backward: func(ctx BWContext) {
+				rolledBack = true
+			},
+		},
+		{
+			Name: "second",
+			Forward: func(ctx FWContext) (Result, error) {
+				return nil, errors.New("failed")
+			},
+		},
+	}
+	err := NewPersistentPipeline("test-failure", actions...).Execute("myapp")
+	c.Assert(err, gocheck.NotNil)
+	c.Assert(rolledBack, gocheck.Equals, true)
+	count, err := s.conn.Pipelines().Count()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(count, gocheck.Equals, 0)
+}
+
+func (s *PersistSuite) TestPersistentPipelineNotRegistered(c *gocheck.C) {
+	action := Action{Name: "first", Forward: func(ctx FWContext) (Result, error) { return nil, nil }}
+	err := NewPersistentPipeline("unregistered", &action).Execute()
+	c.Assert(err, gocheck.NotNil)
+	c.Assert(err.Error(), gocheck.Equals, `Unknown pipeline "unregistered".`)
+}
+
+func (s *PersistSuite) TestRecoverRollsBack(c *gocheck.C) {
+	var calls []string
+	var results []Result
+	backward := func(name string) Backward {
+		return func(ctx BWContext) {
+			calls = append(calls, name)
+			results = append(results, ctx.FWResult)
+			c.Check(ctx.Params, gocheck.DeepEquals, []interface{}{"myapp"})
+		}
+	}
+	forward := func(ctx FWContext) (Result, error) {
+		c.Error("Forward should not be called.")
+		return nil, nil
+	}
+	RegisterRecovery("test-rollback", &Recovery{
+		Actions: []*Action{
+			{Name: "first", Forward: forward, Backward: backward("first")},
+			{Name: "second", Forward: forward, Backward: backward("second"), DecodeResult: decodeCounter},
+			{Name: "third", Forward: forward, Backward: backward("third")},
+		},
+		EncodeParams: encodeName,
+		DecodeParams: decodeName,
+	})
+	id := s.insertPipeline(c, "test-rollback", expired, []interface{}{"one", bson.M{"n": 2}}, false)
+	err := Recover()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(calls, gocheck.DeepEquals, []string{"second", "first"})
+	c.Assert(results, gocheck.DeepEquals, []Result{&counter{N: 2}, "one"})
+	count, err := s.conn.Pipelines().FindId(id).Count()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(count, gocheck.Equals, 0)
+}
+
+func (s *PersistSuite) TestRecoverResumes(c *gocheck.C) {
+	var calls []string
+	RegisterRecovery("test-resume", &Recovery{
+		Actions: []*Action{
+			{
+				Name: "first",
+				Forward: func(ctx FWContext) (Result, error) {
+					c.Error("Forward of the first action should not be called.")
+					return nil, nil
+				},
+			},
+			{
+				Name: "second",
+				Forward: func(ctx FWContext) (Result, error) {
+					c.Check(ctx.Previous, gocheck.Equals, "one")
+					c.Check(ctx.Params, gocheck.DeepEquals, []interface{}{"myapp"})
+					calls = append(calls, "second")
+					return "two", nil
+				},
+			},
+			{
+				Name: "third",
+				Forward: func(ctx FWContext) (Result, error) {
+					c.Check(ctx.Previous, gocheck.Equals, "two")
+					calls = append(calls, "third")
+					return nil, nil
+				},
+			},
+		},
+		EncodeParams: encodeName,
+		DecodeParams: decodeName,
+		Resume:       true,
+	})
+	id := s.insertPipeline(c, "test-resume", expired, []interface{}{"one"}, false)
+	err := Recover()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(calls, gocheck.DeepEquals, []string{"second", "third"})
+	count, err := s.conn.Pipelines().FindId(id).Count()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(count, gocheck.Equals, 0)
+}
+
+func (s *PersistSuite) TestRecoverRollsBackPipelinesThatWereRollingBack(c *gocheck.C) {
+	var calls []string
+	RegisterRecovery("test-rolling-back", &Recovery{
+		Actions: []*Action{
+			{Name: "first", Backward: func(ctx BWContext) { calls = append(calls, "first") }},
+			{Name: "second"},
+			{Name: "third"},
+		},
+		EncodeParams: encodeName,
+		DecodeParams: decodeName,
+		Resume:       true,
+	})
+	s.insertPipeline(c, "test-rolling-back", expired, []interface{}{"one"}, true)
+	err := Recover()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(calls, gocheck.DeepEquals, []string{"first"})
+}
+
+func (s *PersistSuite) TestRecoverRecordsTheRollbackProgress(c *gocheck.C) {
+	var stored storedPipeline
+	RegisterRecovery("test-rollback-progress", &Recovery{
+		Actions: []*Action{
+			{
+				Name: "first",
+				Backward: func(ctx BWContext) {
+					err := s.conn.Pipelines().Find(bson.M{"name": "test-rollback-progress"}).One(&stored)
+					c.Check(err, gocheck.IsNil)
+				},
+			},
+			{Name: "second", Backward: func(ctx BWContext) {}},
+			{Name: "third"},
+		},
+		EncodeParams: encodeName,
+		DecodeParams: decodeName,
+	})
+	s.insertPipeline(c, "test-rollback-progress", expired, []interface{}{"one", "two"}, true)
+	err := Recover()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(stored.Results, gocheck.HasLen, 1)
+	var r string
+	err = stored.Results[0].Unmarshal(&r)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(r, gocheck.Equals, "one")
+}
+
+func (s *PersistSuite) TestRecoverMarksPipelinesThatCantBeRecoveredAsFailed(c *gocheck.C) {
+	RegisterRecovery("test-unrecoverable", &Recovery{
+		Actions:      []*Action{{Name: "first"}, {Name: "second"}},
+		EncodeParams: encodeName,
+		DecodeParams: decodeName,
+	})
+	id := s.insertPipeline(c, "test-unrecoverable", expired, []interface{}{"one"}, false)
+	err := Recover()
+	c.Assert(err, gocheck.IsNil)
+	var stored storedPipeline
+	err = s.conn.Pipelines().FindId(id).One(&stored)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(stored.Recoveries, gocheck.Equals, 1)
+	c.Assert(stored.Failed, gocheck.Equals, false)
+	err = s.conn.Pipelines().UpdateId(id, bson.M{"$set": bson.M{"lease": expired, "recoveries": maxRecoveries - 1}})
+	c.Assert(err, gocheck.IsNil)
+	err = Recover()
+	c.Assert(err, gocheck.IsNil)
+	err = s.conn.Pipelines().FindId(id).One(&stored)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(stored.Recoveries, gocheck.Equals, maxRecoveries)
+	c.Assert(stored.Failed, gocheck.Equals, true)
+	c.Assert(stored.Error, gocheck.Equals, `Unknown action "third".`)
+	err = s.conn.Pipelines().UpdateId(id, bson.M{"$set": bson.M{"lease": expired}})
+	c.Assert(err, gocheck.IsNil)
+	err = Recover()
+	c.Assert(err, gocheck.IsNil)
+	err = s.conn.Pipelines().FindId(id).One(&stored)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(stored.Recoveries, gocheck.Equals, maxRecoveries)
+}
+
+func (s *PersistSuite) TestRecoverIgnoresLeasedAndUnknownPipelines(c *gocheck.C) {
+	RegisterRecovery("test-other-owner", &Recovery{
+		Actions: []*Action{
+			{Name: "first", Backward: func(ctx BWContext) { c.Error("Backward should not be called.") }},
+		},
+		EncodeParams: encodeName,
+		DecodeParams: decodeName,
+	})
+	s.insertPipeline(c, "test-other-owner", time.Now().Add(time.Minute), []interface{}{"one"}, false)
+	s.insertPipeline(c, "unregistered", expired, []interface{}{"one"}, false)
+	err := Recover()
+	c.Assert(err, gocheck.IsNil)
+	count, err := s.conn.Pipelines().Count()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(count, gocheck.Equals, 2)
+}
+
+func (s *PersistSuite) TestRecoverTakesOverPipelinesWithoutLease(c *gocheck.C) {
+	var calls []string
+	RegisterRecovery("test-no-lease", &Recovery{
+		Actions: []*Action{
+			{Name: "first", Backward: func(ctx BWContext) { calls = append(calls, "first") }},
+			{Name: "second"},
+			{Name: "third"},
+		},
+		EncodeParams: encodeName,
+		DecodeParams: decodeName,
+	})
+	id := s.insertPipeline(c, "test-no-lease", expired, []interface{}{"one"}, false)
+	err := s.conn.Pipelines().UpdateId(id, bson.M{"$unset": bson.M{"lease": 1}})
+	c.Assert(err, gocheck.IsNil)
+	err = Recover()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(calls, gocheck.DeepEquals, []string{"first"})
+}
+
+func (s *PersistSuite) TestRenewLeases(c *gocheck.C) {
+	running := bson.NewObjectId()
+	err := s.conn.Pipelines().Insert(bson.M{"_id": running, "owner": processID, "lease": expired})
+	c.Assert(err, gocheck.IsNil)
+	other := s.insertPipeline(c, "test-renew", expired, nil, false)
+	hold(running)
+	hold(other)
+	defer release(running)
+	defer release(other)
+	renewLeases()
+	var stored storedPipeline
+	err = s.conn.Pipelines().FindId(running).One(&stored)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(stored.Lease.After(time.Now()), gocheck.Equals, true)
+	err = s.conn.Pipelines().FindId(other).One(&stored)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(stored.Lease.After(time.Now()), gocheck.Equals, false)
+}
@@ -0,0 +1,217 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package action
+
+import (
+	"errors"
+	"launchpad.net/gocheck"
+	"sync/atomic"
+	"time"
+)
+
+func (s *S) TestExecuteRetriesForward(c *gocheck.C) {
+	var calls int
+	actions := []*Action{
+		{
+			Name: "flaky",
+			Forward: func(ctx FWContext) (Result, error) {
+				calls++
+				if calls < 3 {
+					return nil, errors.New("temporary failure")
+				}
+				return "ok", nil
+			},
+			Retry: RetryPolicy{Attempts: 3, Backoff: time.Millisecond},
+		},
+	}
+	pipeline := NewPipeline(actions...)
+	err := pipeline.Execute()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(calls, gocheck.Equals, 3)
+	c.Assert(pipeline.Result(), gocheck.Equals, "ok")
+	c.Assert(pipeline.Failure(), gocheck.IsNil)
+}
+
+func (s *S) TestExecuteReportsTheFailedAttempt(c *gocheck.C) {
+	var calls int
+	var rolledBack bool
+	failure := errors.New("persistent failure")
+	actions := []*Action{
+		{
+			Name: "first",
+			Forward: func(ctx FWContext) (Result, error) {
+				return "ok", nil
+			},
+			Backward: func(ctx BWContext) {
+				rolledBack = true
+			},
+		},
+		{
+			Name: "broken",
+			Forward: func(ctx FWContext) (Result, error) {
+				calls++
+				return nil, failure
+			},
+			Retry: RetryPolicy{Attempts: 2, Backoff: time.Millisecond},
+		},
+	}
+	pipeline := NewPipeline(actions...)
+	err := pipeline.Execute()
+	c.Assert(err, gocheck.Equals, failure)
+	c.Assert(calls, gocheck.Equals, 2)
+	c.Assert(rolledBack, gocheck.Equals, true)
+	c.Assert(pipeline.Failure(), gocheck.DeepEquals, &Failure{Action: "broken", Attempt: 2, Err: failure})
+}
+
+func (s *S) TestExecuteDoesNotRetryErrorsThatAreNotRetryable(c *gocheck.C) {
+	var calls int
+	actions := []*Action{
+		{
+			Name: "broken",
+			Forward: func(ctx FWContext) (Result, error) {
+				calls++
+				return nil, errors.New("fatal failure")
+			},
+			Retry: RetryPolicy{
+				Attempts:  5,
+				Backoff:   time.Millisecond,
+				Retryable: func(err error) bool { return err.Error() != "fatal failure" },
+			},
+		},
+	}
+	pipeline := NewPipeline(actions...)
+	err := pipeline.Execute()
+	c.Assert(err, gocheck.NotNil)
+	c.Assert(calls, gocheck.Equals, 1)
+	c.Assert(pipeline.Failure().Attempt, gocheck.Equals, 1)
+}
+
+func (s *S) TestExecuteTimeout(c *gocheck.C) {
+	undone := make(chan Result, 1)
+	actions := []*Action{
+		{
+			Name: "slow",
+			Forward: func(ctx FWContext) (Result, error) {
+				time.Sleep(100 * time.Millisecond)
+				return "ok", nil
+			},
+			Backward: func(ctx BWContext) {
+				undone <- ctx.FWResult
+			},
+			Timeout: 10 * time.Millisecond,
+		},
+	}
+	pipeline := NewPipeline(actions...)
+	start := time.Now()
+	err := pipeline.Execute()
+	c.Assert(err, gocheck.Equals, ErrTimeout)
+	c.Assert(time.Since(start) < 100*time.Millisecond, gocheck.Equals, true)
+	c.Assert(pipeline.Failure(), gocheck.DeepEquals, &Failure{Action: "slow", Attempt: 1, Err: ErrTimeout})
+	select {
+	case r := <-undone:
+		c.Assert(r, gocheck.Equals, "ok")
+	case <-time.After(5 * time.Second):
+		c.Fatal("The late success was not undone.")
+	}
+}
+
+func (s *S) TestExecuteTimeoutUndoesTheAbandonedCallAfterRetrying(c *gocheck.C) {
+	var calls int32
+	undone := make(chan Result, 2)
+	actions := []*Action{
+		{
+			Name: "slow",
+			Forward: func(ctx FWContext) (Result, error) {
+				n := atomic.AddInt32(&calls, 1)
+				if n == 1 {
+					time.Sleep(100 * time.Millisecond)
+				}
+				return n, nil
+			},
+			Backward: func(ctx BWContext) {
+				undone <- ctx.FWResult
+			},
+			Retry:   RetryPolicy{Attempts: 2},
+			Timeout: 10 * time.Millisecond,
+		},
+	}
+	pipeline := NewPipeline(actions...)
+	err := pipeline.Execute()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(pipeline.Result(), gocheck.Equals, int32(2))
+	select {
+	case r := <-undone:
+		c.Assert(r, gocheck.Equals, int32(1))
+	case <-time.After(5 * time.Second):
+		c.Fatal("The late success was not undone.")
+	}
+}
+
+func (s *S) TestExecuteTimeoutRetries(c *gocheck.C) {
+	var calls int32
+	actions := []*Action{
+		{
+			Name: "slow",
+			Forward: func(ctx FWContext) (Result, error) {
+				if atomic.AddInt32(&calls, 1) == 1 {
+					time.Sleep(100 * time.Millisecond)
+				}
+				return "ok", nil
+			},
+			Retry:   RetryPolicy{Attempts: 2, Backoff: 200 * time.Millisecond},
+			Timeout: 10 * time.Millisecond,
+		},
+	}
+	pipeline := NewPipeline(actions...)
+	err := pipeline.Execute()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(atomic.LoadInt32(&calls), gocheck.Equals, int32(2))
+}
+
+func (s *S) TestExecuteTimeoutPropagatesPanics(c *gocheck.C) {
+	actions := []*Action{
+		{
+			Name: "panicking",
+			Forward: func(ctx FWContext) (Result, error) {
+				panic("something went wrong")
+			},
+			Timeout: time.Second,
+		},
+	}
+	defer func() {
+		c.Assert(recover(), gocheck.Equals, "something went wrong")
+	}()
+	NewPipeline(actions...).Execute()
+	c.Fatal("Execute should panic.")
+}
+
+func (s *S) TestFailureWithoutCallingForward(c *gocheck.C) {
+	actions := []*Action{
+		{
+			Name: "needs-params",
+			Forward: func(ctx FWContext) (Result, error) {
+				return nil, nil
+			},
+			MinParams: 1,
+		},
+	}
+	pipeline := NewPipeline(actions...)
+	err := pipeline.Execute()
+	c.Assert(err, gocheck.NotNil)
+	c.Assert(pipeline.Failure().Attempt, gocheck.Equals, 0)
+}
+
+func (s *S) TestFailureError(c *gocheck.C) {
+	f := Failure{Action: "create-repository", Attempt: 3, Err: errors.New("connection refused")}
+	c.Assert(f.Error(), gocheck.Equals, "The create-repository action failed on attempt 3: connection refused")
+}
+
+func (s *S) TestRetryPolicyNext(c *gocheck.C) {
+	p := RetryPolicy{Backoff: time.Second, MaxBackoff: 3 * time.Second}
+	c.Assert(p.next(time.Second), gocheck.Equals, 2*time.Second)
+	c.Assert(p.next(2*time.Second), gocheck.Equals, 3*time.Second)
+	p.MaxBackoff = 0
+	c.Assert(p.next(4*time.Second), gocheck.Equals, 8*time.Second)
+}
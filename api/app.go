@@ -14,7 +14,6 @@ import (
 	"github.com/globocom/tsuru/auth"
 	"github.com/globocom/tsuru/db"
 	"github.com/globocom/tsuru/errors"
-	"github.com/globocom/tsuru/log"
 	"github.com/globocom/tsuru/quota"
 	"github.com/globocom/tsuru/rec"
 	"github.com/globocom/tsuru/repository"
@@ -32,10 +31,7 @@ func getApp(name string, u *auth.User) (app.App, error) {
 	if err != nil {
 		return app, &errors.HTTP{Code: http.StatusNotFound, Message: fmt.Sprintf("App %s not found.", name)}
 	}
-	if u.IsAdmin() {
-		return app, nil
-	}
-	if !auth.CheckUserAccess(app.Teams, u) {
+	if !u.HasPermission(auth.PermAppRead, app.Name, app.Teams) {
 		return app, &errors.HTTP{Code: http.StatusForbidden, Message: "User does not have access to this app"}
 	}
 	return app, nil
@@ -53,7 +49,76 @@ func cloneRepository(w http.ResponseWriter, r *http.Request, t *auth.Token) erro
 		return &errors.HTTP{Code: http.StatusNotFound, Message: fmt.Sprintf("App %s not found.", instance.Name)}
 	}
 	logger := app.LogWriter{App: instance, Writer: w}
-	return app.Provisioner.Deploy(instance, version, &logger)
+	return instance.Deploy(version, tokenOwner(t), &logger)
+}
+
+func rollback(w http.ResponseWriter, r *http.Request, t *auth.Token) error {
+	version := r.PostFormValue("version")
+	if version == "" {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: "Missing parameter version"}
+	}
+	u, err := t.User()
+	if err != nil {
+		return err
+	}
+	appName := r.URL.Query().Get(":app")
+	rec.Log(u.Email, "rollback", "app="+appName, "version="+version)
+	instance, err := getApp(appName, u)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "text")
+	logger := app.LogWriter{App: &instance, Writer: w}
+	err = instance.Rollback(version, u.Email, &logger)
+	if _, ok := err.(*app.DeployNotFoundError); ok {
+		return &errors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+	}
+	if err == app.ErrRollbackNotSupported {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	return err
+}
+
+func deploysList(w http.ResponseWriter, r *http.Request, t *auth.Token) error {
+	u, err := t.User()
+	if err != nil {
+		return err
+	}
+	appName := r.URL.Query().Get(":app")
+	rec.Log(u.Email, "app-deploys", "app="+appName)
+	instance, err := getApp(appName, u)
+	if err != nil {
+		return err
+	}
+	deploys, err := instance.Deploys()
+	if err != nil {
+		return err
+	}
+	if len(deploys) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	return json.NewEncoder(w).Encode(deploys)
+}
+
+func deployInfo(w http.ResponseWriter, r *http.Request, t *auth.Token) error {
+	u, err := t.User()
+	if err != nil {
+		return err
+	}
+	id := r.URL.Query().Get(":id")
+	rec.Log(u.Email, "deploy-info", "id="+id)
+	d, err := app.GetDeploy(id)
+	if err != nil {
+		return &errors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+	}
+	if !t.Allows(auth.PermAppRead, d.App) {
+		return &errors.HTTP{Code: http.StatusForbidden, Message: errTokenNotAllowed.Error()}
+	}
+	if _, err := getApp(d.App, u); err != nil {
+		return err
+	}
+	return json.NewEncoder(w).Encode(d)
 }
 
 func appIsAvailable(w http.ResponseWriter, r *http.Request, t *auth.Token) error {
@@ -94,6 +159,15 @@ func appList(w http.ResponseWriter, r *http.Request, t *auth.Token) error {
 	if err != nil {
 		return err
 	}
+	if t.Scope == auth.TokenScopeApp {
+		var allowed []app.App
+		for _, a := range apps {
+			if t.Allows(auth.PermAppRead, a.Name) {
+				allowed = append(allowed, a)
+			}
+		}
+		apps = allowed
+	}
 	if len(apps) == 0 {
 		w.WriteHeader(http.StatusNoContent)
 		return nil
@@ -119,14 +193,58 @@ func appInfo(w http.ResponseWriter, r *http.Request, t *auth.Token) error {
 	return json.NewEncoder(w).Encode(&app)
 }
 
-func createApp(w http.ResponseWriter, r *http.Request, t *auth.Token) error {
+// appCreationError converts the errors of app creation to HTTP errors.
+func appCreationError(err error) error {
+	if e, ok := err.(*errors.ValidationError); ok {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: e.Message}
+	}
+	if _, ok := err.(app.NoTeamsError); ok {
+		return &errors.HTTP{
+			Code:    http.StatusBadRequest,
+			Message: "In order to create an app, you should be member of at least one team",
+		}
+	}
+	if e, ok := err.(*app.AppCreationError); ok {
+		if e.Err == app.ErrAppAlreadyExists {
+			return &errors.HTTP{Code: http.StatusConflict, Message: e.Error()}
+		}
+		if _, ok := e.Err.(*quota.QuotaExceededError); ok {
+			return &errors.HTTP{
+				Code:    http.StatusForbidden,
+				Message: "Quota exceeded",
+			}
+		}
+	}
+	return err
+}
+
+func decodeApp(r *http.Request) (*app.App, error) {
 	var a app.App
 	defer r.Body.Close()
 	body, err := ioutil.ReadAll(r.Body)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	if err = json.Unmarshal(body, &a); err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+// dryRunHandler calls dryRun instead of fn when the request has the dry-run
+// parameter, so dry runs are not recorded as events.
+func dryRunHandler(dryRun, fn authorizationRequiredHandler) authorizationRequiredHandler {
+	return func(w http.ResponseWriter, r *http.Request, t *auth.Token) error {
+		if ok, _ := strconv.ParseBool(r.URL.Query().Get("dry-run")); ok {
+			return dryRun(w, r, t)
+		}
+		return fn(w, r, t)
+	}
+}
+
+func createApp(w http.ResponseWriter, r *http.Request, t *auth.Token, evt *rec.Event) error {
+	a, err := decodeApp(r)
+	if err != nil {
 		return err
 	}
 	u, err := t.User()
@@ -134,30 +252,10 @@ func createApp(w http.ResponseWriter, r *http.Request, t *auth.Token) error {
 		return err
 	}
 	rec.Log(u.Email, "create-app", "name="+a.Name, "platform="+a.Platform)
-	err = app.CreateApp(&a, u)
+	err = app.CreateApp(a, u, stepObservers(evt, r)...)
 	if err != nil {
-		log.Printf("Got error while creating app: %s", err)
-		if e, ok := err.(*errors.ValidationError); ok {
-			return &errors.HTTP{Code: http.StatusBadRequest, Message: e.Message}
-		}
-		if _, ok := err.(app.NoTeamsError); ok {
-			return &errors.HTTP{
-				Code:    http.StatusBadRequest,
-				Message: "In order to create an app, you should be member of at least one team",
-			}
-		}
-		if e, ok := err.(*app.AppCreationError); ok {
-			if e.Err == app.ErrAppAlreadyExists {
-				return &errors.HTTP{Code: http.StatusConflict, Message: e.Error()}
-			}
-			if _, ok := e.Err.(*quota.QuotaExceededError); ok {
-				return &errors.HTTP{
-					Code:    http.StatusForbidden,
-					Message: "Quota exceeded",
-				}
-			}
-		}
-		return err
+		requestLog(r, t).Errorf("Got error while creating app: %s", err)
+		return appCreationError(err)
 	}
 	msg := map[string]string{
 		"status":         "success",
@@ -171,6 +269,25 @@ func createApp(w http.ResponseWriter, r *http.Request, t *auth.Token) error {
 	return nil
 }
 
+// createAppDryRun validates the creation of an app, without creating it, and
+// returns the steps of the creation.
+func createAppDryRun(w http.ResponseWriter, r *http.Request, t *auth.Token) error {
+	a, err := decodeApp(r)
+	if err != nil {
+		return err
+	}
+	u, err := t.User()
+	if err != nil {
+		return err
+	}
+	rec.Log(u.Email, "create-app-dry-run", "name="+a.Name, "platform="+a.Platform)
+	steps, err := app.CreateAppDryRun(a, u)
+	if err != nil {
+		return appCreationError(err)
+	}
+	return json.NewEncoder(w).Encode(map[string]interface{}{"status": "dry-run", "steps": steps})
+}
+
 func numberOfUnits(r *http.Request) (uint, error) {
 	missingMsg := "You must provide the number of units."
 	if r.Body == nil {
@@ -493,6 +610,44 @@ func setCName(w http.ResponseWriter, r *http.Request, t *auth.Token) error {
 	return err
 }
 
+func setResources(w http.ResponseWriter, r *http.Request, t *auth.Token) error {
+	msg := "You must provide the memory or the cpu-shares."
+	if r.Body == nil {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: msg}
+	}
+	var v map[string]int
+	err := json.NewDecoder(r.Body).Decode(&v)
+	if err != nil {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: "Invalid JSON in request body."}
+	}
+	memory, hasMemory := v["memory"]
+	cpuShares, hasCpuShares := v["cpu-shares"]
+	if !hasMemory && !hasCpuShares {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: msg}
+	}
+	u, err := t.User()
+	if err != nil {
+		return err
+	}
+	appName := r.URL.Query().Get(":app")
+	rec.Log(u.Email, "set-resources", "app="+appName, fmt.Sprintf("memory=%d", memory), fmt.Sprintf("cpu-shares=%d", cpuShares))
+	instance, err := getApp(appName, u)
+	if err != nil {
+		return err
+	}
+	if !hasMemory {
+		memory = instance.Memory
+	}
+	if !hasCpuShares {
+		cpuShares = instance.CpuShares
+	}
+	err = instance.SetResources(memory, cpuShares)
+	if err == app.ErrInvalidResources {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	return err
+}
+
 func unsetCName(w http.ResponseWriter, r *http.Request, t *auth.Token) error {
 	u, err := t.User()
 	if err != nil {
@@ -520,7 +675,11 @@ func appLog(w http.ResponseWriter, r *http.Request, t *auth.Token) error {
 		return &errors.HTTP{Code: http.StatusBadRequest, Message: `Parameter "lines" is mandatory.`}
 	}
 	w.Header().Set("Content-Type", "application/json")
-	source := r.URL.Query().Get("source")
+	filter := app.LogFilter{
+		Source: r.URL.Query().Get("source"),
+		Unit:   r.URL.Query().Get("unit"),
+	}
+	follow := r.URL.Query().Get("follow") == "1"
 	u, err := t.User()
 	if err != nil {
 		return err
@@ -530,10 +689,13 @@ func appLog(w http.ResponseWriter, r *http.Request, t *auth.Token) error {
 		"app=" + appName,
 		fmt.Sprintf("lines=%d", lines),
 	}
-	if source != "" {
-		extra = append(extra, "source="+source)
+	if filter.Source != "" {
+		extra = append(extra, "source="+filter.Source)
 	}
-	if r.URL.Query().Get("follow") == "1" {
+	if filter.Unit != "" {
+		extra = append(extra, "unit="+filter.Unit)
+	}
+	if follow {
 		extra = append(extra, "follow=1")
 	}
 	rec.Log(u.Email, "app-log", extra...)
@@ -541,27 +703,46 @@ func appLog(w http.ResponseWriter, r *http.Request, t *auth.Token) error {
 	if err != nil {
 		return err
 	}
-	logs, err := a.LastLogs(lines, source)
+	// The listener is created before reading the last logs, so no log is
+	// lost between the two.
+	var l *app.LogListener
+	if follow {
+		l = app.NewLogListener(&a, filter)
+		defer l.Close()
+	}
+	logs, err := a.LastLogs(lines, filter)
 	if err != nil {
 		return err
 	}
 	encoder := json.NewEncoder(w)
 	err = encoder.Encode(logs)
-	if err != nil {
+	if err != nil || !follow {
 		return err
 	}
-	// TODO(fss): write an automated test for this code.
-	if r.URL.Query().Get("follow") == "1" {
-		l := app.NewLogListener(&a)
-		defer l.Close()
-		for log := range l.C {
-			err := encoder.Encode([]app.Applog{log})
-			if err != nil {
-				break
+	var last app.Applog
+	if len(logs) > 0 {
+		last = logs[len(logs)-1]
+	}
+	var closed <-chan bool
+	if notifier, ok := w.(http.CloseNotifier); ok {
+		closed = notifier.CloseNotify()
+	}
+	for {
+		select {
+		case log, ok := <-l.C:
+			if !ok {
+				return nil
+			}
+			if !log.After(&last) {
+				continue
+			}
+			if err := encoder.Encode([]app.Applog{log}); err != nil {
+				return nil
 			}
+		case <-closed:
+			return nil
 		}
 	}
-	return nil
 }
 
 func getServiceInstance(instanceName, appName string, u *auth.User) (*service.ServiceInstance, *app.App, error) {
@@ -653,8 +834,9 @@ func addLog(w http.ResponseWriter, r *http.Request, t *auth.Token) error {
 	}
 	var logs []string
 	err = json.Unmarshal(body, &logs)
+	unit := r.URL.Query().Get("unit")
 	for _, log := range logs {
-		err := app.Log(log, "app")
+		err := app.UnitLog(log, "app", unit)
 		if err != nil {
 			return err
 		}
@@ -663,6 +845,123 @@ func addLog(w http.ResponseWriter, r *http.Request, t *auth.Token) error {
 	return nil
 }
 
+// drainURL reads the URL of a log drain from the JSON request body.
+func drainURL(r *http.Request) (string, error) {
+	msg := "You must provide the URL of the drain."
+	if r.Body == nil {
+		return "", &errors.HTTP{Code: http.StatusBadRequest, Message: msg}
+	}
+	var v map[string]string
+	err := json.NewDecoder(r.Body).Decode(&v)
+	if err != nil {
+		return "", &errors.HTTP{Code: http.StatusBadRequest, Message: "Invalid JSON in request body."}
+	}
+	if v["url"] == "" {
+		return "", &errors.HTTP{Code: http.StatusBadRequest, Message: msg}
+	}
+	return v["url"], nil
+}
+
+func addLogDrain(w http.ResponseWriter, r *http.Request, t *auth.Token) error {
+	drain, err := drainURL(r)
+	if err != nil {
+		return err
+	}
+	u, err := t.User()
+	if err != nil {
+		return err
+	}
+	appName := r.URL.Query().Get(":app")
+	rec.Log(u.Email, "add-log-drain", "app="+appName, "url="+drain)
+	a, err := getApp(appName, u)
+	if err != nil {
+		return err
+	}
+	err = a.AddLogDrain(drain)
+	switch err {
+	case app.ErrInvalidDrainURL, app.ErrPrivateDrainURL:
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	case app.ErrDrainAlreadyExists:
+		return &errors.HTTP{Code: http.StatusConflict, Message: err.Error()}
+	}
+	return err
+}
+
+func removeLogDrain(w http.ResponseWriter, r *http.Request, t *auth.Token) error {
+	drain, err := drainURL(r)
+	if err != nil {
+		return err
+	}
+	u, err := t.User()
+	if err != nil {
+		return err
+	}
+	appName := r.URL.Query().Get(":app")
+	rec.Log(u.Email, "remove-log-drain", "app="+appName, "url="+drain)
+	a, err := getApp(appName, u)
+	if err != nil {
+		return err
+	}
+	err = a.RemoveLogDrain(drain)
+	if err == app.ErrDrainNotFound {
+		return &errors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+	}
+	return err
+}
+
+func listLogDrains(w http.ResponseWriter, r *http.Request, t *auth.Token) error {
+	u, err := t.User()
+	if err != nil {
+		return err
+	}
+	appName := r.URL.Query().Get(":app")
+	rec.Log(u.Email, "list-log-drains", "app="+appName)
+	a, err := getApp(appName, u)
+	if err != nil {
+		return err
+	}
+	drains, err := a.LogDrains()
+	if err != nil {
+		return err
+	}
+	if len(drains) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	return json.NewEncoder(w).Encode(drains)
+}
+
+// setLogRetention overrides the global retention of the logs of the app.
+// Empty values fall back to the global retention, unless no-defaults is true.
+func setLogRetention(w http.ResponseWriter, r *http.Request, t *auth.Token) error {
+	u, err := t.User()
+	if err != nil {
+		return err
+	}
+	retention := app.LogRetention{
+		MaxAge:     r.PostFormValue("max-age"),
+		NoDefaults: r.PostFormValue("no-defaults") == "true",
+	}
+	if v := r.PostFormValue("max-entries"); v != "" {
+		retention.MaxEntries, err = strconv.Atoi(v)
+		if err != nil {
+			return &errors.HTTP{Code: http.StatusBadRequest, Message: app.ErrInvalidLogMaxEntries.Error()}
+		}
+	}
+	appName := r.URL.Query().Get(":app")
+	rec.Log(u.Email, "set-log-retention", "app="+appName, "max-age="+retention.MaxAge,
+		fmt.Sprintf("max-entries=%d", retention.MaxEntries), fmt.Sprintf("no-defaults=%t", retention.NoDefaults))
+	a := app.App{Name: appName}
+	if err := a.Get(); err != nil {
+		return &errors.HTTP{Code: http.StatusNotFound, Message: fmt.Sprintf("App %s not found.", appName)}
+	}
+	err = a.SetLogRetention(retention)
+	if err == app.ErrInvalidLogMaxAge || err == app.ErrInvalidLogMaxEntries {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	return err
+}
+
 func platformList(w http.ResponseWriter, r *http.Request, t *auth.Token) error {
 	u, err := t.User()
 	if err != nil {
@@ -691,6 +990,11 @@ func swap(w http.ResponseWriter, r *http.Request, t *auth.Token) error {
 	if err != nil {
 		return err
 	}
+	for _, a := range []app.App{app1, app2} {
+		if !u.HasPermission(auth.PermAppUpdate, a.Name, a.Teams) {
+			return &errors.HTTP{Code: http.StatusForbidden, Message: "You don't have permission to do this action."}
+		}
+	}
 	rec.Log(u.Email, "swap", app1Name, app2Name)
 	return app.Swap(&app1, &app2)
 }
@@ -96,6 +96,60 @@ func (s *S) TestCloneRepositoryHandler(c *gocheck.C) {
 	c.Assert(s.provisioner.Version(&a), gocheck.Equals, "a345f3e")
 }
 
+func (s *S) TestCloneRepositoryStoresTheDeployInTheHistory(c *gocheck.C) {
+	a := app.App{
+		Name:     "otherapp",
+		Platform: "zend",
+		Teams:    []string{s.team.Name},
+		Units:    []app.Unit{{Name: "i-0800", State: "started"}},
+	}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	defer s.conn.Deploys().RemoveAll(bson.M{"app": a.Name})
+	s.provisioner.Provision(&a)
+	defer s.provisioner.Destroy(&a)
+	url := fmt.Sprintf("/apps/%s/repository/clone?:appname=%s", a.Name, a.Name)
+	request, err := http.NewRequest("POST", url, strings.NewReader("version=a345f3e"))
+	c.Assert(err, gocheck.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	err = cloneRepository(recorder, request, s.token)
+	c.Assert(err, gocheck.IsNil)
+	var d app.Deploy
+	err = s.conn.Deploys().Find(bson.M{"app": a.Name}).One(&d)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(d.Version, gocheck.Equals, "a345f3e")
+	c.Assert(d.Image, gocheck.Equals, "tsuru/otherapp:a345f3e")
+	c.Assert(d.User, gocheck.Equals, s.user.Email)
+}
+
+func (s *S) TestCloneRepositoryWithAppTokenStoresTheTokenOwner(c *gocheck.C) {
+	a := app.App{
+		Name:     "otherapp",
+		Platform: "zend",
+		Teams:    []string{s.team.Name},
+		Units:    []app.Unit{{Name: "i-0800", State: "started"}},
+	}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	defer s.conn.Deploys().RemoveAll(bson.M{"app": a.Name})
+	s.provisioner.Provision(&a)
+	defer s.provisioner.Destroy(&a)
+	url := fmt.Sprintf("/apps/%s/repository/clone?:appname=%s", a.Name, a.Name)
+	request, err := http.NewRequest("POST", url, strings.NewReader("version=a345f3e"))
+	c.Assert(err, gocheck.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	err = cloneRepository(recorder, request, &auth.Token{AppName: "otherapp"})
+	c.Assert(err, gocheck.IsNil)
+	var d app.Deploy
+	err = s.conn.Deploys().Find(bson.M{"app": a.Name}).One(&d)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(d.User, gocheck.Equals, "app:otherapp")
+}
+
 func (s *S) TestCloneRepositoryShouldReturnNotFoundWhenAppDoesNotExist(c *gocheck.C) {
 	request, err := http.NewRequest("POST", "/apps/abc/repository/clone?:appname=abc", strings.NewReader("version=abcdef"))
 	c.Assert(err, gocheck.IsNil)
@@ -345,6 +399,45 @@ func (s *S) TestAppInfoReturnsNotFoundWhenAppDoesNotExist(c *gocheck.C) {
 	c.Assert(e, gocheck.ErrorMatches, "^App SomeApp not found.$")
 }
 
+func (s *S) TestCreateAppHandlerDryRun(c *gocheck.C) {
+	defer s.conn.Events().RemoveAll(nil)
+	b := strings.NewReader(`{"name":"someapp","platform":"zend"}`)
+	request, err := http.NewRequest("POST", "/apps?dry-run=true", b)
+	c.Assert(err, gocheck.IsNil)
+	request.Header.Set("Content-Type", "application/json")
+	recorder := httptest.NewRecorder()
+	handler := dryRunHandler(createAppDryRun, recordEventSteps("app-create", "app", "name", createApp))
+	err = handler(recorder, request, s.token)
+	c.Assert(err, gocheck.IsNil)
+	var result struct {
+		Status string
+		Steps  []string
+	}
+	err = json.NewDecoder(recorder.Body).Decode(&result)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(result.Status, gocheck.Equals, "dry-run")
+	c.Assert(result.Steps, gocheck.Not(gocheck.HasLen), 0)
+	c.Assert(result.Steps[0], gocheck.Equals, "reserve-user-app")
+	n, err := s.conn.Apps().Find(bson.M{"name": "someapp"}).Count()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(n, gocheck.Equals, 0)
+	n, err = s.conn.Events().Find(nil).Count()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(n, gocheck.Equals, 0)
+}
+
+func (s *S) TestCreateAppHandlerDryRunInvalidName(c *gocheck.C) {
+	b := strings.NewReader(`{"name":"1nvalid","platform":"zend"}`)
+	request, err := http.NewRequest("POST", "/apps?dry-run=true", b)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = createAppDryRun(recorder, request, s.token)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.HTTP)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusBadRequest)
+}
+
 func (s *S) TestCreateAppHandler(c *gocheck.C) {
 	h := testHandler{}
 	ts := s.t.StartGandalfTestServer(&h)
@@ -361,7 +454,7 @@ func (s *S) TestCreateAppHandler(c *gocheck.C) {
 	c.Assert(err, gocheck.IsNil)
 	request.Header.Set("Content-Type", "application/json")
 	recorder := httptest.NewRecorder()
-	err = createApp(recorder, request, s.token)
+	err = createApp(recorder, request, s.token, nil)
 	c.Assert(err, gocheck.IsNil)
 	body, err := ioutil.ReadAll(recorder.Body)
 	c.Assert(err, gocheck.IsNil)
@@ -396,7 +489,7 @@ func (s *S) TestCreateAppQuotaExceeded(c *gocheck.C) {
 	c.Assert(err, gocheck.IsNil)
 	request.Header.Set("Content-Type", "application/json")
 	recorder := httptest.NewRecorder()
-	err = createApp(recorder, request, s.token)
+	err = createApp(recorder, request, s.token, nil)
 	c.Assert(err, gocheck.NotNil)
 	e, ok := err.(*errors.HTTP)
 	c.Assert(ok, gocheck.Equals, true)
@@ -410,7 +503,7 @@ func (s *S) TestCreateAppInvalidName(c *gocheck.C) {
 	c.Assert(err, gocheck.IsNil)
 	request.Header.Set("Content-Type", "application/json")
 	recorder := httptest.NewRecorder()
-	err = createApp(recorder, request, s.token)
+	err = createApp(recorder, request, s.token, nil)
 	c.Assert(err, gocheck.NotNil)
 	e, ok := err.(*errors.HTTP)
 	c.Assert(ok, gocheck.Equals, true)
@@ -434,7 +527,7 @@ func (s *S) TestCreateAppReturns400IfTheUserIsNotMemberOfAnyTeam(c *gocheck.C) {
 	c.Assert(err, gocheck.IsNil)
 	request.Header.Set("Content-Type", "application/json")
 	recorder := httptest.NewRecorder()
-	err = createApp(recorder, request, token)
+	err = createApp(recorder, request, token, nil)
 	c.Assert(err, gocheck.NotNil)
 	e, ok := err.(*errors.HTTP)
 	c.Assert(ok, gocheck.Equals, true)
@@ -456,7 +549,7 @@ func (s *S) TestCreateAppReturnsConflictWithProperMessageWhenTheAppAlreadyExist(
 	c.Assert(err, gocheck.IsNil)
 	request.Header.Set("Content-Type", "application/json")
 	recorder := httptest.NewRecorder()
-	err = createApp(recorder, request, s.token)
+	err = createApp(recorder, request, s.token, nil)
 	c.Assert(err, gocheck.NotNil)
 	c.Assert(err, gocheck.ErrorMatches, ".*there is already an app with this name.*")
 	e, ok := err.(*errors.HTTP)
@@ -1682,6 +1775,98 @@ func (s *S) TestSetCNameHandler(c *gocheck.C) {
 	c.Assert(action, testing.IsRecorded)
 }
 
+func (s *S) TestSetResourcesHandler(c *gocheck.C) {
+	a := app.App{Name: "leper", Teams: []string{s.team.Name}}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	url := fmt.Sprintf("/apps/%s/resources?:app=%s", a.Name, a.Name)
+	b := strings.NewReader(`{"memory":512,"cpu-shares":256}`)
+	request, err := http.NewRequest("POST", url, b)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = setResources(recorder, request, s.token)
+	c.Assert(err, gocheck.IsNil)
+	err = a.Get()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(a.Memory, gocheck.Equals, 512)
+	c.Assert(a.CpuShares, gocheck.Equals, 256)
+	action := testing.Action{
+		Action: "set-resources",
+		User:   s.user.Email,
+		Extra:  []interface{}{"app=" + a.Name, "memory=512", "cpu-shares=256"},
+	}
+	c.Assert(action, testing.IsRecorded)
+}
+
+func (s *S) TestSetResourcesHandlerKeepsMissingValues(c *gocheck.C) {
+	a := app.App{Name: "leper", Teams: []string{s.team.Name}, Memory: 512, CpuShares: 256}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	url := fmt.Sprintf("/apps/%s/resources?:app=%s", a.Name, a.Name)
+	b := strings.NewReader(`{"memory":1024}`)
+	request, err := http.NewRequest("POST", url, b)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = setResources(recorder, request, s.token)
+	c.Assert(err, gocheck.IsNil)
+	err = a.Get()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(a.Memory, gocheck.Equals, 1024)
+	c.Assert(a.CpuShares, gocheck.Equals, 256)
+}
+
+func (s *S) TestSetResourcesHandlerNegativeValues(c *gocheck.C) {
+	a := app.App{Name: "leper", Teams: []string{s.team.Name}}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	url := fmt.Sprintf("/apps/%s/resources?:app=%s", a.Name, a.Name)
+	b := strings.NewReader(`{"memory":-1}`)
+	request, err := http.NewRequest("POST", url, b)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = setResources(recorder, request, s.token)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.HTTP)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusBadRequest)
+	c.Assert(e.Message, gocheck.Equals, app.ErrInvalidResources.Error())
+}
+
+func (s *S) TestSetResourcesHandlerReturnsBadRequestWhenValuesAreMissing(c *gocheck.C) {
+	bodies := []io.Reader{nil, strings.NewReader(`{}`), strings.NewReader(`{"name":1}`)}
+	for _, b := range bodies {
+		request, err := http.NewRequest("POST", "/apps/unknown/resources?:app=unknown", b)
+		c.Assert(err, gocheck.IsNil)
+		recorder := httptest.NewRecorder()
+		err = setResources(recorder, request, s.token)
+		c.Check(err, gocheck.NotNil)
+		e, ok := err.(*errors.HTTP)
+		c.Check(ok, gocheck.Equals, true)
+		c.Check(e.Code, gocheck.Equals, http.StatusBadRequest)
+		c.Check(e.Message, gocheck.Equals, "You must provide the memory or the cpu-shares.")
+	}
+}
+
+func (s *S) TestSetResourcesHandlerUserWithoutAccessToTheApp(c *gocheck.C) {
+	a := app.App{Name: "lost"}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	url := fmt.Sprintf("/apps/%s/resources?:app=%s", a.Name, a.Name)
+	b := strings.NewReader(`{"memory":512}`)
+	request, err := http.NewRequest("POST", url, b)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = setResources(recorder, request, s.token)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.HTTP)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusForbidden)
+}
+
 func (s *S) TestSetCNameHandlerAcceptsEmptyCName(c *gocheck.C) {
 	a := app.App{Name: "leper", Teams: []string{s.team.Name}, CName: "leper.secretcompany.com"}
 	err := s.conn.Apps().Insert(a)
@@ -1997,6 +2182,165 @@ func (s *S) TestAppLogSelectBySource(c *gocheck.C) {
 	c.Assert(action, testing.IsRecorded)
 }
 
+func (s *S) TestAppLogSelectByUnit(c *gocheck.C) {
+	a := app.App{
+		Name:     "lost",
+		Platform: "vougan",
+		Teams:    []string{s.team.Name},
+	}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	defer s.conn.Logs().RemoveAll(bson.M{"appname": a.Name})
+	a.UnitLog("log from unit 0", "app", "lost/0")
+	a.UnitLog("log from unit 1", "app", "lost/1")
+	url := fmt.Sprintf("/apps/%s/log/?:app=%s&unit=lost/1&lines=10", a.Name, a.Name)
+	request, err := http.NewRequest("GET", url, nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = appLog(recorder, request, s.token)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(recorder.Code, gocheck.Equals, http.StatusOK)
+	var logs []app.Applog
+	err = json.NewDecoder(recorder.Body).Decode(&logs)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(logs, gocheck.HasLen, 1)
+	c.Assert(logs[0].Message, gocheck.Equals, "log from unit 1")
+	c.Assert(logs[0].Unit, gocheck.Equals, "lost/1")
+	action := testing.Action{
+		Action: "app-log",
+		User:   s.user.Email,
+		Extra:  []interface{}{"app=" + a.Name, "lines=10", "unit=lost/1"},
+	}
+	c.Assert(action, testing.IsRecorded)
+}
+
+// streamRecorder is a ResponseWriter that sends each write to a channel, and
+// notifies the handler when the test closes it.
+type streamRecorder struct {
+	header http.Header
+	writes chan []byte
+	closed chan bool
+}
+
+func newStreamRecorder() *streamRecorder {
+	return &streamRecorder{
+		header: make(http.Header),
+		writes: make(chan []byte, 10),
+		closed: make(chan bool, 1),
+	}
+}
+
+func (r *streamRecorder) Header() http.Header {
+	return r.header
+}
+
+func (r *streamRecorder) Write(data []byte) (int, error) {
+	r.writes <- append([]byte(nil), data...)
+	return len(data), nil
+}
+
+func (r *streamRecorder) WriteHeader(int) {}
+
+func (r *streamRecorder) CloseNotify() <-chan bool {
+	return r.closed
+}
+
+func (r *streamRecorder) next(c *gocheck.C) []app.Applog {
+	select {
+	case data := <-r.writes:
+		var logs []app.Applog
+		err := json.Unmarshal(data, &logs)
+		c.Assert(err, gocheck.IsNil)
+		return logs
+	case <-time.After(5 * time.Second):
+		c.Fatal("Timed out waiting for logs.")
+	}
+	return nil
+}
+
+func (s *S) TestAppLogFollow(c *gocheck.C) {
+	a := app.App{
+		Name:     "lost",
+		Platform: "vougan",
+		Teams:    []string{s.team.Name},
+	}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	defer s.conn.Logs().RemoveAll(bson.M{"appname": a.Name})
+	a.Log("old log", "app")
+	url := fmt.Sprintf("/apps/%s/log/?:app=%s&lines=10&source=app&follow=1", a.Name, a.Name)
+	request, err := http.NewRequest("GET", url, nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := newStreamRecorder()
+	result := make(chan error)
+	go func() {
+		result <- appLog(recorder, request, s.token)
+	}()
+	logs := recorder.next(c)
+	c.Assert(logs, gocheck.HasLen, 1)
+	c.Assert(logs[0].Message, gocheck.Equals, "old log")
+	a.Log("ignored log", "tsuru")
+	a.Log("new log", "app")
+	logs = recorder.next(c)
+	c.Assert(logs, gocheck.HasLen, 1)
+	c.Assert(logs[0].Message, gocheck.Equals, "new log")
+	recorder.closed <- true
+	select {
+	case err := <-result:
+		c.Assert(err, gocheck.IsNil)
+	case <-time.After(5 * time.Second):
+		c.Fatal("The handler did not stop after the client went away.")
+	}
+	action := testing.Action{
+		Action: "app-log",
+		User:   s.user.Email,
+		Extra:  []interface{}{"app=" + a.Name, "lines=10", "source=app", "follow=1"},
+	}
+	c.Assert(action, testing.IsRecorded)
+}
+
+func (s *S) TestAppLogFollowSendsLogsWrittenInTheSameMillisecondOfTheLastLog(c *gocheck.C) {
+	a := app.App{
+		Name:     "lost",
+		Platform: "vougan",
+		Teams:    []string{s.team.Name},
+	}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	defer s.conn.Logs().RemoveAll(bson.M{"appname": a.Name})
+	date := time.Now().Add(time.Hour).Truncate(time.Second)
+	old := app.Applog{ID: bson.NewObjectId(), Date: date, Message: "old log", Source: "app", AppName: a.Name}
+	err = s.conn.Logs().Insert(old)
+	c.Assert(err, gocheck.IsNil)
+	url := fmt.Sprintf("/apps/%s/log/?:app=%s&lines=10&follow=1", a.Name, a.Name)
+	request, err := http.NewRequest("GET", url, nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := newStreamRecorder()
+	result := make(chan error)
+	go func() {
+		result <- appLog(recorder, request, s.token)
+	}()
+	logs := recorder.next(c)
+	c.Assert(logs, gocheck.HasLen, 1)
+	c.Assert(logs[0].Message, gocheck.Equals, "old log")
+	same := app.Applog{ID: bson.NewObjectId(), Date: date, Message: "same millisecond", Source: "app", AppName: a.Name}
+	err = s.conn.LogStream().Insert(same)
+	c.Assert(err, gocheck.IsNil)
+	logs = recorder.next(c)
+	c.Assert(logs, gocheck.HasLen, 1)
+	c.Assert(logs[0].Message, gocheck.Equals, "same millisecond")
+	recorder.closed <- true
+	select {
+	case err := <-result:
+		c.Assert(err, gocheck.IsNil)
+	case <-time.After(5 * time.Second):
+		c.Fatal("The handler did not stop after the client went away.")
+	}
+}
+
 func (s *S) TestAppLogSelectByLinesShouldReturnTheLastestEntries(c *gocheck.C) {
 	a := app.App{
 		Name:     "lost",
@@ -2477,37 +2821,278 @@ func (s *S) TestRestartHandler(c *gocheck.C) {
 	c.Assert(action, testing.IsRecorded)
 }
 
-func (s *S) TestRestartHandlerReturns404IfTheAppDoesNotExist(c *gocheck.C) {
-	request, err := http.NewRequest("GET", "/apps/unknown/restart?:app=unknown", nil)
+func (s *S) TestRollbackHandler(c *gocheck.C) {
+	a := app.App{
+		Name:  "stress",
+		Teams: []string{s.team.Name},
+		Units: []app.Unit{{Name: "i-0800", State: "started"}},
+	}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	defer s.conn.Logs().Remove(bson.M{"appname": a.Name})
+	defer s.conn.Deploys().RemoveAll(bson.M{"app": a.Name})
+	s.provisioner.Provision(&a)
+	defer s.provisioner.Destroy(&a)
+	err = a.Deploy("a345f3e", s.user.Email, ioutil.Discard)
+	c.Assert(err, gocheck.IsNil)
+	err = a.Deploy("b456f3e", s.user.Email, ioutil.Discard)
+	c.Assert(err, gocheck.IsNil)
+	url := fmt.Sprintf("/apps/%s/rollback?:app=%s", a.Name, a.Name)
+	request, err := http.NewRequest("POST", url, strings.NewReader("version=a345"))
+	c.Assert(err, gocheck.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	err = rollback(recorder, request, s.token)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(recorder.Header().Get("Content-Type"), gocheck.Equals, "text")
+	c.Assert(recorder.Body.String(), gocheck.Matches, "(?s).*Rollback called$")
+	c.Assert(s.provisioner.Image(&a), gocheck.Equals, "tsuru/stress:a345f3e")
+	action := testing.Action{
+		Action: "rollback",
+		User:   s.user.Email,
+		Extra:  []interface{}{"app=" + a.Name, "version=a345"},
+	}
+	c.Assert(action, testing.IsRecorded)
+}
+
+func (s *S) TestRollbackHandlerWithoutVersion(c *gocheck.C) {
+	request, err := http.NewRequest("POST", "/apps/stress/rollback?:app=stress", nil)
 	c.Assert(err, gocheck.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 	recorder := httptest.NewRecorder()
-	err = restart(recorder, request, s.token)
+	err = rollback(recorder, request, s.token)
 	c.Assert(err, gocheck.NotNil)
 	e, ok := err.(*errors.HTTP)
 	c.Assert(ok, gocheck.Equals, true)
-	c.Assert(e.Code, gocheck.Equals, http.StatusNotFound)
+	c.Assert(e.Code, gocheck.Equals, http.StatusBadRequest)
+	c.Assert(e.Message, gocheck.Equals, "Missing parameter version")
 }
 
-func (s *S) TestRestartHandlerReturns403IfTheUserDoesNotHaveAccessToTheApp(c *gocheck.C) {
-	a := app.App{Name: "nightmist"}
+func (s *S) TestRollbackHandlerUnknownVersion(c *gocheck.C) {
+	a := app.App{
+		Name:  "stress",
+		Teams: []string{s.team.Name},
+	}
 	err := s.conn.Apps().Insert(a)
 	c.Assert(err, gocheck.IsNil)
 	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
-	defer s.conn.Logs().Remove(bson.M{"appname": a.Name})
-	url := fmt.Sprintf("/apps/%s/restart?:app=%s", a.Name, a.Name)
-	request, err := http.NewRequest("GET", url, nil)
+	url := fmt.Sprintf("/apps/%s/rollback?:app=%s", a.Name, a.Name)
+	request, err := http.NewRequest("POST", url, strings.NewReader("version=a345f3e"))
 	c.Assert(err, gocheck.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 	recorder := httptest.NewRecorder()
-	err = restart(recorder, request, s.token)
+	err = rollback(recorder, request, s.token)
 	c.Assert(err, gocheck.NotNil)
 	e, ok := err.(*errors.HTTP)
 	c.Assert(ok, gocheck.Equals, true)
-	c.Assert(e.Code, gocheck.Equals, http.StatusForbidden)
+	c.Assert(e.Code, gocheck.Equals, http.StatusNotFound)
 }
 
-func (s *S) TestAddLogHandler(c *gocheck.C) {
-	a := app.App{
-		Name:     "myapp",
+func (s *S) TestRollbackHandlerReturns404IfTheAppDoesNotExist(c *gocheck.C) {
+	request, err := http.NewRequest("POST", "/apps/unknown/rollback?:app=unknown", strings.NewReader("version=a345f3e"))
+	c.Assert(err, gocheck.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	err = rollback(recorder, request, s.token)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.HTTP)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusNotFound)
+}
+
+func (s *S) TestDeploysListHandler(c *gocheck.C) {
+	a := app.App{
+		Name:  "stress",
+		Teams: []string{s.team.Name},
+	}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	defer s.conn.Deploys().RemoveAll(bson.M{"app": a.Name})
+	s.provisioner.Provision(&a)
+	defer s.provisioner.Destroy(&a)
+	err = a.Deploy("a345f3e", s.user.Email, ioutil.Discard)
+	c.Assert(err, gocheck.IsNil)
+	err = a.Deploy("b456f3e", s.user.Email, ioutil.Discard)
+	c.Assert(err, gocheck.IsNil)
+	url := fmt.Sprintf("/apps/%s/deploys?:app=%s", a.Name, a.Name)
+	request, err := http.NewRequest("GET", url, nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = deploysList(recorder, request, s.token)
+	c.Assert(err, gocheck.IsNil)
+	var deploys []app.Deploy
+	err = json.Unmarshal(recorder.Body.Bytes(), &deploys)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(deploys, gocheck.HasLen, 2)
+	c.Assert(deploys[0].Version, gocheck.Equals, "b456f3e")
+	c.Assert(deploys[0].Status, gocheck.Equals, app.DeploySuccess)
+	c.Assert(deploys[1].Version, gocheck.Equals, "a345f3e")
+	action := testing.Action{
+		Action: "app-deploys",
+		User:   s.user.Email,
+		Extra:  []interface{}{"app=" + a.Name},
+	}
+	c.Assert(action, testing.IsRecorded)
+}
+
+func (s *S) TestDeploysListHandlerReturns204IfThereAreNoDeploys(c *gocheck.C) {
+	a := app.App{
+		Name:  "stress",
+		Teams: []string{s.team.Name},
+	}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	url := fmt.Sprintf("/apps/%s/deploys?:app=%s", a.Name, a.Name)
+	request, err := http.NewRequest("GET", url, nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = deploysList(recorder, request, s.token)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(recorder.Code, gocheck.Equals, http.StatusNoContent)
+}
+
+func (s *S) TestDeploysListHandlerReturns403IfTheUserDoesNotHaveAccessToTheApp(c *gocheck.C) {
+	a := app.App{Name: "nightmist"}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	url := fmt.Sprintf("/apps/%s/deploys?:app=%s", a.Name, a.Name)
+	request, err := http.NewRequest("GET", url, nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = deploysList(recorder, request, s.token)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.HTTP)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusForbidden)
+}
+
+func (s *S) TestDeployInfoHandler(c *gocheck.C) {
+	a := app.App{
+		Name:  "stress",
+		Teams: []string{s.team.Name},
+	}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	defer s.conn.Deploys().RemoveAll(bson.M{"app": a.Name})
+	s.provisioner.Provision(&a)
+	defer s.provisioner.Destroy(&a)
+	err = a.Deploy("a345f3e", s.user.Email, ioutil.Discard)
+	c.Assert(err, gocheck.IsNil)
+	var stored app.Deploy
+	err = s.conn.Deploys().Find(bson.M{"app": a.Name}).One(&stored)
+	c.Assert(err, gocheck.IsNil)
+	id := stored.ID.Hex()
+	request, err := http.NewRequest("GET", "/deploys/"+id+"?:id="+id, nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = deployInfo(recorder, request, s.token)
+	c.Assert(err, gocheck.IsNil)
+	var d app.Deploy
+	err = json.Unmarshal(recorder.Body.Bytes(), &d)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(d.ID, gocheck.Equals, stored.ID)
+	c.Assert(d.Version, gocheck.Equals, "a345f3e")
+	c.Assert(d.Log, gocheck.Equals, "Deploy called")
+	action := testing.Action{
+		Action: "deploy-info",
+		User:   s.user.Email,
+		Extra:  []interface{}{"id=" + id},
+	}
+	c.Assert(action, testing.IsRecorded)
+}
+
+func (s *S) TestDeployInfoHandlerReturns404IfTheDeployDoesNotExist(c *gocheck.C) {
+	id := bson.NewObjectId().Hex()
+	request, err := http.NewRequest("GET", "/deploys/"+id+"?:id="+id, nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = deployInfo(recorder, request, s.token)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.HTTP)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusNotFound)
+}
+
+func (s *S) TestDeployInfoHandlerReturns403IfTheUserDoesNotHaveAccessToTheApp(c *gocheck.C) {
+	a := app.App{Name: "nightmist"}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	d := app.Deploy{ID: bson.NewObjectId(), App: a.Name, Version: "a345f3e"}
+	err = s.conn.Deploys().Insert(d)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Deploys().RemoveId(d.ID)
+	id := d.ID.Hex()
+	request, err := http.NewRequest("GET", "/deploys/"+id+"?:id="+id, nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = deployInfo(recorder, request, s.token)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.HTTP)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusForbidden)
+}
+
+func (s *S) TestDeployInfoHandlerReturns403IfTheTokenDoesNotAllowTheApp(c *gocheck.C) {
+	a := app.App{Name: "stress", Teams: []string{s.team.Name}}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	d := app.Deploy{ID: bson.NewObjectId(), App: a.Name, Version: "a345f3e"}
+	err = s.conn.Deploys().Insert(d)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Deploys().RemoveId(d.ID)
+	token, err := s.user.CreateAPIToken("ci", auth.TokenScopeRead, []string{"otherapp"}, time.Hour)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Tokens().Remove(bson.M{"token": token.Token})
+	id := d.ID.Hex()
+	request, err := http.NewRequest("GET", "/deploys/"+id+"?:id="+id, nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = deployInfo(recorder, request, token)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.HTTP)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusForbidden)
+	c.Assert(e.Message, gocheck.Equals, errTokenNotAllowed.Error())
+}
+
+func (s *S) TestRestartHandlerReturns404IfTheAppDoesNotExist(c *gocheck.C) {
+	request, err := http.NewRequest("GET", "/apps/unknown/restart?:app=unknown", nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = restart(recorder, request, s.token)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.HTTP)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusNotFound)
+}
+
+func (s *S) TestRestartHandlerReturns403IfTheUserDoesNotHaveAccessToTheApp(c *gocheck.C) {
+	a := app.App{Name: "nightmist"}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	defer s.conn.Logs().Remove(bson.M{"appname": a.Name})
+	url := fmt.Sprintf("/apps/%s/restart?:app=%s", a.Name, a.Name)
+	request, err := http.NewRequest("GET", url, nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = restart(recorder, request, s.token)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.HTTP)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusForbidden)
+}
+
+func (s *S) TestAddLogHandler(c *gocheck.C) {
+	a := app.App{
+		Name:     "myapp",
 		Platform: "zend",
 	}
 	err := s.conn.Apps().Insert(a)
@@ -2526,7 +3111,7 @@ func (s *S) TestAddLogHandler(c *gocheck.C) {
 		"message 2",
 		"message 3",
 	}
-	logs, err := a.LastLogs(3, "")
+	logs, err := a.LastLogs(3, app.LogFilter{})
 	c.Assert(err, gocheck.IsNil)
 	got := make([]string, len(logs))
 	for i, l := range logs {
@@ -2536,6 +3121,312 @@ func (s *S) TestAddLogHandler(c *gocheck.C) {
 	c.Assert(got, gocheck.DeepEquals, want)
 }
 
+func (s *S) TestAddLogHandlerWithUnit(c *gocheck.C) {
+	a := app.App{
+		Name:     "myapp",
+		Platform: "zend",
+	}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	defer s.conn.Logs().RemoveAll(bson.M{"appname": a.Name})
+	b := strings.NewReader(`["message 1"]`)
+	request, err := http.NewRequest("POST", "/apps/myapp/log/?:app=myapp&unit=myapp/0", b)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = addLog(recorder, request, s.token)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(recorder.Code, gocheck.Equals, http.StatusOK)
+	logs, err := a.LastLogs(1, app.LogFilter{Unit: "myapp/0"})
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(logs, gocheck.HasLen, 1)
+	c.Assert(logs[0].Message, gocheck.Equals, "message 1")
+	c.Assert(logs[0].Source, gocheck.Equals, "app")
+}
+
+func (s *S) TestAddLogDrainHandler(c *gocheck.C) {
+	a := app.App{Name: "leper", Teams: []string{s.team.Name}}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	defer s.conn.LogDrains().RemoveAll(bson.M{"appname": a.Name})
+	url := fmt.Sprintf("/apps/%s/log-drains?:app=%s", a.Name, a.Name)
+	b := strings.NewReader(`{"url":"syslog://logs.example.com:514"}`)
+	request, err := http.NewRequest("POST", url, b)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = addLogDrain(recorder, request, s.token)
+	c.Assert(err, gocheck.IsNil)
+	drains, err := a.LogDrains()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(drains, gocheck.DeepEquals, []app.LogDrain{{AppName: a.Name, URL: "syslog://logs.example.com:514"}})
+	action := testing.Action{
+		Action: "add-log-drain",
+		User:   s.user.Email,
+		Extra:  []interface{}{"app=" + a.Name, "url=syslog://logs.example.com:514"},
+	}
+	c.Assert(action, testing.IsRecorded)
+}
+
+func (s *S) TestAddLogDrainHandlerWithoutURL(c *gocheck.C) {
+	url := "/apps/leper/log-drains?:app=leper"
+	request, err := http.NewRequest("POST", url, strings.NewReader(`{}`))
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = addLogDrain(recorder, request, s.token)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.HTTP)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusBadRequest)
+	c.Assert(e.Message, gocheck.Equals, "You must provide the URL of the drain.")
+}
+
+func (s *S) TestAddLogDrainHandlerInvalidURL(c *gocheck.C) {
+	a := app.App{Name: "leper", Teams: []string{s.team.Name}}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	url := fmt.Sprintf("/apps/%s/log-drains?:app=%s", a.Name, a.Name)
+	b := strings.NewReader(`{"url":"ftp://logs.example.com"}`)
+	request, err := http.NewRequest("POST", url, b)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = addLogDrain(recorder, request, s.token)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.HTTP)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusBadRequest)
+	c.Assert(e.Message, gocheck.Equals, app.ErrInvalidDrainURL.Error())
+}
+
+func (s *S) TestAddLogDrainHandlerPrivateURL(c *gocheck.C) {
+	a := app.App{Name: "leper", Teams: []string{s.team.Name}}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	url := fmt.Sprintf("/apps/%s/log-drains?:app=%s", a.Name, a.Name)
+	b := strings.NewReader(`{"url":"http://169.254.169.254/latest"}`)
+	request, err := http.NewRequest("POST", url, b)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = addLogDrain(recorder, request, s.token)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.HTTP)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusBadRequest)
+	c.Assert(e.Message, gocheck.Equals, app.ErrPrivateDrainURL.Error())
+}
+
+func (s *S) TestAddLogDrainHandlerDuplicate(c *gocheck.C) {
+	a := app.App{Name: "leper", Teams: []string{s.team.Name}}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	defer s.conn.LogDrains().RemoveAll(bson.M{"appname": a.Name})
+	err = a.AddLogDrain("syslog://logs.example.com:514")
+	c.Assert(err, gocheck.IsNil)
+	url := fmt.Sprintf("/apps/%s/log-drains?:app=%s", a.Name, a.Name)
+	b := strings.NewReader(`{"url":"syslog://logs.example.com:514"}`)
+	request, err := http.NewRequest("POST", url, b)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = addLogDrain(recorder, request, s.token)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.HTTP)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusConflict)
+}
+
+func (s *S) TestAddLogDrainHandlerUserWithoutAccessToTheApp(c *gocheck.C) {
+	a := app.App{Name: "leper"}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	url := fmt.Sprintf("/apps/%s/log-drains?:app=%s", a.Name, a.Name)
+	b := strings.NewReader(`{"url":"syslog://logs.example.com:514"}`)
+	request, err := http.NewRequest("POST", url, b)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = addLogDrain(recorder, request, s.token)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.HTTP)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusForbidden)
+}
+
+func (s *S) TestRemoveLogDrainHandler(c *gocheck.C) {
+	a := app.App{Name: "leper", Teams: []string{s.team.Name}}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	defer s.conn.LogDrains().RemoveAll(bson.M{"appname": a.Name})
+	err = a.AddLogDrain("syslog://logs.example.com:514")
+	c.Assert(err, gocheck.IsNil)
+	url := fmt.Sprintf("/apps/%s/log-drains?:app=%s", a.Name, a.Name)
+	b := strings.NewReader(`{"url":"syslog://logs.example.com:514"}`)
+	request, err := http.NewRequest("DELETE", url, b)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = removeLogDrain(recorder, request, s.token)
+	c.Assert(err, gocheck.IsNil)
+	drains, err := a.LogDrains()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(drains, gocheck.HasLen, 0)
+	action := testing.Action{
+		Action: "remove-log-drain",
+		User:   s.user.Email,
+		Extra:  []interface{}{"app=" + a.Name, "url=syslog://logs.example.com:514"},
+	}
+	c.Assert(action, testing.IsRecorded)
+}
+
+func (s *S) TestRemoveLogDrainHandlerNotFound(c *gocheck.C) {
+	a := app.App{Name: "leper", Teams: []string{s.team.Name}}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	url := fmt.Sprintf("/apps/%s/log-drains?:app=%s", a.Name, a.Name)
+	b := strings.NewReader(`{"url":"syslog://logs.example.com:514"}`)
+	request, err := http.NewRequest("DELETE", url, b)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = removeLogDrain(recorder, request, s.token)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.HTTP)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusNotFound)
+	c.Assert(e.Message, gocheck.Equals, app.ErrDrainNotFound.Error())
+}
+
+func (s *S) TestListLogDrainsHandler(c *gocheck.C) {
+	a := app.App{Name: "leper", Teams: []string{s.team.Name}}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	defer s.conn.LogDrains().RemoveAll(bson.M{"appname": a.Name})
+	err = a.AddLogDrain("syslog://logs.example.com:514")
+	c.Assert(err, gocheck.IsNil)
+	err = a.AddLogDrain("https://logs.example.com/drain")
+	c.Assert(err, gocheck.IsNil)
+	url := fmt.Sprintf("/apps/%s/log-drains?:app=%s", a.Name, a.Name)
+	request, err := http.NewRequest("GET", url, nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = listLogDrains(recorder, request, s.token)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(recorder.Code, gocheck.Equals, http.StatusOK)
+	var drains []app.LogDrain
+	err = json.NewDecoder(recorder.Body).Decode(&drains)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(drains, gocheck.HasLen, 2)
+	action := testing.Action{
+		Action: "list-log-drains",
+		User:   s.user.Email,
+		Extra:  []interface{}{"app=" + a.Name},
+	}
+	c.Assert(action, testing.IsRecorded)
+}
+
+func (s *S) TestListLogDrainsHandlerNoContent(c *gocheck.C) {
+	a := app.App{Name: "leper", Teams: []string{s.team.Name}}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	url := fmt.Sprintf("/apps/%s/log-drains?:app=%s", a.Name, a.Name)
+	request, err := http.NewRequest("GET", url, nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = listLogDrains(recorder, request, s.token)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(recorder.Code, gocheck.Equals, http.StatusNoContent)
+}
+
+func (s *S) TestSetLogRetentionHandler(c *gocheck.C) {
+	a := app.App{Name: "leper"}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	url := fmt.Sprintf("/apps/%s/log-retention?:app=%s", a.Name, a.Name)
+	body := strings.NewReader("max-age=24h&max-entries=1000")
+	request, err := http.NewRequest("POST", url, body)
+	c.Assert(err, gocheck.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	err = setLogRetention(recorder, request, s.token)
+	c.Assert(err, gocheck.IsNil)
+	err = a.Get()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(a.LogRetention, gocheck.DeepEquals, app.LogRetention{MaxAge: "24h", MaxEntries: 1000})
+	action := testing.Action{
+		Action: "set-log-retention",
+		User:   s.user.Email,
+		Extra:  []interface{}{"app=" + a.Name, "max-age=24h", "max-entries=1000", "no-defaults=false"},
+	}
+	c.Assert(action, testing.IsRecorded)
+}
+
+func (s *S) TestSetLogRetentionHandlerWithoutDefaults(c *gocheck.C) {
+	a := app.App{Name: "leper"}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	url := fmt.Sprintf("/apps/%s/log-retention?:app=%s", a.Name, a.Name)
+	body := strings.NewReader("max-entries=1000&no-defaults=true")
+	request, err := http.NewRequest("POST", url, body)
+	c.Assert(err, gocheck.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	err = setLogRetention(recorder, request, s.token)
+	c.Assert(err, gocheck.IsNil)
+	err = a.Get()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(a.LogRetention, gocheck.DeepEquals, app.LogRetention{MaxEntries: 1000, NoDefaults: true})
+}
+
+func (s *S) TestSetLogRetentionHandlerInvalidMaxAge(c *gocheck.C) {
+	a := app.App{Name: "leper"}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	url := fmt.Sprintf("/apps/%s/log-retention?:app=%s", a.Name, a.Name)
+	request, err := http.NewRequest("POST", url, strings.NewReader("max-age=forever"))
+	c.Assert(err, gocheck.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	err = setLogRetention(recorder, request, s.token)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.HTTP)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusBadRequest)
+	c.Assert(e.Message, gocheck.Equals, app.ErrInvalidLogMaxAge.Error())
+}
+
+func (s *S) TestSetLogRetentionHandlerInvalidMaxEntries(c *gocheck.C) {
+	url := "/apps/leper/log-retention?:app=leper"
+	request, err := http.NewRequest("POST", url, strings.NewReader("max-entries=many"))
+	c.Assert(err, gocheck.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	err = setLogRetention(recorder, request, s.token)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.HTTP)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusBadRequest)
+}
+
+func (s *S) TestSetLogRetentionHandlerAppNotFound(c *gocheck.C) {
+	url := "/apps/unknown/log-retention?:app=unknown"
+	request, err := http.NewRequest("POST", url, strings.NewReader("max-age=24h"))
+	c.Assert(err, gocheck.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	err = setLogRetention(recorder, request, s.token)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.HTTP)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusNotFound)
+}
+
 func (s *S) TestPlatformList(c *gocheck.C) {
 	platforms := []app.Platform{
 		{Name: "python"},
@@ -2605,3 +3496,29 @@ func (s *S) TestSwap(c *gocheck.C) {
 	action := testing.Action{Action: "swap", User: s.user.Email, Extra: []interface{}{"app1", "app2"}}
 	c.Assert(action, testing.IsRecorded)
 }
+
+func (s *S) TestSwapRequiresUpdatePermissionOnBothApps(c *gocheck.C) {
+	app1 := app.App{Name: "app1", Teams: []string{s.team.Name}}
+	err := s.conn.Apps().Insert(&app1)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().RemoveId(&app1.Name)
+	app2 := app.App{Name: "app2", Teams: []string{s.team.Name}}
+	err = s.conn.Apps().Insert(&app2)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().RemoveId(&app2.Name)
+	roles := []auth.RoleAssignment{{Name: "app-viewer", Scope: auth.ScopeGlobal}}
+	user := &auth.User{Email: "viewer@tsuru.io", Password: "123456", Roles: roles}
+	err = user.Create()
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Users().Remove(bson.M{"email": user.Email})
+	token, err := user.CreateToken("123456")
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Tokens().Remove(bson.M{"token": token.Token})
+	request, _ := http.NewRequest("PUT", "/swap?app1=app1&app2=app2", nil)
+	recorder := httptest.NewRecorder()
+	err = swap(recorder, request, token)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.HTTP)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusForbidden)
+}
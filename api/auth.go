@@ -7,7 +7,6 @@ package api
 import (
 	"encoding/json"
 	"fmt"
-	"github.com/globocom/config"
 	"github.com/globocom/go-gandalfclient"
 	"github.com/globocom/tsuru/action"
 	"github.com/globocom/tsuru/app"
@@ -15,7 +14,6 @@ import (
 	"github.com/globocom/tsuru/auth"
 	"github.com/globocom/tsuru/db"
 	"github.com/globocom/tsuru/errors"
-	"github.com/globocom/tsuru/log"
 	"github.com/globocom/tsuru/quota"
 	"github.com/globocom/tsuru/rec"
 	"github.com/globocom/tsuru/repository"
@@ -40,78 +38,89 @@ func createUser(w http.ResponseWriter, r *http.Request) error {
 	if err != nil {
 		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
 	}
-	if !validation.ValidateEmail(u.Email) {
-		return &errors.HTTP{Code: http.StatusBadRequest, Message: emailError}
-	}
-	if !validation.ValidateLength(u.Password, passwordMinLen, passwordMaxLen) {
-		return &errors.HTTP{Code: http.StatusBadRequest, Message: passwordError}
-	}
-	gURL := repository.ServerURL()
-	c := gandalf.Client{Endpoint: gURL}
-	if _, err := c.NewUser(u.Email, keyToMap(u.Keys)); err != nil {
-		return fmt.Errorf("Failed to create user in the git server: %s", err)
+	scheme, err := auth.CurrentScheme()
+	if err != nil {
+		return err
 	}
-	if err := u.Create(); err == nil {
-		rec.Log(u.Email, "create-user")
-		if limit, err := config.GetUint("quota:apps-per-user"); err == nil {
-			quota.Create(u.Email, uint(limit))
+	_, err = scheme.Create(&u)
+	if err != nil {
+		if e, ok := err.(*errors.ValidationError); ok {
+			return &errors.HTTP{Code: http.StatusBadRequest, Message: e.Message}
 		}
-		w.WriteHeader(http.StatusCreated)
-		return nil
-	}
-	if _, err = auth.GetUserByEmail(u.Email); err == nil {
-		err = &errors.HTTP{Code: http.StatusConflict, Message: "This email is already registered"}
+		switch err {
+		case auth.ErrUserAlreadyExists:
+			return &errors.HTTP{Code: http.StatusConflict, Message: err.Error()}
+		case auth.ErrCreateNotSupported:
+			return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+		}
+		return err
 	}
-	return err
+	rec.Log(u.Email, "create-user")
+	w.WriteHeader(http.StatusCreated)
+	return nil
 }
 
+// login authenticates the user with the configured scheme. The request body
+// contains the parameters of the scheme, in JSON format, and the email may
+// also be given in the URL.
 func login(w http.ResponseWriter, r *http.Request) error {
-	var pass map[string]string
-	err := json.NewDecoder(r.Body).Decode(&pass)
+	var params map[string]string
+	err := json.NewDecoder(r.Body).Decode(&params)
 	if err != nil {
 		return &errors.HTTP{Code: http.StatusBadRequest, Message: "Invalid JSON"}
 	}
-	password, ok := pass["password"]
-	if !ok {
-		msg := "You must provide a password to login"
-		return &errors.HTTP{Code: http.StatusBadRequest, Message: msg}
+	if params == nil {
+		params = make(map[string]string)
+	}
+	if email := r.URL.Query().Get(":email"); email != "" {
+		params["email"] = email
 	}
-	u, err := auth.GetUserByEmail(r.URL.Query().Get(":email"))
+	scheme, err := auth.CurrentScheme()
 	if err != nil {
-		if e, ok := err.(*errors.ValidationError); ok {
-			return &errors.HTTP{Code: http.StatusBadRequest, Message: e.Message}
-		} else if err == auth.ErrUserNotFound {
-			return &errors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
-		}
 		return err
 	}
-	rec.Log(u.Email, "login")
-	t, err := u.CreateToken(password)
+	t, err := scheme.Login(params)
 	if err != nil {
-		switch err.(type) {
+		switch e := err.(type) {
 		case *errors.ValidationError:
-			return &errors.HTTP{
-				Code:    http.StatusBadRequest,
-				Message: err.(*errors.ValidationError).Message,
-			}
+			return &errors.HTTP{Code: http.StatusBadRequest, Message: e.Message}
 		case auth.AuthenticationFailure:
-			return &errors.HTTP{
-				Code:    http.StatusUnauthorized,
-				Message: err.Error(),
-			}
-		default:
-			return err
+			return &errors.HTTP{Code: http.StatusUnauthorized, Message: e.Error()}
 		}
+		if err == auth.ErrUserNotFound {
+			return &errors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+		}
+		return err
 	}
+	rec.Log(t.UserEmail, "login")
 	fmt.Fprintf(w, `{"token":"%s"}`, t.Token)
 	return nil
 }
 
 func logout(w http.ResponseWriter, r *http.Request, t *auth.Token) error {
-	auth.DeleteToken(t.Token)
+	scheme, err := auth.CurrentScheme()
+	if err != nil {
+		return err
+	}
+	scheme.Logout(t.Token)
 	return nil
 }
 
+// authScheme returns the name of the configured authentication scheme and
+// the information clients need to login with it.
+func authScheme(w http.ResponseWriter, r *http.Request) error {
+	scheme, err := auth.CurrentScheme()
+	if err != nil {
+		return err
+	}
+	info, err := scheme.Info()
+	if err != nil {
+		return err
+	}
+	result := map[string]interface{}{"name": auth.SchemeName(), "data": info}
+	return json.NewEncoder(w).Encode(result)
+}
+
 // ChangePassword changes the password from the logged in user.
 //
 // It reads the request body in JSON format. The JSON in the request body
@@ -315,7 +324,7 @@ func addUserToTeam(w http.ResponseWriter, r *http.Request, t *auth.Token) error
 	if err != nil {
 		return &errors.HTTP{Code: http.StatusNotFound, Message: "Team not found"}
 	}
-	if !team.ContainsUser(u) {
+	if !u.HasPermission(auth.PermTeamAdmin, "", []string{team.Name}) {
 		msg := fmt.Sprintf("You are not authorized to add new users to the team %s", team.Name)
 		return &errors.HTTP{Code: http.StatusUnauthorized, Message: msg}
 	}
@@ -372,7 +381,7 @@ func removeUserFromTeam(w http.ResponseWriter, r *http.Request, t *auth.Token) e
 	if err != nil {
 		return &errors.HTTP{Code: http.StatusNotFound, Message: "Team not found"}
 	}
-	if !team.ContainsUser(u) {
+	if !u.HasPermission(auth.PermTeamAdmin, "", []string{team.Name}) {
 		msg := fmt.Sprintf("You are not authorized to remove a member from the team %s", team.Name)
 		return &errors.HTTP{Code: http.StatusUnauthorized, Message: msg}
 	}
@@ -551,7 +560,7 @@ func removeUser(w http.ResponseWriter, r *http.Request, t *auth.Token) error {
 		return err
 	}
 	if err := c.RevokeAccess(alwdApps, []string{u.Email}); err != nil {
-		log.Printf("Failed to revoke access in Gandalf: %s", err)
+		requestLog(r, t).Errorf("Failed to revoke access in Gandalf: %s", err)
 		return fmt.Errorf("Failed to revoke acess from git repositories: %s", err)
 	}
 	teams, err := u.Teams()
@@ -582,7 +591,7 @@ Please remove the team, them remove the user.`, team.Name)
 	}
 	rec.Log(u.Email, "remove-user")
 	if err := c.RemoveUser(u.Email); err != nil {
-		log.Printf("Failed to remove user from gandalf: %s", err)
+		requestLog(r, t).Errorf("Failed to remove user from gandalf: %s", err)
 		return fmt.Errorf("Failed to remove the user from the git server: %s", err)
 	}
 	quota.Delete(u.Email)
@@ -461,6 +461,93 @@ func (s *AuthSuite) TestLoginShouldReturnBadRequestWhenPasswordIsInvalid(c *goch
 	}
 }
 
+func (s *AuthSuite) TestLoginWithTheEmailInTheBody(c *gocheck.C) {
+	b := bytes.NewBufferString(`{"email":"whydidifall@thewho.com","password":"123456"}`)
+	request, err := http.NewRequest("POST", "/auth/login", b)
+	c.Assert(err, gocheck.IsNil)
+	request.Header.Set("Content-type", "application/json")
+	recorder := httptest.NewRecorder()
+	err = login(recorder, request)
+	c.Assert(err, gocheck.IsNil)
+	var result map[string]string
+	err = json.NewDecoder(recorder.Body).Decode(&result)
+	c.Assert(err, gocheck.IsNil)
+	t, err := auth.GetToken("bearer " + result["token"])
+	c.Assert(err, gocheck.IsNil)
+	defer auth.DeleteToken(t.Token)
+	c.Assert(t.UserEmail, gocheck.Equals, s.user.Email)
+}
+
+func (s *AuthSuite) TestLoginWithUnknownScheme(c *gocheck.C) {
+	config.Set("auth:scheme", "unknown")
+	defer config.Unset("auth:scheme")
+	b := bytes.NewBufferString(`{"password":"123456"}`)
+	request, err := http.NewRequest("POST", "/users/whydidifall@thewho.com/tokens?:email=whydidifall@thewho.com", b)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = login(recorder, request)
+	c.Assert(err, gocheck.ErrorMatches, `^Unknown authentication scheme: "unknown".$`)
+}
+
+func (s *AuthSuite) TestCreateUserWithExternalScheme(c *gocheck.C) {
+	config.Set("auth:scheme", "ldap")
+	defer config.Unset("auth:scheme")
+	b := bytes.NewBufferString(`{"email":"nobody@me.myself","password":"123456"}`)
+	request, err := http.NewRequest("POST", "/users", b)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = createUser(recorder, request)
+	e, ok := err.(*errors.HTTP)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusBadRequest)
+	c.Assert(e.Message, gocheck.Equals, auth.ErrCreateNotSupported.Error())
+	_, err = auth.GetUserByEmail("nobody@me.myself")
+	c.Assert(err, gocheck.Equals, auth.ErrUserNotFound)
+}
+
+func (s *AuthSuite) TestAuthScheme(c *gocheck.C) {
+	request, err := http.NewRequest("GET", "/auth/scheme", nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = authScheme(recorder, request)
+	c.Assert(err, gocheck.IsNil)
+	var result map[string]interface{}
+	err = json.NewDecoder(recorder.Body).Decode(&result)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(result, gocheck.DeepEquals, map[string]interface{}{"name": "native", "data": nil})
+}
+
+func (s *AuthSuite) TestAuthSchemeOAuth(c *gocheck.C) {
+	settings := map[string]string{
+		"scheme":              "oauth",
+		"oauth:client-id":     "tsuru",
+		"oauth:client-secret": "s3cr3t",
+		"oauth:auth-url":      "https://auth.tsuru.io/authorize",
+		"oauth:token-url":     "https://auth.tsuru.io/token",
+		"oauth:info-url":      "https://auth.tsuru.io/info",
+		"oauth:callback-port": "35654",
+	}
+	for k, v := range settings {
+		config.Set("auth:"+k, v)
+		defer config.Unset("auth:" + k)
+	}
+	request, err := http.NewRequest("GET", "/auth/scheme", nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = authScheme(recorder, request)
+	c.Assert(err, gocheck.IsNil)
+	var result struct {
+		Name string
+		Data map[string]string
+	}
+	err = json.NewDecoder(recorder.Body).Decode(&result)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(result.Name, gocheck.Equals, "oauth")
+	expected := "https://auth.tsuru.io/authorize?client_id=tsuru&response_type=code&redirect_uri=__redirect_url__&state=__state__"
+	c.Assert(result.Data["authorizeUrl"], gocheck.Equals, expected)
+	c.Assert(result.Data["port"], gocheck.Equals, "35654")
+}
+
 func (s *AuthSuite) TestLogout(c *gocheck.C) {
 	token, err := s.user.CreateToken("123456")
 	c.Assert(err, gocheck.IsNil)
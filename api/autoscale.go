@@ -0,0 +1,82 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"github.com/globocom/tsuru/auth"
+	"github.com/globocom/tsuru/autoscale"
+	"github.com/globocom/tsuru/errors"
+	"github.com/globocom/tsuru/rec"
+	"net/http"
+	"time"
+)
+
+// setAutoscaleRule defines the autoscale rule of the app, replacing the
+// previous one. The rule is sent in json.
+func setAutoscaleRule(w http.ResponseWriter, r *http.Request, t *auth.Token) error {
+	u, err := t.User()
+	if err != nil {
+		return err
+	}
+	appName := r.URL.Query().Get(":app")
+	var rule autoscale.Rule
+	if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: "Invalid rule: " + err.Error()}
+	}
+	rec.Log(u.Email, "set-autoscale-rule", "app="+appName, "metric="+rule.Metric)
+	a, err := getApp(appName, u)
+	if err != nil {
+		return err
+	}
+	rule.App = a.Name
+	rule.LastScale = time.Time{}
+	if err := rule.Validate(); err != nil {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	return autoscale.SaveRule(&rule)
+}
+
+// getAutoscaleRule returns the autoscale rule of the app, in json.
+func getAutoscaleRule(w http.ResponseWriter, r *http.Request, t *auth.Token) error {
+	u, err := t.User()
+	if err != nil {
+		return err
+	}
+	appName := r.URL.Query().Get(":app")
+	rec.Log(u.Email, "get-autoscale-rule", "app="+appName)
+	a, err := getApp(appName, u)
+	if err != nil {
+		return err
+	}
+	rule, err := autoscale.GetRule(a.Name)
+	if err == autoscale.ErrRuleNotFound {
+		return &errors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+	}
+	if err != nil {
+		return err
+	}
+	return json.NewEncoder(w).Encode(rule)
+}
+
+// removeAutoscaleRule removes the autoscale rule of the app, disabling its
+// autoscaling.
+func removeAutoscaleRule(w http.ResponseWriter, r *http.Request, t *auth.Token) error {
+	u, err := t.User()
+	if err != nil {
+		return err
+	}
+	appName := r.URL.Query().Get(":app")
+	rec.Log(u.Email, "remove-autoscale-rule", "app="+appName)
+	a, err := getApp(appName, u)
+	if err != nil {
+		return err
+	}
+	err = autoscale.RemoveRule(a.Name)
+	if err == autoscale.ErrRuleNotFound {
+		return &errors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+	}
+	return err
+}
@@ -0,0 +1,155 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/globocom/tsuru/app"
+	"github.com/globocom/tsuru/autoscale"
+	"github.com/globocom/tsuru/errors"
+	"github.com/globocom/tsuru/testing"
+	"labix.org/v2/mgo/bson"
+	"launchpad.net/gocheck"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+)
+
+func (s *S) TestSetAutoscaleRuleHandler(c *gocheck.C) {
+	a := app.App{Name: "leper", Teams: []string{s.team.Name}}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	defer autoscale.RemoveRule(a.Name)
+	url := fmt.Sprintf("/apps/%s/autoscale?:app=%s", a.Name, a.Name)
+	body := strings.NewReader(`{"Metric":"cpu","MinUnits":1,"MaxUnits":5,"ScaleUp":80,"ScaleDown":20,"Cooldown":300}`)
+	request, err := http.NewRequest("POST", url, body)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = setAutoscaleRule(recorder, request, s.token)
+	c.Assert(err, gocheck.IsNil)
+	rule, err := autoscale.GetRule(a.Name)
+	c.Assert(err, gocheck.IsNil)
+	expected := autoscale.Rule{App: a.Name, Metric: "cpu", MinUnits: 1, MaxUnits: 5, ScaleUp: 80, ScaleDown: 20, Cooldown: 300}
+	c.Assert(*rule, gocheck.DeepEquals, expected)
+	action := testing.Action{
+		Action: "set-autoscale-rule",
+		User:   s.user.Email,
+		Extra:  []interface{}{"app=" + a.Name, "metric=cpu"},
+	}
+	c.Assert(action, testing.IsRecorded)
+}
+
+func (s *S) TestSetAutoscaleRuleHandlerInvalidRule(c *gocheck.C) {
+	a := app.App{Name: "leper", Teams: []string{s.team.Name}}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	url := fmt.Sprintf("/apps/%s/autoscale?:app=%s", a.Name, a.Name)
+	request, err := http.NewRequest("POST", url, strings.NewReader(`{"Metric":"disk"}`))
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = setAutoscaleRule(recorder, request, s.token)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.HTTP)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusBadRequest)
+	c.Assert(e.Message, gocheck.Equals, `Unknown metric: "disk".`)
+	_, err = autoscale.GetRule(a.Name)
+	c.Assert(err, gocheck.Equals, autoscale.ErrRuleNotFound)
+}
+
+func (s *S) TestSetAutoscaleRuleHandlerUserWithoutAccessToTheApp(c *gocheck.C) {
+	a := app.App{Name: "leper"}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	url := fmt.Sprintf("/apps/%s/autoscale?:app=%s", a.Name, a.Name)
+	request, err := http.NewRequest("POST", url, strings.NewReader(`{"Metric":"cpu"}`))
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = setAutoscaleRule(recorder, request, s.token)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.HTTP)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusForbidden)
+}
+
+func (s *S) TestGetAutoscaleRuleHandler(c *gocheck.C) {
+	a := app.App{Name: "leper", Teams: []string{s.team.Name}}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	rule := autoscale.Rule{App: a.Name, Metric: "memory", MaxUnits: 3, ScaleUp: 90}
+	err = autoscale.SaveRule(&rule)
+	c.Assert(err, gocheck.IsNil)
+	defer autoscale.RemoveRule(a.Name)
+	url := fmt.Sprintf("/apps/%s/autoscale?:app=%s", a.Name, a.Name)
+	request, err := http.NewRequest("GET", url, nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = getAutoscaleRule(recorder, request, s.token)
+	c.Assert(err, gocheck.IsNil)
+	var got autoscale.Rule
+	err = json.NewDecoder(recorder.Body).Decode(&got)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(got, gocheck.DeepEquals, rule)
+}
+
+func (s *S) TestGetAutoscaleRuleHandlerNotFound(c *gocheck.C) {
+	a := app.App{Name: "leper", Teams: []string{s.team.Name}}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	url := fmt.Sprintf("/apps/%s/autoscale?:app=%s", a.Name, a.Name)
+	request, err := http.NewRequest("GET", url, nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = getAutoscaleRule(recorder, request, s.token)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.HTTP)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusNotFound)
+}
+
+func (s *S) TestRemoveAutoscaleRuleHandler(c *gocheck.C) {
+	a := app.App{Name: "leper", Teams: []string{s.team.Name}}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	err = autoscale.SaveRule(&autoscale.Rule{App: a.Name, Metric: "cpu"})
+	c.Assert(err, gocheck.IsNil)
+	url := fmt.Sprintf("/apps/%s/autoscale?:app=%s", a.Name, a.Name)
+	request, err := http.NewRequest("DELETE", url, nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = removeAutoscaleRule(recorder, request, s.token)
+	c.Assert(err, gocheck.IsNil)
+	_, err = autoscale.GetRule(a.Name)
+	c.Assert(err, gocheck.Equals, autoscale.ErrRuleNotFound)
+	action := testing.Action{
+		Action: "remove-autoscale-rule",
+		User:   s.user.Email,
+		Extra:  []interface{}{"app=" + a.Name},
+	}
+	c.Assert(action, testing.IsRecorded)
+}
+
+func (s *S) TestRemoveAutoscaleRuleHandlerNotFound(c *gocheck.C) {
+	a := app.App{Name: "leper", Teams: []string{s.team.Name}}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	url := fmt.Sprintf("/apps/%s/autoscale?:app=%s", a.Name, a.Name)
+	request, err := http.NewRequest("DELETE", url, nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = removeAutoscaleRule(recorder, request, s.token)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.HTTP)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusNotFound)
+}
@@ -0,0 +1,343 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/globocom/tsuru/action"
+	"github.com/globocom/tsuru/app"
+	"github.com/globocom/tsuru/auth"
+	"github.com/globocom/tsuru/errors"
+	"github.com/globocom/tsuru/rec"
+	"io/ioutil"
+	"launchpad.net/goyaml"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// redacted replaces the secrets in the payload of events.
+const redacted = "*****"
+
+// eventsWithSecretValues contains the kinds of events whose payload values are
+// all secrets. Only the names of the fields of their payload are stored.
+var eventsWithSecretValues = map[string]bool{
+	"app-set-env":          true,
+	"user-change-password": true,
+}
+
+var (
+	// secretField matches the names of the fields whose values are not
+	// stored in the payload of events.
+	secretField = regexp.MustCompile(`(?i)pass|secret|token|credential|auth|private`)
+
+	// urlCredentials matches the user info in URLs.
+	urlCredentials = regexp.MustCompile(`([a-zA-Z][a-zA-Z0-9+.-]*://)[^/\s@]+@`)
+)
+
+// eventHandler is a handler that receives the event recorded for the request,
+// to record the steps of its actions.
+type eventHandler func(http.ResponseWriter, *http.Request, *auth.Token, *rec.Event) error
+
+// recordEvent wraps the handler, recording an event of the given kind for
+// each request. The name of the target is read from the given parameter, in
+// the URL or in the request body. When the parameter is empty, the target is
+// the user that sends the request.
+func recordEvent(kind, targetType, param string, fn authorizationRequiredHandler) authorizationRequiredHandler {
+	return recordEventSteps(kind, targetType, param, func(w http.ResponseWriter, r *http.Request, t *auth.Token, evt *rec.Event) error {
+		return fn(w, r, t)
+	})
+}
+
+// recordEventSteps is like recordEvent, but passes the event to the handler.
+func recordEventSteps(kind, targetType, param string, fn eventHandler) authorizationRequiredHandler {
+	return func(w http.ResponseWriter, r *http.Request, t *auth.Token) error {
+		var payload []byte
+		if r.Body != nil {
+			var err error
+			payload, err = ioutil.ReadAll(r.Body)
+			if err != nil {
+				return err
+			}
+			r.Body = ioutil.NopCloser(bytes.NewReader(payload))
+		}
+		owner := tokenOwner(t)
+		target := rec.Target{Type: targetType, Name: owner}
+		if param != "" {
+			target.Name = paramValue(r, param, payload)
+		}
+		evt, err := rec.NewEvent(kind, target, owner, eventPayload(kind, r, payload))
+		if err != nil {
+			return err
+		}
+		err = fn(w, r, t, evt)
+		if doneErr := evt.Done(err); doneErr != nil {
+			requestLog(r, t).Errorf("Failed to finish the event %s: %s", evt.ID.Hex(), doneErr)
+		}
+		return err
+	}
+}
+
+// stepObservers returns the observers that record the steps of a pipeline
+// in the given event, if any.
+func stepObservers(evt *rec.Event, r *http.Request) []action.Observer {
+	if evt == nil {
+		return nil
+	}
+	return []action.Observer{&eventObserver{evt: evt, r: r}}
+}
+
+// eventObserver records the steps of a pipeline in an event.
+type eventObserver struct {
+	evt *rec.Event
+	r   *http.Request
+}
+
+func (o *eventObserver) Forward(e action.StepEvent) {
+	step := rec.Step{Name: e.Action, Phase: "forward", Attempts: e.Attempts, Duration: e.Duration}
+	if e.Err != nil {
+		step.Error = e.Err.Error()
+	}
+	o.add(step)
+}
+
+func (o *eventObserver) Backward(e action.StepEvent) {
+	o.add(rec.Step{Name: e.Action, Phase: "backward", Duration: e.Duration})
+}
+
+func (o *eventObserver) add(step rec.Step) {
+	if err := o.evt.AddStep(step); err != nil {
+		requestLog(o.r, nil).Errorf("Failed to record the step %s of the event %s: %s", step.Name, o.evt.ID.Hex(), err)
+	}
+}
+
+// tokenOwner returns the email of the user of the token, or the name of the
+// app, for app tokens.
+func tokenOwner(t *auth.Token) string {
+	if t.UserEmail != "" {
+		return t.UserEmail
+	}
+	return "app:" + t.AppName
+}
+
+// paramValue returns the value of the parameter from the URL, or from the
+// request body, in JSON, YAML or form format.
+func paramValue(r *http.Request, param string, body []byte) string {
+	if value := r.URL.Query().Get(param); value != "" {
+		return value
+	}
+	var fields map[string]interface{}
+	if json.Unmarshal(body, &fields) == nil {
+		value, _ := fields[param].(string)
+		return value
+	}
+	var yamlFields map[string]interface{}
+	if goyaml.Unmarshal(body, &yamlFields) == nil {
+		if value, ok := yamlFields[param]; ok && value != nil {
+			return fmt.Sprint(value)
+		}
+	}
+	if values, err := url.ParseQuery(string(body)); err == nil {
+		return values.Get(param)
+	}
+	return ""
+}
+
+// eventPayload returns the request body to be stored in the event, without
+// secrets: values of fields whose names look like secrets, like passwords and
+// tokens, and credentials in URLs are redacted. JSON and YAML bodies are
+// stored as JSON.
+func eventPayload(kind string, r *http.Request, body []byte) string {
+	if len(body) == 0 {
+		return ""
+	}
+	all := eventsWithSecretValues[kind]
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+		if values, err := url.ParseQuery(string(body)); err == nil {
+			for name, vs := range values {
+				for i, v := range vs {
+					vs[i] = redactValue(name, v, all).(string)
+				}
+			}
+			return values.Encode()
+		}
+	}
+	var fields map[string]interface{}
+	if json.Unmarshal(body, &fields) != nil {
+		if goyaml.Unmarshal(body, &fields) != nil || len(fields) == 0 {
+			if all {
+				return redacted
+			}
+			return urlCredentials.ReplaceAllString(string(body), "${1}"+redacted+"@")
+		}
+	}
+	b, err := json.Marshal(redactFields(fields, all))
+	if err != nil {
+		return ""
+	}
+	return string(b)
+}
+
+func redactFields(fields map[string]interface{}, all bool) map[string]interface{} {
+	result := make(map[string]interface{}, len(fields))
+	for name, value := range fields {
+		result[name] = redactValue(name, value, all)
+	}
+	return result
+}
+
+// redactValue redacts the value of the named field. When all is true, every
+// value is redacted, keeping only the names of the fields.
+func redactValue(name string, value interface{}, all bool) interface{} {
+	if secretField.MatchString(name) {
+		return redacted
+	}
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return redactFields(v, all)
+	case map[interface{}]interface{}:
+		fields := make(map[string]interface{}, len(v))
+		for k, value := range v {
+			fields[fmt.Sprint(k)] = value
+		}
+		return redactFields(fields, all)
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, value := range v {
+			result[i] = redactValue(name, value, all)
+		}
+		return result
+	case nil:
+		return nil
+	}
+	if all {
+		return redacted
+	}
+	if s, ok := value.(string); ok {
+		return redactURL(s)
+	}
+	return value
+}
+
+// redactURL redacts the credentials and the query parameters that look like
+// secrets in the URL. Values that are not URLs are returned unchanged.
+func redactURL(value string) string {
+	u, err := url.Parse(value)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return value
+	}
+	if u.RawQuery != "" {
+		query := u.Query()
+		changed := false
+		for name := range query {
+			if secretField.MatchString(name) {
+				query.Set(name, redacted)
+				changed = true
+			}
+		}
+		if changed {
+			u.RawQuery = query.Encode()
+			value = u.String()
+		}
+	}
+	return urlCredentials.ReplaceAllString(value, "${1}"+redacted+"@")
+}
+
+// canReadEvents checks whether the user may read the events of the app.
+func canReadEvents(u *auth.User, t *auth.Token, appName string) error {
+	a := app.App{Name: appName}
+	if err := a.Get(); err != nil {
+		return &errors.HTTP{Code: http.StatusNotFound, Message: fmt.Sprintf("App %s not found.", appName)}
+	}
+	if !u.HasPermission(auth.PermAppRead, a.Name, a.Teams) || !t.Allows(auth.PermAppRead, a.Name) {
+		return &errors.HTTP{Code: http.StatusForbidden, Message: "You don't have permission to do this action."}
+	}
+	return nil
+}
+
+func parseEventTime(value, name string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		msg := fmt.Sprintf("Invalid %s: the time must be in RFC 3339 format.", name)
+		return time.Time{}, &errors.HTTP{Code: http.StatusBadRequest, Message: msg}
+	}
+	return t, nil
+}
+
+// listEvents returns the events that match the filters in the query string:
+// app, user, kind, since, until and limit. Admins may see all events, other
+// users see only their own events, or the events of apps they can read.
+func listEvents(w http.ResponseWriter, r *http.Request, t *auth.Token) error {
+	u, err := t.User()
+	if err != nil {
+		return err
+	}
+	query := r.URL.Query()
+	filter := rec.EventFilter{Owner: query.Get("user"), Kind: query.Get("kind")}
+	appName := query.Get("app")
+	if appName != "" {
+		filter.Target = rec.Target{Type: "app", Name: appName}
+	}
+	if filter.Since, err = parseEventTime(query.Get("since"), "since"); err != nil {
+		return err
+	}
+	if filter.Until, err = parseEventTime(query.Get("until"), "until"); err != nil {
+		return err
+	}
+	if limit := query.Get("limit"); limit != "" {
+		filter.Limit, err = strconv.Atoi(limit)
+		if err != nil || filter.Limit < 1 {
+			return &errors.HTTP{Code: http.StatusBadRequest, Message: "Invalid limit: it must be a positive number."}
+		}
+	}
+	if !u.IsAdmin() {
+		if appName == "" {
+			filter.Owner = u.Email
+		} else if err := canReadEvents(u, t, appName); err != nil {
+			return err
+		}
+	}
+	rec.Log(u.Email, "list-events")
+	events, err := rec.ListEvents(&filter)
+	if err != nil {
+		return err
+	}
+	if len(events) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	return json.NewEncoder(w).Encode(events)
+}
+
+// eventInfo returns the event with the given id.
+func eventInfo(w http.ResponseWriter, r *http.Request, t *auth.Token) error {
+	u, err := t.User()
+	if err != nil {
+		return err
+	}
+	id := r.URL.Query().Get(":id")
+	evt, err := rec.GetEvent(id)
+	if err != nil {
+		return &errors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+	}
+	if !u.IsAdmin() && evt.Owner != u.Email {
+		if evt.Target.Type != "app" {
+			return &errors.HTTP{Code: http.StatusForbidden, Message: "You don't have permission to do this action."}
+		}
+		if err := canReadEvents(u, t, evt.Target.Name); err != nil {
+			return err
+		}
+	}
+	rec.Log(u.Email, "event-info", "id="+id)
+	return json.NewEncoder(w).Encode(evt)
+}
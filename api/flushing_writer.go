@@ -29,3 +29,12 @@ func (w *flushingWriter) Write(data []byte) (int, error) {
 	}
 	return n, err
 }
+
+// CloseNotify returns a channel that receives a value when the client
+// connection goes away, if the underlying ResponseWriter supports it.
+func (w *flushingWriter) CloseNotify() <-chan bool {
+	if n, ok := w.ResponseWriter.(http.CloseNotifier); ok {
+		return n.CloseNotify()
+	}
+	return nil
+}
@@ -5,10 +5,11 @@
 package api
 
 import (
+	stderrors "errors"
 	"fmt"
+	"github.com/globocom/tsuru/app"
 	"github.com/globocom/tsuru/auth"
 	"github.com/globocom/tsuru/errors"
-	"github.com/globocom/tsuru/log"
 	"net/http"
 )
 
@@ -24,23 +25,34 @@ func setVersionHeaders(w http.ResponseWriter) {
 	w.Header().Set("Supported-Tsuru-Admin", tsuruAdminMin)
 }
 
+var errTokenNotAllowed = stderrors.New("This token does not allow this action.")
+
+// writeError writes the error to the response, with the status code of the
+// error, or 500 if it's not an HTTP error, and logs it. When the handler has
+// already started the response, the error is appended to the body.
+func writeError(w *flushingWriter, r *http.Request, t *auth.Token, err error) {
+	code := http.StatusInternalServerError
+	if e, ok := err.(*errors.HTTP); ok {
+		code = e.Code
+	}
+	if w.wrote {
+		fmt.Fprintln(w, err)
+	} else {
+		http.Error(w, err.Error(), code)
+	}
+	requestLog(r, t).Errorf("%s", err)
+}
+
 type handler func(http.ResponseWriter, *http.Request) error
 
 func (fn handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	setVersionHeaders(w)
-	defer func() {
-		if r.Body != nil {
-			r.Body.Close()
-		}
-	}()
+	chain(http.HandlerFunc(fn.serve), apiMiddlewares...).ServeHTTP(w, r)
+}
+
+func (fn handler) serve(w http.ResponseWriter, r *http.Request) {
 	fw := flushingWriter{w, false}
 	if err := fn(&fw, r); err != nil {
-		if fw.wrote {
-			fmt.Fprintln(&fw, err)
-		} else {
-			http.Error(&fw, err.Error(), http.StatusInternalServerError)
-		}
-		log.Print(err)
+		writeError(&fw, r, nil, err)
 	}
 }
 
@@ -66,57 +78,119 @@ func validate(token string, r *http.Request) (*auth.Token, error) {
 type authorizationRequiredHandler func(http.ResponseWriter, *http.Request, *auth.Token) error
 
 func (fn authorizationRequiredHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	setVersionHeaders(w)
-	defer func() {
-		if r.Body != nil {
-			r.Body.Close()
-		}
-	}()
-	fw := flushingWriter{w, false}
-	token := r.Header.Get("Authorization")
-	if t, err := validate(token, r); err != nil {
-		http.Error(&fw, err.Error(), http.StatusUnauthorized)
-	} else if err = fn(&fw, r, t); err != nil {
-		code := http.StatusInternalServerError
-		if e, ok := err.(*errors.HTTP); ok {
-			code = e.Code
+	fn.serve(w, r, true)
+}
+
+// serve validates the token and calls the handler. When restrictScoped is
+// true, scoped API tokens are allowed only in GET requests, as the handler
+// does not check any permission by itself.
+func (fn authorizationRequiredHandler) serve(w http.ResponseWriter, r *http.Request, restrictScoped bool) {
+	chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fw := flushingWriter{w, false}
+		t, err := validate(r.Header.Get("Authorization"), r)
+		if err != nil {
+			http.Error(&fw, err.Error(), http.StatusUnauthorized)
+			return
 		}
-		if fw.wrote {
-			fmt.Fprintln(&fw, err)
-		} else {
-			http.Error(&fw, err.Error(), code)
+		setUser(w, t)
+		if restrictScoped && t.IsScoped() && r.Method != "GET" {
+			http.Error(&fw, errTokenNotAllowed.Error(), http.StatusForbidden)
+		} else if err = fn(&fw, r, t); err != nil {
+			writeError(&fw, r, t, err)
 		}
-		log.Print(err)
-	}
+	}), apiMiddlewares...).ServeHTTP(w, r)
 }
 
 type adminRequiredHandler authorizationRequiredHandler
 
 func (fn adminRequiredHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	setVersionHeaders(w)
-	defer func() {
-		if r.Body != nil {
-			r.Body.Close()
-		}
-	}()
+	chain(http.HandlerFunc(fn.serve), apiMiddlewares...).ServeHTTP(w, r)
+}
+
+func (fn adminRequiredHandler) serve(w http.ResponseWriter, r *http.Request) {
 	fw := flushingWriter{w, false}
 	header := r.Header.Get("Authorization")
 	if header == "" {
 		http.Error(&fw, "You must provide the Authorization header", http.StatusUnauthorized)
-	} else if t, err := auth.GetToken(header); err != nil {
+		return
+	}
+	t, err := auth.GetToken(header)
+	if err != nil {
 		http.Error(&fw, "Invalid token", http.StatusUnauthorized)
-	} else if user, err := t.User(); err != nil || !user.IsAdmin() {
+		return
+	}
+	setUser(w, t)
+	if user, err := t.User(); err != nil || t.IsScoped() || !user.IsAdmin() {
 		http.Error(&fw, "Forbidden", http.StatusForbidden)
 	} else if err = fn(&fw, r, t); err != nil {
-		code := http.StatusInternalServerError
-		if e, ok := err.(*errors.HTTP); ok {
-			code = e.Code
+		writeError(&fw, r, t, err)
+	}
+}
+
+// permissionRequiredHandler is a handler that requires the user to have the
+// given permission. The permission is checked against the apps in the given
+// parameters, the app in the :app parameter or the team in the :team
+// parameter, if any.
+type permissionRequiredHandler struct {
+	perm      auth.Permission
+	appParams []string
+	fn        authorizationRequiredHandler
+}
+
+func permissionRequired(perm auth.Permission, fn authorizationRequiredHandler) http.Handler {
+	return permissionRequiredHandler{perm: perm, fn: fn}
+}
+
+// appsPermissionRequired returns a handler that requires the user to have the
+// given permission on every app named in the given parameters.
+func appsPermissionRequired(perm auth.Permission, params []string, fn authorizationRequiredHandler) http.Handler {
+	return permissionRequiredHandler{perm: perm, appParams: params, fn: fn}
+}
+
+func (h permissionRequiredHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	authorizationRequiredHandler(h.check).serve(w, r, false)
+}
+
+func (h permissionRequiredHandler) check(w http.ResponseWriter, r *http.Request, t *auth.Token) error {
+	u, err := t.User()
+	if err != nil {
+		return err
+	}
+	if len(h.appParams) > 0 {
+		for _, param := range h.appParams {
+			a := app.App{Name: r.URL.Query().Get(param)}
+			if err := a.Get(); err != nil {
+				return &errors.HTTP{Code: http.StatusNotFound, Message: fmt.Sprintf("App %s not found.", a.Name)}
+			}
+			if err := h.allowed(u, t, a.Name, a.Teams); err != nil {
+				return err
+			}
 		}
-		if fw.wrote {
-			fmt.Fprintln(&fw, err)
-		} else {
-			http.Error(&fw, err.Error(), code)
+		return h.fn(w, r, t)
+	}
+	var appName string
+	var teams []string
+	if name := r.URL.Query().Get(":app"); name != "" {
+		a := app.App{Name: name}
+		if err := a.Get(); err != nil {
+			return &errors.HTTP{Code: http.StatusNotFound, Message: fmt.Sprintf("App %s not found.", name)}
 		}
-		log.Print(err)
+		appName, teams = a.Name, a.Teams
+	} else if team := r.URL.Query().Get(":team"); team != "" {
+		teams = []string{team}
+	}
+	if err := h.allowed(u, t, appName, teams); err != nil {
+		return err
+	}
+	return h.fn(w, r, t)
+}
+
+func (h permissionRequiredHandler) allowed(u *auth.User, t *auth.Token, appName string, teams []string) error {
+	if !u.HasPermission(h.perm, appName, teams) {
+		return &errors.HTTP{Code: http.StatusForbidden, Message: "You don't have permission to do this action."}
+	}
+	if !t.Allows(h.perm, appName) {
+		return &errors.HTTP{Code: http.StatusForbidden, Message: errTokenNotAllowed.Error()}
 	}
+	return nil
 }
@@ -5,16 +5,22 @@
 package api
 
 import (
+	"bytes"
 	stderrors "errors"
 	"fmt"
 	"github.com/globocom/config"
+	"github.com/globocom/tsuru/app"
 	"github.com/globocom/tsuru/auth"
 	"github.com/globocom/tsuru/db"
 	"github.com/globocom/tsuru/errors"
+	"github.com/globocom/tsuru/log"
 	"labix.org/v2/mgo/bson"
 	"launchpad.net/gocheck"
+	stdlog "log"
 	"net/http"
 	"net/http/httptest"
+	"strings"
+	"time"
 )
 
 type HandlerSuite struct {
@@ -369,3 +375,231 @@ func (s *HandlerSuite) TestAuthorizationRequiredHandlerAppMissng(c *gocheck.C) {
 	authorizationRequiredHandler(authorizedOutputHandler).ServeHTTP(recorder, request)
 	c.Assert(recorder.Code, gocheck.Equals, http.StatusOK)
 }
+
+func (s *HandlerSuite) roleUser(c *gocheck.C, roles ...auth.RoleAssignment) (*auth.User, *auth.Token) {
+	user := &auth.User{Email: "pinball@thewho.com", Password: "123456", Roles: roles}
+	err := user.Create()
+	c.Assert(err, gocheck.IsNil)
+	token, err := user.CreateToken("123456")
+	c.Assert(err, gocheck.IsNil)
+	return user, token
+}
+
+func (s *HandlerSuite) TestPermissionRequiredHandlerShouldReturnForbiddenWithoutPermission(c *gocheck.C) {
+	a := app.App{Name: "tommy", Teams: []string{"tsuruteam"}}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	user, token := s.roleUser(c)
+	defer s.conn.Users().Remove(bson.M{"email": user.Email})
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest("GET", "/apps/tommy?:app=tommy", nil)
+	c.Assert(err, gocheck.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.Token)
+	permissionRequired(auth.PermAppRead, authorizedSimpleHandler).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, gocheck.Equals, http.StatusForbidden)
+	c.Assert(recorder.Body.String(), gocheck.Equals, "You don't have permission to do this action.\n")
+}
+
+func (s *HandlerSuite) TestPermissionRequiredHandlerChecksTheRolesOfTheUser(c *gocheck.C) {
+	a := app.App{Name: "tommy", Teams: []string{"tsuruteam"}}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	role := auth.RoleAssignment{Name: "app-deployer", Scope: auth.ScopeApp, Value: "tommy"}
+	user, token := s.roleUser(c, role)
+	defer s.conn.Users().Remove(bson.M{"email": user.Email})
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest("GET", "/apps/tommy/restart?:app=tommy", nil)
+	c.Assert(err, gocheck.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.Token)
+	permissionRequired(auth.PermAppRestart, authorizedSimpleHandler).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, gocheck.Equals, http.StatusOK)
+	c.Assert(recorder.Body.String(), gocheck.Equals, "success")
+	recorder = httptest.NewRecorder()
+	request, err = http.NewRequest("DELETE", "/apps/tommy?:app=tommy", nil)
+	c.Assert(err, gocheck.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.Token)
+	permissionRequired(auth.PermAppDelete, authorizedSimpleHandler).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, gocheck.Equals, http.StatusForbidden)
+}
+
+func (s *HandlerSuite) TestPermissionRequiredHandlerChecksTheTeam(c *gocheck.C) {
+	role := auth.RoleAssignment{Name: "team-admin", Scope: auth.ScopeTeam, Value: "tsuruteam"}
+	user, token := s.roleUser(c, role)
+	defer s.conn.Users().Remove(bson.M{"email": user.Email})
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest("PUT", "/teams/tsuruteam/someone?:team=tsuruteam", nil)
+	c.Assert(err, gocheck.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.Token)
+	permissionRequired(auth.PermTeamAdmin, authorizedSimpleHandler).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, gocheck.Equals, http.StatusOK)
+	recorder = httptest.NewRecorder()
+	request, err = http.NewRequest("PUT", "/teams/otherteam/someone?:team=otherteam", nil)
+	c.Assert(err, gocheck.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.Token)
+	permissionRequired(auth.PermTeamAdmin, authorizedSimpleHandler).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, gocheck.Equals, http.StatusForbidden)
+}
+
+func (s *HandlerSuite) TestAppsPermissionRequiredHandlerChecksEveryApp(c *gocheck.C) {
+	for _, name := range []string{"tommy", "quadrophenia"} {
+		err := s.conn.Apps().Insert(app.App{Name: name, Teams: []string{"tsuruteam"}})
+		c.Assert(err, gocheck.IsNil)
+		defer s.conn.Apps().Remove(bson.M{"name": name})
+	}
+	role := auth.RoleAssignment{Name: "app-deployer", Scope: auth.ScopeApp, Value: "tommy"}
+	user, token := s.roleUser(c, role)
+	defer s.conn.Users().Remove(bson.M{"email": user.Email})
+	params := []string{"app1", "app2"}
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest("PUT", "/swap?app1=tommy&app2=tommy", nil)
+	c.Assert(err, gocheck.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.Token)
+	appsPermissionRequired(auth.PermAppRestart, params, authorizedSimpleHandler).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, gocheck.Equals, http.StatusOK)
+	recorder = httptest.NewRecorder()
+	request, err = http.NewRequest("PUT", "/swap?app1=tommy&app2=quadrophenia", nil)
+	c.Assert(err, gocheck.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.Token)
+	appsPermissionRequired(auth.PermAppRestart, params, authorizedSimpleHandler).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, gocheck.Equals, http.StatusForbidden)
+	recorder = httptest.NewRecorder()
+	request, err = http.NewRequest("PUT", "/swap?app1=tommy&app2=unknown", nil)
+	c.Assert(err, gocheck.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.Token)
+	appsPermissionRequired(auth.PermAppRestart, params, authorizedSimpleHandler).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, gocheck.Equals, http.StatusNotFound)
+}
+
+func (s *HandlerSuite) TestPermissionRequiredHandlerShouldReturnNotFoundIfTheAppDoesNotExist(c *gocheck.C) {
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest("GET", "/apps/unknown?:app=unknown", nil)
+	c.Assert(err, gocheck.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.Token)
+	permissionRequired(auth.PermAppRead, authorizedSimpleHandler).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, gocheck.Equals, http.StatusNotFound)
+	c.Assert(recorder.Body.String(), gocheck.Equals, "App unknown not found.\n")
+}
+
+func (s *HandlerSuite) TestPermissionRequiredHandlerShouldReturnUnauthorizedIfTheTokenIsInvalid(c *gocheck.C) {
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest("GET", "/apps/tommy?:app=tommy", nil)
+	c.Assert(err, gocheck.IsNil)
+	request.Header.Set("Authorization", "what the token?!")
+	permissionRequired(auth.PermAppRead, authorizedSimpleHandler).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, gocheck.Equals, http.StatusUnauthorized)
+}
+
+func (s *HandlerSuite) apiToken(c *gocheck.C, scope string, apps ...string) *auth.Token {
+	user, err := s.token.User()
+	c.Assert(err, gocheck.IsNil)
+	token, err := user.CreateAPIToken("ci", scope, apps, time.Hour)
+	c.Assert(err, gocheck.IsNil)
+	return token
+}
+
+func (s *HandlerSuite) TestAuthorizationRequiredHandlerScopedTokenCanOnlyRead(c *gocheck.C) {
+	token := s.apiToken(c, auth.TokenScopeDeploy)
+	defer s.conn.Tokens().Remove(bson.M{"token": token.Token})
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest("GET", "/apps", nil)
+	c.Assert(err, gocheck.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.Token)
+	authorizationRequiredHandler(authorizedSimpleHandler).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, gocheck.Equals, http.StatusOK)
+	recorder = httptest.NewRecorder()
+	request, err = http.NewRequest("POST", "/apps", nil)
+	c.Assert(err, gocheck.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.Token)
+	authorizationRequiredHandler(authorizedSimpleHandler).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, gocheck.Equals, http.StatusForbidden)
+	c.Assert(recorder.Body.String(), gocheck.Equals, "This token does not allow this action.\n")
+}
+
+func (s *HandlerSuite) TestAdminRequiredHandlerShouldReturnForbiddenForScopedTokens(c *gocheck.C) {
+	token := s.apiToken(c, auth.TokenScopeRead)
+	defer s.conn.Tokens().Remove(bson.M{"token": token.Token})
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest("GET", "/apps", nil)
+	c.Assert(err, gocheck.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.Token)
+	adminRequiredHandler(authorizedSimpleHandler).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, gocheck.Equals, http.StatusForbidden)
+}
+
+func (s *HandlerSuite) TestPermissionRequiredHandlerChecksTheScopeOfTheToken(c *gocheck.C) {
+	a := app.App{Name: "tommy", Teams: []string{"tsuruteam"}}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	token := s.apiToken(c, auth.TokenScopeDeploy)
+	defer s.conn.Tokens().Remove(bson.M{"token": token.Token})
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest("POST", "/apps/tommy/rollback?:app=tommy", nil)
+	c.Assert(err, gocheck.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.Token)
+	permissionRequired(auth.PermAppDeploy, authorizedSimpleHandler).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, gocheck.Equals, http.StatusOK)
+	recorder = httptest.NewRecorder()
+	request, err = http.NewRequest("DELETE", "/apps/tommy?:app=tommy", nil)
+	c.Assert(err, gocheck.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.Token)
+	permissionRequired(auth.PermAppDelete, authorizedSimpleHandler).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, gocheck.Equals, http.StatusForbidden)
+	c.Assert(recorder.Body.String(), gocheck.Equals, "This token does not allow this action.\n")
+}
+
+func (s *HandlerSuite) TestPermissionRequiredHandlerChecksTheAppsOfTheToken(c *gocheck.C) {
+	a := app.App{Name: "tommy", Teams: []string{"tsuruteam"}}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	token := s.apiToken(c, auth.TokenScopeApp, "quadrophenia")
+	defer s.conn.Tokens().Remove(bson.M{"token": token.Token})
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest("GET", "/apps/tommy?:app=tommy", nil)
+	c.Assert(err, gocheck.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.Token)
+	permissionRequired(auth.PermAppRead, authorizedSimpleHandler).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, gocheck.Equals, http.StatusForbidden)
+}
+
+func (s *HandlerSuite) TestHandlerShouldGenerateARequestID(c *gocheck.C) {
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest("GET", "/apps", nil)
+	c.Assert(err, gocheck.IsNil)
+	handler(simpleHandler).ServeHTTP(recorder, request)
+	id := recorder.Header().Get("X-Request-ID")
+	c.Assert(id, gocheck.HasLen, 32)
+	c.Assert(request.Header.Get("X-Request-ID"), gocheck.Equals, id)
+	other := httptest.NewRecorder()
+	request, err = http.NewRequest("GET", "/apps", nil)
+	c.Assert(err, gocheck.IsNil)
+	handler(simpleHandler).ServeHTTP(other, request)
+	c.Assert(other.Header().Get("X-Request-ID"), gocheck.Not(gocheck.Equals), id)
+}
+
+func (s *HandlerSuite) TestHandlerShouldKeepTheRequestIDFromTheClient(c *gocheck.C) {
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest("GET", "/apps", nil)
+	c.Assert(err, gocheck.IsNil)
+	request.Header.Set("X-Request-ID", "abc123")
+	request.Header.Set("Authorization", "bearer "+s.token.Token)
+	authorizationRequiredHandler(authorizedSimpleHandler).ServeHTTP(recorder, request)
+	c.Assert(recorder.Header().Get("X-Request-ID"), gocheck.Equals, "abc123")
+}
+
+func (s *HandlerSuite) TestAuthorizationRequiredHandlerShouldLogErrorsWithTheRequestID(c *gocheck.C) {
+	var buf bytes.Buffer
+	log.SetLogger(stdlog.New(&buf, "", 0))
+	defer log.SetLogger(nil)
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest("GET", "/apps/tommy?:app=tommy", nil)
+	c.Assert(err, gocheck.IsNil)
+	request.Header.Set("X-Request-ID", "abc123")
+	request.Header.Set("Authorization", "bearer "+s.token.Token)
+	authorizationRequiredHandler(authorizedErrorHandler).ServeHTTP(recorder, request)
+	lines := strings.Split(buf.String(), "\n")
+	c.Assert(lines[0], gocheck.Equals, "ERROR: some error app=tommy request-id=abc123 user=whydidifall@thewho.com")
+}
@@ -0,0 +1,39 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"github.com/globocom/tsuru/auth"
+	"github.com/globocom/tsuru/errors"
+	"github.com/globocom/tsuru/log"
+	"github.com/globocom/tsuru/rec"
+	"net/http"
+)
+
+// getLogLevel returns the current level of the API server log.
+func getLogLevel(w http.ResponseWriter, r *http.Request, t *auth.Token) error {
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(map[string]string{"level": log.CurrentLevel().String()})
+}
+
+// setLogLevel changes the level of the API server log, without restarting
+// it. The change is lost when the server restarts, and the level falls back
+// to the log:level setting.
+func setLogLevel(w http.ResponseWriter, r *http.Request, t *auth.Token) error {
+	u, err := t.User()
+	if err != nil {
+		return err
+	}
+	name := r.FormValue("level")
+	rec.Log(u.Email, "set-log-level", "level="+name)
+	level, err := log.ParseLevel(name)
+	if err != nil {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	requestLog(r, t).Warnf("Changing the log level from %s to %s", log.CurrentLevel(), level)
+	log.SetLevel(level)
+	return nil
+}
@@ -0,0 +1,58 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"github.com/globocom/tsuru/errors"
+	"github.com/globocom/tsuru/log"
+	"github.com/globocom/tsuru/testing"
+	"launchpad.net/gocheck"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+)
+
+func (s *S) TestGetLogLevel(c *gocheck.C) {
+	log.SetLevel(log.WarnLevel)
+	defer log.SetLevel(log.InfoLevel)
+	request, err := http.NewRequest("GET", "/log-level", nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = getLogLevel(recorder, request, s.token)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(recorder.Body.String(), gocheck.Equals, `{"level":"warn"}`+"\n")
+	c.Assert(recorder.Header().Get("Content-Type"), gocheck.Equals, "application/json")
+}
+
+func (s *S) TestSetLogLevel(c *gocheck.C) {
+	defer log.SetLevel(log.InfoLevel)
+	request, err := http.NewRequest("PUT", "/log-level", strings.NewReader("level=debug"))
+	c.Assert(err, gocheck.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	err = setLogLevel(recorder, request, s.token)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(log.CurrentLevel(), gocheck.Equals, log.DebugLevel)
+	action := testing.Action{
+		Action: "set-log-level",
+		User:   s.user.Email,
+		Extra:  []interface{}{"level=debug"},
+	}
+	c.Assert(action, testing.IsRecorded)
+}
+
+func (s *S) TestSetLogLevelInvalid(c *gocheck.C) {
+	request, err := http.NewRequest("PUT", "/log-level", strings.NewReader("level=verbose"))
+	c.Assert(err, gocheck.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	err = setLogLevel(recorder, request, s.token)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.HTTP)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusBadRequest)
+	c.Assert(e.Message, gocheck.Equals, log.ErrInvalidLevel.Error())
+	c.Assert(log.CurrentLevel(), gocheck.Equals, log.InfoLevel)
+}
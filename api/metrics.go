@@ -0,0 +1,68 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"github.com/bmizerany/pat"
+	"github.com/globocom/tsuru/metrics"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+var (
+	requestsCounter = metrics.NewCounter(
+		"tsuru_http_requests_total",
+		"Number of requests handled by the API, by method, route and status.",
+		"method", "route", "status",
+	)
+	requestDuration = metrics.NewHistogram(
+		"tsuru_http_request_duration_seconds",
+		"Duration of the requests handled by the API, by method and route.",
+		metrics.DefBuckets,
+		"method", "route",
+	)
+)
+
+// router is a pat router that instruments every route, counting requests
+// and observing their durations by the pattern of the route, instead of the
+// path of the request.
+type router struct {
+	*pat.PatternServeMux
+}
+
+func newRouter() router {
+	return router{pat.New()}
+}
+
+func (m router) Get(route string, h http.Handler) {
+	m.PatternServeMux.Get(route, instrument(route, h))
+}
+
+func (m router) Post(route string, h http.Handler) {
+	m.PatternServeMux.Post(route, instrument(route, h))
+}
+
+func (m router) Put(route string, h http.Handler) {
+	m.PatternServeMux.Put(route, instrument(route, h))
+}
+
+func (m router) Del(route string, h http.Handler) {
+	m.PatternServeMux.Del(route, instrument(route, h))
+}
+
+func instrument(route string, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: w}
+		h.ServeHTTP(sw, r)
+		status := sw.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		requestsCounter.Inc(r.Method, route, strconv.Itoa(status))
+		requestDuration.Observe(time.Since(start).Seconds(), r.Method, route)
+	})
+}
@@ -0,0 +1,61 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"bytes"
+	"github.com/globocom/tsuru/metrics"
+	"launchpad.net/gocheck"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+)
+
+func sampleValue(c *gocheck.C, sample string) float64 {
+	var buf bytes.Buffer
+	err := metrics.Write(&buf)
+	c.Assert(err, gocheck.IsNil)
+	for _, line := range strings.Split(buf.String(), "\n") {
+		if strings.HasPrefix(line, sample+" ") {
+			value, err := strconv.ParseFloat(line[len(sample)+1:], 64)
+			c.Assert(err, gocheck.IsNil)
+			return value
+		}
+	}
+	return 0
+}
+
+func (s *HandlerSuite) TestRouterCountsRequestsByRoute(c *gocheck.C) {
+	ok := `tsuru_http_requests_total{method="GET",route="/things/:name",status="200"}`
+	failed := `tsuru_http_requests_total{method="POST",route="/things/:name",status="500"}`
+	count := `tsuru_http_request_duration_seconds_count{method="GET",route="/things/:name"}`
+	okBefore, failedBefore, countBefore := sampleValue(c, ok), sampleValue(c, failed), sampleValue(c, count)
+	m := newRouter()
+	m.Get("/things/:name", handler(simpleHandler))
+	m.Post("/things/:name", handler(errorHandler))
+	for _, path := range []string{"/things/a", "/things/b"} {
+		request, err := http.NewRequest("GET", path, nil)
+		c.Assert(err, gocheck.IsNil)
+		m.ServeHTTP(httptest.NewRecorder(), request)
+	}
+	request, err := http.NewRequest("POST", "/things/a", nil)
+	c.Assert(err, gocheck.IsNil)
+	m.ServeHTTP(httptest.NewRecorder(), request)
+	c.Assert(sampleValue(c, ok), gocheck.Equals, okBefore+2)
+	c.Assert(sampleValue(c, failed), gocheck.Equals, failedBefore+1)
+	c.Assert(sampleValue(c, count), gocheck.Equals, countBefore+2)
+}
+
+func (s *HandlerSuite) TestRouterCountsPanicsAsErrors(c *gocheck.C) {
+	sample := `tsuru_http_requests_total{method="DELETE",route="/panic",status="500"}`
+	before := sampleValue(c, sample)
+	m := newRouter()
+	m.Del("/panic", handler(panicHandler))
+	request, err := http.NewRequest("DELETE", "/panic", nil)
+	c.Assert(err, gocheck.IsNil)
+	m.ServeHTTP(httptest.NewRecorder(), request)
+	c.Assert(sampleValue(c, sample), gocheck.Equals, before+1)
+}
@@ -0,0 +1,176 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"crypto/rand"
+	"fmt"
+	"github.com/globocom/tsuru/auth"
+	"github.com/globocom/tsuru/log"
+	"net/http"
+	"runtime"
+	"time"
+)
+
+// middleware wraps a handler, running code before and after it.
+type middleware func(http.Handler) http.Handler
+
+// apiMiddlewares are the middlewares of every handler in the API, the first
+// one being the outermost.
+var apiMiddlewares = []middleware{setRequestID, logAccess, recoverPanic, setVersion, closeBody}
+
+// chain wraps the handler with the given middlewares, the first one being the
+// outermost.
+func chain(h http.Handler, middlewares ...middleware) http.Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		h = middlewares[i](h)
+	}
+	return h
+}
+
+// statusWriter is a ResponseWriter that keeps the status of the response and
+// the user that sent the request, for the access log.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+	user   string
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusWriter) Write(data []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+// Flush flushes the underlying ResponseWriter, if it's an http.Flusher.
+func (w *statusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// CloseNotify returns a channel that receives a value when the client
+// connection goes away, if the underlying ResponseWriter supports it.
+func (w *statusWriter) CloseNotify() <-chan bool {
+	if n, ok := w.ResponseWriter.(http.CloseNotifier); ok {
+		return n.CloseNotify()
+	}
+	return nil
+}
+
+// setUser stores the owner of the token in the writer, when the writer comes
+// from the access log middleware.
+func setUser(w http.ResponseWriter, t *auth.Token) {
+	if sw, ok := w.(*statusWriter); ok {
+		sw.user = tokenOwner(t)
+	}
+}
+
+const requestIDHeader = "X-Request-ID"
+
+// requestID returns the id of the request, taken from the X-Request-ID
+// header. Requests without the header get a new id, which is stored in the
+// request and sent back to the client, so that every log entry of the request
+// may be correlated.
+func requestID(w http.ResponseWriter, r *http.Request) string {
+	id := r.Header.Get(requestIDHeader)
+	if id == "" {
+		var b [16]byte
+		rand.Read(b[:])
+		id = fmt.Sprintf("%x", b)
+		r.Header.Set(requestIDHeader, id)
+	}
+	w.Header().Set(requestIDHeader, id)
+	return id
+}
+
+// requestLog returns a log entry with the request id, the app in the URL, if
+// any, and the owner of the token, if any.
+func requestLog(r *http.Request, t *auth.Token) *log.Entry {
+	fields := log.Fields{"request-id": r.Header.Get(requestIDHeader)}
+	if appName := r.URL.Query().Get(":app"); appName != "" {
+		fields["app"] = appName
+	}
+	if t != nil {
+		fields["user"] = tokenOwner(t)
+	}
+	return log.WithFields(fields)
+}
+
+func setRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID(w, r)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// logAccess writes a line to the log for each request, with its method,
+// path, status, duration and user.
+func logAccess(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: w}
+		next.ServeHTTP(sw, r)
+		status := sw.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		entry := requestLog(r, nil).WithField("status", status).
+			WithField("duration", time.Since(start).String())
+		if sw.user != "" {
+			entry = entry.WithField("user", sw.user)
+		}
+		entry.Infof("%s %s", r.Method, r.URL.Path)
+	})
+}
+
+// recoverPanic recovers from panics in the handler, logging the stack and
+// responding with a 500, unless the response has already been started.
+func recoverPanic(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sw, ok := w.(*statusWriter)
+		if !ok {
+			sw = &statusWriter{ResponseWriter: w}
+		}
+		defer func() {
+			if v := recover(); v != nil {
+				stack := make([]byte, 8192)
+				stack = stack[:runtime.Stack(stack, false)]
+				requestLog(r, nil).WithField("stack", string(stack)).
+					Errorf("Panic serving %s %s: %v", r.Method, r.URL.Path, v)
+				if sw.status == 0 {
+					http.Error(sw, "Internal server error", http.StatusInternalServerError)
+				}
+			}
+		}()
+		next.ServeHTTP(sw, r)
+	})
+}
+
+func setVersion(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		setVersionHeaders(w)
+		next.ServeHTTP(w, r)
+	})
+}
+
+func closeBody(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			if r.Body != nil {
+				r.Body.Close()
+			}
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,127 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/globocom/tsuru/log"
+	"launchpad.net/gocheck"
+	stdlog "log"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+)
+
+func panicHandler(w http.ResponseWriter, r *http.Request) error {
+	panic("something went wrong")
+}
+
+func (s *HandlerSuite) TestChainRunsTheMiddlewaresInOrder(c *gocheck.C) {
+	var calls []string
+	named := func(name string) middleware {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls = append(calls, name)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, "handler")
+	})
+	request, err := http.NewRequest("GET", "/apps", nil)
+	c.Assert(err, gocheck.IsNil)
+	chain(h, named("first"), named("second")).ServeHTTP(httptest.NewRecorder(), request)
+	c.Assert(calls, gocheck.DeepEquals, []string{"first", "second", "handler"})
+}
+
+func (s *HandlerSuite) TestStatusWriter(c *gocheck.C) {
+	recorder := httptest.NewRecorder()
+	w := &statusWriter{ResponseWriter: recorder}
+	w.WriteHeader(http.StatusNotFound)
+	fmt.Fprint(w, "not found")
+	c.Assert(w.status, gocheck.Equals, http.StatusNotFound)
+	c.Assert(recorder.Code, gocheck.Equals, http.StatusNotFound)
+	c.Assert(recorder.Body.String(), gocheck.Equals, "not found")
+	w = &statusWriter{ResponseWriter: httptest.NewRecorder()}
+	fmt.Fprint(w, "ok")
+	c.Assert(w.status, gocheck.Equals, http.StatusOK)
+}
+
+func (s *HandlerSuite) TestStatusWriterFlush(c *gocheck.C) {
+	recorder := httptest.NewRecorder()
+	w := &statusWriter{ResponseWriter: recorder}
+	w.Flush()
+	c.Assert(recorder.Flushed, gocheck.Equals, true)
+}
+
+func (s *HandlerSuite) TestSetRequestIDMiddleware(c *gocheck.C) {
+	var id string
+	h := setRequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id = r.Header.Get("X-Request-ID")
+	}))
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest("GET", "/apps", nil)
+	c.Assert(err, gocheck.IsNil)
+	h.ServeHTTP(recorder, request)
+	c.Assert(id, gocheck.HasLen, 32)
+	c.Assert(recorder.Header().Get("X-Request-ID"), gocheck.Equals, id)
+}
+
+func (s *HandlerSuite) TestLogAccessMiddleware(c *gocheck.C) {
+	var buf bytes.Buffer
+	log.SetLogger(stdlog.New(&buf, "", 0))
+	defer log.SetLogger(nil)
+	h := logAccess(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	}))
+	request, err := http.NewRequest("POST", "/teams", nil)
+	c.Assert(err, gocheck.IsNil)
+	request.Header.Set("X-Request-ID", "abc123")
+	h.ServeHTTP(httptest.NewRecorder(), request)
+	c.Assert(buf.String(), gocheck.Matches, `POST /teams duration=\S+ request-id=abc123 status=201\n`)
+}
+
+func (s *HandlerSuite) TestAuthorizationRequiredHandlerShouldLogTheAccessWithTheUser(c *gocheck.C) {
+	var buf bytes.Buffer
+	log.SetLogger(stdlog.New(&buf, "", 0))
+	defer log.SetLogger(nil)
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest("GET", "/apps", nil)
+	c.Assert(err, gocheck.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.Token)
+	authorizationRequiredHandler(authorizedSimpleHandler).ServeHTTP(recorder, request)
+	c.Assert(buf.String(), gocheck.Matches, `GET /apps duration=\S+ request-id=\w+ status=200 user=whydidifall@thewho.com\n`)
+}
+
+func (s *HandlerSuite) TestRecoverPanicMiddleware(c *gocheck.C) {
+	var buf bytes.Buffer
+	log.SetLogger(stdlog.New(&buf, "", 0))
+	defer log.SetLogger(nil)
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest("GET", "/apps", nil)
+	c.Assert(err, gocheck.IsNil)
+	handler(panicHandler).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, gocheck.Equals, http.StatusInternalServerError)
+	c.Assert(recorder.Body.String(), gocheck.Equals, "Internal server error\n")
+	lines := strings.SplitN(buf.String(), "\n", 2)
+	c.Assert(lines[0], gocheck.Matches, `ERROR: Panic serving GET /apps: something went wrong request-id=\w+ stack=".*`)
+	c.Assert(regexp.MustCompile(`(?m)^GET /apps .*status=500$`).MatchString(buf.String()), gocheck.Equals, true)
+}
+
+func (s *HandlerSuite) TestRecoverPanicMiddlewareAfterTheResponseStarted(c *gocheck.C) {
+	h := recoverPanic(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "partial")
+		panic("something went wrong")
+	}))
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest("GET", "/apps", nil)
+	c.Assert(err, gocheck.IsNil)
+	h.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, gocheck.Equals, http.StatusOK)
+	c.Assert(recorder.Body.String(), gocheck.Equals, "partial")
+}
@@ -0,0 +1,71 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"github.com/globocom/tsuru/app"
+	"github.com/globocom/tsuru/auth"
+	"github.com/globocom/tsuru/errors"
+	"github.com/globocom/tsuru/provision"
+	"github.com/globocom/tsuru/rec"
+	"net/http"
+)
+
+// nodeError converts the errors of node management to HTTP errors.
+func nodeError(err error) error {
+	switch err {
+	case app.ErrNodesNotSupported, app.ErrInvalidNode:
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	case provision.ErrNodeAlreadyExists, provision.ErrNodeNotEmpty:
+		return &errors.HTTP{Code: http.StatusConflict, Message: err.Error()}
+	case provision.ErrNodeNotFound, provision.ErrPoolNotFound:
+		return &errors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+	}
+	return err
+}
+
+func listNodes(w http.ResponseWriter, r *http.Request, t *auth.Token) error {
+	u, err := t.User()
+	if err != nil {
+		return err
+	}
+	rec.Log(u.Email, "list-nodes")
+	nodes, err := app.ListNodes()
+	if err != nil {
+		return nodeError(err)
+	}
+	if len(nodes) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(nodes)
+}
+
+// addNode adds a node to the provisioner. The body of the request is a JSON
+// object with the id, the address, the pool and the labels of the node.
+func addNode(w http.ResponseWriter, r *http.Request, t *auth.Token) error {
+	u, err := t.User()
+	if err != nil {
+		return err
+	}
+	var n provision.Node
+	if err := json.NewDecoder(r.Body).Decode(&n); err != nil {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: "Invalid JSON in the request body."}
+	}
+	rec.Log(u.Email, "add-node", "id="+n.ID, "address="+n.Address)
+	return nodeError(app.AddNode(n))
+}
+
+func removeNode(w http.ResponseWriter, r *http.Request, t *auth.Token) error {
+	u, err := t.User()
+	if err != nil {
+		return err
+	}
+	id := r.URL.Query().Get(":id")
+	rec.Log(u.Email, "remove-node", "id="+id)
+	return nodeError(app.RemoveNode(id))
+}
@@ -0,0 +1,145 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"github.com/globocom/tsuru/app"
+	"github.com/globocom/tsuru/errors"
+	"github.com/globocom/tsuru/provision"
+	"github.com/globocom/tsuru/testing"
+	"launchpad.net/gocheck"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+)
+
+// unmanagedProvisioner is a provisioner that doesn't manage nodes.
+type unmanagedProvisioner struct {
+	provision.Provisioner
+}
+
+func (s *S) TestListNodes(c *gocheck.C) {
+	s.provisioner.AddNode(provision.Node{ID: "server1", Address: "http://10.10.10.2:4243"})
+	s.provisioner.AddNode(provision.Node{ID: "server0", Address: "http://10.10.10.1:4243", Pool: "pool1"})
+	request, err := http.NewRequest("GET", "/docker/nodes", nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = listNodes(recorder, request, s.token)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(recorder.Header().Get("Content-Type"), gocheck.Equals, "application/json")
+	var nodes []provision.Node
+	err = json.NewDecoder(recorder.Body).Decode(&nodes)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(nodes, gocheck.HasLen, 2)
+	c.Assert(nodes[0].ID, gocheck.Equals, "server0")
+	c.Assert(nodes[0].Pool, gocheck.Equals, "pool1")
+	c.Assert(nodes[1].ID, gocheck.Equals, "server1")
+	action := testing.Action{Action: "list-nodes", User: s.user.Email}
+	c.Assert(action, testing.IsRecorded)
+}
+
+func (s *S) TestListNodesEmpty(c *gocheck.C) {
+	request, err := http.NewRequest("GET", "/docker/nodes", nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = listNodes(recorder, request, s.token)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(recorder.Code, gocheck.Equals, http.StatusNoContent)
+}
+
+func (s *S) TestListNodesNotSupported(c *gocheck.C) {
+	app.Provisioner = unmanagedProvisioner{s.provisioner}
+	defer func() { app.Provisioner = s.provisioner }()
+	request, err := http.NewRequest("GET", "/docker/nodes", nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = listNodes(recorder, request, s.token)
+	e, ok := err.(*errors.HTTP)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusBadRequest)
+	c.Assert(e.Message, gocheck.Equals, app.ErrNodesNotSupported.Error())
+}
+
+func (s *S) TestAddNode(c *gocheck.C) {
+	body := strings.NewReader(`{"ID":"server0","Address":"http://10.10.10.1:4243","Pool":"pool1","Labels":{"zone":"a"}}`)
+	request, err := http.NewRequest("POST", "/docker/nodes", body)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = addNode(recorder, request, s.token)
+	c.Assert(err, gocheck.IsNil)
+	nodes, err := s.provisioner.ListNodes()
+	c.Assert(err, gocheck.IsNil)
+	expected := []provision.Node{{
+		ID:      "server0",
+		Address: "http://10.10.10.1:4243",
+		Pool:    "pool1",
+		Labels:  map[string]string{"zone": "a"},
+	}}
+	c.Assert(nodes, gocheck.DeepEquals, expected)
+	action := testing.Action{
+		Action: "add-node",
+		User:   s.user.Email,
+		Extra:  []interface{}{"id=server0", "address=http://10.10.10.1:4243"},
+	}
+	c.Assert(action, testing.IsRecorded)
+}
+
+func (s *S) TestAddNodeInvalidJSON(c *gocheck.C) {
+	request, err := http.NewRequest("POST", "/docker/nodes", strings.NewReader("{"))
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = addNode(recorder, request, s.token)
+	e, ok := err.(*errors.HTTP)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusBadRequest)
+}
+
+func (s *S) TestAddNodeWithoutAddress(c *gocheck.C) {
+	request, err := http.NewRequest("POST", "/docker/nodes", strings.NewReader(`{"ID":"server0"}`))
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = addNode(recorder, request, s.token)
+	e, ok := err.(*errors.HTTP)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusBadRequest)
+	c.Assert(e.Message, gocheck.Equals, app.ErrInvalidNode.Error())
+}
+
+func (s *S) TestAddNodeDuplicated(c *gocheck.C) {
+	s.provisioner.AddNode(provision.Node{ID: "server0", Address: "http://10.10.10.1:4243"})
+	body := strings.NewReader(`{"ID":"server0","Address":"http://10.10.10.2:4243"}`)
+	request, err := http.NewRequest("POST", "/docker/nodes", body)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = addNode(recorder, request, s.token)
+	e, ok := err.(*errors.HTTP)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusConflict)
+}
+
+func (s *S) TestRemoveNode(c *gocheck.C) {
+	s.provisioner.AddNode(provision.Node{ID: "server0", Address: "http://10.10.10.1:4243"})
+	request, err := http.NewRequest("DELETE", "/docker/nodes/server0?:id=server0", nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = removeNode(recorder, request, s.token)
+	c.Assert(err, gocheck.IsNil)
+	nodes, err := s.provisioner.ListNodes()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(nodes, gocheck.HasLen, 0)
+	action := testing.Action{Action: "remove-node", User: s.user.Email, Extra: []interface{}{"id=server0"}}
+	c.Assert(action, testing.IsRecorded)
+}
+
+func (s *S) TestRemoveNodeNotFound(c *gocheck.C) {
+	request, err := http.NewRequest("DELETE", "/docker/nodes/server0?:id=server0", nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = removeNode(recorder, request, s.token)
+	e, ok := err.(*errors.HTTP)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusNotFound)
+}
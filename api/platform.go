@@ -0,0 +1,76 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"github.com/globocom/tsuru/app"
+	"github.com/globocom/tsuru/auth"
+	"github.com/globocom/tsuru/errors"
+	"github.com/globocom/tsuru/rec"
+	"net/http"
+)
+
+func platformAdd(w http.ResponseWriter, r *http.Request, t *auth.Token) error {
+	u, err := t.User()
+	if err != nil {
+		return err
+	}
+	p := app.Platform{
+		Name:       r.PostFormValue("name"),
+		Dockerfile: r.PostFormValue("dockerfile"),
+		Image:      r.PostFormValue("image"),
+		Charm:      r.PostFormValue("charm"),
+	}
+	rec.Log(u.Email, "platform-add", "name="+p.Name)
+	w.Header().Set("Content-Type", "text")
+	err = app.PlatformAdd(p, w)
+	switch err {
+	case app.ErrPlatformNameMissing, app.ErrPlatformSource:
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	case app.ErrDuplicatePlatform:
+		return &errors.HTTP{Code: http.StatusConflict, Message: err.Error()}
+	}
+	return err
+}
+
+func platformUpdate(w http.ResponseWriter, r *http.Request, t *auth.Token) error {
+	u, err := t.User()
+	if err != nil {
+		return err
+	}
+	p := app.Platform{
+		Name:       r.URL.Query().Get(":name"),
+		Dockerfile: r.PostFormValue("dockerfile"),
+		Image:      r.PostFormValue("image"),
+		Charm:      r.PostFormValue("charm"),
+	}
+	rec.Log(u.Email, "platform-update", "name="+p.Name)
+	w.Header().Set("Content-Type", "text")
+	err = app.PlatformUpdate(p, w)
+	if _, ok := err.(app.InvalidPlatformError); ok {
+		return &errors.HTTP{Code: http.StatusNotFound, Message: "Platform not found."}
+	}
+	if err == app.ErrPlatformSource {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	return err
+}
+
+func platformRemove(w http.ResponseWriter, r *http.Request, t *auth.Token) error {
+	u, err := t.User()
+	if err != nil {
+		return err
+	}
+	name := r.URL.Query().Get(":name")
+	rec.Log(u.Email, "platform-remove", "name="+name)
+	err = app.PlatformRemove(name)
+	if _, ok := err.(app.InvalidPlatformError); ok {
+		return &errors.HTTP{Code: http.StatusNotFound, Message: "Platform not found."}
+	}
+	if err == app.ErrPlatformInUse {
+		return &errors.HTTP{Code: http.StatusConflict, Message: err.Error()}
+	}
+	return err
+}
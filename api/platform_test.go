@@ -0,0 +1,136 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"github.com/globocom/tsuru/app"
+	"github.com/globocom/tsuru/errors"
+	"github.com/globocom/tsuru/testing"
+	"labix.org/v2/mgo/bson"
+	"launchpad.net/gocheck"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+)
+
+func (s *S) TestPlatformAdd(c *gocheck.C) {
+	body := strings.NewReader("name=python&dockerfile=http://example.com/Dockerfile&charm=python")
+	request, err := http.NewRequest("POST", "/platforms", body)
+	c.Assert(err, gocheck.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	err = platformAdd(recorder, request, s.token)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Platforms().RemoveId("python")
+	c.Assert(recorder.Body.String(), gocheck.Equals, "PlatformAdd called")
+	p, err := app.GetPlatform("python")
+	c.Assert(err, gocheck.IsNil)
+	expected := app.Platform{Name: "python", Dockerfile: "http://example.com/Dockerfile", Charm: "python"}
+	c.Assert(*p, gocheck.DeepEquals, expected)
+	_, ok := s.provisioner.Platform("python")
+	c.Assert(ok, gocheck.Equals, true)
+	action := testing.Action{Action: "platform-add", User: s.user.Email, Extra: []interface{}{"name=python"}}
+	c.Assert(action, testing.IsRecorded)
+}
+
+func (s *S) TestPlatformAddWithoutName(c *gocheck.C) {
+	request, err := http.NewRequest("POST", "/platforms", strings.NewReader("image=tsuru/python"))
+	c.Assert(err, gocheck.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	err = platformAdd(recorder, request, s.token)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.HTTP)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusBadRequest)
+	c.Assert(e.Message, gocheck.Equals, app.ErrPlatformNameMissing.Error())
+}
+
+func (s *S) TestPlatformAddDuplicate(c *gocheck.C) {
+	request, err := http.NewRequest("POST", "/platforms", strings.NewReader("name=zend&image=tsuru/zend"))
+	c.Assert(err, gocheck.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	err = platformAdd(recorder, request, s.token)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.HTTP)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusConflict)
+}
+
+func (s *S) TestPlatformUpdate(c *gocheck.C) {
+	err := app.PlatformAdd(app.Platform{Name: "python", Image: "tsuru/python"}, httptest.NewRecorder())
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Platforms().RemoveId("python")
+	body := strings.NewReader("dockerfile=http://example.com/Dockerfile")
+	request, err := http.NewRequest("PUT", "/platforms/python?:name=python", body)
+	c.Assert(err, gocheck.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	err = platformUpdate(recorder, request, s.token)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(recorder.Body.String(), gocheck.Equals, "PlatformUpdate called")
+	p, err := app.GetPlatform("python")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(*p, gocheck.DeepEquals, app.Platform{Name: "python", Dockerfile: "http://example.com/Dockerfile"})
+	action := testing.Action{Action: "platform-update", User: s.user.Email, Extra: []interface{}{"name=python"}}
+	c.Assert(action, testing.IsRecorded)
+}
+
+func (s *S) TestPlatformUpdateNotFound(c *gocheck.C) {
+	body := strings.NewReader("image=tsuru/python")
+	request, err := http.NewRequest("PUT", "/platforms/python?:name=python", body)
+	c.Assert(err, gocheck.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	err = platformUpdate(recorder, request, s.token)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.HTTP)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusNotFound)
+	c.Assert(e.Message, gocheck.Equals, "Platform not found.")
+}
+
+func (s *S) TestPlatformRemove(c *gocheck.C) {
+	err := app.PlatformAdd(app.Platform{Name: "python", Image: "tsuru/python"}, httptest.NewRecorder())
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Platforms().RemoveId("python")
+	request, err := http.NewRequest("DELETE", "/platforms/python?:name=python", nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = platformRemove(recorder, request, s.token)
+	c.Assert(err, gocheck.IsNil)
+	_, err = app.GetPlatform("python")
+	c.Assert(err, gocheck.NotNil)
+	action := testing.Action{Action: "platform-remove", User: s.user.Email, Extra: []interface{}{"name=python"}}
+	c.Assert(action, testing.IsRecorded)
+}
+
+func (s *S) TestPlatformRemoveNotFound(c *gocheck.C) {
+	request, err := http.NewRequest("DELETE", "/platforms/python?:name=python", nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = platformRemove(recorder, request, s.token)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.HTTP)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusNotFound)
+}
+
+func (s *S) TestPlatformRemoveInUse(c *gocheck.C) {
+	a := app.App{Name: "myapp", Platform: "zend"}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	request, err := http.NewRequest("DELETE", "/platforms/zend?:name=zend", nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = platformRemove(recorder, request, s.token)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.HTTP)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusConflict)
+	c.Assert(e.Message, gocheck.Equals, app.ErrPlatformInUse.Error())
+}
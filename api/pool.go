@@ -0,0 +1,109 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"github.com/globocom/tsuru/app"
+	"github.com/globocom/tsuru/auth"
+	"github.com/globocom/tsuru/errors"
+	"github.com/globocom/tsuru/provision"
+	"github.com/globocom/tsuru/rec"
+	"net/http"
+	"strings"
+)
+
+// poolError converts the errors of pool management to HTTP errors.
+func poolError(err error) error {
+	switch err {
+	case app.ErrPoolsNotSupported, app.ErrInvalidPool, app.ErrNoPoolTeams:
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	case provision.ErrPoolAlreadyExists, provision.ErrPoolNotEmpty, app.ErrPoolInUse:
+		return &errors.HTTP{Code: http.StatusConflict, Message: err.Error()}
+	case provision.ErrPoolNotFound:
+		return &errors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+	}
+	return err
+}
+
+func listPools(w http.ResponseWriter, r *http.Request, t *auth.Token) error {
+	u, err := t.User()
+	if err != nil {
+		return err
+	}
+	rec.Log(u.Email, "list-pools")
+	pools, err := app.ListPools()
+	if err != nil {
+		return poolError(err)
+	}
+	if len(pools) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(pools)
+}
+
+// addPool adds a pool of nodes. The body of the request is a JSON object with
+// the name and the teams of the pool, and whether it's the default pool.
+func addPool(w http.ResponseWriter, r *http.Request, t *auth.Token) error {
+	u, err := t.User()
+	if err != nil {
+		return err
+	}
+	var p provision.Pool
+	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: "Invalid JSON in the request body."}
+	}
+	rec.Log(u.Email, "add-pool", "name="+p.Name, "teams="+strings.Join(p.Teams, ","))
+	return poolError(app.AddPool(p))
+}
+
+func removePool(w http.ResponseWriter, r *http.Request, t *auth.Token) error {
+	u, err := t.User()
+	if err != nil {
+		return err
+	}
+	name := r.URL.Query().Get(":name")
+	rec.Log(u.Email, "remove-pool", "name="+name)
+	return poolError(app.RemovePool(name))
+}
+
+// poolTeams decodes the list of teams in the body of the request.
+func poolTeams(r *http.Request) ([]string, error) {
+	var teams []string
+	if err := json.NewDecoder(r.Body).Decode(&teams); err != nil {
+		return nil, &errors.HTTP{Code: http.StatusBadRequest, Message: "Invalid JSON in the request body."}
+	}
+	return teams, nil
+}
+
+func addTeamsToPool(w http.ResponseWriter, r *http.Request, t *auth.Token) error {
+	u, err := t.User()
+	if err != nil {
+		return err
+	}
+	teams, err := poolTeams(r)
+	if err != nil {
+		return err
+	}
+	name := r.URL.Query().Get(":name")
+	rec.Log(u.Email, "add-teams-to-pool", "name="+name, "teams="+strings.Join(teams, ","))
+	return poolError(app.AddTeamsToPool(name, teams))
+}
+
+func removeTeamsFromPool(w http.ResponseWriter, r *http.Request, t *auth.Token) error {
+	u, err := t.User()
+	if err != nil {
+		return err
+	}
+	teams, err := poolTeams(r)
+	if err != nil {
+		return err
+	}
+	name := r.URL.Query().Get(":name")
+	rec.Log(u.Email, "remove-teams-from-pool", "name="+name, "teams="+strings.Join(teams, ","))
+	return poolError(app.RemoveTeamsFromPool(name, teams))
+}
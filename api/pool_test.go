@@ -0,0 +1,199 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"github.com/globocom/tsuru/app"
+	"github.com/globocom/tsuru/errors"
+	"github.com/globocom/tsuru/provision"
+	"github.com/globocom/tsuru/testing"
+	"launchpad.net/gocheck"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+)
+
+func (s *S) TestListPools(c *gocheck.C) {
+	s.provisioner.AddPool(provision.Pool{Name: "staging", Teams: []string{"ops"}})
+	s.provisioner.AddPool(provision.Pool{Name: "production", Default: true})
+	request, err := http.NewRequest("GET", "/docker/pools", nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = listPools(recorder, request, s.token)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(recorder.Header().Get("Content-Type"), gocheck.Equals, "application/json")
+	var pools []provision.Pool
+	err = json.NewDecoder(recorder.Body).Decode(&pools)
+	c.Assert(err, gocheck.IsNil)
+	expected := []provision.Pool{
+		{Name: "production", Default: true},
+		{Name: "staging", Teams: []string{"ops"}},
+	}
+	c.Assert(pools, gocheck.DeepEquals, expected)
+	action := testing.Action{Action: "list-pools", User: s.user.Email}
+	c.Assert(action, testing.IsRecorded)
+}
+
+func (s *S) TestListPoolsEmpty(c *gocheck.C) {
+	request, err := http.NewRequest("GET", "/docker/pools", nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = listPools(recorder, request, s.token)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(recorder.Code, gocheck.Equals, http.StatusNoContent)
+}
+
+func (s *S) TestListPoolsNotSupported(c *gocheck.C) {
+	app.Provisioner = unmanagedProvisioner{s.provisioner}
+	defer func() { app.Provisioner = s.provisioner }()
+	request, err := http.NewRequest("GET", "/docker/pools", nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = listPools(recorder, request, s.token)
+	e, ok := err.(*errors.HTTP)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusBadRequest)
+	c.Assert(e.Message, gocheck.Equals, app.ErrPoolsNotSupported.Error())
+}
+
+func (s *S) TestAddPool(c *gocheck.C) {
+	body := strings.NewReader(`{"Name":"staging","Teams":["ops","devs"],"Default":true}`)
+	request, err := http.NewRequest("POST", "/docker/pools", body)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = addPool(recorder, request, s.token)
+	c.Assert(err, gocheck.IsNil)
+	pools, err := s.provisioner.ListPools()
+	c.Assert(err, gocheck.IsNil)
+	expected := []provision.Pool{{Name: "staging", Teams: []string{"ops", "devs"}, Default: true}}
+	c.Assert(pools, gocheck.DeepEquals, expected)
+	action := testing.Action{
+		Action: "add-pool",
+		User:   s.user.Email,
+		Extra:  []interface{}{"name=staging", "teams=ops,devs"},
+	}
+	c.Assert(action, testing.IsRecorded)
+}
+
+func (s *S) TestAddPoolInvalid(c *gocheck.C) {
+	for _, body := range []string{"{", `{"Teams":["ops"]}`} {
+		request, err := http.NewRequest("POST", "/docker/pools", strings.NewReader(body))
+		c.Assert(err, gocheck.IsNil)
+		recorder := httptest.NewRecorder()
+		err = addPool(recorder, request, s.token)
+		e, ok := err.(*errors.HTTP)
+		c.Assert(ok, gocheck.Equals, true)
+		c.Assert(e.Code, gocheck.Equals, http.StatusBadRequest)
+	}
+}
+
+func (s *S) TestAddPoolDuplicated(c *gocheck.C) {
+	s.provisioner.AddPool(provision.Pool{Name: "staging"})
+	request, err := http.NewRequest("POST", "/docker/pools", strings.NewReader(`{"Name":"staging"}`))
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = addPool(recorder, request, s.token)
+	e, ok := err.(*errors.HTTP)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusConflict)
+}
+
+func (s *S) TestRemovePool(c *gocheck.C) {
+	s.provisioner.AddPool(provision.Pool{Name: "staging"})
+	request, err := http.NewRequest("DELETE", "/docker/pools/staging?:name=staging", nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = removePool(recorder, request, s.token)
+	c.Assert(err, gocheck.IsNil)
+	pools, err := s.provisioner.ListPools()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(pools, gocheck.HasLen, 0)
+	action := testing.Action{Action: "remove-pool", User: s.user.Email, Extra: []interface{}{"name=staging"}}
+	c.Assert(action, testing.IsRecorded)
+}
+
+func (s *S) TestRemovePoolWithNodes(c *gocheck.C) {
+	s.provisioner.AddPool(provision.Pool{Name: "staging"})
+	s.provisioner.AddNode(provision.Node{ID: "server0", Address: "http://10.10.10.1:4243", Pool: "staging"})
+	request, err := http.NewRequest("DELETE", "/docker/pools/staging?:name=staging", nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = removePool(recorder, request, s.token)
+	e, ok := err.(*errors.HTTP)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusConflict)
+	c.Assert(e.Message, gocheck.Equals, provision.ErrPoolNotEmpty.Error())
+}
+
+func (s *S) TestRemovePoolNotFound(c *gocheck.C) {
+	request, err := http.NewRequest("DELETE", "/docker/pools/staging?:name=staging", nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = removePool(recorder, request, s.token)
+	e, ok := err.(*errors.HTTP)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusNotFound)
+}
+
+func (s *S) TestAddTeamsToPool(c *gocheck.C) {
+	s.provisioner.AddPool(provision.Pool{Name: "staging"})
+	body := strings.NewReader(`["ops","devs"]`)
+	request, err := http.NewRequest("POST", "/docker/pools/staging/teams?:name=staging", body)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = addTeamsToPool(recorder, request, s.token)
+	c.Assert(err, gocheck.IsNil)
+	pools, err := s.provisioner.ListPools()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(pools[0].Teams, gocheck.DeepEquals, []string{"ops", "devs"})
+	action := testing.Action{
+		Action: "add-teams-to-pool",
+		User:   s.user.Email,
+		Extra:  []interface{}{"name=staging", "teams=ops,devs"},
+	}
+	c.Assert(action, testing.IsRecorded)
+}
+
+func (s *S) TestAddTeamsToPoolWithoutTeams(c *gocheck.C) {
+	s.provisioner.AddPool(provision.Pool{Name: "staging"})
+	request, err := http.NewRequest("POST", "/docker/pools/staging/teams?:name=staging", strings.NewReader("[]"))
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = addTeamsToPool(recorder, request, s.token)
+	e, ok := err.(*errors.HTTP)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusBadRequest)
+	c.Assert(e.Message, gocheck.Equals, app.ErrNoPoolTeams.Error())
+}
+
+func (s *S) TestRemoveTeamsFromPool(c *gocheck.C) {
+	s.provisioner.AddPool(provision.Pool{Name: "staging", Teams: []string{"ops", "devs"}})
+	body := strings.NewReader(`["ops"]`)
+	request, err := http.NewRequest("DELETE", "/docker/pools/staging/teams?:name=staging", body)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = removeTeamsFromPool(recorder, request, s.token)
+	c.Assert(err, gocheck.IsNil)
+	pools, err := s.provisioner.ListPools()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(pools[0].Teams, gocheck.DeepEquals, []string{"devs"})
+	action := testing.Action{
+		Action: "remove-teams-from-pool",
+		User:   s.user.Email,
+		Extra:  []interface{}{"name=staging", "teams=ops"},
+	}
+	c.Assert(action, testing.IsRecorded)
+}
+
+func (s *S) TestRemoveTeamsFromUnknownPool(c *gocheck.C) {
+	request, err := http.NewRequest("DELETE", "/docker/pools/staging/teams?:name=staging", strings.NewReader(`["ops"]`))
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = removeTeamsFromPool(recorder, request, s.token)
+	e, ok := err.(*errors.HTTP)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusNotFound)
+}
@@ -0,0 +1,55 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"github.com/globocom/tsuru/auth"
+	"github.com/globocom/tsuru/errors"
+	"github.com/globocom/tsuru/queue"
+	"github.com/globocom/tsuru/rec"
+	"net/http"
+)
+
+// listDeadLetters returns the messages in the dead-letter queue. The queue
+// parameter filters the messages by the queue where they came from.
+func listDeadLetters(w http.ResponseWriter, r *http.Request, t *auth.Token) error {
+	u, err := t.User()
+	if err != nil {
+		return err
+	}
+	name := r.URL.Query().Get("queue")
+	rec.Log(u.Email, "list-dead-letters", "queue="+name)
+	letters, err := queue.DeadLetters(name)
+	if err != nil {
+		return err
+	}
+	if len(letters) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(letters)
+}
+
+// replayDeadLetter puts a message from the dead-letter queue back in its
+// queue.
+func replayDeadLetter(w http.ResponseWriter, r *http.Request, t *auth.Token) error {
+	u, err := t.User()
+	if err != nil {
+		return err
+	}
+	id := r.URL.Query().Get(":id")
+	rec.Log(u.Email, "replay-dead-letter", "id="+id)
+	letter, err := queue.ReplayDeadLetter(id)
+	if err == queue.ErrDeadLetterNotFound {
+		return &errors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+	}
+	if err != nil {
+		return err
+	}
+	requestLog(r, t).Infof("Replayed the %q message to the queue %s", letter.Action, letter.Queue)
+	return nil
+}
@@ -0,0 +1,108 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"github.com/globocom/config"
+	"github.com/globocom/tsuru/errors"
+	"github.com/globocom/tsuru/queue"
+	"github.com/globocom/tsuru/testing"
+	"labix.org/v2/mgo/bson"
+	"launchpad.net/gocheck"
+	"net/http"
+	"net/http/httptest"
+	"time"
+)
+
+func (s *S) insertDeadLetter(c *gocheck.C, queueName, action string) queue.DeadLetter {
+	l := queue.DeadLetter{
+		ID:       bson.NewObjectId(),
+		Queue:    queueName,
+		Action:   action,
+		Args:     []string{"myapp"},
+		Attempts: 11,
+		Date:     time.Now().In(time.UTC),
+	}
+	err := s.conn.DeadLetters().Insert(l)
+	c.Assert(err, gocheck.IsNil)
+	return l
+}
+
+func (s *S) TestListDeadLetters(c *gocheck.C) {
+	s.insertDeadLetter(c, "tsuru-app", "start-app")
+	s.insertDeadLetter(c, "other", "do-something")
+	defer s.conn.DeadLetters().RemoveAll(nil)
+	request, err := http.NewRequest("GET", "/queue/dead-letters?queue=tsuru-app", nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = listDeadLetters(recorder, request, s.token)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(recorder.Header().Get("Content-Type"), gocheck.Equals, "application/json")
+	var letters []queue.DeadLetter
+	err = json.NewDecoder(recorder.Body).Decode(&letters)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(letters, gocheck.HasLen, 1)
+	c.Assert(letters[0].Action, gocheck.Equals, "start-app")
+	c.Assert(letters[0].Attempts, gocheck.Equals, 11)
+	action := testing.Action{
+		Action: "list-dead-letters",
+		User:   s.user.Email,
+		Extra:  []interface{}{"queue=tsuru-app"},
+	}
+	c.Assert(action, testing.IsRecorded)
+}
+
+func (s *S) TestListDeadLettersEmpty(c *gocheck.C) {
+	request, err := http.NewRequest("GET", "/queue/dead-letters", nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = listDeadLetters(recorder, request, s.token)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(recorder.Code, gocheck.Equals, http.StatusNoContent)
+}
+
+func (s *S) TestReplayDeadLetter(c *gocheck.C) {
+	config.Set("queue", "memory")
+	defer config.Unset("queue")
+	l := s.insertDeadLetter(c, "api-replay", "start-app")
+	defer s.conn.DeadLetters().RemoveAll(nil)
+	id := l.ID.Hex()
+	request, err := http.NewRequest("POST", "/queue/dead-letters/"+id+"/replay?:id="+id, nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = replayDeadLetter(recorder, request, s.token)
+	c.Assert(err, gocheck.IsNil)
+	factory, err := queue.Factory()
+	c.Assert(err, gocheck.IsNil)
+	q, err := factory.Get("api-replay")
+	c.Assert(err, gocheck.IsNil)
+	msg, err := q.Get(1e6)
+	c.Assert(err, gocheck.IsNil)
+	defer q.Delete(msg)
+	c.Assert(msg.Action, gocheck.Equals, "start-app")
+	c.Assert(msg.Args, gocheck.DeepEquals, []string{"myapp"})
+	count, err := s.conn.DeadLetters().Count()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(count, gocheck.Equals, 0)
+	action := testing.Action{
+		Action: "replay-dead-letter",
+		User:   s.user.Email,
+		Extra:  []interface{}{"id=" + id},
+	}
+	c.Assert(action, testing.IsRecorded)
+}
+
+func (s *S) TestReplayDeadLetterNotFound(c *gocheck.C) {
+	request, err := http.NewRequest("POST", "/queue/dead-letters/unknown/replay?:id=unknown", nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = replayDeadLetter(recorder, request, s.token)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.HTTP)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusNotFound)
+	c.Assert(e.Message, gocheck.Equals, queue.ErrDeadLetterNotFound.Error())
+}
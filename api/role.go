@@ -0,0 +1,82 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"github.com/globocom/tsuru/auth"
+	"github.com/globocom/tsuru/errors"
+	"github.com/globocom/tsuru/rec"
+	"net/http"
+)
+
+func roleError(err error) error {
+	switch err {
+	case auth.ErrRoleNotFound, auth.ErrInvalidScope, auth.ErrScopeValueMissing:
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	case auth.ErrRoleAlreadyAssigned:
+		return &errors.HTTP{Code: http.StatusConflict, Message: err.Error()}
+	case auth.ErrRoleNotAssigned:
+		return &errors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+	}
+	return err
+}
+
+func roleParams(r *http.Request) (name, scope, value string) {
+	name = r.FormValue("role")
+	scope = r.FormValue("scope")
+	if scope == "" {
+		scope = auth.ScopeGlobal
+	}
+	return name, scope, r.FormValue("value")
+}
+
+func addRole(w http.ResponseWriter, r *http.Request, t *auth.Token) error {
+	u, err := t.User()
+	if err != nil {
+		return err
+	}
+	email := r.URL.Query().Get(":email")
+	name, scope, value := roleParams(r)
+	rec.Log(u.Email, "add-role", "user="+email, "role="+name, "scope="+scope, "value="+value)
+	user, err := auth.GetUserByEmail(email)
+	if err != nil {
+		return &errors.HTTP{Code: http.StatusNotFound, Message: "User not found"}
+	}
+	return roleError(user.AddRole(name, scope, value))
+}
+
+func removeRole(w http.ResponseWriter, r *http.Request, t *auth.Token) error {
+	u, err := t.User()
+	if err != nil {
+		return err
+	}
+	email := r.URL.Query().Get(":email")
+	name, scope, value := roleParams(r)
+	rec.Log(u.Email, "remove-role", "user="+email, "role="+name, "scope="+scope, "value="+value)
+	user, err := auth.GetUserByEmail(email)
+	if err != nil {
+		return &errors.HTTP{Code: http.StatusNotFound, Message: "User not found"}
+	}
+	return roleError(user.RemoveRole(name, scope, value))
+}
+
+func listRoles(w http.ResponseWriter, r *http.Request, t *auth.Token) error {
+	u, err := t.User()
+	if err != nil {
+		return err
+	}
+	email := r.URL.Query().Get(":email")
+	rec.Log(u.Email, "list-roles", "user="+email)
+	user, err := auth.GetUserByEmail(email)
+	if err != nil {
+		return &errors.HTTP{Code: http.StatusNotFound, Message: "User not found"}
+	}
+	if len(user.Roles) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	return json.NewEncoder(w).Encode(user.Roles)
+}
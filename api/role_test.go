@@ -0,0 +1,175 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"github.com/globocom/tsuru/auth"
+	"github.com/globocom/tsuru/errors"
+	"github.com/globocom/tsuru/testing"
+	"labix.org/v2/mgo/bson"
+	"launchpad.net/gocheck"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+)
+
+func (s *S) createRoleUser(c *gocheck.C, roles ...auth.RoleAssignment) *auth.User {
+	u := &auth.User{Email: "roles@tsuru.io", Password: "123456", Roles: roles}
+	err := u.Create()
+	c.Assert(err, gocheck.IsNil)
+	return u
+}
+
+func (s *S) TestAddRole(c *gocheck.C) {
+	u := s.createRoleUser(c)
+	defer s.conn.Users().Remove(bson.M{"email": u.Email})
+	body := strings.NewReader("role=app-deployer&scope=team&value=tsuruteam")
+	request, err := http.NewRequest("POST", "/users/roles@tsuru.io/roles?:email=roles@tsuru.io", body)
+	c.Assert(err, gocheck.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	err = addRole(recorder, request, s.token)
+	c.Assert(err, gocheck.IsNil)
+	user, err := auth.GetUserByEmail(u.Email)
+	c.Assert(err, gocheck.IsNil)
+	expected := []auth.RoleAssignment{{Name: "app-deployer", Scope: auth.ScopeTeam, Value: "tsuruteam"}}
+	c.Assert(user.Roles, gocheck.DeepEquals, expected)
+	action := testing.Action{
+		Action: "add-role",
+		User:   s.user.Email,
+		Extra:  []interface{}{"user=" + u.Email, "role=app-deployer", "scope=team", "value=tsuruteam"},
+	}
+	c.Assert(action, testing.IsRecorded)
+}
+
+func (s *S) TestAddRoleDefaultsToGlobalScope(c *gocheck.C) {
+	u := s.createRoleUser(c)
+	defer s.conn.Users().Remove(bson.M{"email": u.Email})
+	body := strings.NewReader("role=app-viewer")
+	request, err := http.NewRequest("POST", "/users/roles@tsuru.io/roles?:email=roles@tsuru.io", body)
+	c.Assert(err, gocheck.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	err = addRole(recorder, request, s.token)
+	c.Assert(err, gocheck.IsNil)
+	user, err := auth.GetUserByEmail(u.Email)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(user.Roles, gocheck.DeepEquals, []auth.RoleAssignment{{Name: "app-viewer", Scope: auth.ScopeGlobal}})
+}
+
+func (s *S) TestAddRoleInvalid(c *gocheck.C) {
+	u := s.createRoleUser(c)
+	defer s.conn.Users().Remove(bson.M{"email": u.Email})
+	body := strings.NewReader("role=superuser")
+	request, err := http.NewRequest("POST", "/users/roles@tsuru.io/roles?:email=roles@tsuru.io", body)
+	c.Assert(err, gocheck.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	err = addRole(recorder, request, s.token)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.HTTP)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusBadRequest)
+	c.Assert(e.Message, gocheck.Equals, auth.ErrRoleNotFound.Error())
+}
+
+func (s *S) TestAddRoleAlreadyAssigned(c *gocheck.C) {
+	u := s.createRoleUser(c, auth.RoleAssignment{Name: "app-viewer", Scope: auth.ScopeGlobal})
+	defer s.conn.Users().Remove(bson.M{"email": u.Email})
+	body := strings.NewReader("role=app-viewer&scope=global")
+	request, err := http.NewRequest("POST", "/users/roles@tsuru.io/roles?:email=roles@tsuru.io", body)
+	c.Assert(err, gocheck.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	err = addRole(recorder, request, s.token)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.HTTP)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusConflict)
+}
+
+func (s *S) TestAddRoleUserNotFound(c *gocheck.C) {
+	body := strings.NewReader("role=app-viewer")
+	request, err := http.NewRequest("POST", "/users/nobody@tsuru.io/roles?:email=nobody@tsuru.io", body)
+	c.Assert(err, gocheck.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	err = addRole(recorder, request, s.token)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.HTTP)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusNotFound)
+	c.Assert(e.Message, gocheck.Equals, "User not found")
+}
+
+func (s *S) TestRemoveRole(c *gocheck.C) {
+	u := s.createRoleUser(c,
+		auth.RoleAssignment{Name: "app-viewer", Scope: auth.ScopeApp, Value: "myapp"},
+		auth.RoleAssignment{Name: "team-admin", Scope: auth.ScopeTeam, Value: "tsuruteam"},
+	)
+	defer s.conn.Users().Remove(bson.M{"email": u.Email})
+	request, err := http.NewRequest("DELETE", "/users/roles@tsuru.io/roles?:email=roles@tsuru.io&role=app-viewer&scope=app&value=myapp", nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = removeRole(recorder, request, s.token)
+	c.Assert(err, gocheck.IsNil)
+	user, err := auth.GetUserByEmail(u.Email)
+	c.Assert(err, gocheck.IsNil)
+	expected := []auth.RoleAssignment{{Name: "team-admin", Scope: auth.ScopeTeam, Value: "tsuruteam"}}
+	c.Assert(user.Roles, gocheck.DeepEquals, expected)
+	action := testing.Action{
+		Action: "remove-role",
+		User:   s.user.Email,
+		Extra:  []interface{}{"user=" + u.Email, "role=app-viewer", "scope=app", "value=myapp"},
+	}
+	c.Assert(action, testing.IsRecorded)
+}
+
+func (s *S) TestRemoveRoleNotAssigned(c *gocheck.C) {
+	u := s.createRoleUser(c)
+	defer s.conn.Users().Remove(bson.M{"email": u.Email})
+	request, err := http.NewRequest("DELETE", "/users/roles@tsuru.io/roles?:email=roles@tsuru.io&role=app-viewer", nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = removeRole(recorder, request, s.token)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.HTTP)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusNotFound)
+	c.Assert(e.Message, gocheck.Equals, auth.ErrRoleNotAssigned.Error())
+}
+
+func (s *S) TestListRoles(c *gocheck.C) {
+	roles := []auth.RoleAssignment{
+		{Name: "app-viewer", Scope: auth.ScopeApp, Value: "myapp"},
+		{Name: "service-admin", Scope: auth.ScopeGlobal},
+	}
+	u := s.createRoleUser(c, roles...)
+	defer s.conn.Users().Remove(bson.M{"email": u.Email})
+	request, err := http.NewRequest("GET", "/users/roles@tsuru.io/roles?:email=roles@tsuru.io", nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = listRoles(recorder, request, s.token)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(recorder.Code, gocheck.Equals, http.StatusOK)
+	var got []auth.RoleAssignment
+	err = json.NewDecoder(recorder.Body).Decode(&got)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(got, gocheck.DeepEquals, roles)
+	action := testing.Action{Action: "list-roles", User: s.user.Email, Extra: []interface{}{"user=" + u.Email}}
+	c.Assert(action, testing.IsRecorded)
+}
+
+func (s *S) TestListRolesEmpty(c *gocheck.C) {
+	u := s.createRoleUser(c)
+	defer s.conn.Users().Remove(bson.M{"email": u.Email})
+	request, err := http.NewRequest("GET", "/users/roles@tsuru.io/roles?:email=roles@tsuru.io", nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = listRoles(recorder, request, s.token)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(recorder.Code, gocheck.Equals, http.StatusNoContent)
+}
@@ -5,20 +5,68 @@
 package api
 
 import (
+	"crypto/tls"
 	"fmt"
-	"github.com/bmizerany/pat"
 	"github.com/globocom/config"
+	"github.com/globocom/tsuru/action"
 	"github.com/globocom/tsuru/app"
+	"github.com/globocom/tsuru/auth"
 	"github.com/globocom/tsuru/log"
+	"github.com/globocom/tsuru/metrics"
 	"github.com/globocom/tsuru/provision"
+	"github.com/globocom/tsuru/shutdown"
 	"net"
 	"net/http"
+	"time"
 )
 
 func fatal(err error) {
 	log.Fatal(err)
 }
 
+// serve serves HTTP requests in the listener until the process receives
+// SIGTERM or SIGINT. Then it stops accepting connections, and waits for the
+// requests in flight, the queue handlers and the running pipelines to finish,
+// up to the shutdown timeout.
+func serve(listener net.Listener, d *drainer) {
+	go func() {
+		sig := <-shutdown.Notify()
+		fmt.Printf("Received %s, shutting down the tsuru HTTP server...\n", sig)
+		d.drain()
+		listener.Close()
+	}()
+	err := http.Serve(listener, d)
+	if !d.isDraining() {
+		fatal(err)
+	}
+	deadline := time.Now().Add(shutdown.Timeout())
+	if requests, conns := d.wait(deadline); requests+conns > 0 {
+		log.Warnf("Shutting down with %d requests still running and %d connections open.", requests, conns)
+	}
+	if err := shutdown.Drain(deadline); err != nil {
+		log.Warnf("Shutting down before the queue handlers and pipelines finished: %s", err)
+	}
+	fmt.Println("tsuru HTTP server stopped.")
+}
+
+// serveMetrics serves the metrics of the API server in the address defined by
+// the setting metrics-listen, if any. The metrics are not served in the
+// address of the API, which is public.
+func serveMetrics() {
+	listen, err := config.GetString("metrics-listen")
+	if err != nil {
+		return
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+	fmt.Printf("tsuru HTTP server metrics listening at %s...\n", listen)
+	go func() {
+		if err := http.ListenAndServe(listen, mux); err != nil {
+			log.Errorf("Failed to serve the metrics of the API server: %s", err)
+		}
+	}()
+}
+
 // RunServer starts Tsuru API server. The dry parameter indicates whether the
 // server should run in dry mode, not starting the HTTP listener (for testing
 // purposes).
@@ -34,7 +82,7 @@ func RunServer(dry bool) {
 	}
 	fmt.Printf("Using the database %q from the server %q.\n\n", dbName, connString)
 
-	m := pat.New()
+	m := newRouter()
 
 	m.Get("/schema/app", authorizationRequiredHandler(appSchema))
 	m.Get("/schema/service", authorizationRequiredHandler(serviceSchema))
@@ -44,47 +92,61 @@ func RunServer(dry bool) {
 
 	m.Get("/services/instances", authorizationRequiredHandler(serviceInstances))
 	m.Get("/services/instances/:name", authorizationRequiredHandler(serviceInstance))
-	m.Del("/services/instances/:name", authorizationRequiredHandler(removeServiceInstance))
-	m.Post("/services/instances", authorizationRequiredHandler(createServiceInstance))
-	m.Put("/services/instances/:instance/:app", authorizationRequiredHandler(bindServiceInstance))
-	m.Del("/services/instances/:instance/:app", authorizationRequiredHandler(unbindServiceInstance))
+	m.Del("/services/instances/:name", authorizationRequiredHandler(recordEvent("service-instance-remove", "service-instance", ":name", removeServiceInstance)))
+	m.Post("/services/instances", authorizationRequiredHandler(recordEvent("service-instance-create", "service-instance", "name", createServiceInstance)))
+	m.Put("/services/instances/:instance/:app", permissionRequired(auth.PermAppUpdate, recordEvent("app-bind", "app", ":app", bindServiceInstance)))
+	m.Del("/services/instances/:instance/:app", permissionRequired(auth.PermAppUpdate, recordEvent("app-unbind", "app", ":app", unbindServiceInstance)))
 	m.Get("/services/instances/:instance/status", authorizationRequiredHandler(serviceInstanceStatus))
 
 	m.Get("/services", authorizationRequiredHandler(serviceList))
-	m.Post("/services", authorizationRequiredHandler(serviceCreate))
-	m.Put("/services", authorizationRequiredHandler(serviceUpdate))
-	m.Del("/services/:name", authorizationRequiredHandler(serviceDelete))
+	m.Post("/services", authorizationRequiredHandler(recordEvent("service-create", "service", "id", serviceCreate)))
+	m.Put("/services", authorizationRequiredHandler(recordEvent("service-update", "service", "id", serviceUpdate)))
+	m.Del("/services/:name", authorizationRequiredHandler(recordEvent("service-remove", "service", ":name", serviceDelete)))
 	m.Get("/services/:name", authorizationRequiredHandler(serviceInfo))
 	m.Get("/services/:name/doc", authorizationRequiredHandler(serviceDoc))
-	m.Put("/services/:name/doc", authorizationRequiredHandler(serviceAddDoc))
-	m.Put("/services/:service/:team", authorizationRequiredHandler(grantServiceAccess))
-	m.Del("/services/:service/:team", authorizationRequiredHandler(revokeServiceAccess))
-
-	m.Del("/apps/:app", authorizationRequiredHandler(appDelete))
-	m.Get("/apps/:app", authorizationRequiredHandler(appInfo))
-	m.Post("/apps/:app/cname", authorizationRequiredHandler(setCName))
-	m.Del("/apps/:app/cname", authorizationRequiredHandler(unsetCName))
-	m.Post("/apps/:app/run", authorizationRequiredHandler(runCommand))
-	m.Get("/apps/:app/restart", authorizationRequiredHandler(restart))
-	m.Get("/apps/:app/env", authorizationRequiredHandler(getEnv))
-	m.Post("/apps/:app/env", authorizationRequiredHandler(setEnv))
-	m.Del("/apps/:app/env", authorizationRequiredHandler(unsetEnv))
+	m.Put("/services/:name/doc", authorizationRequiredHandler(recordEvent("service-update-doc", "service", ":name", serviceAddDoc)))
+	m.Put("/services/:service/:team", authorizationRequiredHandler(recordEvent("service-grant", "service", ":service", grantServiceAccess)))
+	m.Del("/services/:service/:team", authorizationRequiredHandler(recordEvent("service-revoke", "service", ":service", revokeServiceAccess)))
+
+	m.Del("/apps/:app", permissionRequired(auth.PermAppDelete, recordEvent("app-remove", "app", ":app", appDelete)))
+	m.Get("/apps/:app", permissionRequired(auth.PermAppRead, appInfo))
+	m.Post("/apps/:app/cname", permissionRequired(auth.PermAppUpdate, recordEvent("app-set-cname", "app", ":app", setCName)))
+	m.Del("/apps/:app/cname", permissionRequired(auth.PermAppUpdate, recordEvent("app-unset-cname", "app", ":app", unsetCName)))
+	m.Post("/apps/:app/resources", permissionRequired(auth.PermAppUpdate, recordEvent("app-set-resources", "app", ":app", setResources)))
+	m.Post("/apps/:app/run", permissionRequired(auth.PermAppUpdate, recordEvent("app-run", "app", ":app", runCommand)))
+	m.Get("/apps/:app/restart", permissionRequired(auth.PermAppRestart, recordEvent("app-restart", "app", ":app", restart)))
+	m.Post("/apps/:app/rollback", permissionRequired(auth.PermAppDeploy, recordEvent("app-rollback", "app", ":app", rollback)))
+	m.Get("/apps/:app/deploys", permissionRequired(auth.PermAppRead, deploysList))
+	m.Get("/deploys/:id", authorizationRequiredHandler(deployInfo))
+	m.Get("/apps/:app/env", permissionRequired(auth.PermAppRead, getEnv))
+	m.Post("/apps/:app/env", permissionRequired(auth.PermAppUpdate, recordEvent("app-set-env", "app", ":app", setEnv)))
+	m.Del("/apps/:app/env", permissionRequired(auth.PermAppUpdate, recordEvent("app-unset-env", "app", ":app", unsetEnv)))
+	m.Get("/apps/:app/log-drains", permissionRequired(auth.PermAppRead, listLogDrains))
+	m.Post("/apps/:app/log-drains", permissionRequired(auth.PermAppUpdate, recordEvent("app-add-log-drain", "app", ":app", addLogDrain)))
+	m.Del("/apps/:app/log-drains", permissionRequired(auth.PermAppUpdate, recordEvent("app-remove-log-drain", "app", ":app", removeLogDrain)))
+	m.Get("/apps/:app/autoscale", permissionRequired(auth.PermAppRead, getAutoscaleRule))
+	m.Post("/apps/:app/autoscale", permissionRequired(auth.PermAppUpdate, recordEvent("app-set-autoscale", "app", ":app", setAutoscaleRule)))
+	m.Del("/apps/:app/autoscale", permissionRequired(auth.PermAppUpdate, recordEvent("app-unset-autoscale", "app", ":app", removeAutoscaleRule)))
+	m.Post("/apps/:app/log-retention", adminRequiredHandler(recordEvent("app-set-log-retention", "app", ":app", setLogRetention)))
 	m.Get("/apps", authorizationRequiredHandler(appList))
-	m.Post("/apps", authorizationRequiredHandler(createApp))
-	m.Put("/apps/:app/units", authorizationRequiredHandler(addUnits))
-	m.Del("/apps/:app/units", authorizationRequiredHandler(removeUnits))
-	m.Put("/apps/:app/:team", authorizationRequiredHandler(grantAppAccess))
-	m.Del("/apps/:app/:team", authorizationRequiredHandler(revokeAppAccess))
-	m.Get("/apps/:app/log", authorizationRequiredHandler(appLog))
+	m.Post("/apps", authorizationRequiredHandler(dryRunHandler(createAppDryRun, recordEventSteps("app-create", "app", "name", createApp))))
+	m.Put("/apps/:app/units", permissionRequired(auth.PermAppUpdate, recordEvent("app-add-units", "app", ":app", addUnits)))
+	m.Del("/apps/:app/units", permissionRequired(auth.PermAppUpdate, recordEvent("app-remove-units", "app", ":app", removeUnits)))
+	m.Put("/apps/:app/:team", permissionRequired(auth.PermAppUpdate, recordEvent("app-grant", "app", ":app", grantAppAccess)))
+	m.Del("/apps/:app/:team", permissionRequired(auth.PermAppUpdate, recordEvent("app-revoke", "app", ":app", revokeAppAccess)))
+	m.Get("/apps/:app/log", permissionRequired(auth.PermAppRead, appLog))
 	m.Post("/apps/:app/log", authorizationRequiredHandler(addLog))
 
 	m.Get("/platforms", authorizationRequiredHandler(platformList))
+	m.Post("/platforms", adminRequiredHandler(recordEvent("platform-add", "platform", "name", platformAdd)))
+	m.Put("/platforms/:name", adminRequiredHandler(recordEvent("platform-update", "platform", ":name", platformUpdate)))
+	m.Del("/platforms/:name", adminRequiredHandler(recordEvent("platform-remove", "platform", ":name", platformRemove)))
 
 	// These handlers don't use :app on purpose. Using :app means that only
 	// the token generate for the given app is valid, but these handlers
 	// use a token generated for Gandalf.
 	m.Get("/apps/:appname/available", authorizationRequiredHandler(appIsAvailable))
-	m.Post("/apps/:appname/repository/clone", authorizationRequiredHandler(cloneRepository))
+	m.Post("/apps/:appname/repository/clone", authorizationRequiredHandler(recordEvent("app-deploy", "app", ":appname", cloneRepository)))
 
 	if registrationEnabled, _ := config.GetBool("auth:user-registration"); registrationEnabled {
 		m.Post("/users", handler(createUser))
@@ -92,26 +154,53 @@ func RunServer(dry bool) {
 
 	m.Post("/users/:email/password", handler(resetPassword))
 	m.Post("/users/:email/tokens", handler(login))
+	m.Get("/auth/scheme", handler(authScheme))
+	m.Post("/auth/login", handler(login))
 	m.Del("/users/tokens", authorizationRequiredHandler(logout))
-	m.Put("/users/password", authorizationRequiredHandler(changePassword))
-	m.Del("/users", authorizationRequiredHandler(removeUser))
+	m.Get("/users/tokens", authorizationRequiredHandler(listAPITokens))
+	m.Post("/users/tokens", authorizationRequiredHandler(recordEvent("user-create-api-token", "user", "", createAPIToken)))
+	m.Del("/users/tokens/:name", authorizationRequiredHandler(recordEvent("user-revoke-api-token", "user", "", revokeAPIToken)))
+	m.Put("/users/password", authorizationRequiredHandler(recordEvent("user-change-password", "user", "", changePassword)))
+	m.Del("/users", authorizationRequiredHandler(recordEvent("user-remove", "user", "", removeUser)))
 	m.Get("/users/:email/keys", authorizationRequiredHandler(listKeys))
-	m.Post("/users/keys", authorizationRequiredHandler(addKeyToUser))
-	m.Del("/users/keys", authorizationRequiredHandler(removeKeyFromUser))
+	m.Post("/users/keys", authorizationRequiredHandler(recordEvent("user-add-key", "user", "", addKeyToUser)))
+	m.Del("/users/keys", authorizationRequiredHandler(recordEvent("user-remove-key", "user", "", removeKeyFromUser)))
+
+	m.Get("/users/:email/roles", adminRequiredHandler(listRoles))
+	m.Post("/users/:email/roles", adminRequiredHandler(recordEvent("role-add", "user", ":email", addRole)))
+	m.Del("/users/:email/roles", adminRequiredHandler(recordEvent("role-remove", "user", ":email", removeRole)))
 
-	m.Post("/tokens", adminRequiredHandler(generateAppToken))
+	m.Post("/tokens", adminRequiredHandler(recordEvent("app-create-token", "app", "client", generateAppToken)))
 
 	m.Get("/teams", authorizationRequiredHandler(teamList))
-	m.Post("/teams", authorizationRequiredHandler(createTeam))
+	m.Post("/teams", authorizationRequiredHandler(recordEvent("team-create", "team", "name", createTeam)))
 	m.Get("/teams/:name", authorizationRequiredHandler(getTeam))
-	m.Del("/teams/:name", authorizationRequiredHandler(removeTeam))
-	m.Put("/teams/:team/:user", authorizationRequiredHandler(addUserToTeam))
-	m.Del("/teams/:team/:user", authorizationRequiredHandler(removeUserFromTeam))
+	m.Del("/teams/:name", authorizationRequiredHandler(recordEvent("team-remove", "team", ":name", removeTeam)))
+	m.Put("/teams/:team/:user", permissionRequired(auth.PermTeamAdmin, recordEvent("team-add-user", "team", ":team", addUserToTeam)))
+	m.Del("/teams/:team/:user", permissionRequired(auth.PermTeamAdmin, recordEvent("team-remove-user", "team", ":team", removeUserFromTeam)))
+
+	m.Get("/events", authorizationRequiredHandler(listEvents))
+	m.Get("/events/:id", authorizationRequiredHandler(eventInfo))
 
 	m.Get("/healers", authorizationRequiredHandler(healers))
 	m.Get("/healers/:healer", authorizationRequiredHandler(healer))
 
-	m.Put("/swap", authorizationRequiredHandler(swap))
+	m.Put("/swap", appsPermissionRequired(auth.PermAppUpdate, []string{"app1", "app2"}, recordEvent("app-swap", "app", "app1", swap)))
+
+	m.Get("/queue/dead-letters", adminRequiredHandler(listDeadLetters))
+	m.Post("/queue/dead-letters/:id/replay", adminRequiredHandler(recordEvent("queue-dead-letter-replay", "queue-message", ":id", replayDeadLetter)))
+
+	m.Get("/docker/nodes", adminRequiredHandler(listNodes))
+	m.Post("/docker/nodes", adminRequiredHandler(recordEvent("docker-node-add", "docker-node", "ID", addNode)))
+	m.Del("/docker/nodes/:id", adminRequiredHandler(recordEvent("docker-node-remove", "docker-node", ":id", removeNode)))
+	m.Get("/docker/pools", adminRequiredHandler(listPools))
+	m.Post("/docker/pools", adminRequiredHandler(recordEvent("docker-pool-add", "docker-pool", "Name", addPool)))
+	m.Del("/docker/pools/:name", adminRequiredHandler(recordEvent("docker-pool-remove", "docker-pool", ":name", removePool)))
+	m.Post("/docker/pools/:name/teams", adminRequiredHandler(recordEvent("docker-pool-add-teams", "docker-pool", ":name", addTeamsToPool)))
+	m.Del("/docker/pools/:name/teams", adminRequiredHandler(recordEvent("docker-pool-remove-teams", "docker-pool", ":name", removeTeamsFromPool)))
+
+	m.Get("/log-level", adminRequiredHandler(getLogLevel))
+	m.Put("/log-level", adminRequiredHandler(recordEvent("log-level-set", "log-level", "level", setLogLevel)))
 
 	if !dry {
 		provisioner, err := config.GetString("provisioner")
@@ -124,13 +213,20 @@ func RunServer(dry bool) {
 			fatal(err)
 		}
 		fmt.Printf("Using %q provisioner.\n\n", provisioner)
+		go action.KeepRecovering()
 
 		listen, err := config.GetString("listen")
 		if err != nil {
 			fatal(err)
 		}
-		tls, _ := config.GetBool("use-tls")
-		if tls {
+		listener, err := net.Listen("tcp", listen)
+		if err != nil {
+			fatal(err)
+		}
+		d := &drainer{handler: http.DefaultServeMux}
+		listener = d.listen(listener)
+		useTLS, _ := config.GetBool("use-tls")
+		if useTLS {
 			certFile, err := config.GetString("tls:cert-file")
 			if err != nil {
 				fatal(err)
@@ -139,16 +235,17 @@ func RunServer(dry bool) {
 			if err != nil {
 				fatal(err)
 			}
-			fmt.Printf("tsuru HTTP/TLS server listening at %s...\n", listen)
-			fatal(http.ListenAndServeTLS(listen, certFile, keyFile, m))
-		} else {
-			listener, err := net.Listen("tcp", listen)
+			cert, err := tls.LoadX509KeyPair(certFile, keyFile)
 			if err != nil {
 				fatal(err)
 			}
+			listener = tls.NewListener(listener, &tls.Config{Certificates: []tls.Certificate{cert}})
+			fmt.Printf("tsuru HTTP/TLS server listening at %s...\n", listen)
+		} else {
 			fmt.Printf("tsuru HTTP server listening at %s...\n", listen)
-			http.Handle("/", m)
-			fatal(http.Serve(listener, nil))
 		}
+		serveMetrics()
+		http.Handle("/", m)
+		serve(listener, d)
 	}
 }
@@ -250,7 +250,7 @@ func getServiceByOwner(name string, u *auth.User) (service.Service, error) {
 	if err != nil {
 		return s, &errors.HTTP{Code: http.StatusNotFound, Message: "Service not found"}
 	}
-	if !auth.CheckUserAccess(s.OwnerTeams, u) {
+	if !u.HasPermission(auth.PermServiceAdmin, "", s.OwnerTeams) {
 		msg := "This user does not have access to this service"
 		return s, &errors.HTTP{Code: http.StatusForbidden, Message: msg}
 	}
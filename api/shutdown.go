@@ -0,0 +1,171 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// States of the connections tracked by the drainer.
+const (
+	// The connection is waiting for a request.
+	connIdle int32 = iota
+	// The connection is reading or serving a request.
+	connActive
+	// The handler returned, and the response is being sent.
+	connFinishing
+)
+
+// drainer wraps the handler and the listener of the server, tracking the
+// requests in flight and the open connections, so the server can wait for
+// them when shutting down. While draining, keep-alives are turned off: idle
+// connections are closed, and so are the connections serving requests, after
+// the response.
+type drainer struct {
+	handler  http.Handler
+	inFlight int32
+	draining int32
+	mu       sync.Mutex
+	conns    map[string]*drainConn
+}
+
+func (d *drainer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	atomic.AddInt32(&d.inFlight, 1)
+	defer atomic.AddInt32(&d.inFlight, -1)
+	defer d.finish(r.RemoteAddr)
+	if atomic.LoadInt32(&d.draining) == 1 {
+		w.Header().Set("Connection", "close")
+	}
+	d.handler.ServeHTTP(w, r)
+}
+
+// listen wraps the listener, tracking the connections accepted by it. The
+// listener must be wrapped before any TLS listener, so connections are
+// tracked by their remote addresses.
+func (d *drainer) listen(l net.Listener) net.Listener {
+	return &drainListener{Listener: l, d: d}
+}
+
+func (d *drainer) track(c net.Conn) net.Conn {
+	conn := &drainConn{Conn: c, d: d, addr: c.RemoteAddr().String()}
+	d.mu.Lock()
+	if d.conns == nil {
+		d.conns = make(map[string]*drainConn)
+	}
+	d.conns[conn.addr] = conn
+	d.mu.Unlock()
+	return conn
+}
+
+func (d *drainer) untrack(c *drainConn) {
+	d.mu.Lock()
+	if d.conns[c.addr] == c {
+		delete(d.conns, c.addr)
+	}
+	d.mu.Unlock()
+}
+
+// finish marks the connection of the request as sending the response, so it
+// becomes idle after the response is written.
+func (d *drainer) finish(addr string) {
+	d.mu.Lock()
+	conn := d.conns[addr]
+	d.mu.Unlock()
+	if conn != nil {
+		atomic.StoreInt32(&conn.state, connFinishing)
+	}
+}
+
+// drain marks the server as draining and closes the idle connections. It
+// must be called before closing the listener.
+func (d *drainer) drain() {
+	atomic.StoreInt32(&d.draining, 1)
+	d.closeIdle()
+}
+
+func (d *drainer) closeIdle() {
+	d.mu.Lock()
+	var idle []*drainConn
+	for _, conn := range d.conns {
+		if atomic.LoadInt32(&conn.state) == connIdle {
+			idle = append(idle, conn)
+		}
+	}
+	d.mu.Unlock()
+	for _, conn := range idle {
+		conn.Close()
+	}
+}
+
+func (d *drainer) isDraining() bool {
+	return atomic.LoadInt32(&d.draining) == 1
+}
+
+// wait waits for the requests in flight to finish and for the connections to
+// be closed, until the deadline, closing the connections that become idle
+// while draining. It returns the number of requests still running and of
+// connections still open.
+func (d *drainer) wait(deadline time.Time) (requests, conns int) {
+	for {
+		if d.isDraining() {
+			d.closeIdle()
+		}
+		requests = int(atomic.LoadInt32(&d.inFlight))
+		d.mu.Lock()
+		conns = len(d.conns)
+		d.mu.Unlock()
+		if requests+conns == 0 || !time.Now().Before(deadline) {
+			return requests, conns
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+type drainListener struct {
+	net.Listener
+	d *drainer
+}
+
+func (l *drainListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return l.d.track(c), nil
+}
+
+// drainConn is a connection tracked by the drainer. Reading data means a
+// request is arriving, and writing after the handler returned means the
+// response is being sent, after which the server waits for the next request.
+type drainConn struct {
+	net.Conn
+	d     *drainer
+	addr  string
+	state int32
+	once  sync.Once
+}
+
+func (c *drainConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if n > 0 {
+		atomic.StoreInt32(&c.state, connActive)
+	}
+	return n, err
+}
+
+func (c *drainConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	atomic.CompareAndSwapInt32(&c.state, connFinishing, connIdle)
+	return n, err
+}
+
+func (c *drainConn) Close() error {
+	c.once.Do(func() { c.d.untrack(c) })
+	return c.Conn.Close()
+}
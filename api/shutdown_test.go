@@ -0,0 +1,104 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"io/ioutil"
+	"launchpad.net/gocheck"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"time"
+)
+
+func (s *S) TestDrainerCountsRequestsInFlight(c *gocheck.C) {
+	started := make(chan bool)
+	finish := make(chan bool)
+	d := &drainer{handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- true
+		<-finish
+	})}
+	request, err := http.NewRequest("GET", "/apps", nil)
+	c.Assert(err, gocheck.IsNil)
+	go d.ServeHTTP(httptest.NewRecorder(), request)
+	<-started
+	requests, _ := d.wait(time.Now().Add(1e8))
+	c.Assert(requests, gocheck.Equals, 1)
+	close(finish)
+	requests, _ = d.wait(time.Now().Add(2e9))
+	c.Assert(requests, gocheck.Equals, 0)
+}
+
+func (s *S) TestDrainerClosesConnectionsWhenDraining(c *gocheck.C) {
+	d := &drainer{handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})}
+	request, err := http.NewRequest("GET", "/apps", nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	d.ServeHTTP(recorder, request)
+	c.Assert(recorder.Header().Get("Connection"), gocheck.Equals, "")
+	c.Assert(d.isDraining(), gocheck.Equals, false)
+	d.drain()
+	c.Assert(d.isDraining(), gocheck.Equals, true)
+	recorder = httptest.NewRecorder()
+	d.ServeHTTP(recorder, request)
+	c.Assert(recorder.Header().Get("Connection"), gocheck.Equals, "close")
+}
+
+func (s *S) TestDrainerClosesIdleConnections(c *gocheck.C) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, gocheck.IsNil)
+	d := &drainer{handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})}
+	go http.Serve(d.listen(listener), d)
+	client := &http.Client{Transport: &http.Transport{}}
+	resp, err := client.Get("http://" + listener.Addr().String() + "/")
+	c.Assert(err, gocheck.IsNil)
+	ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	time.Sleep(10 * time.Millisecond)
+	_, conns := d.wait(time.Now())
+	c.Assert(conns, gocheck.Equals, 1)
+	d.drain()
+	listener.Close()
+	requests, conns := d.wait(time.Now().Add(2e9))
+	c.Assert(requests, gocheck.Equals, 0)
+	c.Assert(conns, gocheck.Equals, 0)
+}
+
+func (s *S) TestDrainerWaitsForTheConnectionsServingRequests(c *gocheck.C) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, gocheck.IsNil)
+	started := make(chan bool)
+	finish := make(chan bool)
+	d := &drainer{handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- true
+		<-finish
+		w.Write([]byte("ok"))
+	})}
+	go http.Serve(d.listen(listener), d)
+	responses := make(chan *http.Response, 1)
+	go func() {
+		client := &http.Client{Transport: &http.Transport{}}
+		resp, err := client.Get("http://" + listener.Addr().String() + "/")
+		c.Check(err, gocheck.IsNil)
+		responses <- resp
+	}()
+	<-started
+	d.drain()
+	listener.Close()
+	requests, conns := d.wait(time.Now().Add(1e8))
+	c.Assert(requests, gocheck.Equals, 1)
+	c.Assert(conns, gocheck.Equals, 1)
+	close(finish)
+	resp := <-responses
+	c.Assert(resp, gocheck.NotNil)
+	body, err := ioutil.ReadAll(resp.Body)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(string(body), gocheck.Equals, "ok")
+	requests, conns = d.wait(time.Now().Add(2e9))
+	c.Assert(requests, gocheck.Equals, 0)
+	c.Assert(conns, gocheck.Equals, 0)
+}
@@ -0,0 +1,105 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"github.com/globocom/tsuru/auth"
+	"github.com/globocom/tsuru/errors"
+	"github.com/globocom/tsuru/rec"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// apiToken is the representation of API tokens in the API. The value of the
+// token is returned only when the token is created.
+type apiToken struct {
+	Token   string    `json:"token,omitempty"`
+	Name    string    `json:"name"`
+	Scope   string    `json:"scope"`
+	Apps    []string  `json:"apps,omitempty"`
+	Expires time.Time `json:"expires"`
+}
+
+func newAPIToken(t *auth.Token) apiToken {
+	return apiToken{
+		Name:    t.Name,
+		Scope:   t.Scope,
+		Apps:    t.Apps,
+		Expires: t.Creation.Add(t.Expires),
+	}
+}
+
+// createAPIToken creates a named API token for the user. The request body
+// contains the name, the scope, the apps and the expiration of the token,
+// in days.
+func createAPIToken(w http.ResponseWriter, r *http.Request, t *auth.Token) error {
+	var body struct {
+		Name    string
+		Scope   string
+		Apps    []string
+		Expires int
+	}
+	defer r.Body.Close()
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: "Invalid JSON"}
+	}
+	u, err := t.User()
+	if err != nil {
+		return err
+	}
+	rec.Log(u.Email, "create-api-token", "name="+body.Name, "scope="+body.Scope, "apps="+strings.Join(body.Apps, ","))
+	expires := time.Duration(body.Expires) * 24 * time.Hour
+	token, err := u.CreateAPIToken(body.Name, body.Scope, body.Apps, expires)
+	switch err {
+	case nil:
+	case auth.ErrDuplicateToken:
+		return &errors.HTTP{Code: http.StatusConflict, Message: err.Error()}
+	case auth.ErrTokenNameMissing, auth.ErrInvalidTokenScope, auth.ErrTokenAppsMissing, auth.ErrTokenExpiresMissing:
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	default:
+		return err
+	}
+	result := newAPIToken(token)
+	result.Token = token.Token
+	return json.NewEncoder(w).Encode(result)
+}
+
+func listAPITokens(w http.ResponseWriter, r *http.Request, t *auth.Token) error {
+	u, err := t.User()
+	if err != nil {
+		return err
+	}
+	rec.Log(u.Email, "list-api-tokens")
+	tokens, err := u.APITokens()
+	if err != nil {
+		return err
+	}
+	if len(tokens) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	result := make([]apiToken, len(tokens))
+	for i := range tokens {
+		result[i] = newAPIToken(&tokens[i])
+	}
+	return json.NewEncoder(w).Encode(result)
+}
+
+func revokeAPIToken(w http.ResponseWriter, r *http.Request, t *auth.Token) error {
+	u, err := t.User()
+	if err != nil {
+		return err
+	}
+	name := r.URL.Query().Get(":name")
+	rec.Log(u.Email, "revoke-api-token", "name="+name)
+	err = u.RevokeAPIToken(name)
+	if err == auth.ErrTokenNotFound {
+		return &errors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+	}
+	return err
+}
@@ -0,0 +1,151 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"github.com/globocom/tsuru/auth"
+	"github.com/globocom/tsuru/errors"
+	"github.com/globocom/tsuru/testing"
+	"labix.org/v2/mgo/bson"
+	"launchpad.net/gocheck"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+)
+
+func (s *S) TestCreateAPIToken(c *gocheck.C) {
+	body := strings.NewReader(`{"name":"ci","scope":"app","apps":["myapp"],"expires":30}`)
+	request, err := http.NewRequest("POST", "/users/tokens", body)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = createAPIToken(recorder, request, s.token)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Tokens().RemoveAll(bson.M{"useremail": s.user.Email, "name": "ci"})
+	var result apiToken
+	err = json.NewDecoder(recorder.Body).Decode(&result)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(result.Name, gocheck.Equals, "ci")
+	c.Assert(result.Scope, gocheck.Equals, auth.TokenScopeApp)
+	c.Assert(result.Apps, gocheck.DeepEquals, []string{"myapp"})
+	c.Assert(result.Expires.After(time.Now().Add(29*24*time.Hour)), gocheck.Equals, true)
+	t, err := auth.GetToken("bearer " + result.Token)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(t.UserEmail, gocheck.Equals, s.user.Email)
+	c.Assert(t.Name, gocheck.Equals, "ci")
+	action := testing.Action{
+		Action: "create-api-token",
+		User:   s.user.Email,
+		Extra:  []interface{}{"name=ci", "scope=app", "apps=myapp"},
+	}
+	c.Assert(action, testing.IsRecorded)
+}
+
+func (s *S) TestCreateAPITokenInvalidJSON(c *gocheck.C) {
+	request, err := http.NewRequest("POST", "/users/tokens", strings.NewReader("{"))
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = createAPIToken(recorder, request, s.token)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.HTTP)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusBadRequest)
+}
+
+func (s *S) TestCreateAPITokenInvalidScope(c *gocheck.C) {
+	body := strings.NewReader(`{"name":"ci","scope":"write","expires":30}`)
+	request, err := http.NewRequest("POST", "/users/tokens", body)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = createAPIToken(recorder, request, s.token)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.HTTP)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusBadRequest)
+	c.Assert(e.Message, gocheck.Equals, auth.ErrInvalidTokenScope.Error())
+}
+
+func (s *S) TestCreateAPITokenWithoutExpiration(c *gocheck.C) {
+	body := strings.NewReader(`{"name":"ci","scope":"deploy"}`)
+	request, err := http.NewRequest("POST", "/users/tokens", body)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = createAPIToken(recorder, request, s.token)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.HTTP)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusBadRequest)
+	c.Assert(e.Message, gocheck.Equals, auth.ErrTokenExpiresMissing.Error())
+}
+
+func (s *S) TestCreateAPITokenDuplicate(c *gocheck.C) {
+	_, err := s.user.CreateAPIToken("ci", auth.TokenScopeRead, nil, time.Hour)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Tokens().RemoveAll(bson.M{"useremail": s.user.Email, "name": "ci"})
+	body := strings.NewReader(`{"name":"ci","scope":"deploy","expires":30}`)
+	request, err := http.NewRequest("POST", "/users/tokens", body)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = createAPIToken(recorder, request, s.token)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.HTTP)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusConflict)
+}
+
+func (s *S) TestListAPITokens(c *gocheck.C) {
+	_, err := s.user.CreateAPIToken("ci", auth.TokenScopeDeploy, nil, time.Hour)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Tokens().RemoveAll(bson.M{"useremail": s.user.Email, "name": "ci"})
+	request, err := http.NewRequest("GET", "/users/tokens", nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = listAPITokens(recorder, request, s.token)
+	c.Assert(err, gocheck.IsNil)
+	var result []apiToken
+	err = json.NewDecoder(recorder.Body).Decode(&result)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(result, gocheck.HasLen, 1)
+	c.Assert(result[0].Name, gocheck.Equals, "ci")
+	c.Assert(result[0].Scope, gocheck.Equals, auth.TokenScopeDeploy)
+	c.Assert(result[0].Token, gocheck.Equals, "")
+	action := testing.Action{Action: "list-api-tokens", User: s.user.Email}
+	c.Assert(action, testing.IsRecorded)
+}
+
+func (s *S) TestListAPITokensEmpty(c *gocheck.C) {
+	request, err := http.NewRequest("GET", "/users/tokens", nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = listAPITokens(recorder, request, s.token)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(recorder.Code, gocheck.Equals, http.StatusNoContent)
+}
+
+func (s *S) TestRevokeAPIToken(c *gocheck.C) {
+	t, err := s.user.CreateAPIToken("ci", auth.TokenScopeDeploy, nil, time.Hour)
+	c.Assert(err, gocheck.IsNil)
+	request, err := http.NewRequest("DELETE", "/users/tokens/ci?:name=ci", nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = revokeAPIToken(recorder, request, s.token)
+	c.Assert(err, gocheck.IsNil)
+	_, err = auth.GetToken("bearer " + t.Token)
+	c.Assert(err, gocheck.NotNil)
+	action := testing.Action{Action: "revoke-api-token", User: s.user.Email, Extra: []interface{}{"name=ci"}}
+	c.Assert(action, testing.IsRecorded)
+}
+
+func (s *S) TestRevokeAPITokenNotFound(c *gocheck.C) {
+	request, err := http.NewRequest("DELETE", "/users/tokens/ci?:name=ci", nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = revokeAPIToken(recorder, request, s.token)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.HTTP)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusNotFound)
+}
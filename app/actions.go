@@ -23,6 +23,7 @@ import (
 	"launchpad.net/goamz/iam"
 	"strconv"
 	"strings"
+	"time"
 )
 
 var ErrAppAlreadyExists = errors.New("there is already an app with this name.")
@@ -131,19 +132,42 @@ var insertApp = action.Action{
 	MinParams: 1,
 }
 
+// iamRetry retries the calls to IAM that fail because of errors in the IAM
+// service.
+var iamRetry = action.RetryPolicy{
+	Attempts:   3,
+	Backoff:    time.Second,
+	MaxBackoff: 5 * time.Second,
+	Retryable: func(err error) bool {
+		e, ok := err.(*iam.Error)
+		return ok && e.StatusCode >= 500
+	},
+}
+
 // createIAMUserAction creates a user in IAM. It requires that the first
 // parameter is the a pointer to an App instance.
 var createIAMUserAction = action.Action{
 	Name: "create-iam-user",
 	Forward: func(ctx action.FWContext) (action.Result, error) {
 		app := ctx.Previous.(*App)
-		return createIAMUser(app.Name)
+		user, err := createIAMUser(app.Name)
+		if e, ok := err.(*iam.Error); ok && e.Code == "EntityAlreadyExists" && ctx.Attempt > 1 {
+			// The previous attempt created the user, but failed
+			// to report it.
+			resp, err := getIAMEndpoint().GetUser(app.Name)
+			if err != nil {
+				return nil, err
+			}
+			return &resp.User, nil
+		}
+		return user, err
 	},
 	Backward: func(ctx action.BWContext) {
 		user := ctx.FWResult.(*iam.User)
 		getIAMEndpoint().DeleteUser(user.Name)
 	},
 	MinParams: 1,
+	Retry:     iamRetry,
 }
 
 // createIAMAccessKeyAction creates an access key in IAM. It uses the result
@@ -159,6 +183,7 @@ var createIAMAccessKeyAction = action.Action{
 		getIAMEndpoint().DeleteAccessKey(key.Id, key.UserName)
 	},
 	MinParams: 1,
+	Retry:     iamRetry,
 }
 
 // createBucketAction creates a bucket in S3. It uses the result of
@@ -212,6 +237,7 @@ var createUserPolicyAction = action.Action{
 		getIAMEndpoint().DeleteUserPolicy(app.Name, policyName)
 	},
 	MinParams: 1,
+	Retry:     iamRetry,
 }
 
 // exportEnvironmentsAction exports tsuru's default environment variables in a
@@ -325,7 +351,7 @@ var provisionApp = action.Action{
 		default:
 			return nil, errors.New("First parameter must be App or *App.")
 		}
-		err := Provisioner.Provision(&app)
+		err := provision.CountError("provision", Provisioner.Provision(&app))
 		if err != nil {
 			return nil, err
 		}
@@ -410,7 +436,7 @@ var provisionAddUnits = action.Action{
 		n := uint(len(result.ids))
 		units, err := Provisioner.AddUnits(&app, n)
 		if err != nil {
-			return nil, err
+			return nil, provision.CountError("add-units", err)
 		}
 		result.units = units
 		return &result, nil
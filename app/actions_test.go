@@ -168,6 +168,25 @@ func (s *S) TestCreateIAMUserForward(c *gocheck.C) {
 	c.Assert(u.Name, gocheck.Equals, app.Name)
 }
 
+func (s *S) TestCreateIAMUserForwardRetryOfCreatedUser(c *gocheck.C) {
+	auth := aws.Auth{AccessKey: "access", SecretKey: "s3cr3t"}
+	region := aws.Region{IAMEndpoint: s.t.IamServer.URL()}
+	iamClient := iam.New(auth, region)
+	app := App{Name: "trapped"}
+	_, err := createIAMUser(app.Name)
+	c.Assert(err, gocheck.IsNil)
+	defer iamClient.DeleteUser(app.Name)
+	ctx := action.FWContext{Params: []interface{}{&app}, Previous: &app, Attempt: 1}
+	_, err = createIAMUserAction.Forward(ctx)
+	c.Assert(err, gocheck.NotNil)
+	ctx.Attempt = 2
+	result, err := createIAMUserAction.Forward(ctx)
+	c.Assert(err, gocheck.IsNil)
+	u, ok := result.(*iam.User)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(u.Name, gocheck.Equals, app.Name)
+}
+
 func (s *S) TestCreateIAMUserBackward(c *gocheck.C) {
 	auth := aws.Auth{AccessKey: "access", SecretKey: "s3cr3t"}
 	region := aws.Region{IAMEndpoint: s.t.IamServer.URL()}
@@ -1119,3 +1138,15 @@ func (s *S) TestSaveNewUnitsInDatabaseBackward(c *gocheck.C) {
 func (s *S) TestSaveNewUnitsMinParams(c *gocheck.C) {
 	c.Assert(saveNewUnitsInDatabase.MinParams, gocheck.Equals, 1)
 }
+
+func (s *S) TestIAMRetryRetryable(c *gocheck.C) {
+	c.Assert(iamRetry.Retryable(&iam.Error{StatusCode: 503}), gocheck.Equals, true)
+	c.Assert(iamRetry.Retryable(&iam.Error{StatusCode: 409}), gocheck.Equals, false)
+	c.Assert(iamRetry.Retryable(errors.New("connection refused")), gocheck.Equals, false)
+}
+
+func (s *S) TestIAMActionsRetry(c *gocheck.C) {
+	c.Assert(createIAMUserAction.Retry.Attempts, gocheck.Equals, 3)
+	c.Assert(createIAMAccessKeyAction.Retry.Attempts, gocheck.Equals, 3)
+	c.Assert(createUserPolicyAction.Retry.Attempts, gocheck.Equals, 3)
+}
@@ -53,7 +53,19 @@ type App struct {
 	Teams    []string
 	Owner    string
 	State    string
-	conf     *conf
+	// Memory is the memory limit of each unit of the app, in megabytes.
+	// Zero means no limit.
+	Memory int
+	// CpuShares is the relative CPU weight of each unit of the app. Zero
+	// means the provisioner default.
+	CpuShares int
+	// LogRetention overrides the global retention of the logs of the app.
+	LogRetention LogRetention
+	// Pool is the pool of nodes chosen on the creation of the app. When
+	// it's empty, the provisioner chooses the pool from the teams of the
+	// app.
+	Pool string `bson:",omitempty"`
+	conf *conf
 }
 
 // MarshalJSON marshals the app in json format. It returns a JSON object with
@@ -68,15 +80,28 @@ func (app *App) MarshalJSON() ([]byte, error) {
 	result["ip"] = app.Ip
 	result["cname"] = app.CName
 	result["ready"] = app.State == "ready"
+	result["memory"] = app.Memory
+	result["cpushares"] = app.CpuShares
 	return json.Marshal(&result)
 }
 
 // Applog represents a log entry.
 type Applog struct {
+	ID      bson.ObjectId `bson:"_id,omitempty" json:"-"`
 	Date    time.Time
 	Message string
 	Source  string
 	AppName string
+	Unit    string `bson:",omitempty" json:",omitempty"`
+}
+
+// After reports whether the log was written after the given log. Logs
+// written in the same millisecond are ordered by their ids.
+func (l *Applog) After(other *Applog) bool {
+	if !l.Date.Equal(other.Date) {
+		return l.Date.After(other.Date)
+	}
+	return l.ID > other.ID
 }
 
 type hooks struct {
@@ -85,7 +110,8 @@ type hooks struct {
 }
 
 type conf struct {
-	Hooks hooks
+	Hooks       hooks
+	HealthCheck provision.HealthCheck `yaml:"healthcheck"`
 }
 
 // Get queries the database and fills the App object with data retrieved from
@@ -113,16 +139,58 @@ func (app *App) Get() error {
 //       3. Create S3 bucket for the app (if the bucket support is enabled)
 //       4. Create the git repository using gandalf
 //       5. Provision units within the provisioner
-func CreateApp(app *App, user *auth.User) error {
-	teams, err := user.Teams()
+//
+// The given observers receive each step of the process.
+func CreateApp(app *App, user *auth.User, observers ...action.Observer) error {
+	actions, err := appCreationActions(app, user)
 	if err != nil {
 		return err
 	}
+	pipeline := action.NewPersistentPipeline(createAppPipeline, actions...)
+	for _, o := range observers {
+		pipeline.Observe(o)
+	}
+	err = pipeline.Execute(app, user)
+	if err != nil {
+		return &AppCreationError{app: app.Name, Err: err}
+	}
+	return nil
+}
+
+// CreateAppDryRun validates the creation of the app, without creating it. It
+// returns the names of the steps that CreateApp would run, in order.
+func CreateAppDryRun(app *App, user *auth.User) ([]string, error) {
+	actions, err := appCreationActions(app, user)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	n, err := conn.Apps().Find(bson.M{"name": app.Name}).Count()
+	if err != nil {
+		return nil, err
+	}
+	if n > 0 {
+		return nil, &AppCreationError{app: app.Name, Err: ErrAppAlreadyExists}
+	}
+	return action.NewPipeline(actions...).DryRun(app, user)
+}
+
+// appCreationActions validates the app and returns the actions that create
+// it.
+func appCreationActions(app *App, user *auth.User) ([]*action.Action, error) {
+	teams, err := user.Teams()
+	if err != nil {
+		return nil, err
+	}
 	if len(teams) == 0 {
-		return NoTeamsError{}
+		return nil, NoTeamsError{}
 	}
-	if _, err := getPlatform(app.Platform); err != nil {
-		return err
+	if _, err := GetPlatform(app.Platform); err != nil {
+		return nil, err
 	}
 	app.SetTeams(teams)
 	app.Owner = user.Email
@@ -130,7 +198,10 @@ func CreateApp(app *App, user *auth.User) error {
 		msg := "Invalid app name, your app should have at most 63 " +
 			"characters, containing only lower case letters, numbers or dashes, " +
 			"starting with a letter."
-		return &errors.ValidationError{Message: msg}
+		return nil, &errors.ValidationError{Message: msg}
+	}
+	if err := app.validatePool(); err != nil {
+		return nil, err
 	}
 	actions := []*action.Action{&reserveUserApp, &createAppQuota, &insertApp}
 	useS3, _ := config.GetBool("bucket-support")
@@ -141,12 +212,7 @@ func CreateApp(app *App, user *auth.User) error {
 	}
 	actions = append(actions, &exportEnvironmentsAction,
 		&createRepository, &provisionApp)
-	pipeline := action.NewPipeline(actions...)
-	err = pipeline.Execute(app, user)
-	if err != nil {
-		return &AppCreationError{app: app.Name, Err: err}
-	}
-	return nil
+	return actions, nil
 }
 
 // unbind takes all service instances that are bound to the app, and unbind
@@ -212,6 +278,9 @@ func ForceDestroy(app *App) error {
 	}
 	defer conn.Close()
 	quota.Delete(app.Name)
+	conn.LogDrains().RemoveAll(bson.M{"appname": app.Name})
+	drainURLs.invalidate(app.Name)
+	drains.closeApp(app.Name)
 	return conn.Apps().Remove(bson.M{"name": app.Name})
 }
 
@@ -269,7 +338,7 @@ func (app *App) RemoveUnit(id string) error {
 	if unit.GetName() == "" {
 		return stderr.New("Unit not found.")
 	}
-	if err := Provisioner.RemoveUnit(app, unit.GetName()); err != nil {
+	if err := provision.CountError("remove-unit", Provisioner.RemoveUnit(app, unit.GetName())); err != nil {
 		return err
 	}
 	app.removeUnits([]int{i})
@@ -339,7 +408,7 @@ func (app *App) RemoveUnits(n uint) error {
 	sort.Sort(units)
 	items := make([]string, int(n))
 	for i := 0; i < int(n); i++ {
-		err = Provisioner.RemoveUnit(app, units[i].GetName())
+		err = provision.CountError("remove-unit", Provisioner.RemoveUnit(app, units[i].GetName()))
 		if err == nil {
 			removed = append(removed, i)
 		}
@@ -532,6 +601,20 @@ func (app *App) loadConf() error {
 	return nil
 }
 
+// HealthCheck returns the health check defined in the healthcheck section of
+// app.yaml, or nil if the app does not define a health check. The file is read
+// from the running units of the app, so it reflects the code they run.
+func (app *App) HealthCheck() (*provision.HealthCheck, error) {
+	if err := app.loadConf(); err != nil {
+		return nil, err
+	}
+	if app.conf.HealthCheck.Path == "" {
+		return nil, nil
+	}
+	hc := app.conf.HealthCheck
+	return &hc, nil
+}
+
 // preRestart is responsible for running user's pre-restart script.
 //
 // The path to this script can be found at the app.conf file, at the root of user's app repository.
@@ -602,7 +685,7 @@ func (app *App) sourced(cmd string, w io.Writer) error {
 }
 
 func (app *App) run(cmd string, w io.Writer) error {
-	return Provisioner.ExecuteCommand(w, w, app, cmd)
+	return provision.CountError("execute-command", Provisioner.ExecuteCommand(w, w, app, cmd))
 }
 
 // Restart runs the restart hook for the app, writing its output to w.
@@ -616,7 +699,7 @@ func (app *App) Restart(w io.Writer) error {
 	if err != nil {
 		return err
 	}
-	err = Provisioner.Restart(app)
+	err = provision.CountError("restart", Provisioner.Restart(app))
 	if err != nil {
 		return err
 	}
@@ -658,6 +741,14 @@ func (app *App) GetPlatform() string {
 	return app.Platform
 }
 
+func (app *App) GetMemory() int {
+	return app.Memory
+}
+
+func (app *App) GetCpuShares() int {
+	return app.CpuShares
+}
+
 // ProvisionedUnits returns the internal list of units converted to
 // provision.AppUnit.
 func (app *App) ProvisionedUnits() []provision.AppUnit {
@@ -799,6 +890,26 @@ func (app *App) SetCName(cname string) error {
 	)
 }
 
+// SetResources defines the memory limit (in megabytes) and the CPU shares of
+// the units of the app, saving them in the database. The provisioner applies
+// the new values in the next restart of the app.
+func (app *App) SetResources(memory, cpuShares int) error {
+	if memory < 0 || cpuShares < 0 {
+		return ErrInvalidResources
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	app.Memory = memory
+	app.CpuShares = cpuShares
+	return conn.Apps().Update(
+		bson.M{"name": app.Name},
+		bson.M{"$set": bson.M{"memory": app.Memory, "cpushares": app.CpuShares}},
+	)
+}
+
 func (app *App) UnsetCName() error {
 	if s, ok := Provisioner.(provision.CNameManager); ok {
 		if err := s.UnsetCName(app, app.CName); err != nil {
@@ -820,34 +931,49 @@ func (app *App) UnsetCName() error {
 // Log adds a log message to the app. Specifying a good source is good so the
 // user can filter where the message come from.
 func (app *App) Log(message, source string) error {
+	return app.UnitLog(message, source, "")
+}
+
+// UnitLog stores the log of the given unit of the app, sending it to the
+// listeners and to the drains of the app logs.
+func (app *App) UnitLog(message, source, unit string) error {
 	messages := strings.Split(message, "\n")
+	entries := make([]Applog, 0, len(messages))
 	logs := make([]interface{}, 0, len(messages))
 	for _, msg := range messages {
 		if msg != "" {
 			l := Applog{
+				ID:      bson.NewObjectId(),
 				Date:    time.Now().In(time.UTC),
 				Message: msg,
 				Source:  source,
 				AppName: app.Name,
+				Unit:    unit,
 			}
+			entries = append(entries, l)
 			logs = append(logs, l)
 		}
 	}
 	if len(logs) > 0 {
-		go notify(app.Name, logs)
 		conn, err := db.Conn()
 		if err != nil {
 			return err
 		}
 		defer conn.Close()
-		return conn.Logs().Insert(logs...)
+		if err := conn.Logs().Insert(logs...); err != nil {
+			return err
+		}
+		if err := conn.LogStream().Insert(logs...); err != nil {
+			return err
+		}
+		forwardLogs(conn, app.Name, entries)
 	}
 	return nil
 }
 
 // LastLogs returns a list of the last `lines` log of the app, matching the
-// given source.
-func (app *App) LastLogs(lines int, source string) ([]Applog, error) {
+// given filter.
+func (app *App) LastLogs(lines int, filter LogFilter) ([]Applog, error) {
 	conn, err := db.Conn()
 	if err != nil {
 		return nil, err
@@ -855,10 +981,13 @@ func (app *App) LastLogs(lines int, source string) ([]Applog, error) {
 	defer conn.Close()
 	var logs []Applog
 	q := bson.M{"appname": app.Name}
-	if source != "" {
-		q["source"] = source
+	if filter.Source != "" {
+		q["source"] = filter.Source
 	}
-	err = conn.Logs().Find(q).Sort("-date").Limit(lines).All(&logs)
+	if filter.Unit != "" {
+		q["unit"] = filter.Unit
+	}
+	err = conn.Logs().Find(q).Sort("-date", "-_id").Limit(lines).All(&logs)
 	if err != nil {
 		return nil, err
 	}
@@ -869,7 +998,8 @@ func (app *App) LastLogs(lines int, source string) ([]Applog, error) {
 	return logs, nil
 }
 
-// List returns the list of apps that the given user has access to.
+// List returns the list of apps that the given user has access to, either
+// as a member of the teams of the app or through roles.
 //
 // If the user does not have acces to any app, this function returns an empty
 // list and a nil error.
@@ -880,7 +1010,8 @@ func List(u *auth.User) ([]App, error) {
 		return nil, err
 	}
 	defer conn.Close()
-	if u.IsAdmin() {
+	all, roleTeams, roleApps := u.AppScopes()
+	if all || u.IsAdmin() {
 		if err := conn.Apps().Find(nil).All(&apps); err != nil {
 			return []App{}, err
 		}
@@ -890,8 +1021,12 @@ func List(u *auth.User) ([]App, error) {
 	if err != nil {
 		return []App{}, err
 	}
-	teams := auth.GetTeamsNames(ts)
-	if err := conn.Apps().Find(bson.M{"teams": bson.M{"$in": teams}}).All(&apps); err != nil {
+	teams := append(auth.GetTeamsNames(ts), roleTeams...)
+	query := bson.M{"teams": bson.M{"$in": teams}}
+	if len(roleApps) > 0 {
+		query = bson.M{"$or": []bson.M{query, {"name": bson.M{"$in": roleApps}}}}
+	}
+	if err := conn.Apps().Find(query).All(&apps); err != nil {
 		return []App{}, err
 	}
 	return apps, nil
@@ -899,5 +1034,5 @@ func List(u *auth.User) ([]App, error) {
 
 // Swap calls the Provisioner.Swap.
 func Swap(app1, app2 *App) error {
-	return Provisioner.Swap(app1, app2)
+	return provision.CountError("swap", Provisioner.Swap(app1, app2))
 }
@@ -228,6 +228,40 @@ func (s *S) TestCreateApp(c *gocheck.C) {
 	c.Assert(err, gocheck.IsNil)
 }
 
+func (s *S) TestCreateAppDryRun(c *gocheck.C) {
+	a := App{Name: "appname", Platform: "python"}
+	steps, err := CreateAppDryRun(&a, s.user)
+	c.Assert(err, gocheck.IsNil)
+	expected := []string{reserveUserApp.Name, createAppQuota.Name, insertApp.Name}
+	if useS3, _ := config.GetBool("bucket-support"); useS3 {
+		expected = append(expected, createIAMUserAction.Name, createIAMAccessKeyAction.Name,
+			createBucketAction.Name, createUserPolicyAction.Name)
+	}
+	expected = append(expected, exportEnvironmentsAction.Name, createRepository.Name, provisionApp.Name)
+	c.Assert(steps, gocheck.DeepEquals, expected)
+	n, err := s.conn.Apps().Find(bson.M{"name": a.Name}).Count()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(n, gocheck.Equals, 0)
+}
+
+func (s *S) TestCreateAppDryRunAppAlreadyExists(c *gocheck.C) {
+	a := App{Name: "appname", Platform: "python"}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	_, err = CreateAppDryRun(&a, s.user)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*AppCreationError)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Err, gocheck.Equals, ErrAppAlreadyExists)
+}
+
+func (s *S) TestCreateAppDryRunInvalidName(c *gocheck.C) {
+	a := App{Name: "1nvalid", Platform: "python"}
+	_, err := CreateAppDryRun(&a, s.user)
+	c.Assert(err, gocheck.FitsTypeOf, &errors.ValidationError{})
+}
+
 func (s *S) TestCreateAppUserQuotaExceeded(c *gocheck.C) {
 	app := App{Name: "america", Platform: "python"}
 	err := quota.Create(s.user.Email, 1)
@@ -1252,6 +1286,31 @@ func (s *S) TestSetCName(c *gocheck.C) {
 	c.Assert(a.CName, gocheck.Equals, "ktulu.mycompany.com")
 }
 
+func (s *S) TestSetResources(c *gocheck.C) {
+	a := App{Name: "ktulu", Platform: "python"}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	err = a.SetResources(512, 256)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(a.GetMemory(), gocheck.Equals, 512)
+	c.Assert(a.GetCpuShares(), gocheck.Equals, 256)
+	other := App{Name: a.Name}
+	err = other.Get()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(other.Memory, gocheck.Equals, 512)
+	c.Assert(other.CpuShares, gocheck.Equals, 256)
+	c.Assert(other.Platform, gocheck.Equals, "python")
+}
+
+func (s *S) TestSetResourcesNegativeValues(c *gocheck.C) {
+	a := App{Name: "ktulu"}
+	err := a.SetResources(-1, 256)
+	c.Assert(err, gocheck.Equals, ErrInvalidResources)
+	err = a.SetResources(512, -1)
+	c.Assert(err, gocheck.Equals, ErrInvalidResources)
+}
+
 func (s *S) TestSetCNamePartialUpdate(c *gocheck.C) {
 	a := App{Name: "master", Platform: "puppet"}
 	err := s.conn.Apps().Insert(a)
@@ -1429,6 +1488,44 @@ func (s *S) TestLoadConfWithError(c *gocheck.C) {
 	c.Assert(a.conf.Hooks.PostRestart, gocheck.IsNil)
 }
 
+func (s *S) TestLoadConfWithHealthCheck(c *gocheck.C) {
+	output := `healthcheck:
+  path: /healthcheck
+  status: 204
+  timeout: 30
+`
+	s.provisioner.PrepareOutput([]byte(output))
+	a := App{
+		Name:     "something",
+		Platform: "django",
+		Units:    []Unit{{Name: "i-0800", State: "started"}},
+	}
+	err := a.loadConf()
+	c.Assert(err, gocheck.IsNil)
+	expected := provision.HealthCheck{Path: "/healthcheck", Status: 204, Timeout: 30}
+	c.Assert(a.conf.HealthCheck, gocheck.DeepEquals, expected)
+}
+
+func (s *S) TestHealthCheck(c *gocheck.C) {
+	a := App{
+		Name:     "something",
+		Platform: "django",
+		conf: &conf{
+			HealthCheck: provision.HealthCheck{Path: "/healthcheck"},
+		},
+	}
+	hc, err := a.HealthCheck()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(hc, gocheck.DeepEquals, &provision.HealthCheck{Path: "/healthcheck"})
+}
+
+func (s *S) TestHealthCheckUndefined(c *gocheck.C) {
+	a := App{Name: "something", Platform: "django", conf: &conf{}}
+	hc, err := a.HealthCheck()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(hc, gocheck.IsNil)
+}
+
 func (s *S) TestPreRestart(c *gocheck.C) {
 	s.provisioner.PrepareOutput([]byte("pre-restarted"))
 	a := App{
@@ -1686,7 +1783,7 @@ func (s *S) TestLogWithListeners(c *gocheck.C) {
 	err := s.conn.Apps().Insert(a)
 	c.Assert(err, gocheck.IsNil)
 	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
-	l := NewLogListener(&a)
+	l := NewLogListener(&a, LogFilter{})
 	defer l.Close()
 	go func() {
 		for log := range l.C {
@@ -1743,7 +1840,7 @@ func (s *S) TestLastLogs(c *gocheck.C) {
 		time.Sleep(1e6) // let the time flow
 	}
 	app.Log("app3 log from circus", "circus")
-	logs, err := app.LastLogs(10, "tsuru")
+	logs, err := app.LastLogs(10, LogFilter{Source: "tsuru"})
 	c.Assert(err, gocheck.IsNil)
 	c.Assert(logs, gocheck.HasLen, 10)
 	for i := 5; i < 15; i++ {
@@ -1752,6 +1849,37 @@ func (s *S) TestLastLogs(c *gocheck.C) {
 	}
 }
 
+func (s *S) TestLastLogsFilteredByUnit(c *gocheck.C) {
+	app := App{Name: "app4", Platform: "vougan", Teams: []string{s.team.Name}}
+	err := s.conn.Apps().Insert(app)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": app.Name})
+	defer s.conn.Logs().RemoveAll(bson.M{"appname": app.Name})
+	err = app.UnitLog("log from unit 1", "app", "app4/1")
+	c.Assert(err, gocheck.IsNil)
+	err = app.UnitLog("log from unit 2", "app", "app4/2")
+	c.Assert(err, gocheck.IsNil)
+	logs, err := app.LastLogs(10, LogFilter{Unit: "app4/2"})
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(logs, gocheck.HasLen, 1)
+	c.Assert(logs[0].Message, gocheck.Equals, "log from unit 2")
+	c.Assert(logs[0].Unit, gocheck.Equals, "app4/2")
+}
+
+func (s *S) TestUnitLogWritesToTheLogStream(c *gocheck.C) {
+	app := App{Name: "app5"}
+	defer s.conn.Logs().RemoveAll(bson.M{"appname": app.Name})
+	err := app.UnitLog("first\nsecond", "app", "app5/0")
+	c.Assert(err, gocheck.IsNil)
+	var logs []Applog
+	err = s.conn.LogStream().Find(bson.M{"appname": app.Name}).All(&logs)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(logs, gocheck.HasLen, 2)
+	c.Assert(logs[0].Message, gocheck.Equals, "first")
+	c.Assert(logs[1].Message, gocheck.Equals, "second")
+	c.Assert(logs[1].Unit, gocheck.Equals, "app5/0")
+}
+
 func (s *S) TestGetTeams(c *gocheck.C) {
 	app := App{Name: "app", Teams: []string{s.team.Name}}
 	teams := app.GetTeams()
@@ -1794,6 +1922,8 @@ func (s *S) TestAppMarshalJSON(c *gocheck.C) {
 	expected["ip"] = "10.10.10.1"
 	expected["cname"] = "name.mycompany.com"
 	expected["ready"] = false
+	expected["memory"] = float64(0)
+	expected["cpushares"] = float64(0)
 	data, err := app.MarshalJSON()
 	c.Assert(err, gocheck.IsNil)
 	result := make(map[string]interface{})
@@ -1820,6 +1950,8 @@ func (s *S) TestAppMarshalJSONReady(c *gocheck.C) {
 	expected["ip"] = "10.10.10.1"
 	expected["cname"] = "name.mycompany.com"
 	expected["ready"] = true
+	expected["memory"] = float64(0)
+	expected["cpushares"] = float64(0)
 	data, err := app.MarshalJSON()
 	c.Assert(err, gocheck.IsNil)
 	result := make(map[string]interface{})
@@ -1961,6 +2093,38 @@ func (s *S) TestListReturnsAllAppsWhenUserIsInAdminTeam(c *gocheck.C) {
 	c.Assert(apps[0].Teams, gocheck.DeepEquals, []string{"notAdmin", "noSuperUser"})
 }
 
+func (s *S) TestListReturnsAppsGrantedThroughRoles(c *gocheck.C) {
+	apps := []App{
+		{Name: "teamapp", Teams: []string{"otherteam"}},
+		{Name: "singleapp", Teams: []string{"anotherteam"}},
+		{Name: "hiddenapp", Teams: []string{"anotherteam"}},
+	}
+	for _, a := range apps {
+		err := s.conn.Apps().Insert(a)
+		c.Assert(err, gocheck.IsNil)
+		defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	}
+	u := auth.User{
+		Email: "viewer@tsuru.io",
+		Roles: []auth.RoleAssignment{
+			{Name: "app-deployer", Scope: auth.ScopeTeam, Value: "otherteam"},
+			{Name: "app-viewer", Scope: auth.ScopeApp, Value: "singleapp"},
+		},
+	}
+	got, err := List(&u)
+	c.Assert(err, gocheck.IsNil)
+	names := make([]string, len(got))
+	for i, a := range got {
+		names[i] = a.Name
+	}
+	sort.Strings(names)
+	c.Assert(names, gocheck.DeepEquals, []string{"singleapp", "teamapp"})
+	u.Roles = []auth.RoleAssignment{{Name: "app-viewer", Scope: auth.ScopeGlobal}}
+	got, err = List(&u)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(got, gocheck.HasLen, 3)
+}
+
 func (s *S) TestGetName(c *gocheck.C) {
 	a := App{Name: "something"}
 	c.Assert(a.GetName(), gocheck.Equals, a.Name)
@@ -0,0 +1,225 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"fmt"
+	"github.com/globocom/tsuru/db"
+	"github.com/globocom/tsuru/metrics"
+	"github.com/globocom/tsuru/provision"
+	"io"
+	"labix.org/v2/mgo/bson"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// maxDeployLogSize is the maximum size, in bytes, of the log stored with a
+// deploy. Only the end of longer logs is stored, keeping the deploy document
+// well below the size limit of MongoDB documents.
+const maxDeployLogSize = 1 << 20
+
+const (
+	DeploySuccess = "success"
+	DeployFailure = "failure"
+)
+
+var (
+	deploysCounter = metrics.NewCounter(
+		"tsuru_deploys_total",
+		"Number of deploys and rollbacks, by status.",
+		"status",
+	)
+	deployDuration = metrics.NewHistogram(
+		"tsuru_deploy_duration_seconds",
+		"Duration of deploys and rollbacks, by status.",
+		[]float64{5, 15, 30, 60, 120, 300, 600, 1200},
+		"status",
+	)
+)
+
+// Deploy represents a deploy of an app. It's stored in the deploy history of
+// the app, and holds the version deployed, the image built for it (when the
+// provisioner builds images), who triggered it, its duration, status and the
+// log written during the deploy.
+type Deploy struct {
+	ID       bson.ObjectId `bson:"_id,omitempty"`
+	App      string
+	Version  string
+	Image    string
+	User     string
+	Start    time.Time
+	End      time.Time
+	Duration time.Duration
+	Status   string
+	Log      string `json:",omitempty"`
+}
+
+// Deploy deploys the given version of the app, storing the deploy in the
+// history of the app. The user parameter identifies who triggered the deploy.
+func (app *App) Deploy(version, user string, w io.Writer) error {
+	return app.deploy(version, user, w, func(w io.Writer) (string, error) {
+		if r, ok := Provisioner.(provision.Rollbacker); ok {
+			image, err := r.ImageDeploy(app, version, w)
+			return image, provision.CountError("deploy", err)
+		}
+		return "", provision.CountError("deploy", Provisioner.Deploy(app, version, w))
+	})
+}
+
+// Rollback deploys again the image built for a previous version of the app.
+// The version may be abbreviated, in that case the most recent deploy
+// matching it will be used.
+//
+// It returns an error if the provisioner is not able to rollback apps, or if
+// the version is not in the deploy history of the app.
+func (app *App) Rollback(version, user string, w io.Writer) error {
+	r, ok := Provisioner.(provision.Rollbacker)
+	if !ok {
+		return ErrRollbackNotSupported
+	}
+	d, err := app.findDeploy(version)
+	if err != nil {
+		return err
+	}
+	return app.deploy(d.Version, user, w, func(w io.Writer) (string, error) {
+		fmt.Fprintf(w, "\n ---> Rolling back to version %s\n", d.Version)
+		return d.Image, provision.CountError("rollback", r.Rollback(app, d.Image, w))
+	})
+}
+
+// Deploys returns the deploy history of the app, most recent deploys first.
+// The log of the deploys is not included, use GetDeploy to get it.
+func (app *App) Deploys() ([]Deploy, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	var deploys []Deploy
+	err = conn.Deploys().Find(bson.M{"app": app.Name}).Select(bson.M{"log": 0}).Sort("-start").All(&deploys)
+	if err != nil {
+		return nil, err
+	}
+	return deploys, nil
+}
+
+// GetDeploy returns the deploy identified by the given id, including its log.
+func GetDeploy(id string) (*Deploy, error) {
+	if !bson.IsObjectIdHex(id) {
+		return nil, ErrDeployNotFound
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	var d Deploy
+	err = conn.Deploys().FindId(bson.ObjectIdHex(id)).One(&d)
+	if err != nil {
+		return nil, ErrDeployNotFound
+	}
+	return &d, nil
+}
+
+// deploy calls the given function, storing the deploy in the history of the
+// app, along with its status, duration and the log written by the function.
+//
+// The function receives the writer where it should log the progress of the
+// deploy, and returns the image deployed, if any.
+func (app *App) deploy(version, user string, w io.Writer, fn func(io.Writer) (string, error)) error {
+	var buf deployLog
+	d := Deploy{
+		App:     app.Name,
+		Version: version,
+		User:    user,
+		Start:   time.Now().In(time.UTC),
+	}
+	image, err := fn(io.MultiWriter(w, &buf))
+	d.End = time.Now().In(time.UTC)
+	d.Duration = d.End.Sub(d.Start)
+	d.Image = image
+	d.Log = buf.String()
+	d.Status = DeploySuccess
+	if err != nil {
+		d.Status = DeployFailure
+	}
+	deploysCounter.Inc(d.Status)
+	deployDuration.Observe(d.Duration.Seconds(), d.Status)
+	if saveErr := d.save(); err == nil {
+		err = saveErr
+	}
+	return err
+}
+
+// findDeploy returns the most recent successful deploy of the app whose
+// version starts with the given version, skipping deploys that have no image.
+func (app *App) findDeploy(version string) (*Deploy, error) {
+	if version == "" {
+		return nil, &DeployNotFoundError{Version: version}
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	var d Deploy
+	q := bson.M{
+		"app":     app.Name,
+		"version": bson.RegEx{Pattern: "^" + regexp.QuoteMeta(version)},
+		"image":   bson.M{"$ne": ""},
+		"status":  DeploySuccess,
+	}
+	err = conn.Deploys().Find(q).Sort("-start").One(&d)
+	if err != nil {
+		return nil, &DeployNotFoundError{Version: version}
+	}
+	return &d, nil
+}
+
+func (d *Deploy) save() error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return conn.Deploys().Insert(d)
+}
+
+// deployLog is a writer that keeps the last maxDeployLogSize bytes written to
+// it.
+type deployLog struct {
+	mut       sync.Mutex
+	buf       []byte
+	truncated bool
+}
+
+func (l *deployLog) Write(p []byte) (int, error) {
+	l.mut.Lock()
+	defer l.mut.Unlock()
+	l.buf = append(l.buf, p...)
+	if len(l.buf) > 2*maxDeployLogSize {
+		l.trim()
+	}
+	return len(p), nil
+}
+
+func (l *deployLog) trim() {
+	if len(l.buf) > maxDeployLogSize {
+		l.buf = append([]byte(nil), l.buf[len(l.buf)-maxDeployLogSize:]...)
+		l.truncated = true
+	}
+}
+
+// String returns the log, noting whether its beginning was discarded.
+func (l *deployLog) String() string {
+	l.mut.Lock()
+	defer l.mut.Unlock()
+	l.trim()
+	if l.truncated {
+		return fmt.Sprintf("[log truncated, showing the last %d bytes]\n", maxDeployLogSize) + string(l.buf)
+	}
+	return string(l.buf)
+}
@@ -0,0 +1,234 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/globocom/tsuru/metrics"
+	"labix.org/v2/mgo/bson"
+	"launchpad.net/gocheck"
+	"strconv"
+	"strings"
+)
+
+func (s *S) TestDeploy(c *gocheck.C) {
+	a := App{Name: "otherapp", Platform: "python"}
+	s.provisioner.Provision(&a)
+	defer s.provisioner.Destroy(&a)
+	defer s.conn.Deploys().RemoveAll(bson.M{"app": a.Name})
+	var buf bytes.Buffer
+	err := a.Deploy("a345f3e", "someone@tsuru.io", &buf)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(buf.String(), gocheck.Equals, "Deploy called")
+	c.Assert(s.provisioner.Version(&a), gocheck.Equals, "a345f3e")
+	var d Deploy
+	err = s.conn.Deploys().Find(bson.M{"app": a.Name}).One(&d)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(d.Version, gocheck.Equals, "a345f3e")
+	c.Assert(d.Image, gocheck.Equals, "tsuru/otherapp:a345f3e")
+	c.Assert(d.User, gocheck.Equals, "someone@tsuru.io")
+	c.Assert(d.Status, gocheck.Equals, DeploySuccess)
+	c.Assert(d.Log, gocheck.Equals, "Deploy called")
+	c.Assert(d.Start.IsZero(), gocheck.Equals, false)
+	c.Assert(d.End.Before(d.Start), gocheck.Equals, false)
+	c.Assert(d.Duration, gocheck.Equals, d.End.Sub(d.Start))
+}
+
+func (s *S) TestDeployFailureIsStored(c *gocheck.C) {
+	a := App{Name: "otherapp", Platform: "python"}
+	s.provisioner.Provision(&a)
+	defer s.provisioner.Destroy(&a)
+	defer s.conn.Deploys().RemoveAll(bson.M{"app": a.Name})
+	s.provisioner.PrepareFailure("Deploy", errors.New("deploy failed"))
+	var buf bytes.Buffer
+	err := a.Deploy("a345f3e", "someone@tsuru.io", &buf)
+	c.Assert(err, gocheck.ErrorMatches, "deploy failed")
+	var d Deploy
+	err = s.conn.Deploys().Find(bson.M{"app": a.Name}).One(&d)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(d.Version, gocheck.Equals, "a345f3e")
+	c.Assert(d.Image, gocheck.Equals, "")
+	c.Assert(d.Status, gocheck.Equals, DeployFailure)
+}
+
+func (s *S) TestDeploys(c *gocheck.C) {
+	a := App{Name: "otherapp", Platform: "python"}
+	s.provisioner.Provision(&a)
+	defer s.provisioner.Destroy(&a)
+	defer s.conn.Deploys().RemoveAll(bson.M{"app": a.Name})
+	var buf bytes.Buffer
+	err := a.Deploy("a345f3e", "someone@tsuru.io", &buf)
+	c.Assert(err, gocheck.IsNil)
+	err = a.Deploy("b567f3e", "other@tsuru.io", &buf)
+	c.Assert(err, gocheck.IsNil)
+	deploys, err := a.Deploys()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(deploys, gocheck.HasLen, 2)
+	c.Assert(deploys[0].Version, gocheck.Equals, "b567f3e")
+	c.Assert(deploys[0].User, gocheck.Equals, "other@tsuru.io")
+	c.Assert(deploys[0].Log, gocheck.Equals, "")
+	c.Assert(deploys[1].Version, gocheck.Equals, "a345f3e")
+}
+
+func (s *S) TestDeploysEmpty(c *gocheck.C) {
+	a := App{Name: "otherapp", Platform: "python"}
+	deploys, err := a.Deploys()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(deploys, gocheck.HasLen, 0)
+}
+
+func (s *S) TestGetDeploy(c *gocheck.C) {
+	a := App{Name: "otherapp", Platform: "python"}
+	s.provisioner.Provision(&a)
+	defer s.provisioner.Destroy(&a)
+	defer s.conn.Deploys().RemoveAll(bson.M{"app": a.Name})
+	var buf bytes.Buffer
+	err := a.Deploy("a345f3e", "someone@tsuru.io", &buf)
+	c.Assert(err, gocheck.IsNil)
+	var stored Deploy
+	err = s.conn.Deploys().Find(bson.M{"app": a.Name}).One(&stored)
+	c.Assert(err, gocheck.IsNil)
+	d, err := GetDeploy(stored.ID.Hex())
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(d.App, gocheck.Equals, a.Name)
+	c.Assert(d.Version, gocheck.Equals, "a345f3e")
+	c.Assert(d.Log, gocheck.Equals, "Deploy called")
+}
+
+func (s *S) TestGetDeployNotFound(c *gocheck.C) {
+	d, err := GetDeploy(bson.NewObjectId().Hex())
+	c.Assert(d, gocheck.IsNil)
+	c.Assert(err, gocheck.Equals, ErrDeployNotFound)
+}
+
+func (s *S) TestGetDeployInvalidId(c *gocheck.C) {
+	d, err := GetDeploy("not-an-id")
+	c.Assert(d, gocheck.IsNil)
+	c.Assert(err, gocheck.Equals, ErrDeployNotFound)
+}
+
+func (s *S) TestRollbackSkipsFailedDeploys(c *gocheck.C) {
+	a := App{Name: "otherapp", Platform: "python"}
+	s.provisioner.Provision(&a)
+	defer s.provisioner.Destroy(&a)
+	defer s.conn.Deploys().RemoveAll(bson.M{"app": a.Name})
+	s.provisioner.PrepareFailure("Deploy", errors.New("deploy failed"))
+	var buf bytes.Buffer
+	err := a.Deploy("a345f3e", "someone@tsuru.io", &buf)
+	c.Assert(err, gocheck.NotNil)
+	err = a.Rollback("a345f3e", "someone@tsuru.io", &buf)
+	c.Assert(err, gocheck.FitsTypeOf, &DeployNotFoundError{})
+}
+
+func (s *S) TestRollback(c *gocheck.C) {
+	a := App{Name: "otherapp", Platform: "python"}
+	s.provisioner.Provision(&a)
+	defer s.provisioner.Destroy(&a)
+	defer s.conn.Deploys().RemoveAll(bson.M{"app": a.Name})
+	var buf bytes.Buffer
+	err := a.Deploy("a345f3e", "someone@tsuru.io", &buf)
+	c.Assert(err, gocheck.IsNil)
+	err = a.Deploy("b567f3e", "someone@tsuru.io", &buf)
+	c.Assert(err, gocheck.IsNil)
+	buf.Reset()
+	err = a.Rollback("a345", "other@tsuru.io", &buf)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(buf.String(), gocheck.Equals, "\n ---> Rolling back to version a345f3e\nRollback called")
+	c.Assert(s.provisioner.Image(&a), gocheck.Equals, "tsuru/otherapp:a345f3e")
+	var deploys []Deploy
+	err = s.conn.Deploys().Find(bson.M{"app": a.Name}).Sort("start").All(&deploys)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(deploys, gocheck.HasLen, 3)
+	c.Assert(deploys[2].Version, gocheck.Equals, "a345f3e")
+	c.Assert(deploys[2].Image, gocheck.Equals, "tsuru/otherapp:a345f3e")
+	c.Assert(deploys[2].User, gocheck.Equals, "other@tsuru.io")
+	c.Assert(deploys[2].Log, gocheck.Equals, "\n ---> Rolling back to version a345f3e\nRollback called")
+}
+
+func (s *S) TestRollbackUnknownVersion(c *gocheck.C) {
+	a := App{Name: "otherapp", Platform: "python"}
+	s.provisioner.Provision(&a)
+	defer s.provisioner.Destroy(&a)
+	var buf bytes.Buffer
+	err := a.Rollback("a345f3e", "someone@tsuru.io", &buf)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*DeployNotFoundError)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Version, gocheck.Equals, "a345f3e")
+}
+
+func (s *S) TestRollbackProvisionerFailure(c *gocheck.C) {
+	a := App{Name: "otherapp", Platform: "python"}
+	s.provisioner.Provision(&a)
+	defer s.provisioner.Destroy(&a)
+	defer s.conn.Deploys().RemoveAll(bson.M{"app": a.Name})
+	var buf bytes.Buffer
+	err := a.Deploy("a345f3e", "someone@tsuru.io", &buf)
+	c.Assert(err, gocheck.IsNil)
+	s.provisioner.PrepareFailure("Rollback", errors.New("rollback failed"))
+	err = a.Rollback("a345f3e", "someone@tsuru.io", &buf)
+	c.Assert(err, gocheck.ErrorMatches, "rollback failed")
+	n, err := s.conn.Deploys().Find(bson.M{"app": a.Name, "status": DeployFailure}).Count()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(n, gocheck.Equals, 1)
+}
+
+func (s *S) TestDeployLogKeepsTheWholeShortLog(c *gocheck.C) {
+	var l deployLog
+	l.Write([]byte("building\n"))
+	l.Write([]byte("done\n"))
+	c.Assert(l.String(), gocheck.Equals, "building\ndone\n")
+}
+
+func (s *S) TestDeployLogKeepsTheEndOfLongLogs(c *gocheck.C) {
+	var l deployLog
+	chunk := bytes.Repeat([]byte("a"), maxDeployLogSize/2)
+	for i := 0; i < 5; i++ {
+		l.Write(chunk)
+	}
+	l.Write([]byte("done"))
+	log := l.String()
+	header := fmt.Sprintf("[log truncated, showing the last %d bytes]\n", maxDeployLogSize)
+	c.Assert(strings.HasPrefix(log, header), gocheck.Equals, true)
+	c.Assert(len(log), gocheck.Equals, len(header)+maxDeployLogSize)
+	c.Assert(strings.HasSuffix(log, "aaaadone"), gocheck.Equals, true)
+}
+
+func sampleValue(c *gocheck.C, sample string) float64 {
+	var buf bytes.Buffer
+	err := metrics.Write(&buf)
+	c.Assert(err, gocheck.IsNil)
+	for _, line := range strings.Split(buf.String(), "\n") {
+		if strings.HasPrefix(line, sample+" ") {
+			value, err := strconv.ParseFloat(line[len(sample)+1:], 64)
+			c.Assert(err, gocheck.IsNil)
+			return value
+		}
+	}
+	return 0
+}
+
+func (s *S) TestDeployMetrics(c *gocheck.C) {
+	a := App{Name: "otherapp", Platform: "python"}
+	s.provisioner.Provision(&a)
+	defer s.provisioner.Destroy(&a)
+	defer s.conn.Deploys().RemoveAll(bson.M{"app": a.Name})
+	successes := sampleValue(c, `tsuru_deploys_total{status="success"}`)
+	failures := sampleValue(c, `tsuru_deploys_total{status="failure"}`)
+	durations := sampleValue(c, `tsuru_deploy_duration_seconds_count{status="failure"}`)
+	provErrors := sampleValue(c, `tsuru_provisioner_errors_total{operation="deploy"}`)
+	var buf bytes.Buffer
+	err := a.Deploy("a345f3e", "someone@tsuru.io", &buf)
+	c.Assert(err, gocheck.IsNil)
+	s.provisioner.PrepareFailure("Deploy", errors.New("deploy failed"))
+	err = a.Deploy("b345f3e", "someone@tsuru.io", &buf)
+	c.Assert(err, gocheck.NotNil)
+	c.Assert(sampleValue(c, `tsuru_deploys_total{status="success"}`), gocheck.Equals, successes+1)
+	c.Assert(sampleValue(c, `tsuru_deploys_total{status="failure"}`), gocheck.Equals, failures+1)
+	c.Assert(sampleValue(c, `tsuru_deploy_duration_seconds_count{status="failure"}`), gocheck.Equals, durations+1)
+	c.Assert(sampleValue(c, `tsuru_provisioner_errors_total{operation="deploy"}`), gocheck.Equals, provErrors+1)
+}
@@ -0,0 +1,482 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/globocom/config"
+	"github.com/globocom/tsuru/db"
+	"github.com/globocom/tsuru/log"
+	"labix.org/v2/mgo"
+	"labix.org/v2/mgo/bson"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+var (
+	ErrInvalidDrainURL    = errors.New("Invalid drain URL: the scheme must be syslog, syslog+tcp, syslog+udp, http or https.")
+	ErrDrainAlreadyExists = errors.New("The app already has this drain.")
+	ErrDrainNotFound      = errors.New("Drain not found.")
+	ErrPrivateDrainURL    = errors.New("Invalid drain URL: the host must not be a private or loopback address.")
+)
+
+// drainBufferSize is the number of logs that each drain holds while they're
+// not forwarded. Logs are discarded when the buffer is full.
+const drainBufferSize = 1000
+
+var (
+	// drainRetries is how many times the delivery of logs to a drain is
+	// retried before they're discarded.
+	drainRetries = 3
+
+	// drainRetryInterval is the interval before the first retry. It doubles
+	// on each retry.
+	drainRetryInterval = time.Second
+
+	// drainTimeout is the timeout for connecting and sending logs to drains.
+	drainTimeout = 10 * time.Second
+
+	// drainCacheTTL is how long the drains of an app are cached. Drains
+	// added or removed in other API servers are seen after this interval.
+	drainCacheTTL = time.Minute
+)
+
+// privateNetworks are the networks that drains can't reach, unless the
+// "app-log:drains:allow-private-addresses" setting is true.
+var privateNetworks []*net.IPNet
+
+func init() {
+	cidrs := []string{
+		"0.0.0.0/8", "10.0.0.0/8", "100.64.0.0/10", "127.0.0.0/8",
+		"169.254.0.0/16", "172.16.0.0/12", "192.168.0.0/16",
+		"::1/128", "fc00::/7", "fe80::/10",
+	}
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		privateNetworks = append(privateNetworks, network)
+	}
+}
+
+// LogDrain is an external destination for the logs of an app, like a syslog
+// server or an HTTP endpoint.
+type LogDrain struct {
+	AppName string
+	URL     string
+}
+
+// AddLogDrain adds a drain to the app. From now on, the logs of the app are
+// forwarded to the drain.
+//
+// The URL must be in the form syslog://host:port (syslog over TCP, also
+// accepted as syslog+tcp://host:port), syslog+udp://host:port or an HTTP(S)
+// URL, that receives the logs in JSON format.
+//
+// Drains can't point to private or loopback addresses, unless the
+// "app-log:drains:allow-private-addresses" setting is true.
+func (app *App) AddLogDrain(rawurl string) error {
+	if _, err := newDrainSender(rawurl); err != nil {
+		return err
+	}
+	if err := checkDrainHost(rawurl); err != nil {
+		return err
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	err = conn.LogDrains().Insert(LogDrain{AppName: app.Name, URL: rawurl})
+	if mgo.IsDup(err) {
+		return ErrDrainAlreadyExists
+	}
+	if err != nil {
+		return err
+	}
+	drainURLs.invalidate(app.Name)
+	return nil
+}
+
+// RemoveLogDrain removes a drain from the app.
+func (app *App) RemoveLogDrain(rawurl string) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	err = conn.LogDrains().Remove(bson.M{"appname": app.Name, "url": rawurl})
+	if err == mgo.ErrNotFound {
+		return ErrDrainNotFound
+	}
+	if err != nil {
+		return err
+	}
+	drainURLs.invalidate(app.Name)
+	drains.close(app.Name, rawurl)
+	return nil
+}
+
+// LogDrains returns the drains of the app.
+func (app *App) LogDrains() ([]LogDrain, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	var result []LogDrain
+	err = conn.LogDrains().Find(bson.M{"appname": app.Name}).All(&result)
+	return result, err
+}
+
+// forwardLogs sends the logs to the drains of the app. Logs are buffered and
+// delivered in background, so forwardLogs does not wait for the drains.
+func forwardLogs(conn *db.Storage, appName string, logs []Applog) {
+	urls, err := drainURLs.get(conn, appName)
+	if err != nil {
+		log.Printf("Failed to get the log drains of %s: %s", appName, err)
+		return
+	}
+	for _, u := range urls {
+		w, err := drains.get(appName, u)
+		if err != nil {
+			log.Printf("Failed to forward logs of %s to %s: %s", appName, u, err)
+			continue
+		}
+		w.send(logs)
+	}
+}
+
+type cachedDrains struct {
+	urls    []string
+	expires time.Time
+}
+
+// drainCache holds the URLs of the drains of each app, so forwardLogs
+// doesn't query the database on every write.
+type drainCache struct {
+	sync.Mutex
+	apps map[string]cachedDrains
+}
+
+var drainURLs = drainCache{apps: make(map[string]cachedDrains)}
+
+func (c *drainCache) get(conn *db.Storage, appName string) ([]string, error) {
+	c.Lock()
+	cached, ok := c.apps[appName]
+	c.Unlock()
+	if ok && time.Now().Before(cached.expires) {
+		return cached.urls, nil
+	}
+	var result []LogDrain
+	err := conn.LogDrains().Find(bson.M{"appname": appName}).All(&result)
+	if err != nil {
+		return nil, err
+	}
+	urls := make([]string, len(result))
+	for i, d := range result {
+		urls[i] = d.URL
+	}
+	c.Lock()
+	c.apps[appName] = cachedDrains{urls: urls, expires: time.Now().Add(drainCacheTTL)}
+	c.Unlock()
+	return urls, nil
+}
+
+func (c *drainCache) invalidate(appName string) {
+	c.Lock()
+	defer c.Unlock()
+	delete(c.apps, appName)
+}
+
+func allowPrivateDrains() bool {
+	allow, _ := config.GetBool("app-log:drains:allow-private-addresses")
+	return allow
+}
+
+func isPrivateIP(ip net.IP) bool {
+	if ip.IsUnspecified() || ip.IsLoopback() || ip.IsMulticast() {
+		return true
+	}
+	for _, network := range privateNetworks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkDrainHost returns ErrPrivateDrainURL when the host of the drain is, or
+// resolves to, a private address. Hosts that can't be resolved now are
+// accepted: the address is checked again on every connection.
+func checkDrainHost(rawurl string) error {
+	if allowPrivateDrains() {
+		return nil
+	}
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return ErrInvalidDrainURL
+	}
+	host := u.Host
+	if h, _, err := net.SplitHostPort(u.Host); err == nil {
+		host = h
+	}
+	if host == "localhost" {
+		return ErrPrivateDrainURL
+	}
+	ips, _ := net.LookupIP(host)
+	for _, ip := range ips {
+		if isPrivateIP(ip) {
+			return ErrPrivateDrainURL
+		}
+	}
+	return nil
+}
+
+// dialDrain connects to a drain, refusing private addresses. The host is
+// resolved here, so a name that resolves to a private address after the
+// drain is added (or the target of an HTTP redirect) is refused too.
+func dialDrain(network, addr string) (net.Conn, error) {
+	if allowPrivateDrains() {
+		return net.DialTimeout(network, addr, drainTimeout)
+	}
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	ips, err := net.LookupIP(host)
+	if err != nil {
+		return nil, err
+	}
+	for _, ip := range ips {
+		if isPrivateIP(ip) {
+			return nil, ErrPrivateDrainURL
+		}
+	}
+	return net.DialTimeout(network, net.JoinHostPort(ips[0].String(), port), drainTimeout)
+}
+
+// drainSender delivers logs to a drain.
+type drainSender interface {
+	Send(appName string, logs []Applog) error
+	Close()
+}
+
+func newDrainSender(rawurl string) (drainSender, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil || u.Host == "" {
+		return nil, ErrInvalidDrainURL
+	}
+	switch u.Scheme {
+	case "syslog", "syslog+tcp":
+		return &syslogSender{network: "tcp", addr: u.Host}, nil
+	case "syslog+udp":
+		return &syslogSender{network: "udp", addr: u.Host}, nil
+	case "http", "https":
+		transport := http.Transport{
+			Dial:                  dialDrain,
+			ResponseHeaderTimeout: drainTimeout,
+		}
+		return &httpSender{url: rawurl, client: &http.Client{Transport: &transport}}, nil
+	}
+	return nil, ErrInvalidDrainURL
+}
+
+// syslogSender sends logs to a syslog server, in the format described in RFC
+// 5424. Each log is sent in its own line, with the app name as the hostname,
+// the source as the app name and the unit as the process id.
+type syslogSender struct {
+	network string
+	addr    string
+	conn    net.Conn
+}
+
+func (s *syslogSender) Send(appName string, logs []Applog) error {
+	if s.conn == nil {
+		conn, err := dialDrain(s.network, s.addr)
+		if err != nil {
+			return err
+		}
+		s.conn = conn
+	}
+	s.conn.SetWriteDeadline(time.Now().Add(drainTimeout))
+	for _, l := range logs {
+		procid := l.Unit
+		if procid == "" {
+			procid = "-"
+		}
+		// Priority 14 is facility user, severity informational.
+		line := fmt.Sprintf("<14>1 %s %s %s %s - - %s\n",
+			l.Date.UTC().Format(time.RFC3339Nano), appName, l.Source, procid, l.Message)
+		if _, err := s.conn.Write([]byte(line)); err != nil {
+			// The connection is opened again on the next delivery.
+			s.Close()
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *syslogSender) Close() {
+	if s.conn != nil {
+		s.conn.Close()
+		s.conn = nil
+	}
+}
+
+// httpSender posts logs to an HTTP endpoint, as a JSON list.
+type httpSender struct {
+	url    string
+	client *http.Client
+}
+
+func (s *httpSender) Send(appName string, logs []Applog) error {
+	body, err := json.Marshal(logs)
+	if err != nil {
+		return err
+	}
+	resp, err := s.client.Post(s.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func (s *httpSender) Close() {}
+
+// drainWriter buffers the logs of an app and delivers them to a drain, in
+// background.
+type drainWriter struct {
+	appName string
+	url     string
+	sender  drainSender
+	logs    chan Applog
+	quit    chan bool
+}
+
+func newDrainWriter(appName, url string, sender drainSender) *drainWriter {
+	w := drainWriter{
+		appName: appName,
+		url:     url,
+		sender:  sender,
+		logs:    make(chan Applog, drainBufferSize),
+		quit:    make(chan bool),
+	}
+	go w.run()
+	return &w
+}
+
+// send buffers the logs, discarding them when the buffer is full.
+func (w *drainWriter) send(logs []Applog) {
+	var discarded int
+	for _, l := range logs {
+		select {
+		case w.logs <- l:
+		default:
+			discarded++
+		}
+	}
+	if discarded > 0 {
+		log.Printf("Log drain %s of %s is full, discarded %d logs.", w.url, w.appName, discarded)
+	}
+}
+
+func (w *drainWriter) run() {
+	defer w.sender.Close()
+	for {
+		select {
+		case l := <-w.logs:
+			batch := []Applog{l}
+			for len(batch) < cap(w.logs) && len(w.logs) > 0 {
+				batch = append(batch, <-w.logs)
+			}
+			w.deliver(batch)
+		case <-w.quit:
+			return
+		}
+	}
+}
+
+// deliver sends the logs to the drain, retrying with exponential backoff.
+func (w *drainWriter) deliver(logs []Applog) {
+	interval := drainRetryInterval
+	for i := 0; ; i++ {
+		err := w.sender.Send(w.appName, logs)
+		if err == nil {
+			return
+		}
+		if i == drainRetries {
+			log.Printf("Failed to send %d logs of %s to %s: %s", len(logs), w.appName, w.url, err)
+			return
+		}
+		select {
+		case <-time.After(interval):
+		case <-w.quit:
+			return
+		}
+		interval *= 2
+	}
+}
+
+func (w *drainWriter) close() {
+	close(w.quit)
+}
+
+// drainPool holds the drain writers running in this process.
+type drainPool struct {
+	sync.Mutex
+	writers map[string]*drainWriter
+}
+
+var drains = drainPool{writers: make(map[string]*drainWriter)}
+
+func (p *drainPool) get(appName, url string) (*drainWriter, error) {
+	p.Lock()
+	defer p.Unlock()
+	key := appName + " " + url
+	if w, ok := p.writers[key]; ok {
+		return w, nil
+	}
+	sender, err := newDrainSender(url)
+	if err != nil {
+		return nil, err
+	}
+	w := newDrainWriter(appName, url, sender)
+	p.writers[key] = w
+	return w, nil
+}
+
+func (p *drainPool) close(appName, url string) {
+	p.Lock()
+	defer p.Unlock()
+	key := appName + " " + url
+	if w, ok := p.writers[key]; ok {
+		w.close()
+		delete(p.writers, key)
+	}
+}
+
+// closeApp stops all drain writers of the app.
+func (p *drainPool) closeApp(appName string) {
+	p.Lock()
+	defer p.Unlock()
+	for key, w := range p.writers {
+		if w.appName == appName {
+			w.close()
+			delete(p.writers, key)
+		}
+	}
+}
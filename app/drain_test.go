@@ -0,0 +1,335 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"github.com/globocom/config"
+	"labix.org/v2/mgo/bson"
+	"launchpad.net/gocheck"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+)
+
+type fakeDrainSender struct {
+	sync.Mutex
+	failures int
+	calls    int
+	logs     []Applog
+	sent     chan bool
+}
+
+func (s *fakeDrainSender) Send(appName string, logs []Applog) error {
+	s.Lock()
+	defer s.Unlock()
+	s.calls++
+	if s.failures > 0 {
+		s.failures--
+		return errors.New("drain is down")
+	}
+	s.logs = append(s.logs, logs...)
+	s.sent <- true
+	return nil
+}
+
+func (s *fakeDrainSender) Close() {}
+
+func (s *S) TestAddLogDrain(c *gocheck.C) {
+	a := App{Name: "drained"}
+	err := a.AddLogDrain("syslog://logs.example.com:514")
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.LogDrains().RemoveAll(bson.M{"appname": a.Name})
+	drains, err := a.LogDrains()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(drains, gocheck.DeepEquals, []LogDrain{{AppName: "drained", URL: "syslog://logs.example.com:514"}})
+}
+
+func (s *S) TestAddLogDrainInvalidURL(c *gocheck.C) {
+	a := App{Name: "drained"}
+	urls := []string{"ftp://logs.example.com", "logs.example.com:514", "syslog://", "%%%"}
+	for _, u := range urls {
+		err := a.AddLogDrain(u)
+		c.Check(err, gocheck.Equals, ErrInvalidDrainURL)
+	}
+	n, err := s.conn.LogDrains().Find(bson.M{"appname": a.Name}).Count()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(n, gocheck.Equals, 0)
+}
+
+func (s *S) TestAddLogDrainPrivateAddress(c *gocheck.C) {
+	a := App{Name: "drained"}
+	urls := []string{
+		"syslog://127.0.0.1:514", "syslog+udp://10.0.0.1:514", "http://localhost/drain",
+		"http://169.254.169.254/latest/meta-data", "https://192.168.1.10/drain", "http://[::1]:8080/",
+	}
+	for _, u := range urls {
+		err := a.AddLogDrain(u)
+		c.Check(err, gocheck.Equals, ErrPrivateDrainURL)
+	}
+	n, err := s.conn.LogDrains().Find(bson.M{"appname": a.Name}).Count()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(n, gocheck.Equals, 0)
+}
+
+func (s *S) TestAddLogDrainPrivateAddressAllowedByTheAdmin(c *gocheck.C) {
+	config.Set("app-log:drains:allow-private-addresses", true)
+	defer config.Unset("app-log:drains:allow-private-addresses")
+	a := App{Name: "drained"}
+	err := a.AddLogDrain("syslog://10.0.0.1:514")
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.LogDrains().RemoveAll(bson.M{"appname": a.Name})
+}
+
+func (s *S) TestHTTPSenderRefusesPrivateAddresses(c *gocheck.C) {
+	var called bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	defer server.Close()
+	sender, err := newDrainSender(server.URL)
+	c.Assert(err, gocheck.IsNil)
+	err = sender.Send("myapp", []Applog{{Message: "hello"}})
+	c.Assert(err, gocheck.NotNil)
+	c.Assert(called, gocheck.Equals, false)
+}
+
+func (s *S) TestForwardLogsCachesTheDrains(c *gocheck.C) {
+	a := App{Name: "drained"}
+	err := a.AddLogDrain("syslog://logs.example.com:514")
+	c.Assert(err, gocheck.IsNil)
+	defer a.RemoveLogDrain("syslog://logs.example.com:514")
+	urls, err := drainURLs.get(s.conn, a.Name)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(urls, gocheck.DeepEquals, []string{"syslog://logs.example.com:514"})
+	err = s.conn.LogDrains().Insert(LogDrain{AppName: a.Name, URL: "syslog://other.example.com:514"})
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.LogDrains().RemoveAll(bson.M{"appname": a.Name})
+	urls, err = drainURLs.get(s.conn, a.Name)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(urls, gocheck.HasLen, 1)
+	err = a.AddLogDrain("https://logs.example.com/drain")
+	c.Assert(err, gocheck.IsNil)
+	urls, err = drainURLs.get(s.conn, a.Name)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(urls, gocheck.HasLen, 3)
+}
+
+func (s *S) TestAddLogDrainDuplicate(c *gocheck.C) {
+	a := App{Name: "drained"}
+	err := a.AddLogDrain("https://logs.example.com/drain")
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.LogDrains().RemoveAll(bson.M{"appname": a.Name})
+	err = a.AddLogDrain("https://logs.example.com/drain")
+	c.Assert(err, gocheck.Equals, ErrDrainAlreadyExists)
+}
+
+func (s *S) TestRemoveLogDrain(c *gocheck.C) {
+	a := App{Name: "drained"}
+	err := a.AddLogDrain("syslog+udp://logs.example.com:514")
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.LogDrains().RemoveAll(bson.M{"appname": a.Name})
+	err = a.RemoveLogDrain("syslog+udp://logs.example.com:514")
+	c.Assert(err, gocheck.IsNil)
+	drains, err := a.LogDrains()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(drains, gocheck.HasLen, 0)
+}
+
+func (s *S) TestRemoveLogDrainNotFound(c *gocheck.C) {
+	a := App{Name: "drained"}
+	err := a.RemoveLogDrain("syslog://logs.example.com:514")
+	c.Assert(err, gocheck.Equals, ErrDrainNotFound)
+}
+
+func (s *S) TestSyslogSenderTCP(c *gocheck.C) {
+	config.Set("app-log:drains:allow-private-addresses", true)
+	defer config.Unset("app-log:drains:allow-private-addresses")
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, gocheck.IsNil)
+	defer l.Close()
+	lines := make(chan string, 2)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		for i := 0; i < 2; i++ {
+			line, _ := r.ReadString('\n')
+			lines <- line
+		}
+	}()
+	sender, err := newDrainSender("syslog://" + l.Addr().String())
+	c.Assert(err, gocheck.IsNil)
+	defer sender.Close()
+	date := time.Date(2013, 12, 10, 15, 0, 0, 0, time.UTC)
+	logs := []Applog{
+		{Date: date, Message: "starting", Source: "app", Unit: "myapp/0"},
+		{Date: date, Message: "restarted", Source: "tsuru"},
+	}
+	err = sender.Send("myapp", logs)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(<-lines, gocheck.Equals, "<14>1 2013-12-10T15:00:00Z myapp app myapp/0 - - starting\n")
+	c.Assert(<-lines, gocheck.Equals, "<14>1 2013-12-10T15:00:00Z myapp tsuru - - - restarted\n")
+}
+
+func (s *S) TestSyslogSenderUDP(c *gocheck.C) {
+	config.Set("app-log:drains:allow-private-addresses", true)
+	defer config.Unset("app-log:drains:allow-private-addresses")
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	c.Assert(err, gocheck.IsNil)
+	defer conn.Close()
+	sender, err := newDrainSender("syslog+udp://" + conn.LocalAddr().String())
+	c.Assert(err, gocheck.IsNil)
+	defer sender.Close()
+	date := time.Date(2013, 12, 10, 15, 0, 0, 0, time.UTC)
+	err = sender.Send("myapp", []Applog{{Date: date, Message: "starting", Source: "app"}})
+	c.Assert(err, gocheck.IsNil)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 512)
+	n, _, err := conn.ReadFrom(buf)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(string(buf[:n]), gocheck.Equals, "<14>1 2013-12-10T15:00:00Z myapp app - - - starting\n")
+}
+
+func (s *S) TestSyslogSenderConnectionRefused(c *gocheck.C) {
+	config.Set("app-log:drains:allow-private-addresses", true)
+	defer config.Unset("app-log:drains:allow-private-addresses")
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, gocheck.IsNil)
+	addr := l.Addr().String()
+	l.Close()
+	sender, err := newDrainSender("syslog://" + addr)
+	c.Assert(err, gocheck.IsNil)
+	err = sender.Send("myapp", []Applog{{Message: "starting"}})
+	c.Assert(err, gocheck.NotNil)
+}
+
+func (s *S) TestHTTPSender(c *gocheck.C) {
+	config.Set("app-log:drains:allow-private-addresses", true)
+	defer config.Unset("app-log:drains:allow-private-addresses")
+	var logs []Applog
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.Method, gocheck.Equals, "POST")
+		c.Check(r.Header.Get("Content-Type"), gocheck.Equals, "application/json")
+		json.NewDecoder(r.Body).Decode(&logs)
+	}))
+	defer server.Close()
+	sender, err := newDrainSender(server.URL)
+	c.Assert(err, gocheck.IsNil)
+	err = sender.Send("myapp", []Applog{{Message: "starting", Source: "app", AppName: "myapp"}})
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(logs, gocheck.HasLen, 1)
+	c.Assert(logs[0].Message, gocheck.Equals, "starting")
+}
+
+func (s *S) TestHTTPSenderErrorStatus(c *gocheck.C) {
+	config.Set("app-log:drains:allow-private-addresses", true)
+	defer config.Unset("app-log:drains:allow-private-addresses")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	sender, err := newDrainSender(server.URL)
+	c.Assert(err, gocheck.IsNil)
+	err = sender.Send("myapp", []Applog{{Message: "starting"}})
+	c.Assert(err, gocheck.NotNil)
+	c.Assert(err.Error(), gocheck.Equals, "unexpected status code: 503")
+}
+
+func (s *S) TestDrainWriterRetries(c *gocheck.C) {
+	old := drainRetryInterval
+	drainRetryInterval = time.Millisecond
+	defer func() {
+		drainRetryInterval = old
+	}()
+	sender := &fakeDrainSender{failures: 2, sent: make(chan bool, 1)}
+	w := newDrainWriter("myapp", "fake://", sender)
+	defer w.close()
+	w.send([]Applog{{Message: "starting"}})
+	select {
+	case <-sender.sent:
+	case <-time.After(5 * time.Second):
+		c.Fatal("Timed out waiting for the delivery.")
+	}
+	sender.Lock()
+	defer sender.Unlock()
+	c.Assert(sender.calls, gocheck.Equals, 3)
+	c.Assert(sender.logs, gocheck.HasLen, 1)
+	c.Assert(sender.logs[0].Message, gocheck.Equals, "starting")
+}
+
+func (s *S) TestDrainWriterDiscardsAfterRetries(c *gocheck.C) {
+	old := drainRetryInterval
+	drainRetryInterval = time.Millisecond
+	defer func() {
+		drainRetryInterval = old
+	}()
+	sender := &fakeDrainSender{failures: drainRetries + 1, sent: make(chan bool, 1)}
+	w := newDrainWriter("myapp", "fake://", sender)
+	defer w.close()
+	w.send([]Applog{{Message: "lost"}})
+	for i := 0; ; i++ {
+		sender.Lock()
+		calls := sender.calls
+		sender.Unlock()
+		if calls == drainRetries+1 {
+			break
+		}
+		if i == 500 {
+			c.Fatal("Timed out waiting for the retries.")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	w.send([]Applog{{Message: "delivered"}})
+	select {
+	case <-sender.sent:
+	case <-time.After(5 * time.Second):
+		c.Fatal("Timed out waiting for the delivery.")
+	}
+	sender.Lock()
+	defer sender.Unlock()
+	c.Assert(sender.logs, gocheck.HasLen, 1)
+	c.Assert(sender.logs[0].Message, gocheck.Equals, "delivered")
+}
+
+func (s *S) TestUnitLogForwardsToDrains(c *gocheck.C) {
+	config.Set("app-log:drains:allow-private-addresses", true)
+	defer config.Unset("app-log:drains:allow-private-addresses")
+	received := make(chan []Applog, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var logs []Applog
+		json.NewDecoder(r.Body).Decode(&logs)
+		received <- logs
+	}))
+	defer server.Close()
+	a := App{Name: "drained"}
+	err := a.AddLogDrain(server.URL)
+	c.Assert(err, gocheck.IsNil)
+	defer a.RemoveLogDrain(server.URL)
+	defer s.conn.Logs().RemoveAll(bson.M{"appname": a.Name})
+	err = a.UnitLog("first\nsecond", "app", "drained/0")
+	c.Assert(err, gocheck.IsNil)
+	var messages []string
+	for len(messages) < 2 {
+		select {
+		case logs := <-received:
+			for _, l := range logs {
+				c.Check(l.Unit, gocheck.Equals, "drained/0")
+				messages = append(messages, l.Message)
+			}
+		case <-time.After(5 * time.Second):
+			c.Fatal("Timed out waiting for the logs.")
+		}
+	}
+	c.Assert(strings.Join(messages, ","), gocheck.Equals, "first,second")
+}
@@ -5,9 +5,46 @@
 package app
 
 import (
+	"errors"
 	"fmt"
 )
 
+// ErrRollbackNotSupported is the error returned when one tries to rollback an
+// app using a provisioner that does not keep the images of previous deploys.
+var ErrRollbackNotSupported = errors.New("The provisioner does not support rollbacks.")
+
+// ErrNodesNotSupported is the error returned when one tries to manage the
+// nodes of a provisioner that does not support it.
+var ErrNodesNotSupported = errors.New("The provisioner does not support node management.")
+
+// ErrInvalidNode is the error returned when one tries to add a node without
+// id or address.
+var ErrInvalidNode = errors.New("The id and the address of the node are required.")
+
+// ErrPoolsNotSupported is the error returned when one tries to manage the
+// pools of a provisioner that does not support it.
+var ErrPoolsNotSupported = errors.New("The provisioner does not support pools.")
+
+// ErrInvalidPool is the error returned when one tries to add a pool without
+// name.
+var ErrInvalidPool = errors.New("The name of the pool is required.")
+
+// ErrNoPoolTeams is the error returned when one tries to add or remove the
+// teams of a pool without giving any team.
+var ErrNoPoolTeams = errors.New("At least one team is required.")
+
+// ErrPoolInUse is the error returned when one tries to remove a pool chosen
+// by apps.
+var ErrPoolInUse = errors.New("The pool is used by apps.")
+
+// ErrDeployNotFound is the error returned when the requested deploy is not in
+// the database.
+var ErrDeployNotFound = errors.New("Deploy not found.")
+
+// ErrInvalidResources is the error returned when one tries to set negative
+// resource limits to an app.
+var ErrInvalidResources = errors.New("Memory and CPU shares must not be negative.")
+
 type AppCreationError struct {
 	app string
 	Err error
@@ -24,3 +61,13 @@ type NoTeamsError struct{}
 func (err NoTeamsError) Error() string {
 	return "Cannot create app without teams."
 }
+
+// DeployNotFoundError is the error returned when the given version is not in
+// the deploy history of an app.
+type DeployNotFoundError struct {
+	Version string
+}
+
+func (err *DeployNotFoundError) Error() string {
+	return fmt.Sprintf("Version %q not found in the deploy history.", err.Version)
+}
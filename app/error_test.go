@@ -19,3 +19,8 @@ func (s *S) TestNoTeamsError(c *gocheck.C) {
 	e := NoTeamsError{}
 	c.Assert(e.Error(), gocheck.Equals, "Cannot create app without teams.")
 }
+
+func (s *S) TestDeployNotFoundError(c *gocheck.C) {
+	e := DeployNotFoundError{Version: "a345f3e"}
+	c.Assert(e.Error(), gocheck.Equals, `Version "a345f3e" not found in the deploy history.`)
+}
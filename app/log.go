@@ -6,8 +6,11 @@ package app
 
 import (
 	"errors"
-	"sync"
+	"github.com/globocom/tsuru/db"
+	"github.com/globocom/tsuru/log"
+	"labix.org/v2/mgo/bson"
 	"sync/atomic"
+	"time"
 )
 
 const (
@@ -15,66 +18,112 @@ const (
 	open
 )
 
-var listeners = struct {
-	m map[string][]*LogListener
-	sync.RWMutex
-}{
-	m: make(map[string][]*LogListener),
+// tailTimeout is how long the listener waits for new logs before checking
+// whether it was closed.
+var tailTimeout = time.Second
+
+// LogFilter filters the logs received by a LogListener. Empty fields are
+// ignored.
+type LogFilter struct {
+	Source string
+	Unit   string
 }
 
+// LogListener follows the logs of an app. Logs are read from the log stream
+// collection, so listeners receive the logs written by any API server.
 type LogListener struct {
 	C       <-chan Applog
 	c       chan Applog
+	quit    chan bool
 	state   int32
 	appname string
 }
 
-func NewLogListener(a *App) *LogListener {
+// NewLogListener returns a listener that receives the logs of the app written
+// after its creation, matching the filter. The listener must be closed when
+// it's no longer used.
+func NewLogListener(a *App, filter LogFilter) *LogListener {
 	c := make(chan Applog, 10)
-	l := LogListener{C: c, c: c, state: open, appname: a.Name}
-	listeners.Lock()
-	list := listeners.m[l.appname]
-	list = append(list, &l)
-	listeners.m[a.Name] = list
-	listeners.Unlock()
+	l := LogListener{C: c, c: c, quit: make(chan bool), state: open, appname: a.Name}
+	query := bson.M{"appname": a.Name}
+	if filter.Source != "" {
+		query["source"] = filter.Source
+	}
+	if filter.Unit != "" {
+		query["unit"] = filter.Unit
+	}
+	go l.tail(query, time.Now().In(time.UTC))
 	return &l
 }
 
-func (l *LogListener) Close() error {
-	if !atomic.CompareAndSwapInt32(&l.state, open, closed) {
-		return errors.New("Already closed.")
+// logsAfter returns a copy of the query that matches the logs written after
+// the log with the given date and id. If the id is empty, the logs written in
+// the same millisecond of the date are matched too.
+func logsAfter(query bson.M, date time.Time, id bson.ObjectId) bson.M {
+	q := make(bson.M, len(query)+1)
+	for k, v := range query {
+		q[k] = v
 	}
-	close(l.c)
-	listeners.Lock()
-	defer listeners.Unlock()
-	list := listeners.m[l.appname]
-	index := -1
-	for i, listener := range list {
-		if listener == l {
-			index = i
-			break
+	if id == "" {
+		q["date"] = bson.M{"$gte": date}
+	} else {
+		q["$or"] = []bson.M{
+			{"date": bson.M{"$gt": date}},
+			{"date": date, "_id": bson.M{"$gt": id}},
 		}
 	}
-	if index > -1 {
-		list[index], list[len(list)-1] = list[len(list)-1], list[index]
-		listeners.m[l.appname] = list[:len(list)-1]
-	}
-	return nil
+	return q
 }
 
-func notify(appName string, messages []interface{}) {
-	var wg sync.WaitGroup
-	listeners.RLock()
-	ls := listeners.m[appName]
-	listeners.RUnlock()
-	for _, l := range ls {
-		wg.Add(1)
-		go func(l *LogListener) {
-			for _, msg := range messages {
-				l.c <- msg.(Applog)
+// tail follows the log stream collection, sending the logs to the listener
+// channel until the listener is closed.
+func (l *LogListener) tail(query bson.M, since time.Time) {
+	defer close(l.c)
+	conn, err := db.Conn()
+	if err != nil {
+		log.Printf("Failed to follow the logs of %s: %s", l.appname, err)
+		return
+	}
+	defer conn.Close()
+	var lastID bson.ObjectId
+	iter := conn.LogStream().Find(logsAfter(query, since, lastID)).Tail(tailTimeout)
+	defer func() {
+		iter.Close()
+	}()
+	var entry Applog
+	for {
+		for iter.Next(&entry) {
+			since, lastID = entry.Date, entry.ID
+			select {
+			case l.c <- entry:
+			case <-l.quit:
+				return
 			}
-			wg.Done()
-		}(l)
+		}
+		if err := iter.Err(); err != nil {
+			log.Printf("Failed to follow the logs of %s: %s", l.appname, err)
+			return
+		}
+		select {
+		case <-l.quit:
+			return
+		default:
+		}
+		if !iter.Timeout() {
+			// The cursor dies when there are no logs in the collection, so
+			// wait a little and query again.
+			iter.Close()
+			time.Sleep(tailTimeout)
+			iter = conn.LogStream().Find(logsAfter(query, since, lastID)).Tail(tailTimeout)
+		}
+	}
+}
+
+// Close stops the listener. The channel C is closed after the listener stops.
+func (l *LogListener) Close() error {
+	if !atomic.CompareAndSwapInt32(&l.state, open, closed) {
+		return errors.New("Already closed.")
 	}
-	wg.Wait()
+	close(l.quit)
+	return nil
 }
@@ -5,92 +5,124 @@
 package app
 
 import (
+	"labix.org/v2/mgo/bson"
 	"launchpad.net/gocheck"
-	"sync"
 	"time"
 )
 
+// receiveLogs reads n logs from the listener, failing on timeout.
+func receiveLogs(c *gocheck.C, l *LogListener, n int) []Applog {
+	var logs []Applog
+	timeout := time.After(5 * time.Second)
+	for len(logs) < n {
+		select {
+		case log, ok := <-l.C:
+			if !ok {
+				c.Fatal("Listener closed.")
+			}
+			logs = append(logs, log)
+		case <-timeout:
+			c.Fatal("Timed out.")
+		}
+	}
+	return logs
+}
+
 func (s *S) TestNewLogListener(c *gocheck.C) {
 	app := App{Name: "myapp"}
-	l := NewLogListener(&app)
+	l := NewLogListener(&app, LogFilter{})
+	defer l.Close()
 	c.Assert(l.appname, gocheck.Equals, "myapp")
 	c.Assert(l.state, gocheck.Equals, open)
 	c.Assert(l.C, gocheck.NotNil)
-	close(l.c)
-	_, ok := <-l.C
-	c.Assert(ok, gocheck.Equals, false)
-	ls := listeners.m["myapp"]
-	c.Assert(ls, gocheck.HasLen, 1)
-	c.Assert(ls[0], gocheck.Equals, l)
-	delete(listeners.m, "myapp")
 }
 
 func (s *S) TestLogListenerClose(c *gocheck.C) {
 	app := App{Name: "yourapp"}
-	l := NewLogListener(&app)
+	l := NewLogListener(&app, LogFilter{})
 	err := l.Close()
 	c.Assert(err, gocheck.IsNil)
 	c.Assert(l.state, gocheck.Equals, closed)
-	_, ok := <-l.C
-	c.Assert(ok, gocheck.Equals, false)
-	ls := listeners.m["yourapp"]
-	c.Assert(ls, gocheck.HasLen, 0)
+	select {
+	case _, ok := <-l.C:
+		c.Assert(ok, gocheck.Equals, false)
+	case <-time.After(5 * time.Second):
+		c.Fatal("Timed out waiting for the listener to stop.")
+	}
 }
 
 func (s *S) TestLogListenerDoubleClose(c *gocheck.C) {
 	app := App{Name: "yourapp"}
-	l := NewLogListener(&app)
+	l := NewLogListener(&app, LogFilter{})
 	err := l.Close()
 	c.Assert(err, gocheck.IsNil)
 	err = l.Close()
 	c.Assert(err, gocheck.NotNil)
 }
 
-func (s *S) TestNotify(c *gocheck.C) {
-	var logs struct {
-		l []interface{}
-		sync.Mutex
-	}
+func (s *S) TestLogListenerReceivesLogsWrittenAfterItsCreation(c *gocheck.C) {
 	app := App{Name: "fade"}
-	l := NewLogListener(&app)
+	err := app.Log("old message", "tsuru")
+	c.Assert(err, gocheck.IsNil)
+	time.Sleep(10 * time.Millisecond)
+	l := NewLogListener(&app, LogFilter{})
 	defer l.Close()
-	go func() {
-		for log := range l.C {
-			logs.Lock()
-			logs.l = append(logs.l, log)
-			logs.Unlock()
-		}
-	}()
-	ms := []interface{}{
-		Applog{Date: time.Now(), Message: "Something went wrong. Check it out:", Source: "tsuru"},
-		Applog{Date: time.Now(), Message: "This program has performed an illegal operation.", Source: "tsuru"},
+	time.Sleep(10 * time.Millisecond)
+	err = app.Log("Something went wrong. Check it out:\nThis program has performed an illegal operation.", "tsuru")
+	c.Assert(err, gocheck.IsNil)
+	logs := receiveLogs(c, l, 2)
+	c.Assert(logs[0].Message, gocheck.Equals, "Something went wrong. Check it out:")
+	c.Assert(logs[1].Message, gocheck.Equals, "This program has performed an illegal operation.")
+	c.Assert(logs[1].AppName, gocheck.Equals, "fade")
+}
+
+func (s *S) TestLogListenerFilter(c *gocheck.C) {
+	app := App{Name: "filtered"}
+	l := NewLogListener(&app, LogFilter{Source: "app", Unit: "filtered/1"})
+	defer l.Close()
+	time.Sleep(10 * time.Millisecond)
+	other := App{Name: "other"}
+	c.Assert(other.UnitLog("other app", "app", "filtered/1"), gocheck.IsNil)
+	c.Assert(app.Log("from tsuru", "tsuru"), gocheck.IsNil)
+	c.Assert(app.UnitLog("from another unit", "app", "filtered/0"), gocheck.IsNil)
+	c.Assert(app.UnitLog("from the unit", "app", "filtered/1"), gocheck.IsNil)
+	logs := receiveLogs(c, l, 1)
+	c.Assert(logs[0].Message, gocheck.Equals, "from the unit")
+	c.Assert(logs[0].Unit, gocheck.Equals, "filtered/1")
+}
+
+func (s *S) TestLogsAfterMatchesLogsWrittenInTheSameMillisecond(c *gocheck.C) {
+	date := time.Date(2013, 12, 10, 15, 0, 0, 0, time.UTC)
+	logs := []Applog{
+		{ID: bson.NewObjectId(), Date: date, Message: "first", AppName: "sametime"},
+		{ID: bson.NewObjectId(), Date: date, Message: "second", AppName: "sametime"},
+		{ID: bson.NewObjectId(), Date: date.Add(time.Millisecond), Message: "third", AppName: "sametime"},
 	}
-	notify(app.Name, ms)
-	done := make(chan bool, 1)
-	q := make(chan bool)
-	go func(quit chan bool) {
-		for _ = range time.Tick(1e3) {
-			select {
-			case <-quit:
-				return
-			default:
-			}
-			logs.Lock()
-			if len(logs.l) == 2 {
-				logs.Unlock()
-				done <- true
-				return
-			}
-			logs.Unlock()
-		}
-	}(q)
-	select {
-	case <-done:
-	case <-time.After(2e9):
-		defer close(q)
-		c.Fatal("Timed out.")
+	coll := s.conn.LogStream()
+	for _, l := range logs {
+		c.Assert(coll.Insert(l), gocheck.IsNil)
 	}
-	logs.Lock()
-	defer logs.Unlock()
-	c.Assert(logs.l, gocheck.DeepEquals, ms)
+	var got []Applog
+	query := logsAfter(bson.M{"appname": "sametime"}, date, logs[0].ID)
+	err := coll.Find(query).Sort("date", "_id").All(&got)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(got, gocheck.HasLen, 2)
+	c.Assert(got[0].Message, gocheck.Equals, "second")
+	c.Assert(got[1].Message, gocheck.Equals, "third")
+	query = logsAfter(bson.M{"appname": "sametime"}, date, "")
+	err = coll.Find(query).Sort("date", "_id").All(&got)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(got, gocheck.HasLen, 3)
+}
+
+func (s *S) TestApplogAfter(c *gocheck.C) {
+	date := time.Date(2013, 12, 10, 15, 0, 0, 0, time.UTC)
+	first := Applog{ID: bson.NewObjectId(), Date: date}
+	second := Applog{ID: bson.NewObjectId(), Date: date}
+	third := Applog{ID: bson.NewObjectId(), Date: date.Add(time.Millisecond)}
+	c.Assert(second.After(&first), gocheck.Equals, true)
+	c.Assert(first.After(&second), gocheck.Equals, false)
+	c.Assert(first.After(&first), gocheck.Equals, false)
+	c.Assert(third.After(&second), gocheck.Equals, true)
+	c.Assert(first.After(&Applog{}), gocheck.Equals, true)
 }
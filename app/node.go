@@ -0,0 +1,46 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import "github.com/globocom/tsuru/provision"
+
+func nodeManager() (provision.NodeManager, error) {
+	if m, ok := Provisioner.(provision.NodeManager); ok {
+		return m, nil
+	}
+	return nil, ErrNodesNotSupported
+}
+
+// AddNode adds a node to the provisioner, if it supports node management.
+func AddNode(n provision.Node) error {
+	if n.ID == "" || n.Address == "" {
+		return ErrInvalidNode
+	}
+	m, err := nodeManager()
+	if err != nil {
+		return err
+	}
+	return m.AddNode(n)
+}
+
+// RemoveNode removes a node from the provisioner, if it supports node
+// management.
+func RemoveNode(id string) error {
+	m, err := nodeManager()
+	if err != nil {
+		return err
+	}
+	return m.RemoveNode(id)
+}
+
+// ListNodes returns the nodes of the provisioner, if it supports node
+// management.
+func ListNodes() ([]provision.Node, error) {
+	m, err := nodeManager()
+	if err != nil {
+		return nil, err
+	}
+	return m.ListNodes()
+}
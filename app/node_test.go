@@ -0,0 +1,53 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"github.com/globocom/tsuru/provision"
+	"launchpad.net/gocheck"
+)
+
+type unmanagedProvisioner struct {
+	provision.Provisioner
+}
+
+func (s *S) TestAddNode(c *gocheck.C) {
+	n := provision.Node{ID: "node1", Address: "http://10.0.0.1:4243"}
+	err := AddNode(n)
+	c.Assert(err, gocheck.IsNil)
+	defer RemoveNode("node1")
+	nodes, err := ListNodes()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(nodes, gocheck.DeepEquals, []provision.Node{n})
+}
+
+func (s *S) TestAddNodeInvalid(c *gocheck.C) {
+	err := AddNode(provision.Node{ID: "node1"})
+	c.Assert(err, gocheck.Equals, ErrInvalidNode)
+	err = AddNode(provision.Node{Address: "http://10.0.0.1:4243"})
+	c.Assert(err, gocheck.Equals, ErrInvalidNode)
+}
+
+func (s *S) TestRemoveNode(c *gocheck.C) {
+	err := AddNode(provision.Node{ID: "node1", Address: "http://10.0.0.1:4243"})
+	c.Assert(err, gocheck.IsNil)
+	err = RemoveNode("node1")
+	c.Assert(err, gocheck.IsNil)
+	err = RemoveNode("node1")
+	c.Assert(err, gocheck.Equals, provision.ErrNodeNotFound)
+}
+
+func (s *S) TestNodesNotSupported(c *gocheck.C) {
+	Provisioner = unmanagedProvisioner{s.provisioner}
+	defer func() {
+		Provisioner = s.provisioner
+	}()
+	err := AddNode(provision.Node{ID: "node1", Address: "http://10.0.0.1:4243"})
+	c.Assert(err, gocheck.Equals, ErrNodesNotSupported)
+	err = RemoveNode("node1")
+	c.Assert(err, gocheck.Equals, ErrNodesNotSupported)
+	_, err = ListNodes()
+	c.Assert(err, gocheck.Equals, ErrNodesNotSupported)
+}
@@ -5,12 +5,45 @@
 package app
 
 import (
+	"errors"
 	"github.com/globocom/tsuru/db"
+	"github.com/globocom/tsuru/provision"
+	"io"
+	"labix.org/v2/mgo"
 	"labix.org/v2/mgo/bson"
 )
 
+var (
+	ErrPlatformNameMissing = errors.New("Platform name is required.")
+	ErrDuplicatePlatform   = errors.New("Duplicate platform.")
+	ErrPlatformInUse       = errors.New("Platform is in use by some apps.")
+	ErrPlatformSource      = errors.New("You must provide either the Dockerfile or the image of the platform, not both.")
+)
+
+// Platform represents a platform in which apps are built.
+//
+// Depending on the provisioner, the base image of the platform is built from
+// Dockerfile or Image, and its units are deployed with Charm.
 type Platform struct {
-	Name string `bson:"_id"`
+	Name       string `bson:"_id"`
+	Dockerfile string `bson:",omitempty" json:",omitempty"`
+	Image      string `bson:",omitempty" json:",omitempty"`
+	Charm      string `bson:",omitempty" json:",omitempty"`
+}
+
+// args returns the arguments of the platform that are given to the
+// provisioner.
+func (p *Platform) args() map[string]string {
+	return map[string]string{"dockerfile": p.Dockerfile, "image": p.Image}
+}
+
+// CharmName returns the name of the juju charm used by the platform, which
+// defaults to the name of the platform.
+func (p *Platform) CharmName() string {
+	if p.Charm != "" {
+		return p.Charm
+	}
+	return p.Name
 }
 
 // Platforms returns the list of available platforms.
@@ -24,7 +57,9 @@ func Platforms() ([]Platform, error) {
 	return platforms, err
 }
 
-func getPlatform(name string) (*Platform, error) {
+// GetPlatform returns the platform with the given name, or
+// InvalidPlatformError if there is no such platform.
+func GetPlatform(name string) (*Platform, error) {
 	var p Platform
 	conn, err := db.Conn()
 	if err != nil {
@@ -37,6 +72,95 @@ func getPlatform(name string) (*Platform, error) {
 	return &p, nil
 }
 
+// PlatformAdd stores a new platform and, if supported by the provisioner,
+// builds its base image, logging the build output in the given writer.
+func PlatformAdd(p Platform, w io.Writer) error {
+	if p.Name == "" {
+		return ErrPlatformNameMissing
+	}
+	if p.Dockerfile != "" && p.Image != "" {
+		return ErrPlatformSource
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	err = conn.Platforms().Insert(p)
+	if e, ok := err.(*mgo.LastError); ok && e.Code == 11000 {
+		return ErrDuplicatePlatform
+	} else if err != nil {
+		return err
+	}
+	if manager, ok := Provisioner.(provision.PlatformManager); ok {
+		err = manager.PlatformAdd(p.Name, p.args(), w)
+		if err != nil {
+			conn.Platforms().RemoveId(p.Name)
+			return err
+		}
+	}
+	return nil
+}
+
+// PlatformUpdate updates the platform with the non-empty fields of the given
+// platform and, if supported by the provisioner, rebuilds its base image. The
+// platform is stored only after its image is rebuilt.
+func PlatformUpdate(p Platform, w io.Writer) error {
+	if p.Dockerfile != "" && p.Image != "" {
+		return ErrPlatformSource
+	}
+	current, err := GetPlatform(p.Name)
+	if err != nil {
+		return err
+	}
+	if p.Dockerfile != "" || p.Image != "" {
+		current.Dockerfile = p.Dockerfile
+		current.Image = p.Image
+	}
+	if p.Charm != "" {
+		current.Charm = p.Charm
+	}
+	if manager, ok := Provisioner.(provision.PlatformManager); ok {
+		err = manager.PlatformUpdate(current.Name, current.args(), w)
+		if err != nil {
+			return err
+		}
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return conn.Platforms().UpdateId(current.Name, current)
+}
+
+// PlatformRemove removes the platform and its base image. Platforms used by
+// apps can't be removed.
+func PlatformRemove(name string) error {
+	if _, err := GetPlatform(name); err != nil {
+		return err
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	count, err := conn.Apps().Find(bson.M{"framework": name}).Count()
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrPlatformInUse
+	}
+	if manager, ok := Provisioner.(provision.PlatformManager); ok {
+		err = manager.PlatformRemove(name)
+		if err != nil {
+			return err
+		}
+	}
+	return conn.Platforms().RemoveId(name)
+}
+
 type InvalidPlatformError struct{}
 
 func (InvalidPlatformError) Error() string {
@@ -5,25 +5,44 @@
 package app
 
 import (
+	"bytes"
+	"errors"
 	"github.com/globocom/config"
 	"github.com/globocom/tsuru/db"
+	"github.com/globocom/tsuru/provision"
+	ttesting "github.com/globocom/tsuru/testing"
+	"labix.org/v2/mgo/bson"
 	"launchpad.net/gocheck"
 )
 
-type PlatformSuite struct{}
+type PlatformSuite struct {
+	conn        *db.Storage
+	provisioner *ttesting.FakeProvisioner
+	old         provision.Provisioner
+}
 
 var _ = gocheck.Suite(&PlatformSuite{})
 
 func (s *PlatformSuite) SetUpSuite(c *gocheck.C) {
 	config.Set("database:url", "127.0.0.1:27017")
 	config.Set("database:name", "platform_tests")
+	var err error
+	s.conn, err = db.Conn()
+	c.Assert(err, gocheck.IsNil)
+	s.provisioner = ttesting.NewFakeProvisioner()
+	s.old = Provisioner
+	Provisioner = s.provisioner
 }
 
 func (s *PlatformSuite) TearDownSuite(c *gocheck.C) {
-	conn, err := db.Conn()
-	c.Assert(err, gocheck.IsNil)
-	conn.Apps().Database.DropDatabase()
-	conn.Close()
+	Provisioner = s.old
+	s.conn.Apps().Database.DropDatabase()
+	s.conn.Close()
+}
+
+func (s *PlatformSuite) TearDownTest(c *gocheck.C) {
+	s.provisioner.Reset()
+	s.conn.Platforms().RemoveAll(nil)
 }
 
 func (s *PlatformSuite) TestPlatforms(c *gocheck.C) {
@@ -59,11 +78,137 @@ func (s *PlatformSuite) TestGetPlatform(c *gocheck.C) {
 	p := Platform{Name: "dea"}
 	conn.Platforms().Insert(p)
 	defer conn.Platforms().Remove(p)
-	got, err := getPlatform(p.Name)
+	got, err := GetPlatform(p.Name)
 	c.Assert(err, gocheck.IsNil)
 	c.Assert(*got, gocheck.DeepEquals, p)
-	got, err = getPlatform("WAT")
+	got, err = GetPlatform("WAT")
 	c.Assert(got, gocheck.IsNil)
 	_, ok := err.(InvalidPlatformError)
 	c.Assert(ok, gocheck.Equals, true)
 }
+
+func (s *PlatformSuite) TestPlatformCharmName(c *gocheck.C) {
+	p := Platform{Name: "python"}
+	c.Assert(p.CharmName(), gocheck.Equals, "python")
+	p.Charm = "python-django"
+	c.Assert(p.CharmName(), gocheck.Equals, "python-django")
+}
+
+func (s *PlatformSuite) TestPlatformAdd(c *gocheck.C) {
+	var buf bytes.Buffer
+	p := Platform{Name: "python", Dockerfile: "http://example.com/python/Dockerfile", Charm: "python"}
+	err := PlatformAdd(p, &buf)
+	c.Assert(err, gocheck.IsNil)
+	got, err := GetPlatform("python")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(*got, gocheck.DeepEquals, p)
+	args, ok := s.provisioner.Platform("python")
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(args, gocheck.DeepEquals, map[string]string{"dockerfile": p.Dockerfile, "image": ""})
+	c.Assert(buf.String(), gocheck.Equals, "PlatformAdd called")
+}
+
+func (s *PlatformSuite) TestPlatformAddWithoutName(c *gocheck.C) {
+	err := PlatformAdd(Platform{Image: "tsuru/python"}, nil)
+	c.Assert(err, gocheck.Equals, ErrPlatformNameMissing)
+}
+
+func (s *PlatformSuite) TestPlatformAddWithDockerfileAndImage(c *gocheck.C) {
+	p := Platform{Name: "python", Dockerfile: "http://example.com/Dockerfile", Image: "tsuru/python"}
+	err := PlatformAdd(p, nil)
+	c.Assert(err, gocheck.Equals, ErrPlatformSource)
+}
+
+func (s *PlatformSuite) TestPlatformAddDuplicate(c *gocheck.C) {
+	var buf bytes.Buffer
+	err := s.conn.Platforms().Insert(Platform{Name: "python"})
+	c.Assert(err, gocheck.IsNil)
+	err = PlatformAdd(Platform{Name: "python", Image: "tsuru/python"}, &buf)
+	c.Assert(err, gocheck.Equals, ErrDuplicatePlatform)
+	_, ok := s.provisioner.Platform("python")
+	c.Assert(ok, gocheck.Equals, false)
+}
+
+func (s *PlatformSuite) TestPlatformAddProvisionerFailure(c *gocheck.C) {
+	var buf bytes.Buffer
+	s.provisioner.PrepareFailure("PlatformAdd", errors.New("build failed"))
+	err := PlatformAdd(Platform{Name: "python", Image: "tsuru/python"}, &buf)
+	c.Assert(err, gocheck.ErrorMatches, "build failed")
+	_, err = GetPlatform("python")
+	c.Assert(err, gocheck.FitsTypeOf, InvalidPlatformError{})
+}
+
+func (s *PlatformSuite) TestPlatformUpdate(c *gocheck.C) {
+	var buf bytes.Buffer
+	err := PlatformAdd(Platform{Name: "python", Dockerfile: "http://example.com/Dockerfile", Charm: "python"}, &buf)
+	c.Assert(err, gocheck.IsNil)
+	buf.Reset()
+	err = PlatformUpdate(Platform{Name: "python", Image: "tsuru/python"}, &buf)
+	c.Assert(err, gocheck.IsNil)
+	got, err := GetPlatform("python")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(*got, gocheck.DeepEquals, Platform{Name: "python", Image: "tsuru/python", Charm: "python"})
+	args, ok := s.provisioner.Platform("python")
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(args, gocheck.DeepEquals, map[string]string{"dockerfile": "", "image": "tsuru/python"})
+	c.Assert(buf.String(), gocheck.Equals, "PlatformUpdate called")
+}
+
+func (s *PlatformSuite) TestPlatformUpdateKeepsTheSourceWhenNotProvided(c *gocheck.C) {
+	var buf bytes.Buffer
+	err := PlatformAdd(Platform{Name: "python", Image: "tsuru/python"}, &buf)
+	c.Assert(err, gocheck.IsNil)
+	err = PlatformUpdate(Platform{Name: "python", Charm: "python-django"}, &buf)
+	c.Assert(err, gocheck.IsNil)
+	got, err := GetPlatform("python")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(*got, gocheck.DeepEquals, Platform{Name: "python", Image: "tsuru/python", Charm: "python-django"})
+	args, _ := s.provisioner.Platform("python")
+	c.Assert(args["image"], gocheck.Equals, "tsuru/python")
+}
+
+func (s *PlatformSuite) TestPlatformUpdateProvisionerFailure(c *gocheck.C) {
+	var buf bytes.Buffer
+	err := PlatformAdd(Platform{Name: "python", Image: "tsuru/python"}, &buf)
+	c.Assert(err, gocheck.IsNil)
+	s.provisioner.PrepareFailure("PlatformUpdate", errors.New("build failed"))
+	err = PlatformUpdate(Platform{Name: "python", Dockerfile: "http://example.com/Dockerfile"}, &buf)
+	c.Assert(err, gocheck.ErrorMatches, "build failed")
+	got, err := GetPlatform("python")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(*got, gocheck.DeepEquals, Platform{Name: "python", Image: "tsuru/python"})
+}
+
+func (s *PlatformSuite) TestPlatformUpdateNotFound(c *gocheck.C) {
+	err := PlatformUpdate(Platform{Name: "python", Image: "tsuru/python"}, nil)
+	c.Assert(err, gocheck.FitsTypeOf, InvalidPlatformError{})
+}
+
+func (s *PlatformSuite) TestPlatformRemove(c *gocheck.C) {
+	var buf bytes.Buffer
+	err := PlatformAdd(Platform{Name: "python", Image: "tsuru/python"}, &buf)
+	c.Assert(err, gocheck.IsNil)
+	err = PlatformRemove("python")
+	c.Assert(err, gocheck.IsNil)
+	_, err = GetPlatform("python")
+	c.Assert(err, gocheck.FitsTypeOf, InvalidPlatformError{})
+	_, ok := s.provisioner.Platform("python")
+	c.Assert(ok, gocheck.Equals, false)
+}
+
+func (s *PlatformSuite) TestPlatformRemoveNotFound(c *gocheck.C) {
+	err := PlatformRemove("python")
+	c.Assert(err, gocheck.FitsTypeOf, InvalidPlatformError{})
+}
+
+func (s *PlatformSuite) TestPlatformRemoveInUse(c *gocheck.C) {
+	err := s.conn.Platforms().Insert(Platform{Name: "python"})
+	c.Assert(err, gocheck.IsNil)
+	err = s.conn.Apps().Insert(App{Name: "myapp", Platform: "python"})
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": "myapp"})
+	err = PlatformRemove("python")
+	c.Assert(err, gocheck.Equals, ErrPlatformInUse)
+	_, err = GetPlatform("python")
+	c.Assert(err, gocheck.IsNil)
+}
@@ -0,0 +1,121 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"fmt"
+	"github.com/globocom/tsuru/auth"
+	"github.com/globocom/tsuru/db"
+	"github.com/globocom/tsuru/errors"
+	"github.com/globocom/tsuru/provision"
+	"labix.org/v2/mgo/bson"
+)
+
+func poolManager() (provision.PoolManager, error) {
+	if m, ok := Provisioner.(provision.PoolManager); ok {
+		return m, nil
+	}
+	return nil, ErrPoolsNotSupported
+}
+
+// validatePool checks that the pool chosen for the app exists and that the
+// app may use it: the default pool is available to all apps, and the other
+// pools to the apps of their teams.
+func (app *App) validatePool() error {
+	if app.Pool == "" {
+		return nil
+	}
+	m, err := poolManager()
+	if err != nil {
+		return &errors.ValidationError{Message: err.Error()}
+	}
+	pools, err := m.ListPools()
+	if err != nil {
+		return err
+	}
+	for _, p := range pools {
+		if p.Name != app.Pool {
+			continue
+		}
+		if p.Default {
+			return nil
+		}
+		for _, team := range p.Teams {
+			if _, found := app.find(&auth.Team{Name: team}); found {
+				return nil
+			}
+		}
+		msg := fmt.Sprintf("None of the teams of the app can use the pool %q.", app.Pool)
+		return &errors.ValidationError{Message: msg}
+	}
+	return &errors.ValidationError{Message: fmt.Sprintf("Pool %q not found.", app.Pool)}
+}
+
+// AddPool adds a pool to the provisioner, if it supports pools.
+func AddPool(p provision.Pool) error {
+	if p.Name == "" {
+		return ErrInvalidPool
+	}
+	m, err := poolManager()
+	if err != nil {
+		return err
+	}
+	return m.AddPool(p)
+}
+
+// RemovePool removes a pool from the provisioner. Pools chosen by apps can't
+// be removed.
+func RemovePool(name string) error {
+	m, err := poolManager()
+	if err != nil {
+		return err
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	n, err := conn.Apps().Find(bson.M{"pool": name}).Count()
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		return ErrPoolInUse
+	}
+	return m.RemovePool(name)
+}
+
+// ListPools returns the pools of the provisioner, if it supports pools.
+func ListPools() ([]provision.Pool, error) {
+	m, err := poolManager()
+	if err != nil {
+		return nil, err
+	}
+	return m.ListPools()
+}
+
+// AddTeamsToPool assigns the pool to the given teams.
+func AddTeamsToPool(pool string, teams []string) error {
+	if len(teams) == 0 {
+		return ErrNoPoolTeams
+	}
+	m, err := poolManager()
+	if err != nil {
+		return err
+	}
+	return m.AddTeamsToPool(pool, teams)
+}
+
+// RemoveTeamsFromPool removes the given teams from the pool.
+func RemoveTeamsFromPool(pool string, teams []string) error {
+	if len(teams) == 0 {
+		return ErrNoPoolTeams
+	}
+	m, err := poolManager()
+	if err != nil {
+		return err
+	}
+	return m.RemoveTeamsFromPool(pool, teams)
+}
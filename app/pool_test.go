@@ -0,0 +1,89 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"github.com/globocom/tsuru/errors"
+	"github.com/globocom/tsuru/provision"
+	"labix.org/v2/mgo/bson"
+	"launchpad.net/gocheck"
+)
+
+func (s *S) TestValidatePool(c *gocheck.C) {
+	s.provisioner.AddPool(provision.Pool{Name: "staging", Teams: []string{"ops", s.team.Name}})
+	s.provisioner.AddPool(provision.Pool{Name: "shared", Default: true})
+	a := App{Name: "myapp", Teams: []string{s.team.Name}}
+	c.Assert(a.validatePool(), gocheck.IsNil)
+	a.Pool = "staging"
+	c.Assert(a.validatePool(), gocheck.IsNil)
+	a.Pool = "shared"
+	c.Assert(a.validatePool(), gocheck.IsNil)
+}
+
+func (s *S) TestValidatePoolOfOtherTeams(c *gocheck.C) {
+	s.provisioner.AddPool(provision.Pool{Name: "production", Teams: []string{"ops"}})
+	a := App{Name: "myapp", Teams: []string{s.team.Name}, Pool: "production"}
+	err := a.validatePool()
+	e, ok := err.(*errors.ValidationError)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Message, gocheck.Equals, `None of the teams of the app can use the pool "production".`)
+}
+
+func (s *S) TestCantCreateAppWithUnknownPool(c *gocheck.C) {
+	a := App{Name: "myapp", Platform: "python", Pool: "staging"}
+	err := CreateApp(&a, s.user)
+	e, ok := err.(*errors.ValidationError)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Message, gocheck.Equals, `Pool "staging" not found.`)
+	count, err := s.conn.Apps().Find(bson.M{"name": a.Name}).Count()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(count, gocheck.Equals, 0)
+}
+
+func (s *S) TestAddPool(c *gocheck.C) {
+	err := AddPool(provision.Pool{Name: "staging", Teams: []string{"ops"}})
+	c.Assert(err, gocheck.IsNil)
+	pools, err := ListPools()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(pools, gocheck.DeepEquals, []provision.Pool{{Name: "staging", Teams: []string{"ops"}}})
+	err = AddPool(provision.Pool{})
+	c.Assert(err, gocheck.Equals, ErrInvalidPool)
+}
+
+func (s *S) TestRemovePoolInUse(c *gocheck.C) {
+	s.provisioner.AddPool(provision.Pool{Name: "staging"})
+	a := App{Name: "myapp", Pool: "staging"}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	err = RemovePool("staging")
+	c.Assert(err, gocheck.Equals, ErrPoolInUse)
+	s.conn.Apps().Remove(bson.M{"name": a.Name})
+	err = RemovePool("staging")
+	c.Assert(err, gocheck.IsNil)
+}
+
+func (s *S) TestPoolTeamsRequired(c *gocheck.C) {
+	err := AddTeamsToPool("staging", nil)
+	c.Assert(err, gocheck.Equals, ErrNoPoolTeams)
+	err = RemoveTeamsFromPool("staging", []string{})
+	c.Assert(err, gocheck.Equals, ErrNoPoolTeams)
+}
+
+func (s *S) TestPoolsNotSupported(c *gocheck.C) {
+	Provisioner = unmanagedProvisioner{s.provisioner}
+	defer func() {
+		Provisioner = s.provisioner
+	}()
+	_, err := ListPools()
+	c.Assert(err, gocheck.Equals, ErrPoolsNotSupported)
+	err = AddPool(provision.Pool{Name: "staging"})
+	c.Assert(err, gocheck.Equals, ErrPoolsNotSupported)
+	a := App{Name: "myapp", Pool: "staging"}
+	err = a.validatePool()
+	e, ok := err.(*errors.ValidationError)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Message, gocheck.Equals, ErrPoolsNotSupported.Error())
+}
@@ -15,6 +15,7 @@ import (
 	"io/ioutil"
 	"labix.org/v2/mgo/bson"
 	"sync"
+	"time"
 )
 
 const (
@@ -27,6 +28,15 @@ const (
 	queueName = "tsuru-app"
 )
 
+func init() {
+	// Messages that wait for the units of the app to start are retried for
+	// about half an hour before going to the dead-letter queue.
+	waitUnits := queue.RetryPolicy{MaxRetries: 35, Backoff: time.Second, MaxBackoff: time.Minute}
+	queue.SetRetryPolicy(regenerateApprc, waitUnits)
+	queue.SetRetryPolicy(RegenerateApprcAndStart, waitUnits)
+	queue.SetRetryPolicy(startApp, waitUnits)
+}
+
 // ensureAppIsStarted make sure that the app and all units present in the given
 // message are started.
 func ensureAppIsStarted(msg *queue.Message) (App, error) {
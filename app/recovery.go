@@ -0,0 +1,159 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"errors"
+	"github.com/globocom/tsuru/action"
+	"github.com/globocom/tsuru/auth"
+	"labix.org/v2/mgo/bson"
+	"launchpad.net/goamz/aws"
+	"launchpad.net/goamz/iam"
+)
+
+// createAppPipeline is the name of the persistent pipeline executed by
+// CreateApp. Unfinished app creations are rolled back on startup, so the
+// stored results keep only what the backward phases need: secret keys are
+// never stored.
+const createAppPipeline = "create-app"
+
+func init() {
+	reserveUserApp.DecodeResult = decodeStringMap
+	insertApp.DecodeResult = decodeApp
+	createIAMUserAction.DecodeResult = decodeIAMUser
+	createIAMAccessKeyAction.EncodeResult = encodeIAMAccessKey
+	createIAMAccessKeyAction.DecodeResult = decodeIAMAccessKey
+	createBucketAction.EncodeResult = encodeS3Env
+	createBucketAction.DecodeResult = decodeS3Env
+	createUserPolicyAction.EncodeResult = encodeS3Env
+	createUserPolicyAction.DecodeResult = decodeS3Env
+	// The backward phase of exportEnvironmentsAction doesn't use the
+	// result, which may contain the S3 credentials.
+	exportEnvironmentsAction.EncodeResult = func(action.Result) (interface{}, error) {
+		return nil, nil
+	}
+	createRepository.DecodeResult = decodeApp
+	provisionApp.DecodeResult = decodeApp
+	action.RegisterRecovery(createAppPipeline, &action.Recovery{
+		Actions: []*action.Action{
+			&reserveUserApp, &createAppQuota, &insertApp,
+			&createIAMUserAction, &createIAMAccessKeyAction,
+			&createBucketAction, &createUserPolicyAction,
+			&exportEnvironmentsAction, &createRepository, &provisionApp,
+		},
+		EncodeParams: encodeCreateAppParams,
+		DecodeParams: decodeCreateAppParams,
+	})
+}
+
+// createAppParams is the stored version of the parameters of CreateApp.
+type createAppParams struct {
+	App  App
+	User string
+}
+
+func encodeCreateAppParams(params []interface{}) (interface{}, error) {
+	if len(params) < 2 {
+		return nil, errors.New("CreateApp takes the app and the user as parameters.")
+	}
+	app, ok := params[0].(*App)
+	if !ok {
+		return nil, errors.New("First parameter must be *App.")
+	}
+	user, ok := params[1].(*auth.User)
+	if !ok {
+		return nil, errors.New("Second parameter must be *auth.User.")
+	}
+	return createAppParams{App: *app, User: user.Email}, nil
+}
+
+func decodeCreateAppParams(raw bson.Raw) ([]interface{}, error) {
+	var p createAppParams
+	if err := raw.Unmarshal(&p); err != nil {
+		return nil, err
+	}
+	user, err := auth.GetUserByEmail(p.User)
+	if err != nil {
+		return nil, err
+	}
+	return []interface{}{&p.App, user}, nil
+}
+
+func decodeStringMap(raw bson.Raw) (action.Result, error) {
+	var m map[string]string
+	err := raw.Unmarshal(&m)
+	return m, err
+}
+
+func decodeApp(raw bson.Raw) (action.Result, error) {
+	var app App
+	err := raw.Unmarshal(&app)
+	return &app, err
+}
+
+func decodeIAMUser(raw bson.Raw) (action.Result, error) {
+	var user iam.User
+	err := raw.Unmarshal(&user)
+	return &user, err
+}
+
+// storedIAMAccessKey is the stored version of iam.AccessKey, without the
+// secret.
+type storedIAMAccessKey struct {
+	Id       string
+	UserName string
+}
+
+func encodeIAMAccessKey(r action.Result) (interface{}, error) {
+	key, ok := r.(*iam.AccessKey)
+	if !ok {
+		return nil, errors.New("Result must be *iam.AccessKey.")
+	}
+	return storedIAMAccessKey{Id: key.Id, UserName: key.UserName}, nil
+}
+
+func decodeIAMAccessKey(raw bson.Raw) (action.Result, error) {
+	var s storedIAMAccessKey
+	if err := raw.Unmarshal(&s); err != nil {
+		return nil, err
+	}
+	return &iam.AccessKey{Id: s.Id, UserName: s.UserName}, nil
+}
+
+// storedS3Env is the stored version of s3Env, whose fields are unexported.
+// The secret key is not stored.
+type storedS3Env struct {
+	AccessKey          string
+	Bucket             string
+	Endpoint           string
+	LocationConstraint bool
+}
+
+func encodeS3Env(r action.Result) (interface{}, error) {
+	env, ok := r.(*s3Env)
+	if !ok {
+		return nil, errors.New("Result must be *s3Env.")
+	}
+	return storedS3Env{
+		AccessKey:          env.AccessKey,
+		Bucket:             env.bucket,
+		Endpoint:           env.endpoint,
+		LocationConstraint: env.locationConstraint,
+	}, nil
+}
+
+func decodeS3Env(raw bson.Raw) (action.Result, error) {
+	var s storedS3Env
+	if err := raw.Unmarshal(&s); err != nil {
+		return nil, err
+	}
+	env := s3Env{
+		Auth:               aws.Auth{AccessKey: s.AccessKey},
+		bucket:             s.Bucket,
+		endpoint:           s.Endpoint,
+		locationConstraint: s.LocationConstraint,
+	}
+	return &env, nil
+}
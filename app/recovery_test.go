@@ -0,0 +1,76 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"github.com/globocom/tsuru/auth"
+	"labix.org/v2/mgo/bson"
+	"launchpad.net/goamz/aws"
+	"launchpad.net/goamz/iam"
+	"launchpad.net/gocheck"
+	"strings"
+)
+
+func (s *S) TestCreateAppParamsCodec(c *gocheck.C) {
+	a := App{Name: "recovered", Platform: "python", Teams: []string{s.team.Name}}
+	encoded, err := encodeCreateAppParams([]interface{}{&a, s.user})
+	c.Assert(err, gocheck.IsNil)
+	data, err := bson.Marshal(encoded)
+	c.Assert(err, gocheck.IsNil)
+	params, err := decodeCreateAppParams(bson.Raw{Kind: 3, Data: data})
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(params, gocheck.HasLen, 2)
+	c.Assert(params[0].(*App).Name, gocheck.Equals, a.Name)
+	c.Assert(params[0].(*App).Platform, gocheck.Equals, a.Platform)
+	c.Assert(params[0].(*App).Teams, gocheck.DeepEquals, a.Teams)
+	c.Assert(params[1].(*auth.User).Email, gocheck.Equals, s.user.Email)
+}
+
+func (s *S) TestEncodeCreateAppParamsInvalidParams(c *gocheck.C) {
+	_, err := encodeCreateAppParams([]interface{}{App{Name: "recovered"}, s.user})
+	c.Assert(err, gocheck.NotNil)
+}
+
+func (s *S) TestS3EnvCodec(c *gocheck.C) {
+	env := s3Env{
+		Auth:               aws.Auth{AccessKey: "access", SecretKey: "secret"},
+		bucket:             "mybucket",
+		endpoint:           "https://s3.amazonaws.com",
+		locationConstraint: true,
+	}
+	encoded, err := encodeS3Env(&env)
+	c.Assert(err, gocheck.IsNil)
+	data, err := bson.Marshal(encoded)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(strings.Contains(string(data), "secret"), gocheck.Equals, false)
+	r, err := decodeS3Env(bson.Raw{Kind: 3, Data: data})
+	c.Assert(err, gocheck.IsNil)
+	env.SecretKey = ""
+	c.Assert(r, gocheck.DeepEquals, &env)
+}
+
+func (s *S) TestIAMAccessKeyCodecDoesNotStoreTheSecret(c *gocheck.C) {
+	key := iam.AccessKey{Id: "access", Secret: "secret", UserName: "myapp", Status: "Active"}
+	encoded, err := encodeIAMAccessKey(&key)
+	c.Assert(err, gocheck.IsNil)
+	data, err := bson.Marshal(encoded)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(strings.Contains(string(data), "secret"), gocheck.Equals, false)
+	r, err := decodeIAMAccessKey(bson.Raw{Kind: 3, Data: data})
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(r, gocheck.DeepEquals, &iam.AccessKey{Id: "access", UserName: "myapp"})
+}
+
+func (s *S) TestCreateAppRemovesThePipelineRecord(c *gocheck.C) {
+	ts := s.t.StartGandalfTestServer(&testHandler{})
+	defer ts.Close()
+	a := App{Name: "pipelined", Platform: "python"}
+	err := CreateApp(&a, s.user)
+	c.Assert(err, gocheck.IsNil)
+	defer ForceDestroy(&a)
+	count, err := s.conn.Pipelines().Find(bson.M{"name": createAppPipeline}).Count()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(count, gocheck.Equals, 0)
+}
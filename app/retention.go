@@ -0,0 +1,167 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"errors"
+	"github.com/globocom/config"
+	"github.com/globocom/tsuru/db"
+	"github.com/globocom/tsuru/log"
+	"labix.org/v2/mgo"
+	"labix.org/v2/mgo/bson"
+	"time"
+)
+
+var (
+	ErrInvalidLogMaxAge     = errors.New("Invalid max age: it must be a positive duration, like 720h.")
+	ErrInvalidLogMaxEntries = errors.New("Invalid max entries: it must not be negative.")
+)
+
+// LogRetention defines which logs of an app are kept in the database. Logs
+// older than MaxAge, a duration like "720h", and logs beyond the most recent
+// MaxEntries are removed by CleanLogs. Empty fields mean no limit.
+//
+// The empty fields of the retention of an app fall back to the global
+// retention, unless NoDefaults is set.
+type LogRetention struct {
+	MaxAge     string `bson:",omitempty" json:",omitempty"`
+	MaxEntries int    `bson:",omitempty" json:",omitempty"`
+	NoDefaults bool   `bson:",omitempty" json:",omitempty"`
+}
+
+func (r *LogRetention) validate() error {
+	if r.MaxAge != "" {
+		if d, err := time.ParseDuration(r.MaxAge); err != nil || d <= 0 {
+			return ErrInvalidLogMaxAge
+		}
+	}
+	if r.MaxEntries < 0 {
+		return ErrInvalidLogMaxEntries
+	}
+	return nil
+}
+
+func (r *LogRetention) maxAge() time.Duration {
+	d, _ := time.ParseDuration(r.MaxAge)
+	return d
+}
+
+// merge returns the retention with the empty fields of r taken from the
+// other retention. Retentions with NoDefaults are returned unchanged.
+func (r LogRetention) merge(other LogRetention) LogRetention {
+	if r.NoDefaults {
+		return r
+	}
+	if r.MaxAge == "" {
+		r.MaxAge = other.MaxAge
+	}
+	if r.MaxEntries == 0 {
+		r.MaxEntries = other.MaxEntries
+	}
+	return r
+}
+
+// DefaultLogRetention returns the global retention of logs, defined by the
+// settings app-log:retention:max-age and app-log:retention:max-entries.
+func DefaultLogRetention() (LogRetention, error) {
+	var r LogRetention
+	r.MaxAge, _ = config.GetString("app-log:retention:max-age")
+	r.MaxEntries, _ = config.GetInt("app-log:retention:max-entries")
+	return r, r.validate()
+}
+
+// SetLogRetention overrides the global retention of logs for the app. Empty
+// fields fall back to the global retention.
+func (app *App) SetLogRetention(r LogRetention) error {
+	if err := r.validate(); err != nil {
+		return err
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	app.LogRetention = r
+	return conn.Apps().Update(
+		bson.M{"name": app.Name},
+		bson.M{"$set": bson.M{"logretention": app.LogRetention}},
+	)
+}
+
+// CleanLogs removes the logs that are beyond the retention of each app,
+// including the logs of removed apps, that follow the global retention.
+func CleanLogs() error {
+	defaults, err := DefaultLogRetention()
+	if err != nil {
+		return err
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	var names []string
+	err = conn.Logs().Find(nil).Distinct("appname", &names)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		var a App
+		err := conn.Apps().Find(bson.M{"name": name}).Select(bson.M{"logretention": 1}).One(&a)
+		if err != nil && err != mgo.ErrNotFound {
+			return err
+		}
+		retention := a.LogRetention.merge(defaults)
+		if err := cleanAppLogs(conn, name, retention); err != nil {
+			log.Printf("Failed to clean the logs of %s: %s", name, err)
+		}
+	}
+	return nil
+}
+
+func cleanAppLogs(conn *db.Storage, appName string, r LogRetention) error {
+	if maxAge := r.maxAge(); maxAge > 0 {
+		limit := time.Now().In(time.UTC).Add(-maxAge)
+		_, err := conn.Logs().RemoveAll(bson.M{"appname": appName, "date": bson.M{"$lt": limit}})
+		if err != nil {
+			return err
+		}
+	}
+	if r.MaxEntries > 0 {
+		// Logs are ordered by date and then by id, so logs that share the
+		// date of the boundary are removed only when they come before it.
+		var last struct {
+			ID   bson.ObjectId `bson:"_id"`
+			Date time.Time
+		}
+		err := conn.Logs().Find(bson.M{"appname": appName}).Sort("-date", "-_id").Skip(r.MaxEntries).Select(bson.M{"_id": 1, "date": 1}).One(&last)
+		if err == mgo.ErrNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		_, err = conn.Logs().RemoveAll(bson.M{
+			"appname": appName,
+			"$or": []bson.M{
+				{"date": bson.M{"$lt": last.Date}},
+				{"date": last.Date, "_id": bson.M{"$lte": last.ID}},
+			},
+		})
+		return err
+	}
+	return nil
+}
+
+// RunLogJanitor cleans the logs of apps on each tick, until the channel is
+// closed.
+func RunLogJanitor(ticker <-chan time.Time) {
+	for _ = range ticker {
+		log.Print("Cleaning app logs")
+		if err := CleanLogs(); err != nil {
+			log.Printf("Failed to clean app logs: %s", err)
+		}
+	}
+}
@@ -0,0 +1,182 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"github.com/globocom/config"
+	"labix.org/v2/mgo/bson"
+	"launchpad.net/gocheck"
+	"strconv"
+	"time"
+)
+
+// insertLogs inserts n logs of the app, one per hour, the last one an hour
+// ago.
+func (s *S) insertLogs(c *gocheck.C, appName string, n int) {
+	now := time.Now().In(time.UTC)
+	for i := 0; i < n; i++ {
+		l := Applog{
+			Date:    now.Add(time.Duration(i-n) * time.Hour),
+			Message: strconv.Itoa(i),
+			Source:  "app",
+			AppName: appName,
+		}
+		err := s.conn.Logs().Insert(l)
+		c.Assert(err, gocheck.IsNil)
+	}
+}
+
+func (s *S) logMessages(c *gocheck.C, appName string) []string {
+	var logs []Applog
+	err := s.conn.Logs().Find(bson.M{"appname": appName}).Sort("date").All(&logs)
+	c.Assert(err, gocheck.IsNil)
+	messages := make([]string, len(logs))
+	for i, l := range logs {
+		messages[i] = l.Message
+	}
+	return messages
+}
+
+func (s *S) TestDefaultLogRetention(c *gocheck.C) {
+	config.Set("app-log:retention:max-age", "720h")
+	defer config.Unset("app-log:retention:max-age")
+	config.Set("app-log:retention:max-entries", 5000)
+	defer config.Unset("app-log:retention:max-entries")
+	r, err := DefaultLogRetention()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(r, gocheck.DeepEquals, LogRetention{MaxAge: "720h", MaxEntries: 5000})
+}
+
+func (s *S) TestDefaultLogRetentionNotDefined(c *gocheck.C) {
+	r, err := DefaultLogRetention()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(r, gocheck.DeepEquals, LogRetention{})
+}
+
+func (s *S) TestDefaultLogRetentionInvalid(c *gocheck.C) {
+	config.Set("app-log:retention:max-age", "-1h")
+	defer config.Unset("app-log:retention:max-age")
+	_, err := DefaultLogRetention()
+	c.Assert(err, gocheck.Equals, ErrInvalidLogMaxAge)
+}
+
+func (s *S) TestSetLogRetention(c *gocheck.C) {
+	a := App{Name: "forgetful"}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	err = a.SetLogRetention(LogRetention{MaxAge: "24h", MaxEntries: 100})
+	c.Assert(err, gocheck.IsNil)
+	var stored App
+	err = s.conn.Apps().Find(bson.M{"name": a.Name}).One(&stored)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(stored.LogRetention, gocheck.DeepEquals, LogRetention{MaxAge: "24h", MaxEntries: 100})
+}
+
+func (s *S) TestSetLogRetentionInvalid(c *gocheck.C) {
+	a := App{Name: "forgetful"}
+	err := a.SetLogRetention(LogRetention{MaxAge: "one day"})
+	c.Assert(err, gocheck.Equals, ErrInvalidLogMaxAge)
+	err = a.SetLogRetention(LogRetention{MaxEntries: -1})
+	c.Assert(err, gocheck.Equals, ErrInvalidLogMaxEntries)
+}
+
+func (s *S) TestCleanLogsByMaxAge(c *gocheck.C) {
+	config.Set("app-log:retention:max-age", "150m")
+	defer config.Unset("app-log:retention:max-age")
+	defer s.conn.Logs().RemoveAll(bson.M{"appname": "forgetful"})
+	s.insertLogs(c, "forgetful", 5)
+	err := CleanLogs()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(s.logMessages(c, "forgetful"), gocheck.DeepEquals, []string{"3", "4"})
+}
+
+func (s *S) TestCleanLogsByMaxEntries(c *gocheck.C) {
+	config.Set("app-log:retention:max-entries", 3)
+	defer config.Unset("app-log:retention:max-entries")
+	defer s.conn.Logs().RemoveAll(bson.M{"appname": "forgetful"})
+	s.insertLogs(c, "forgetful", 5)
+	err := CleanLogs()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(s.logMessages(c, "forgetful"), gocheck.DeepEquals, []string{"2", "3", "4"})
+}
+
+func (s *S) TestCleanLogsWithAppRetention(c *gocheck.C) {
+	config.Set("app-log:retention:max-entries", 3)
+	defer config.Unset("app-log:retention:max-entries")
+	a := App{Name: "forgetful", LogRetention: LogRetention{MaxEntries: 1}}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	defer s.conn.Logs().RemoveAll(bson.M{"appname": a.Name})
+	defer s.conn.Logs().RemoveAll(bson.M{"appname": "mindful"})
+	s.insertLogs(c, a.Name, 5)
+	s.insertLogs(c, "mindful", 5)
+	err = CleanLogs()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(s.logMessages(c, a.Name), gocheck.DeepEquals, []string{"4"})
+	c.Assert(s.logMessages(c, "mindful"), gocheck.DeepEquals, []string{"2", "3", "4"})
+}
+
+func (s *S) TestCleanLogsByMaxEntriesWithLogsOfTheSameDate(c *gocheck.C) {
+	config.Set("app-log:retention:max-entries", 3)
+	defer config.Unset("app-log:retention:max-entries")
+	defer s.conn.Logs().RemoveAll(bson.M{"appname": "forgetful"})
+	date := time.Now().In(time.UTC).Add(-time.Hour)
+	for i := 0; i < 5; i++ {
+		l := Applog{Date: date, Message: strconv.Itoa(i), Source: "app", AppName: "forgetful"}
+		err := s.conn.Logs().Insert(l)
+		c.Assert(err, gocheck.IsNil)
+	}
+	err := CleanLogs()
+	c.Assert(err, gocheck.IsNil)
+	var logs []Applog
+	err = s.conn.Logs().Find(bson.M{"appname": "forgetful"}).Sort("_id").All(&logs)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(logs, gocheck.HasLen, 3)
+	c.Assert(logs[0].Message, gocheck.Equals, "2")
+	c.Assert(logs[2].Message, gocheck.Equals, "4")
+}
+
+func (s *S) TestCleanLogsWithAppRetentionWithoutDefaults(c *gocheck.C) {
+	config.Set("app-log:retention:max-age", "150m")
+	defer config.Unset("app-log:retention:max-age")
+	config.Set("app-log:retention:max-entries", 1)
+	defer config.Unset("app-log:retention:max-entries")
+	a := App{Name: "forgetful", LogRetention: LogRetention{MaxEntries: 4, NoDefaults: true}}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	defer s.conn.Logs().RemoveAll(bson.M{"appname": a.Name})
+	s.insertLogs(c, a.Name, 5)
+	err = CleanLogs()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(s.logMessages(c, a.Name), gocheck.DeepEquals, []string{"1", "2", "3", "4"})
+}
+
+func (s *S) TestCleanLogsWithoutRetention(c *gocheck.C) {
+	defer s.conn.Logs().RemoveAll(bson.M{"appname": "forgetful"})
+	s.insertLogs(c, "forgetful", 5)
+	err := CleanLogs()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(s.logMessages(c, "forgetful"), gocheck.HasLen, 5)
+}
+
+func (s *S) TestRunLogJanitor(c *gocheck.C) {
+	config.Set("app-log:retention:max-entries", 2)
+	defer config.Unset("app-log:retention:max-entries")
+	defer s.conn.Logs().RemoveAll(bson.M{"appname": "forgetful"})
+	s.insertLogs(c, "forgetful", 5)
+	ticker := make(chan time.Time)
+	done := make(chan bool)
+	go func() {
+		RunLogJanitor(ticker)
+		done <- true
+	}()
+	ticker <- time.Now()
+	close(ticker)
+	<-done
+	c.Assert(s.logMessages(c, "forgetful"), gocheck.DeepEquals, []string{"3", "4"})
+}
@@ -0,0 +1,141 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package auth
+
+import (
+	"crypto"
+	stderrors "errors"
+	"github.com/globocom/tsuru/db"
+	"labix.org/v2/mgo/bson"
+	"time"
+)
+
+// Scopes of API tokens. Read tokens can only read apps, deploy tokens can
+// also deploy, rollback and restart apps, and app tokens have the same
+// permissions of the user, but only over the listed apps.
+const (
+	TokenScopeRead   = "read"
+	TokenScopeDeploy = "deploy"
+	TokenScopeApp    = "app"
+)
+
+var tokenScopes = map[string][]Permission{
+	TokenScopeRead:   {PermAppRead},
+	TokenScopeDeploy: {PermAppRead, PermAppDeploy, PermAppRestart},
+}
+
+var (
+	ErrTokenNameMissing    = stderrors.New("You must provide the name of the token.")
+	ErrInvalidTokenScope   = stderrors.New("Invalid scope. The scope must be read, deploy or app.")
+	ErrTokenAppsMissing    = stderrors.New("You must provide the apps of the token.")
+	ErrTokenExpiresMissing = stderrors.New("You must provide the expiration of the token.")
+	ErrDuplicateToken      = stderrors.New("There is already a token with this name.")
+	ErrTokenNotFound       = stderrors.New("Token not found.")
+)
+
+// CreateAPIToken creates a named API token for the user, with the given
+// scope and expiration. Unlike session tokens, API tokens are not removed
+// when the user logs in.
+func (u *User) CreateAPIToken(name, scope string, apps []string, expires time.Duration) (*Token, error) {
+	if name == "" {
+		return nil, ErrTokenNameMissing
+	}
+	if _, ok := tokenScopes[scope]; !ok && scope != TokenScopeApp {
+		return nil, ErrInvalidTokenScope
+	}
+	if scope == TokenScopeApp && len(apps) == 0 {
+		return nil, ErrTokenAppsMissing
+	}
+	if expires <= 0 {
+		return nil, ErrTokenExpiresMissing
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	count, err := conn.Tokens().Find(bson.M{"useremail": u.Email, "name": name}).Count()
+	if err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, ErrDuplicateToken
+	}
+	t := Token{
+		Token:     token(u.Email+name, crypto.SHA1),
+		Creation:  time.Now(),
+		Expires:   expires,
+		UserEmail: u.Email,
+		Name:      name,
+		Scope:     scope,
+	}
+	if scope == TokenScopeApp {
+		t.Apps = apps
+	}
+	err = conn.Tokens().Insert(t)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// APITokens returns the API tokens of the user.
+func (u *User) APITokens() ([]Token, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	var tokens []Token
+	query := bson.M{"useremail": u.Email, "name": bson.M{"$exists": true}}
+	err = conn.Tokens().Find(query).Sort("name").All(&tokens)
+	return tokens, err
+}
+
+// RevokeAPIToken removes the API token of the user with the given name.
+func (u *User) RevokeAPIToken(name string) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	info, err := conn.Tokens().RemoveAll(bson.M{"useremail": u.Email, "name": name})
+	if err != nil {
+		return err
+	}
+	if info.Removed == 0 {
+		return ErrTokenNotFound
+	}
+	return nil
+}
+
+// IsScoped checks whether the token is an API token, whose access is limited
+// by its scope.
+func (t *Token) IsScoped() bool {
+	return t.Scope != ""
+}
+
+// Allows checks whether the scope of the token allows the given permission
+// over the app. Tokens without scope allow everything, the permissions of
+// the user are checked separately.
+func (t *Token) Allows(perm Permission, appName string) bool {
+	if !t.IsScoped() {
+		return true
+	}
+	if t.Scope == TokenScopeApp {
+		for _, a := range t.Apps {
+			if a == appName {
+				return true
+			}
+		}
+		return false
+	}
+	for _, p := range tokenScopes[t.Scope] {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,115 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package auth
+
+import (
+	"labix.org/v2/mgo/bson"
+	"launchpad.net/gocheck"
+	"time"
+)
+
+func (s *S) TestCreateAPIToken(c *gocheck.C) {
+	defer s.conn.Tokens().RemoveAll(bson.M{"useremail": s.user.Email, "name": "ci"})
+	t, err := s.user.CreateAPIToken("ci", TokenScopeDeploy, nil, 24*time.Hour)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(t.Name, gocheck.Equals, "ci")
+	c.Assert(t.Scope, gocheck.Equals, TokenScopeDeploy)
+	c.Assert(t.Expires, gocheck.Equals, 24*time.Hour)
+	c.Assert(t.UserEmail, gocheck.Equals, s.user.Email)
+	c.Assert(t.Token, gocheck.Not(gocheck.Equals), "")
+	got, err := GetToken("bearer " + t.Token)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(got.Name, gocheck.Equals, "ci")
+	c.Assert(got.Scope, gocheck.Equals, TokenScopeDeploy)
+}
+
+func (s *S) TestCreateAPITokenWithApps(c *gocheck.C) {
+	defer s.conn.Tokens().RemoveAll(bson.M{"useremail": s.user.Email, "name": "ci"})
+	t, err := s.user.CreateAPIToken("ci", TokenScopeApp, []string{"myapp", "otherapp"}, time.Hour)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(t.Apps, gocheck.DeepEquals, []string{"myapp", "otherapp"})
+	t, err = s.user.CreateAPIToken("reader", TokenScopeRead, []string{"myapp"}, time.Hour)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Tokens().RemoveAll(bson.M{"useremail": s.user.Email, "name": "reader"})
+	c.Assert(t.Apps, gocheck.IsNil)
+}
+
+func (s *S) TestCreateAPITokenValidation(c *gocheck.C) {
+	var tests = []struct {
+		name    string
+		scope   string
+		apps    []string
+		expires time.Duration
+		err     error
+	}{
+		{"", TokenScopeRead, nil, time.Hour, ErrTokenNameMissing},
+		{"ci", "write", nil, time.Hour, ErrInvalidTokenScope},
+		{"ci", "", nil, time.Hour, ErrInvalidTokenScope},
+		{"ci", TokenScopeApp, nil, time.Hour, ErrTokenAppsMissing},
+		{"ci", TokenScopeRead, nil, 0, ErrTokenExpiresMissing},
+	}
+	for _, t := range tests {
+		_, err := s.user.CreateAPIToken(t.name, t.scope, t.apps, t.expires)
+		c.Check(err, gocheck.Equals, t.err)
+	}
+}
+
+func (s *S) TestCreateAPITokenDuplicate(c *gocheck.C) {
+	defer s.conn.Tokens().RemoveAll(bson.M{"useremail": s.user.Email, "name": "ci"})
+	_, err := s.user.CreateAPIToken("ci", TokenScopeRead, nil, time.Hour)
+	c.Assert(err, gocheck.IsNil)
+	_, err = s.user.CreateAPIToken("ci", TokenScopeDeploy, nil, time.Hour)
+	c.Assert(err, gocheck.Equals, ErrDuplicateToken)
+}
+
+func (s *S) TestAPITokens(c *gocheck.C) {
+	defer s.conn.Tokens().RemoveAll(bson.M{"useremail": s.user.Email, "name": bson.M{"$exists": true}})
+	_, err := s.user.CreateAPIToken("reader", TokenScopeRead, nil, time.Hour)
+	c.Assert(err, gocheck.IsNil)
+	_, err = s.user.CreateAPIToken("ci", TokenScopeDeploy, nil, time.Hour)
+	c.Assert(err, gocheck.IsNil)
+	tokens, err := s.user.APITokens()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(tokens, gocheck.HasLen, 2)
+	c.Assert(tokens[0].Name, gocheck.Equals, "ci")
+	c.Assert(tokens[1].Name, gocheck.Equals, "reader")
+}
+
+func (s *S) TestRevokeAPIToken(c *gocheck.C) {
+	t, err := s.user.CreateAPIToken("ci", TokenScopeDeploy, nil, time.Hour)
+	c.Assert(err, gocheck.IsNil)
+	err = s.user.RevokeAPIToken("ci")
+	c.Assert(err, gocheck.IsNil)
+	_, err = GetToken("bearer " + t.Token)
+	c.Assert(err, gocheck.Equals, ErrInvalidToken)
+}
+
+func (s *S) TestRevokeAPITokenNotFound(c *gocheck.C) {
+	err := s.user.RevokeAPIToken("ci")
+	c.Assert(err, gocheck.Equals, ErrTokenNotFound)
+}
+
+func (s *S) TestTokenAllows(c *gocheck.C) {
+	var tests = []struct {
+		token    Token
+		perm     Permission
+		app      string
+		expected bool
+	}{
+		{Token{}, PermAppDelete, "myapp", true},
+		{Token{Scope: TokenScopeRead}, PermAppRead, "myapp", true},
+		{Token{Scope: TokenScopeRead}, PermAppRestart, "myapp", false},
+		{Token{Scope: TokenScopeDeploy}, PermAppDeploy, "myapp", true},
+		{Token{Scope: TokenScopeDeploy}, PermAppRestart, "myapp", true},
+		{Token{Scope: TokenScopeDeploy}, PermAppDelete, "myapp", false},
+		{Token{Scope: TokenScopeDeploy}, PermTeamAdmin, "", false},
+		{Token{Scope: TokenScopeApp, Apps: []string{"myapp"}}, PermAppDelete, "myapp", true},
+		{Token{Scope: TokenScopeApp, Apps: []string{"myapp"}}, PermAppRead, "otherapp", false},
+		{Token{Scope: TokenScopeApp, Apps: []string{"myapp"}}, PermTeamAdmin, "", false},
+	}
+	for _, t := range tests {
+		c.Check(t.token.Allows(t.perm, t.app), gocheck.Equals, t.expected)
+	}
+}
@@ -0,0 +1,92 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package auth
+
+import (
+	stderrors "errors"
+	"fmt"
+	"github.com/globocom/config"
+	"github.com/globocom/tsuru/errors"
+	"github.com/globocom/tsuru/log"
+	"github.com/mmitton/ldap"
+	"strings"
+)
+
+func init() {
+	RegisterScheme("ldap", ldapScheme{})
+}
+
+// ldapBinder binds to an LDAP server, checking the credentials of users.
+type ldapBinder interface {
+	Bind(server, dn, password string) error
+}
+
+type ldapClient struct{}
+
+func (ldapClient) Bind(server, dn, password string) error {
+	conn, err := ldap.Dial("tcp", server)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if err := conn.Bind(dn, password); err != nil {
+		return err
+	}
+	return nil
+}
+
+var binder ldapBinder = ldapClient{}
+
+// ldapScheme authenticates users against an LDAP server, binding with the
+// DN built from the "auth:ldap:user-dn" setting, in which %s is replaced by
+// the email of the user. Users are registered in their first login.
+type ldapScheme struct{}
+
+func (ldapScheme) Login(params map[string]string) (*Token, error) {
+	email, password := params["email"], params["password"]
+	if email == "" || password == "" {
+		return nil, &errors.ValidationError{Message: "You must provide the email and the password to login"}
+	}
+	server, err := config.GetString("auth:ldap:server")
+	if err != nil {
+		return nil, stderrors.New(`Setting "auth:ldap:server" is undefined.`)
+	}
+	userDN, err := config.GetString("auth:ldap:user-dn")
+	if err != nil {
+		return nil, stderrors.New(`Setting "auth:ldap:user-dn" is undefined.`)
+	}
+	dn := fmt.Sprintf(userDN, escapeDN(email))
+	if err := binder.Bind(server, dn, password); err != nil {
+		log.Printf("LDAP authentication of %q failed: %s", dn, err)
+		return nil, AuthenticationFailure{}
+	}
+	u, err := externalUser(email)
+	if err != nil {
+		return nil, err
+	}
+	return u.createSessionToken()
+}
+
+func (ldapScheme) Logout(token string) error {
+	return DeleteToken(token)
+}
+
+func (ldapScheme) Create(u *User) (*User, error) {
+	return nil, ErrCreateNotSupported
+}
+
+func (ldapScheme) Info() (SchemeInfo, error) {
+	return nil, nil
+}
+
+var dnReplacer = strings.NewReplacer(
+	`\`, `\\`, `,`, `\,`, `+`, `\+`, `"`, `\"`,
+	`<`, `\<`, `>`, `\>`, `;`, `\;`, `=`, `\=`,
+)
+
+// escapeDN escapes the special characters of a value used in a DN.
+func escapeDN(value string) string {
+	return dnReplacer.Replace(value)
+}
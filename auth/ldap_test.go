@@ -0,0 +1,84 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package auth
+
+import (
+	stderrors "errors"
+	"github.com/globocom/config"
+	"labix.org/v2/mgo/bson"
+	"launchpad.net/gocheck"
+)
+
+type fakeBinder struct {
+	server   string
+	dn       string
+	password string
+	err      error
+}
+
+func (b *fakeBinder) Bind(server, dn, password string) error {
+	b.server, b.dn, b.password = server, dn, password
+	return b.err
+}
+
+func (s *S) setUpLDAP(b *fakeBinder) func() {
+	config.Set("auth:ldap:server", "ldap.tsuru.io:389")
+	config.Set("auth:ldap:user-dn", "mail=%s,ou=people,dc=tsuru,dc=io")
+	old := binder
+	binder = b
+	return func() {
+		binder = old
+		config.Unset("auth:ldap:server")
+		config.Unset("auth:ldap:user-dn")
+	}
+}
+
+func (s *S) TestLDAPLogin(c *gocheck.C) {
+	var b fakeBinder
+	defer s.setUpLDAP(&b)()
+	t, err := ldapScheme{}.Login(map[string]string{"email": s.user.Email, "password": "secret"})
+	c.Assert(err, gocheck.IsNil)
+	defer DeleteToken(t.Token)
+	c.Assert(t.UserEmail, gocheck.Equals, s.user.Email)
+	c.Assert(b.server, gocheck.Equals, "ldap.tsuru.io:389")
+	c.Assert(b.dn, gocheck.Equals, "mail=timeredbull@globo.com,ou=people,dc=tsuru,dc=io")
+	c.Assert(b.password, gocheck.Equals, "secret")
+}
+
+func (s *S) TestLDAPLoginRegistersTheUser(c *gocheck.C) {
+	h := testHandler{}
+	ts := s.startGandalfTestServer(&h)
+	defer ts.Close()
+	var b fakeBinder
+	defer s.setUpLDAP(&b)()
+	defer s.conn.Users().Remove(bson.M{"email": "ldap@tsuru.io"})
+	t, err := ldapScheme{}.Login(map[string]string{"email": "ldap@tsuru.io", "password": "secret"})
+	c.Assert(err, gocheck.IsNil)
+	defer DeleteToken(t.Token)
+	_, err = GetUserByEmail("ldap@tsuru.io")
+	c.Assert(err, gocheck.IsNil)
+}
+
+func (s *S) TestLDAPLoginFailure(c *gocheck.C) {
+	b := fakeBinder{err: stderrors.New("invalid credentials")}
+	defer s.setUpLDAP(&b)()
+	_, err := ldapScheme{}.Login(map[string]string{"email": s.user.Email, "password": "wrong"})
+	c.Assert(err, gocheck.FitsTypeOf, AuthenticationFailure{})
+}
+
+func (s *S) TestLDAPLoginWithoutServer(c *gocheck.C) {
+	_, err := ldapScheme{}.Login(map[string]string{"email": s.user.Email, "password": "secret"})
+	c.Assert(err, gocheck.ErrorMatches, `^Setting "auth:ldap:server" is undefined.$`)
+}
+
+func (s *S) TestLDAPCreate(c *gocheck.C) {
+	_, err := ldapScheme{}.Create(&User{Email: "ldap@tsuru.io"})
+	c.Assert(err, gocheck.Equals, ErrCreateNotSupported)
+}
+
+func (s *S) TestEscapeDN(c *gocheck.C) {
+	c.Assert(escapeDN("user@tsuru.io"), gocheck.Equals, "user@tsuru.io")
+	c.Assert(escapeDN("a,b=c+d"), gocheck.Equals, `a\,b\=c\+d`)
+}
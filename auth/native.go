@@ -0,0 +1,51 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package auth
+
+import (
+	"github.com/globocom/tsuru/errors"
+	"github.com/globocom/tsuru/validation"
+)
+
+func init() {
+	RegisterScheme("native", nativeScheme{})
+}
+
+// nativeScheme authenticates users with the passwords stored in tsuru's
+// database.
+type nativeScheme struct{}
+
+func (nativeScheme) Login(params map[string]string) (*Token, error) {
+	password, ok := params["password"]
+	if !ok {
+		return nil, &errors.ValidationError{Message: "You must provide a password to login"}
+	}
+	u, err := GetUserByEmail(params["email"])
+	if err != nil {
+		return nil, err
+	}
+	return u.CreateToken(password)
+}
+
+func (nativeScheme) Logout(token string) error {
+	return DeleteToken(token)
+}
+
+func (nativeScheme) Create(u *User) (*User, error) {
+	if !validation.ValidateEmail(u.Email) {
+		return nil, &errors.ValidationError{Message: emailError}
+	}
+	if !validation.ValidateLength(u.Password, passwordMinLen, passwordMaxLen) {
+		return nil, &errors.ValidationError{Message: passwordError}
+	}
+	if err := register(u); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+func (nativeScheme) Info() (SchemeInfo, error) {
+	return nil, nil
+}
@@ -0,0 +1,75 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package auth
+
+import (
+	"github.com/globocom/tsuru/errors"
+	"labix.org/v2/mgo/bson"
+	"launchpad.net/gocheck"
+)
+
+func (s *S) TestNativeLogin(c *gocheck.C) {
+	t, err := nativeScheme{}.Login(map[string]string{"email": s.user.Email, "password": "123456"})
+	c.Assert(err, gocheck.IsNil)
+	defer DeleteToken(t.Token)
+	c.Assert(t.UserEmail, gocheck.Equals, s.user.Email)
+}
+
+func (s *S) TestNativeLoginWithoutPassword(c *gocheck.C) {
+	_, err := nativeScheme{}.Login(map[string]string{"email": s.user.Email})
+	e, ok := err.(*errors.ValidationError)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Message, gocheck.Equals, "You must provide a password to login")
+}
+
+func (s *S) TestNativeLoginWrongPassword(c *gocheck.C) {
+	_, err := nativeScheme{}.Login(map[string]string{"email": s.user.Email, "password": "1234567"})
+	c.Assert(err, gocheck.FitsTypeOf, AuthenticationFailure{})
+}
+
+func (s *S) TestNativeLogout(c *gocheck.C) {
+	t, err := s.user.CreateToken("123456")
+	c.Assert(err, gocheck.IsNil)
+	err = nativeScheme{}.Logout(t.Token)
+	c.Assert(err, gocheck.IsNil)
+	_, err = GetToken("bearer " + t.Token)
+	c.Assert(err, gocheck.Equals, ErrInvalidToken)
+}
+
+func (s *S) TestNativeCreate(c *gocheck.C) {
+	h := testHandler{}
+	ts := s.startGandalfTestServer(&h)
+	defer ts.Close()
+	u := &User{Email: "new@tsuru.io", Password: "123456"}
+	_, err := nativeScheme{}.Create(u)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Users().Remove(bson.M{"email": u.Email})
+	c.Assert(h.url, gocheck.DeepEquals, []string{"/user"})
+	stored, err := GetUserByEmail(u.Email)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(stored.CheckPassword("123456"), gocheck.IsNil)
+}
+
+func (s *S) TestNativeCreateValidation(c *gocheck.C) {
+	var tests = []struct {
+		user    User
+		message string
+	}{
+		{User{Email: "new", Password: "123456"}, emailError},
+		{User{Email: "new@tsuru.io", Password: "123"}, passwordError},
+	}
+	for _, t := range tests {
+		_, err := nativeScheme{}.Create(&t.user)
+		e, ok := err.(*errors.ValidationError)
+		c.Check(ok, gocheck.Equals, true)
+		c.Check(e.Message, gocheck.Equals, t.message)
+	}
+}
+
+func (s *S) TestNativeCreateDuplicate(c *gocheck.C) {
+	u := &User{Email: s.user.Email, Password: "123456"}
+	_, err := nativeScheme{}.Create(u)
+	c.Assert(err, gocheck.Equals, ErrUserAlreadyExists)
+}
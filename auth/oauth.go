@@ -0,0 +1,182 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package auth
+
+import (
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"github.com/globocom/config"
+	"github.com/globocom/tsuru/errors"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// redirectURLPlaceholder is replaced by clients with the URL in which they
+// wait for the callback of the authorization server.
+const redirectURLPlaceholder = "__redirect_url__"
+
+// statePlaceholder is replaced by clients with a random value, that they
+// check in the callback of the authorization server, refusing callbacks that
+// were not started by them.
+const statePlaceholder = "__state__"
+
+func init() {
+	RegisterScheme("oauth", oauthScheme{})
+}
+
+// oauthScheme authenticates users with the authorization code flow of
+// OAuth 2.0. Clients send users to the authorization server, and then send
+// the code from the callback to tsuru, that exchanges it for an access token
+// and reads the email of the user from the "auth:oauth:info-url" endpoint.
+// Users are registered in their first login.
+type oauthScheme struct{}
+
+type oauthConfig struct {
+	clientID     string
+	clientSecret string
+	authURL      string
+	tokenURL     string
+	infoURL      string
+	scope        string
+	callbackPort string
+}
+
+func loadOAuthConfig() (*oauthConfig, error) {
+	var c oauthConfig
+	settings := []struct {
+		name  string
+		value *string
+	}{
+		{"client-id", &c.clientID},
+		{"client-secret", &c.clientSecret},
+		{"auth-url", &c.authURL},
+		{"token-url", &c.tokenURL},
+		{"info-url", &c.infoURL},
+		{"callback-port", &c.callbackPort},
+	}
+	for _, s := range settings {
+		value, err := config.GetString("auth:oauth:" + s.name)
+		if err != nil {
+			return nil, fmt.Errorf(`Setting "auth:oauth:%s" is undefined.`, s.name)
+		}
+		*s.value = value
+	}
+	c.scope, _ = config.GetString("auth:oauth:scope")
+	return &c, nil
+}
+
+func (oauthScheme) Login(params map[string]string) (*Token, error) {
+	code, redirectURL := params["code"], params["redirectUrl"]
+	if code == "" || redirectURL == "" {
+		return nil, &errors.ValidationError{Message: "You must provide the code and the redirectUrl to login"}
+	}
+	c, err := loadOAuthConfig()
+	if err != nil {
+		return nil, err
+	}
+	accessToken, err := c.exchange(code, redirectURL)
+	if err != nil {
+		return nil, err
+	}
+	email, err := c.email(accessToken)
+	if err != nil {
+		return nil, err
+	}
+	u, err := externalUser(email)
+	if err != nil {
+		return nil, err
+	}
+	return u.createSessionToken()
+}
+
+// exchange exchanges the authorization code for an access token.
+func (c *oauthConfig) exchange(code, redirectURL string) (string, error) {
+	resp, err := http.PostForm(c.tokenURL, url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {redirectURL},
+		"client_id":     {c.clientID},
+		"client_secret": {c.clientSecret},
+	})
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", AuthenticationFailure{}
+	}
+	var result struct {
+		AccessToken string `json:"access_token"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&result)
+	if err != nil {
+		return "", err
+	}
+	if result.AccessToken == "" {
+		return "", AuthenticationFailure{}
+	}
+	return result.AccessToken, nil
+}
+
+// email reads the email of the user from the info endpoint.
+func (c *oauthConfig) email(accessToken string) (string, error) {
+	request, err := http.NewRequest("GET", c.infoURL, nil)
+	if err != nil {
+		return "", err
+	}
+	request.Header.Set("Authorization", "Bearer "+accessToken)
+	resp, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", AuthenticationFailure{}
+	}
+	var info struct {
+		Email string `json:"email"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&info)
+	if err != nil {
+		return "", err
+	}
+	if info.Email == "" {
+		return "", stderrors.New("The authorization server did not return the email of the user.")
+	}
+	return info.Email, nil
+}
+
+func (oauthScheme) Logout(token string) error {
+	return DeleteToken(token)
+}
+
+func (oauthScheme) Create(u *User) (*User, error) {
+	return nil, ErrCreateNotSupported
+}
+
+// Info returns the URL of the authorization server, in "authorizeUrl", and
+// the port in which clients should wait for the callback, in "port". The
+// redirect_uri and state parameters of the URL must be replaced by clients.
+func (oauthScheme) Info() (SchemeInfo, error) {
+	c, err := loadOAuthConfig()
+	if err != nil {
+		return nil, err
+	}
+	v := url.Values{
+		"client_id":     {c.clientID},
+		"response_type": {"code"},
+	}
+	if c.scope != "" {
+		v.Set("scope", c.scope)
+	}
+	sep := "?"
+	if strings.Contains(c.authURL, "?") {
+		sep = "&"
+	}
+	authorizeURL := c.authURL + sep + v.Encode() + "&redirect_uri=" + redirectURLPlaceholder + "&state=" + statePlaceholder
+	return SchemeInfo{"authorizeUrl": authorizeURL, "port": c.callbackPort}, nil
+}
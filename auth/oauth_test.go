@@ -0,0 +1,105 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package auth
+
+import (
+	"fmt"
+	"github.com/globocom/config"
+	"launchpad.net/gocheck"
+	"net/http"
+	"net/http/httptest"
+)
+
+type oauthServer struct {
+	code  string
+	email string
+	form  map[string]string
+}
+
+func (s *oauthServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/token":
+		r.ParseForm()
+		s.form = map[string]string{}
+		for k := range r.PostForm {
+			s.form[k] = r.PostForm.Get(k)
+		}
+		if r.PostForm.Get("code") != s.code {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		fmt.Fprint(w, `{"access_token":"secret-token","token_type":"bearer"}`)
+	case "/info":
+		if r.Header.Get("Authorization") != "Bearer secret-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprintf(w, `{"email":%q}`, s.email)
+	}
+}
+
+func (s *S) setUpOAuth(h *oauthServer) func() {
+	ts := httptest.NewServer(h)
+	config.Set("auth:oauth:client-id", "tsuru")
+	config.Set("auth:oauth:client-secret", "s3cr3t")
+	config.Set("auth:oauth:auth-url", ts.URL+"/authorize")
+	config.Set("auth:oauth:token-url", ts.URL+"/token")
+	config.Set("auth:oauth:info-url", ts.URL+"/info")
+	config.Set("auth:oauth:callback-port", "35654")
+	return func() {
+		ts.Close()
+		for _, name := range []string{"client-id", "client-secret", "auth-url", "token-url", "info-url", "callback-port", "scope"} {
+			config.Unset("auth:oauth:" + name)
+		}
+	}
+}
+
+func (s *S) TestOAuthLogin(c *gocheck.C) {
+	h := oauthServer{code: "xyz", email: s.user.Email}
+	defer s.setUpOAuth(&h)()
+	params := map[string]string{"code": "xyz", "redirectUrl": "http://localhost:35654"}
+	t, err := oauthScheme{}.Login(params)
+	c.Assert(err, gocheck.IsNil)
+	defer DeleteToken(t.Token)
+	c.Assert(t.UserEmail, gocheck.Equals, s.user.Email)
+	expected := map[string]string{
+		"grant_type":    "authorization_code",
+		"code":          "xyz",
+		"redirect_uri":  "http://localhost:35654",
+		"client_id":     "tsuru",
+		"client_secret": "s3cr3t",
+	}
+	c.Assert(h.form, gocheck.DeepEquals, expected)
+}
+
+func (s *S) TestOAuthLoginInvalidCode(c *gocheck.C) {
+	h := oauthServer{code: "xyz", email: s.user.Email}
+	defer s.setUpOAuth(&h)()
+	params := map[string]string{"code": "abc", "redirectUrl": "http://localhost:35654"}
+	_, err := oauthScheme{}.Login(params)
+	c.Assert(err, gocheck.FitsTypeOf, AuthenticationFailure{})
+}
+
+func (s *S) TestOAuthLoginWithoutCode(c *gocheck.C) {
+	_, err := oauthScheme{}.Login(map[string]string{"redirectUrl": "http://localhost:35654"})
+	c.Assert(err, gocheck.ErrorMatches, "^You must provide the code and the redirectUrl to login$")
+}
+
+func (s *S) TestOAuthInfo(c *gocheck.C) {
+	var h oauthServer
+	defer s.setUpOAuth(&h)()
+	config.Set("auth:oauth:scope", "email")
+	info, err := oauthScheme{}.Info()
+	c.Assert(err, gocheck.IsNil)
+	authURL, _ := config.GetString("auth:oauth:auth-url")
+	expected := authURL + "?client_id=tsuru&response_type=code&scope=email&redirect_uri=__redirect_url__&state=__state__"
+	c.Assert(info["authorizeUrl"], gocheck.Equals, expected)
+	c.Assert(info["port"], gocheck.Equals, "35654")
+}
+
+func (s *S) TestOAuthInfoWithoutConfig(c *gocheck.C) {
+	_, err := oauthScheme{}.Info()
+	c.Assert(err, gocheck.ErrorMatches, `^Setting "auth:oauth:client-id" is undefined.$`)
+}
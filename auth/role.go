@@ -0,0 +1,170 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package auth
+
+import (
+	stderrors "errors"
+)
+
+// Permission identifies an action that users may be allowed to do.
+type Permission string
+
+const (
+	PermAppRead      Permission = "app.read"
+	PermAppDeploy    Permission = "app.deploy"
+	PermAppRestart   Permission = "app.restart"
+	PermAppUpdate    Permission = "app.update"
+	PermAppDelete    Permission = "app.delete"
+	PermServiceAdmin Permission = "service.admin"
+	PermTeamAdmin    Permission = "team.admin"
+)
+
+// Scopes in which a role can be assigned to a user. A role with global scope
+// applies to everything, a role with team scope applies to the team and to
+// everything owned by it, and a role with app scope applies only to the app.
+const (
+	ScopeGlobal = "global"
+	ScopeTeam   = "team"
+	ScopeApp    = "app"
+)
+
+// Roles maps the name of each role to the permissions granted by it.
+var Roles = map[string][]Permission{
+	"app-viewer":    {PermAppRead},
+	"app-deployer":  {PermAppRead, PermAppDeploy, PermAppRestart},
+	"app-admin":     {PermAppRead, PermAppDeploy, PermAppRestart, PermAppUpdate, PermAppDelete},
+	"service-admin": {PermServiceAdmin},
+	"team-admin":    {PermTeamAdmin},
+}
+
+var (
+	ErrRoleNotFound        = stderrors.New("Role not found.")
+	ErrInvalidScope        = stderrors.New("Invalid scope. The scope must be global, team or app.")
+	ErrScopeValueMissing   = stderrors.New("You must provide the team or the app of the scope.")
+	ErrRoleAlreadyAssigned = stderrors.New("This role is already assigned to the user.")
+	ErrRoleNotAssigned     = stderrors.New("This role is not assigned to the user.")
+)
+
+// RoleAssignment represents a role assigned to a user in a scope. Value is the
+// name of the team or of the app, and is empty in the global scope.
+type RoleAssignment struct {
+	Name  string
+	Scope string
+	Value string `bson:",omitempty" json:",omitempty"`
+}
+
+func (r *RoleAssignment) validate() error {
+	if _, ok := Roles[r.Name]; !ok {
+		return ErrRoleNotFound
+	}
+	switch r.Scope {
+	case ScopeGlobal:
+		r.Value = ""
+	case ScopeTeam, ScopeApp:
+		if r.Value == "" {
+			return ErrScopeValueMissing
+		}
+	default:
+		return ErrInvalidScope
+	}
+	return nil
+}
+
+// grants checks whether the role grants the permission.
+func (r *RoleAssignment) grants(perm Permission) bool {
+	for _, p := range Roles[r.Name] {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// applies checks whether the scope of the role includes the given app or any
+// of the given teams.
+func (r *RoleAssignment) applies(appName string, teams []string) bool {
+	switch r.Scope {
+	case ScopeGlobal:
+		return true
+	case ScopeApp:
+		return appName != "" && r.Value == appName
+	case ScopeTeam:
+		for _, t := range teams {
+			if r.Value == t {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// AddRole assigns the named role to the user, in the given scope.
+func (u *User) AddRole(name, scope, value string) error {
+	role := RoleAssignment{Name: name, Scope: scope, Value: value}
+	if err := role.validate(); err != nil {
+		return err
+	}
+	for _, r := range u.Roles {
+		if r == role {
+			return ErrRoleAlreadyAssigned
+		}
+	}
+	u.Roles = append(u.Roles, role)
+	return u.Update()
+}
+
+// RemoveRole revokes the named role from the user, in the given scope.
+func (u *User) RemoveRole(name, scope, value string) error {
+	role := RoleAssignment{Name: name, Scope: scope, Value: value}
+	if scope == ScopeGlobal {
+		role.Value = ""
+	}
+	for i, r := range u.Roles {
+		if r == role {
+			u.Roles = append(u.Roles[:i], u.Roles[i+1:]...)
+			return u.Update()
+		}
+	}
+	return ErrRoleNotAssigned
+}
+
+// HasPermission checks whether the user has the given permission over the
+// app or the teams. Members of the given teams have all permissions over
+// them, admins have all permissions over apps, and other users depend on
+// their roles.
+//
+// The app may be empty when checking permissions over teams and services, in
+// that case teams contains the teams that own the resource.
+func (u *User) HasPermission(perm Permission, appName string, teams []string) bool {
+	for _, r := range u.Roles {
+		if r.grants(perm) && r.applies(appName, teams) {
+			return true
+		}
+	}
+	if len(teams) > 0 && CheckUserAccess(teams, u) {
+		return true
+	}
+	return appName != "" && u.IsAdmin()
+}
+
+// AppScopes returns the scopes in which the user has any role that grants
+// access to apps: all is true when the user has a global role, teams and
+// apps contain the values of team and app scoped roles.
+func (u *User) AppScopes() (all bool, teams, apps []string) {
+	for _, r := range u.Roles {
+		if !r.grants(PermAppRead) {
+			continue
+		}
+		switch r.Scope {
+		case ScopeGlobal:
+			all = true
+		case ScopeTeam:
+			teams = append(teams, r.Value)
+		case ScopeApp:
+			apps = append(apps, r.Value)
+		}
+	}
+	return all, teams, apps
+}
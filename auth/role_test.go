@@ -0,0 +1,151 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package auth
+
+import (
+	"labix.org/v2/mgo/bson"
+	"launchpad.net/gocheck"
+)
+
+func (s *S) TestAddRole(c *gocheck.C) {
+	u := User{Email: "ops@tsuru.io", Password: "123456"}
+	err := u.Create()
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Users().Remove(bson.M{"email": u.Email})
+	err = u.AddRole("app-deployer", ScopeTeam, "cobrateam")
+	c.Assert(err, gocheck.IsNil)
+	user, err := GetUserByEmail(u.Email)
+	c.Assert(err, gocheck.IsNil)
+	expected := []RoleAssignment{{Name: "app-deployer", Scope: ScopeTeam, Value: "cobrateam"}}
+	c.Assert(user.Roles, gocheck.DeepEquals, expected)
+}
+
+func (s *S) TestAddRoleGlobalScopeIgnoresTheValue(c *gocheck.C) {
+	u := User{Email: "ops@tsuru.io", Password: "123456"}
+	err := u.Create()
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Users().Remove(bson.M{"email": u.Email})
+	err = u.AddRole("app-viewer", ScopeGlobal, "something")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(u.Roles, gocheck.DeepEquals, []RoleAssignment{{Name: "app-viewer", Scope: ScopeGlobal}})
+}
+
+func (s *S) TestAddRoleValidation(c *gocheck.C) {
+	var tests = []struct {
+		name  string
+		scope string
+		value string
+		err   error
+	}{
+		{"superuser", ScopeGlobal, "", ErrRoleNotFound},
+		{"app-viewer", "world", "", ErrInvalidScope},
+		{"app-viewer", ScopeApp, "", ErrScopeValueMissing},
+		{"team-admin", ScopeTeam, "", ErrScopeValueMissing},
+	}
+	u := User{Email: "ops@tsuru.io"}
+	for _, t := range tests {
+		err := u.AddRole(t.name, t.scope, t.value)
+		c.Check(err, gocheck.Equals, t.err)
+	}
+	c.Assert(u.Roles, gocheck.HasLen, 0)
+}
+
+func (s *S) TestAddRoleAlreadyAssigned(c *gocheck.C) {
+	u := User{Email: "ops@tsuru.io", Password: "123456"}
+	err := u.Create()
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Users().Remove(bson.M{"email": u.Email})
+	err = u.AddRole("app-viewer", ScopeApp, "myapp")
+	c.Assert(err, gocheck.IsNil)
+	err = u.AddRole("app-viewer", ScopeApp, "myapp")
+	c.Assert(err, gocheck.Equals, ErrRoleAlreadyAssigned)
+}
+
+func (s *S) TestRemoveRole(c *gocheck.C) {
+	u := User{Email: "ops@tsuru.io", Password: "123456"}
+	err := u.Create()
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Users().Remove(bson.M{"email": u.Email})
+	err = u.AddRole("app-viewer", ScopeApp, "myapp")
+	c.Assert(err, gocheck.IsNil)
+	err = u.AddRole("app-deployer", ScopeGlobal, "")
+	c.Assert(err, gocheck.IsNil)
+	err = u.RemoveRole("app-viewer", ScopeApp, "myapp")
+	c.Assert(err, gocheck.IsNil)
+	user, err := GetUserByEmail(u.Email)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(user.Roles, gocheck.DeepEquals, []RoleAssignment{{Name: "app-deployer", Scope: ScopeGlobal}})
+}
+
+func (s *S) TestRemoveRoleNotAssigned(c *gocheck.C) {
+	u := User{Email: "ops@tsuru.io"}
+	err := u.RemoveRole("app-viewer", ScopeApp, "myapp")
+	c.Assert(err, gocheck.Equals, ErrRoleNotAssigned)
+}
+
+func (s *S) TestHasPermissionGlobalRole(c *gocheck.C) {
+	u := User{
+		Email: "ops@tsuru.io",
+		Roles: []RoleAssignment{{Name: "app-deployer", Scope: ScopeGlobal}},
+	}
+	c.Assert(u.HasPermission(PermAppRestart, "myapp", []string{"someteam"}), gocheck.Equals, true)
+	c.Assert(u.HasPermission(PermAppDeploy, "otherapp", nil), gocheck.Equals, true)
+	c.Assert(u.HasPermission(PermAppDelete, "myapp", []string{"someteam"}), gocheck.Equals, false)
+	c.Assert(u.HasPermission(PermTeamAdmin, "", []string{"someteam"}), gocheck.Equals, false)
+}
+
+func (s *S) TestHasPermissionTeamRole(c *gocheck.C) {
+	u := User{
+		Email: "ops@tsuru.io",
+		Roles: []RoleAssignment{{Name: "app-admin", Scope: ScopeTeam, Value: "someteam"}},
+	}
+	c.Assert(u.HasPermission(PermAppDelete, "myapp", []string{"otherteam", "someteam"}), gocheck.Equals, true)
+	c.Assert(u.HasPermission(PermAppDelete, "myapp", []string{"otherteam"}), gocheck.Equals, false)
+}
+
+func (s *S) TestHasPermissionAppRole(c *gocheck.C) {
+	u := User{
+		Email: "ops@tsuru.io",
+		Roles: []RoleAssignment{{Name: "app-viewer", Scope: ScopeApp, Value: "myapp"}},
+	}
+	c.Assert(u.HasPermission(PermAppRead, "myapp", []string{"someteam"}), gocheck.Equals, true)
+	c.Assert(u.HasPermission(PermAppRestart, "myapp", []string{"someteam"}), gocheck.Equals, false)
+	c.Assert(u.HasPermission(PermAppRead, "otherapp", []string{"someteam"}), gocheck.Equals, false)
+	c.Assert(u.HasPermission(PermAppRead, "", []string{"someteam"}), gocheck.Equals, false)
+}
+
+func (s *S) TestHasPermissionTeamMember(c *gocheck.C) {
+	c.Assert(s.user.HasPermission(PermAppDelete, "myapp", []string{s.team.Name}), gocheck.Equals, true)
+	c.Assert(s.user.HasPermission(PermTeamAdmin, "", []string{s.team.Name}), gocheck.Equals, true)
+	c.Assert(s.user.HasPermission(PermAppDelete, "myapp", []string{"otherteam"}), gocheck.Equals, false)
+	c.Assert(s.user.HasPermission(PermServiceAdmin, "", nil), gocheck.Equals, false)
+}
+
+func (s *S) TestHasPermissionAdmin(c *gocheck.C) {
+	t := Team{Name: "admin", Users: []string{s.user.Email}}
+	err := s.conn.Teams().Insert(&t)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Teams().RemoveId(t.Name)
+	c.Assert(s.user.HasPermission(PermAppDelete, "myapp", []string{"otherteam"}), gocheck.Equals, true)
+	c.Assert(s.user.HasPermission(PermServiceAdmin, "", []string{"otherteam"}), gocheck.Equals, false)
+}
+
+func (s *S) TestAppScopes(c *gocheck.C) {
+	u := User{
+		Email: "ops@tsuru.io",
+		Roles: []RoleAssignment{
+			{Name: "app-viewer", Scope: ScopeApp, Value: "myapp"},
+			{Name: "app-deployer", Scope: ScopeTeam, Value: "someteam"},
+			{Name: "team-admin", Scope: ScopeTeam, Value: "otherteam"},
+		},
+	}
+	all, teams, apps := u.AppScopes()
+	c.Assert(all, gocheck.Equals, false)
+	c.Assert(teams, gocheck.DeepEquals, []string{"someteam"})
+	c.Assert(apps, gocheck.DeepEquals, []string{"myapp"})
+	u.Roles = append(u.Roles, RoleAssignment{Name: "app-viewer", Scope: ScopeGlobal})
+	all, _, _ = u.AppScopes()
+	c.Assert(all, gocheck.Equals, true)
+}
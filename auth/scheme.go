@@ -0,0 +1,116 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package auth
+
+import (
+	stderrors "errors"
+	"fmt"
+	"github.com/globocom/config"
+	"github.com/globocom/go-gandalfclient"
+	"github.com/globocom/tsuru/quota"
+	"github.com/globocom/tsuru/repository"
+)
+
+const defaultScheme = "native"
+
+var (
+	ErrUserAlreadyExists  = stderrors.New("This email is already registered")
+	ErrCreateNotSupported = stderrors.New("Users are created in their first login with this authentication scheme.")
+)
+
+// SchemeInfo contains the information that clients need to login with a
+// scheme, like the URL of an authorization server.
+type SchemeInfo map[string]string
+
+// Scheme is an authentication scheme. It authenticates users, creating
+// tokens for them, and manages their registration.
+type Scheme interface {
+	// Login authenticates the user with the given parameters and returns
+	// a new session token.
+	Login(params map[string]string) (*Token, error)
+
+	// Logout invalidates the given token.
+	Logout(token string) error
+
+	// Create registers a new user.
+	Create(u *User) (*User, error)
+
+	// Info returns the information that clients need to login.
+	Info() (SchemeInfo, error)
+}
+
+var schemes = make(map[string]Scheme)
+
+// RegisterScheme registers a new authentication scheme.
+func RegisterScheme(name string, scheme Scheme) {
+	schemes[name] = scheme
+}
+
+// GetScheme returns the authentication scheme registered with the given
+// name.
+func GetScheme(name string) (Scheme, error) {
+	scheme, ok := schemes[name]
+	if !ok {
+		return nil, fmt.Errorf("Unknown authentication scheme: %q.", name)
+	}
+	return scheme, nil
+}
+
+// SchemeName returns the name of the configured authentication scheme, read
+// from the "auth:scheme" setting. The native scheme is the default.
+func SchemeName() string {
+	name, err := config.GetString("auth:scheme")
+	if err != nil || name == "" {
+		return defaultScheme
+	}
+	return name
+}
+
+// CurrentScheme returns the configured authentication scheme.
+func CurrentScheme() (Scheme, error) {
+	return GetScheme(SchemeName())
+}
+
+// register stores the user in the database and in the git server, and
+// creates its quota, if the "quota:apps-per-user" setting is defined.
+func register(u *User) error {
+	if _, err := GetUserByEmail(u.Email); err == nil {
+		return ErrUserAlreadyExists
+	}
+	c := gandalf.Client{Endpoint: repository.ServerURL()}
+	if _, err := c.NewUser(u.Email, keysToMap(u.Keys)); err != nil {
+		return fmt.Errorf("Failed to create user in the git server: %s", err)
+	}
+	if err := u.Create(); err != nil {
+		return err
+	}
+	if limit, err := config.GetUint("quota:apps-per-user"); err == nil {
+		quota.Create(u.Email, uint(limit))
+	}
+	return nil
+}
+
+// externalUser returns the user with the given email, registering it if
+// needed. It's used by schemes in which users are authenticated somewhere
+// else, and created in their first login.
+func externalUser(email string) (*User, error) {
+	u, err := GetUserByEmail(email)
+	if err == ErrUserNotFound {
+		u = &User{Email: email}
+		err = register(u)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+func keysToMap(keys []Key) map[string]string {
+	keysMap := make(map[string]string, len(keys))
+	for _, k := range keys {
+		keysMap[k.Name] = k.Content
+	}
+	return keysMap
+}
@@ -0,0 +1,70 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package auth
+
+import (
+	"github.com/globocom/config"
+	"labix.org/v2/mgo/bson"
+	"launchpad.net/gocheck"
+)
+
+type fakeScheme struct{}
+
+func (fakeScheme) Login(params map[string]string) (*Token, error) { return nil, nil }
+func (fakeScheme) Logout(token string) error                      { return nil }
+func (fakeScheme) Create(u *User) (*User, error)                  { return u, nil }
+func (fakeScheme) Info() (SchemeInfo, error)                      { return nil, nil }
+
+func (s *S) TestRegisterAndGetScheme(c *gocheck.C) {
+	RegisterScheme("fake", fakeScheme{})
+	defer delete(schemes, "fake")
+	scheme, err := GetScheme("fake")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(scheme, gocheck.FitsTypeOf, fakeScheme{})
+}
+
+func (s *S) TestGetUnknownScheme(c *gocheck.C) {
+	scheme, err := GetScheme("unknown")
+	c.Assert(scheme, gocheck.IsNil)
+	c.Assert(err, gocheck.ErrorMatches, `^Unknown authentication scheme: "unknown".$`)
+}
+
+func (s *S) TestBuiltinSchemesAreRegistered(c *gocheck.C) {
+	c.Assert(schemes["native"], gocheck.FitsTypeOf, nativeScheme{})
+	c.Assert(schemes["ldap"], gocheck.FitsTypeOf, ldapScheme{})
+	c.Assert(schemes["oauth"], gocheck.FitsTypeOf, oauthScheme{})
+}
+
+func (s *S) TestCurrentSchemeDefaultsToNative(c *gocheck.C) {
+	c.Assert(SchemeName(), gocheck.Equals, "native")
+	scheme, err := CurrentScheme()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(scheme, gocheck.FitsTypeOf, nativeScheme{})
+}
+
+func (s *S) TestCurrentSchemeReadsTheConfig(c *gocheck.C) {
+	config.Set("auth:scheme", "ldap")
+	defer config.Unset("auth:scheme")
+	c.Assert(SchemeName(), gocheck.Equals, "ldap")
+	scheme, err := CurrentScheme()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(scheme, gocheck.FitsTypeOf, ldapScheme{})
+}
+
+func (s *S) TestExternalUserRegistersTheUser(c *gocheck.C) {
+	h := testHandler{}
+	ts := s.startGandalfTestServer(&h)
+	defer ts.Close()
+	defer s.conn.Users().Remove(bson.M{"email": "sso@tsuru.io"})
+	u, err := externalUser("sso@tsuru.io")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(u.Email, gocheck.Equals, "sso@tsuru.io")
+	c.Assert(h.url, gocheck.DeepEquals, []string{"/user"})
+	_, err = GetUserByEmail("sso@tsuru.io")
+	c.Assert(err, gocheck.IsNil)
+	_, err = externalUser("sso@tsuru.io")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(h.url, gocheck.HasLen, 1)
+}
@@ -20,12 +20,18 @@ const keySize = 32
 
 var ErrInvalidToken = errors.New("Invalid token")
 
+// Token represents an authentication token. Session tokens are created by
+// user logins, application tokens are created for apps, and API tokens are
+// named tokens created by users, with a scope and an explicit expiration.
 type Token struct {
 	Token     string        `json:"token"`
 	Creation  time.Time     `json:"creation"`
 	Expires   time.Duration `json:"expires"`
 	UserEmail string        `json:"email"`
 	AppName   string        `json:"app"`
+	Name      string        `json:"name,omitempty" bson:",omitempty"`
+	Scope     string        `json:"scope,omitempty" bson:",omitempty"`
+	Apps      []string      `json:"apps,omitempty" bson:",omitempty"`
 }
 
 func (t *Token) User() (*User, error) {
@@ -184,7 +190,8 @@ func removeOldTokens(userEmail string) error {
 	if limit, err = config.GetInt("auth:max-simultaneous-sessions"); err != nil {
 		return err
 	}
-	count, err := conn.Tokens().Find(bson.M{"useremail": userEmail}).Count()
+	query := bson.M{"useremail": userEmail, "name": bson.M{"$exists": false}}
+	count, err := conn.Tokens().Find(query).Count()
 	if err != nil {
 		return err
 	}
@@ -193,7 +200,7 @@ func removeOldTokens(userEmail string) error {
 		return nil
 	}
 	var tokens []map[string]interface{}
-	err = conn.Tokens().Find(bson.M{"useremail": userEmail}).Select(bson.M{"_id": 1}).Limit(diff).All(&tokens)
+	err = conn.Tokens().Find(query).Select(bson.M{"_id": 1}).Limit(diff).All(&tokens)
 	if err != nil {
 		return nil
 	}
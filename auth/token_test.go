@@ -293,6 +293,26 @@ func (s *S) TestRemoveOldNothingToRemove(c *gocheck.C) {
 	c.Assert(count, gocheck.Equals, 1)
 }
 
+func (s *S) TestRemoveOldTokensIgnoresAPITokens(c *gocheck.C) {
+	config.Set("auth:max-simultaneous-sessions", 1)
+	defer config.Unset("auth:max-simultaneous-sessions")
+	user := "removeme@tsuru.io"
+	defer s.conn.Tokens().RemoveAll(bson.M{"useremail": user})
+	tokens := []Token{
+		{Token: "session", UserEmail: user, Creation: time.Now(), Expires: time.Hour},
+		{Token: "ci", UserEmail: user, Creation: time.Now(), Expires: time.Hour, Name: "ci", Scope: TokenScopeDeploy},
+	}
+	for _, t := range tokens {
+		err := s.conn.Tokens().Insert(t)
+		c.Assert(err, gocheck.IsNil)
+	}
+	err := removeOldTokens(user)
+	c.Assert(err, gocheck.IsNil)
+	count, err := s.conn.Tokens().Find(bson.M{"useremail": user}).Count()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(count, gocheck.Equals, 2)
+}
+
 func (s *S) TestRemoveOldWithoutSetting(c *gocheck.C) {
 	err := removeOldTokens("something@tsuru.io")
 	c.Assert(err, gocheck.NotNil)
@@ -62,6 +62,7 @@ type User struct {
 	Email    string
 	Password string
 	Keys     []Key
+	Roles    []RoleAssignment
 }
 
 func GetUserByEmail(email string) (*User, error) {
@@ -123,6 +124,13 @@ func (u *User) CreateToken(password string) (*Token, error) {
 	if err := u.CheckPassword(password); err != nil {
 		return nil, err
 	}
+	return u.createSessionToken()
+}
+
+// createSessionToken creates a new session token for the user, without
+// checking its password. It's used by authentication schemes that
+// authenticate users somewhere else.
+func (u *User) createSessionToken() (*Token, error) {
 	conn, err := db.Conn()
 	if err != nil {
 		return nil, err
@@ -0,0 +1,281 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package autoscale provides an agent that adds and removes units of apps
+// based on metrics sampled from their units.
+//
+// Each app is scaled according to its rule, stored in the autoscale
+// collection. Metrics are sampled using a MetricsSource, defined by the
+// autoscale:metrics-source setting.
+package autoscale
+
+import (
+	"errors"
+	"fmt"
+	"github.com/globocom/config"
+	"github.com/globocom/tsuru/app"
+	"github.com/globocom/tsuru/db"
+	"github.com/globocom/tsuru/log"
+	"github.com/globocom/tsuru/provision"
+	"github.com/globocom/tsuru/quota"
+	"labix.org/v2/mgo"
+	"labix.org/v2/mgo/bson"
+	stdlog "log"
+	"time"
+)
+
+var ErrRuleNotFound = errors.New("Rule not found.")
+
+// Rule defines how the units of an app are scaled.
+//
+// When the average value of the metric in the started units of the app goes
+// above ScaleUp, a new unit is added; when it goes below ScaleDown, a unit is
+// removed. The number of units is kept between MinUnits and MaxUnits (0 means
+// no limit), and no scaling happens within Cooldown seconds after the last
+// one.
+type Rule struct {
+	App       string `bson:"_id"`
+	Metric    string
+	MinUnits  uint
+	MaxUnits  uint
+	ScaleUp   float64
+	ScaleDown float64
+	Cooldown  int
+	LastScale time.Time
+}
+
+// Validate returns an error describing why the rule is invalid, if it is.
+func (r *Rule) Validate() error {
+	if _, err := (&Metrics{}).value(r.Metric); err != nil {
+		return err
+	}
+	if r.MaxUnits > 0 && r.MinUnits > r.MaxUnits {
+		return errors.New("The minimum number of units must not be greater than the maximum.")
+	}
+	if r.ScaleUp > 0 && r.ScaleDown >= r.ScaleUp {
+		return errors.New("The scale down threshold must be lower than the scale up threshold.")
+	}
+	return nil
+}
+
+func collection(conn *db.Storage) *mgo.Collection {
+	return conn.Collection("autoscale")
+}
+
+// SaveRule validates and stores the given rule, replacing any rule previously
+// defined for the app.
+func SaveRule(r *Rule) error {
+	if err := r.Validate(); err != nil {
+		return err
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = collection(conn).UpsertId(r.App, r)
+	return err
+}
+
+// GetRule returns the rule of the given app.
+func GetRule(appName string) (*Rule, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	var r Rule
+	err = collection(conn).FindId(appName).One(&r)
+	if err == mgo.ErrNotFound {
+		return nil, ErrRuleNotFound
+	}
+	return &r, err
+}
+
+// RemoveRule removes the rule of the given app, disabling its autoscaling.
+func RemoveRule(appName string) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	err = collection(conn).RemoveId(appName)
+	if err == mgo.ErrNotFound {
+		return ErrRuleNotFound
+	}
+	return err
+}
+
+// average returns the average value of the metric in the started units of
+// the app. Units whose metrics can't be sampled are ignored, the second
+// return value is false when no unit could be sampled.
+func average(a *app.App, metric string, source MetricsSource) (float64, bool) {
+	var sum float64
+	var count int
+	for i := range a.Units {
+		unit := &a.Units[i]
+		if unit.GetStatus() != provision.StatusStarted {
+			continue
+		}
+		m, err := source.Metrics(a, unit)
+		if err != nil {
+			log.Printf("autoscale: failed to get metrics of the unit %q: %s", unit.GetName(), err)
+			continue
+		}
+		value, err := m.value(metric)
+		if err != nil {
+			log.Printf("autoscale: %s", err)
+			return 0, false
+		}
+		sum += value
+		count++
+	}
+	if count == 0 {
+		return 0, false
+	}
+	return sum / float64(count), true
+}
+
+// delta returns how many units should be added to (positive) or removed from
+// (negative) the app, according to the rule.
+func delta(r *Rule, a *app.App, source MetricsSource) int {
+	units := uint(len(a.Units))
+	if units < r.MinUnits {
+		return int(r.MinUnits - units)
+	}
+	if r.MaxUnits > 0 && units > r.MaxUnits {
+		return -int(units - r.MaxUnits)
+	}
+	value, ok := average(a, r.Metric, source)
+	if !ok {
+		return 0
+	}
+	if r.ScaleUp > 0 && value > r.ScaleUp && (r.MaxUnits == 0 || units < r.MaxUnits) {
+		return 1
+	}
+	if value < r.ScaleDown && units > r.MinUnits && units > 1 {
+		return -1
+	}
+	return 0
+}
+
+// scale adds or removes units of the app according to the rule. Units are
+// added only while the quota of the app allows it.
+func scale(r *Rule, source MetricsSource) error {
+	if time.Since(r.LastScale) < time.Duration(r.Cooldown)*time.Second {
+		return nil
+	}
+	a := app.App{Name: r.App}
+	if err := a.Get(); err != nil {
+		return fmt.Errorf("app %q not found", r.App)
+	}
+	n := delta(r, &a, source)
+	if n > 0 {
+		_, available, err := quota.Items(a.Name)
+		if err == nil && uint(n) > available {
+			n = int(available)
+		} else if err != nil && err != quota.ErrQuotaNotFound {
+			return err
+		}
+		if n == 0 {
+			log.Printf("autoscale: app %q reached its quota, not adding units.", a.Name)
+			return nil
+		}
+		log.Printf("autoscale: adding %d unit(s) to the app %q.", n, a.Name)
+		if err := a.AddUnits(uint(n)); err != nil {
+			return err
+		}
+	} else if n < 0 {
+		log.Printf("autoscale: removing %d unit(s) from the app %q.", -n, a.Name)
+		if err := a.RemoveUnits(uint(-n)); err != nil {
+			return err
+		}
+	} else {
+		return nil
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	r.LastScale = time.Now()
+	return collection(conn).UpdateId(r.App, bson.M{"$set": bson.M{"lastscale": r.LastScale}})
+}
+
+func scaleApps(source MetricsSource) {
+	conn, err := db.Conn()
+	if err != nil {
+		log.Printf("autoscale: failed to connect to the database: %s", err)
+		return
+	}
+	var rules []Rule
+	err = collection(conn).Find(nil).All(&rules)
+	conn.Close()
+	if err != nil {
+		log.Printf("autoscale: failed to load the rules: %s", err)
+		return
+	}
+	for i := range rules {
+		if err := scale(&rules[i], source); err != nil {
+			log.Printf("autoscale: failed to scale the app %q: %s", rules[i].App, err)
+		}
+	}
+}
+
+func run(ticker <-chan time.Time, source MetricsSource) {
+	for _ = range ticker {
+		log.Print("Scaling apps")
+		scaleApps(source)
+	}
+}
+
+func fatal(err error) {
+	stdlog.Fatal(err)
+}
+
+// Run is the function that starts the autoscaler. The dryMode parameter
+// indicates whether the autoscaler should loop forever or not.
+//
+// It assumes the configuration has already been defined (from a config file or
+// memory).
+func Run(dryMode bool) {
+	log.Init()
+	connString, err := config.GetString("database:url")
+	if err != nil {
+		fatal(err)
+	}
+	dbName, err := config.GetString("database:name")
+	if err != nil {
+		fatal(err)
+	}
+	fmt.Printf("Using the database %q from the server %q.\n\n", dbName, connString)
+	if !dryMode {
+		provisioner, err := config.GetString("provisioner")
+		if err != nil {
+			fmt.Println("Warning: configuration didn't declare a provisioner, using default provisioner.")
+			provisioner = "juju"
+		}
+		app.Provisioner, err = provision.Get(provisioner)
+		if err != nil {
+			fatal(err)
+		}
+		fmt.Printf("Using %q provisioner.\n\n", provisioner)
+		sourceName, err := config.GetString("autoscale:metrics-source")
+		if err != nil {
+			fatal(err)
+		}
+		source, err := Get(sourceName)
+		if err != nil {
+			fatal(err)
+		}
+		fmt.Printf("Using %q metrics source.\n\n", sourceName)
+		interval, err := config.GetInt("autoscale:interval")
+		if err != nil {
+			interval = 60
+		}
+		ticker := time.Tick(time.Duration(interval) * time.Second)
+		fmt.Println("tsuru autoscale agent started...")
+		run(ticker, source)
+	}
+}
@@ -0,0 +1,251 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package autoscale
+
+import (
+	"fmt"
+	"github.com/globocom/tsuru/app"
+	"github.com/globocom/tsuru/provision"
+	"github.com/globocom/tsuru/quota"
+	"launchpad.net/gocheck"
+	"time"
+)
+
+func (s *S) createApp(c *gocheck.C, name string, units int) *app.App {
+	a := app.App{Name: name, Platform: "python"}
+	err := s.provisioner.Provision(&a)
+	c.Assert(err, gocheck.IsNil)
+	if units > 1 {
+		_, err = s.provisioner.AddUnits(&a, uint(units-1))
+		c.Assert(err, gocheck.IsNil)
+	}
+	for i, u := range s.provisioner.GetUnits(&a) {
+		a.Units = append(a.Units, app.Unit{
+			Name:      u.Name,
+			Ip:        u.Ip,
+			State:     provision.StatusStarted.String(),
+			QuotaItem: fmt.Sprintf("%s-%d", name, i),
+		})
+	}
+	err = s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	return &a
+}
+
+func (s *S) units(c *gocheck.C, name string) int {
+	a := app.App{Name: name}
+	err := a.Get()
+	c.Assert(err, gocheck.IsNil)
+	return len(a.Units)
+}
+
+func (s *S) TestSaveRule(c *gocheck.C) {
+	rule := Rule{App: "myapp", Metric: "cpu", MinUnits: 1, MaxUnits: 5, ScaleUp: 80, ScaleDown: 20, Cooldown: 300}
+	err := SaveRule(&rule)
+	c.Assert(err, gocheck.IsNil)
+	got, err := GetRule("myapp")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(*got, gocheck.DeepEquals, rule)
+	rule.MaxUnits = 10
+	err = SaveRule(&rule)
+	c.Assert(err, gocheck.IsNil)
+	got, err = GetRule("myapp")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(got.MaxUnits, gocheck.Equals, uint(10))
+	count, err := collection(s.conn).Find(nil).Count()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(count, gocheck.Equals, 1)
+}
+
+func (s *S) TestSaveRuleUnknownMetric(c *gocheck.C) {
+	rule := Rule{App: "myapp", Metric: "disk", ScaleUp: 80}
+	err := SaveRule(&rule)
+	c.Assert(err, gocheck.ErrorMatches, `Unknown metric: "disk".`)
+}
+
+func (s *S) TestSaveRuleMinGreaterThanMax(c *gocheck.C) {
+	rule := Rule{App: "myapp", Metric: "cpu", MinUnits: 5, MaxUnits: 2}
+	err := SaveRule(&rule)
+	c.Assert(err, gocheck.ErrorMatches, "The minimum number of units must not be greater than the maximum.")
+}
+
+func (s *S) TestSaveRuleInvalidThresholds(c *gocheck.C) {
+	rule := Rule{App: "myapp", Metric: "cpu", ScaleUp: 20, ScaleDown: 80}
+	err := SaveRule(&rule)
+	c.Assert(err, gocheck.ErrorMatches, "The scale down threshold must be lower than the scale up threshold.")
+}
+
+func (s *S) TestGetRuleNotFound(c *gocheck.C) {
+	_, err := GetRule("unknown")
+	c.Assert(err, gocheck.Equals, ErrRuleNotFound)
+}
+
+func (s *S) TestRemoveRule(c *gocheck.C) {
+	rule := Rule{App: "myapp", Metric: "cpu"}
+	err := SaveRule(&rule)
+	c.Assert(err, gocheck.IsNil)
+	err = RemoveRule("myapp")
+	c.Assert(err, gocheck.IsNil)
+	_, err = GetRule("myapp")
+	c.Assert(err, gocheck.Equals, ErrRuleNotFound)
+}
+
+func (s *S) TestRemoveRuleNotFound(c *gocheck.C) {
+	err := RemoveRule("unknown")
+	c.Assert(err, gocheck.Equals, ErrRuleNotFound)
+}
+
+func (s *S) TestScaleUp(c *gocheck.C) {
+	a := s.createApp(c, "myapp", 2)
+	defer s.provisioner.Destroy(a)
+	s.source.Set("myapp/0", Metrics{CPU: 90})
+	s.source.Set("myapp/1", Metrics{CPU: 70})
+	rule := Rule{App: "myapp", Metric: "cpu", MaxUnits: 5, ScaleUp: 75, ScaleDown: 20}
+	err := SaveRule(&rule)
+	c.Assert(err, gocheck.IsNil)
+	err = scale(&rule, s.source)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(s.units(c, "myapp"), gocheck.Equals, 3)
+	c.Assert(s.provisioner.GetUnits(a), gocheck.HasLen, 3)
+	got, err := GetRule("myapp")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(got.LastScale.IsZero(), gocheck.Equals, false)
+}
+
+func (s *S) TestScaleUpRespectsMaxUnits(c *gocheck.C) {
+	a := s.createApp(c, "myapp", 2)
+	defer s.provisioner.Destroy(a)
+	s.source.Set("myapp/0", Metrics{CPU: 90})
+	s.source.Set("myapp/1", Metrics{CPU: 90})
+	rule := Rule{App: "myapp", Metric: "cpu", MaxUnits: 2, ScaleUp: 75}
+	err := SaveRule(&rule)
+	c.Assert(err, gocheck.IsNil)
+	err = scale(&rule, s.source)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(s.units(c, "myapp"), gocheck.Equals, 2)
+}
+
+func (s *S) TestScaleUpRespectsQuota(c *gocheck.C) {
+	a := s.createApp(c, "myapp", 2)
+	defer s.provisioner.Destroy(a)
+	err := quota.Create("myapp", 2)
+	c.Assert(err, gocheck.IsNil)
+	err = quota.Reserve("myapp", "myapp-0", "myapp-1")
+	c.Assert(err, gocheck.IsNil)
+	s.source.Set("myapp/0", Metrics{Requests: 300})
+	s.source.Set("myapp/1", Metrics{Requests: 500})
+	rule := Rule{App: "myapp", Metric: "requests", ScaleUp: 100}
+	err = SaveRule(&rule)
+	c.Assert(err, gocheck.IsNil)
+	err = scale(&rule, s.source)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(s.units(c, "myapp"), gocheck.Equals, 2)
+	got, err := GetRule("myapp")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(got.LastScale.IsZero(), gocheck.Equals, true)
+}
+
+func (s *S) TestScaleDown(c *gocheck.C) {
+	a := s.createApp(c, "myapp", 3)
+	defer s.provisioner.Destroy(a)
+	s.source.Set("myapp/0", Metrics{Memory: 10})
+	s.source.Set("myapp/1", Metrics{Memory: 15})
+	s.source.Set("myapp/2", Metrics{Memory: 20})
+	rule := Rule{App: "myapp", Metric: "memory", MinUnits: 1, ScaleUp: 80, ScaleDown: 30}
+	err := SaveRule(&rule)
+	c.Assert(err, gocheck.IsNil)
+	err = scale(&rule, s.source)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(s.units(c, "myapp"), gocheck.Equals, 2)
+}
+
+func (s *S) TestScaleDownRespectsMinUnits(c *gocheck.C) {
+	a := s.createApp(c, "myapp", 2)
+	defer s.provisioner.Destroy(a)
+	s.source.Set("myapp/0", Metrics{CPU: 5})
+	s.source.Set("myapp/1", Metrics{CPU: 5})
+	rule := Rule{App: "myapp", Metric: "cpu", MinUnits: 2, ScaleUp: 80, ScaleDown: 30}
+	err := SaveRule(&rule)
+	c.Assert(err, gocheck.IsNil)
+	err = scale(&rule, s.source)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(s.units(c, "myapp"), gocheck.Equals, 2)
+}
+
+func (s *S) TestScaleToMinUnits(c *gocheck.C) {
+	a := s.createApp(c, "myapp", 1)
+	defer s.provisioner.Destroy(a)
+	rule := Rule{App: "myapp", Metric: "cpu", MinUnits: 3, ScaleUp: 80}
+	err := SaveRule(&rule)
+	c.Assert(err, gocheck.IsNil)
+	err = scale(&rule, s.source)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(s.units(c, "myapp"), gocheck.Equals, 3)
+}
+
+func (s *S) TestScaleRespectsCooldown(c *gocheck.C) {
+	a := s.createApp(c, "myapp", 2)
+	defer s.provisioner.Destroy(a)
+	s.source.Set("myapp/0", Metrics{CPU: 90})
+	s.source.Set("myapp/1", Metrics{CPU: 90})
+	rule := Rule{App: "myapp", Metric: "cpu", ScaleUp: 75, Cooldown: 300, LastScale: time.Now().Add(-time.Minute)}
+	err := SaveRule(&rule)
+	c.Assert(err, gocheck.IsNil)
+	err = scale(&rule, s.source)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(s.units(c, "myapp"), gocheck.Equals, 2)
+	rule.LastScale = time.Now().Add(-10 * time.Minute)
+	err = scale(&rule, s.source)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(s.units(c, "myapp"), gocheck.Equals, 3)
+}
+
+func (s *S) TestScaleWithoutMetrics(c *gocheck.C) {
+	a := s.createApp(c, "myapp", 2)
+	defer s.provisioner.Destroy(a)
+	rule := Rule{App: "myapp", Metric: "cpu", ScaleUp: 75, ScaleDown: 20}
+	err := SaveRule(&rule)
+	c.Assert(err, gocheck.IsNil)
+	err = scale(&rule, s.source)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(s.units(c, "myapp"), gocheck.Equals, 2)
+}
+
+func (s *S) TestScaleIgnoresUnitsWithoutMetrics(c *gocheck.C) {
+	a := s.createApp(c, "myapp", 2)
+	defer s.provisioner.Destroy(a)
+	s.source.Set("myapp/1", Metrics{CPU: 90})
+	rule := Rule{App: "myapp", Metric: "cpu", ScaleUp: 75}
+	err := SaveRule(&rule)
+	c.Assert(err, gocheck.IsNil)
+	err = scale(&rule, s.source)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(s.units(c, "myapp"), gocheck.Equals, 3)
+}
+
+func (s *S) TestScaleAppNotFound(c *gocheck.C) {
+	rule := Rule{App: "unknown", Metric: "cpu", ScaleUp: 75}
+	err := scale(&rule, s.source)
+	c.Assert(err, gocheck.ErrorMatches, `app "unknown" not found`)
+}
+
+func (s *S) TestRun(c *gocheck.C) {
+	a := s.createApp(c, "myapp", 1)
+	defer s.provisioner.Destroy(a)
+	s.source.Set("myapp/0", Metrics{CPU: 90})
+	rule := Rule{App: "myapp", Metric: "cpu", ScaleUp: 75}
+	err := SaveRule(&rule)
+	c.Assert(err, gocheck.IsNil)
+	ch := make(chan time.Time)
+	done := make(chan bool)
+	go func() {
+		run(ch, s.source)
+		close(done)
+	}()
+	ch <- time.Now()
+	close(ch)
+	<-done
+	c.Assert(s.units(c, "myapp"), gocheck.Equals, 2)
+}
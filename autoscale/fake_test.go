@@ -0,0 +1,46 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package autoscale
+
+import (
+	"fmt"
+	"github.com/globocom/tsuru/provision"
+	"sync"
+)
+
+// FakeSource is a metrics source that returns the metrics defined with the Set
+// method.
+type FakeSource struct {
+	metrics map[string]Metrics
+	mut     sync.Mutex
+}
+
+func NewFakeSource() *FakeSource {
+	return &FakeSource{metrics: make(map[string]Metrics)}
+}
+
+// Set defines the metrics returned for the unit with the given name.
+func (s *FakeSource) Set(unit string, m Metrics) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	s.metrics[unit] = m
+}
+
+// Reset removes all metrics defined in the source.
+func (s *FakeSource) Reset() {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	s.metrics = make(map[string]Metrics)
+}
+
+func (s *FakeSource) Metrics(app provision.App, unit provision.AppUnit) (*Metrics, error) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	m, ok := s.metrics[unit.GetName()]
+	if !ok {
+		return nil, fmt.Errorf("No metrics for the unit %q.", unit.GetName())
+	}
+	return &m, nil
+}
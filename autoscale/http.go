@@ -0,0 +1,75 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package autoscale
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/globocom/config"
+	"github.com/globocom/tsuru/provision"
+	"net"
+	"net/http"
+	"time"
+)
+
+func init() {
+	Register("http", &HTTPSource{})
+}
+
+// httpTimeout is the timeout for sampling the metrics of a unit.
+const httpTimeout = 5 * time.Second
+
+var httpClient = &http.Client{
+	Transport: &http.Transport{
+		Dial: func(network, addr string) (net.Conn, error) {
+			return net.DialTimeout(network, addr, httpTimeout)
+		},
+		ResponseHeaderTimeout: httpTimeout,
+	},
+}
+
+// HTTPSource samples the metrics of a unit from an HTTP endpoint served by
+// the unit, in the port defined by the autoscale:http:port setting and the
+// path defined by autoscale:http:path (defaults to /tsuru/metrics). The
+// endpoint returns the metrics in JSON, like:
+//
+//	{"cpu": 42.5, "memory": 60, "requests": 120}
+type HTTPSource struct{}
+
+func (HTTPSource) url(unit provision.AppUnit) (string, error) {
+	if unit.GetIp() == "" {
+		return "", fmt.Errorf("The unit %q has no IP.", unit.GetName())
+	}
+	port, err := config.GetInt("autoscale:http:port")
+	if err != nil {
+		return "", errors.New(`The setting "autoscale:http:port" is not defined.`)
+	}
+	path, err := config.GetString("autoscale:http:path")
+	if err != nil {
+		path = "/tsuru/metrics"
+	}
+	return fmt.Sprintf("http://%s:%d%s", unit.GetIp(), port, path), nil
+}
+
+func (s *HTTPSource) Metrics(app provision.App, unit provision.AppUnit) (*Metrics, error) {
+	url, err := s.url(unit)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := httpClient.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Failed to get the metrics of the unit %q: unexpected status code %d.", unit.GetName(), resp.StatusCode)
+	}
+	var m Metrics
+	if err := json.NewDecoder(resp.Body).Decode(&m); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
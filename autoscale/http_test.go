@@ -0,0 +1,57 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package autoscale
+
+import (
+	"github.com/globocom/config"
+	"github.com/globocom/tsuru/app"
+	"launchpad.net/gocheck"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+)
+
+func (s *S) TestHTTPSourceMetrics(c *gocheck.C) {
+	var path string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		w.Write([]byte(`{"cpu": 42.5, "memory": 60, "requests": 120}`))
+	}))
+	defer server.Close()
+	host, port, err := net.SplitHostPort(server.Listener.Addr().String())
+	c.Assert(err, gocheck.IsNil)
+	p, err := strconv.Atoi(port)
+	c.Assert(err, gocheck.IsNil)
+	config.Set("autoscale:http:port", p)
+	defer config.Unset("autoscale:http:port")
+	var source HTTPSource
+	m, err := source.Metrics(&app.App{Name: "myapp"}, &app.Unit{Name: "myapp/0", Ip: host})
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(*m, gocheck.DeepEquals, Metrics{CPU: 42.5, Memory: 60, Requests: 120})
+	c.Assert(path, gocheck.Equals, "/tsuru/metrics")
+}
+
+func (s *S) TestHTTPSourceMetricsErrorStatus(c *gocheck.C) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+	host, port, err := net.SplitHostPort(server.Listener.Addr().String())
+	c.Assert(err, gocheck.IsNil)
+	p, err := strconv.Atoi(port)
+	c.Assert(err, gocheck.IsNil)
+	config.Set("autoscale:http:port", p)
+	defer config.Unset("autoscale:http:port")
+	var source HTTPSource
+	_, err = source.Metrics(&app.App{Name: "myapp"}, &app.Unit{Name: "myapp/0", Ip: host})
+	c.Assert(err, gocheck.ErrorMatches, `Failed to get the metrics of the unit "myapp/0": unexpected status code 500.`)
+}
+
+func (s *S) TestHTTPSourceMetricsWithoutPort(c *gocheck.C) {
+	var source HTTPSource
+	_, err := source.Metrics(&app.App{Name: "myapp"}, &app.Unit{Name: "myapp/0", Ip: "10.0.0.1"})
+	c.Assert(err, gocheck.ErrorMatches, `The setting "autoscale:http:port" is not defined.`)
+}
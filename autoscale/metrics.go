@@ -0,0 +1,58 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package autoscale
+
+import (
+	"fmt"
+	"github.com/globocom/tsuru/provision"
+)
+
+// Metrics holds the values sampled from a unit.
+type Metrics struct {
+	// CPU usage of the unit, in percentage.
+	CPU float64
+
+	// Memory usage of the unit, in percentage of the available memory.
+	Memory float64
+
+	// Requests is the number of requests per second handled by the unit.
+	Requests float64
+}
+
+// value returns the value of the named metric.
+func (m *Metrics) value(metric string) (float64, error) {
+	switch metric {
+	case "cpu":
+		return m.CPU, nil
+	case "memory":
+		return m.Memory, nil
+	case "requests":
+		return m.Requests, nil
+	}
+	return 0, fmt.Errorf("Unknown metric: %q.", metric)
+}
+
+// MetricsSource is the interface that must be satisfied by anything that
+// is able to sample metrics from the units of an app.
+type MetricsSource interface {
+	// Metrics returns the current metrics of the given unit.
+	Metrics(app provision.App, unit provision.AppUnit) (*Metrics, error)
+}
+
+var sources = make(map[string]MetricsSource)
+
+// Register registers a new metrics source in the registry.
+func Register(name string, s MetricsSource) {
+	sources[name] = s
+}
+
+// Get gets the named metrics source from the registry.
+func Get(name string) (MetricsSource, error) {
+	s, ok := sources[name]
+	if !ok {
+		return nil, fmt.Errorf("Unknown metrics source: %q.", name)
+	}
+	return s, nil
+}
@@ -0,0 +1,64 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package autoscale
+
+import (
+	"github.com/globocom/tsuru/app"
+	"launchpad.net/gocheck"
+)
+
+func (s *S) TestMetricsValue(c *gocheck.C) {
+	m := Metrics{CPU: 10, Memory: 20, Requests: 30}
+	var tests = []struct {
+		metric   string
+		expected float64
+	}{
+		{"cpu", 10},
+		{"memory", 20},
+		{"requests", 30},
+	}
+	for _, t := range tests {
+		value, err := m.value(t.metric)
+		c.Check(err, gocheck.IsNil)
+		c.Check(value, gocheck.Equals, t.expected)
+	}
+}
+
+func (s *S) TestMetricsValueUnknownMetric(c *gocheck.C) {
+	m := Metrics{}
+	_, err := m.value("disk")
+	c.Assert(err, gocheck.ErrorMatches, `Unknown metric: "disk".`)
+}
+
+func (s *S) TestRegisterAndGet(c *gocheck.C) {
+	source := NewFakeSource()
+	Register("my-source", source)
+	defer delete(sources, "my-source")
+	got, err := Get("my-source")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(got, gocheck.Equals, source)
+}
+
+func (s *S) TestGetUnknownSource(c *gocheck.C) {
+	_, err := Get("unknown")
+	c.Assert(err, gocheck.ErrorMatches, `Unknown metrics source: "unknown".`)
+}
+
+func (s *S) TestHTTPSourceIsRegistered(c *gocheck.C) {
+	source, err := Get("http")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(source, gocheck.FitsTypeOf, &HTTPSource{})
+}
+
+func (s *S) TestFakeSourceMetrics(c *gocheck.C) {
+	source := NewFakeSource()
+	source.Set("myapp/0", Metrics{CPU: 42})
+	a := app.App{Name: "myapp"}
+	m, err := source.Metrics(&a, &app.Unit{Name: "myapp/0"})
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(*m, gocheck.DeepEquals, Metrics{CPU: 42})
+	_, err = source.Metrics(&a, &app.Unit{Name: "myapp/1"})
+	c.Assert(err, gocheck.ErrorMatches, `No metrics for the unit "myapp/1".`)
+}
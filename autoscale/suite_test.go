@@ -0,0 +1,54 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package autoscale
+
+import (
+	"github.com/globocom/config"
+	"github.com/globocom/tsuru/app"
+	"github.com/globocom/tsuru/db"
+	"github.com/globocom/tsuru/queue"
+	ttesting "github.com/globocom/tsuru/testing"
+	"launchpad.net/gocheck"
+	"testing"
+)
+
+func Test(t *testing.T) { gocheck.TestingT(t) }
+
+type S struct {
+	conn        *db.Storage
+	provisioner *ttesting.FakeProvisioner
+	source      *FakeSource
+}
+
+var _ = gocheck.Suite(&S{})
+
+func (s *S) SetUpSuite(c *gocheck.C) {
+	var err error
+	config.Set("database:url", "127.0.0.1:27017")
+	config.Set("database:name", "tsuru_autoscale_test")
+	config.Set("queue", "fake")
+	s.conn, err = db.Conn()
+	c.Assert(err, gocheck.IsNil)
+	s.provisioner = ttesting.NewFakeProvisioner()
+	app.Provisioner = s.provisioner
+	s.source = NewFakeSource()
+}
+
+func (s *S) TearDownSuite(c *gocheck.C) {
+	s.conn.Apps().Database.DropDatabase()
+	s.conn.Close()
+	queue.Preempt()
+}
+
+func (s *S) TearDownTest(c *gocheck.C) {
+	_, err := s.conn.Apps().RemoveAll(nil)
+	c.Assert(err, gocheck.IsNil)
+	_, err = collection(s.conn).RemoveAll(nil)
+	c.Assert(err, gocheck.IsNil)
+	_, err = s.conn.Quota().RemoveAll(nil)
+	c.Assert(err, gocheck.IsNil)
+	s.provisioner.Reset()
+	s.source.Reset()
+}
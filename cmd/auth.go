@@ -6,6 +6,8 @@ package cmd
 
 import (
 	"bytes"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -13,9 +15,14 @@ import (
 	"io"
 	"io/ioutil"
 	"launchpad.net/gnuflag"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
+	"os/exec"
+	"runtime"
 	"sort"
+	"strings"
 )
 
 type userCreate struct{}
@@ -107,7 +114,20 @@ func (c *userRemove) Info() *Info {
 type login struct{}
 
 func (c *login) Run(context *Context, client *Client) error {
-	email := context.Args[0]
+	if len(context.Args) > 0 {
+		return c.passwordLogin(context, client, context.Args[0])
+	}
+	scheme, err := authScheme(client)
+	if err != nil {
+		return err
+	}
+	if scheme.Name == "oauth" {
+		return c.oauthLogin(context, client, scheme.Data)
+	}
+	return errors.New("You must provide your email to login.")
+}
+
+func (c *login) passwordLogin(context *Context, client *Client, email string) error {
 	url, err := GetURL("/users/" + email + "/tokens")
 	if err != nil {
 		return err
@@ -123,31 +143,174 @@ func (c *login) Run(context *Context, client *Client) error {
 	if err != nil {
 		return err
 	}
-	response, err := client.Do(request)
+	token, err := requestToken(client, request)
 	if err != nil {
 		return err
 	}
-	defer response.Body.Close()
-	result, err := ioutil.ReadAll(response.Body)
+	fmt.Fprintln(context.Stdout, "Successfully logged in!")
+	return writeToken(token)
+}
+
+// oauthState returns a random value for the state parameter of the OAuth
+// flow.
+func oauthState() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// oauthLogin sends the user to the authorization server, in the browser, and
+// waits for the callback with the authorization code in a local server. The
+// code is then exchanged for a tsuru token. Callbacks without the state sent
+// to the authorization server are refused.
+func (c *login) oauthLogin(context *Context, client *Client, data map[string]string) error {
+	state, err := oauthState()
 	if err != nil {
 		return err
 	}
-	out := make(map[string]string)
-	err = json.Unmarshal(result, &out)
+	listener, err := net.Listen("tcp", "127.0.0.1:"+data["port"])
 	if err != nil {
 		return err
 	}
+	defer listener.Close()
+	redirectURL := "http://" + listener.Addr().String()
+	authorizeURL := strings.Replace(data["authorizeUrl"], "__redirect_url__", url.QueryEscape(redirectURL), 1)
+	if strings.Contains(authorizeURL, "__state__") {
+		authorizeURL = strings.Replace(authorizeURL, "__state__", state, 1)
+	} else {
+		authorizeURL += "&state=" + state
+	}
+	finish := make(chan error, 1)
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.URL.Query().Get("state") != state {
+			http.Error(w, "Login failed: invalid state.", http.StatusBadRequest)
+			return
+		}
+		err := c.exchangeCode(client, r.URL.Query(), redirectURL)
+		if err != nil {
+			fmt.Fprintf(w, "Login failed: %s", err)
+		} else {
+			fmt.Fprint(w, "Successfully logged in! You can close this window now.")
+		}
+		select {
+		case finish <- err:
+		default:
+		}
+	}
+	go http.Serve(listener, http.HandlerFunc(handler))
+	fmt.Fprintf(context.Stdout, "Open the following URL in your browser to login:\n\n%s\n\n", authorizeURL)
+	openBrowser(authorizeURL)
+	if err := <-finish; err != nil {
+		return err
+	}
 	fmt.Fprintln(context.Stdout, "Successfully logged in!")
-	return writeToken(out["token"])
+	return nil
+}
+
+// exchangeCode sends the authorization code received in the callback to the
+// tsuru server and stores the token returned by it.
+func (c *login) exchangeCode(client *Client, query url.Values, redirectURL string) error {
+	code := query.Get("code")
+	if code == "" {
+		if e := query.Get("error"); e != "" {
+			return fmt.Errorf("The authorization server returned an error: %s", e)
+		}
+		return errors.New("The authorization server did not return the code.")
+	}
+	loginURL, err := GetURL("/auth/login")
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(map[string]string{"code": code, "redirectUrl": redirectURL})
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequest("POST", loginURL, bytes.NewBuffer(body))
+	if err != nil {
+		return err
+	}
+	token, err := requestToken(client, request)
+	if err != nil {
+		return err
+	}
+	return writeToken(token)
 }
 
 func (c *login) Info() *Info {
 	return &Info{
 		Name:    "login",
-		Usage:   "login <email>",
+		Usage:   "login [email]",
 		Desc:    "log in with your credentials.",
-		MinArgs: 1,
+		MinArgs: 0,
+	}
+}
+
+// requestToken sends the login request to the tsuru server and returns the
+// token from the response.
+func requestToken(client *Client, request *http.Request) (string, error) {
+	response, err := client.Do(request)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+	result, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return "", err
 	}
+	out := make(map[string]string)
+	err = json.Unmarshal(result, &out)
+	if err != nil {
+		return "", err
+	}
+	return out["token"], nil
+}
+
+type scheme struct {
+	Name string
+	Data map[string]string
+}
+
+// authScheme returns the authentication scheme used by the tsuru server.
+func authScheme(client *Client) (*scheme, error) {
+	url, err := GetURL("/auth/scheme")
+	if err != nil {
+		return nil, err
+	}
+	request, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	var s scheme
+	err = json.NewDecoder(response.Body).Decode(&s)
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// openBrowser opens the given URL in the default browser of the user.
+var openBrowser = func(url string) error {
+	var args []string
+	switch runtime.GOOS {
+	case "darwin":
+		args = []string{"open", url}
+	case "windows":
+		args = []string{"cmd", "/c", "start", url}
+	default:
+		args = []string{"xdg-open", url}
+	}
+	return exec.Command(args[0], args[1:]...).Start()
 }
 
 type logout struct{}
@@ -12,6 +12,7 @@ import (
 	"io"
 	"launchpad.net/gocheck"
 	"net/http"
+	"net/url"
 	"os"
 	"path"
 	"path/filepath"
@@ -63,6 +64,124 @@ func (s *S) TestLoginShouldReturnErrorIfThePasswordIsNotGiven(c *gocheck.C) {
 	c.Assert(err, gocheck.ErrorMatches, "^You must provide the password!$")
 }
 
+func (s *S) TestLoginInfo(c *gocheck.C) {
+	expected := &Info{
+		Name:    "login",
+		Usage:   "login [email]",
+		Desc:    "log in with your credentials.",
+		MinArgs: 0,
+	}
+	c.Assert((&login{}).Info(), gocheck.DeepEquals, expected)
+}
+
+// oauthTransport fakes the tsuru server in the OAuth login flow.
+type oauthTransport struct {
+	scheme string
+	body   map[string]string
+}
+
+func (t *oauthTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var message string
+	switch req.URL.Path {
+	case "/auth/scheme":
+		message = t.scheme
+	case "/auth/login":
+		json.NewDecoder(req.Body).Decode(&t.body)
+		message = `{"token":"oauthtoken"}`
+	}
+	transport := ttesting.Transport{Message: message, Status: http.StatusOK}
+	return transport.RoundTrip(req)
+}
+
+func (s *S) TestLoginWithOAuth(c *gocheck.C) {
+	rfs := &testing.RecordingFs{}
+	fsystem = rfs
+	defer func() {
+		fsystem = nil
+	}()
+	writeTarget("http://localhost")
+	var authorizeURL string
+	old := openBrowser
+	openBrowser = func(u string) error {
+		authorizeURL = u
+		parsed, err := url.Parse(u)
+		c.Assert(err, gocheck.IsNil)
+		query := parsed.Query()
+		resp, err := http.Get(query.Get("redirect_uri") + "/?code=xyz&state=" + query.Get("state"))
+		c.Assert(err, gocheck.IsNil)
+		resp.Body.Close()
+		return nil
+	}
+	defer func() {
+		openBrowser = old
+	}()
+	transport := oauthTransport{
+		scheme: `{"name":"oauth","data":{"authorizeUrl":"https://auth.tsuru.io/authorize?client_id=tsuru&redirect_uri=__redirect_url__&state=__state__","port":"0"}}`,
+	}
+	client := NewClient(&http.Client{Transport: &transport}, nil, manager)
+	context := Context{[]string{}, manager.stdout, manager.stderr, manager.stdin}
+	command := login{}
+	err := command.Run(&context, client)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(authorizeURL, gocheck.Matches, `^https://auth.tsuru.io/authorize\?client_id=tsuru&redirect_uri=http%3A%2F%2F127.0.0.1%3A\d+&state=[0-9a-f]{32}$`)
+	c.Assert(transport.body["code"], gocheck.Equals, "xyz")
+	c.Assert(transport.body["redirectUrl"], gocheck.Matches, `^http://127.0.0.1:\d+$`)
+	c.Assert(manager.stdout.(*bytes.Buffer).String(), gocheck.Matches, `(?s).*Successfully logged in!\n$`)
+	token, err := readToken()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(token, gocheck.Equals, "oauthtoken")
+}
+
+func (s *S) TestLoginWithOAuthRefusesCallbacksWithInvalidState(c *gocheck.C) {
+	rfs := &testing.RecordingFs{}
+	fsystem = rfs
+	defer func() {
+		fsystem = nil
+	}()
+	writeTarget("http://localhost")
+	var status int
+	old := openBrowser
+	openBrowser = func(u string) error {
+		parsed, err := url.Parse(u)
+		c.Assert(err, gocheck.IsNil)
+		query := parsed.Query()
+		resp, err := http.Get(query.Get("redirect_uri") + "/?code=evil&state=other")
+		c.Assert(err, gocheck.IsNil)
+		resp.Body.Close()
+		status = resp.StatusCode
+		resp, err = http.Get(query.Get("redirect_uri") + "/?code=xyz&state=" + query.Get("state"))
+		c.Assert(err, gocheck.IsNil)
+		resp.Body.Close()
+		return nil
+	}
+	defer func() {
+		openBrowser = old
+	}()
+	transport := oauthTransport{
+		scheme: `{"name":"oauth","data":{"authorizeUrl":"https://auth.tsuru.io/authorize?client_id=tsuru&redirect_uri=__redirect_url__","port":"0"}}`,
+	}
+	client := NewClient(&http.Client{Transport: &transport}, nil, manager)
+	context := Context{[]string{}, manager.stdout, manager.stderr, manager.stdin}
+	command := login{}
+	err := command.Run(&context, client)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(status, gocheck.Equals, http.StatusBadRequest)
+	c.Assert(transport.body["code"], gocheck.Equals, "xyz")
+}
+
+func (s *S) TestLoginWithoutEmail(c *gocheck.C) {
+	fsystem = &testing.RecordingFs{FileContent: "http://localhost"}
+	defer func() {
+		fsystem = nil
+	}()
+	transport := ttesting.Transport{Message: `{"name":"native","data":null}`, Status: http.StatusOK}
+	client := NewClient(&http.Client{Transport: &transport}, nil, manager)
+	context := Context{[]string{}, manager.stdout, manager.stderr, manager.stdin}
+	command := login{}
+	err := command.Run(&context, client)
+	c.Assert(err, gocheck.ErrorMatches, "^You must provide your email to login.$")
+}
+
 func (s *S) TestLogout(c *gocheck.C) {
 	var called bool
 	rfs := &testing.RecordingFs{}
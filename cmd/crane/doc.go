@@ -98,7 +98,7 @@ Authenticate within remote crane server
 
 Usage:
 
-	% crane login <email>
+	% crane login [email]
 
 Login will ask for the password and check if the user is successfully
 authenticated. If so, the token generated by the crane server will be stored in
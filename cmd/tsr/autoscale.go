@@ -0,0 +1,39 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"github.com/globocom/tsuru/autoscale"
+	"github.com/globocom/tsuru/cmd"
+	"launchpad.net/gnuflag"
+)
+
+type autoscaleCmd struct {
+	fs  *gnuflag.FlagSet
+	dry bool
+}
+
+func (c *autoscaleCmd) Run(context *cmd.Context, client *cmd.Client) error {
+	autoscale.Run(c.dry)
+	return nil
+}
+
+func (autoscaleCmd) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:    "autoscale",
+		Usage:   "autoscale",
+		Desc:    "Starts the tsuru autoscaler.",
+		MinArgs: 0,
+	}
+}
+
+func (c *autoscaleCmd) Flags() *gnuflag.FlagSet {
+	if c.fs == nil {
+		c.fs = gnuflag.NewFlagSet("autoscale", gnuflag.ExitOnError)
+		c.fs.BoolVar(&c.dry, "dry", false, "dry-run: does not run the autoscaler (for testing purpose)")
+		c.fs.BoolVar(&c.dry, "d", false, "dry-run: does not run the autoscaler (for testing purpose)")
+	}
+	return c.fs
+}
@@ -0,0 +1,44 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"github.com/globocom/tsuru/cmd"
+	"launchpad.net/gocheck"
+)
+
+func (s *S) TestAutoscaleCmdInfo(c *gocheck.C) {
+	expected := &cmd.Info{
+		Name:    "autoscale",
+		Usage:   "autoscale",
+		Desc:    "Starts the tsuru autoscaler.",
+		MinArgs: 0,
+	}
+	c.Assert(autoscaleCmd{}.Info(), gocheck.DeepEquals, expected)
+}
+
+func (s *S) TestAutoscaleCmdIsACommand(c *gocheck.C) {
+	var _ cmd.FlaggedCommand = &autoscaleCmd{}
+}
+
+func (s *S) TestAutoscaleCmdFlags(c *gocheck.C) {
+	command := autoscaleCmd{}
+	flagset := command.Flags()
+	c.Assert(flagset, gocheck.NotNil)
+	flagset.Parse(true, []string{"--dry", "true"})
+	flag := flagset.Lookup("dry")
+	c.Assert(flag, gocheck.NotNil)
+	c.Assert(flag.Name, gocheck.Equals, "dry")
+	c.Assert(flag.Usage, gocheck.Equals, "dry-run: does not run the autoscaler (for testing purpose)")
+	c.Assert(flag.Value.String(), gocheck.Equals, "true")
+	c.Assert(flag.DefValue, gocheck.Equals, "false")
+	flagset.Parse(true, []string{"-d", "true"})
+	flag = flagset.Lookup("d")
+	c.Assert(flag, gocheck.NotNil)
+	c.Assert(flag.Name, gocheck.Equals, "d")
+	c.Assert(flag.Usage, gocheck.Equals, "dry-run: does not run the autoscaler (for testing purpose)")
+	c.Assert(flag.Value.String(), gocheck.Equals, "true")
+	c.Assert(flag.DefValue, gocheck.Equals, "false")
+}
@@ -0,0 +1,57 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"github.com/globocom/config"
+	"github.com/globocom/tsuru/app"
+	"github.com/globocom/tsuru/cmd"
+	"github.com/globocom/tsuru/log"
+	"launchpad.net/gnuflag"
+	"time"
+)
+
+type logJanitorCmd struct {
+	fs  *gnuflag.FlagSet
+	dry bool
+}
+
+func (c *logJanitorCmd) Run(context *cmd.Context, client *cmd.Client) error {
+	retention, err := app.DefaultLogRetention()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(context.Stdout, "Using the retention max-age=%q max-entries=%d.\n", retention.MaxAge, retention.MaxEntries)
+	if c.dry {
+		return nil
+	}
+	log.Init()
+	interval, err := config.GetInt("app-log:retention:interval")
+	if err != nil {
+		interval = 3600
+	}
+	fmt.Fprintln(context.Stdout, "tsuru log janitor started...")
+	app.RunLogJanitor(time.Tick(time.Duration(interval) * time.Second))
+	return nil
+}
+
+func (logJanitorCmd) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:    "log-janitor",
+		Usage:   "log-janitor",
+		Desc:    "Starts the tsuru log janitor, that removes the app logs beyond their retention.",
+		MinArgs: 0,
+	}
+}
+
+func (c *logJanitorCmd) Flags() *gnuflag.FlagSet {
+	if c.fs == nil {
+		c.fs = gnuflag.NewFlagSet("log-janitor", gnuflag.ExitOnError)
+		c.fs.BoolVar(&c.dry, "dry", false, "dry-run: does not run the janitor (for testing purpose)")
+		c.fs.BoolVar(&c.dry, "d", false, "dry-run: does not run the janitor (for testing purpose)")
+	}
+	return c.fs
+}
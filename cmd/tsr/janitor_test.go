@@ -0,0 +1,63 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"github.com/globocom/config"
+	"github.com/globocom/tsuru/cmd"
+	"launchpad.net/gocheck"
+)
+
+func (s *S) TestLogJanitorCmdInfo(c *gocheck.C) {
+	expected := &cmd.Info{
+		Name:    "log-janitor",
+		Usage:   "log-janitor",
+		Desc:    "Starts the tsuru log janitor, that removes the app logs beyond their retention.",
+		MinArgs: 0,
+	}
+	c.Assert(logJanitorCmd{}.Info(), gocheck.DeepEquals, expected)
+}
+
+func (s *S) TestLogJanitorCmdIsACommand(c *gocheck.C) {
+	var _ cmd.FlaggedCommand = &logJanitorCmd{}
+}
+
+func (s *S) TestLogJanitorCmdFlags(c *gocheck.C) {
+	command := logJanitorCmd{}
+	flagset := command.Flags()
+	c.Assert(flagset, gocheck.NotNil)
+	flagset.Parse(true, []string{"--dry", "true"})
+	flag := flagset.Lookup("dry")
+	c.Assert(flag, gocheck.NotNil)
+	c.Assert(flag.Name, gocheck.Equals, "dry")
+	c.Assert(flag.Usage, gocheck.Equals, "dry-run: does not run the janitor (for testing purpose)")
+	c.Assert(flag.Value.String(), gocheck.Equals, "true")
+	c.Assert(flag.DefValue, gocheck.Equals, "false")
+	flagset.Parse(true, []string{"-d", "true"})
+	flag = flagset.Lookup("d")
+	c.Assert(flag, gocheck.NotNil)
+	c.Assert(flag.Name, gocheck.Equals, "d")
+	c.Assert(flag.Value.String(), gocheck.Equals, "true")
+}
+
+func (s *S) TestLogJanitorCmdRunDry(c *gocheck.C) {
+	config.Set("app-log:retention:max-age", "720h")
+	defer config.Unset("app-log:retention:max-age")
+	var stdout bytes.Buffer
+	command := logJanitorCmd{dry: true}
+	err := command.Run(&cmd.Context{Stdout: &stdout}, nil)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(stdout.String(), gocheck.Equals, "Using the retention max-age=\"720h\" max-entries=0.\n")
+}
+
+func (s *S) TestLogJanitorCmdRunInvalidRetention(c *gocheck.C) {
+	config.Set("app-log:retention:max-age", "a month")
+	defer config.Unset("app-log:retention:max-age")
+	var stdout bytes.Buffer
+	command := logJanitorCmd{dry: true}
+	err := command.Run(&cmd.Context{Stdout: &stdout}, nil)
+	c.Assert(err, gocheck.NotNil)
+}
@@ -19,6 +19,8 @@ func buildManager() *cmd.Manager {
 	m := cmd.NewManager("tsr", "0.2.0", "", os.Stdout, os.Stderr, os.Stdin)
 	m.Register(&tsrCommand{Command: &apiCmd{}})
 	m.Register(&tsrCommand{Command: &collectorCmd{}})
+	m.Register(&tsrCommand{Command: &autoscaleCmd{}})
+	m.Register(&tsrCommand{Command: &logJanitorCmd{}})
 	m.Register(&tsrCommand{Command: tokenCmd{}})
 	registerProvisionersCommands(m)
 	return m
@@ -49,6 +49,24 @@ func (s *S) TestCollectorCmdIsRegistered(c *gocheck.C) {
 	c.Assert(tsrCollector.Command, gocheck.FitsTypeOf, &collectorCmd{})
 }
 
+func (s *S) TestLogJanitorCmdIsRegistered(c *gocheck.C) {
+	manager := buildManager()
+	janitor, ok := manager.Commands["log-janitor"]
+	c.Assert(ok, gocheck.Equals, true)
+	tsrJanitor, ok := janitor.(*tsrCommand)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(tsrJanitor.Command, gocheck.FitsTypeOf, &logJanitorCmd{})
+}
+
+func (s *S) TestAutoscaleCmdIsRegistered(c *gocheck.C) {
+	manager := buildManager()
+	autoscale, ok := manager.Commands["autoscale"]
+	c.Assert(ok, gocheck.Equals, true)
+	tsrAutoscale, ok := autoscale.(*tsrCommand)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(tsrAutoscale.Command, gocheck.FitsTypeOf, &autoscaleCmd{})
+}
+
 func (s *S) TestTokenCmdIsRegistered(c *gocheck.C) {
 	manager := buildManager()
 	token, ok := manager.Commands["token"]
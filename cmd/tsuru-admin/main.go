@@ -22,6 +22,20 @@ func buildManager(name string) *cmd.Manager {
 	m.Register(&tsuru.SetCName{})
 	m.Register(&tsuru.UnsetCName{})
 	m.Register(&tokenGen{})
+	m.Register(&platformAdd{})
+	m.Register(&platformUpdate{})
+	m.Register(platformRemove{})
+	m.Register(&roleAdd{})
+	m.Register(&roleRemove{})
+	m.Register(roleList{})
+	m.Register(&logRetentionSet{})
+	m.Register(&queueDLQList{})
+	m.Register(queueDLQReplay{})
+	m.Register(&poolAdd{})
+	m.Register(poolRemove{})
+	m.Register(poolList{})
+	m.Register(poolTeamAdd{})
+	m.Register(poolTeamRemove{})
 	return m
 }
 
@@ -47,3 +47,82 @@ func (s *S) TestCommandsFromBaseManagerAreRegistered(c *gocheck.C) {
 		c.Assert(command, gocheck.FitsTypeOf, instance)
 	}
 }
+
+func (s *S) TestPlatformAddIsRegistered(c *gocheck.C) {
+	manager := buildManager("tsuru-admin")
+	add, ok := manager.Commands["platform-add"]
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(add, gocheck.FitsTypeOf, &platformAdd{})
+}
+
+func (s *S) TestPlatformUpdateIsRegistered(c *gocheck.C) {
+	manager := buildManager("tsuru-admin")
+	update, ok := manager.Commands["platform-update"]
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(update, gocheck.FitsTypeOf, &platformUpdate{})
+}
+
+func (s *S) TestPlatformRemoveIsRegistered(c *gocheck.C) {
+	manager := buildManager("tsuru-admin")
+	remove, ok := manager.Commands["platform-remove"]
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(remove, gocheck.FitsTypeOf, platformRemove{})
+}
+
+func (s *S) TestRoleAddIsRegistered(c *gocheck.C) {
+	manager := buildManager("tsuru-admin")
+	add, ok := manager.Commands["role-add"]
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(add, gocheck.FitsTypeOf, &roleAdd{})
+}
+
+func (s *S) TestRoleRemoveIsRegistered(c *gocheck.C) {
+	manager := buildManager("tsuru-admin")
+	remove, ok := manager.Commands["role-remove"]
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(remove, gocheck.FitsTypeOf, &roleRemove{})
+}
+
+func (s *S) TestRoleListIsRegistered(c *gocheck.C) {
+	manager := buildManager("tsuru-admin")
+	list, ok := manager.Commands["role-list"]
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(list, gocheck.FitsTypeOf, roleList{})
+}
+
+func (s *S) TestLogRetentionSetIsRegistered(c *gocheck.C) {
+	manager := buildManager("tsuru-admin")
+	set, ok := manager.Commands["log-retention-set"]
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(set, gocheck.FitsTypeOf, &logRetentionSet{})
+}
+
+func (s *S) TestQueueDLQListIsRegistered(c *gocheck.C) {
+	manager := buildManager("tsuru-admin")
+	list, ok := manager.Commands["queue-dlq-list"]
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(list, gocheck.FitsTypeOf, &queueDLQList{})
+}
+
+func (s *S) TestQueueDLQReplayIsRegistered(c *gocheck.C) {
+	manager := buildManager("tsuru-admin")
+	replay, ok := manager.Commands["queue-dlq-replay"]
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(replay, gocheck.FitsTypeOf, queueDLQReplay{})
+}
+
+func (s *S) TestPoolCommandsAreRegistered(c *gocheck.C) {
+	manager := buildManager("tsuru-admin")
+	expected := map[string]interface{}{
+		"pool-add":         &poolAdd{},
+		"pool-remove":      poolRemove{},
+		"pool-list":        poolList{},
+		"pool-team-add":    poolTeamAdd{},
+		"pool-team-remove": poolTeamRemove{},
+	}
+	for name, command := range expected {
+		registered, ok := manager.Commands[name]
+		c.Assert(ok, gocheck.Equals, true)
+		c.Assert(registered, gocheck.FitsTypeOf, command)
+	}
+}
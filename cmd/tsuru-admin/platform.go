@@ -0,0 +1,152 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"github.com/globocom/tsuru/cmd"
+	"io"
+	"launchpad.net/gnuflag"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// platformFlags holds the flags shared by platform-add and platform-update.
+type platformFlags struct {
+	dockerfile string
+	image      string
+	charm      string
+	fs         *gnuflag.FlagSet
+}
+
+func (f *platformFlags) flags(name string) *gnuflag.FlagSet {
+	if f.fs == nil {
+		f.fs = gnuflag.NewFlagSet(name, gnuflag.ExitOnError)
+		f.fs.StringVar(&f.dockerfile, "dockerfile", "", "URL of the Dockerfile used to build the base image of the platform")
+		f.fs.StringVar(&f.dockerfile, "d", "", "URL of the Dockerfile used to build the base image of the platform")
+		f.fs.StringVar(&f.image, "image", "", "Existing docker image used as the base image of the platform")
+		f.fs.StringVar(&f.image, "i", "", "Existing docker image used as the base image of the platform")
+		f.fs.StringVar(&f.charm, "charm", "", "Name of the juju charm used by the platform")
+		f.fs.StringVar(&f.charm, "c", "", "Name of the juju charm used by the platform")
+	}
+	return f.fs
+}
+
+func (f *platformFlags) values() url.Values {
+	v := url.Values{}
+	if f.dockerfile != "" {
+		v.Set("dockerfile", f.dockerfile)
+	}
+	if f.image != "" {
+		v.Set("image", f.image)
+	}
+	if f.charm != "" {
+		v.Set("charm", f.charm)
+	}
+	return v
+}
+
+func sendPlatform(method, path string, v url.Values, ctx *cmd.Context, client *cmd.Client) error {
+	u, err := cmd.GetURL(path)
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequest(method, u, strings.NewReader(v.Encode()))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, err = io.Copy(ctx.Stdout, resp.Body)
+	return err
+}
+
+type platformAdd struct {
+	platformFlags
+}
+
+func (c *platformAdd) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:    "platform-add",
+		Usage:   "platform-add <name> [--dockerfile url] [--image image] [--charm charm]",
+		Desc:    "Adds a new platform to tsuru.",
+		MinArgs: 1,
+	}
+}
+
+func (c *platformAdd) Run(ctx *cmd.Context, client *cmd.Client) error {
+	name := ctx.Args[0]
+	v := c.values()
+	v.Set("name", name)
+	if err := sendPlatform("POST", "/platforms", v, ctx, client); err != nil {
+		return err
+	}
+	fmt.Fprintf(ctx.Stdout, "\nPlatform %q successfully added!\n", name)
+	return nil
+}
+
+func (c *platformAdd) Flags() *gnuflag.FlagSet {
+	return c.flags("platform-add")
+}
+
+type platformUpdate struct {
+	platformFlags
+}
+
+func (c *platformUpdate) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:    "platform-update",
+		Usage:   "platform-update <name> [--dockerfile url] [--image image] [--charm charm]",
+		Desc:    "Updates a platform, rebuilding its base image. Apps use the new image in their next deploy.",
+		MinArgs: 1,
+	}
+}
+
+func (c *platformUpdate) Run(ctx *cmd.Context, client *cmd.Client) error {
+	name := ctx.Args[0]
+	if err := sendPlatform("PUT", "/platforms/"+name, c.values(), ctx, client); err != nil {
+		return err
+	}
+	fmt.Fprintf(ctx.Stdout, "\nPlatform %q successfully updated!\n", name)
+	return nil
+}
+
+func (c *platformUpdate) Flags() *gnuflag.FlagSet {
+	return c.flags("platform-update")
+}
+
+type platformRemove struct{}
+
+func (platformRemove) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:    "platform-remove",
+		Usage:   "platform-remove <name>",
+		Desc:    "Removes a platform from tsuru. Platforms used by apps can't be removed.",
+		MinArgs: 1,
+	}
+}
+
+func (platformRemove) Run(ctx *cmd.Context, client *cmd.Client) error {
+	name := ctx.Args[0]
+	u, err := cmd.GetURL("/platforms/" + name)
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequest("DELETE", u, nil)
+	if err != nil {
+		return err
+	}
+	_, err = client.Do(request)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(ctx.Stdout, "Platform %q successfully removed!\n", name)
+	return nil
+}
@@ -0,0 +1,146 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"github.com/globocom/tsuru/cmd"
+	"github.com/globocom/tsuru/cmd/testing"
+	"launchpad.net/gocheck"
+	"net/http"
+)
+
+func (s *S) TestPlatformAddInfo(c *gocheck.C) {
+	expected := &cmd.Info{
+		Name:    "platform-add",
+		Usage:   "platform-add <name> [--dockerfile url] [--image image] [--charm charm]",
+		Desc:    "Adds a new platform to tsuru.",
+		MinArgs: 1,
+	}
+	c.Assert((&platformAdd{}).Info(), gocheck.DeepEquals, expected)
+}
+
+func (s *S) TestPlatformAdd(c *gocheck.C) {
+	var called bool
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Args:   []string{"python"},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	manager := cmd.NewManager("glb", "0.2", "ad-ver", &stdout, &stderr, nil)
+	trans := testing.ConditionalTransport{
+		Transport: testing.Transport{Message: "building image...", Status: http.StatusOK},
+		CondFunc: func(req *http.Request) bool {
+			called = true
+			c.Assert(req.FormValue("name"), gocheck.Equals, "python")
+			c.Assert(req.FormValue("dockerfile"), gocheck.Equals, "http://example.com/Dockerfile")
+			c.Assert(req.FormValue("charm"), gocheck.Equals, "python")
+			return req.Method == "POST" && req.URL.Path == "/platforms"
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: &trans}, nil, manager)
+	command := platformAdd{}
+	command.Flags().Parse(true, []string{"--dockerfile", "http://example.com/Dockerfile", "-c", "python"})
+	err := command.Run(&context, client)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(called, gocheck.Equals, true)
+	c.Assert(stdout.String(), gocheck.Equals, "building image...\nPlatform \"python\" successfully added!\n")
+}
+
+func (s *S) TestPlatformAddFlags(c *gocheck.C) {
+	command := platformAdd{}
+	flagset := command.Flags()
+	c.Assert(flagset, gocheck.NotNil)
+	flagset.Parse(true, []string{"-i", "tsuru/python", "-d", "http://example.com/Dockerfile", "-c", "python"})
+	c.Assert(command.image, gocheck.Equals, "tsuru/python")
+	c.Assert(command.dockerfile, gocheck.Equals, "http://example.com/Dockerfile")
+	c.Assert(command.charm, gocheck.Equals, "python")
+	image := flagset.Lookup("image")
+	c.Assert(image, gocheck.NotNil)
+	c.Assert(image.Usage, gocheck.Equals, "Existing docker image used as the base image of the platform")
+	c.Assert(image.DefValue, gocheck.Equals, "")
+}
+
+func (s *S) TestPlatformAddIsACommand(c *gocheck.C) {
+	var _ cmd.FlaggedCommand = &platformAdd{}
+}
+
+func (s *S) TestPlatformUpdateInfo(c *gocheck.C) {
+	expected := &cmd.Info{
+		Name:    "platform-update",
+		Usage:   "platform-update <name> [--dockerfile url] [--image image] [--charm charm]",
+		Desc:    "Updates a platform, rebuilding its base image. Apps use the new image in their next deploy.",
+		MinArgs: 1,
+	}
+	c.Assert((&platformUpdate{}).Info(), gocheck.DeepEquals, expected)
+}
+
+func (s *S) TestPlatformUpdate(c *gocheck.C) {
+	var called bool
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Args:   []string{"python"},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	manager := cmd.NewManager("glb", "0.2", "ad-ver", &stdout, &stderr, nil)
+	trans := testing.ConditionalTransport{
+		Transport: testing.Transport{Message: "building image...", Status: http.StatusOK},
+		CondFunc: func(req *http.Request) bool {
+			called = true
+			c.Assert(req.FormValue("image"), gocheck.Equals, "tsuru/python")
+			return req.Method == "PUT" && req.URL.Path == "/platforms/python"
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: &trans}, nil, manager)
+	command := platformUpdate{}
+	command.Flags().Parse(true, []string{"--image", "tsuru/python"})
+	err := command.Run(&context, client)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(called, gocheck.Equals, true)
+	c.Assert(stdout.String(), gocheck.Equals, "building image...\nPlatform \"python\" successfully updated!\n")
+}
+
+func (s *S) TestPlatformUpdateIsACommand(c *gocheck.C) {
+	var _ cmd.FlaggedCommand = &platformUpdate{}
+}
+
+func (s *S) TestPlatformRemoveInfo(c *gocheck.C) {
+	expected := &cmd.Info{
+		Name:    "platform-remove",
+		Usage:   "platform-remove <name>",
+		Desc:    "Removes a platform from tsuru. Platforms used by apps can't be removed.",
+		MinArgs: 1,
+	}
+	c.Assert(platformRemove{}.Info(), gocheck.DeepEquals, expected)
+}
+
+func (s *S) TestPlatformRemove(c *gocheck.C) {
+	var called bool
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Args:   []string{"python"},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	manager := cmd.NewManager("glb", "0.2", "ad-ver", &stdout, &stderr, nil)
+	trans := testing.ConditionalTransport{
+		Transport: testing.Transport{Message: "", Status: http.StatusOK},
+		CondFunc: func(req *http.Request) bool {
+			called = true
+			return req.Method == "DELETE" && req.URL.Path == "/platforms/python"
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: &trans}, nil, manager)
+	err := platformRemove{}.Run(&context, client)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(called, gocheck.Equals, true)
+	c.Assert(stdout.String(), gocheck.Equals, "Platform \"python\" successfully removed!\n")
+}
+
+func (s *S) TestPlatformRemoveIsACommand(c *gocheck.C) {
+	var _ cmd.Command = platformRemove{}
+}
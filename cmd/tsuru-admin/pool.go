@@ -0,0 +1,205 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/globocom/tsuru/cmd"
+	"launchpad.net/gnuflag"
+	"net/http"
+	"strings"
+)
+
+type pool struct {
+	Name    string
+	Teams   []string `json:",omitempty"`
+	Default bool     `json:",omitempty"`
+}
+
+type poolAdd struct {
+	isDefault bool
+	fs        *gnuflag.FlagSet
+}
+
+func (c *poolAdd) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:  "pool-add",
+		Usage: "pool-add <name> [team...] [--default]",
+		Desc: `Adds a pool of docker nodes, optionally assigning it to teams.
+
+The units of an app run in the pool chosen on its creation, in the first pool
+assigned to one of its teams or in the default pool. There's only one default
+pool: adding a default pool replaces the previous one.`,
+		MinArgs: 1,
+	}
+}
+
+func (c *poolAdd) Run(ctx *cmd.Context, client *cmd.Client) error {
+	p := pool{Name: ctx.Args[0], Teams: ctx.Args[1:], Default: c.isDefault}
+	b, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	u, err := cmd.GetURL("/docker/pools")
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequest("POST", u, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	_, err = client.Do(request)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(ctx.Stdout, "Pool %q successfully added!\n", p.Name)
+	return nil
+}
+
+func (c *poolAdd) Flags() *gnuflag.FlagSet {
+	if c.fs == nil {
+		c.fs = gnuflag.NewFlagSet("pool-add", gnuflag.ExitOnError)
+		c.fs.BoolVar(&c.isDefault, "default", false, "Makes the pool the default pool")
+		c.fs.BoolVar(&c.isDefault, "d", false, "Makes the pool the default pool")
+	}
+	return c.fs
+}
+
+type poolRemove struct{}
+
+func (poolRemove) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:    "pool-remove",
+		Usage:   "pool-remove <name>",
+		Desc:    "Removes a pool of docker nodes. Pools with nodes, or chosen by apps, can't be removed.",
+		MinArgs: 1,
+	}
+}
+
+func (poolRemove) Run(ctx *cmd.Context, client *cmd.Client) error {
+	name := ctx.Args[0]
+	u, err := cmd.GetURL("/docker/pools/" + name)
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequest("DELETE", u, nil)
+	if err != nil {
+		return err
+	}
+	_, err = client.Do(request)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(ctx.Stdout, "Pool %q successfully removed!\n", name)
+	return nil
+}
+
+type poolList struct{}
+
+func (poolList) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:    "pool-list",
+		Usage:   "pool-list",
+		Desc:    "Lists the pools of docker nodes and their teams.",
+		MinArgs: 0,
+	}
+}
+
+func (poolList) Run(ctx *cmd.Context, client *cmd.Client) error {
+	u, err := cmd.GetURL("/docker/pools")
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return err
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode == http.StatusNoContent {
+		fmt.Fprintln(ctx.Stdout, "No pools available.")
+		return nil
+	}
+	var pools []pool
+	err = json.NewDecoder(response.Body).Decode(&pools)
+	if err != nil {
+		return err
+	}
+	table := cmd.NewTable()
+	table.Headers = cmd.Row{"Pool", "Teams", "Default"}
+	for _, p := range pools {
+		var isDefault string
+		if p.Default {
+			isDefault = "yes"
+		}
+		table.AddRow(cmd.Row{p.Name, strings.Join(p.Teams, ", "), isDefault})
+	}
+	ctx.Stdout.Write(table.Bytes())
+	return nil
+}
+
+// poolTeamsRequest sends the list of teams of the command to the teams of the
+// pool, using the given method.
+func poolTeamsRequest(method string, ctx *cmd.Context, client *cmd.Client) error {
+	b, err := json.Marshal(ctx.Args[1:])
+	if err != nil {
+		return err
+	}
+	u, err := cmd.GetURL("/docker/pools/" + ctx.Args[0] + "/teams")
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequest(method, u, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	_, err = client.Do(request)
+	return err
+}
+
+type poolTeamAdd struct{}
+
+func (poolTeamAdd) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:    "pool-team-add",
+		Usage:   "pool-team-add <pool> <team> [team...]",
+		Desc:    "Assigns a pool of docker nodes to teams.",
+		MinArgs: 2,
+	}
+}
+
+func (poolTeamAdd) Run(ctx *cmd.Context, client *cmd.Client) error {
+	if err := poolTeamsRequest("POST", ctx, client); err != nil {
+		return err
+	}
+	fmt.Fprintf(ctx.Stdout, "Teams successfully added to the pool %q!\n", ctx.Args[0])
+	return nil
+}
+
+type poolTeamRemove struct{}
+
+func (poolTeamRemove) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:    "pool-team-remove",
+		Usage:   "pool-team-remove <pool> <team> [team...]",
+		Desc:    "Removes teams from a pool of docker nodes.",
+		MinArgs: 2,
+	}
+}
+
+func (poolTeamRemove) Run(ctx *cmd.Context, client *cmd.Client) error {
+	if err := poolTeamsRequest("DELETE", ctx, client); err != nil {
+		return err
+	}
+	fmt.Fprintf(ctx.Stdout, "Teams successfully removed from the pool %q!\n", ctx.Args[0])
+	return nil
+}
@@ -0,0 +1,173 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"github.com/globocom/tsuru/cmd"
+	"github.com/globocom/tsuru/cmd/testing"
+	"io/ioutil"
+	"launchpad.net/gocheck"
+	"net/http"
+	"strings"
+)
+
+func (s *S) TestPoolAddInfo(c *gocheck.C) {
+	info := (&poolAdd{}).Info()
+	c.Assert(info.Name, gocheck.Equals, "pool-add")
+	c.Assert(info.Usage, gocheck.Equals, "pool-add <name> [team...] [--default]")
+	c.Assert(info.MinArgs, gocheck.Equals, 1)
+}
+
+func (s *S) TestPoolAdd(c *gocheck.C) {
+	var called bool
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Args:   []string{"staging", "ops", "devs"},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	manager := cmd.NewManager("glb", "0.2", "ad-ver", &stdout, &stderr, nil)
+	trans := testing.ConditionalTransport{
+		Transport: testing.Transport{Message: "", Status: http.StatusOK},
+		CondFunc: func(req *http.Request) bool {
+			called = true
+			body, err := ioutil.ReadAll(req.Body)
+			c.Assert(err, gocheck.IsNil)
+			c.Assert(string(body), gocheck.Equals, `{"Name":"staging","Teams":["ops","devs"],"Default":true}`)
+			return req.Method == "POST" && req.URL.Path == "/docker/pools"
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: &trans}, nil, manager)
+	command := poolAdd{}
+	command.Flags().Parse(true, []string{"--default"})
+	err := command.Run(&context, client)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(called, gocheck.Equals, true)
+	c.Assert(stdout.String(), gocheck.Equals, "Pool \"staging\" successfully added!\n")
+}
+
+func (s *S) TestPoolAddFlags(c *gocheck.C) {
+	command := poolAdd{}
+	flagset := command.Flags()
+	flagset.Parse(true, []string{"-d"})
+	c.Assert(command.isDefault, gocheck.Equals, true)
+	flag := flagset.Lookup("default")
+	c.Assert(flag, gocheck.NotNil)
+	c.Assert(flag.Usage, gocheck.Equals, "Makes the pool the default pool")
+}
+
+func (s *S) TestPoolRemove(c *gocheck.C) {
+	var called bool
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Args:   []string{"staging"},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	manager := cmd.NewManager("glb", "0.2", "ad-ver", &stdout, &stderr, nil)
+	trans := testing.ConditionalTransport{
+		Transport: testing.Transport{Message: "", Status: http.StatusOK},
+		CondFunc: func(req *http.Request) bool {
+			called = true
+			return req.Method == "DELETE" && req.URL.Path == "/docker/pools/staging"
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: &trans}, nil, manager)
+	err := poolRemove{}.Run(&context, client)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(called, gocheck.Equals, true)
+	c.Assert(stdout.String(), gocheck.Equals, "Pool \"staging\" successfully removed!\n")
+}
+
+func (s *S) TestPoolList(c *gocheck.C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	manager := cmd.NewManager("glb", "0.2", "ad-ver", &stdout, &stderr, nil)
+	result := `[{"Name":"production","Default":true},{"Name":"staging","Teams":["ops","devs"]}]`
+	trans := testing.ConditionalTransport{
+		Transport: testing.Transport{Message: result, Status: http.StatusOK},
+		CondFunc: func(req *http.Request) bool {
+			return req.Method == "GET" && req.URL.Path == "/docker/pools"
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: &trans}, nil, manager)
+	err := poolList{}.Run(&context, client)
+	c.Assert(err, gocheck.IsNil)
+	lines := strings.Split(stdout.String(), "\n")
+	c.Assert(lines, gocheck.HasLen, 7)
+	c.Assert(lines[1], gocheck.Matches, `\| Pool +\| Teams +\| Default \|`)
+	c.Assert(lines[3], gocheck.Matches, `\| production +\| +\| yes +\|`)
+	c.Assert(lines[4], gocheck.Matches, `\| staging +\| ops, devs +\| +\|`)
+}
+
+func (s *S) TestPoolListEmpty(c *gocheck.C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	manager := cmd.NewManager("glb", "0.2", "ad-ver", &stdout, &stderr, nil)
+	trans := testing.Transport{Message: "", Status: http.StatusNoContent}
+	client := cmd.NewClient(&http.Client{Transport: &trans}, nil, manager)
+	err := poolList{}.Run(&context, client)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(stdout.String(), gocheck.Equals, "No pools available.\n")
+}
+
+func (s *S) TestPoolTeamAdd(c *gocheck.C) {
+	var called bool
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Args:   []string{"staging", "ops", "devs"},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	manager := cmd.NewManager("glb", "0.2", "ad-ver", &stdout, &stderr, nil)
+	trans := testing.ConditionalTransport{
+		Transport: testing.Transport{Message: "", Status: http.StatusOK},
+		CondFunc: func(req *http.Request) bool {
+			called = true
+			body, err := ioutil.ReadAll(req.Body)
+			c.Assert(err, gocheck.IsNil)
+			c.Assert(string(body), gocheck.Equals, `["ops","devs"]`)
+			return req.Method == "POST" && req.URL.Path == "/docker/pools/staging/teams"
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: &trans}, nil, manager)
+	err := poolTeamAdd{}.Run(&context, client)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(called, gocheck.Equals, true)
+	c.Assert(stdout.String(), gocheck.Equals, "Teams successfully added to the pool \"staging\"!\n")
+}
+
+func (s *S) TestPoolTeamRemove(c *gocheck.C) {
+	var called bool
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Args:   []string{"staging", "ops"},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	manager := cmd.NewManager("glb", "0.2", "ad-ver", &stdout, &stderr, nil)
+	trans := testing.ConditionalTransport{
+		Transport: testing.Transport{Message: "", Status: http.StatusOK},
+		CondFunc: func(req *http.Request) bool {
+			called = true
+			body, err := ioutil.ReadAll(req.Body)
+			c.Assert(err, gocheck.IsNil)
+			c.Assert(string(body), gocheck.Equals, `["ops"]`)
+			return req.Method == "DELETE" && req.URL.Path == "/docker/pools/staging/teams"
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: &trans}, nil, manager)
+	err := poolTeamRemove{}.Run(&context, client)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(called, gocheck.Equals, true)
+	c.Assert(stdout.String(), gocheck.Equals, "Teams successfully removed from the pool \"staging\"!\n")
+}
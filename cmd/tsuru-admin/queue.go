@@ -0,0 +1,119 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/globocom/tsuru/cmd"
+	"launchpad.net/gnuflag"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type deadLetter struct {
+	ID       string
+	Queue    string
+	Action   string
+	Args     []string
+	Attempts int
+	Date     time.Time
+}
+
+type queueDLQList struct {
+	queue string
+	fs    *gnuflag.FlagSet
+}
+
+func (c *queueDLQList) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:  "queue-dlq-list",
+		Usage: "queue-dlq-list [--queue name]",
+		Desc: `lists the messages in the dead-letter queue, most recent first.
+
+Messages are moved to the dead-letter queue when they exceed the maximum
+number of retries of their action.`,
+		MinArgs: 0,
+	}
+}
+
+func (c *queueDLQList) Run(context *cmd.Context, client *cmd.Client) error {
+	query := url.Values{}
+	if c.queue != "" {
+		query.Set("queue", c.queue)
+	}
+	u, err := cmd.GetURL("/queue/dead-letters?" + query.Encode())
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return err
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode == http.StatusNoContent {
+		fmt.Fprintln(context.Stdout, "The dead-letter queue is empty.")
+		return nil
+	}
+	var letters []deadLetter
+	err = json.NewDecoder(response.Body).Decode(&letters)
+	if err != nil {
+		return err
+	}
+	table := cmd.NewTable()
+	table.Headers = cmd.Row{"Id", "Date", "Queue", "Action", "Args", "Attempts"}
+	for _, l := range letters {
+		date := l.Date.In(time.Local).Format("2006-01-02 15:04:05 -0700")
+		table.AddRow(cmd.Row{l.ID, date, l.Queue, l.Action, strings.Join(l.Args, " "), strconv.Itoa(l.Attempts)})
+	}
+	context.Stdout.Write(table.Bytes())
+	return nil
+}
+
+func (c *queueDLQList) Flags() *gnuflag.FlagSet {
+	if c.fs == nil {
+		c.fs = gnuflag.NewFlagSet("queue-dlq-list", gnuflag.ExitOnError)
+		c.fs.StringVar(&c.queue, "queue", "", "Lists only the messages from the queue")
+		c.fs.StringVar(&c.queue, "q", "", "Lists only the messages from the queue")
+	}
+	return c.fs
+}
+
+type queueDLQReplay struct{}
+
+func (queueDLQReplay) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:    "queue-dlq-replay",
+		Usage:   "queue-dlq-replay <id> [id...]",
+		Desc:    "puts messages from the dead-letter queue back in their queues.",
+		MinArgs: 1,
+	}
+}
+
+func (queueDLQReplay) Run(context *cmd.Context, client *cmd.Client) error {
+	for _, id := range context.Args {
+		u, err := cmd.GetURL("/queue/dead-letters/" + id + "/replay")
+		if err != nil {
+			return err
+		}
+		request, err := http.NewRequest("POST", u, nil)
+		if err != nil {
+			return err
+		}
+		_, err = client.Do(request)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(context.Stdout, "Message %s successfully replayed.\n", id)
+	}
+	return nil
+}
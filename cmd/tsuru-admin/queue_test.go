@@ -0,0 +1,101 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"github.com/globocom/tsuru/cmd"
+	"github.com/globocom/tsuru/cmd/testing"
+	"launchpad.net/gocheck"
+	"net/http"
+	"strings"
+)
+
+func (s *S) TestQueueDLQListInfo(c *gocheck.C) {
+	info := (&queueDLQList{}).Info()
+	c.Assert(info.Name, gocheck.Equals, "queue-dlq-list")
+	c.Assert(info.Usage, gocheck.Equals, "queue-dlq-list [--queue name]")
+	c.Assert(info.MinArgs, gocheck.Equals, 0)
+}
+
+func (s *S) TestQueueDLQList(c *gocheck.C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	manager := cmd.NewManager("glb", "0.2", "ad-ver", &stdout, &stderr, nil)
+	result := `[{"ID":"52a7358d3ba5c2a2b6000001","Queue":"tsuru-app","Action":"start-app","Args":["myapp","myapp/0"],"Attempts":11,"Date":"2013-12-10T15:00:00Z"}]`
+	var called bool
+	trans := testing.ConditionalTransport{
+		Transport: testing.Transport{Message: result, Status: http.StatusOK},
+		CondFunc: func(req *http.Request) bool {
+			called = true
+			c.Assert(req.URL.Query().Get("queue"), gocheck.Equals, "tsuru-app")
+			return req.Method == "GET" && req.URL.Path == "/queue/dead-letters"
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: &trans}, nil, manager)
+	command := queueDLQList{}
+	command.Flags().Parse(true, []string{"-q", "tsuru-app"})
+	err := command.Run(&context, client)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(called, gocheck.Equals, true)
+	lines := strings.Split(stdout.String(), "\n")
+	c.Assert(lines, gocheck.HasLen, 6)
+	c.Assert(lines[1], gocheck.Matches, `\| Id +\| Date +\| Queue +\| Action +\| Args +\| Attempts \|`)
+	c.Assert(lines[3], gocheck.Matches, `\| 52a7358d3ba5c2a2b6000001 \| .+ \| tsuru-app \| start-app \| myapp myapp/0 \| 11 +\|`)
+}
+
+func (s *S) TestQueueDLQListEmpty(c *gocheck.C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	manager := cmd.NewManager("glb", "0.2", "ad-ver", &stdout, &stderr, nil)
+	trans := testing.Transport{Message: "", Status: http.StatusNoContent}
+	client := cmd.NewClient(&http.Client{Transport: &trans}, nil, manager)
+	err := (&queueDLQList{}).Run(&context, client)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(stdout.String(), gocheck.Equals, "The dead-letter queue is empty.\n")
+}
+
+func (s *S) TestQueueDLQReplayInfo(c *gocheck.C) {
+	expected := &cmd.Info{
+		Name:    "queue-dlq-replay",
+		Usage:   "queue-dlq-replay <id> [id...]",
+		Desc:    "puts messages from the dead-letter queue back in their queues.",
+		MinArgs: 1,
+	}
+	c.Assert(queueDLQReplay{}.Info(), gocheck.DeepEquals, expected)
+}
+
+func (s *S) TestQueueDLQReplay(c *gocheck.C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Args:   []string{"52a7358d3ba5c2a2b6000001", "52a7358d3ba5c2a2b6000002"},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	manager := cmd.NewManager("glb", "0.2", "ad-ver", &stdout, &stderr, nil)
+	var paths []string
+	trans := testing.ConditionalTransport{
+		Transport: testing.Transport{Message: "", Status: http.StatusOK},
+		CondFunc: func(req *http.Request) bool {
+			paths = append(paths, req.URL.Path)
+			return req.Method == "POST"
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: &trans}, nil, manager)
+	err := queueDLQReplay{}.Run(&context, client)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(paths, gocheck.DeepEquals, []string{
+		"/queue/dead-letters/52a7358d3ba5c2a2b6000001/replay",
+		"/queue/dead-letters/52a7358d3ba5c2a2b6000002/replay",
+	})
+	expected := "Message 52a7358d3ba5c2a2b6000001 successfully replayed.\nMessage 52a7358d3ba5c2a2b6000002 successfully replayed.\n"
+	c.Assert(stdout.String(), gocheck.Equals, expected)
+}
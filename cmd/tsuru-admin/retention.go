@@ -0,0 +1,68 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"github.com/globocom/tsuru/cmd"
+	"launchpad.net/gnuflag"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+type logRetentionSet struct {
+	maxAge     string
+	maxEntries int
+	noDefaults bool
+	fs         *gnuflag.FlagSet
+}
+
+func (c *logRetentionSet) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:  "log-retention-set",
+		Usage: "log-retention-set <appname> [--max-age duration] [--max-entries n] [--no-defaults]",
+		Desc: `overrides the global retention of the logs of an app.
+
+The max age is a duration, like 720h. Omitted values fall back to the global
+retention, defined in tsuru.conf. With --no-defaults, omitted values mean no
+limit.`,
+		MinArgs: 1,
+	}
+}
+
+func (c *logRetentionSet) Run(context *cmd.Context, client *cmd.Client) error {
+	appName := context.Args[0]
+	u, err := cmd.GetURL(fmt.Sprintf("/apps/%s/log-retention", appName))
+	if err != nil {
+		return err
+	}
+	v := url.Values{}
+	v.Set("max-age", c.maxAge)
+	v.Set("max-entries", strconv.Itoa(c.maxEntries))
+	v.Set("no-defaults", strconv.FormatBool(c.noDefaults))
+	request, err := http.NewRequest("POST", u, strings.NewReader(v.Encode()))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	_, err = client.Do(request)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(context.Stdout, "Log retention of %q successfully defined.\n", appName)
+	return nil
+}
+
+func (c *logRetentionSet) Flags() *gnuflag.FlagSet {
+	if c.fs == nil {
+		c.fs = gnuflag.NewFlagSet("log-retention-set", gnuflag.ExitOnError)
+		c.fs.StringVar(&c.maxAge, "max-age", "", "Maximum age of the logs, like 720h")
+		c.fs.IntVar(&c.maxEntries, "max-entries", 0, "Maximum number of logs")
+		c.fs.BoolVar(&c.noDefaults, "no-defaults", false, "Don't fall back to the global retention")
+	}
+	return c.fs
+}
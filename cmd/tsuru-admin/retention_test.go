@@ -0,0 +1,52 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"github.com/globocom/tsuru/cmd"
+	"github.com/globocom/tsuru/cmd/testing"
+	"launchpad.net/gocheck"
+	"net/http"
+)
+
+func (s *S) TestLogRetentionSetInfo(c *gocheck.C) {
+	info := (&logRetentionSet{}).Info()
+	c.Assert(info.Name, gocheck.Equals, "log-retention-set")
+	c.Assert(info.Usage, gocheck.Equals, "log-retention-set <appname> [--max-age duration] [--max-entries n] [--no-defaults]")
+	c.Assert(info.MinArgs, gocheck.Equals, 1)
+}
+
+func (s *S) TestLogRetentionSetIsACommand(c *gocheck.C) {
+	var _ cmd.FlaggedCommand = &logRetentionSet{}
+}
+
+func (s *S) TestLogRetentionSet(c *gocheck.C) {
+	var called bool
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Args:   []string{"myapp"},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	manager := cmd.NewManager("glb", "0.2", "ad-ver", &stdout, &stderr, nil)
+	trans := testing.ConditionalTransport{
+		Transport: testing.Transport{Message: "", Status: http.StatusOK},
+		CondFunc: func(req *http.Request) bool {
+			called = true
+			c.Assert(req.FormValue("max-age"), gocheck.Equals, "720h")
+			c.Assert(req.FormValue("max-entries"), gocheck.Equals, "5000")
+			c.Assert(req.FormValue("no-defaults"), gocheck.Equals, "false")
+			return req.Method == "POST" && req.URL.Path == "/apps/myapp/log-retention"
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: &trans}, nil, manager)
+	command := logRetentionSet{}
+	command.Flags().Parse(true, []string{"--max-age", "720h", "--max-entries", "5000"})
+	err := command.Run(&context, client)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(called, gocheck.Equals, true)
+	c.Assert(stdout.String(), gocheck.Equals, "Log retention of \"myapp\" successfully defined.\n")
+}
@@ -0,0 +1,166 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/globocom/tsuru/cmd"
+	"io/ioutil"
+	"launchpad.net/gnuflag"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// roleFlags holds the flags shared by role-add and role-remove.
+type roleFlags struct {
+	scope string
+	value string
+	fs    *gnuflag.FlagSet
+}
+
+func (f *roleFlags) flags(name string) *gnuflag.FlagSet {
+	if f.fs == nil {
+		f.fs = gnuflag.NewFlagSet(name, gnuflag.ExitOnError)
+		f.fs.StringVar(&f.scope, "scope", "global", "Scope of the role: global, team or app")
+		f.fs.StringVar(&f.scope, "s", "global", "Scope of the role: global, team or app")
+		f.fs.StringVar(&f.value, "value", "", "Name of the team or of the app of the scope")
+		f.fs.StringVar(&f.value, "v", "", "Name of the team or of the app of the scope")
+	}
+	return f.fs
+}
+
+func (f *roleFlags) values(role string) url.Values {
+	v := url.Values{}
+	v.Set("role", role)
+	v.Set("scope", f.scope)
+	if f.value != "" {
+		v.Set("value", f.value)
+	}
+	return v
+}
+
+type roleAdd struct {
+	roleFlags
+}
+
+func (c *roleAdd) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:    "role-add",
+		Usage:   "role-add <email> <role> [--scope global|team|app] [--value name]",
+		Desc:    "Assigns a role to a user. Available roles: app-viewer, app-deployer, app-admin, service-admin and team-admin.",
+		MinArgs: 2,
+	}
+}
+
+func (c *roleAdd) Run(ctx *cmd.Context, client *cmd.Client) error {
+	email, role := ctx.Args[0], ctx.Args[1]
+	u, err := cmd.GetURL("/users/" + email + "/roles")
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequest("POST", u, strings.NewReader(c.values(role).Encode()))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	_, err = client.Do(request)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(ctx.Stdout, "Role %q successfully assigned to %s!\n", role, email)
+	return nil
+}
+
+func (c *roleAdd) Flags() *gnuflag.FlagSet {
+	return c.flags("role-add")
+}
+
+type roleRemove struct {
+	roleFlags
+}
+
+func (c *roleRemove) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:    "role-remove",
+		Usage:   "role-remove <email> <role> [--scope global|team|app] [--value name]",
+		Desc:    "Revokes a role from a user.",
+		MinArgs: 2,
+	}
+}
+
+func (c *roleRemove) Run(ctx *cmd.Context, client *cmd.Client) error {
+	email, role := ctx.Args[0], ctx.Args[1]
+	u, err := cmd.GetURL("/users/" + email + "/roles?" + c.values(role).Encode())
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequest("DELETE", u, nil)
+	if err != nil {
+		return err
+	}
+	_, err = client.Do(request)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(ctx.Stdout, "Role %q successfully revoked from %s!\n", role, email)
+	return nil
+}
+
+func (c *roleRemove) Flags() *gnuflag.FlagSet {
+	return c.flags("role-remove")
+}
+
+type roleList struct{}
+
+func (roleList) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:    "role-list",
+		Usage:   "role-list <email>",
+		Desc:    "Lists the roles assigned to a user.",
+		MinArgs: 1,
+	}
+}
+
+func (roleList) Run(ctx *cmd.Context, client *cmd.Client) error {
+	u, err := cmd.GetURL("/users/" + ctx.Args[0] + "/roles")
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNoContent {
+		fmt.Fprintln(ctx.Stdout, "No roles assigned to this user.")
+		return nil
+	}
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	var roles []struct {
+		Name  string
+		Scope string
+		Value string
+	}
+	err = json.Unmarshal(b, &roles)
+	if err != nil {
+		return err
+	}
+	table := cmd.NewTable()
+	table.Headers = cmd.Row{"Role", "Scope", "Value"}
+	for _, r := range roles {
+		table.AddRow(cmd.Row{r.Name, r.Scope, r.Value})
+	}
+	ctx.Stdout.Write(table.Bytes())
+	return nil
+}
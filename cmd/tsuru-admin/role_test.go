@@ -0,0 +1,162 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"github.com/globocom/tsuru/cmd"
+	"github.com/globocom/tsuru/cmd/testing"
+	"launchpad.net/gocheck"
+	"net/http"
+)
+
+func (s *S) TestRoleAddInfo(c *gocheck.C) {
+	expected := &cmd.Info{
+		Name:    "role-add",
+		Usage:   "role-add <email> <role> [--scope global|team|app] [--value name]",
+		Desc:    "Assigns a role to a user. Available roles: app-viewer, app-deployer, app-admin, service-admin and team-admin.",
+		MinArgs: 2,
+	}
+	c.Assert((&roleAdd{}).Info(), gocheck.DeepEquals, expected)
+}
+
+func (s *S) TestRoleAdd(c *gocheck.C) {
+	var called bool
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Args:   []string{"ops@tsuru.io", "app-deployer"},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	manager := cmd.NewManager("glb", "0.2", "ad-ver", &stdout, &stderr, nil)
+	trans := testing.ConditionalTransport{
+		Transport: testing.Transport{Message: "", Status: http.StatusOK},
+		CondFunc: func(req *http.Request) bool {
+			called = true
+			c.Assert(req.FormValue("role"), gocheck.Equals, "app-deployer")
+			c.Assert(req.FormValue("scope"), gocheck.Equals, "team")
+			c.Assert(req.FormValue("value"), gocheck.Equals, "ops")
+			return req.Method == "POST" && req.URL.Path == "/users/ops@tsuru.io/roles"
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: &trans}, nil, manager)
+	command := roleAdd{}
+	command.Flags().Parse(true, []string{"--scope", "team", "-v", "ops"})
+	err := command.Run(&context, client)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(called, gocheck.Equals, true)
+	c.Assert(stdout.String(), gocheck.Equals, "Role \"app-deployer\" successfully assigned to ops@tsuru.io!\n")
+}
+
+func (s *S) TestRoleAddFlags(c *gocheck.C) {
+	command := roleAdd{}
+	flagset := command.Flags()
+	c.Assert(flagset, gocheck.NotNil)
+	flagset.Parse(true, []string{"-s", "app", "--value", "myapp"})
+	c.Assert(command.scope, gocheck.Equals, "app")
+	c.Assert(command.value, gocheck.Equals, "myapp")
+	scope := flagset.Lookup("scope")
+	c.Assert(scope, gocheck.NotNil)
+	c.Assert(scope.Usage, gocheck.Equals, "Scope of the role: global, team or app")
+	c.Assert(scope.DefValue, gocheck.Equals, "global")
+}
+
+func (s *S) TestRoleAddIsACommand(c *gocheck.C) {
+	var _ cmd.FlaggedCommand = &roleAdd{}
+}
+
+func (s *S) TestRoleRemoveInfo(c *gocheck.C) {
+	expected := &cmd.Info{
+		Name:    "role-remove",
+		Usage:   "role-remove <email> <role> [--scope global|team|app] [--value name]",
+		Desc:    "Revokes a role from a user.",
+		MinArgs: 2,
+	}
+	c.Assert((&roleRemove{}).Info(), gocheck.DeepEquals, expected)
+}
+
+func (s *S) TestRoleRemove(c *gocheck.C) {
+	var called bool
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Args:   []string{"ops@tsuru.io", "app-viewer"},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	manager := cmd.NewManager("glb", "0.2", "ad-ver", &stdout, &stderr, nil)
+	trans := testing.ConditionalTransport{
+		Transport: testing.Transport{Message: "", Status: http.StatusOK},
+		CondFunc: func(req *http.Request) bool {
+			called = true
+			c.Assert(req.URL.Query().Get("role"), gocheck.Equals, "app-viewer")
+			c.Assert(req.URL.Query().Get("scope"), gocheck.Equals, "global")
+			return req.Method == "DELETE" && req.URL.Path == "/users/ops@tsuru.io/roles"
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: &trans}, nil, manager)
+	command := roleRemove{}
+	command.Flags().Parse(true, []string{})
+	err := command.Run(&context, client)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(called, gocheck.Equals, true)
+	c.Assert(stdout.String(), gocheck.Equals, "Role \"app-viewer\" successfully revoked from ops@tsuru.io!\n")
+}
+
+func (s *S) TestRoleRemoveIsACommand(c *gocheck.C) {
+	var _ cmd.FlaggedCommand = &roleRemove{}
+}
+
+func (s *S) TestRoleListInfo(c *gocheck.C) {
+	expected := &cmd.Info{
+		Name:    "role-list",
+		Usage:   "role-list <email>",
+		Desc:    "Lists the roles assigned to a user.",
+		MinArgs: 1,
+	}
+	c.Assert(roleList{}.Info(), gocheck.DeepEquals, expected)
+}
+
+func (s *S) TestRoleList(c *gocheck.C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Args:   []string{"ops@tsuru.io"},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	manager := cmd.NewManager("glb", "0.2", "ad-ver", &stdout, &stderr, nil)
+	result := `[{"Name":"app-deployer","Scope":"team","Value":"ops"},{"Name":"service-admin","Scope":"global"}]`
+	trans := testing.ConditionalTransport{
+		Transport: testing.Transport{Message: result, Status: http.StatusOK},
+		CondFunc: func(req *http.Request) bool {
+			return req.Method == "GET" && req.URL.Path == "/users/ops@tsuru.io/roles"
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: &trans}, nil, manager)
+	err := roleList{}.Run(&context, client)
+	c.Assert(err, gocheck.IsNil)
+	expected := `+---------------+--------+-------+
+| Role          | Scope  | Value |
++---------------+--------+-------+
+| app-deployer  | team   | ops   |
+| service-admin | global |       |
++---------------+--------+-------+
+`
+	c.Assert(stdout.String(), gocheck.Equals, expected)
+}
+
+func (s *S) TestRoleListEmpty(c *gocheck.C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Args:   []string{"ops@tsuru.io"},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	manager := cmd.NewManager("glb", "0.2", "ad-ver", &stdout, &stderr, nil)
+	trans := testing.Transport{Message: "", Status: http.StatusNoContent}
+	client := cmd.NewClient(&http.Client{Transport: &trans}, nil, manager)
+	err := roleList{}.Run(&context, client)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(stdout.String(), gocheck.Equals, "No roles assigned to this user.\n")
+}
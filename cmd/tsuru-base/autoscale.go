@@ -0,0 +1,178 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tsuru
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/globocom/tsuru/cmd"
+	"launchpad.net/gnuflag"
+	"net/http"
+	"strconv"
+)
+
+type autoscaleRule struct {
+	Metric    string
+	MinUnits  uint
+	MaxUnits  uint
+	ScaleUp   float64
+	ScaleDown float64
+	Cooldown  int
+}
+
+type AutoscaleSet struct {
+	GuessingCommand
+	rule autoscaleRule
+	fs   *gnuflag.FlagSet
+}
+
+func (c *AutoscaleSet) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:  "app-autoscale-set",
+		Usage: "app-autoscale-set <metric> [--min units] [--max units] [--up value] [--down value] [--cooldown seconds] [--app appname]",
+		Desc: `defines the autoscale rule of an app, replacing the previous one.
+
+The metric may be cpu, memory (both in percentage) or requests (per second).
+When the average value of the metric in the units of the app goes above the
+--up threshold, a unit is added; when it goes below the --down threshold, a
+unit is removed. The number of units is kept between --min and --max (0 means
+no limit), and no scaling happens within --cooldown seconds after the last one.
+
+If you don't provide the app name, tsuru will try to guess it.`,
+		MinArgs: 1,
+	}
+}
+
+func (c *AutoscaleSet) Run(context *cmd.Context, client *cmd.Client) error {
+	appName, err := c.Guess()
+	if err != nil {
+		return err
+	}
+	url, err := cmd.GetURL(fmt.Sprintf("/apps/%s/autoscale", appName))
+	if err != nil {
+		return err
+	}
+	c.rule.Metric = context.Args[0]
+	body, err := json.Marshal(c.rule)
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	_, err = client.Do(request)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(context.Stdout, "Autoscale rule successfully defined.")
+	return nil
+}
+
+func (c *AutoscaleSet) Flags() *gnuflag.FlagSet {
+	if c.fs == nil {
+		c.fs = c.GuessingCommand.Flags()
+		c.fs.UintVar(&c.rule.MinUnits, "min", 0, "The minimum number of units")
+		c.fs.UintVar(&c.rule.MaxUnits, "max", 0, "The maximum number of units, 0 means no limit")
+		c.fs.Float64Var(&c.rule.ScaleUp, "up", 0, "The value of the metric above which a unit is added")
+		c.fs.Float64Var(&c.rule.ScaleDown, "down", 0, "The value of the metric below which a unit is removed")
+		c.fs.IntVar(&c.rule.Cooldown, "cooldown", 0, "The number of seconds without scaling after the last scaling")
+	}
+	return c.fs
+}
+
+type AutoscaleInfo struct {
+	GuessingCommand
+}
+
+func (c *AutoscaleInfo) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:  "app-autoscale-info",
+		Usage: "app-autoscale-info [--app appname]",
+		Desc: `shows the autoscale rule of an app.
+
+If you don't provide the app name, tsuru will try to guess it.`,
+		MinArgs: 0,
+	}
+}
+
+func (c *AutoscaleInfo) Run(context *cmd.Context, client *cmd.Client) error {
+	appName, err := c.Guess()
+	if err != nil {
+		return err
+	}
+	url, err := cmd.GetURL(fmt.Sprintf("/apps/%s/autoscale", appName))
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return err
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	var rule autoscaleRule
+	err = json.NewDecoder(response.Body).Decode(&rule)
+	if err != nil {
+		return err
+	}
+	max := "unlimited"
+	if rule.MaxUnits > 0 {
+		max = strconv.FormatUint(uint64(rule.MaxUnits), 10)
+	}
+	table := cmd.NewTable()
+	table.Headers = cmd.Row{"Metric", "Min units", "Max units", "Scale up", "Scale down", "Cooldown"}
+	table.AddRow(cmd.Row{
+		rule.Metric,
+		strconv.FormatUint(uint64(rule.MinUnits), 10),
+		max,
+		strconv.FormatFloat(rule.ScaleUp, 'f', -1, 64),
+		strconv.FormatFloat(rule.ScaleDown, 'f', -1, 64),
+		fmt.Sprintf("%ds", rule.Cooldown),
+	})
+	context.Stdout.Write(table.Bytes())
+	return nil
+}
+
+type AutoscaleUnset struct {
+	GuessingCommand
+}
+
+func (c *AutoscaleUnset) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:  "app-autoscale-unset",
+		Usage: "app-autoscale-unset [--app appname]",
+		Desc: `removes the autoscale rule of an app, disabling its autoscaling.
+
+If you don't provide the app name, tsuru will try to guess it.`,
+		MinArgs: 0,
+	}
+}
+
+func (c *AutoscaleUnset) Run(context *cmd.Context, client *cmd.Client) error {
+	appName, err := c.Guess()
+	if err != nil {
+		return err
+	}
+	url, err := cmd.GetURL(fmt.Sprintf("/apps/%s/autoscale", appName))
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequest("DELETE", url, nil)
+	if err != nil {
+		return err
+	}
+	_, err = client.Do(request)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(context.Stdout, "Autoscale rule successfully removed.")
+	return nil
+}
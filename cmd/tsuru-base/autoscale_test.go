@@ -0,0 +1,111 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tsuru
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/globocom/tsuru/cmd"
+	"github.com/globocom/tsuru/cmd/testing"
+	"launchpad.net/gocheck"
+	"net/http"
+)
+
+func (s *S) TestAutoscaleSetInfo(c *gocheck.C) {
+	info := (&AutoscaleSet{}).Info()
+	c.Assert(info.Name, gocheck.Equals, "app-autoscale-set")
+	c.Assert(info.MinArgs, gocheck.Equals, 1)
+}
+
+func (s *S) TestAutoscaleSet(c *gocheck.C) {
+	var (
+		called         bool
+		stdout, stderr bytes.Buffer
+	)
+	context := cmd.Context{
+		Stdout: &stdout,
+		Stderr: &stderr,
+		Args:   []string{"cpu"},
+	}
+	trans := &testing.ConditionalTransport{
+		Transport: testing.Transport{Message: "", Status: http.StatusOK},
+		CondFunc: func(req *http.Request) bool {
+			called = true
+			var rule autoscaleRule
+			err := json.NewDecoder(req.Body).Decode(&rule)
+			c.Assert(err, gocheck.IsNil)
+			expected := autoscaleRule{Metric: "cpu", MinUnits: 1, MaxUnits: 5, ScaleUp: 80, ScaleDown: 20.5, Cooldown: 300}
+			c.Assert(rule, gocheck.DeepEquals, expected)
+			return req.URL.Path == "/apps/death/autoscale" && req.Method == "POST"
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	command := AutoscaleSet{}
+	args := []string{"-a", "death", "--min", "1", "--max", "5", "--up", "80", "--down", "20.5", "--cooldown", "300"}
+	err := command.Flags().Parse(true, args)
+	c.Assert(err, gocheck.IsNil)
+	err = command.Run(&context, client)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(called, gocheck.Equals, true)
+	c.Assert(stdout.String(), gocheck.Equals, "Autoscale rule successfully defined.\n")
+}
+
+func (s *S) TestAutoscaleInfoInfo(c *gocheck.C) {
+	info := (&AutoscaleInfo{}).Info()
+	c.Assert(info.Name, gocheck.Equals, "app-autoscale-info")
+	c.Assert(info.Usage, gocheck.Equals, "app-autoscale-info [--app appname]")
+	c.Assert(info.MinArgs, gocheck.Equals, 0)
+}
+
+func (s *S) TestAutoscaleInfo(c *gocheck.C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{Stdout: &stdout, Stderr: &stderr}
+	result := `{"App":"death","Metric":"cpu","MinUnits":1,"MaxUnits":5,"ScaleUp":80,"ScaleDown":20,"Cooldown":300}`
+	trans := &testing.ConditionalTransport{
+		Transport: testing.Transport{Message: result, Status: http.StatusOK},
+		CondFunc: func(req *http.Request) bool {
+			return req.URL.Path == "/apps/death/autoscale" && req.Method == "GET"
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	command := AutoscaleInfo{GuessingCommand{G: &FakeGuesser{name: "death"}}}
+	err := command.Run(&context, client)
+	c.Assert(err, gocheck.IsNil)
+	expected := `+--------+-----------+-----------+----------+------------+----------+
+| Metric | Min units | Max units | Scale up | Scale down | Cooldown |
++--------+-----------+-----------+----------+------------+----------+
+| cpu    | 1         | 5         | 80       | 20         | 300s     |
++--------+-----------+-----------+----------+------------+----------+
+`
+	c.Assert(stdout.String(), gocheck.Equals, expected)
+}
+
+func (s *S) TestAutoscaleUnsetInfo(c *gocheck.C) {
+	info := (&AutoscaleUnset{}).Info()
+	c.Assert(info.Name, gocheck.Equals, "app-autoscale-unset")
+	c.Assert(info.Usage, gocheck.Equals, "app-autoscale-unset [--app appname]")
+	c.Assert(info.MinArgs, gocheck.Equals, 0)
+}
+
+func (s *S) TestAutoscaleUnset(c *gocheck.C) {
+	var (
+		called         bool
+		stdout, stderr bytes.Buffer
+	)
+	context := cmd.Context{Stdout: &stdout, Stderr: &stderr}
+	trans := &testing.ConditionalTransport{
+		Transport: testing.Transport{Message: "", Status: http.StatusOK},
+		CondFunc: func(req *http.Request) bool {
+			called = true
+			return req.URL.Path == "/apps/death/autoscale" && req.Method == "DELETE"
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	command := AutoscaleUnset{GuessingCommand{G: &FakeGuesser{name: "death"}}}
+	err := command.Run(&context, client)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(called, gocheck.Equals, true)
+	c.Assert(stdout.String(), gocheck.Equals, "Autoscale rule successfully removed.\n")
+}
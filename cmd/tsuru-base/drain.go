@@ -0,0 +1,137 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tsuru
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/globocom/tsuru/cmd"
+	"net/http"
+)
+
+func sendLogDrain(method, drain string, g GuessingCommand, client *cmd.Client) error {
+	appName, err := g.Guess()
+	if err != nil {
+		return err
+	}
+	url, err := cmd.GetURL(fmt.Sprintf("/apps/%s/log-drains", appName))
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(map[string]string{"url": drain})
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	_, err = client.Do(request)
+	return err
+}
+
+type LogDrainAdd struct {
+	GuessingCommand
+}
+
+func (c *LogDrainAdd) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:  "app-log-drain-add",
+		Usage: "app-log-drain-add <url> [--app appname]",
+		Desc: `forwards the logs of an app to an external drain.
+
+The url may be a syslog server, over TCP (syslog://host:port) or UDP
+(syslog+udp://host:port), or an HTTP endpoint (http://host/path), that receives
+the logs in JSON format.
+
+If you don't provide the app name, tsuru will try to guess it.`,
+		MinArgs: 1,
+	}
+}
+
+func (c *LogDrainAdd) Run(context *cmd.Context, client *cmd.Client) error {
+	err := sendLogDrain("POST", context.Args[0], c.GuessingCommand, client)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(context.Stdout, "Log drain successfully added.")
+	return nil
+}
+
+type LogDrainRemove struct {
+	GuessingCommand
+}
+
+func (c *LogDrainRemove) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:  "app-log-drain-remove",
+		Usage: "app-log-drain-remove <url> [--app appname]",
+		Desc: `stops forwarding the logs of an app to the drain.
+
+If you don't provide the app name, tsuru will try to guess it.`,
+		MinArgs: 1,
+	}
+}
+
+func (c *LogDrainRemove) Run(context *cmd.Context, client *cmd.Client) error {
+	err := sendLogDrain("DELETE", context.Args[0], c.GuessingCommand, client)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(context.Stdout, "Log drain successfully removed.")
+	return nil
+}
+
+type LogDrainList struct {
+	GuessingCommand
+}
+
+func (c *LogDrainList) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:  "app-log-drain-list",
+		Usage: "app-log-drain-list [--app appname]",
+		Desc: `lists the drains that receive the logs of an app.
+
+If you don't provide the app name, tsuru will try to guess it.`,
+		MinArgs: 0,
+	}
+}
+
+func (c *LogDrainList) Run(context *cmd.Context, client *cmd.Client) error {
+	appName, err := c.Guess()
+	if err != nil {
+		return err
+	}
+	url, err := cmd.GetURL(fmt.Sprintf("/apps/%s/log-drains", appName))
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return err
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode == http.StatusNoContent {
+		fmt.Fprintln(context.Stdout, "No log drains found.")
+		return nil
+	}
+	var drains []struct{ URL string }
+	err = json.NewDecoder(response.Body).Decode(&drains)
+	if err != nil {
+		return err
+	}
+	table := cmd.NewTable()
+	table.Headers = cmd.Row{"Url"}
+	for _, d := range drains {
+		table.AddRow(cmd.Row{d.URL})
+	}
+	context.Stdout.Write(table.Bytes())
+	return nil
+}
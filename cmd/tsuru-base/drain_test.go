@@ -0,0 +1,125 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tsuru
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/globocom/tsuru/cmd"
+	"github.com/globocom/tsuru/cmd/testing"
+	"launchpad.net/gocheck"
+	"net/http"
+)
+
+func (s *S) TestLogDrainAddInfo(c *gocheck.C) {
+	info := (&LogDrainAdd{}).Info()
+	c.Assert(info.Name, gocheck.Equals, "app-log-drain-add")
+	c.Assert(info.Usage, gocheck.Equals, "app-log-drain-add <url> [--app appname]")
+	c.Assert(info.MinArgs, gocheck.Equals, 1)
+}
+
+func (s *S) TestLogDrainAdd(c *gocheck.C) {
+	var (
+		called         bool
+		stdout, stderr bytes.Buffer
+	)
+	context := cmd.Context{
+		Stdout: &stdout,
+		Stderr: &stderr,
+		Args:   []string{"syslog://logs.example.com:514"},
+	}
+	trans := &testing.ConditionalTransport{
+		Transport: testing.Transport{Message: "", Status: http.StatusOK},
+		CondFunc: func(req *http.Request) bool {
+			called = true
+			var m map[string]string
+			err := json.NewDecoder(req.Body).Decode(&m)
+			c.Assert(err, gocheck.IsNil)
+			return req.URL.Path == "/apps/death/log-drains" &&
+				req.Method == "POST" &&
+				m["url"] == "syslog://logs.example.com:514"
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	command := LogDrainAdd{}
+	command.Flags().Parse(true, []string{"-a", "death"})
+	err := command.Run(&context, client)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(called, gocheck.Equals, true)
+	c.Assert(stdout.String(), gocheck.Equals, "Log drain successfully added.\n")
+}
+
+func (s *S) TestLogDrainRemoveInfo(c *gocheck.C) {
+	info := (&LogDrainRemove{}).Info()
+	c.Assert(info.Name, gocheck.Equals, "app-log-drain-remove")
+	c.Assert(info.Usage, gocheck.Equals, "app-log-drain-remove <url> [--app appname]")
+	c.Assert(info.MinArgs, gocheck.Equals, 1)
+}
+
+func (s *S) TestLogDrainRemove(c *gocheck.C) {
+	var (
+		called         bool
+		stdout, stderr bytes.Buffer
+	)
+	context := cmd.Context{
+		Stdout: &stdout,
+		Stderr: &stderr,
+		Args:   []string{"https://logs.example.com/drain"},
+	}
+	fake := &FakeGuesser{name: "corey"}
+	trans := &testing.ConditionalTransport{
+		Transport: testing.Transport{Message: "", Status: http.StatusOK},
+		CondFunc: func(req *http.Request) bool {
+			called = true
+			var m map[string]string
+			err := json.NewDecoder(req.Body).Decode(&m)
+			c.Assert(err, gocheck.IsNil)
+			return req.URL.Path == "/apps/corey/log-drains" &&
+				req.Method == "DELETE" &&
+				m["url"] == "https://logs.example.com/drain"
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	err := (&LogDrainRemove{GuessingCommand{G: fake}}).Run(&context, client)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(called, gocheck.Equals, true)
+	c.Assert(stdout.String(), gocheck.Equals, "Log drain successfully removed.\n")
+}
+
+func (s *S) TestLogDrainList(c *gocheck.C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{Stdout: &stdout, Stderr: &stderr}
+	result := `[{"AppName":"death","URL":"syslog://logs.example.com:514"},{"AppName":"death","URL":"https://logs.example.com/drain"}]`
+	trans := &testing.ConditionalTransport{
+		Transport: testing.Transport{Message: result, Status: http.StatusOK},
+		CondFunc: func(req *http.Request) bool {
+			return req.URL.Path == "/apps/death/log-drains" && req.Method == "GET"
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	command := LogDrainList{}
+	command.Flags().Parse(true, []string{"--app", "death"})
+	err := command.Run(&context, client)
+	c.Assert(err, gocheck.IsNil)
+	expected := `+--------------------------------+
+| Url                            |
++--------------------------------+
+| syslog://logs.example.com:514  |
+| https://logs.example.com/drain |
++--------------------------------+
+`
+	c.Assert(stdout.String(), gocheck.Equals, expected)
+}
+
+func (s *S) TestLogDrainListNoContent(c *gocheck.C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{Stdout: &stdout, Stderr: &stderr}
+	trans := &testing.Transport{Message: "", Status: http.StatusNoContent}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	command := LogDrainList{GuessingCommand{G: &FakeGuesser{name: "death"}}}
+	err := command.Run(&context, client)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(stdout.String(), gocheck.Equals, "No log drains found.\n")
+}
@@ -5,6 +5,7 @@
 package tsuru
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"github.com/globocom/tsuru/cmd"
@@ -18,6 +19,7 @@ type AppLog struct {
 	GuessingCommand
 	fs     *gnuflag.FlagSet
 	source string
+	unit   string
 	lines  int
 	follow bool
 }
@@ -25,39 +27,62 @@ type AppLog struct {
 func (c *AppLog) Info() *cmd.Info {
 	return &cmd.Info{
 		Name:  "log",
-		Usage: "log [--app appname] [--lines/-l numberOfLines] [--source/-s source] [--follow/-f]",
+		Usage: "log [--app appname] [--lines/-l numberOfLines] [--source/-s source] [--unit/-u unit] [--follow/-f]",
 		Desc: `show logs for an app.
 
-If you don't provide the app name, tsuru will try to guess it. The default number of lines is 10.`,
+If you don't provide the app name, tsuru will try to guess it. The default number of lines is 10.
+
+With --follow, tsuru keeps showing the new logs of the app until you stop it.`,
 		MinArgs: 0,
 	}
 }
 
+// jsonWriter writes the logs sent by the API, in JSON format. The API sends
+// each list of logs in its own line, and the writer buffers incomplete lines.
 type jsonWriter struct {
 	w io.Writer
 	b []byte
 }
 
 func (w *jsonWriter) Write(b []byte) (int, error) {
-	var logs []log
 	w.b = append(w.b, b...)
-	err := json.Unmarshal(w.b, &logs)
-	if err != nil {
-		return len(b), nil
+	for len(w.b) > 0 {
+		line := w.b
+		i := bytes.IndexByte(w.b, '\n')
+		if i >= 0 {
+			line = w.b[:i]
+		}
+		var logs []log
+		if err := json.Unmarshal(line, &logs); err == nil {
+			w.write(logs)
+		} else if i < 0 {
+			break
+		}
+		if i < 0 {
+			w.b = nil
+		} else {
+			w.b = w.b[i+1:]
+		}
 	}
+	return len(b), nil
+}
+
+func (w *jsonWriter) write(logs []log) {
 	for _, l := range logs {
 		date := l.Date.In(time.Local).Format("2006-01-02 15:04:05 -0700")
 		prefix := fmt.Sprintf("%s [%s]:", date, l.Source)
+		if l.Unit != "" {
+			prefix = fmt.Sprintf("%s [%s][%s]:", date, l.Source, l.Unit)
+		}
 		fmt.Fprintf(w.w, "%s %s\n", cmd.Colorfy(prefix, "blue", "", ""), l.Message)
 	}
-	w.b = nil
-	return len(b), nil
 }
 
 type log struct {
 	Date    time.Time
 	Message string
 	Source  string
+	Unit    string
 }
 
 func (c *AppLog) Run(context *cmd.Context, client *cmd.Client) error {
@@ -72,6 +97,9 @@ func (c *AppLog) Run(context *cmd.Context, client *cmd.Client) error {
 	if c.source != "" {
 		url = fmt.Sprintf("%s&source=%s", url, c.source)
 	}
+	if c.unit != "" {
+		url = fmt.Sprintf("%s&unit=%s", url, c.unit)
+	}
 	if c.follow {
 		url += "&follow=1"
 	}
@@ -100,6 +128,8 @@ func (c *AppLog) Flags() *gnuflag.FlagSet {
 		c.fs.IntVar(&c.lines, "l", 10, "The number of log lines to display")
 		c.fs.StringVar(&c.source, "source", "", "The log from the given source")
 		c.fs.StringVar(&c.source, "s", "", "The log from the given source")
+		c.fs.StringVar(&c.unit, "unit", "", "The log from the given unit")
+		c.fs.StringVar(&c.unit, "u", "", "The log from the given unit")
 		c.fs.BoolVar(&c.follow, "follow", false, "Follow logs")
 		c.fs.BoolVar(&c.follow, "f", false, "Follow logs")
 	}
@@ -84,6 +84,28 @@ func (s *S) TestJSONWriter(c *gocheck.C) {
 	c.Assert(writer.String(), gocheck.Equals, expected)
 }
 
+func (s *S) TestJSONWriterMultipleLines(c *gocheck.C) {
+	t := time.Now()
+	first, err := json.Marshal([]log{{Date: t, Message: "first", Source: "tsuru"}})
+	c.Assert(err, gocheck.IsNil)
+	second, err := json.Marshal([]log{{Date: t, Message: "second", Source: "app", Unit: "myapp/0"}})
+	c.Assert(err, gocheck.IsNil)
+	data := append(append(first, '\n'), second...)
+	data = append(data, '\n')
+	var writer bytes.Buffer
+	w := jsonWriter{w: &writer}
+	_, err = w.Write(data[:len(first)+5])
+	c.Assert(err, gocheck.IsNil)
+	_, err = w.Write(data[len(first)+5:])
+	c.Assert(err, gocheck.IsNil)
+	tfmt := "2006-01-02 15:04:05 -0700"
+	t = t.In(time.Local)
+	expected := cmd.Colorfy(t.Format(tfmt)+" [tsuru]:", "blue", "", "") + " first\n"
+	expected = expected + cmd.Colorfy(t.Format(tfmt)+" [app][myapp/0]:", "blue", "", "") + " second\n"
+	c.Assert(writer.String(), gocheck.Equals, expected)
+	c.Assert(w.b, gocheck.HasLen, 0)
+}
+
 func (s *S) TestJSONWriterInvalidJSON(c *gocheck.C) {
 	var writer bytes.Buffer
 	w := jsonWriter{w: &writer}
@@ -173,10 +195,12 @@ func (s *S) TestAppLogShouldReturnNilIfHasNoContent(c *gocheck.C) {
 func (s *S) TestAppLogInfo(c *gocheck.C) {
 	expected := &cmd.Info{
 		Name:  "log",
-		Usage: "log [--app appname] [--lines/-l numberOfLines] [--source/-s source] [--follow/-f]",
+		Usage: "log [--app appname] [--lines/-l numberOfLines] [--source/-s source] [--unit/-u unit] [--follow/-f]",
 		Desc: `show logs for an app.
 
-If you don't provide the app name, tsuru will try to guess it. The default number of lines is 10.`,
+If you don't provide the app name, tsuru will try to guess it. The default number of lines is 10.
+
+With --follow, tsuru keeps showing the new logs of the app until you stop it.`,
 		MinArgs: 0,
 	}
 	c.Assert((&AppLog{}).Info(), gocheck.DeepEquals, expected)
@@ -214,6 +238,36 @@ func (s *S) TestAppLogBySource(c *gocheck.C) {
 	c.Assert(stdout.String(), gocheck.Equals, expected)
 }
 
+func (s *S) TestAppLogByUnit(c *gocheck.C) {
+	var stdout, stderr bytes.Buffer
+	t := time.Now()
+	logs := []log{
+		{Date: t, Message: "starting", Source: "app", Unit: "hitthelights/1"},
+	}
+	result, err := json.Marshal(logs)
+	c.Assert(err, gocheck.IsNil)
+	t = t.In(time.Local)
+	tfmt := "2006-01-02 15:04:05 -0700"
+	expected := cmd.Colorfy(t.Format(tfmt)+" [app][hitthelights/1]:", "blue", "", "") + " starting\n"
+	context := cmd.Context{
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	fake := &FakeGuesser{name: "hitthelights"}
+	command := AppLog{GuessingCommand: GuessingCommand{G: fake}}
+	command.Flags().Parse(true, []string{"--unit", "hitthelights/1"})
+	trans := &testing.ConditionalTransport{
+		Transport: testing.Transport{Message: string(result), Status: http.StatusOK},
+		CondFunc: func(req *http.Request) bool {
+			return req.URL.Query().Get("unit") == "hitthelights/1"
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	err = command.Run(&context, client)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(stdout.String(), gocheck.Equals, expected)
+}
+
 func (s *S) TestAppLogWithLines(c *gocheck.C) {
 	var stdout, stderr bytes.Buffer
 	t := time.Now()
@@ -281,7 +335,7 @@ func (s *S) TestAppLogWithFollow(c *gocheck.C) {
 func (s *S) TestAppLogFlagSet(c *gocheck.C) {
 	command := AppLog{}
 	flagset := command.Flags()
-	flagset.Parse(true, []string{"--source", "tsuru", "--lines", "12", "--app", "ashamed", "--follow"})
+	flagset.Parse(true, []string{"--source", "tsuru", "--lines", "12", "--app", "ashamed", "--unit", "ashamed/0", "--follow"})
 	source := flagset.Lookup("source")
 	c.Check(source, gocheck.NotNil)
 	c.Check(source.Name, gocheck.Equals, "source")
@@ -330,4 +384,16 @@ func (s *S) TestAppLogFlagSet(c *gocheck.C) {
 	c.Check(sfollow.Usage, gocheck.Equals, "Follow logs")
 	c.Check(sfollow.Value.String(), gocheck.Equals, "true")
 	c.Check(sfollow.DefValue, gocheck.Equals, "false")
+	unit := flagset.Lookup("unit")
+	c.Check(unit, gocheck.NotNil)
+	c.Check(unit.Name, gocheck.Equals, "unit")
+	c.Check(unit.Usage, gocheck.Equals, "The log from the given unit")
+	c.Check(unit.Value.String(), gocheck.Equals, "ashamed/0")
+	c.Check(unit.DefValue, gocheck.Equals, "")
+	sunit := flagset.Lookup("u")
+	c.Check(sunit, gocheck.NotNil)
+	c.Check(sunit.Name, gocheck.Equals, "u")
+	c.Check(sunit.Usage, gocheck.Equals, "The log from the given unit")
+	c.Check(sunit.Value.String(), gocheck.Equals, "ashamed/0")
+	c.Check(sunit.DefValue, gocheck.Equals, "")
 }
@@ -7,25 +7,44 @@ package main
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/globocom/tsuru/cmd"
 	"github.com/globocom/tsuru/cmd/tsuru-base"
+	"io"
 	"io/ioutil"
 	"launchpad.net/gnuflag"
 	"net/http"
+	"net/url"
+	"strings"
 )
 
-type AppCreate struct{}
+type AppCreate struct {
+	pool   string
+	dryRun bool
+	fs     *gnuflag.FlagSet
+}
 
-func (AppCreate) Run(context *cmd.Context, client *cmd.Client) error {
+func (c *AppCreate) Run(context *cmd.Context, client *cmd.Client) error {
 	appName := context.Args[0]
 	platform := context.Args[1]
-	b := bytes.NewBufferString(fmt.Sprintf(`{"name":"%s","platform":"%s"}`, appName, platform))
-	url, err := cmd.GetURL("/apps")
+	params := map[string]string{"name": appName, "platform": platform}
+	if c.pool != "" {
+		params["pool"] = c.pool
+	}
+	b, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	path := "/apps"
+	if c.dryRun {
+		path += "?dry-run=true"
+	}
+	url, err := cmd.GetURL(path)
 	if err != nil {
 		return err
 	}
-	request, err := http.NewRequest("POST", url, b)
+	request, err := http.NewRequest("POST", url, bytes.NewReader(b))
 	if err != nil {
 		return err
 	}
@@ -35,6 +54,17 @@ func (AppCreate) Run(context *cmd.Context, client *cmd.Client) error {
 		return err
 	}
 	defer response.Body.Close()
+	if c.dryRun {
+		var out struct{ Steps []string }
+		if err := json.NewDecoder(response.Body).Decode(&out); err != nil {
+			return err
+		}
+		fmt.Fprintf(context.Stdout, "App %q can be created. The creation would run these steps:\n", appName)
+		for _, step := range out.Steps {
+			fmt.Fprintf(context.Stdout, "  %s\n", step)
+		}
+		return nil
+	}
 	result, err := ioutil.ReadAll(response.Body)
 	if err != nil {
 		return err
@@ -50,15 +80,25 @@ func (AppCreate) Run(context *cmd.Context, client *cmd.Client) error {
 	return nil
 }
 
-func (AppCreate) Info() *cmd.Info {
+func (c *AppCreate) Info() *cmd.Info {
 	return &cmd.Info{
 		Name:    "app-create",
-		Usage:   "app-create <appname> <platform>",
-		Desc:    "create a new app.",
+		Usage:   "app-create <appname> <platform> [--pool pool] [--dry-run]",
+		Desc:    "create a new app, optionally choosing the pool of nodes where its units run. With --dry-run, the creation is only validated.",
 		MinArgs: 2,
 	}
 }
 
+func (c *AppCreate) Flags() *gnuflag.FlagSet {
+	if c.fs == nil {
+		c.fs = gnuflag.NewFlagSet("app-create", gnuflag.ExitOnError)
+		c.fs.StringVar(&c.pool, "pool", "", "Pool of nodes where the units of the app run")
+		c.fs.StringVar(&c.pool, "o", "", "Pool of nodes where the units of the app run")
+		c.fs.BoolVar(&c.dryRun, "dry-run", false, "Validates the creation of the app, without creating it")
+	}
+	return c.fs
+}
+
 type AppRemove struct {
 	tsuru.GuessingCommand
 	yes bool
@@ -183,3 +223,107 @@ func (c *UnitRemove) Run(context *cmd.Context, client *cmd.Client) error {
 	fmt.Fprintln(context.Stdout, "Units successfully removed!")
 	return nil
 }
+
+type AppRollback struct {
+	tsuru.GuessingCommand
+}
+
+func (c *AppRollback) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:  "app-rollback",
+		Usage: "app-rollback <version> [--app appname]",
+		Desc: `deploys again a previously deployed version of an app, without rebuilding it.
+
+If you don't provide the app name, tsuru will try to guess it.`,
+		MinArgs: 1,
+	}
+}
+
+func (c *AppRollback) Run(context *cmd.Context, client *cmd.Client) error {
+	appName, err := c.Guess()
+	if err != nil {
+		return err
+	}
+	u, err := cmd.GetURL(fmt.Sprintf("/apps/%s/rollback", appName))
+	if err != nil {
+		return err
+	}
+	body := strings.NewReader(url.Values{"version": []string{context.Args[0]}}.Encode())
+	request, err := http.NewRequest("POST", u, body)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	_, err = io.Copy(context.Stdout, response.Body)
+	return err
+}
+
+type SetResources struct {
+	tsuru.GuessingCommand
+	memory    int
+	cpuShares int
+	fs        *gnuflag.FlagSet
+}
+
+func (c *SetResources) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:  "set-resources",
+		Usage: "set-resources [--memory megabytes] [--cpu-shares shares] [--app appname]",
+		Desc: `defines the memory limit and the CPU shares of each unit of your app.
+
+The new values are applied in the next restart of the app. Use 0 to remove the
+memory limit or to use the default CPU shares.
+
+If you don't provide the app name, tsuru will try to guess it.`,
+		MinArgs: 0,
+	}
+}
+
+func (c *SetResources) Run(context *cmd.Context, client *cmd.Client) error {
+	appName, err := c.Guess()
+	if err != nil {
+		return err
+	}
+	resources := make(map[string]int)
+	if c.memory >= 0 {
+		resources["memory"] = c.memory
+	}
+	if c.cpuShares >= 0 {
+		resources["cpu-shares"] = c.cpuShares
+	}
+	if len(resources) == 0 {
+		return errors.New("You must provide the memory or the cpu-shares.")
+	}
+	b, err := json.Marshal(resources)
+	if err != nil {
+		return err
+	}
+	url, err := cmd.GetURL(fmt.Sprintf("/apps/%s/resources", appName))
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequest("POST", url, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	_, err = client.Do(request)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(context.Stdout, "Resources successfully defined, they will be applied in the next restart of the app.")
+	return nil
+}
+
+func (c *SetResources) Flags() *gnuflag.FlagSet {
+	if c.fs == nil {
+		c.fs = c.GuessingCommand.Flags()
+		c.fs.IntVar(&c.memory, "memory", -1, "Memory limit of each unit, in megabytes.")
+		c.fs.IntVar(&c.cpuShares, "cpu-shares", -1, "Relative CPU weight of each unit.")
+	}
+	return c.fs
+}
@@ -6,6 +6,7 @@ package main
 
 import (
 	"bytes"
+	"encoding/json"
 	"github.com/globocom/tsuru/cmd"
 	"github.com/globocom/tsuru/cmd/testing"
 	"github.com/globocom/tsuru/cmd/tsuru-base"
@@ -18,8 +19,8 @@ import (
 func (s *S) TestAppCreateInfo(c *gocheck.C) {
 	expected := &cmd.Info{
 		Name:    "app-create",
-		Usage:   "app-create <appname> <platform>",
-		Desc:    "create a new app.",
+		Usage:   "app-create <appname> <platform> [--pool pool] [--dry-run]",
+		Desc:    "create a new app, optionally choosing the pool of nodes where its units run. With --dry-run, the creation is only validated.",
 		MinArgs: 2,
 	}
 	c.Assert((&AppCreate{}).Info(), gocheck.DeepEquals, expected)
@@ -53,6 +54,66 @@ Your repository for "ble" project is "git@tsuru.plataformas.glb.com:ble.git"` +
 	c.Assert(stdout.String(), gocheck.Equals, expected)
 }
 
+func (s *S) TestAppCreateWithPool(c *gocheck.C) {
+	var stdout, stderr bytes.Buffer
+	result := `{"status":"success", "repository_url":"git@tsuru.plataformas.glb.com:ble.git"}`
+	context := cmd.Context{
+		Args:   []string{"ble", "django"},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	trans := testing.ConditionalTransport{
+		Transport: testing.Transport{Message: result, Status: http.StatusOK},
+		CondFunc: func(req *http.Request) bool {
+			defer req.Body.Close()
+			body, err := ioutil.ReadAll(req.Body)
+			c.Assert(err, gocheck.IsNil)
+			c.Assert(string(body), gocheck.Equals, `{"name":"ble","platform":"django","pool":"staging"}`)
+			return req.Method == "POST" && req.URL.Path == "/apps"
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: &trans}, nil, manager)
+	command := AppCreate{}
+	command.Flags().Parse(true, []string{"--pool", "staging"})
+	err := command.Run(&context, client)
+	c.Assert(err, gocheck.IsNil)
+}
+
+func (s *S) TestAppCreateDryRun(c *gocheck.C) {
+	var stdout, stderr bytes.Buffer
+	result := `{"status":"dry-run","steps":["reserve-user-app","insert-app"]}`
+	expected := `App "ble" can be created. The creation would run these steps:
+  reserve-user-app
+  insert-app` + "\n"
+	context := cmd.Context{
+		Args:   []string{"ble", "django"},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	trans := testing.ConditionalTransport{
+		Transport: testing.Transport{Message: result, Status: http.StatusOK},
+		CondFunc: func(req *http.Request) bool {
+			return req.Method == "POST" && req.URL.Path == "/apps" && req.URL.Query().Get("dry-run") == "true"
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: &trans}, nil, manager)
+	command := AppCreate{}
+	command.Flags().Parse(true, []string{"--dry-run"})
+	err := command.Run(&context, client)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(stdout.String(), gocheck.Equals, expected)
+}
+
+func (s *S) TestAppCreateFlags(c *gocheck.C) {
+	command := AppCreate{}
+	flagset := command.Flags()
+	flagset.Parse(true, []string{"-o", "staging"})
+	c.Assert(command.pool, gocheck.Equals, "staging")
+	pool := flagset.Lookup("pool")
+	c.Assert(pool, gocheck.NotNil)
+	c.Assert(pool.Usage, gocheck.Equals, "Pool of nodes where the units of the app run")
+}
+
 func (s *S) TestAppCreateWithInvalidFramework(c *gocheck.C) {
 	var stdout, stderr bytes.Buffer
 	context := cmd.Context{
@@ -318,3 +379,129 @@ func (s *S) TestUnitRemoveInfo(c *gocheck.C) {
 func (s *S) TestUnitRemoveIsACommand(c *gocheck.C) {
 	var _ cmd.Command = &UnitRemove{}
 }
+
+func (s *S) TestAppRollbackInfo(c *gocheck.C) {
+	expected := &cmd.Info{
+		Name:  "app-rollback",
+		Usage: "app-rollback <version> [--app appname]",
+		Desc: `deploys again a previously deployed version of an app, without rebuilding it.
+
+If you don't provide the app name, tsuru will try to guess it.`,
+		MinArgs: 1,
+	}
+	c.Assert((&AppRollback{}).Info(), gocheck.DeepEquals, expected)
+}
+
+func (s *S) TestAppRollback(c *gocheck.C) {
+	var stdout, stderr bytes.Buffer
+	var called bool
+	context := cmd.Context{
+		Args:   []string{"a345f3e"},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	trans := &testing.ConditionalTransport{
+		Transport: testing.Transport{Message: "Rolling back...", Status: http.StatusOK},
+		CondFunc: func(req *http.Request) bool {
+			called = true
+			c.Assert(req.FormValue("version"), gocheck.Equals, "a345f3e")
+			return req.URL.Path == "/apps/radio/rollback" && req.Method == "POST"
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	command := AppRollback{}
+	command.Flags().Parse(true, []string{"-a", "radio"})
+	err := command.Run(&context, client)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(called, gocheck.Equals, true)
+	c.Assert(stdout.String(), gocheck.Equals, "Rolling back...")
+}
+
+func (s *S) TestAppRollbackFailure(c *gocheck.C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Args:   []string{"a345f3e"},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	trans := &testing.Transport{Message: "Version not found.", Status: http.StatusNotFound}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	command := AppRollback{}
+	command.Flags().Parse(true, []string{"-a", "radio"})
+	err := command.Run(&context, client)
+	c.Assert(err, gocheck.NotNil)
+	c.Assert(err.Error(), gocheck.Equals, "Version not found.")
+}
+
+func (s *S) TestAppRollbackIsACommand(c *gocheck.C) {
+	var _ cmd.Command = &AppRollback{}
+}
+
+func (s *S) TestSetResourcesInfo(c *gocheck.C) {
+	expected := &cmd.Info{
+		Name:  "set-resources",
+		Usage: "set-resources [--memory megabytes] [--cpu-shares shares] [--app appname]",
+		Desc: `defines the memory limit and the CPU shares of each unit of your app.
+
+The new values are applied in the next restart of the app. Use 0 to remove the
+memory limit or to use the default CPU shares.
+
+If you don't provide the app name, tsuru will try to guess it.`,
+		MinArgs: 0,
+	}
+	c.Assert((&SetResources{}).Info(), gocheck.DeepEquals, expected)
+}
+
+func (s *S) TestSetResources(c *gocheck.C) {
+	var stdout, stderr bytes.Buffer
+	var called bool
+	context := cmd.Context{
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	trans := &testing.ConditionalTransport{
+		Transport: testing.Transport{Message: "", Status: http.StatusOK},
+		CondFunc: func(req *http.Request) bool {
+			called = true
+			var resources map[string]int
+			err := json.NewDecoder(req.Body).Decode(&resources)
+			c.Assert(err, gocheck.IsNil)
+			c.Assert(resources, gocheck.DeepEquals, map[string]int{"memory": 512})
+			return req.URL.Path == "/apps/radio/resources" && req.Method == "POST"
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	command := SetResources{}
+	command.Flags().Parse(true, []string{"-a", "radio", "--memory", "512"})
+	err := command.Run(&context, client)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(called, gocheck.Equals, true)
+	c.Assert(stdout.String(), gocheck.Equals, "Resources successfully defined, they will be applied in the next restart of the app.\n")
+}
+
+func (s *S) TestSetResourcesWithoutValues(c *gocheck.C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	trans := &testing.Transport{Message: "", Status: http.StatusOK}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	command := SetResources{}
+	command.Flags().Parse(true, []string{"-a", "radio"})
+	err := command.Run(&context, client)
+	c.Assert(err, gocheck.ErrorMatches, "You must provide the memory or the cpu-shares.")
+}
+
+func (s *S) TestSetResourcesFlags(c *gocheck.C) {
+	command := SetResources{}
+	flagset := command.Flags()
+	c.Assert(flagset, gocheck.NotNil)
+	flagset.Parse(true, []string{"--memory", "256", "--cpu-shares", "512"})
+	c.Assert(command.memory, gocheck.Equals, 256)
+	c.Assert(command.cpuShares, gocheck.Equals, 512)
+}
+
+func (s *S) TestSetResourcesIsACommand(c *gocheck.C) {
+	var _ cmd.Command = &SetResources{}
+}
@@ -0,0 +1,135 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/globocom/tsuru/cmd"
+	"github.com/globocom/tsuru/cmd/tsuru-base"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+const dateFormat = "2006-01-02 15:04:05 -0700"
+
+type deploy struct {
+	ID       string
+	App      string
+	Version  string
+	User     string
+	Start    time.Time
+	End      time.Time
+	Duration time.Duration
+	Status   string
+	Log      string
+}
+
+type AppDeploys struct {
+	tsuru.GuessingCommand
+}
+
+func (c *AppDeploys) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:  "app-deploys",
+		Usage: "app-deploys [--app appname]",
+		Desc: `lists the deploy history of an app, most recent deploys first.
+
+If you don't provide the app name, tsuru will try to guess it.`,
+		MinArgs: 0,
+	}
+}
+
+func (c *AppDeploys) Run(context *cmd.Context, client *cmd.Client) error {
+	appName, err := c.Guess()
+	if err != nil {
+		return err
+	}
+	url, err := cmd.GetURL(fmt.Sprintf("/apps/%s/deploys", appName))
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return err
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode == http.StatusNoContent {
+		fmt.Fprintf(context.Stdout, "App %q has no deploys.\n", appName)
+		return nil
+	}
+	result, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return err
+	}
+	var deploys []deploy
+	err = json.Unmarshal(result, &deploys)
+	if err != nil {
+		return err
+	}
+	table := cmd.NewTable()
+	table.Headers = cmd.Row([]string{"Id", "Version", "User", "Start", "Duration", "Status"})
+	for _, d := range deploys {
+		start := d.Start.In(time.Local).Format(dateFormat)
+		table.AddRow(cmd.Row([]string{d.ID, d.Version, d.User, start, d.Duration.String(), d.Status}))
+	}
+	context.Stdout.Write(table.Bytes())
+	return nil
+}
+
+type DeployInfo struct{}
+
+func (DeployInfo) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:    "deploy-info",
+		Usage:   "deploy-info <id>",
+		Desc:    "shows the details of a deploy, including its log.",
+		MinArgs: 1,
+	}
+}
+
+func (DeployInfo) Run(context *cmd.Context, client *cmd.Client) error {
+	url, err := cmd.GetURL("/deploys/" + context.Args[0])
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return err
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	result, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return err
+	}
+	var d deploy
+	err = json.Unmarshal(result, &d)
+	if err != nil {
+		return err
+	}
+	format := `Id: %s
+App: %s
+Version: %s
+User: %s
+Status: %s
+Start: %s
+End: %s
+Duration: %s
+
+`
+	fmt.Fprintf(context.Stdout, format, d.ID, d.App, d.Version, d.User, d.Status,
+		d.Start.In(time.Local).Format(dateFormat), d.End.In(time.Local).Format(dateFormat), d.Duration)
+	fmt.Fprint(context.Stdout, d.Log)
+	return nil
+}
@@ -0,0 +1,138 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"github.com/globocom/tsuru/cmd"
+	"github.com/globocom/tsuru/cmd/testing"
+	"launchpad.net/gocheck"
+	"net/http"
+	"time"
+)
+
+func (s *S) TestAppDeploysInfo(c *gocheck.C) {
+	expected := &cmd.Info{
+		Name:  "app-deploys",
+		Usage: "app-deploys [--app appname]",
+		Desc: `lists the deploy history of an app, most recent deploys first.
+
+If you don't provide the app name, tsuru will try to guess it.`,
+		MinArgs: 0,
+	}
+	c.Assert((&AppDeploys{}).Info(), gocheck.DeepEquals, expected)
+}
+
+func (s *S) TestAppDeploys(c *gocheck.C) {
+	var stdout, stderr bytes.Buffer
+	var called bool
+	context := cmd.Context{
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	result := `[{"ID":"52609f6f0d1ec4a2b2b56c22","App":"radio","Version":"a345f3e","User":"someone@tsuru.io","Start":"2013-10-18T02:40:00Z","End":"2013-10-18T02:41:30Z","Duration":90000000000,"Status":"success"}]`
+	trans := &testing.ConditionalTransport{
+		Transport: testing.Transport{Message: result, Status: http.StatusOK},
+		CondFunc: func(req *http.Request) bool {
+			called = true
+			return req.URL.Path == "/apps/radio/deploys" && req.Method == "GET"
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	command := AppDeploys{}
+	command.Flags().Parse(true, []string{"-a", "radio"})
+	err := command.Run(&context, client)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(called, gocheck.Equals, true)
+	start := time.Date(2013, 10, 18, 2, 40, 0, 0, time.UTC).In(time.Local).Format(dateFormat)
+	table := cmd.NewTable()
+	table.Headers = cmd.Row([]string{"Id", "Version", "User", "Start", "Duration", "Status"})
+	table.AddRow(cmd.Row([]string{"52609f6f0d1ec4a2b2b56c22", "a345f3e", "someone@tsuru.io", start, "1m30s", "success"}))
+	c.Assert(stdout.String(), gocheck.Equals, table.String())
+}
+
+func (s *S) TestAppDeploysWithoutDeploys(c *gocheck.C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	trans := &testing.Transport{Message: "", Status: http.StatusNoContent}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	command := AppDeploys{}
+	command.Flags().Parse(true, []string{"-a", "radio"})
+	err := command.Run(&context, client)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(stdout.String(), gocheck.Equals, "App \"radio\" has no deploys.\n")
+}
+
+func (s *S) TestAppDeploysIsACommand(c *gocheck.C) {
+	var _ cmd.Command = &AppDeploys{}
+}
+
+func (s *S) TestDeployInfoInfo(c *gocheck.C) {
+	expected := &cmd.Info{
+		Name:    "deploy-info",
+		Usage:   "deploy-info <id>",
+		Desc:    "shows the details of a deploy, including its log.",
+		MinArgs: 1,
+	}
+	c.Assert(DeployInfo{}.Info(), gocheck.DeepEquals, expected)
+}
+
+func (s *S) TestDeployInfo(c *gocheck.C) {
+	var stdout, stderr bytes.Buffer
+	var called bool
+	context := cmd.Context{
+		Args:   []string{"52609f6f0d1ec4a2b2b56c22"},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	result := `{"ID":"52609f6f0d1ec4a2b2b56c22","App":"radio","Version":"a345f3e","User":"someone@tsuru.io","Start":"2013-10-18T02:40:00Z","End":"2013-10-18T02:41:30Z","Duration":90000000000,"Status":"failure","Log":"installing dependencies\nfailed\n"}`
+	trans := &testing.ConditionalTransport{
+		Transport: testing.Transport{Message: result, Status: http.StatusOK},
+		CondFunc: func(req *http.Request) bool {
+			called = true
+			return req.URL.Path == "/deploys/52609f6f0d1ec4a2b2b56c22" && req.Method == "GET"
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	err := DeployInfo{}.Run(&context, client)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(called, gocheck.Equals, true)
+	start := time.Date(2013, 10, 18, 2, 40, 0, 0, time.UTC).In(time.Local).Format(dateFormat)
+	end := time.Date(2013, 10, 18, 2, 41, 30, 0, time.UTC).In(time.Local).Format(dateFormat)
+	expected := `Id: 52609f6f0d1ec4a2b2b56c22
+App: radio
+Version: a345f3e
+User: someone@tsuru.io
+Status: failure
+Start: ` + start + `
+End: ` + end + `
+Duration: 1m30s
+
+installing dependencies
+failed
+`
+	c.Assert(stdout.String(), gocheck.Equals, expected)
+}
+
+func (s *S) TestDeployInfoNotFound(c *gocheck.C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Args:   []string{"52609f6f0d1ec4a2b2b56c22"},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	trans := &testing.Transport{Message: "Deploy not found.", Status: http.StatusNotFound}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	err := DeployInfo{}.Run(&context, client)
+	c.Assert(err, gocheck.NotNil)
+	c.Assert(err.Error(), gocheck.Equals, "Deploy not found.")
+}
+
+func (s *S) TestDeployInfoIsACommand(c *gocheck.C) {
+	var _ cmd.Command = DeployInfo{}
+}
@@ -28,6 +28,11 @@ The currently available commands are (grouped by subject):
 	reset-password    redefines your password
 	key-add           adds a public key to tsuru deploy server
 	key-remove        removes a public key from tsuru deploy server
+	token-create      creates a named API token
+	token-list        lists your API tokens
+	token-revoke      revokes an API token
+	event-list        lists the actions done in tsuru
+	event-info        shows the details of an action
 
 	team-create       creates a new team (adding the current user to it automatically)
 	team-remove       removes a team from tsuru
@@ -45,6 +50,9 @@ The currently available commands are (grouped by subject):
 	unit-add          adds new units to an app
 	unit-remove       remove units from an app
 	log               shows log for an app
+	app-log-drain-add     forwards the logs of an app to a drain
+	app-log-drain-remove  stops forwarding the logs of an app to a drain
+	app-log-drain-list    lists the log drains of an app
 	run               runs a command in all units of an app
 	restart           restarts the app's application server
 	set-cname         defines a cname for an app
@@ -71,7 +79,7 @@ Use "tsuru help <command>" for more information about a command.
 Guessing app names
 
 In some app-related commands (app-remove, app-info, app-grant, app-revoke, log,
-run, restart, env-get, env-set, env-unset, bind and unbind), there is an
+app-log-drain-add, app-log-drain-remove, app-log-drain-list, run, restart, env-get, env-set, env-unset, bind and unbind), there is an
 optional parameter --app, used to specify the name of the app.
 
 The --app parameter is optional, if omitted, tsuru will try to "guess" the name
@@ -139,12 +147,16 @@ Authenticate within remote tsuru server
 
 Usage:
 
-	% tsuru login <email>
+	% tsuru login [email]
 
 Login will ask for the password and check if the user is successfully
 authenticated. If so, the token generated by the tsuru server will be stored in
 ${HOME}/.tsuru_token.
 
+When the tsuru server uses OAuth authentication, the email is not required:
+login opens the authorization page in the browser, and waits for the callback
+of the authorization server.
+
 All tsuru actions require the user to be authenticated (except login and
 user-create, obviously).
 
@@ -218,6 +230,51 @@ you can pass it as parameter to key-remove:
 The key will be removed from the current logged in user.
 
 
+Create a named API token
+
+Usage:
+
+	% tsuru token-create <name> --expires days [--scope read|deploy|app] [--apps app1,app2]
+
+token-create creates a long-lived token, that is not tied to your login
+session, to be used by scripts and CI systems. The scope of the token limits
+what it can do: read tokens can only read apps, deploy tokens can also
+rollback and restart apps, and app tokens can do anything you can do, but only
+with the apps given in the --apps flag. For example:
+
+	% tsuru token-create ci --scope deploy --expires 90
+
+The token is displayed only once. Use token-list to list your tokens and
+token-revoke to revoke them.
+
+
+List events
+
+Usage:
+
+	% tsuru event-list [--app appname] [--user email] [--kind kind] [--since time] [--until time] [--limit n]
+
+event-list lists the actions done in tsuru, like app creation, restarts and
+deploys, most recent first. The times given in --since and --until may be
+durations, like 2h, or times in RFC 3339 format. For example, to list the
+restarts of an app in the last day:
+
+	% tsuru event-list --app myapp --kind app-restart --since 24h
+
+Unless you're an admin, you can list only your own events or the events of the
+apps you have access.
+
+
+Show the details of an event
+
+Usage:
+
+	% tsuru event-info <id>
+
+event-info shows the details of an event, including its error and the payload
+of the request.
+
+
 Create a new team for the user
 
 Usage:
@@ -288,7 +345,7 @@ Create an app
 
 Usage:
 
-	% tsuru app-create <app-name> <platform>
+	% tsuru app-create <app-name> <platform> [--pool pool]
 
 app-create will create a new app using the given name and platform. For tsuru,
 a platform is a Juju charm. To check the available platforms, use the command
@@ -298,6 +355,11 @@ In order to create an app, you need to be member of at least one team. All
 teams that you are member (see "tsuru team-list") will be able to access the
 app.
 
+The --pool flag chooses the pool of nodes where the units of the app run. The
+pool must be assigned to one of your teams, or be the default pool. Without
+it, the units run in the first pool assigned to one of the teams of the app, or
+in the default pool.
+
 
 Remove an app
 
@@ -390,7 +452,7 @@ See app's logs
 
 Usage:
 
-	% tsuru log [--app|-a appname] [--lines|-l numberOfLines] [--source|-s source] [--follow|-f]
+	% tsuru log [--app|-a appname] [--lines|-l numberOfLines] [--source|-s source] [--unit|-u unit] [--follow|-f]
 
 Log will show log entries for an app. These logs are not related to the code of
 the app itself, but to actions of the app in tsuru server (deployments,
@@ -399,6 +461,29 @@ restarts, etc.).
 The --app flag is optional, see "Guessing app names" section for more details.
 The --lines flag is optional and by default its value is 10.
 The --source flag is optional.
+The --unit flag is optional, and shows only the logs of the given unit.
+The --follow flag is optional. When it's used, log keeps showing the new
+entries of the app, until it's interrupted.
+
+
+Forward app's logs to external drains
+
+Usage:
+
+	% tsuru app-log-drain-add <url> [--app appname]
+	% tsuru app-log-drain-remove <url> [--app appname]
+	% tsuru app-log-drain-list [--app appname]
+
+app-log-drain-add makes tsuru forward every log entry of the app to the given
+drain, besides storing it. The url may be a syslog server, over TCP
+(syslog://host:port) or UDP (syslog+udp://host:port), or an HTTP endpoint
+(http://host/path), that receives the logs in JSON format. Logs are buffered
+and forwarded in background, and the delivery is retried when the drain fails.
+
+app-log-drain-remove stops forwarding the logs to the drain, and
+app-log-drain-list lists the drains of the app.
+
+The --app flag is optional, see "Guessing app names" section for more details.
 
 
 Run an arbitrary command in the app machine
@@ -0,0 +1,196 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/globocom/tsuru/cmd"
+	"launchpad.net/gnuflag"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+type event struct {
+	ID     string
+	Kind   string
+	Target struct {
+		Type string
+		Name string
+	}
+	Owner     string
+	StartTime time.Time
+	EndTime   time.Time
+	Error     string
+	Payload   string
+}
+
+func (e *event) target() string {
+	if e.Target.Name == "" {
+		return e.Target.Type
+	}
+	return e.Target.Type + " " + e.Target.Name
+}
+
+func (e *event) status() string {
+	if e.EndTime.IsZero() {
+		return "running"
+	}
+	if e.Error != "" {
+		return "error"
+	}
+	return "success"
+}
+
+type eventList struct {
+	app   string
+	user  string
+	kind  string
+	since string
+	until string
+	limit int
+	fs    *gnuflag.FlagSet
+}
+
+func (c *eventList) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:  "event-list",
+		Usage: "event-list [--app appname] [--user email] [--kind kind] [--since time] [--until time] [--limit n]",
+		Desc: `lists the actions done in tsuru, most recent first.
+
+The times given in --since and --until may be durations, like 2h or 30m, or
+times in RFC 3339 format, like 2013-12-10T15:00:00Z. Unless you're an admin,
+you can list only your own events or the events of the apps you have access.`,
+		MinArgs: 0,
+	}
+}
+
+// eventTime converts durations to times in RFC 3339 format, relative to now.
+// Other values are sent as given.
+func eventTime(value string) string {
+	if d, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(-d).UTC().Format(time.RFC3339)
+	}
+	return value
+}
+
+func (c *eventList) Run(context *cmd.Context, client *cmd.Client) error {
+	query := url.Values{}
+	filters := map[string]string{"app": c.app, "user": c.user, "kind": c.kind}
+	for name, value := range filters {
+		if value != "" {
+			query.Set(name, value)
+		}
+	}
+	if c.since != "" {
+		query.Set("since", eventTime(c.since))
+	}
+	if c.until != "" {
+		query.Set("until", eventTime(c.until))
+	}
+	if c.limit > 0 {
+		query.Set("limit", strconv.Itoa(c.limit))
+	}
+	u, err := cmd.GetURL("/events?" + query.Encode())
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return err
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode == http.StatusNoContent {
+		fmt.Fprintln(context.Stdout, "No events found.")
+		return nil
+	}
+	var events []event
+	err = json.NewDecoder(response.Body).Decode(&events)
+	if err != nil {
+		return err
+	}
+	table := cmd.NewTable()
+	table.Headers = cmd.Row{"Id", "Start", "Kind", "Target", "Owner", "Status"}
+	for _, e := range events {
+		start := e.StartTime.In(time.Local).Format(dateFormat)
+		table.AddRow(cmd.Row{e.ID, start, e.Kind, e.target(), e.Owner, e.status()})
+	}
+	context.Stdout.Write(table.Bytes())
+	return nil
+}
+
+func (c *eventList) Flags() *gnuflag.FlagSet {
+	if c.fs == nil {
+		c.fs = gnuflag.NewFlagSet("event-list", gnuflag.ExitOnError)
+		c.fs.StringVar(&c.app, "app", "", "Lists only the events of the app")
+		c.fs.StringVar(&c.app, "a", "", "Lists only the events of the app")
+		c.fs.StringVar(&c.user, "user", "", "Lists only the events of the user")
+		c.fs.StringVar(&c.user, "u", "", "Lists only the events of the user")
+		c.fs.StringVar(&c.kind, "kind", "", "Lists only the events of the kind, like app-restart")
+		c.fs.StringVar(&c.kind, "k", "", "Lists only the events of the kind, like app-restart")
+		c.fs.StringVar(&c.since, "since", "", "Lists only the events started after the time")
+		c.fs.StringVar(&c.until, "until", "", "Lists only the events started before the time")
+		c.fs.IntVar(&c.limit, "limit", 0, "Maximum number of events")
+		c.fs.IntVar(&c.limit, "l", 0, "Maximum number of events")
+	}
+	return c.fs
+}
+
+type eventInfo struct{}
+
+func (eventInfo) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:    "event-info",
+		Usage:   "event-info <id>",
+		Desc:    "shows the details of an event, including its payload.",
+		MinArgs: 1,
+	}
+}
+
+func (eventInfo) Run(context *cmd.Context, client *cmd.Client) error {
+	u, err := cmd.GetURL("/events/" + context.Args[0])
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return err
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	var e event
+	err = json.NewDecoder(response.Body).Decode(&e)
+	if err != nil {
+		return err
+	}
+	format := `Id: %s
+Kind: %s
+Target: %s
+Owner: %s
+Status: %s
+Start: %s
+`
+	fmt.Fprintf(context.Stdout, format, e.ID, e.Kind, e.target(), e.Owner, e.status(),
+		e.StartTime.In(time.Local).Format(dateFormat))
+	if !e.EndTime.IsZero() {
+		fmt.Fprintf(context.Stdout, "End: %s\n", e.EndTime.In(time.Local).Format(dateFormat))
+	}
+	if e.Error != "" {
+		fmt.Fprintf(context.Stdout, "Error: %s\n", e.Error)
+	}
+	if e.Payload != "" {
+		fmt.Fprintf(context.Stdout, "\n%s\n", e.Payload)
+	}
+	return nil
+}
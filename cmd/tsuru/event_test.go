@@ -0,0 +1,156 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"github.com/globocom/tsuru/cmd"
+	"github.com/globocom/tsuru/cmd/testing"
+	"launchpad.net/gocheck"
+	"net/http"
+	"time"
+)
+
+func (s *S) TestEventListInfo(c *gocheck.C) {
+	expected := &cmd.Info{
+		Name:  "event-list",
+		Usage: "event-list [--app appname] [--user email] [--kind kind] [--since time] [--until time] [--limit n]",
+		Desc: `lists the actions done in tsuru, most recent first.
+
+The times given in --since and --until may be durations, like 2h or 30m, or
+times in RFC 3339 format, like 2013-12-10T15:00:00Z. Unless you're an admin,
+you can list only your own events or the events of the apps you have access.`,
+		MinArgs: 0,
+	}
+	c.Assert((&eventList{}).Info(), gocheck.DeepEquals, expected)
+}
+
+func (s *S) TestEventList(c *gocheck.C) {
+	var stdout, stderr bytes.Buffer
+	var called bool
+	context := cmd.Context{
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	result := `[{"ID":"52a7256ee9d8a25be3000001","Kind":"app-restart","Target":{"Type":"app","Name":"radio"},"Owner":"someone@tsuru.io","StartTime":"2013-12-10T15:00:00Z","EndTime":"2013-12-10T15:00:10Z"},
+{"ID":"52a7256ee9d8a25be3000002","Kind":"team-create","Target":{"Type":"team","Name":"ops"},"Owner":"someone@tsuru.io","StartTime":"2013-12-10T14:00:00Z","EndTime":"2013-12-10T14:00:01Z","Error":"team already exists"}]`
+	trans := &testing.ConditionalTransport{
+		Transport: testing.Transport{Message: result, Status: http.StatusOK},
+		CondFunc: func(req *http.Request) bool {
+			called = true
+			return req.URL.Path == "/events" && req.Method == "GET" &&
+				req.URL.Query().Get("user") == "someone@tsuru.io" &&
+				req.URL.Query().Get("limit") == "2" &&
+				req.URL.Query().Get("until") == "2013-12-11T00:00:00Z"
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	command := eventList{}
+	command.Flags().Parse(true, []string{"-u", "someone@tsuru.io", "-l", "2", "--until", "2013-12-11T00:00:00Z"})
+	err := command.Run(&context, client)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(called, gocheck.Equals, true)
+	table := cmd.NewTable()
+	table.Headers = cmd.Row{"Id", "Start", "Kind", "Target", "Owner", "Status"}
+	start1 := time.Date(2013, 12, 10, 15, 0, 0, 0, time.UTC).In(time.Local).Format(dateFormat)
+	start2 := time.Date(2013, 12, 10, 14, 0, 0, 0, time.UTC).In(time.Local).Format(dateFormat)
+	table.AddRow(cmd.Row{"52a7256ee9d8a25be3000001", start1, "app-restart", "app radio", "someone@tsuru.io", "success"})
+	table.AddRow(cmd.Row{"52a7256ee9d8a25be3000002", start2, "team-create", "team ops", "someone@tsuru.io", "error"})
+	c.Assert(stdout.String(), gocheck.Equals, table.String())
+}
+
+func (s *S) TestEventListSinceDuration(c *gocheck.C) {
+	var stdout, stderr bytes.Buffer
+	var since time.Time
+	context := cmd.Context{
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	trans := &testing.ConditionalTransport{
+		Transport: testing.Transport{Message: "", Status: http.StatusNoContent},
+		CondFunc: func(req *http.Request) bool {
+			var err error
+			since, err = time.Parse(time.RFC3339, req.URL.Query().Get("since"))
+			return err == nil && req.URL.Query().Get("app") == "radio"
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	command := eventList{}
+	command.Flags().Parse(true, []string{"-a", "radio", "--since", "2h"})
+	err := command.Run(&context, client)
+	c.Assert(err, gocheck.IsNil)
+	diff := time.Now().Add(-2 * time.Hour).Sub(since)
+	c.Assert(diff < time.Minute && diff > -time.Minute, gocheck.Equals, true)
+	c.Assert(stdout.String(), gocheck.Equals, "No events found.\n")
+}
+
+func (s *S) TestEventInfoInfo(c *gocheck.C) {
+	expected := &cmd.Info{
+		Name:    "event-info",
+		Usage:   "event-info <id>",
+		Desc:    "shows the details of an event, including its payload.",
+		MinArgs: 1,
+	}
+	c.Assert(eventInfo{}.Info(), gocheck.DeepEquals, expected)
+}
+
+func (s *S) TestEventInfo(c *gocheck.C) {
+	var stdout, stderr bytes.Buffer
+	var called bool
+	context := cmd.Context{
+		Args:   []string{"52a7256ee9d8a25be3000001"},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	result := `{"ID":"52a7256ee9d8a25be3000001","Kind":"app-create","Target":{"Type":"app","Name":"radio"},"Owner":"someone@tsuru.io","StartTime":"2013-12-10T15:00:00Z","EndTime":"2013-12-10T15:00:10Z","Error":"quota exceeded","Payload":"{\"name\":\"radio\",\"platform\":\"python\"}"}`
+	trans := &testing.ConditionalTransport{
+		Transport: testing.Transport{Message: result, Status: http.StatusOK},
+		CondFunc: func(req *http.Request) bool {
+			called = true
+			return req.URL.Path == "/events/52a7256ee9d8a25be3000001" && req.Method == "GET"
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	err := eventInfo{}.Run(&context, client)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(called, gocheck.Equals, true)
+	start := time.Date(2013, 12, 10, 15, 0, 0, 0, time.UTC).In(time.Local).Format(dateFormat)
+	end := time.Date(2013, 12, 10, 15, 0, 10, 0, time.UTC).In(time.Local).Format(dateFormat)
+	expected := `Id: 52a7256ee9d8a25be3000001
+Kind: app-create
+Target: app radio
+Owner: someone@tsuru.io
+Status: error
+Start: ` + start + `
+End: ` + end + `
+Error: quota exceeded
+
+{"name":"radio","platform":"python"}
+`
+	c.Assert(stdout.String(), gocheck.Equals, expected)
+}
+
+func (s *S) TestEventInfoRunning(c *gocheck.C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Args:   []string{"52a7256ee9d8a25be3000001"},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	result := `{"ID":"52a7256ee9d8a25be3000001","Kind":"app-deploy","Target":{"Type":"app","Name":"radio"},"Owner":"app:radio","StartTime":"2013-12-10T15:00:00Z","EndTime":"0001-01-01T00:00:00Z"}`
+	trans := &testing.Transport{Message: result, Status: http.StatusOK}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	err := eventInfo{}.Run(&context, client)
+	c.Assert(err, gocheck.IsNil)
+	start := time.Date(2013, 12, 10, 15, 0, 0, 0, time.UTC).In(time.Local).Format(dateFormat)
+	expected := `Id: 52a7256ee9d8a25be3000001
+Kind: app-deploy
+Target: app radio
+Owner: app:radio
+Status: running
+Start: ` + start + `
+`
+	c.Assert(stdout.String(), gocheck.Equals, expected)
+}
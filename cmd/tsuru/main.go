@@ -19,12 +19,22 @@ func buildManager(name string) *cmd.Manager {
 	m := cmd.BuildBaseManager(name, version, header)
 	m.Register(&tsuru.AppRun{})
 	m.Register(&tsuru.AppInfo{})
-	m.Register(AppCreate{})
+	m.Register(&AppCreate{})
 	m.Register(&AppRemove{})
+	m.Register(&AppRollback{})
+	m.Register(&AppDeploys{})
+	m.Register(DeployInfo{})
+	m.Register(&SetResources{})
 	m.Register(&UnitAdd{})
 	m.Register(&UnitRemove{})
 	m.Register(tsuru.AppList{})
 	m.Register(&tsuru.AppLog{})
+	m.Register(&tsuru.LogDrainAdd{})
+	m.Register(&tsuru.LogDrainRemove{})
+	m.Register(&tsuru.LogDrainList{})
+	m.Register(&tsuru.AutoscaleSet{})
+	m.Register(&tsuru.AutoscaleInfo{})
+	m.Register(&tsuru.AutoscaleUnset{})
 	m.Register(&tsuru.AppGrant{})
 	m.Register(&tsuru.AppRevoke{})
 	m.Register(&tsuru.AppRestart{})
@@ -35,6 +45,11 @@ func buildManager(name string) *cmd.Manager {
 	m.Register(&tsuru.EnvUnset{})
 	m.Register(&KeyAdd{})
 	m.Register(&KeyRemove{})
+	m.Register(&tokenCreate{})
+	m.Register(tokenList{})
+	m.Register(tokenRevoke{})
+	m.Register(&eventList{})
+	m.Register(eventInfo{})
 	m.Register(tsuru.ServiceList{})
 	m.Register(tsuru.ServiceAdd{})
 	m.Register(tsuru.ServiceRemove{})
@@ -24,7 +24,7 @@ func (s *S) TestAppCreateIsRegistered(c *gocheck.C) {
 	manager := buildManager("tsuru")
 	create, ok := manager.Commands["app-create"]
 	c.Assert(ok, gocheck.Equals, true)
-	c.Assert(create, gocheck.FitsTypeOf, AppCreate{})
+	c.Assert(create, gocheck.FitsTypeOf, &AppCreate{})
 }
 
 func (s *S) TestAppRemoveIsRegistered(c *gocheck.C) {
@@ -174,6 +174,34 @@ func (s *S) TestAppInfoIsRegistered(c *gocheck.C) {
 	c.Assert(list, gocheck.FitsTypeOf, &tsuru.AppInfo{})
 }
 
+func (s *S) TestAppRollbackIsRegistered(c *gocheck.C) {
+	manager := buildManager("tsuru")
+	rollback, ok := manager.Commands["app-rollback"]
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(rollback, gocheck.FitsTypeOf, &AppRollback{})
+}
+
+func (s *S) TestAppDeploysIsRegistered(c *gocheck.C) {
+	manager := buildManager("tsuru")
+	deploys, ok := manager.Commands["app-deploys"]
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(deploys, gocheck.FitsTypeOf, &AppDeploys{})
+}
+
+func (s *S) TestDeployInfoIsRegistered(c *gocheck.C) {
+	manager := buildManager("tsuru")
+	info, ok := manager.Commands["deploy-info"]
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(info, gocheck.FitsTypeOf, DeployInfo{})
+}
+
+func (s *S) TestSetResourcesIsRegistered(c *gocheck.C) {
+	manager := buildManager("tsuru")
+	set, ok := manager.Commands["set-resources"]
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(set, gocheck.FitsTypeOf, &SetResources{})
+}
+
 func (s *S) TestUnitAddIsRegistered(c *gocheck.C) {
 	manager := buildManager("tsuru")
 	addunit, ok := manager.Commands["unit-add"]
@@ -202,6 +230,48 @@ func (s *S) TestUnsetCNameIsRegistered(c *gocheck.C) {
 	c.Assert(cname, gocheck.FitsTypeOf, &tsuru.UnsetCName{})
 }
 
+func (s *S) TestLogDrainAddIsRegistered(c *gocheck.C) {
+	manager := buildManager("tsuru")
+	drain, ok := manager.Commands["app-log-drain-add"]
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(drain, gocheck.FitsTypeOf, &tsuru.LogDrainAdd{})
+}
+
+func (s *S) TestLogDrainRemoveIsRegistered(c *gocheck.C) {
+	manager := buildManager("tsuru")
+	drain, ok := manager.Commands["app-log-drain-remove"]
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(drain, gocheck.FitsTypeOf, &tsuru.LogDrainRemove{})
+}
+
+func (s *S) TestLogDrainListIsRegistered(c *gocheck.C) {
+	manager := buildManager("tsuru")
+	drain, ok := manager.Commands["app-log-drain-list"]
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(drain, gocheck.FitsTypeOf, &tsuru.LogDrainList{})
+}
+
+func (s *S) TestAutoscaleSetIsRegistered(c *gocheck.C) {
+	manager := buildManager("tsuru")
+	autoscale, ok := manager.Commands["app-autoscale-set"]
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(autoscale, gocheck.FitsTypeOf, &tsuru.AutoscaleSet{})
+}
+
+func (s *S) TestAutoscaleInfoIsRegistered(c *gocheck.C) {
+	manager := buildManager("tsuru")
+	autoscale, ok := manager.Commands["app-autoscale-info"]
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(autoscale, gocheck.FitsTypeOf, &tsuru.AutoscaleInfo{})
+}
+
+func (s *S) TestAutoscaleUnsetIsRegistered(c *gocheck.C) {
+	manager := buildManager("tsuru")
+	autoscale, ok := manager.Commands["app-autoscale-unset"]
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(autoscale, gocheck.FitsTypeOf, &tsuru.AutoscaleUnset{})
+}
+
 func (s *S) TestPlatformListIsRegistered(c *gocheck.C) {
 	manager := buildManager("tsuru")
 	plat, ok := manager.Commands["platform-list"]
@@ -215,3 +285,38 @@ func (s *S) TestSwapIsRegistered(c *gocheck.C) {
 	c.Assert(ok, gocheck.Equals, true)
 	c.Assert(cmd, gocheck.FitsTypeOf, swap{})
 }
+
+func (s *S) TestTokenCreateIsRegistered(c *gocheck.C) {
+	manager := buildManager("tsuru")
+	create, ok := manager.Commands["token-create"]
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(create, gocheck.FitsTypeOf, &tokenCreate{})
+}
+
+func (s *S) TestTokenListIsRegistered(c *gocheck.C) {
+	manager := buildManager("tsuru")
+	list, ok := manager.Commands["token-list"]
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(list, gocheck.FitsTypeOf, tokenList{})
+}
+
+func (s *S) TestTokenRevokeIsRegistered(c *gocheck.C) {
+	manager := buildManager("tsuru")
+	revoke, ok := manager.Commands["token-revoke"]
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(revoke, gocheck.FitsTypeOf, tokenRevoke{})
+}
+
+func (s *S) TestEventListIsRegistered(c *gocheck.C) {
+	manager := buildManager("tsuru")
+	list, ok := manager.Commands["event-list"]
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(list, gocheck.FitsTypeOf, &eventList{})
+}
+
+func (s *S) TestEventInfoIsRegistered(c *gocheck.C) {
+	manager := buildManager("tsuru")
+	info, ok := manager.Commands["event-info"]
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(info, gocheck.FitsTypeOf, eventInfo{})
+}
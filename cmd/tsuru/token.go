@@ -0,0 +1,171 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/globocom/tsuru/cmd"
+	"launchpad.net/gnuflag"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type apiToken struct {
+	Token   string
+	Name    string
+	Scope   string
+	Apps    []string
+	Expires time.Time
+}
+
+type tokenCreate struct {
+	scope   string
+	apps    string
+	expires int
+	fs      *gnuflag.FlagSet
+}
+
+func (c *tokenCreate) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:  "token-create",
+		Usage: "token-create <name> --expires days [--scope read|deploy|app] [--apps app1,app2]",
+		Desc: `creates a named API token, to be used by scripts and CI systems.
+
+The scope of the token defines what it can do: read tokens can only read apps,
+deploy tokens can also rollback and restart apps, and app tokens can do
+anything you can do, but only with the given apps.
+
+The token is displayed only once, store it in a safe place.`,
+		MinArgs: 1,
+	}
+}
+
+func (c *tokenCreate) Run(context *cmd.Context, client *cmd.Client) error {
+	if c.expires <= 0 {
+		return errors.New("You must provide the expiration of the token, in days.")
+	}
+	body := map[string]interface{}{
+		"name":    context.Args[0],
+		"scope":   c.scope,
+		"expires": c.expires,
+	}
+	if c.apps != "" {
+		body["apps"] = strings.Split(c.apps, ",")
+	}
+	b, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	url, err := cmd.GetURL("/users/tokens")
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequest("POST", url, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	var token apiToken
+	err = json.NewDecoder(response.Body).Decode(&token)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(context.Stdout, "Token %q successfully created: %s\n", token.Name, token.Token)
+	return nil
+}
+
+func (c *tokenCreate) Flags() *gnuflag.FlagSet {
+	if c.fs == nil {
+		c.fs = gnuflag.NewFlagSet("token-create", gnuflag.ExitOnError)
+		c.fs.StringVar(&c.scope, "scope", "read", "Scope of the token: read, deploy or app")
+		c.fs.StringVar(&c.scope, "s", "read", "Scope of the token: read, deploy or app")
+		c.fs.StringVar(&c.apps, "apps", "", "Comma separated list of apps of the token, for the app scope")
+		c.fs.StringVar(&c.apps, "a", "", "Comma separated list of apps of the token, for the app scope")
+		c.fs.IntVar(&c.expires, "expires", 0, "Number of days until the token expires")
+		c.fs.IntVar(&c.expires, "e", 0, "Number of days until the token expires")
+	}
+	return c.fs
+}
+
+type tokenList struct{}
+
+func (tokenList) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:    "token-list",
+		Usage:   "token-list",
+		Desc:    "lists your API tokens.",
+		MinArgs: 0,
+	}
+}
+
+func (tokenList) Run(context *cmd.Context, client *cmd.Client) error {
+	url, err := cmd.GetURL("/users/tokens")
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return err
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode == http.StatusNoContent {
+		fmt.Fprintln(context.Stdout, "You don't have any API tokens.")
+		return nil
+	}
+	var tokens []apiToken
+	err = json.NewDecoder(response.Body).Decode(&tokens)
+	if err != nil {
+		return err
+	}
+	table := cmd.NewTable()
+	table.Headers = cmd.Row{"Name", "Scope", "Apps", "Expires"}
+	for _, t := range tokens {
+		table.AddRow(cmd.Row{t.Name, t.Scope, strings.Join(t.Apps, ", "), t.Expires.Format(time.RFC822)})
+	}
+	context.Stdout.Write(table.Bytes())
+	return nil
+}
+
+type tokenRevoke struct{}
+
+func (tokenRevoke) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:    "token-revoke",
+		Usage:   "token-revoke <name>",
+		Desc:    "revokes one of your API tokens.",
+		MinArgs: 1,
+	}
+}
+
+func (tokenRevoke) Run(context *cmd.Context, client *cmd.Client) error {
+	name := context.Args[0]
+	url, err := cmd.GetURL("/users/tokens/" + name)
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequest("DELETE", url, nil)
+	if err != nil {
+		return err
+	}
+	_, err = client.Do(request)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(context.Stdout, "Token %q successfully revoked!\n", name)
+	return nil
+}
@@ -0,0 +1,143 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/globocom/tsuru/cmd"
+	"github.com/globocom/tsuru/cmd/testing"
+	"launchpad.net/gocheck"
+	"net/http"
+	"time"
+)
+
+func (s *S) TestTokenCreateInfo(c *gocheck.C) {
+	info := (&tokenCreate{}).Info()
+	c.Assert(info.Name, gocheck.Equals, "token-create")
+	c.Assert(info.Usage, gocheck.Equals, "token-create <name> --expires days [--scope read|deploy|app] [--apps app1,app2]")
+	c.Assert(info.MinArgs, gocheck.Equals, 1)
+}
+
+func (s *S) TestTokenCreate(c *gocheck.C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Args:   []string{"ci"},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	trans := testing.ConditionalTransport{
+		Transport: testing.Transport{Message: `{"token":"abc123","name":"ci","scope":"app"}`, Status: http.StatusOK},
+		CondFunc: func(req *http.Request) bool {
+			var body map[string]interface{}
+			err := json.NewDecoder(req.Body).Decode(&body)
+			c.Assert(err, gocheck.IsNil)
+			c.Assert(body["name"], gocheck.Equals, "ci")
+			c.Assert(body["scope"], gocheck.Equals, "app")
+			c.Assert(body["apps"], gocheck.DeepEquals, []interface{}{"myapp", "otherapp"})
+			c.Assert(body["expires"], gocheck.Equals, float64(90))
+			return req.Method == "POST" && req.URL.Path == "/users/tokens"
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: &trans}, nil, manager)
+	command := tokenCreate{}
+	command.Flags().Parse(true, []string{"-s", "app", "--apps", "myapp,otherapp", "-e", "90"})
+	err := command.Run(&context, client)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(stdout.String(), gocheck.Equals, "Token \"ci\" successfully created: abc123\n")
+}
+
+func (s *S) TestTokenCreateWithoutExpiration(c *gocheck.C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Args:   []string{"ci"},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	command := tokenCreate{}
+	command.Flags().Parse(true, []string{"--scope", "deploy"})
+	err := command.Run(&context, nil)
+	c.Assert(err, gocheck.NotNil)
+	c.Assert(err.Error(), gocheck.Equals, "You must provide the expiration of the token, in days.")
+}
+
+func (s *S) TestTokenCreateFlags(c *gocheck.C) {
+	command := tokenCreate{}
+	flagset := command.Flags()
+	c.Assert(flagset, gocheck.NotNil)
+	flagset.Parse(true, []string{})
+	c.Assert(command.scope, gocheck.Equals, "read")
+	c.Assert(command.expires, gocheck.Equals, 0)
+	expires := flagset.Lookup("expires")
+	c.Assert(expires, gocheck.NotNil)
+	c.Assert(expires.Usage, gocheck.Equals, "Number of days until the token expires")
+}
+
+func (s *S) TestTokenCreateIsAFlaggedCommand(c *gocheck.C) {
+	var _ cmd.FlaggedCommand = &tokenCreate{}
+}
+
+func (s *S) TestTokenList(c *gocheck.C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	expires := time.Date(2013, 12, 25, 10, 0, 0, 0, time.UTC)
+	tokens := []apiToken{
+		{Name: "ci", Scope: "deploy", Expires: expires},
+		{Name: "monitor", Scope: "app", Apps: []string{"myapp", "otherapp"}, Expires: expires},
+	}
+	result, err := json.Marshal(tokens)
+	c.Assert(err, gocheck.IsNil)
+	trans := testing.ConditionalTransport{
+		Transport: testing.Transport{Message: string(result), Status: http.StatusOK},
+		CondFunc: func(req *http.Request) bool {
+			return req.Method == "GET" && req.URL.Path == "/users/tokens"
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: &trans}, nil, manager)
+	err = tokenList{}.Run(&context, client)
+	c.Assert(err, gocheck.IsNil)
+	expected := `+---------+--------+-----------------+---------------------+
+| Name    | Scope  | Apps            | Expires             |
++---------+--------+-----------------+---------------------+
+| ci      | deploy |                 | 25 Dec 13 10:00 UTC |
+| monitor | app    | myapp, otherapp | 25 Dec 13 10:00 UTC |
++---------+--------+-----------------+---------------------+
+`
+	c.Assert(stdout.String(), gocheck.Equals, expected)
+}
+
+func (s *S) TestTokenListEmpty(c *gocheck.C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	client := cmd.NewClient(&http.Client{Transport: &testing.Transport{Message: "", Status: http.StatusNoContent}}, nil, manager)
+	err := tokenList{}.Run(&context, client)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(stdout.String(), gocheck.Equals, "You don't have any API tokens.\n")
+}
+
+func (s *S) TestTokenRevoke(c *gocheck.C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Args:   []string{"ci"},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	trans := testing.ConditionalTransport{
+		Transport: testing.Transport{Message: "", Status: http.StatusOK},
+		CondFunc: func(req *http.Request) bool {
+			return req.Method == "DELETE" && req.URL.Path == "/users/tokens/ci"
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: &trans}, nil, manager)
+	err := tokenRevoke{}.Run(&context, client)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(stdout.String(), gocheck.Equals, "Token \"ci\" successfully revoked!\n")
+}
@@ -9,23 +9,104 @@ import (
 	"github.com/globocom/config"
 	"github.com/globocom/tsuru/app"
 	"github.com/globocom/tsuru/log"
+	"github.com/globocom/tsuru/metrics"
 	"github.com/globocom/tsuru/provision"
+	"github.com/globocom/tsuru/shutdown"
 	stdlog "log"
+	"net/http"
+	"os"
 	"time"
 )
 
+var (
+	cycleDuration = metrics.NewHistogram(
+		"tsuru_collector_cycle_duration_seconds",
+		"Duration of the cycles of the collector.",
+		[]float64{.1, .5, 1, 5, 10, 30, 60},
+	)
+	unitsGauge = metrics.NewGauge(
+		"tsuru_units",
+		"Number of units, by status, in the last cycle of the collector.",
+		"status",
+	)
+)
+
 func collect(ticker <-chan time.Time) {
 	for _ = range ticker {
+		start := time.Now()
+		checkNodes()
 		log.Print("Collecting status from provisioner")
 		units, err := app.Provisioner.CollectStatus()
-		if err != nil {
+		if provision.CountError("collect-status", err) != nil {
 			log.Printf("Failed to collect status within the provisioner: %s.", err)
 			continue
 		}
 		update(units)
+		countUnits(units)
+		cycleDuration.Observe(time.Since(start).Seconds())
+	}
+}
+
+// checkNodes checks the health of the nodes of the provisioner, if it manages
+// nodes.
+func checkNodes() {
+	if m, ok := app.Provisioner.(provision.NodeManager); ok {
+		log.Print("Checking the health of the nodes")
+		if err := provision.CountError("check-nodes", m.CheckNodes()); err != nil {
+			log.Errorf("Failed to check the health of the nodes: %s.", err)
+		}
+	}
+}
+
+func countUnits(units []provision.Unit) {
+	unitsGauge.Reset()
+	for _, unit := range units {
+		unitsGauge.Add(1, string(unit.Status))
 	}
 }
 
+// serveMetrics serves the metrics of the collector in the address defined by
+// the setting collector:metrics-listen, if any.
+func serveMetrics() {
+	listen, err := config.GetString("collector:metrics-listen")
+	if err != nil {
+		return
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+	fmt.Printf("tsuru collector metrics listening at %s...\n", listen)
+	go func() {
+		if err := http.ListenAndServe(listen, mux); err != nil {
+			log.Errorf("Failed to serve the metrics of the collector: %s", err)
+		}
+	}()
+}
+
+// stopOnSignal forwards the ticks to the returned channel, until a signal is
+// received. Then the channel is closed, so the collector stops after the
+// current cycle.
+func stopOnSignal(ticks <-chan time.Time, signals <-chan os.Signal) <-chan time.Time {
+	ch := make(chan time.Time)
+	go func() {
+		defer close(ch)
+		for {
+			var sig os.Signal
+			select {
+			case t := <-ticks:
+				select {
+				case ch <- t:
+					continue
+				case sig = <-signals:
+				}
+			case sig = <-signals:
+			}
+			fmt.Printf("Received %s, shutting down the tsuru collector...\n", sig)
+			return
+		}
+	}()
+	return ch
+}
+
 func fatal(err error) {
 	stdlog.Fatal(err)
 }
@@ -58,8 +139,14 @@ func Run(dryMode bool) {
 		}
 		fmt.Printf("Using %q provisioner.\n\n", provisioner)
 
-		ticker := time.Tick(time.Minute)
+		serveMetrics()
+		ticker := time.NewTicker(time.Minute)
 		fmt.Println("tsuru collector agent started...")
-		collect(ticker)
+		collect(stopOnSignal(ticker.C, shutdown.Notify()))
+		ticker.Stop()
+		if err := shutdown.Drain(time.Now().Add(shutdown.Timeout())); err != nil {
+			log.Warnf("Shutting down before the queue handlers and pipelines finished: %s", err)
+		}
+		fmt.Println("tsuru collector agent stopped.")
 	}
 }
@@ -5,11 +5,18 @@
 package collector
 
 import (
+	"bytes"
+	"errors"
 	"github.com/globocom/tsuru/app"
 	"github.com/globocom/tsuru/db"
+	"github.com/globocom/tsuru/metrics"
 	"github.com/globocom/tsuru/provision"
 	"labix.org/v2/mgo/bson"
 	"launchpad.net/gocheck"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
 )
 
@@ -61,3 +68,101 @@ func (s *S) TestJujuCollect(c *gocheck.C) {
 	c.Assert(apps[0].Units[1].Ip, gocheck.Equals, "10.10.10.1")
 	c.Assert(apps[1].Units[1].Ip, gocheck.Equals, "10.10.10.2")
 }
+
+func sampleValue(c *gocheck.C, sample string) float64 {
+	var buf bytes.Buffer
+	err := metrics.Write(&buf)
+	c.Assert(err, gocheck.IsNil)
+	for _, line := range strings.Split(buf.String(), "\n") {
+		if strings.HasPrefix(line, sample+" ") {
+			value, err := strconv.ParseFloat(line[len(sample)+1:], 64)
+			c.Assert(err, gocheck.IsNil)
+			return value
+		}
+	}
+	return 0
+}
+
+func (s *S) TestCollectMetrics(c *gocheck.C) {
+	app1 := app.App{Name: "as_i_rise", Platform: "python"}
+	app2 := app.App{Name: "the_infanta", Platform: "python"}
+	s.provisioner.Provision(&app1)
+	defer s.provisioner.Destroy(&app1)
+	s.provisioner.Provision(&app2)
+	defer s.provisioner.Destroy(&app2)
+	createApps(s.conn)
+	defer destroyApps(s.conn)
+	cycles := sampleValue(c, "tsuru_collector_cycle_duration_seconds_count")
+	unitsGauge.Set(3, "error")
+	ch := make(chan time.Time)
+	done := make(chan bool)
+	go func() {
+		collect(ch)
+		done <- true
+	}()
+	ch <- time.Now()
+	close(ch)
+	<-done
+	c.Assert(sampleValue(c, "tsuru_collector_cycle_duration_seconds_count"), gocheck.Equals, cycles+1)
+	c.Assert(sampleValue(c, `tsuru_units{status="started"}`), gocheck.Equals, 2.0)
+	var buf bytes.Buffer
+	metrics.Write(&buf)
+	c.Assert(strings.Contains(buf.String(), `tsuru_units{status="error"}`), gocheck.Equals, false)
+}
+
+func (s *S) TestCollectCountsProvisionerErrors(c *gocheck.C) {
+	sample := `tsuru_provisioner_errors_total{operation="collect-status"}`
+	before := sampleValue(c, sample)
+	s.provisioner.PrepareFailure("CollectStatus", errors.New("juju failed"))
+	ch := make(chan time.Time)
+	done := make(chan bool)
+	go func() {
+		collect(ch)
+		done <- true
+	}()
+	ch <- time.Now()
+	close(ch)
+	<-done
+	c.Assert(sampleValue(c, sample), gocheck.Equals, before+1)
+}
+
+func (s *S) TestCollectChecksNodes(c *gocheck.C) {
+	s.provisioner.AddNode(provision.Node{ID: "server0", Address: "http://localhost:4243"})
+	defer s.provisioner.RemoveNode("server0")
+	checks := s.provisioner.NodeChecks()
+	ch := make(chan time.Time)
+	done := make(chan bool)
+	go func() {
+		collect(ch)
+		done <- true
+	}()
+	ch <- time.Now()
+	close(ch)
+	<-done
+	c.Assert(s.provisioner.NodeChecks(), gocheck.Equals, checks+1)
+	nodes, err := s.provisioner.ListNodes()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(nodes[0].Status, gocheck.Equals, provision.NodeHealthy)
+}
+
+func (s *S) TestStopOnSignal(c *gocheck.C) {
+	ticks := make(chan time.Time)
+	signals := make(chan os.Signal, 1)
+	ch := stopOnSignal(ticks, signals)
+	now := time.Now()
+	ticks <- now
+	c.Assert(<-ch, gocheck.Equals, now)
+	signals <- syscall.SIGTERM
+	_, ok := <-ch
+	c.Assert(ok, gocheck.Equals, false)
+}
+
+func (s *S) TestStopOnSignalWhileCollecting(c *gocheck.C) {
+	ticks := make(chan time.Time, 1)
+	signals := make(chan os.Signal, 1)
+	ch := stopOnSignal(ticks, signals)
+	ticks <- time.Now()
+	signals <- syscall.SIGINT
+	for _ = range ch {
+	}
+}
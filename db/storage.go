@@ -14,6 +14,7 @@ import (
 	"fmt"
 	"github.com/globocom/config"
 	"labix.org/v2/mgo"
+	"strings"
 	"sync"
 	"time"
 )
@@ -23,6 +24,9 @@ var (
 	mut         sync.RWMutex                // for pool thread safety
 	ticker      *time.Ticker                // for garbage collection
 	maxIdleTime = 5 * time.Minute           // max idle time for connections
+
+	logStreams   = make(map[string]bool) // databases where the log stream was created
+	logStreamMut sync.Mutex              // for logStreams thread safety
 )
 
 const period time.Duration = 7 * 24 * time.Hour
@@ -130,16 +134,61 @@ func (s *Storage) Platforms() *mgo.Collection {
 	return s.Collection("platforms")
 }
 
-// Logs returns the logs collection from MongoDB.
+// Logs returns the logs collection from MongoDB. Logs are indexed by app and
+// date, serving both the queries for the last logs of an app and the removal
+// of old logs.
 func (s *Storage) Logs() *mgo.Collection {
-	appNameIndex := mgo.Index{Key: []string{"appname"}}
+	appDateIndex := mgo.Index{Key: []string{"appname", "-date"}}
 	sourceIndex := mgo.Index{Key: []string{"source"}}
 	c := s.Collection("logs")
-	c.EnsureIndex(appNameIndex)
+	c.EnsureIndex(appDateIndex)
 	c.EnsureIndex(sourceIndex)
 	return c
 }
 
+// defaultLogStreamSize is the default size of the log stream collection, in
+// bytes.
+const defaultLogStreamSize = 10 << 20
+
+// LogStream returns the log_stream collection from MongoDB. It's a capped
+// collection that holds the most recent logs of all apps, and is tailed by
+// the API servers to stream logs to clients. Its size is defined by the
+// "app-log:stream-size" setting, in bytes.
+//
+// The collection is created on the first call for each database.
+func (s *Storage) LogStream() *mgo.Collection {
+	c := s.Collection("log_stream")
+	logStreamMut.Lock()
+	defer logStreamMut.Unlock()
+	if !logStreams[s.dbname] {
+		size, err := config.GetInt("app-log:stream-size")
+		if err != nil || size <= 0 {
+			size = defaultLogStreamSize
+		}
+		err = c.Create(&mgo.CollectionInfo{Capped: true, MaxBytes: size})
+		if err == nil || strings.Contains(err.Error(), "already exists") {
+			logStreams[s.dbname] = true
+		}
+	}
+	return c
+}
+
+// LogDrains returns the log_drains collection from MongoDB.
+func (s *Storage) LogDrains() *mgo.Collection {
+	drainIndex := mgo.Index{Key: []string{"appname", "url"}, Unique: true}
+	c := s.Collection("log_drains")
+	c.EnsureIndex(drainIndex)
+	return c
+}
+
+// Deploys returns the deploys collection from MongoDB.
+func (s *Storage) Deploys() *mgo.Collection {
+	appIndex := mgo.Index{Key: []string{"app"}}
+	c := s.Collection("deploys")
+	c.EnsureIndex(appIndex)
+	return c
+}
+
 // Services returns the services collection from MongoDB.
 func (s *Storage) Services() *mgo.Collection {
 	c := s.Collection("services")
@@ -171,6 +220,16 @@ func (s *Storage) UserActions() *mgo.Collection {
 	return s.Collection("user_actions")
 }
 
+// Events returns the events collection from MongoDB.
+func (s *Storage) Events() *mgo.Collection {
+	targetIndex := mgo.Index{Key: []string{"target.type", "target.name"}}
+	ownerIndex := mgo.Index{Key: []string{"owner"}}
+	c := s.Collection("events")
+	c.EnsureIndex(targetIndex)
+	c.EnsureIndex(ownerIndex)
+	return c
+}
+
 // Teams returns the teams collection from MongoDB.
 func (s *Storage) Teams() *mgo.Collection {
 	return s.Collection("teams")
@@ -184,6 +243,24 @@ func (s *Storage) Quota() *mgo.Collection {
 	return c
 }
 
+// DeadLetters returns the queue_dead_letters collection from MongoDB, that
+// holds the queue messages that exceeded their retries.
+func (s *Storage) DeadLetters() *mgo.Collection {
+	queueIndex := mgo.Index{Key: []string{"queue"}}
+	c := s.Collection("queue_dead_letters")
+	c.EnsureIndex(queueIndex)
+	return c
+}
+
+// Pipelines returns the pipelines collection from MongoDB, that holds the
+// progress of the persistent action pipelines being executed.
+func (s *Storage) Pipelines() *mgo.Collection {
+	leaseIndex := mgo.Index{Key: []string{"lease"}}
+	c := s.Collection("pipelines")
+	c.EnsureIndex(leaseIndex)
+	return c
+}
+
 func init() {
 	ticker = time.NewTicker(time.Hour)
 	go retire(ticker)
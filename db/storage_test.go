@@ -7,6 +7,7 @@ package db
 import (
 	"github.com/globocom/config"
 	"labix.org/v2/mgo"
+	"labix.org/v2/mgo/bson"
 	"launchpad.net/gocheck"
 	"reflect"
 	"sync"
@@ -231,6 +232,22 @@ func (s *S) TestUserActions(c *gocheck.C) {
 	c.Assert(actions, gocheck.DeepEquals, actionsc)
 }
 
+func (s *S) TestEvents(c *gocheck.C) {
+	storage, _ := Open("127.0.0.1:27017", "tsuru_storage_test")
+	defer storage.session.Close()
+	events := storage.Events()
+	eventsc := storage.Collection("events")
+	c.Assert(events, gocheck.DeepEquals, eventsc)
+}
+
+func (s *S) TestEventsIndexes(c *gocheck.C) {
+	storage, _ := Open("127.0.0.1:27017", "tsuru_storage_test")
+	defer storage.session.Close()
+	events := storage.Events()
+	c.Assert(events, HasIndex, []string{"target.type", "target.name"})
+	c.Assert(events, HasIndex, []string{"owner"})
+}
+
 func (s *S) TestApps(c *gocheck.C) {
 	storage, _ := Open("127.0.0.1:27017", "tsuru_storage_test")
 	defer storage.session.Close()
@@ -256,6 +273,77 @@ func (s *S) TestLogs(c *gocheck.C) {
 	c.Assert(logs, gocheck.DeepEquals, logsc)
 }
 
+func (s *S) TestLogStream(c *gocheck.C) {
+	storage, _ := Open("127.0.0.1:27017", "tsuru_storage_test")
+	defer storage.session.Close()
+	stream := storage.LogStream()
+	streamc := storage.Collection("log_stream")
+	c.Assert(stream, gocheck.DeepEquals, streamc)
+}
+
+func (s *S) TestLogStreamIsCapped(c *gocheck.C) {
+	storage, _ := Open("127.0.0.1:27017", "tsuru_storage_test")
+	defer storage.session.Close()
+	defer storage.LogStream().DropCollection()
+	var result struct {
+		Capped bool
+	}
+	err := storage.session.DB("tsuru_storage_test").Run(bson.M{"collstats": "log_stream"}, &result)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(result.Capped, gocheck.Equals, true)
+}
+
+func (s *S) TestLogStreamIsCreatedOnce(c *gocheck.C) {
+	storage, _ := Open("127.0.0.1:27017", "tsuru_storage_test")
+	defer storage.session.Close()
+	resetLogStream := func() {
+		logStreamMut.Lock()
+		delete(logStreams, "tsuru_storage_test")
+		logStreamMut.Unlock()
+	}
+	resetLogStream()
+	defer resetLogStream()
+	storage.LogStream()
+	err := storage.Collection("log_stream").DropCollection()
+	c.Assert(err, gocheck.IsNil)
+	storage.LogStream()
+	names, err := storage.session.DB("tsuru_storage_test").CollectionNames()
+	c.Assert(err, gocheck.IsNil)
+	for _, name := range names {
+		c.Assert(name, gocheck.Not(gocheck.Equals), "log_stream")
+	}
+}
+
+func (s *S) TestLogDrains(c *gocheck.C) {
+	storage, _ := Open("127.0.0.1:27017", "tsuru_storage_test")
+	defer storage.session.Close()
+	drains := storage.LogDrains()
+	drainsc := storage.Collection("log_drains")
+	c.Assert(drains, gocheck.DeepEquals, drainsc)
+}
+
+func (s *S) TestLogDrainsAppAndURLIndex(c *gocheck.C) {
+	storage, _ := Open("127.0.0.1:27017", "tsuru_storage_test")
+	defer storage.session.Close()
+	drains := storage.LogDrains()
+	c.Assert(drains, HasUniqueIndex, []string{"appname", "url"})
+}
+
+func (s *S) TestDeploys(c *gocheck.C) {
+	storage, _ := Open("127.0.0.1:27017", "tsuru_storage_test")
+	defer storage.session.Close()
+	deploys := storage.Deploys()
+	deploysc := storage.Collection("deploys")
+	c.Assert(deploys, gocheck.DeepEquals, deploysc)
+}
+
+func (s *S) TestDeploysAppIndex(c *gocheck.C) {
+	storage, _ := Open("127.0.0.1:27017", "tsuru_storage_test")
+	defer storage.session.Close()
+	deploys := storage.Deploys()
+	c.Assert(deploys, HasIndex, []string{"app"})
+}
+
 func (s *S) TestServices(c *gocheck.C) {
 	storage, _ := Open("127.0.0.1:27017", "tsuru_storage_test")
 	defer storage.session.Close()
@@ -295,11 +383,11 @@ func (s *S) TestQuotaOwnerIsUnique(c *gocheck.C) {
 	c.Assert(quota, HasUniqueIndex, []string{"owner"})
 }
 
-func (s *S) TestLogAppNameIndex(c *gocheck.C) {
+func (s *S) TestLogAppNameAndDateIndex(c *gocheck.C) {
 	storage, _ := Open("127.0.0.1", "tsuru_storage_test")
 	defer storage.session.Close()
 	logs := storage.Logs()
-	c.Assert(logs, HasIndex, []string{"appname"})
+	c.Assert(logs, HasIndex, []string{"appname", "-date"})
 }
 
 func (s *S) TestLogSourceIndex(c *gocheck.C) {
@@ -335,3 +423,33 @@ func (s *S) TestRetire(c *gocheck.C) {
 	c.Check(ok, gocheck.Equals, false)
 	sess.s.Ping()
 }
+
+func (s *S) TestDeadLetters(c *gocheck.C) {
+	storage, _ := Open("127.0.0.1:27017", "tsuru_storage_test")
+	defer storage.session.Close()
+	letters := storage.DeadLetters()
+	lettersc := storage.Collection("queue_dead_letters")
+	c.Assert(letters, gocheck.DeepEquals, lettersc)
+}
+
+func (s *S) TestDeadLettersQueueIndex(c *gocheck.C) {
+	storage, _ := Open("127.0.0.1:27017", "tsuru_storage_test")
+	defer storage.session.Close()
+	letters := storage.DeadLetters()
+	c.Assert(letters, HasIndex, []string{"queue"})
+}
+
+func (s *S) TestPipelines(c *gocheck.C) {
+	storage, _ := Open("127.0.0.1:27017", "tsuru_storage_test")
+	defer storage.session.Close()
+	pipelines := storage.Pipelines()
+	pipelinesc := storage.Collection("pipelines")
+	c.Assert(pipelines, gocheck.DeepEquals, pipelinesc)
+}
+
+func (s *S) TestPipelinesLeaseIndex(c *gocheck.C) {
+	storage, _ := Open("127.0.0.1:27017", "tsuru_storage_test")
+	defer storage.session.Close()
+	pipelines := storage.Pipelines()
+	c.Assert(pipelines, HasIndex, []string{"lease"})
+}
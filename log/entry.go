@@ -0,0 +1,151 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package log
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// TextFormat writes each entry as the message followed by its fields,
+	// in the form key=value.
+	TextFormat = "text"
+
+	// JSONFormat writes each entry as a JSON object, with the keys time,
+	// level and msg, and the fields of the entry.
+	JSONFormat = "json"
+)
+
+var (
+	ErrInvalidLevel  = errors.New("Invalid log level: it must be debug, info, warn or error.")
+	ErrInvalidFormat = errors.New("Invalid log format: it must be text or json.")
+)
+
+// Level is the severity of a log entry. The zero value is InfoLevel.
+type Level int
+
+const (
+	DebugLevel Level = iota - 1
+	InfoLevel
+	WarnLevel
+	ErrorLevel
+)
+
+var levelNames = map[Level]string{
+	DebugLevel: "debug",
+	InfoLevel:  "info",
+	WarnLevel:  "warn",
+	ErrorLevel: "error",
+}
+
+func (l Level) String() string {
+	if name, ok := levelNames[l]; ok {
+		return name
+	}
+	return fmt.Sprintf("level(%d)", int(l))
+}
+
+// ParseLevel returns the level with the given name: debug, info, warn or
+// error.
+func ParseLevel(name string) (Level, error) {
+	for level, n := range levelNames {
+		if n == strings.ToLower(name) {
+			return level, nil
+		}
+	}
+	return InfoLevel, ErrInvalidLevel
+}
+
+// Fields are the structured data of a log entry, like the app or the request
+// id.
+type Fields map[string]interface{}
+
+// Entry writes messages to a target, along with its fields.
+type Entry struct {
+	target *Target
+	fields Fields
+}
+
+// WithField returns a new entry with the given field added to the fields of
+// the entry.
+func (e *Entry) WithField(key string, value interface{}) *Entry {
+	fields := make(Fields, len(e.fields)+1)
+	for k, v := range e.fields {
+		fields[k] = v
+	}
+	fields[key] = value
+	return &Entry{target: e.target, fields: fields}
+}
+
+// Debugf writes the formatted message with the debug level.
+func (e *Entry) Debugf(format string, v ...interface{}) {
+	e.target.output(DebugLevel, e.fields, fmt.Sprintf(format, v...))
+}
+
+// Infof writes the formatted message with the info level.
+func (e *Entry) Infof(format string, v ...interface{}) {
+	e.target.output(InfoLevel, e.fields, fmt.Sprintf(format, v...))
+}
+
+// Warnf writes the formatted message with the warn level.
+func (e *Entry) Warnf(format string, v ...interface{}) {
+	e.target.output(WarnLevel, e.fields, fmt.Sprintf(format, v...))
+}
+
+// Errorf writes the formatted message with the error level.
+func (e *Entry) Errorf(format string, v ...interface{}) {
+	e.target.output(ErrorLevel, e.fields, fmt.Sprintf(format, v...))
+}
+
+// formatText formats the entry as text. The level is omitted for info
+// entries, so they look like the entries written by Print.
+func formatText(level Level, fields Fields, msg string) string {
+	var prefix string
+	if level != InfoLevel {
+		prefix = strings.ToUpper(level.String()) + ": "
+	}
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys)+1)
+	parts = append(parts, prefix+msg)
+	for _, k := range keys {
+		value := fmt.Sprint(fields[k])
+		if strings.ContainsAny(value, " \t\n\"=") {
+			value = fmt.Sprintf("%q", value)
+		}
+		parts = append(parts, k+"="+value)
+	}
+	return strings.Join(parts, " ")
+}
+
+func formatJSON(level Level, fields Fields, msg string) string {
+	data := make(map[string]interface{}, len(fields)+3)
+	for k, v := range fields {
+		if err, ok := v.(error); ok {
+			v = err.Error()
+		}
+		data[k] = v
+	}
+	data["time"] = time.Now().UTC().Format(time.RFC3339Nano)
+	data["level"] = level.String()
+	data["msg"] = msg
+	b, err := json.Marshal(data)
+	if err != nil {
+		b, _ = json.Marshal(map[string]string{
+			"time":  data["time"].(string),
+			"level": level.String(),
+			"msg":   fmt.Sprintf("%s (failed to encode the fields: %s)", msg, err),
+		})
+	}
+	return string(b)
+}
@@ -0,0 +1,152 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"launchpad.net/gocheck"
+	"log"
+)
+
+func (s *S) TestParseLevel(c *gocheck.C) {
+	var tests = []struct {
+		name  string
+		level Level
+	}{
+		{"debug", DebugLevel},
+		{"info", InfoLevel},
+		{"WARN", WarnLevel},
+		{"error", ErrorLevel},
+	}
+	for _, t := range tests {
+		level, err := ParseLevel(t.name)
+		c.Check(err, gocheck.IsNil)
+		c.Check(level, gocheck.Equals, t.level)
+	}
+	_, err := ParseLevel("verbose")
+	c.Assert(err, gocheck.Equals, ErrInvalidLevel)
+}
+
+func (s *S) TestLevelString(c *gocheck.C) {
+	c.Assert(DebugLevel.String(), gocheck.Equals, "debug")
+	c.Assert(ErrorLevel.String(), gocheck.Equals, "error")
+	c.Assert(Level(10).String(), gocheck.Equals, "level(10)")
+}
+
+func (s *S) TestTargetDefaultLevelIsInfo(c *gocheck.C) {
+	var buf bytes.Buffer
+	target := new(Target)
+	target.SetLogger(log.New(&buf, "", 0))
+	c.Assert(target.Level(), gocheck.Equals, InfoLevel)
+	target.Debugf("hidden")
+	target.Infof("shown %d", 1)
+	target.Warnf("shown %d", 2)
+	target.Errorf("shown %d", 3)
+	c.Assert(buf.String(), gocheck.Equals, "shown 1\nWARN: shown 2\nERROR: shown 3\n")
+}
+
+func (s *S) TestTargetSetLevel(c *gocheck.C) {
+	var buf bytes.Buffer
+	target := new(Target)
+	target.SetLogger(log.New(&buf, "", 0))
+	target.SetLevel(WarnLevel)
+	target.Infof("hidden")
+	target.Print("hidden")
+	target.Warnf("shown")
+	c.Assert(buf.String(), gocheck.Equals, "WARN: shown\n")
+	target.SetLevel(DebugLevel)
+	buf.Reset()
+	target.Debugf("debugging")
+	c.Assert(buf.String(), gocheck.Equals, "DEBUG: debugging\n")
+}
+
+func (s *S) TestTargetSetFormat(c *gocheck.C) {
+	target := new(Target)
+	c.Assert(target.SetFormat(JSONFormat), gocheck.IsNil)
+	c.Assert(target.SetFormat(TextFormat), gocheck.IsNil)
+	c.Assert(target.SetFormat("xml"), gocheck.Equals, ErrInvalidFormat)
+}
+
+func (s *S) TestEntryTextFormat(c *gocheck.C) {
+	var buf bytes.Buffer
+	target := new(Target)
+	target.SetLogger(log.New(&buf, "", 0))
+	entry := target.WithFields(Fields{"request-id": "abc123", "app": "myapp"})
+	entry.WithField("user", "me@tsuru.io").Errorf("Failed to %s", "restart")
+	entry.Infof("something with spaces")
+	expected := `ERROR: Failed to restart app=myapp request-id=abc123 user=me@tsuru.io
+something with spaces app=myapp request-id=abc123
+`
+	c.Assert(buf.String(), gocheck.Equals, expected)
+}
+
+func (s *S) TestEntryTextFormatQuotesValues(c *gocheck.C) {
+	var buf bytes.Buffer
+	target := new(Target)
+	target.SetLogger(log.New(&buf, "", 0))
+	target.WithFields(Fields{"error": "something went wrong"}).Warnf("oops")
+	c.Assert(buf.String(), gocheck.Equals, "WARN: oops error=\"something went wrong\"\n")
+}
+
+func (s *S) TestEntryWithFieldDoesNotChangeTheEntry(c *gocheck.C) {
+	entry := new(Target).WithFields(Fields{"app": "myapp"})
+	other := entry.WithField("user", "me@tsuru.io")
+	c.Assert(entry.fields, gocheck.DeepEquals, Fields{"app": "myapp"})
+	c.Assert(other.fields, gocheck.DeepEquals, Fields{"app": "myapp", "user": "me@tsuru.io"})
+}
+
+func (s *S) TestEntryJSONFormat(c *gocheck.C) {
+	var buf bytes.Buffer
+	target := new(Target)
+	target.SetLogger(log.New(&buf, "", 0))
+	target.SetFormat(JSONFormat)
+	target.WithFields(Fields{"app": "myapp", "error": errors.New("timeout")}).Errorf("Failed to restart")
+	var data map[string]interface{}
+	err := json.Unmarshal(buf.Bytes(), &data)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(data["level"], gocheck.Equals, "error")
+	c.Assert(data["msg"], gocheck.Equals, "Failed to restart")
+	c.Assert(data["app"], gocheck.Equals, "myapp")
+	c.Assert(data["error"], gocheck.Equals, "timeout")
+	c.Assert(data["time"], gocheck.NotNil)
+}
+
+func (s *S) TestPrintJSONFormat(c *gocheck.C) {
+	var buf bytes.Buffer
+	target := new(Target)
+	target.SetLogger(log.New(&buf, "", 0))
+	target.SetFormat(JSONFormat)
+	target.Printf("log anything %d", 1)
+	var data map[string]interface{}
+	err := json.Unmarshal(buf.Bytes(), &data)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(data["level"], gocheck.Equals, "info")
+	c.Assert(data["msg"], gocheck.Equals, "log anything 1")
+}
+
+func (s *S) TestLevelWrappers(c *gocheck.C) {
+	var buf bytes.Buffer
+	SetLogger(log.New(&buf, "", 0))
+	defer SetLevel(InfoLevel)
+	SetLevel(DebugLevel)
+	c.Assert(CurrentLevel(), gocheck.Equals, DebugLevel)
+	Debugf("a")
+	Infof("b")
+	Warnf("c")
+	Errorf("d")
+	WithFields(Fields{"app": "myapp"}).Infof("e")
+	c.Assert(buf.String(), gocheck.Equals, "DEBUG: a\nb\nWARN: c\nERROR: d\ne app=myapp\n")
+}
+
+func (s *S) TestLevelMethodsWithoutTarget(c *gocheck.C) {
+	SetLogger(nil)
+	defer func() {
+		c.Assert(recover(), gocheck.IsNil)
+	}()
+	Errorf("log anything")
+	WithFields(Fields{"app": "myapp"}).Errorf("log anything")
+}
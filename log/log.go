@@ -7,9 +7,15 @@
 // It abstracts the logger from the standard log package, allowing the
 // developer to patck the logging target, changing this to a file, or syslog,
 // for example.
+//
+// Entries have a level (debug, info, warn or error) and may carry
+// structured fields, like the app or the request id:
+//
+//	log.WithFields(log.Fields{"app": "myapp"}).Errorf("Failed to restart: %s", err)
 package log
 
 import (
+	"fmt"
 	"github.com/globocom/config"
 	"io"
 	"log"
@@ -18,36 +24,62 @@ import (
 	"sync"
 )
 
-func getSysLogger() *log.Logger {
-	logger, err := syslog.NewLogger(syslog.LOG_INFO, log.LstdFlags)
+func getSysLogger(flags int) *log.Logger {
+	logger, err := syslog.NewLogger(syslog.LOG_INFO, flags)
 	if err != nil {
 		log.Fatal(err)
 	}
 	return logger
 }
 
-func getFileLogger(fileName string) *log.Logger {
+func getFileLogger(fileName string, flags int) *log.Logger {
 	file, err := os.OpenFile(fileName, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
 	if err != nil {
 		log.Fatal(err)
 	}
-	return log.New(file, "", log.LstdFlags)
+	return log.New(file, "", flags)
 }
 
+// Init configures the default target using the settings log:file, log:level
+// and log:format. Without log:file, logs are written to syslog.
 func Init() {
+	format, err := config.GetString("log:format")
+	if err != nil {
+		format = TextFormat
+	}
+	if err := SetFormat(format); err != nil {
+		log.Fatal(err)
+	}
+	flags := log.LstdFlags
+	if format == JSONFormat {
+		// JSON entries include their own time.
+		flags = 0
+	}
+	level := InfoLevel
+	if name, err := config.GetString("log:level"); err == nil {
+		if level, err = ParseLevel(name); err != nil {
+			log.Fatal(err)
+		}
+	}
+	SetLevel(level)
 	logFileName, err := config.GetString("log:file")
 	var logger *log.Logger
 	if err != nil {
-		logger = getSysLogger()
+		logger = getSysLogger(flags)
 	} else {
-		logger = getFileLogger(logFileName)
+		logger = getFileLogger(logFileName, flags)
 	}
 	SetLogger(logger)
 }
 
 // Target is the current target for the log package.
+//
+// Entries below the level of the target are discarded. Entries are written in
+// the format of the target: TextFormat (the default) or JSONFormat.
 type Target struct {
 	logger *log.Logger
+	level  Level
+	format string
 	mut    sync.RWMutex
 }
 
@@ -60,58 +92,115 @@ func (t *Target) SetLogger(l *log.Logger) {
 	t.logger = l
 }
 
-// Fatal is equivalent to Print() followed by os.Exit(1).
-func (t *Target) Fatal(v ...interface{}) {
+// SetLevel defines the minimum level of the entries written by the target.
+func (t *Target) SetLevel(level Level) {
+	t.mut.Lock()
+	defer t.mut.Unlock()
+	t.level = level
+}
+
+// Level returns the minimum level of the entries written by the target.
+func (t *Target) Level() Level {
 	t.mut.RLock()
 	defer t.mut.RUnlock()
-	if t.logger != nil {
-		t.logger.Fatal(v...)
+	return t.level
+}
+
+// SetFormat defines the format of the entries written by the target, which
+// must be TextFormat or JSONFormat.
+func (t *Target) SetFormat(format string) error {
+	if format != TextFormat && format != JSONFormat {
+		return ErrInvalidFormat
 	}
+	t.mut.Lock()
+	defer t.mut.Unlock()
+	t.format = format
+	return nil
 }
 
-// Fatalf is equivalent to Printf followed by os.Exit(1).
-func (t *Target) Fatalf(format string, v ...interface{}) {
+// output writes the entry to the logger, unless its level is below the level
+// of the target. It returns false when the target has no logger.
+func (t *Target) output(level Level, fields Fields, msg string) bool {
 	t.mut.RLock()
 	defer t.mut.RUnlock()
-	if t.logger != nil {
-		t.logger.Fatalf(format, v...)
+	if t.logger == nil {
+		return false
+	}
+	if level >= t.level {
+		var line string
+		if t.format == JSONFormat {
+			line = formatJSON(level, fields, msg)
+		} else {
+			line = formatText(level, fields, msg)
+		}
+		t.logger.Output(3, line)
+	}
+	return true
+}
+
+// WithFields returns an entry that writes the given fields with each message.
+func (t *Target) WithFields(fields Fields) *Entry {
+	return &Entry{target: t, fields: fields}
+}
+
+// Debugf writes the formatted message with the debug level.
+func (t *Target) Debugf(format string, v ...interface{}) {
+	t.output(DebugLevel, nil, fmt.Sprintf(format, v...))
+}
+
+// Infof writes the formatted message with the info level.
+func (t *Target) Infof(format string, v ...interface{}) {
+	t.output(InfoLevel, nil, fmt.Sprintf(format, v...))
+}
+
+// Warnf writes the formatted message with the warn level.
+func (t *Target) Warnf(format string, v ...interface{}) {
+	t.output(WarnLevel, nil, fmt.Sprintf(format, v...))
+}
+
+// Errorf writes the formatted message with the error level.
+func (t *Target) Errorf(format string, v ...interface{}) {
+	t.output(ErrorLevel, nil, fmt.Sprintf(format, v...))
+}
+
+// Fatal is equivalent to Print() followed by os.Exit(1).
+func (t *Target) Fatal(v ...interface{}) {
+	if t.output(ErrorLevel, nil, fmt.Sprint(v...)) {
+		os.Exit(1)
+	}
+}
+
+// Fatalf is equivalent to Printf followed by os.Exit(1).
+func (t *Target) Fatalf(format string, v ...interface{}) {
+	if t.output(ErrorLevel, nil, fmt.Sprintf(format, v...)) {
+		os.Exit(1)
 	}
 }
 
 // Print is similar to fmt.Print, writing the given values to the Target
-// logger.
+// logger, with the info level.
 func (t *Target) Print(v ...interface{}) {
-	t.mut.RLock()
-	defer t.mut.RUnlock()
-	if t.logger != nil {
-		t.logger.Print(v...)
-	}
+	t.output(InfoLevel, nil, fmt.Sprint(v...))
 }
 
 // Printf is similar to fmt.Printf, writing the formatted string to the Target
-// logger.
+// logger, with the info level.
 func (t *Target) Printf(format string, v ...interface{}) {
-	t.mut.RLock()
-	defer t.mut.RUnlock()
-	if t.logger != nil {
-		t.logger.Printf(format, v...)
-	}
+	t.output(InfoLevel, nil, fmt.Sprintf(format, v...))
 }
 
 // Panic is equivalent to Print() followed by panic().
 func (t *Target) Panic(v ...interface{}) {
-	t.mut.RLock()
-	defer t.mut.RUnlock()
-	if t.logger != nil {
-		t.logger.Panic(v...)
+	s := fmt.Sprint(v...)
+	if t.output(ErrorLevel, nil, s) {
+		panic(s)
 	}
 }
 
 func (t *Target) Panicf(format string, v ...interface{}) {
-	t.mut.RLock()
-	defer t.mut.RUnlock()
-	if t.logger != nil {
-		t.logger.Panicf(format, v...)
+	s := fmt.Sprintf(format, v...)
+	if t.output(ErrorLevel, nil, s) {
+		panic(s)
 	}
 }
 
@@ -147,11 +236,51 @@ func Panicf(format string, v ...interface{}) {
 	DefaultTarget.Panicf(format, v...)
 }
 
+// Debugf is a wrapper for DefaultTarget.Debugf.
+func Debugf(format string, v ...interface{}) {
+	DefaultTarget.Debugf(format, v...)
+}
+
+// Infof is a wrapper for DefaultTarget.Infof.
+func Infof(format string, v ...interface{}) {
+	DefaultTarget.Infof(format, v...)
+}
+
+// Warnf is a wrapper for DefaultTarget.Warnf.
+func Warnf(format string, v ...interface{}) {
+	DefaultTarget.Warnf(format, v...)
+}
+
+// Errorf is a wrapper for DefaultTarget.Errorf.
+func Errorf(format string, v ...interface{}) {
+	DefaultTarget.Errorf(format, v...)
+}
+
+// WithFields is a wrapper for DefaultTarget.WithFields.
+func WithFields(fields Fields) *Entry {
+	return DefaultTarget.WithFields(fields)
+}
+
 // SetLogger is a wrapper for DefaultTarget.SetLogger.
 func SetLogger(logger *log.Logger) {
 	DefaultTarget.SetLogger(logger)
 }
 
+// SetLevel is a wrapper for DefaultTarget.SetLevel.
+func SetLevel(level Level) {
+	DefaultTarget.SetLevel(level)
+}
+
+// CurrentLevel is a wrapper for DefaultTarget.Level.
+func CurrentLevel() Level {
+	return DefaultTarget.Level()
+}
+
+// SetFormat is a wrapper for DefaultTarget.SetFormat.
+func SetFormat(format string) error {
+	return DefaultTarget.SetFormat(format)
+}
+
 func Write(w io.Writer, content []byte) error {
 	n, err := w.Write(content)
 	if err != nil {
@@ -0,0 +1,321 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package metrics provides counters, gauges and histograms, that tsuru
+// components expose in the Prometheus text format.
+//
+// Metrics are declared once, usually as package variables, and registered in
+// the package registry:
+//
+//	var deploys = metrics.NewCounter("tsuru_deploys_total", "Number of deploys.", "status")
+//
+//	deploys.Inc("success")
+//
+// Handler returns an http.Handler that writes all registered metrics.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefBuckets are the default buckets of histograms, in seconds, suited for
+// the duration of HTTP requests.
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+var reg = registry{families: make(map[string]*family)}
+
+type registry struct {
+	mut      sync.Mutex
+	families map[string]*family
+	hooks    []func()
+}
+
+func (r *registry) register(f *family) {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	if _, ok := r.families[f.name]; ok {
+		panic(fmt.Sprintf("metrics: %s is already registered", f.name))
+	}
+	r.families[f.name] = f
+}
+
+// OnCollect registers a function that is called before the metrics are
+// written, to update metrics that are read from somewhere else, like the
+// depth of a queue.
+func OnCollect(fn func()) {
+	reg.mut.Lock()
+	reg.hooks = append(reg.hooks, fn)
+	reg.mut.Unlock()
+}
+
+// series is a set of values of a metric with the same label values. Counters
+// and gauges use only value, histograms use the other fields.
+type series struct {
+	labels  []string
+	value   float64
+	buckets []uint64
+	sum     float64
+	count   uint64
+}
+
+type family struct {
+	name    string
+	help    string
+	kind    string
+	labels  []string
+	buckets []float64
+	mut     sync.Mutex
+	series  map[string]*series
+}
+
+func newFamily(name, help, kind string, labels []string) *family {
+	f := &family{
+		name:   name,
+		help:   help,
+		kind:   kind,
+		labels: labels,
+		series: make(map[string]*series),
+	}
+	reg.register(f)
+	return f
+}
+
+// get returns the series with the given label values, creating it if needed.
+// It must be called with the lock held.
+func (f *family) get(values []string) *series {
+	if len(values) != len(f.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", f.name, len(f.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+	s, ok := f.series[key]
+	if !ok {
+		s = &series{labels: append([]string(nil), values...)}
+		if f.buckets != nil {
+			s.buckets = make([]uint64, len(f.buckets))
+		}
+		f.series[key] = s
+	}
+	return s
+}
+
+func (f *family) reset() {
+	f.mut.Lock()
+	f.series = make(map[string]*series)
+	f.mut.Unlock()
+}
+
+// Counter is a metric whose value only goes up, like the number of requests.
+type Counter struct {
+	f *family
+}
+
+// NewCounter registers a new counter, with the given label names.
+func NewCounter(name, help string, labels ...string) *Counter {
+	return &Counter{f: newFamily(name, help, "counter", labels)}
+}
+
+// Inc increments the counter with the given label values by one.
+func (c *Counter) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+// Add increments the counter with the given label values. The delta must not
+// be negative.
+func (c *Counter) Add(delta float64, values ...string) {
+	if delta < 0 {
+		panic(fmt.Sprintf("metrics: counter %s can't decrease", c.f.name))
+	}
+	c.f.mut.Lock()
+	c.f.get(values).value += delta
+	c.f.mut.Unlock()
+}
+
+// Gauge is a metric whose value goes up and down, like the number of units.
+type Gauge struct {
+	f *family
+}
+
+// NewGauge registers a new gauge, with the given label names.
+func NewGauge(name, help string, labels ...string) *Gauge {
+	return &Gauge{f: newFamily(name, help, "gauge", labels)}
+}
+
+// Set sets the value of the gauge with the given label values.
+func (g *Gauge) Set(value float64, values ...string) {
+	g.f.mut.Lock()
+	g.f.get(values).value = value
+	g.f.mut.Unlock()
+}
+
+// Add adds the delta, that may be negative, to the gauge with the given label
+// values.
+func (g *Gauge) Add(delta float64, values ...string) {
+	g.f.mut.Lock()
+	g.f.get(values).value += delta
+	g.f.mut.Unlock()
+}
+
+// Reset removes all values of the gauge, so values of labels that are gone
+// are not exposed anymore.
+func (g *Gauge) Reset() {
+	g.f.reset()
+}
+
+// Histogram counts observations, like durations, in buckets.
+type Histogram struct {
+	f *family
+}
+
+// NewHistogram registers a new histogram with the given buckets, that must be
+// sorted, and label names. The +Inf bucket is implicit.
+func NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	f := &family{
+		name:    name,
+		help:    help,
+		kind:    "histogram",
+		labels:  labels,
+		buckets: buckets,
+		series:  make(map[string]*series),
+	}
+	reg.register(f)
+	return &Histogram{f: f}
+}
+
+// Observe adds an observation to the histogram with the given label values.
+func (h *Histogram) Observe(value float64, values ...string) {
+	h.f.mut.Lock()
+	defer h.f.mut.Unlock()
+	s := h.f.get(values)
+	for i, upper := range h.f.buckets {
+		if value <= upper {
+			s.buckets[i]++
+		}
+	}
+	s.sum += value
+	s.count++
+}
+
+// Write writes all registered metrics to w, in the Prometheus text format.
+func Write(w io.Writer) error {
+	reg.mut.Lock()
+	hooks := append([]func(){}, reg.hooks...)
+	families := make([]*family, 0, len(reg.families))
+	for _, f := range reg.families {
+		families = append(families, f)
+	}
+	reg.mut.Unlock()
+	for _, hook := range hooks {
+		hook()
+	}
+	sort.Sort(byName(families))
+	for _, f := range families {
+		if err := f.write(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *family) write(w io.Writer) error {
+	f.mut.Lock()
+	defer f.mut.Unlock()
+	if len(f.series) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(f.series))
+	for k := range f.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	_, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", f.name, escapeHelp(f.help), f.name, f.kind)
+	if err != nil {
+		return err
+	}
+	for _, k := range keys {
+		s := f.series[k]
+		if f.kind != "histogram" {
+			_, err = fmt.Fprintf(w, "%s%s %s\n", f.name, f.labelPairs(s, ""), formatFloat(s.value))
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		for i, upper := range f.buckets {
+			_, err = fmt.Fprintf(w, "%s_bucket%s %d\n", f.name, f.labelPairs(s, formatFloat(upper)), s.buckets[i])
+			if err != nil {
+				return err
+			}
+		}
+		_, err = fmt.Fprintf(w, "%s_bucket%s %d\n%s_sum%s %s\n%s_count%s %d\n",
+			f.name, f.labelPairs(s, "+Inf"), s.count,
+			f.name, f.labelPairs(s, ""), formatFloat(s.sum),
+			f.name, f.labelPairs(s, ""), s.count)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// labelPairs formats the labels of the series, adding the le label of
+// histogram buckets when it's not empty.
+func (f *family) labelPairs(s *series, le string) string {
+	pairs := make([]string, 0, len(f.labels)+1)
+	for i, name := range f.labels {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, name, escapeValue(s.labels[i])))
+	}
+	if le != "" {
+		pairs = append(pairs, fmt.Sprintf(`le="%s"`, le))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	valueEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string {
+	return helpEscaper.Replace(s)
+}
+
+func escapeValue(s string) string {
+	return valueEscaper.Replace(s)
+}
+
+type byName []*family
+
+func (l byName) Len() int           { return len(l) }
+func (l byName) Less(i, j int) bool { return l[i].name < l[j].name }
+func (l byName) Swap(i, j int)      { l[i], l[j] = l[j], l[i] }
+
+// Handler returns an http.Handler that writes all registered metrics.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		Write(w)
+	})
+}
@@ -0,0 +1,153 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package metrics
+
+import (
+	"bytes"
+	"launchpad.net/gocheck"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func Test(t *testing.T) { gocheck.TestingT(t) }
+
+type S struct{}
+
+var _ = gocheck.Suite(&S{})
+
+func (s *S) samples(c *gocheck.C) map[string]float64 {
+	var buf bytes.Buffer
+	err := Write(&buf)
+	c.Assert(err, gocheck.IsNil)
+	samples, err := parse(&buf)
+	c.Assert(err, gocheck.IsNil)
+	return samples
+}
+
+func (s *S) TestCounter(c *gocheck.C) {
+	counter := NewCounter("test_counter_total", "A counter.", "status", "method")
+	counter.Inc("200", "GET")
+	counter.Inc("200", "GET")
+	counter.Add(3, "500", "POST")
+	samples := s.samples(c)
+	c.Assert(samples[`test_counter_total{method="GET",status="200"}`], gocheck.Equals, 2.0)
+	c.Assert(samples[`test_counter_total{method="POST",status="500"}`], gocheck.Equals, 3.0)
+}
+
+func (s *S) TestCounterCannotDecrease(c *gocheck.C) {
+	counter := NewCounter("test_decreasing_total", "A counter.")
+	c.Assert(func() { counter.Add(-1) }, gocheck.PanicMatches, "metrics: counter test_decreasing_total can't decrease")
+}
+
+func (s *S) TestWrongNumberOfLabelValues(c *gocheck.C) {
+	counter := NewCounter("test_labels_total", "A counter.", "status")
+	c.Assert(func() { counter.Inc() }, gocheck.PanicMatches, "metrics: test_labels_total expects 1 label values, got 0")
+}
+
+func (s *S) TestRegisterTwice(c *gocheck.C) {
+	NewGauge("test_twice", "A gauge.")
+	c.Assert(func() { NewGauge("test_twice", "A gauge.") }, gocheck.PanicMatches, "metrics: test_twice is already registered")
+}
+
+func (s *S) TestGauge(c *gocheck.C) {
+	gauge := NewGauge("test_gauge", "A gauge.", "status")
+	gauge.Set(10, "started")
+	gauge.Add(-3, "started")
+	gauge.Add(2, "error")
+	samples := s.samples(c)
+	c.Assert(samples[`test_gauge{status="started"}`], gocheck.Equals, 7.0)
+	c.Assert(samples[`test_gauge{status="error"}`], gocheck.Equals, 2.0)
+	gauge.Reset()
+	gauge.Set(1, "started")
+	samples = s.samples(c)
+	c.Assert(samples[`test_gauge{status="started"}`], gocheck.Equals, 1.0)
+	_, ok := samples[`test_gauge{status="error"}`]
+	c.Assert(ok, gocheck.Equals, false)
+}
+
+func (s *S) TestHistogram(c *gocheck.C) {
+	histogram := NewHistogram("test_duration_seconds", "A histogram.", []float64{0.1, 1, 10}, "route")
+	histogram.Observe(0.0625, "/apps")
+	histogram.Observe(0.5, "/apps")
+	histogram.Observe(4, "/apps")
+	histogram.Observe(64, "/apps")
+	samples := s.samples(c)
+	c.Assert(samples[`test_duration_seconds_bucket{le="0.1",route="/apps"}`], gocheck.Equals, 1.0)
+	c.Assert(samples[`test_duration_seconds_bucket{le="1",route="/apps"}`], gocheck.Equals, 2.0)
+	c.Assert(samples[`test_duration_seconds_bucket{le="10",route="/apps"}`], gocheck.Equals, 3.0)
+	c.Assert(samples[`test_duration_seconds_bucket{le="+Inf",route="/apps"}`], gocheck.Equals, 4.0)
+	c.Assert(samples[`test_duration_seconds_sum{route="/apps"}`], gocheck.Equals, 68.5625)
+	c.Assert(samples[`test_duration_seconds_count{route="/apps"}`], gocheck.Equals, 4.0)
+}
+
+func (s *S) TestOnCollect(c *gocheck.C) {
+	gauge := NewGauge("test_collected", "A gauge.")
+	var calls int
+	OnCollect(func() {
+		calls++
+		gauge.Set(float64(calls))
+	})
+	c.Assert(s.samples(c)["test_collected"], gocheck.Equals, 1.0)
+	c.Assert(s.samples(c)["test_collected"], gocheck.Equals, 2.0)
+}
+
+func (s *S) TestWriteTextFormat(c *gocheck.C) {
+	counter := NewCounter("test_format_total", "Help with a \\ and\na new line.", "path")
+	counter.Inc(`/a "quoted" path`)
+	NewCounter("test_empty_total", "Not written, it has no values.")
+	var buf bytes.Buffer
+	err := Write(&buf)
+	c.Assert(err, gocheck.IsNil)
+	expected := `# HELP test_format_total Help with a \\ and\na new line.
+# TYPE test_format_total counter
+test_format_total{path="/a \"quoted\" path"} 1
+`
+	c.Assert(strings.Contains(buf.String(), expected), gocheck.Equals, true)
+	c.Assert(strings.Contains(buf.String(), "test_empty_total"), gocheck.Equals, false)
+}
+
+func (s *S) TestParse(c *gocheck.C) {
+	text := `# HELP some_metric Some help.
+# TYPE some_metric counter
+some_metric{b="2",a="x\"y"} 10 1395066363000
+
+other_metric 1.5e+06
+inf_metric{le="+Inf"} +Inf
+`
+	samples, err := parse(strings.NewReader(text))
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(samples, gocheck.HasLen, 3)
+	c.Assert(samples[`some_metric{a="x\"y",b="2"}`], gocheck.Equals, 10.0)
+	c.Assert(samples["other_metric"], gocheck.Equals, 1.5e6)
+	c.Assert(samples[`inf_metric{le="+Inf"}`] > 1e308, gocheck.Equals, true)
+}
+
+func (s *S) TestParseInvalid(c *gocheck.C) {
+	var tests = []string{
+		"some_metric",
+		"some_metric abc",
+		`some_metric{a="1} 1`,
+		"some_metric{a} 1",
+	}
+	for _, t := range tests {
+		_, err := parse(strings.NewReader(t))
+		c.Check(err, gocheck.NotNil, gocheck.Commentf("%q", t))
+	}
+}
+
+func (s *S) TestHandler(c *gocheck.C) {
+	NewCounter("test_handler_total", "A counter.").Inc()
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest("GET", "/metrics", nil)
+	c.Assert(err, gocheck.IsNil)
+	Handler().ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, gocheck.Equals, http.StatusOK)
+	c.Assert(recorder.Header().Get("Content-Type"), gocheck.Equals, "text/plain; version=0.0.4")
+	samples, err := parse(recorder.Body)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(samples["test_handler_total"], gocheck.Equals, 1.0)
+}
@@ -0,0 +1,100 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// parse reads samples in the Prometheus text format, returning their values
+// by sample. Samples are identified by the metric name followed by the
+// labels, sorted by name, like:
+//
+//	tsuru_http_requests_total{method="GET",route="/apps",status="200"}
+//
+// Comments and empty lines are ignored, and timestamps are discarded.
+func parse(r io.Reader) (map[string]float64, error) {
+	samples := make(map[string]float64)
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, rest, err := parseSampleName(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", n, err)
+		}
+		fields := strings.Fields(rest)
+		if len(fields) == 0 || len(fields) > 2 {
+			return nil, fmt.Errorf("line %d: invalid value %q", n, rest)
+		}
+		value, err := strconv.ParseFloat(fields[0], 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid value %q", n, fields[0])
+		}
+		samples[key] = value
+	}
+	return samples, scanner.Err()
+}
+
+// parseSampleName parses the name and labels of the sample in the line,
+// returning the key of the sample and the rest of the line.
+func parseSampleName(line string) (string, string, error) {
+	end := strings.IndexAny(line, "{ \t")
+	if end <= 0 {
+		return "", "", fmt.Errorf("invalid sample %q", line)
+	}
+	name := line[:end]
+	if line[end] != '{' {
+		return name, line[end:], nil
+	}
+	var labels []string
+	i := end + 1
+	for {
+		for i < len(line) && (line[i] == ' ' || line[i] == ',') {
+			i++
+		}
+		if i < len(line) && line[i] == '}' {
+			i++
+			break
+		}
+		eq := strings.Index(line[i:], `="`)
+		if eq <= 0 {
+			return "", "", fmt.Errorf("invalid labels in %q", line)
+		}
+		label := strings.TrimSpace(line[i : i+eq])
+		i += eq + 2
+		var value []byte
+		for ; i < len(line) && line[i] != '"'; i++ {
+			if line[i] == '\\' && i+1 < len(line) {
+				i++
+				switch line[i] {
+				case 'n':
+					value = append(value, '\n')
+				default:
+					value = append(value, line[i])
+				}
+				continue
+			}
+			value = append(value, line[i])
+		}
+		if i >= len(line) {
+			return "", "", fmt.Errorf("unterminated label value in %q", line)
+		}
+		i++
+		labels = append(labels, fmt.Sprintf(`%s="%s"`, label, escapeValue(string(value))))
+	}
+	if len(labels) == 0 {
+		return name, line[i:], nil
+	}
+	sort.Strings(labels)
+	return name + "{" + strings.Join(labels, ",") + "}", line[i:], nil
+}
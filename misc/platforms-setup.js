@@ -2,7 +2,9 @@
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE file.
 
-// This script register some platforms in the database.
+// This script register some platforms in the database. It only registers
+// the names of the platforms, prefer the platform-add command of tsuru-admin,
+// which also builds the base image of the platform.
 //
 // Usage, from the command line:
 //
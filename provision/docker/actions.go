@@ -81,15 +81,30 @@ var insertContainer = action.Action{
 	},
 }
 
-var addRoute = action.Action{
-	Name: "add-route",
+var checkHealth = action.Action{
+	Name: "check-health",
 	Forward: func(ctx action.FWContext) (action.Result, error) {
 		c := ctx.Previous.(container)
-		r, err := getRouter()
-		if err != nil {
+		hc := ctx.Params[3].(*provision.HealthCheck)
+		if hc == nil {
+			return c, nil
+		}
+		log.Printf("checking health of container %s", c.ID)
+		if err := hc.Wait(c.getAddress()); err != nil {
+			log.Printf("container %s failed the health check: %s", c.ID, err)
 			return nil, err
 		}
-		err = r.AddRoute(c.AppName, c.getAddress())
+		return c, nil
+	},
+	Backward: func(ctx action.BWContext) {
+	},
+}
+
+var addRoute = action.Action{
+	Name: "add-route",
+	Forward: func(ctx action.FWContext) (action.Result, error) {
+		c := ctx.Previous.(container)
+		err := c.addRoute()
 		return c, err
 	},
 	Backward: func(ctx action.BWContext) {
@@ -109,5 +124,7 @@ var startContainer = action.Action{
 		return c, nil
 	},
 	Backward: func(ctx action.BWContext) {
+		c := ctx.FWResult.(container)
+		c.stop()
 	},
 }
@@ -7,9 +7,14 @@ package docker
 import (
 	dockerClient "github.com/fsouza/go-dockerclient"
 	"github.com/globocom/tsuru/action"
+	"github.com/globocom/tsuru/provision"
 	rtesting "github.com/globocom/tsuru/router/testing"
 	"github.com/globocom/tsuru/testing"
 	"launchpad.net/gocheck"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 )
 
 func (s *S) TestCreateContainerName(c *gocheck.C) {
@@ -93,6 +98,50 @@ func (s *S) TestAddRouteForward(c *gocheck.C) {
 	c.Assert(cont, gocheck.FitsTypeOf, container{})
 }
 
+func (s *S) TestCheckHealthName(c *gocheck.C) {
+	c.Assert(checkHealth.Name, gocheck.Equals, "check-health")
+}
+
+func (s *S) TestCheckHealthForward(c *gocheck.C) {
+	var path string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	host, port, _ := net.SplitHostPort(strings.TrimPrefix(server.URL, "http://"))
+	cont := container{ID: "ble", HostAddr: host, HostPort: port}
+	hc := &provision.HealthCheck{Path: "/healthcheck", Timeout: 1}
+	context := action.FWContext{Previous: cont, Params: []interface{}{nil, "", nil, hc}}
+	r, err := checkHealth.Forward(context)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(r, gocheck.Equals, cont)
+	c.Assert(path, gocheck.Equals, "/healthcheck")
+}
+
+func (s *S) TestCheckHealthForwardWithoutHealthCheck(c *gocheck.C) {
+	cont := container{ID: "ble"}
+	var hc *provision.HealthCheck
+	context := action.FWContext{Previous: cont, Params: []interface{}{nil, "", nil, hc}}
+	r, err := checkHealth.Forward(context)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(r, gocheck.Equals, cont)
+}
+
+func (s *S) TestCheckHealthForwardFailure(c *gocheck.C) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+	host, port, _ := net.SplitHostPort(strings.TrimPrefix(server.URL, "http://"))
+	cont := container{ID: "ble", HostAddr: host, HostPort: port}
+	hc := &provision.HealthCheck{Path: "/healthcheck", Timeout: 1}
+	context := action.FWContext{Previous: cont, Params: []interface{}{nil, "", nil, hc}}
+	r, err := checkHealth.Forward(context)
+	c.Assert(err, gocheck.ErrorMatches, "unit at .* did not pass the health check .*")
+	c.Assert(r, gocheck.IsNil)
+}
+
 func (s *S) TestSetIpName(c *gocheck.C) {
 	c.Assert(setIp.Name, gocheck.Equals, "set-ip")
 }
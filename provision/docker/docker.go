@@ -17,12 +17,17 @@ import (
 	"github.com/globocom/tsuru/fs"
 	"github.com/globocom/tsuru/log"
 	"github.com/globocom/tsuru/provision"
+	"github.com/globocom/tsuru/repository"
 	"io"
 	"labix.org/v2/mgo/bson"
+	"launchpad.net/goyaml"
 	"net"
 	"net/url"
+	"path"
+	"regexp"
 	"strings"
 	"sync"
+	"time"
 )
 
 var (
@@ -41,24 +46,23 @@ func dockerCluster() *cluster.Cluster {
 	if dCluster == nil {
 		clusterNodes = make(map[string]string)
 		servers, _ := config.GetList("docker:servers")
-		if len(servers) < 1 {
-			log.Fatal(`Tsuru is misconfigured. Setting "docker:servers" is mandatory`)
-		}
 		nodes := []cluster.Node{}
-		for index, server := range servers {
-			id := fmt.Sprintf("server%d", index)
-			node := cluster.Node{
-				ID:      id,
-				Address: server,
-			}
-			nodes = append(nodes, node)
-			clusterNodes[id] = server
+		for i, server := range servers {
+			nodes = append(nodes, cluster.Node{ID: serverID(i), Address: server})
 		}
 		if segregate, _ := config.GetBool("docker:segregate"); segregate {
 			var scheduler segregatedScheduler
 			dCluster, _ = cluster.New(&scheduler, nodes...)
 		} else {
-			dCluster, _ = cluster.New(nil, nodes...)
+			if registered, err := registerServers(servers); err != nil {
+				log.Errorf("Failed to register the nodes of docker:servers: %s", err)
+			} else {
+				nodes = registered
+			}
+			dCluster, _ = cluster.New(nodeScheduler{}, nodes...)
+		}
+		for _, n := range nodes {
+			clusterNodes[n.ID] = n.Address
 		}
 		if redisServer, err := config.GetString("docker:scheduler:redis-server"); err == nil {
 			prefix, _ := config.GetString("docker:scheduler:redis-prefix")
@@ -95,34 +99,52 @@ func getPort() (string, error) {
 }
 
 func getHostAddr(hostID string) string {
-	fullAddress := clusterNodes[hostID]
-	url, _ := url.Parse(fullAddress)
+	fullAddress, ok := clusterNodes[hostID]
+	if !ok {
+		fullAddress = nodeAddress(hostID)
+	}
+	return hostAddr(fullAddress)
+}
+
+// hostAddr returns the host of the given node address.
+func hostAddr(address string) string {
+	url, _ := url.Parse(address)
 	host, _, _ := net.SplitHostPort(url.Host)
 	return host
 }
 
 type container struct {
-	ID       string `bson:"_id"`
-	AppName  string
-	Type     string
-	IP       string
-	Port     string
-	HostAddr string
-	HostPort string
-	Status   string
-	Version  string
-	Image    string
+	ID        string `bson:"_id"`
+	AppName   string
+	Type      string
+	IP        string
+	Port      string
+	HostAddr  string
+	HostPort  string
+	Status    string
+	Version   string
+	Image     string
+	Memory    int64
+	CpuShares int64
 }
 
 func (c *container) getAddress() string {
 	return fmt.Sprintf("http://%s:%s", c.HostAddr, c.HostPort)
 }
 
+// outdated returns true if the container was created with resource limits
+// different from the current limits of the app.
+func (c *container) outdated(app provision.App) bool {
+	return c.Memory != int64(app.GetMemory())*1024*1024 || c.CpuShares != int64(app.GetCpuShares())
+}
+
 // newContainer creates a new container in Docker and stores it in the database.
 func newContainer(app provision.App, imageId string, cmds []string) (container, error) {
 	cont := container{
-		AppName: app.GetName(),
-		Type:    app.GetPlatform(),
+		AppName:   app.GetName(),
+		Type:      app.GetPlatform(),
+		Memory:    int64(app.GetMemory()) * 1024 * 1024,
+		CpuShares: int64(app.GetCpuShares()),
 	}
 	port, err := getPort()
 	if err != nil {
@@ -136,6 +158,9 @@ func newContainer(app provision.App, imageId string, cmds []string) (container,
 		AttachStdin:  false,
 		AttachStdout: false,
 		AttachStderr: false,
+		Memory:       cont.Memory,
+		CpuShares:    cont.CpuShares,
+		Env:          []string{appNameEnv + "=" + cont.AppName},
 	}
 	hostID, c, err := dockerCluster().CreateContainer(&config)
 	if err != nil {
@@ -206,7 +231,7 @@ func deploy(app provision.App, version string, w io.Writer) (string, error) {
 	if err != nil {
 		return "", err
 	}
-	imageId := getImage(app)
+	imageId := deployImage(app)
 	actions := []*action.Action{&createContainer, &startContainer, &insertContainer}
 	pipeline := action.NewPipeline(actions...)
 	err = pipeline.Execute(app, imageId, commands)
@@ -230,23 +255,93 @@ func deploy(app provision.App, version string, w io.Writer) (string, error) {
 		log.Printf("error on get logs for container %s - %s", c.ID, err.Error())
 		return "", err
 	}
-	imageId, err = c.commit()
+	imageId, err = c.commit(version)
 	if err != nil {
 		log.Printf("error on commit container %s - %s", c.ID, err.Error())
 		return "", err
 	}
+	if err := registerImageBuild(imageId); err != nil {
+		log.Printf("error on register the build of image %s - %s", imageId, err.Error())
+	}
 	c.remove()
 	return imageId, nil
 }
 
-func start(app provision.App, imageId string, w io.Writer) (*container, error) {
+// imageHealthCheck returns the health check of the app defined in the
+// app.yaml file of the given image, so new containers are checked against the
+// configuration of the code they run, even in the first deploy.
+var imageHealthCheck = readImageHealthCheck
+
+// readImageHealthCheck runs a short-lived container, based on the given image,
+// that prints the app.yaml file of the app. It returns nil if the file does
+// not define a health check.
+func readImageHealthCheck(app provision.App, imageId string) (*provision.HealthCheck, error) {
+	repoPath, err := repository.GetPath()
+	if err != nil {
+		return nil, err
+	}
+	config := docker.Config{
+		Image: imageId,
+		Cmd:   []string{"/bin/bash", "-c", "cat " + path.Join(repoPath, "app.yaml") + " 2>/dev/null || true"},
+		Env:   []string{appNameEnv + "=" + app.GetName()},
+	}
+	_, c, err := dockerCluster().CreateContainer(&config)
+	if err != nil {
+		return nil, err
+	}
+	defer dockerCluster().RemoveContainer(c.ID)
+	if err := dockerCluster().StartContainer(c.ID); err != nil {
+		return nil, err
+	}
+	cont := container{ID: c.ID}
+	deadline := time.Now().Add(time.Minute)
+	for {
+		stopped, err := cont.stopped()
+		if err != nil {
+			return nil, err
+		}
+		if stopped {
+			break
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("timed out reading app.yaml from the image %s", imageId)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	var out bytes.Buffer
+	opts := dclient.AttachToContainerOptions{Container: c.ID, Logs: true, Stdout: true, OutputStream: &out}
+	if err := dockerCluster().AttachToContainer(opts); err != nil {
+		return nil, err
+	}
+	return parseHealthCheck(out.Bytes())
+}
+
+// parseHealthCheck parses the healthcheck section of an app.yaml file.
+func parseHealthCheck(data []byte) (*provision.HealthCheck, error) {
+	var conf struct {
+		HealthCheck provision.HealthCheck `yaml:"healthcheck"`
+	}
+	if err := goyaml.Unmarshal(data, &conf); err != nil {
+		return nil, err
+	}
+	if conf.HealthCheck.Path == "" {
+		return nil, nil
+	}
+	return &conf.HealthCheck, nil
+}
+
+// start starts a new container for the app, based on the given image. The
+// container is added to the router only after passing the given health check,
+// that may be nil.
+func start(app provision.App, imageId string, hc *provision.HealthCheck, w io.Writer) (*container, error) {
 	commands, err := runCmds()
 	if err != nil {
 		return nil, err
 	}
-	actions := []*action.Action{&createContainer, &startContainer, &setIp, &setHostPort, &insertContainer, &addRoute}
+	actions := []*action.Action{&createContainer, &startContainer, &setIp, &setHostPort, &insertContainer, &checkHealth, &addRoute}
 	pipeline := action.NewPipeline(actions...)
-	err = pipeline.Execute(app, imageId, commands)
+	pipeline.Observe(action.NewWriterObserver(w))
+	err = pipeline.Execute(app, imageId, commands, hc)
 	if err != nil {
 		return nil, err
 	}
@@ -262,9 +357,11 @@ func start(app provision.App, imageId string, w io.Writer) (*container, error) {
 	return &c, nil
 }
 
-// remove removes a docker container.
+// remove removes a docker container, along with its route and its record in
+// the database. The route is removed first, so the router stops sending
+// requests to the container before it goes away.
 func (c *container) remove() error {
-	address := c.getAddress()
+	c.removeRoute()
 	log.Printf("Removing container %s from docker", c.ID)
 	err := dockerCluster().RemoveContainer(c.ID)
 	if err != nil {
@@ -277,12 +374,28 @@ func (c *container) remove() error {
 	if err := coll.RemoveId(c.ID); err != nil {
 		log.Printf("Failed to remove container from database: %s", err)
 	}
+	return nil
+}
+
+// addRoute adds the container to the router.
+func (c *container) addRoute() error {
+	r, err := getRouter()
+	if err != nil {
+		return err
+	}
+	return r.AddRoute(c.AppName, c.getAddress())
+}
+
+// removeRoute removes the container from the router.
+func (c *container) removeRoute() error {
 	r, err := getRouter()
 	if err != nil {
 		log.Printf("Failed to obtain router: %s", err)
+		return err
 	}
-	if err := r.RemoveRoute(c.AppName, address); err != nil {
+	if err := r.RemoveRoute(c.AppName, c.getAddress()); err != nil {
 		log.Printf("Failed to remove route: %s", err)
+		return err
 	}
 	return nil
 }
@@ -302,12 +415,13 @@ func (c *container) ssh(stdout, stderr io.Writer, cmd string, args ...string) er
 	return executor().Execute("ssh", sshArgs, nil, stdout, stderr)
 }
 
-// commit commits an image in docker based in the container
-// and returns the image repository.
-func (c *container) commit() (string, error) {
+// commit commits an image in docker based in the container, tagging it with
+// the given version, and returns the image name (repository and tag).
+func (c *container) commit(version string) (string, error) {
 	log.Printf("commiting container %s", c.ID)
 	repository := assembleImageName(c.AppName)
-	opts := dclient.CommitContainerOptions{Container: c.ID, Repository: repository}
+	tag := imageTag(version)
+	opts := dclient.CommitContainerOptions{Container: c.ID, Repository: repository, Tag: tag}
 	image, err := dockerCluster().CommitContainer(opts)
 	if err != nil {
 		log.Printf("Could not commit docker image: %s", err.Error())
@@ -315,7 +429,7 @@ func (c *container) commit() (string, error) {
 	}
 	log.Printf("image %s generated from container %s", image.ID, c.ID)
 	replicateImage(repository)
-	return repository, nil
+	return repository + ":" + tag, nil
 }
 
 // stopped returns true if the container is stopped.
@@ -385,6 +499,18 @@ func getImage(app provision.App) string {
 	return assembleImageName(app.GetPlatform())
 }
 
+// deployImage returns the image in which a new deploy of the app is built: the
+// image of its last deploy, unless the base image of its platform was built
+// after it, so updates to the platform reach the app in its next deploy.
+func deployImage(app provision.App) string {
+	imageId := getImage(app)
+	platformImage := assembleImageName(app.GetPlatform())
+	if imageId != platformImage && imageBuildDate(platformImage).After(imageBuildDate(imageId)) {
+		return platformImage
+	}
+	return imageId
+}
+
 // removeImage removes an image from docker registry
 func removeImage(imageId string) error {
 	return dockerCluster().RemoveImage(imageId)
@@ -438,6 +564,20 @@ func replicateImage(name string) error {
 	return nil
 }
 
+var invalidTagChars = regexp.MustCompile(`[^\w.-]`)
+
+// imageTag returns a valid docker tag for the given version of an app.
+func imageTag(version string) string {
+	tag := invalidTagChars.ReplaceAllString(version, "-")
+	if len(tag) > 128 {
+		tag = tag[:128]
+	}
+	if tag == "" {
+		tag = "latest"
+	}
+	return tag
+}
+
 func assembleImageName(appName string) string {
 	parts := make([]string, 0, 3)
 	registry, _ := config.GetString("docker:registry")
@@ -14,6 +14,7 @@ import (
 	"github.com/globocom/docker-cluster/cluster"
 	etesting "github.com/globocom/tsuru/exec/testing"
 	ftesting "github.com/globocom/tsuru/fs/testing"
+	"github.com/globocom/tsuru/provision"
 	rtesting "github.com/globocom/tsuru/router/testing"
 	"github.com/globocom/tsuru/testing"
 	"labix.org/v2/mgo/bson"
@@ -25,6 +26,7 @@ import (
 	"os"
 	"strings"
 	"sync/atomic"
+	"time"
 )
 
 func (s *S) TestContainerGetAddress(c *gocheck.C) {
@@ -58,6 +60,40 @@ func (s *S) TestNewContainer(c *gocheck.C) {
 	c.Assert(cont.Port, gocheck.Equals, port)
 }
 
+func (s *S) TestNewContainerWithResourceLimits(c *gocheck.C) {
+	err := s.newImage()
+	c.Assert(err, gocheck.IsNil)
+	app := testing.NewFakeApp("app-name", "python", 1)
+	app.Memory = 256
+	app.CpuShares = 512
+	rtesting.FakeRouter.AddBackend(app.GetName())
+	defer rtesting.FakeRouter.RemoveBackend(app.GetName())
+	cont, err := newContainer(app, getImage(app), []string{"docker", "run"})
+	c.Assert(err, gocheck.IsNil)
+	defer cont.remove()
+	c.Assert(cont.Memory, gocheck.Equals, int64(256*1024*1024))
+	c.Assert(cont.CpuShares, gocheck.Equals, int64(512))
+	client, err := dockerClient.NewClient(s.server.URL())
+	c.Assert(err, gocheck.IsNil)
+	dockerContainer, err := client.InspectContainer(cont.ID)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(dockerContainer.Config.Memory, gocheck.Equals, int64(256*1024*1024))
+	c.Assert(dockerContainer.Config.CpuShares, gocheck.Equals, int64(512))
+	c.Assert(dockerContainer.Config.Env, gocheck.DeepEquals, []string{"TSURU_APP_NAME=app-name"})
+}
+
+func (s *S) TestContainerOutdated(c *gocheck.C) {
+	app := testing.NewFakeApp("app-name", "python", 1)
+	cont := container{AppName: app.GetName()}
+	c.Assert(cont.outdated(app), gocheck.Equals, false)
+	app.Memory = 256
+	c.Assert(cont.outdated(app), gocheck.Equals, true)
+	cont.Memory = 256 * 1024 * 1024
+	c.Assert(cont.outdated(app), gocheck.Equals, false)
+	app.CpuShares = 512
+	c.Assert(cont.outdated(app), gocheck.Equals, true)
+}
+
 func (s *S) TestGetSSHCommandsDefaultSSHDPath(c *gocheck.C) {
 	rfs := ftesting.RecordingFs{}
 	f, err := rfs.Create("/opt/me/id_dsa.pub")
@@ -449,6 +485,35 @@ func (s *S) TestGetImageWithRegistry(c *gocheck.C) {
 	c.Assert(img, gocheck.Equals, expected)
 }
 
+func (s *S) TestDeployImageUsesTheImageOfTheLastDeploy(c *gocheck.C) {
+	cont := container{ID: "bleble", Type: "python", AppName: "myapp", Image: "tsuru/myapp:v1"}
+	err := collection().Insert(cont)
+	c.Assert(err, gocheck.IsNil)
+	defer collection().RemoveAll(bson.M{"_id": "bleble"})
+	coll := s.conn.Collection(imageBuildsCollection)
+	defer coll.RemoveAll(nil)
+	app := testing.NewFakeApp("myapp", "python", 1)
+	c.Assert(deployImage(app), gocheck.Equals, "tsuru/myapp:v1")
+	platformBuild := imageBuild{Image: assembleImageName("python"), Date: time.Date(2013, 12, 10, 15, 0, 0, 0, time.UTC)}
+	err = coll.Insert(platformBuild, imageBuild{Image: "tsuru/myapp:v1", Date: platformBuild.Date.Add(time.Hour)})
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(deployImage(app), gocheck.Equals, "tsuru/myapp:v1")
+}
+
+func (s *S) TestDeployImageUsesThePlatformImageWhenItIsNewer(c *gocheck.C) {
+	cont := container{ID: "bleble", Type: "python", AppName: "myapp", Image: "tsuru/myapp:v1"}
+	err := collection().Insert(cont)
+	c.Assert(err, gocheck.IsNil)
+	defer collection().RemoveAll(bson.M{"_id": "bleble"})
+	coll := s.conn.Collection(imageBuildsCollection)
+	defer coll.RemoveAll(nil)
+	appBuild := imageBuild{Image: "tsuru/myapp:v1", Date: time.Date(2013, 12, 10, 15, 0, 0, 0, time.UTC)}
+	err = coll.Insert(appBuild, imageBuild{Image: assembleImageName("python"), Date: appBuild.Date.Add(time.Hour)})
+	c.Assert(err, gocheck.IsNil)
+	app := testing.NewFakeApp("myapp", "python", 1)
+	c.Assert(deployImage(app), gocheck.Equals, assembleImageName("python"))
+}
+
 func (s *S) TestContainerCommit(c *gocheck.C) {
 	err := s.newImage()
 	c.Assert(err, gocheck.IsNil)
@@ -456,13 +521,21 @@ func (s *S) TestContainerCommit(c *gocheck.C) {
 	c.Assert(err, gocheck.IsNil)
 	defer cont.remove()
 	defer rtesting.FakeRouter.RemoveBackend(cont.AppName)
-	imageId, err := cont.commit()
+	imageId, err := cont.commit("a345f3e")
 	c.Assert(err, gocheck.IsNil)
 	repoNamespace, _ := config.GetString("docker:repository-namespace")
-	repository := repoNamespace + "/" + cont.AppName
+	repository := repoNamespace + "/" + cont.AppName + ":a345f3e"
 	c.Assert(imageId, gocheck.Equals, repository)
 }
 
+func (s *S) TestImageTag(c *gocheck.C) {
+	c.Assert(imageTag("a345f3e"), gocheck.Equals, "a345f3e")
+	c.Assert(imageTag("origin/master"), gocheck.Equals, "origin-master")
+	c.Assert(imageTag("v1.0_rc"), gocheck.Equals, "v1.0_rc")
+	c.Assert(imageTag(""), gocheck.Equals, "latest")
+	c.Assert(imageTag(strings.Repeat("a", 200)), gocheck.HasLen, 128)
+}
+
 func (s *S) TestRemoveImage(c *gocheck.C) {
 	err := s.newImage()
 	c.Assert(err, gocheck.IsNil)
@@ -486,6 +559,19 @@ func (s *S) TestContainerDeploy(c *gocheck.C) {
 	c.Assert(err, gocheck.IsNil)
 }
 
+func (s *S) TestParseHealthCheck(c *gocheck.C) {
+	data := []byte("hooks:\n  pre-restart:\n    - testdata/pre.sh\nhealthcheck:\n  path: /health\n  status: 204\n  timeout: 30\n")
+	hc, err := parseHealthCheck(data)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(hc, gocheck.DeepEquals, &provision.HealthCheck{Path: "/health", Status: 204, Timeout: 30})
+	hc, err = parseHealthCheck([]byte("hooks:\n  pre-restart:\n    - testdata/pre.sh\n"))
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(hc, gocheck.IsNil)
+	hc, err = parseHealthCheck(nil)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(hc, gocheck.IsNil)
+}
+
 func (s *S) TestStart(c *gocheck.C) {
 	err := s.newImage()
 	c.Assert(err, gocheck.IsNil)
@@ -494,7 +580,7 @@ func (s *S) TestStart(c *gocheck.C) {
 	rtesting.FakeRouter.AddBackend(app.GetName())
 	defer rtesting.FakeRouter.RemoveBackend(app.GetName())
 	var buf bytes.Buffer
-	cont, err := start(app, imageId, &buf)
+	cont, err := start(app, imageId, nil, &buf)
 	c.Assert(err, gocheck.IsNil)
 	defer cont.remove()
 	c.Assert(cont.ID, gocheck.Not(gocheck.Equals), "")
@@ -502,6 +588,8 @@ func (s *S) TestStart(c *gocheck.C) {
 	c.Assert(err, gocheck.IsNil)
 	c.Assert(cont2.Image, gocheck.Equals, imageId)
 	c.Assert(cont2.Status, gocheck.Equals, "running")
+	c.Assert(strings.Contains(buf.String(), " ---> create-container done in "), gocheck.Equals, true)
+	c.Assert(strings.Contains(buf.String(), " ---> add-route done in "), gocheck.Equals, true)
 }
 
 func (s *S) TestContainerRunCmdError(c *gocheck.C) {
@@ -565,10 +653,11 @@ func (s *S) TestContainerLogs(c *gocheck.C) {
 
 func (s *S) TestDockerCluster(c *gocheck.C) {
 	config.Set("docker:servers", []string{"http://localhost:4243", "http://10.10.10.10:4243"})
-	expected, _ := cluster.New(nil,
-		cluster.Node{ID: "server0", Address: "http://localhost:4243"},
-		cluster.Node{ID: "server1", Address: "http://10.10.10.10:4243"},
+	expected, _ := cluster.New(nodeScheduler{},
+		cluster.Node{ID: "localhost-4243", Address: "http://localhost:4243"},
+		cluster.Node{ID: "10.10.10.10-4243", Address: "http://10.10.10.10:4243"},
 	)
+	defer s.conn.Collection(schedulerCollection).RemoveAll(nil)
 	oldDockerCluster := dCluster
 	cmutext.Lock()
 	dCluster = nil
@@ -580,6 +669,8 @@ func (s *S) TestDockerCluster(c *gocheck.C) {
 	}()
 	cluster := dockerCluster()
 	c.Assert(cluster, gocheck.DeepEquals, expected)
+	c.Assert(nodeAddress("localhost-4243"), gocheck.Equals, "http://localhost:4243")
+	c.Assert(nodeAddress("10.10.10.10-4243"), gocheck.Equals, "http://10.10.10.10:4243")
 }
 
 func (s *S) TestReplicateImage(c *gocheck.C) {
@@ -8,6 +8,7 @@ import (
 	"bufio"
 	"bytes"
 	"io"
+	"sync"
 )
 
 type filter struct {
@@ -34,3 +35,15 @@ func (f *filter) Write(p []byte) (int, error) {
 	}
 	return len(p), nil
 }
+
+// syncWriter serializes the writes to the underlying writer.
+type syncWriter struct {
+	w  io.Writer
+	mu sync.Mutex
+}
+
+func (w *syncWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.w.Write(p)
+}
@@ -7,6 +7,7 @@ package docker
 import (
 	"bytes"
 	"launchpad.net/gocheck"
+	"strings"
 )
 
 func (s *S) TestFilter(c *gocheck.C) {
@@ -22,3 +23,19 @@ func (s *S) TestFilter(c *gocheck.C) {
 	w.Write([]byte("my name is Gopher\n"))
 	c.Assert(buf.String(), gocheck.Equals, "hello there\nwhat's your name?")
 }
+
+func (s *S) TestSyncWriter(c *gocheck.C) {
+	var buf bytes.Buffer
+	w := syncWriter{w: &buf}
+	done := make(chan bool)
+	for i := 0; i < 10; i++ {
+		go func() {
+			w.Write([]byte("line\n"))
+			done <- true
+		}()
+	}
+	for i := 0; i < 10; i++ {
+		<-done
+	}
+	c.Assert(buf.String(), gocheck.Equals, strings.Repeat("line\n", 10))
+}
@@ -0,0 +1,250 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"fmt"
+	"github.com/globocom/docker-cluster/cluster"
+	"github.com/globocom/tsuru/db"
+	"github.com/globocom/tsuru/log"
+	"github.com/globocom/tsuru/provision"
+	"labix.org/v2/mgo"
+	"labix.org/v2/mgo/bson"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// nodeCheckTimeout is the maximum duration of the health check of a node.
+const nodeCheckTimeout = 10 * time.Second
+
+var nodeCheckClient = &http.Client{
+	Transport: &http.Transport{
+		Dial: func(network, addr string) (net.Conn, error) {
+			return net.DialTimeout(network, addr, nodeCheckTimeout)
+		},
+		ResponseHeaderTimeout: nodeCheckTimeout,
+	},
+}
+
+// removedServersCollection holds the addresses of the nodes removed by admins,
+// so the nodes listed in docker:servers are not registered again.
+const removedServersCollection = "docker_removed_servers"
+
+var invalidNodeIDChars = regexp.MustCompile(`[^\w.-]`)
+
+// serverID returns the id of the node listed at the given position of
+// docker:servers. It's the id used before nodes were registered, so the
+// containers already stored in the cluster keep pointing to their nodes.
+func serverID(index int) string {
+	return fmt.Sprintf("server%d", index)
+}
+
+// addressID returns an id derived from the address of a node, used when the
+// id of its position in docker:servers belongs to another node.
+func addressID(address string) string {
+	if u, err := url.Parse(address); err == nil && u.Host != "" {
+		address = u.Host
+	}
+	return invalidNodeIDChars.ReplaceAllString(address, "-")
+}
+
+// registerServers registers the nodes listed in the setting docker:servers,
+// and returns them. Nodes are matched by address: the ones already registered
+// keep their id, metadata and status, and the ones removed by an admin are not
+// registered again.
+func registerServers(servers []string) ([]cluster.Node, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	coll := conn.Collection(schedulerCollection)
+	var nodes []cluster.Node
+	for i, server := range servers {
+		var n node
+		err := coll.Find(bson.M{"address": server}).One(&n)
+		if err == nil {
+			nodes = append(nodes, cluster.Node{ID: n.ID, Address: server})
+			continue
+		}
+		if err != mgo.ErrNotFound {
+			return nil, err
+		}
+		removed, err := conn.Collection(removedServersCollection).FindId(server).Count()
+		if err != nil {
+			return nil, err
+		}
+		if removed > 0 {
+			continue
+		}
+		id := serverID(i)
+		err = coll.Insert(node{ID: id, Address: server})
+		if mgo.IsDup(err) {
+			id = addressID(server)
+			err = coll.Insert(node{ID: id, Address: server})
+		}
+		if err != nil && !mgo.IsDup(err) {
+			return nil, err
+		}
+		nodes = append(nodes, cluster.Node{ID: id, Address: server})
+	}
+	return nodes, nil
+}
+
+// nodeAddress returns the address of the node registered with the given id,
+// or an empty string if the node is not registered.
+func nodeAddress(id string) string {
+	conn, err := db.Conn()
+	if err != nil {
+		return ""
+	}
+	defer conn.Close()
+	var n node
+	if err := conn.Collection(schedulerCollection).FindId(id).One(&n); err != nil {
+		return ""
+	}
+	return n.Address
+}
+
+func (n *node) provisionNode() provision.Node {
+	return provision.Node{
+		ID:        n.ID,
+		Address:   n.Address,
+		Pool:      n.Pool,
+		Labels:    n.Labels,
+		Status:    n.Status,
+		LastCheck: n.LastCheck,
+		Error:     n.Error,
+	}
+}
+
+// AddNode registers a new node. The node may receive containers right away,
+// until it fails a health check. The pool of the node, if any, must exist.
+func (p *dockerProvisioner) AddNode(n provision.Node) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if n.Pool != "" {
+		if exists, err := poolExists(conn, n.Pool); err != nil {
+			return err
+		} else if !exists {
+			return provision.ErrPoolNotFound
+		}
+	}
+	nd := node{ID: n.ID, Address: n.Address, Pool: n.Pool, Labels: n.Labels}
+	err = conn.Collection(schedulerCollection).Insert(nd)
+	if mgo.IsDup(err) {
+		return provision.ErrNodeAlreadyExists
+	}
+	if err != nil {
+		return err
+	}
+	_, err = conn.Collection(removedServersCollection).RemoveAll(bson.M{"_id": n.Address})
+	return err
+}
+
+// RemoveNode removes the node with the given id. Nodes that still run
+// containers can't be removed. A removed node that is listed in docker:servers
+// is not registered again, unless it's added with AddNode.
+func (p *dockerProvisioner) RemoveNode(id string) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	var n node
+	err = conn.Collection(schedulerCollection).FindId(id).One(&n)
+	if err == mgo.ErrNotFound {
+		return provision.ErrNodeNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if host := hostAddr(n.Address); host != "" {
+		count, err := collection().Find(bson.M{"hostaddr": host}).Count()
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			return provision.ErrNodeNotEmpty
+		}
+	}
+	if err := removeNodeFromScheduler(cluster.Node{ID: id}); err != nil {
+		return err
+	}
+	_, err = conn.Collection(removedServersCollection).UpsertId(n.Address, bson.M{"$set": bson.M{"removedat": time.Now().In(time.UTC)}})
+	return err
+}
+
+func (p *dockerProvisioner) ListNodes() ([]provision.Node, error) {
+	nodes, err := listNodesInTheScheduler()
+	if err != nil {
+		return nil, err
+	}
+	result := make([]provision.Node, len(nodes))
+	for i := range nodes {
+		result[i] = nodes[i].provisionNode()
+	}
+	return result, nil
+}
+
+// CheckNodes checks the health of all nodes concurrently, by requesting the
+// version of the docker API in each node.
+func (p *dockerProvisioner) CheckNodes() error {
+	nodes, err := listNodesInTheScheduler()
+	if err != nil {
+		return err
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	coll := conn.Collection(schedulerCollection)
+	var wg sync.WaitGroup
+	for i := range nodes {
+		wg.Add(1)
+		go func(n *node) {
+			defer wg.Done()
+			status := provision.NodeHealthy
+			var errMsg string
+			if err := checkNode(n.Address); err != nil {
+				status = provision.NodeUnhealthy
+				errMsg = err.Error()
+				if n.Status != provision.NodeUnhealthy {
+					log.Errorf("Docker node %s (%s) is unhealthy, no containers will be created in it: %s", n.ID, n.Address, err)
+				}
+			} else if n.Status == provision.NodeUnhealthy {
+				log.Printf("Docker node %s (%s) is healthy again.", n.ID, n.Address)
+			}
+			update := bson.M{"status": status, "lastcheck": time.Now().In(time.UTC), "error": errMsg}
+			if err := coll.UpdateId(n.ID, bson.M{"$set": update}); err != nil && err != mgo.ErrNotFound {
+				log.Errorf("Failed to store the status of the docker node %s: %s", n.ID, err)
+			}
+		}(&nodes[i])
+	}
+	wg.Wait()
+	return nil
+}
+
+// checkNode checks whether the docker API in the given address is responding.
+func checkNode(address string) error {
+	resp, err := nodeCheckClient.Get(strings.TrimRight(address, "/") + "/version")
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code from the docker API: %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,237 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"github.com/dotcloud/docker"
+	"github.com/globocom/docker-cluster/cluster"
+	"github.com/globocom/tsuru/app"
+	"github.com/globocom/tsuru/provision"
+	"labix.org/v2/mgo/bson"
+	"launchpad.net/gocheck"
+	"net/http"
+	"net/http/httptest"
+)
+
+func (s *S) TestRegisterServersKeepsTheStatus(c *gocheck.C) {
+	coll := s.conn.Collection(schedulerCollection)
+	defer coll.RemoveAll(nil)
+	err := coll.Insert(node{ID: "server0", Address: "http://10.10.10.2:4243", Pool: "pool1", Status: provision.NodeUnhealthy})
+	c.Assert(err, gocheck.IsNil)
+	nodes, err := registerServers([]string{"http://10.10.10.2:4243", "http://10.10.10.3:4243"})
+	c.Assert(err, gocheck.IsNil)
+	expected := []cluster.Node{
+		{ID: "server0", Address: "http://10.10.10.2:4243"},
+		{ID: "server1", Address: "http://10.10.10.3:4243"},
+	}
+	c.Assert(nodes, gocheck.DeepEquals, expected)
+	var stored []node
+	err = coll.Find(nil).Sort("address").All(&stored)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(stored, gocheck.HasLen, 2)
+	c.Assert(stored[0].ID, gocheck.Equals, "server0")
+	c.Assert(stored[0].Pool, gocheck.Equals, "pool1")
+	c.Assert(stored[0].Status, gocheck.Equals, provision.NodeUnhealthy)
+	c.Assert(stored[1].ID, gocheck.Equals, "server1")
+	c.Assert(stored[1].Address, gocheck.Equals, "http://10.10.10.3:4243")
+}
+
+func (s *S) TestRegisterServersDoesNotDependOnTheOrder(c *gocheck.C) {
+	coll := s.conn.Collection(schedulerCollection)
+	defer coll.RemoveAll(nil)
+	_, err := registerServers([]string{"http://10.10.10.2:4243", "http://10.10.10.3:4243"})
+	c.Assert(err, gocheck.IsNil)
+	_, err = registerServers([]string{"http://10.10.10.3:4243", "http://10.10.10.2:4243"})
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(nodeAddress("server0"), gocheck.Equals, "http://10.10.10.2:4243")
+	c.Assert(nodeAddress("server1"), gocheck.Equals, "http://10.10.10.3:4243")
+	n, err := coll.Find(nil).Count()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(n, gocheck.Equals, 2)
+}
+
+func (s *S) TestRegisterServersIgnoresRemovedNodes(c *gocheck.C) {
+	coll := s.conn.Collection(schedulerCollection)
+	defer coll.RemoveAll(nil)
+	defer s.conn.Collection(removedServersCollection).RemoveAll(nil)
+	_, err := registerServers([]string{"http://10.10.10.2:4243", "http://10.10.10.3:4243"})
+	c.Assert(err, gocheck.IsNil)
+	var p dockerProvisioner
+	err = p.RemoveNode("server0")
+	c.Assert(err, gocheck.IsNil)
+	nodes, err := registerServers([]string{"http://10.10.10.2:4243", "http://10.10.10.3:4243"})
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(nodes, gocheck.DeepEquals, []cluster.Node{{ID: "server1", Address: "http://10.10.10.3:4243"}})
+	c.Assert(nodeAddress("server0"), gocheck.Equals, "")
+	err = p.AddNode(provision.Node{ID: "again", Address: "http://10.10.10.2:4243"})
+	c.Assert(err, gocheck.IsNil)
+	nodes, err = registerServers([]string{"http://10.10.10.2:4243", "http://10.10.10.3:4243"})
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(nodes, gocheck.HasLen, 2)
+	c.Assert(nodes[0].ID, gocheck.Equals, "again")
+}
+
+func (s *S) TestRegisterServersUsesTheAddressWhenThePositionIDIsTaken(c *gocheck.C) {
+	coll := s.conn.Collection(schedulerCollection)
+	defer coll.RemoveAll(nil)
+	err := coll.Insert(node{ID: "server0", Address: "http://10.10.10.1:4243"})
+	c.Assert(err, gocheck.IsNil)
+	nodes, err := registerServers([]string{"http://10.10.10.2:4243"})
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(nodes, gocheck.DeepEquals, []cluster.Node{{ID: "10.10.10.2-4243", Address: "http://10.10.10.2:4243"}})
+	c.Assert(nodeAddress("server0"), gocheck.Equals, "http://10.10.10.1:4243")
+}
+
+func (s *S) TestServerID(c *gocheck.C) {
+	c.Assert(serverID(0), gocheck.Equals, "server0")
+	c.Assert(serverID(3), gocheck.Equals, "server3")
+}
+
+func (s *S) TestAddressID(c *gocheck.C) {
+	c.Assert(addressID("http://10.10.10.2:4243"), gocheck.Equals, "10.10.10.2-4243")
+	c.Assert(addressID("https://docker.example.com:4243/"), gocheck.Equals, "docker.example.com-4243")
+}
+
+func (s *S) TestGetHostAddrFromRegisteredNodes(c *gocheck.C) {
+	coll := s.conn.Collection(schedulerCollection)
+	defer coll.RemoveAll(nil)
+	err := coll.Insert(node{ID: "added", Address: "http://10.10.10.1:4243"})
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(getHostAddr("added"), gocheck.Equals, "10.10.10.1")
+	c.Assert(nodeAddress("unknown"), gocheck.Equals, "")
+}
+
+func (s *S) TestProvisionerAddNode(c *gocheck.C) {
+	defer s.conn.Collection(schedulerCollection).RemoveAll(nil)
+	var p dockerProvisioner
+	n := provision.Node{
+		ID:      "server0",
+		Address: "http://10.10.10.1:4243",
+		Pool:    "pool1",
+		Labels:  map[string]string{"zone": "a"},
+	}
+	err := p.AddNode(n)
+	c.Assert(err, gocheck.IsNil)
+	nodes, err := p.ListNodes()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(nodes, gocheck.DeepEquals, []provision.Node{n})
+	err = p.AddNode(n)
+	c.Assert(err, gocheck.Equals, provision.ErrNodeAlreadyExists)
+}
+
+func (s *S) TestProvisionerRemoveNode(c *gocheck.C) {
+	defer s.conn.Collection(schedulerCollection).RemoveAll(nil)
+	var p dockerProvisioner
+	err := p.AddNode(provision.Node{ID: "server0", Address: "http://10.10.10.1:4243"})
+	c.Assert(err, gocheck.IsNil)
+	err = p.RemoveNode("server0")
+	c.Assert(err, gocheck.IsNil)
+	nodes, err := p.ListNodes()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(nodes, gocheck.HasLen, 0)
+	err = p.RemoveNode("server0")
+	c.Assert(err, gocheck.Equals, provision.ErrNodeNotFound)
+}
+
+func (s *S) TestProvisionerRemoveNodeWithContainers(c *gocheck.C) {
+	defer s.conn.Collection(schedulerCollection).RemoveAll(nil)
+	var p dockerProvisioner
+	err := p.AddNode(provision.Node{ID: "server0", Address: "http://10.10.10.1:4243"})
+	c.Assert(err, gocheck.IsNil)
+	coll := s.conn.Collection(s.collName)
+	err = coll.Insert(container{ID: "c-0", AppName: "myapp", HostAddr: "10.10.10.1"})
+	c.Assert(err, gocheck.IsNil)
+	defer coll.RemoveId("c-0")
+	err = p.RemoveNode("server0")
+	c.Assert(err, gocheck.Equals, provision.ErrNodeNotEmpty)
+	c.Assert(nodeAddress("server0"), gocheck.Equals, "http://10.10.10.1:4243")
+}
+
+func (s *S) TestProvisionerCheckNodes(c *gocheck.C) {
+	defer s.conn.Collection(schedulerCollection).RemoveAll(nil)
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/version" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer healthy.Close()
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer broken.Close()
+	down := httptest.NewServer(nil)
+	down.Close()
+	var p dockerProvisioner
+	p.AddNode(provision.Node{ID: "broken", Address: broken.URL})
+	p.AddNode(provision.Node{ID: "down", Address: down.URL})
+	p.AddNode(provision.Node{ID: "healthy", Address: healthy.URL})
+	err := p.CheckNodes()
+	c.Assert(err, gocheck.IsNil)
+	nodes, err := p.ListNodes()
+	c.Assert(err, gocheck.IsNil)
+	status := make(map[string]provision.NodeStatus)
+	for _, n := range nodes {
+		status[n.ID] = n.Status
+		c.Check(n.LastCheck.IsZero(), gocheck.Equals, false)
+		c.Check(n.Error == "", gocheck.Equals, n.Status == provision.NodeHealthy)
+	}
+	expected := map[string]provision.NodeStatus{
+		"broken":  provision.NodeUnhealthy,
+		"down":    provision.NodeUnhealthy,
+		"healthy": provision.NodeHealthy,
+	}
+	c.Assert(status, gocheck.DeepEquals, expected)
+}
+
+func (s *S) TestNodeSchedulerSkipsUnhealthyNodes(c *gocheck.C) {
+	coll := s.conn.Collection(schedulerCollection)
+	defer coll.RemoveAll(nil)
+	err := coll.Insert(
+		node{ID: "unhealthy", Address: "http://10.10.10.1:4243", Status: provision.NodeUnhealthy},
+		node{ID: "healthy", Address: s.server.URL(), Status: provision.NodeHealthy},
+	)
+	c.Assert(err, gocheck.IsNil)
+	for i := 0; i < 5; i++ {
+		id, _, _ := nodeScheduler{}.Schedule(&docker.Config{Image: "tsuru/python"})
+		c.Assert(id, gocheck.Equals, "healthy")
+	}
+	nodes, err := nodeScheduler{}.Nodes()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(nodes, gocheck.HasLen, 2)
+}
+
+func (s *S) TestNodeSchedulerWithoutHealthyNodes(c *gocheck.C) {
+	coll := s.conn.Collection(schedulerCollection)
+	defer coll.RemoveAll(nil)
+	err := coll.Insert(node{ID: "unhealthy", Address: "http://10.10.10.1:4243", Status: provision.NodeUnhealthy})
+	c.Assert(err, gocheck.IsNil)
+	_, _, err = nodeScheduler{}.Schedule(&docker.Config{Image: "tsuru/python"})
+	c.Assert(err, gocheck.Equals, errNoHealthyNodes)
+}
+
+func (s *S) TestNodeSchedulerInPool(c *gocheck.C) {
+	coll := s.conn.Collection(schedulerCollection)
+	defer coll.RemoveAll(nil)
+	defer s.conn.Collection(poolCollection).RemoveAll(nil)
+	a := app.App{Name: "impius", Teams: []string{"tsuruteam"}}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	err = s.conn.Collection(poolCollection).Insert(pool{Name: "production", Teams: []string{"tsuruteam"}})
+	c.Assert(err, gocheck.IsNil)
+	err = coll.Insert(
+		node{ID: "other", Address: s.server.URL()},
+		node{ID: "production", Address: s.server.URL(), Pool: "production"},
+	)
+	c.Assert(err, gocheck.IsNil)
+	for i := 0; i < 5; i++ {
+		id, _, _ := nodeScheduler{}.Schedule(&docker.Config{Image: s.repoNamespace + "/impius"})
+		c.Assert(id, gocheck.Equals, "production")
+	}
+	err = coll.UpdateId("production", bson.M{"$set": bson.M{"status": provision.NodeUnhealthy}})
+	c.Assert(err, gocheck.IsNil)
+	_, _, err = nodeScheduler{}.Schedule(&docker.Config{Image: s.repoNamespace + "/impius"})
+	c.Assert(err, gocheck.ErrorMatches, `No healthy nodes available in the pool "production"`)
+}
@@ -0,0 +1,126 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"fmt"
+	dclient "github.com/fsouza/go-dockerclient"
+	"github.com/globocom/tsuru/db"
+	"github.com/globocom/tsuru/log"
+	"io"
+	"net/url"
+	"time"
+)
+
+// imageBuildsCollection holds the date in which the images of platforms and
+// apps were last built.
+const imageBuildsCollection = "docker_image_builds"
+
+type imageBuild struct {
+	Image string `bson:"_id"`
+	Date  time.Time
+}
+
+// registerImageBuild stores the current date as the build date of the given
+// image.
+func registerImageBuild(image string) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Collection(imageBuildsCollection).UpsertId(image, imageBuild{Image: image, Date: time.Now().In(time.UTC)})
+	return err
+}
+
+// imageBuildDate returns the date in which the given image was last built,
+// or the zero time if the build of the image was not registered.
+func imageBuildDate(image string) time.Time {
+	var build imageBuild
+	conn, err := db.Conn()
+	if err != nil {
+		return build.Date
+	}
+	defer conn.Close()
+	conn.Collection(imageBuildsCollection).FindId(image).One(&build)
+	return build.Date
+}
+
+// imageBuildContext returns a build context, as a tar archive, with a
+// Dockerfile that just uses the given image.
+func imageBuildContext(image string) (io.Reader, error) {
+	var buf bytes.Buffer
+	dockerfile := []byte(fmt.Sprintf("FROM %s\n", image))
+	w := tar.NewWriter(&buf)
+	header := tar.Header{
+		Name:    "Dockerfile",
+		Mode:    0644,
+		Size:    int64(len(dockerfile)),
+		ModTime: time.Now(),
+	}
+	if err := w.WriteHeader(&header); err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(dockerfile); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return &buf, nil
+}
+
+// buildPlatform builds the base image of the platform in the cluster, either
+// from the URL of a Dockerfile or from an existing image, and replicates it
+// through the nodes of the cluster.
+func buildPlatform(name string, args map[string]string, w io.Writer) error {
+	imageName := assembleImageName(name)
+	opts := dclient.BuildImageOptions{
+		Name:           imageName,
+		NoCache:        true,
+		RmTmpContainer: true,
+		OutputStream:   w,
+	}
+	if dockerfile := args["dockerfile"]; dockerfile != "" {
+		if _, err := url.ParseRequestURI(dockerfile); err != nil {
+			return errors.New("The Dockerfile of the platform must be an URL.")
+		}
+		opts.Remote = dockerfile
+	} else if image := args["image"]; image != "" {
+		input, err := imageBuildContext(image)
+		if err != nil {
+			return err
+		}
+		opts.InputStream = input
+	} else {
+		return errors.New("The docker provisioner requires the Dockerfile or the image of the platform.")
+	}
+	if err := dockerCluster().BuildImage(opts); err != nil {
+		return err
+	}
+	if err := replicateImage(imageName); err != nil {
+		return err
+	}
+	return registerImageBuild(imageName)
+}
+
+func (p *dockerProvisioner) PlatformAdd(name string, args map[string]string, w io.Writer) error {
+	return buildPlatform(name, args, w)
+}
+
+func (p *dockerProvisioner) PlatformUpdate(name string, args map[string]string, w io.Writer) error {
+	return buildPlatform(name, args, w)
+}
+
+func (p *dockerProvisioner) PlatformRemove(name string) error {
+	imageName := assembleImageName(name)
+	if err := removeImage(imageName); err != nil {
+		log.Printf("[docker] Failed to remove the image %q: %s", imageName, err)
+	}
+	return nil
+}
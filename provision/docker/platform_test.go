@@ -0,0 +1,99 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"archive/tar"
+	"bytes"
+	etesting "github.com/globocom/tsuru/exec/testing"
+	"github.com/globocom/tsuru/provision"
+	"io"
+	"io/ioutil"
+	"launchpad.net/gocheck"
+)
+
+func (s *S) TestProvisionerIsPlatformManager(c *gocheck.C) {
+	var _ provision.PlatformManager = &dockerProvisioner{}
+}
+
+func (s *S) TestPlatformAddWithDockerfile(c *gocheck.C) {
+	fexec := &etesting.FakeExecutor{}
+	setExecut(fexec)
+	defer setExecut(nil)
+	var p dockerProvisioner
+	var buf bytes.Buffer
+	args := map[string]string{"dockerfile": "http://example.com/python/Dockerfile"}
+	err := p.PlatformAdd("python", args, &buf)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(fexec.ExecutedCmd("docker", []string{"build", "-t", "tsuru/python", args["dockerfile"]}), gocheck.Equals, false)
+}
+
+func (s *S) TestPlatformAddWithInvalidDockerfileURL(c *gocheck.C) {
+	var p dockerProvisioner
+	var buf bytes.Buffer
+	err := p.PlatformAdd("python", map[string]string{"dockerfile": "python/Dockerfile"}, &buf)
+	c.Assert(err, gocheck.ErrorMatches, "^The Dockerfile of the platform must be an URL.$")
+}
+
+func (s *S) TestPlatformAddWithImage(c *gocheck.C) {
+	fexec := &etesting.FakeExecutor{}
+	setExecut(fexec)
+	defer setExecut(nil)
+	var p dockerProvisioner
+	var buf bytes.Buffer
+	err := p.PlatformAdd("python", map[string]string{"image": "someone/python"}, &buf)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(fexec.ExecutedCmd("docker", []string{"pull", "someone/python"}), gocheck.Equals, false)
+}
+
+func (s *S) TestImageBuildContext(c *gocheck.C) {
+	input, err := imageBuildContext("someone/python")
+	c.Assert(err, gocheck.IsNil)
+	r := tar.NewReader(input)
+	header, err := r.Next()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(header.Name, gocheck.Equals, "Dockerfile")
+	dockerfile, err := ioutil.ReadAll(r)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(string(dockerfile), gocheck.Equals, "FROM someone/python\n")
+	_, err = r.Next()
+	c.Assert(err, gocheck.Equals, io.EOF)
+}
+
+func (s *S) TestPlatformAddWithoutDockerfileOrImage(c *gocheck.C) {
+	var p dockerProvisioner
+	var buf bytes.Buffer
+	err := p.PlatformAdd("python", map[string]string{}, &buf)
+	c.Assert(err, gocheck.ErrorMatches, "^The docker provisioner requires the Dockerfile or the image of the platform.$")
+}
+
+func (s *S) TestPlatformUpdate(c *gocheck.C) {
+	fexec := &etesting.FakeExecutor{}
+	setExecut(fexec)
+	defer setExecut(nil)
+	var p dockerProvisioner
+	var buf bytes.Buffer
+	args := map[string]string{"dockerfile": "http://example.com/python/Dockerfile"}
+	err := p.PlatformUpdate("python", args, &buf)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(fexec.ExecutedCmd("docker", []string{"build", "-t", "tsuru/python", args["dockerfile"]}), gocheck.Equals, false)
+}
+
+func (s *S) TestPlatformUpdateRegistersTheBuildOfTheImage(c *gocheck.C) {
+	coll := s.conn.Collection(imageBuildsCollection)
+	defer coll.RemoveAll(nil)
+	var p dockerProvisioner
+	var buf bytes.Buffer
+	err := p.PlatformUpdate("python", map[string]string{"image": "someone/python"}, &buf)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(imageBuildDate(assembleImageName("python")).IsZero(), gocheck.Equals, false)
+	c.Assert(imageBuildDate(assembleImageName("ruby")).IsZero(), gocheck.Equals, true)
+}
+
+func (s *S) TestPlatformRemove(c *gocheck.C) {
+	var p dockerProvisioner
+	err := p.PlatformRemove("unknown")
+	c.Assert(err, gocheck.IsNil)
+}
@@ -0,0 +1,158 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"github.com/globocom/tsuru/app"
+	"github.com/globocom/tsuru/db"
+	"github.com/globocom/tsuru/provision"
+	"labix.org/v2/mgo"
+	"labix.org/v2/mgo/bson"
+)
+
+const poolCollection = "docker_pools"
+
+// pool is a pool of docker nodes, as stored in the database. The nodes of the
+// pool are the ones whose Pool is the name of the pool.
+type pool struct {
+	Name    string `bson:"_id"`
+	Teams   []string
+	Default bool
+}
+
+// appPool returns the pool where the containers of the app are created: the
+// pool chosen on the creation of the app, the first pool assigned to one of
+// its teams or the default pool. It returns an empty string when there's no
+// such pool.
+func appPool(a *app.App) (string, error) {
+	name, err := teamPool(a)
+	if err != nil || name != "" {
+		return name, err
+	}
+	return defaultPool()
+}
+
+// teamPool returns the pool chosen on the creation of the app or the first
+// pool assigned to one of its teams, ignoring the default pool.
+func teamPool(a *app.App) (string, error) {
+	if a.Pool != "" {
+		return a.Pool, nil
+	}
+	return findPool(bson.M{"teams": bson.M{"$in": a.Teams}})
+}
+
+// defaultPool returns the default pool, if any.
+func defaultPool() (string, error) {
+	return findPool(bson.M{"default": true})
+}
+
+func findPool(query bson.M) (string, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	var p pool
+	err = conn.Collection(poolCollection).Find(query).Sort("_id").One(&p)
+	if err == mgo.ErrNotFound {
+		return "", nil
+	}
+	return p.Name, err
+}
+
+func poolExists(conn *db.Storage, name string) (bool, error) {
+	n, err := conn.Collection(poolCollection).FindId(name).Count()
+	return n > 0, err
+}
+
+// AddPool adds a pool of nodes. When the pool is the default, the previous
+// default pool is no longer the default.
+func (p *dockerProvisioner) AddPool(pl provision.Pool) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	coll := conn.Collection(poolCollection)
+	if exists, err := poolExists(conn, pl.Name); err != nil {
+		return err
+	} else if exists {
+		return provision.ErrPoolAlreadyExists
+	}
+	if pl.Default {
+		_, err = coll.UpdateAll(bson.M{"default": true}, bson.M{"$set": bson.M{"default": false}})
+		if err != nil {
+			return err
+		}
+	}
+	err = coll.Insert(pool{Name: pl.Name, Teams: pl.Teams, Default: pl.Default})
+	if mgo.IsDup(err) {
+		return provision.ErrPoolAlreadyExists
+	}
+	return err
+}
+
+// RemovePool removes a pool. Pools that still have nodes can't be removed.
+func (p *dockerProvisioner) RemovePool(name string) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	n, err := conn.Collection(schedulerCollection).Find(bson.M{"pool": name}).Count()
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		return provision.ErrPoolNotEmpty
+	}
+	err = conn.Collection(poolCollection).RemoveId(name)
+	if err == mgo.ErrNotFound {
+		return provision.ErrPoolNotFound
+	}
+	return err
+}
+
+// ListPools returns all pools, sorted by name.
+func (p *dockerProvisioner) ListPools() ([]provision.Pool, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	var pools []pool
+	err = conn.Collection(poolCollection).Find(nil).Sort("_id").All(&pools)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]provision.Pool, len(pools))
+	for i, pl := range pools {
+		result[i] = provision.Pool{Name: pl.Name, Teams: pl.Teams, Default: pl.Default}
+	}
+	return result, nil
+}
+
+// AddTeamsToPool assigns the pool to the given teams.
+func (p *dockerProvisioner) AddTeamsToPool(name string, teams []string) error {
+	return updatePool(name, bson.M{"$addToSet": bson.M{"teams": bson.M{"$each": teams}}})
+}
+
+// RemoveTeamsFromPool removes the given teams from the pool.
+func (p *dockerProvisioner) RemoveTeamsFromPool(name string, teams []string) error {
+	return updatePool(name, bson.M{"$pullAll": bson.M{"teams": teams}})
+}
+
+func updatePool(name string, update bson.M) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	err = conn.Collection(poolCollection).UpdateId(name, update)
+	if err == mgo.ErrNotFound {
+		return provision.ErrPoolNotFound
+	}
+	return err
+}
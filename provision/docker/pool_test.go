@@ -0,0 +1,122 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"github.com/globocom/tsuru/app"
+	"github.com/globocom/tsuru/provision"
+	"launchpad.net/gocheck"
+)
+
+func (s *S) TestProvisionerAddPool(c *gocheck.C) {
+	defer s.conn.Collection(poolCollection).RemoveAll(nil)
+	var p dockerProvisioner
+	err := p.AddPool(provision.Pool{Name: "staging", Teams: []string{"tsuruteam"}})
+	c.Assert(err, gocheck.IsNil)
+	err = p.AddPool(provision.Pool{Name: "production"})
+	c.Assert(err, gocheck.IsNil)
+	pools, err := p.ListPools()
+	c.Assert(err, gocheck.IsNil)
+	expected := []provision.Pool{
+		{Name: "production"},
+		{Name: "staging", Teams: []string{"tsuruteam"}},
+	}
+	c.Assert(pools, gocheck.DeepEquals, expected)
+	err = p.AddPool(provision.Pool{Name: "staging"})
+	c.Assert(err, gocheck.Equals, provision.ErrPoolAlreadyExists)
+}
+
+func (s *S) TestProvisionerAddDefaultPool(c *gocheck.C) {
+	defer s.conn.Collection(poolCollection).RemoveAll(nil)
+	var p dockerProvisioner
+	err := p.AddPool(provision.Pool{Name: "staging", Default: true})
+	c.Assert(err, gocheck.IsNil)
+	err = p.AddPool(provision.Pool{Name: "staging", Default: true})
+	c.Assert(err, gocheck.Equals, provision.ErrPoolAlreadyExists)
+	err = p.AddPool(provision.Pool{Name: "production", Default: true})
+	c.Assert(err, gocheck.IsNil)
+	pools, err := p.ListPools()
+	c.Assert(err, gocheck.IsNil)
+	expected := []provision.Pool{
+		{Name: "production", Default: true},
+		{Name: "staging"},
+	}
+	c.Assert(pools, gocheck.DeepEquals, expected)
+}
+
+func (s *S) TestProvisionerRemovePool(c *gocheck.C) {
+	defer s.conn.Collection(poolCollection).RemoveAll(nil)
+	defer s.conn.Collection(schedulerCollection).RemoveAll(nil)
+	var p dockerProvisioner
+	err := p.AddPool(provision.Pool{Name: "staging"})
+	c.Assert(err, gocheck.IsNil)
+	err = p.AddNode(provision.Node{ID: "server0", Address: "http://10.10.10.1:4243", Pool: "staging"})
+	c.Assert(err, gocheck.IsNil)
+	err = p.RemovePool("staging")
+	c.Assert(err, gocheck.Equals, provision.ErrPoolNotEmpty)
+	err = p.RemoveNode("server0")
+	c.Assert(err, gocheck.IsNil)
+	err = p.RemovePool("staging")
+	c.Assert(err, gocheck.IsNil)
+	err = p.RemovePool("staging")
+	c.Assert(err, gocheck.Equals, provision.ErrPoolNotFound)
+}
+
+func (s *S) TestProvisionerAddNodeToUnknownPool(c *gocheck.C) {
+	defer s.conn.Collection(schedulerCollection).RemoveAll(nil)
+	var p dockerProvisioner
+	err := p.AddNode(provision.Node{ID: "server0", Address: "http://10.10.10.1:4243", Pool: "staging"})
+	c.Assert(err, gocheck.Equals, provision.ErrPoolNotFound)
+}
+
+func (s *S) TestProvisionerPoolTeams(c *gocheck.C) {
+	defer s.conn.Collection(poolCollection).RemoveAll(nil)
+	var p dockerProvisioner
+	err := p.AddPool(provision.Pool{Name: "staging", Teams: []string{"tsuruteam"}})
+	c.Assert(err, gocheck.IsNil)
+	err = p.AddTeamsToPool("staging", []string{"tsuruteam", "nodockerforme", "admin"})
+	c.Assert(err, gocheck.IsNil)
+	pools, err := p.ListPools()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(pools[0].Teams, gocheck.DeepEquals, []string{"tsuruteam", "nodockerforme", "admin"})
+	err = p.RemoveTeamsFromPool("staging", []string{"tsuruteam", "admin"})
+	c.Assert(err, gocheck.IsNil)
+	pools, err = p.ListPools()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(pools[0].Teams, gocheck.DeepEquals, []string{"nodockerforme"})
+	err = p.AddTeamsToPool("production", []string{"tsuruteam"})
+	c.Assert(err, gocheck.Equals, provision.ErrPoolNotFound)
+	err = p.RemoveTeamsFromPool("production", []string{"tsuruteam"})
+	c.Assert(err, gocheck.Equals, provision.ErrPoolNotFound)
+}
+
+func (s *S) TestAppPool(c *gocheck.C) {
+	defer s.conn.Collection(poolCollection).RemoveAll(nil)
+	var p dockerProvisioner
+	a := app.App{Name: "impius", Teams: []string{"nodockerforme", "tsuruteam"}}
+	pool, err := appPool(&a)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(pool, gocheck.Equals, "")
+	err = p.AddPool(provision.Pool{Name: "shared", Default: true})
+	c.Assert(err, gocheck.IsNil)
+	pool, err = appPool(&a)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(pool, gocheck.Equals, "shared")
+	err = p.AddPool(provision.Pool{Name: "staging", Teams: []string{"tsuruteam"}})
+	c.Assert(err, gocheck.IsNil)
+	err = p.AddPool(provision.Pool{Name: "production", Teams: []string{"tsuruteam"}})
+	c.Assert(err, gocheck.IsNil)
+	pool, err = appPool(&a)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(pool, gocheck.Equals, "production")
+	a.Pool = "staging"
+	pool, err = appPool(&a)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(pool, gocheck.Equals, "staging")
+}
+
+func (s *S) TestDockerProvisionerIsPoolManager(c *gocheck.C) {
+	var _ provision.PoolManager = &dockerProvisioner{}
+}
@@ -69,15 +69,62 @@ func (p *dockerProvisioner) Provision(app provision.App) error {
 	return r.AddBackend(app.GetName())
 }
 
-func (p *dockerProvisioner) Restart(app provision.App) error {
-	containers, err := listAppContainers(app.GetName())
+// Restart restarts the containers of the app in batches, whose size is
+// defined by the docker:rolling-batch-size setting. When the app has other
+// containers serving requests, each batch is removed from the router during
+// the restart, and added back after passing the health check of the app.
+//
+// If the resource limits of the app have changed since the containers were
+// created, the containers are replaced by new ones instead.
+func (p *dockerProvisioner) Restart(a provision.App) error {
+	containers, err := listAppContainers(a.GetName())
 	if err != nil {
 		log.Printf("Got error while getting app containers: %s", err)
 		return err
 	}
-	var buf bytes.Buffer
 	for _, c := range containers {
-		err = c.ssh(&buf, &buf, "/var/lib/tsuru/restart")
+		if c.outdated(a) {
+			w := app.LogWriter{App: a, Writer: ioutil.Discard}
+			return replaceContainers(a, getImage(a), &w)
+		}
+	}
+	hc, err := imageHealthCheck(a, getImage(a))
+	if err != nil {
+		return err
+	}
+	size := batchSize()
+	for i := 0; i < len(containers); i += size {
+		end := i + size
+		if end > len(containers) {
+			end = len(containers)
+		}
+		detach := end-i < len(containers)
+		if err := restartBatch(a, containers[i:end], hc, detach); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// restartBatch restarts the given containers. If detach is true, the
+// containers are removed from the router before restarting, and added back
+// after passing the health check. Containers that fail the health check are
+// kept out of the router, the other detached containers are added back to the
+// router when the batch fails.
+func restartBatch(app provision.App, batch []container, hc *provision.HealthCheck, detach bool) error {
+	detached := make(map[string]container)
+	defer func() {
+		for _, c := range detached {
+			c.addRoute()
+		}
+	}()
+	var buf bytes.Buffer
+	for _, c := range batch {
+		if detach {
+			c.removeRoute()
+			detached[c.ID] = c
+		}
+		err := c.ssh(&buf, &buf, "/var/lib/tsuru/restart")
 		if err != nil {
 			log.Printf("Failed to restart %q: %s.", app.GetName(), err)
 			log.Printf("Command outputs:")
@@ -87,9 +134,35 @@ func (p *dockerProvisioner) Restart(app provision.App) error {
 		}
 		buf.Reset()
 	}
+	for _, c := range batch {
+		if hc != nil {
+			if err := hc.Wait(c.getAddress()); err != nil {
+				log.Printf("Container %s failed the health check after restart: %s", c.ID, err)
+				delete(detached, c.ID)
+				return err
+			}
+		}
+		if detach {
+			delete(detached, c.ID)
+			if err := c.addRoute(); err != nil {
+				return err
+			}
+		}
+	}
 	return nil
 }
 
+// batchSize returns the number of containers replaced or restarted at once in
+// rolling deploys and restarts. It's defined by the docker:rolling-batch-size
+// setting, and defaults to 1.
+func batchSize() int {
+	size, err := config.GetInt("docker:rolling-batch-size")
+	if err != nil || size < 1 {
+		return 1
+	}
+	return size
+}
+
 func injectEnvsAndRestart(a provision.App) {
 	time.Sleep(5e9)
 	err := a.SerializeEnvVars()
@@ -104,18 +177,9 @@ func injectEnvsAndRestart(a provision.App) {
 	}
 }
 
-func startInBackground(a provision.App, c container, imageId string, w io.Writer, started chan bool) {
-	_, err := start(a, imageId, w)
-	if err != nil {
-		log.Printf("error on start the app %s - %s", a.GetName(), err)
-	}
-	if c.ID != "" {
-		if a.RemoveUnit(c.ID) != nil {
-			removeContainer(&c)
-		}
-	}
-	started <- true
-}
+// startNewContainer starts a new container of the app, based on the given
+// image. It's a variable so tests can make it fail.
+var startNewContainer = start
 
 func (dockerProvisioner) Swap(app1, app2 provision.App) error {
 	r, err := getRouter()
@@ -155,26 +219,132 @@ func (dockerProvisioner) Swap(app1, app2 provision.App) error {
 }
 
 func (p *dockerProvisioner) Deploy(a provision.App, version string, w io.Writer) error {
+	_, err := p.ImageDeploy(a, version, w)
+	return err
+}
+
+// ImageDeploy builds a new image for the given version of the app, replacing
+// the containers of the app with containers based on this image. It returns
+// the name of the image, so it can be used in rollbacks.
+func (p *dockerProvisioner) ImageDeploy(a provision.App, version string, w io.Writer) (string, error) {
 	imageId, err := deploy(a, version, w)
+	if err != nil {
+		return "", err
+	}
+	if err := replaceContainers(a, imageId, w); err != nil {
+		return "", err
+	}
+	return imageId, nil
+}
+
+// Rollback replaces the containers of the app with containers based on an
+// image built in a previous deploy.
+func (p *dockerProvisioner) Rollback(a provision.App, imageId string, w io.Writer) error {
+	return replaceContainers(a, imageId, w)
+}
+
+// replaceContainers replaces the containers of the app with new containers
+// based on the given image, in batches whose size is defined by the
+// docker:rolling-batch-size setting.
+//
+// For each batch, new containers are started and added to the router after
+// passing the health check defined in the image, and then the old containers
+// of the batch are removed from the router. The old containers are destroyed
+// only after every batch is replaced. If a batch fails, the new containers are
+// destroyed and the old ones are added back to the router, so the app keeps
+// running the previous image.
+func replaceContainers(a provision.App, imageId string, w io.Writer) error {
+	hc, err := imageHealthCheck(a, imageId)
 	if err != nil {
 		return err
 	}
 	containers, err := listAppContainers(a.GetName())
-	started := make(chan bool, len(containers))
-	if err == nil && len(containers) > 0 {
-		for _, c := range containers {
-			go startInBackground(a, c, imageId, w, started)
+	if err != nil || len(containers) == 0 {
+		containers = []container{{}}
+	}
+	var created, replaced []container
+	size := batchSize()
+	for i := 0; i < len(containers); i += size {
+		end := i + size
+		if end > len(containers) {
+			end = len(containers)
 		}
-	} else {
-		go startInBackground(a, container{}, imageId, w, started)
+		started, err := replaceBatch(a, containers[i:end], imageId, hc, w)
+		created = append(created, started...)
+		if err != nil {
+			fmt.Fprintf(w, "\n ---> Failed to replace the units, rolling back to the previous units\n")
+			undoReplace(created, replaced)
+			return err
+		}
+		for _, c := range containers[i:end] {
+			if c.ID != "" {
+				c.removeRoute()
+				replaced = append(replaced, c)
+			}
+		}
+		fmt.Fprintf(w, "\n ---> Replaced %d of %d units\n", end, len(containers))
 	}
-	if <-started {
-		fmt.Fprint(w, "\n ---> App will be restarted, please check its log for more details...\n\n")
-		go injectEnvsAndRestart(a)
+	for _, c := range replaced {
+		if a.RemoveUnit(c.ID) != nil {
+			removeContainer(&c)
+		}
 	}
+	fmt.Fprint(w, "\n ---> App will be restarted, please check its log for more details...\n\n")
+	go injectEnvsAndRestart(a)
 	return nil
 }
 
+// undoReplace destroys the new containers and adds the replaced containers
+// back to the router.
+func undoReplace(created, replaced []container) {
+	for _, c := range created {
+		if err := removeContainer(&c); err != nil {
+			log.Printf("Failed to remove the container %s: %s", c.ID, err)
+		}
+	}
+	for _, c := range replaced {
+		if err := c.addRoute(); err != nil {
+			log.Printf("Failed to add the container %s back to the router: %s", c.ID, err)
+		}
+	}
+}
+
+type startResult struct {
+	container *container
+	err       error
+}
+
+// replaceBatch starts a new container for each container in the batch at
+// once. It returns the containers that were started, and the first error
+// found while starting them.
+func replaceBatch(a provision.App, batch []container, imageId string, hc *provision.HealthCheck, w io.Writer) ([]container, error) {
+	results := make(chan startResult, len(batch))
+	// The containers of the batch report their progress concurrently.
+	w = &syncWriter{w: w}
+	for _ = range batch {
+		go func() {
+			c, err := startNewContainer(a, imageId, hc, w)
+			if err != nil {
+				log.Printf("error on start the app %s - %s", a.GetName(), err)
+			}
+			results <- startResult{container: c, err: err}
+		}()
+	}
+	var started []container
+	var startErr error
+	for _ = range batch {
+		r := <-results
+		if r.err != nil {
+			if startErr == nil {
+				startErr = r.err
+			}
+			continue
+		}
+		started = append(started, *r.container)
+	}
+	return started, startErr
+}
+
 func (p *dockerProvisioner) Destroy(app provision.App) error {
 	containers, _ := listAppContainers(app.GetName())
 	for _, c := range containers {
@@ -182,7 +352,7 @@ func (p *dockerProvisioner) Destroy(app provision.App) error {
 			removeContainer(&c)
 		}(c)
 	}
-	go removeImage(assembleImageName(app.GetName()))
+	go removeAppImages(app.GetName())
 	r, err := getRouter()
 	if err != nil {
 		log.Printf("Failed to get router: %s", err.Error())
@@ -191,6 +361,37 @@ func (p *dockerProvisioner) Destroy(app provision.App) error {
 	return r.RemoveBackend(app.GetName())
 }
 
+// removeAppImages removes the latest image of the app and every image
+// recorded in its deploys.
+func removeAppImages(appName string) {
+	images := []string{assembleImageName(appName)}
+	a := app.App{Name: appName}
+	deploys, err := a.Deploys()
+	if err != nil {
+		log.Printf("Failed to list the deploys of the app %s: %s", appName, err)
+	}
+	for _, d := range deploys {
+		if d.Image == "" {
+			continue
+		}
+		found := false
+		for _, image := range images {
+			if image == d.Image {
+				found = true
+				break
+			}
+		}
+		if !found {
+			images = append(images, d.Image)
+		}
+	}
+	for _, image := range images {
+		if err := removeImage(image); err != nil {
+			log.Printf("Failed to remove the image %s: %s", image, err)
+		}
+	}
+}
+
 func (*dockerProvisioner) Addr(app provision.App) (string, error) {
 	r, err := getRouter()
 	if err != nil {
@@ -216,11 +417,15 @@ func (*dockerProvisioner) AddUnits(a provision.App, units uint) ([]provision.Uni
 	if len(containers) < 1 {
 		return nil, errors.New("New units can only be added after the first deployment")
 	}
+	imageId := getImage(a)
+	hc, err := imageHealthCheck(a, imageId)
+	if err != nil {
+		return nil, err
+	}
 	writer := app.LogWriter{App: a, Writer: ioutil.Discard}
 	result := make([]provision.Unit, int(units))
-	imageId := getImage(a)
 	for i := uint(0); i < units; i++ {
-		container, err := start(a, imageId, &writer)
+		container, err := start(a, imageId, hc, &writer)
 		if err != nil {
 			return nil, err
 		}
@@ -246,7 +451,10 @@ func (*dockerProvisioner) RemoveUnit(app provision.App, unitName string) error {
 	return removeContainer(container)
 }
 
+// removeContainer removes the container from the router, and then stops and
+// removes it.
 func removeContainer(c *container) error {
+	c.removeRoute()
 	err := c.stop()
 	if err != nil {
 		log.Printf("error on stop unit %s - %s", c.ID, err)
@@ -6,7 +6,11 @@ package docker
 
 import (
 	"bytes"
+	"errors"
+	"fmt"
 	dockerClient "github.com/fsouza/go-dockerclient"
+	"github.com/globocom/config"
+	"github.com/globocom/tsuru/app"
 	"github.com/globocom/tsuru/cmd"
 	"github.com/globocom/tsuru/exec"
 	etesting "github.com/globocom/tsuru/exec/testing"
@@ -14,9 +18,13 @@ import (
 	"github.com/globocom/tsuru/provision"
 	rtesting "github.com/globocom/tsuru/router/testing"
 	"github.com/globocom/tsuru/testing"
+	"io"
 	"labix.org/v2/mgo/bson"
 	"launchpad.net/gocheck"
 	stdlog "log"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"runtime"
 	"strings"
 	"time"
@@ -68,6 +76,166 @@ func (s *S) TestProvisionerRestartCallsTheRestartHook(c *gocheck.C) {
 	c.Assert(fexec.ExecutedCmd("ssh", args), gocheck.Equals, true)
 }
 
+func (s *S) TestProvisionerRestartInBatches(c *gocheck.C) {
+	fexec := &etesting.FakeExecutor{}
+	setExecut(fexec)
+	defer setExecut(nil)
+	config.Set("docker:rolling-batch-size", 1)
+	defer config.Unset("docker:rolling-batch-size")
+	var p dockerProvisioner
+	app := testing.NewFakeApp("almah", "static", 2)
+	app.SetHealthCheck(&provision.HealthCheck{Path: "/healthcheck", Timeout: 1})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	rtesting.FakeRouter.AddBackend(app.GetName())
+	defer rtesting.FakeRouter.RemoveBackend(app.GetName())
+	var conts []container
+	for i := 0; i < 2; i++ {
+		server := httptest.NewServer(handler)
+		defer server.Close()
+		host, port, _ := net.SplitHostPort(strings.TrimPrefix(server.URL, "http://"))
+		cont := container{
+			ID:       fmt.Sprintf("caad7bbd541%d", i),
+			AppName:  app.GetName(),
+			Type:     app.GetPlatform(),
+			IP:       fmt.Sprintf("10.10.10.1%d", i),
+			HostAddr: host,
+			HostPort: port,
+		}
+		err := collection().Insert(cont)
+		c.Assert(err, gocheck.IsNil)
+		defer collection().RemoveId(cont.ID)
+		rtesting.FakeRouter.AddRoute(app.GetName(), cont.getAddress())
+		conts = append(conts, cont)
+	}
+	err := p.Restart(app)
+	c.Assert(err, gocheck.IsNil)
+	for _, cont := range conts {
+		args := []string{
+			cont.IP, "-l", s.sshUser, "-o", "StrictHostKeyChecking no",
+			"--", "/var/lib/tsuru/restart",
+		}
+		c.Assert(fexec.ExecutedCmd("ssh", args), gocheck.Equals, true)
+		c.Assert(rtesting.FakeRouter.HasRoute(app.GetName(), cont.getAddress()), gocheck.Equals, true)
+	}
+}
+
+func (s *S) TestProvisionerRestartKeepsUnhealthyContainersOutOfTheRouter(c *gocheck.C) {
+	fexec := &etesting.FakeExecutor{}
+	setExecut(fexec)
+	defer setExecut(nil)
+	var p dockerProvisioner
+	app := testing.NewFakeApp("almah", "static", 2)
+	app.SetHealthCheck(&provision.HealthCheck{Path: "/healthcheck", Timeout: 1})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+	host, port, _ := net.SplitHostPort(strings.TrimPrefix(server.URL, "http://"))
+	rtesting.FakeRouter.AddBackend(app.GetName())
+	defer rtesting.FakeRouter.RemoveBackend(app.GetName())
+	cont1 := container{ID: "caad7bbd5410", AppName: app.GetName(), IP: "10.10.10.10", HostAddr: host, HostPort: port}
+	cont2 := container{ID: "caad7bbd5411", AppName: app.GetName(), IP: "10.10.10.11", HostAddr: "10.10.10.11", HostPort: "3333"}
+	for _, cont := range []container{cont1, cont2} {
+		err := collection().Insert(cont)
+		c.Assert(err, gocheck.IsNil)
+		defer collection().RemoveId(cont.ID)
+		rtesting.FakeRouter.AddRoute(app.GetName(), cont.getAddress())
+	}
+	err := p.Restart(app)
+	c.Assert(err, gocheck.ErrorMatches, "unit at .* did not pass the health check .*")
+	c.Assert(rtesting.FakeRouter.HasRoute(app.GetName(), cont1.getAddress()), gocheck.Equals, false)
+	c.Assert(rtesting.FakeRouter.HasRoute(app.GetName(), cont2.getAddress()), gocheck.Equals, true)
+}
+
+func (s *S) TestProvisionerRestartAddsBackTheDetachedContainersOfAFailedBatch(c *gocheck.C) {
+	fexec := &etesting.FakeExecutor{}
+	setExecut(fexec)
+	defer setExecut(nil)
+	config.Set("docker:rolling-batch-size", 2)
+	defer config.Unset("docker:rolling-batch-size")
+	var p dockerProvisioner
+	app := testing.NewFakeApp("almah", "static", 3)
+	app.SetHealthCheck(&provision.HealthCheck{Path: "/healthcheck", Timeout: 1})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+	host, port, _ := net.SplitHostPort(strings.TrimPrefix(server.URL, "http://"))
+	rtesting.FakeRouter.AddBackend(app.GetName())
+	defer rtesting.FakeRouter.RemoveBackend(app.GetName())
+	cont1 := container{ID: "caad7bbd5410", AppName: app.GetName(), IP: "10.10.10.10", HostAddr: host, HostPort: port}
+	cont2 := container{ID: "caad7bbd5411", AppName: app.GetName(), IP: "10.10.10.11", HostAddr: "10.10.10.11", HostPort: "3333"}
+	cont3 := container{ID: "caad7bbd5412", AppName: app.GetName(), IP: "10.10.10.12", HostAddr: "10.10.10.12", HostPort: "3333"}
+	for _, cont := range []container{cont1, cont2, cont3} {
+		err := collection().Insert(cont)
+		c.Assert(err, gocheck.IsNil)
+		defer collection().RemoveId(cont.ID)
+		rtesting.FakeRouter.AddRoute(app.GetName(), cont.getAddress())
+	}
+	err := p.Restart(app)
+	c.Assert(err, gocheck.ErrorMatches, "unit at .* did not pass the health check .*")
+	c.Assert(rtesting.FakeRouter.HasRoute(app.GetName(), cont1.getAddress()), gocheck.Equals, false)
+	c.Assert(rtesting.FakeRouter.HasRoute(app.GetName(), cont2.getAddress()), gocheck.Equals, true)
+	c.Assert(rtesting.FakeRouter.HasRoute(app.GetName(), cont3.getAddress()), gocheck.Equals, true)
+}
+
+func (s *S) TestProvisionerRestartReadsTheHealthCheckFromTheImage(c *gocheck.C) {
+	fexec := &etesting.FakeExecutor{}
+	setExecut(fexec)
+	defer setExecut(nil)
+	var images []string
+	old := imageHealthCheck
+	imageHealthCheck = func(a provision.App, imageId string) (*provision.HealthCheck, error) {
+		images = append(images, imageId)
+		return nil, nil
+	}
+	defer func() { imageHealthCheck = old }()
+	var p dockerProvisioner
+	app := testing.NewFakeApp("almah", "static", 1)
+	rtesting.FakeRouter.AddBackend(app.GetName())
+	defer rtesting.FakeRouter.RemoveBackend(app.GetName())
+	cont := container{ID: "caad7bbd5410", AppName: app.GetName(), IP: "10.10.10.10", Image: "tsuru/almah:v1"}
+	err := collection().Insert(cont)
+	c.Assert(err, gocheck.IsNil)
+	defer collection().RemoveId(cont.ID)
+	err = p.Restart(app)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(images, gocheck.DeepEquals, []string{"tsuru/almah:v1"})
+}
+
+func (s *S) TestProvisionerRestartReplacesOutdatedContainers(c *gocheck.C) {
+	err := s.newImage()
+	c.Assert(err, gocheck.IsNil)
+	cont, err := s.newContainer()
+	c.Assert(err, gocheck.IsNil)
+	defer rtesting.FakeRouter.RemoveBackend(cont.AppName)
+	fexec := &etesting.FakeExecutor{}
+	setExecut(fexec)
+	defer setExecut(nil)
+	var p dockerProvisioner
+	app := testing.NewFakeApp(cont.AppName, "python", 0)
+	app.Memory = 256
+	defer p.Destroy(app)
+	err = p.Restart(app)
+	c.Assert(err, gocheck.IsNil)
+	containers, err := listAppContainers(app.GetName())
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(containers, gocheck.HasLen, 1)
+	c.Assert(containers[0].ID, gocheck.Not(gocheck.Equals), cont.ID)
+	c.Assert(containers[0].Memory, gocheck.Equals, int64(256*1024*1024))
+}
+
+func (s *S) TestBatchSize(c *gocheck.C) {
+	c.Assert(batchSize(), gocheck.Equals, 1)
+	config.Set("docker:rolling-batch-size", 3)
+	defer config.Unset("docker:rolling-batch-size")
+	c.Assert(batchSize(), gocheck.Equals, 3)
+	config.Set("docker:rolling-batch-size", 0)
+	c.Assert(batchSize(), gocheck.Equals, 1)
+}
+
 func (s *S) stopContainers(n uint) {
 	client, err := dockerClient.NewClient(s.server.URL())
 	if err != nil {
@@ -112,6 +280,154 @@ func (s *S) TestDeploy(c *gocheck.C) {
 	c.Assert(app.HasLog("tsuru", "Restarting app..."), gocheck.Equals, true)
 }
 
+func (s *S) TestRollback(c *gocheck.C) {
+	err := s.newImage()
+	c.Assert(err, gocheck.IsNil)
+	fexec := &etesting.FakeExecutor{}
+	setExecut(fexec)
+	defer setExecut(nil)
+	p := dockerProvisioner{}
+	app := testing.NewFakeApp("cribcaged", "python", 1)
+	p.Provision(app)
+	defer p.Destroy(app)
+	var buf bytes.Buffer
+	err = p.Rollback(app, "tsuru/python", &buf)
+	c.Assert(err, gocheck.IsNil)
+	containers, err := listAppContainers(app.GetName())
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(containers, gocheck.HasLen, 1)
+	c.Assert(containers[0].Image, gocheck.Equals, "tsuru/python")
+}
+
+func (s *S) TestRollbackInBatches(c *gocheck.C) {
+	err := s.newImage()
+	c.Assert(err, gocheck.IsNil)
+	cont1, err := s.newContainer()
+	c.Assert(err, gocheck.IsNil)
+	cont2, err := s.newContainer()
+	c.Assert(err, gocheck.IsNil)
+	defer rtesting.FakeRouter.RemoveBackend(cont1.AppName)
+	fexec := &etesting.FakeExecutor{}
+	setExecut(fexec)
+	defer setExecut(nil)
+	config.Set("docker:rolling-batch-size", 1)
+	defer config.Unset("docker:rolling-batch-size")
+	var p dockerProvisioner
+	app := testing.NewFakeApp(cont1.AppName, "python", 0)
+	defer p.Destroy(app)
+	var buf bytes.Buffer
+	err = p.Rollback(app, "tsuru/python", &buf)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(buf.String(), gocheck.Matches, "(?s).*Replaced 1 of 2 units.*Replaced 2 of 2 units.*")
+	containers, err := listAppContainers(app.GetName())
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(containers, gocheck.HasLen, 2)
+	for _, cont := range containers {
+		c.Assert(cont.ID, gocheck.Not(gocheck.Equals), cont1.ID)
+		c.Assert(cont.ID, gocheck.Not(gocheck.Equals), cont2.ID)
+	}
+}
+
+func (s *S) TestRollbackKeepsTheOldContainersWhenABatchFails(c *gocheck.C) {
+	err := s.newImage()
+	c.Assert(err, gocheck.IsNil)
+	fexec := &etesting.FakeExecutor{}
+	setExecut(fexec)
+	defer setExecut(nil)
+	config.Set("docker:rolling-batch-size", 1)
+	defer config.Unset("docker:rolling-batch-size")
+	var calls int
+	old := startNewContainer
+	startNewContainer = func(a provision.App, imageId string, hc *provision.HealthCheck, w io.Writer) (*container, error) {
+		calls++
+		if calls == 2 {
+			return nil, errors.New("batch 2 failed")
+		}
+		return old(a, imageId, hc, w)
+	}
+	defer func() { startNewContainer = old }()
+	var p dockerProvisioner
+	app := testing.NewFakeApp("almah", "python", 0)
+	rtesting.FakeRouter.AddBackend(app.GetName())
+	defer rtesting.FakeRouter.RemoveBackend(app.GetName())
+	olds := []container{
+		{ID: "caad7bbd5410", AppName: app.GetName(), Image: "tsuru/almah", IP: "10.10.10.10", HostAddr: "10.10.10.10", HostPort: "3333"},
+		{ID: "caad7bbd5411", AppName: app.GetName(), Image: "tsuru/almah", IP: "10.10.10.11", HostAddr: "10.10.10.11", HostPort: "3333"},
+		{ID: "caad7bbd5412", AppName: app.GetName(), Image: "tsuru/almah", IP: "10.10.10.12", HostAddr: "10.10.10.12", HostPort: "3333"},
+	}
+	for _, cont := range olds {
+		err := collection().Insert(cont)
+		c.Assert(err, gocheck.IsNil)
+		defer collection().RemoveId(cont.ID)
+		rtesting.FakeRouter.AddRoute(app.GetName(), cont.getAddress())
+	}
+	var buf bytes.Buffer
+	err = p.Rollback(app, "tsuru/python", &buf)
+	c.Assert(err, gocheck.ErrorMatches, "batch 2 failed")
+	c.Assert(calls, gocheck.Equals, 2)
+	routes, err := rtesting.FakeRouter.Routes(app.GetName())
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(routes, gocheck.HasLen, len(olds))
+	for _, cont := range olds {
+		c.Assert(rtesting.FakeRouter.HasRoute(app.GetName(), cont.getAddress()), gocheck.Equals, true)
+	}
+	containers, err := listAppContainers(app.GetName())
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(containers, gocheck.HasLen, len(olds))
+	for _, cont := range containers {
+		c.Assert(cont.Image, gocheck.Equals, "tsuru/almah")
+	}
+}
+
+func (s *S) TestRollbackHealthCheckFailure(c *gocheck.C) {
+	err := s.newImage()
+	c.Assert(err, gocheck.IsNil)
+	fexec := &etesting.FakeExecutor{}
+	setExecut(fexec)
+	defer setExecut(nil)
+	p := dockerProvisioner{}
+	app := testing.NewFakeApp("cribcaged", "python", 1)
+	app.SetHealthCheck(&provision.HealthCheck{Path: "/healthcheck", Timeout: 1})
+	p.Provision(app)
+	defer p.Destroy(app)
+	var buf bytes.Buffer
+	err = p.Rollback(app, "tsuru/python", &buf)
+	c.Assert(err, gocheck.ErrorMatches, "unit at .* did not pass the health check .*")
+	containers, err := listAppContainers(app.GetName())
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(containers, gocheck.HasLen, 0)
+	routes, err := rtesting.FakeRouter.Routes(app.GetName())
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(routes, gocheck.HasLen, 0)
+}
+
+func (s *S) TestRollbackReadsTheHealthCheckFromTheImage(c *gocheck.C) {
+	err := s.newImage()
+	c.Assert(err, gocheck.IsNil)
+	fexec := &etesting.FakeExecutor{}
+	setExecut(fexec)
+	defer setExecut(nil)
+	var images []string
+	old := imageHealthCheck
+	imageHealthCheck = func(a provision.App, imageId string) (*provision.HealthCheck, error) {
+		images = append(images, imageId)
+		return &provision.HealthCheck{Path: "/healthcheck", Timeout: 1}, nil
+	}
+	defer func() { imageHealthCheck = old }()
+	p := dockerProvisioner{}
+	app := testing.NewFakeApp("cribcaged", "python", 1)
+	p.Provision(app)
+	defer p.Destroy(app)
+	var buf bytes.Buffer
+	err = p.Rollback(app, "tsuru/python", &buf)
+	c.Assert(err, gocheck.ErrorMatches, "unit at .* did not pass the health check .*")
+	c.Assert(images, gocheck.DeepEquals, []string{"tsuru/python"})
+}
+
+func (s *S) TestProvisionerIsRollbacker(c *gocheck.C) {
+	var _ provision.Rollbacker = &dockerProvisioner{}
+}
+
 type writer struct {
 	b   []byte
 	cur int
@@ -181,6 +497,30 @@ func (s *S) TestProvisionerDestroy(c *gocheck.C) {
 	c.Assert(rtesting.FakeRouter.HasBackend("myapp"), gocheck.Equals, false)
 }
 
+func (s *S) TestRemoveAppImagesRemovesTheImagesOfTheDeploys(c *gocheck.C) {
+	client, err := dockerClient.NewClient(s.server.URL())
+	c.Assert(err, gocheck.IsNil)
+	var deployed []string
+	for _, version := range []string{"v1", "v2"} {
+		image := assembleImageName("myapp") + ":" + version
+		var buf bytes.Buffer
+		err = client.PullImage(dockerClient.PullImageOptions{Repository: image}, &buf)
+		c.Assert(err, gocheck.IsNil)
+		err = s.conn.Deploys().Insert(app.Deploy{App: "myapp", Version: version, Image: image})
+		c.Assert(err, gocheck.IsNil)
+		deployed = append(deployed, image)
+	}
+	defer s.conn.Deploys().RemoveAll(bson.M{"app": "myapp"})
+	removeAppImages("myapp")
+	images, err := client.ListImages(true)
+	c.Assert(err, gocheck.IsNil)
+	for _, image := range images {
+		for _, d := range deployed {
+			c.Assert(image.Repository, gocheck.Not(gocheck.Equals), d)
+		}
+	}
+}
+
 func (s *S) TestProvisionerDestroyEmptyUnit(c *gocheck.C) {
 	fexec := &etesting.FakeExecutor{}
 	setExecut(fexec)
@@ -245,6 +585,28 @@ func (s *S) TestProvisionerAddUnits(c *gocheck.C) {
 	c.Assert(count, gocheck.Equals, 4)
 }
 
+func (s *S) TestProvisionerAddUnitsReadsTheHealthCheckFromTheImage(c *gocheck.C) {
+	err := s.newImage()
+	c.Assert(err, gocheck.IsNil)
+	var images []string
+	old := imageHealthCheck
+	imageHealthCheck = func(a provision.App, imageId string) (*provision.HealthCheck, error) {
+		images = append(images, imageId)
+		return nil, nil
+	}
+	defer func() { imageHealthCheck = old }()
+	var p dockerProvisioner
+	app := testing.NewFakeApp("myapp", "python", 0)
+	p.Provision(app)
+	defer p.Destroy(app)
+	s.conn.Collection(s.collName).Insert(container{ID: "c-89320", AppName: app.GetName(), Image: "tsuru/python"})
+	defer s.conn.Collection(s.collName).RemoveId("c-89320")
+	_, err = p.AddUnits(app, 1)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Collection(s.collName).RemoveAll(bson.M{"appname": app.GetName()})
+	c.Assert(images, gocheck.DeepEquals, []string{"tsuru/python"})
+}
+
 func (s *S) TestProvisionerAddZeroUnits(c *gocheck.C) {
 	var p dockerProvisioner
 	units, err := p.AddUnits(nil, 0)
@@ -6,6 +6,7 @@ package docker
 
 import (
 	"errors"
+	"fmt"
 	"github.com/dotcloud/docker"
 	dcli "github.com/fsouza/go-dockerclient"
 	"github.com/globocom/config"
@@ -13,55 +14,95 @@ import (
 	"github.com/globocom/tsuru/app"
 	"github.com/globocom/tsuru/cmd"
 	"github.com/globocom/tsuru/db"
+	"github.com/globocom/tsuru/provision"
 	"labix.org/v2/mgo"
 	"labix.org/v2/mgo/bson"
 	"math/rand"
 	"strings"
+	"time"
 )
 
 // errNoFallback is the error returned when no fallback hosts are configured in
 // the segregated scheduler.
 var errNoFallback = errors.New("No fallback configured in the scheduler")
 
+// errNoHealthyNodes is the error returned when there are no healthy nodes to
+// schedule a container.
+var errNoHealthyNodes = errors.New("No healthy nodes available")
+
 var (
-	errNodeAlreadyRegister = errors.New("This node is already registered")
-	errNodeNotFound        = errors.New("Node not found")
+	errNodeAlreadyRegister = provision.ErrNodeAlreadyExists
+	errNodeNotFound        = provision.ErrNodeNotFound
 )
 
 const schedulerCollection = "docker_scheduler"
 
+// node is a docker node, as stored in the database. Team is used only by the
+// segregated scheduler.
 type node struct {
-	ID      string `bson:"_id"`
-	Address string
-	Team    string
+	ID        string `bson:"_id"`
+	Address   string
+	Team      string
+	Pool      string            `bson:",omitempty"`
+	Labels    map[string]string `bson:",omitempty"`
+	Status    provision.NodeStatus
+	LastCheck time.Time `bson:",omitempty"`
+	Error     string    `bson:",omitempty"`
+}
+
+// schedulable returns the query for the nodes of the given query that may
+// receive new containers: the ones that didn't fail the last health check.
+func schedulable(query bson.M) bson.M {
+	query["status"] = bson.M{"$ne": provision.NodeUnhealthy}
+	return query
+}
+
+// unpooled returns the query for the nodes of the given query that are not
+// assigned to a pool.
+func unpooled(query bson.M) bson.M {
+	query["pool"] = bson.M{"$in": []interface{}{nil, ""}}
+	return query
 }
 
+// segregatedScheduler creates the containers of an app in the pool chosen
+// for the app or in the pool of one of its teams. Apps without such pool use
+// the nodes of their team, when they have only one team, then the default
+// pool and, at last, the nodes without team and without pool.
 type segregatedScheduler struct{}
 
 func (s segregatedScheduler) Schedule(cfg *docker.Config) (string, *docker.Container, error) {
-	image := cfg.Image
-	namespace, err := config.GetString("docker:repository-namespace")
-	if err != nil {
-		return "", nil, err
-	}
 	conn, err := db.Conn()
 	if err != nil {
 		return "", nil, err
 	}
 	defer conn.Close()
-	appname := strings.Replace(image, namespace+"/", "", -1)
-	app := app.App{Name: appname}
-	err = app.Get()
+	a, err := configApp(cfg)
 	if err != nil {
+		return "", nil, err
+	}
+	if a == nil {
 		return s.fallback(cfg)
 	}
-	if len(app.Teams) == 1 {
+	pool, err := teamPool(a)
+	if err != nil {
+		return "", nil, err
+	}
+	if pool != "" {
+		return scheduleInPool(cfg, pool)
+	}
+	if len(a.Teams) == 1 {
 		var nodes []node
-		err = conn.Collection(schedulerCollection).Find(bson.M{"team": app.Teams[0]}).All(&nodes)
-		if err != nil || len(nodes) < 1 {
-			return s.fallback(cfg)
+		err = conn.Collection(schedulerCollection).Find(schedulable(bson.M{"team": a.Teams[0]})).All(&nodes)
+		if err == nil && len(nodes) > 0 {
+			return s.handle(cfg, nodes)
 		}
-		return s.handle(cfg, nodes)
+	}
+	pool, err = defaultPool()
+	if err != nil {
+		return "", nil, err
+	}
+	if pool != "" {
+		return scheduleInPool(cfg, pool)
 	}
 	return s.fallback(cfg)
 }
@@ -73,7 +114,7 @@ func (s segregatedScheduler) fallback(cfg *docker.Config) (string, *docker.Conta
 	}
 	defer conn.Close()
 	var nodes []node
-	err = conn.Collection(schedulerCollection).Find(bson.M{"team": ""}).All(&nodes)
+	err = conn.Collection(schedulerCollection).Find(schedulable(unpooled(bson.M{"team": ""}))).All(&nodes)
 	if err != nil || len(nodes) < 1 {
 		return "", nil, errNoFallback
 	}
@@ -81,6 +122,125 @@ func (s segregatedScheduler) fallback(cfg *docker.Config) (string, *docker.Conta
 }
 
 func (segregatedScheduler) handle(cfg *docker.Config, nodes []node) (string, *docker.Container, error) {
+	return scheduleIn(cfg, nodes)
+}
+
+func (segregatedScheduler) Nodes() ([]cluster.Node, error) {
+	return registeredNodes()
+}
+
+// nodeScheduler is the scheduler used when the segregation is disabled. It
+// creates the containers of apps that have a pool in the healthy nodes of the
+// pool, and the other containers in healthy nodes that are not assigned to a
+// pool.
+type nodeScheduler struct{}
+
+func (nodeScheduler) Schedule(cfg *docker.Config) (string, *docker.Container, error) {
+	a, err := configApp(cfg)
+	if err != nil {
+		return "", nil, err
+	}
+	if a != nil {
+		pool, err := appPool(a)
+		if err != nil {
+			return "", nil, err
+		}
+		if pool != "" {
+			return scheduleInPool(cfg, pool)
+		}
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return "", nil, err
+	}
+	defer conn.Close()
+	var nodes []node
+	err = conn.Collection(schedulerCollection).Find(schedulable(unpooled(bson.M{}))).All(&nodes)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(nodes) == 0 {
+		return "", nil, errNoHealthyNodes
+	}
+	return scheduleIn(cfg, nodes)
+}
+
+func (nodeScheduler) Nodes() ([]cluster.Node, error) {
+	return registeredNodes()
+}
+
+// appNameEnv is the environment variable that carries the name of the app in
+// the config of its containers, so the schedulers know the app of the
+// containers created from platform images.
+const appNameEnv = "TSURU_APP_NAME"
+
+// configApp returns the app of the container being created, or nil when the
+// container doesn't belong to an app. The app is taken from the environment
+// of the container and, when it's not there, from the image name, without
+// the registry and the tag.
+func configApp(cfg *docker.Config) (*app.App, error) {
+	var name string
+	for _, env := range cfg.Env {
+		if strings.HasPrefix(env, appNameEnv+"=") {
+			name = strings.TrimPrefix(env, appNameEnv+"=")
+			break
+		}
+	}
+	if name == "" {
+		namespace, err := config.GetString("docker:repository-namespace")
+		if err != nil {
+			return nil, err
+		}
+		name = imageAppName(cfg.Image, namespace)
+	}
+	if name == "" {
+		return nil, nil
+	}
+	a := app.App{Name: name}
+	if err := a.Get(); err == mgo.ErrNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+// imageAppName returns the name of the app of an image named like
+// [registry/]namespace/app[:tag], or an empty string for other images.
+func imageAppName(image, namespace string) string {
+	parts := strings.Split(image, "/")
+	if len(parts) < 2 || parts[len(parts)-2] != namespace {
+		return ""
+	}
+	name := parts[len(parts)-1]
+	if i := strings.Index(name, ":"); i >= 0 {
+		name = name[:i]
+	}
+	return name
+}
+
+// scheduleInPool creates the container in one of the healthy nodes of the
+// given pool. Containers are never created outside of the pool.
+func scheduleInPool(cfg *docker.Config, pool string) (string, *docker.Container, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return "", nil, err
+	}
+	defer conn.Close()
+	var nodes []node
+	err = conn.Collection(schedulerCollection).Find(schedulable(bson.M{"pool": pool})).All(&nodes)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(nodes) == 0 {
+		return "", nil, fmt.Errorf("No healthy nodes available in the pool %q", pool)
+	}
+	return scheduleIn(cfg, nodes)
+}
+
+// scheduleIn creates the container in one of the given nodes, chosen
+// randomly.
+func scheduleIn(cfg *docker.Config, nodes []node) (string, *docker.Container, error) {
 	node := nodes[rand.Intn(len(nodes))]
 	client, err := dcli.NewClient(node.Address)
 	if err != nil {
@@ -90,7 +250,9 @@ func (segregatedScheduler) handle(cfg *docker.Config, nodes []node) (string, *do
 	return node.ID, container, err
 }
 
-func (segregatedScheduler) Nodes() ([]cluster.Node, error) {
+// registeredNodes returns all nodes registered in the database, including the
+// unhealthy ones, that may still have containers.
+func registeredNodes() ([]cluster.Node, error) {
 	conn, err := db.Conn()
 	if err != nil {
 		return nil, err
@@ -14,6 +14,7 @@ import (
 	"github.com/globocom/tsuru/app"
 	"github.com/globocom/tsuru/cmd"
 	"github.com/globocom/tsuru/db"
+	"github.com/globocom/tsuru/provision"
 	"labix.org/v2/mgo/bson"
 	"launchpad.net/gocheck"
 )
@@ -354,3 +355,185 @@ func (s *SchedulerSuite) TestListNodesInTheSchedulerCmdRun(c *gocheck.C) {
 `
 	c.Assert(buf.String(), gocheck.Equals, expected)
 }
+
+func (s *SchedulerSuite) TestSchedulerScheduleInPool(c *gocheck.C) {
+	server0, err := testing.NewServer(nil)
+	c.Assert(err, gocheck.IsNil)
+	defer server0.Stop()
+	server1, err := testing.NewServer(nil)
+	c.Assert(err, gocheck.IsNil)
+	defer server1.Stop()
+	var buf bytes.Buffer
+	for _, server := range []*testing.DockerServer{server0, server1} {
+		client, _ := dcli.NewClient(server.URL())
+		client.PullImage(dcli.PullImageOptions{Repository: "tsuru/impius"}, &buf)
+		client.PullImage(dcli.PullImageOptions{Repository: "tsuru/mirror"}, &buf)
+	}
+	a1 := app.App{Name: "impius", Teams: []string{"tsuruteam"}, Pool: "staging"}
+	a2 := app.App{Name: "mirror", Teams: []string{"tsuruteam"}}
+	err = s.storage.Apps().Insert(a1, a2)
+	c.Assert(err, gocheck.IsNil)
+	defer s.storage.Apps().Remove(bson.M{"name": bson.M{"$in": []string{a1.Name, a2.Name}}})
+	err = s.storage.Collection(poolCollection).Insert(pool{Name: "staging"}, pool{Name: "production", Teams: []string{"tsuruteam"}})
+	c.Assert(err, gocheck.IsNil)
+	defer s.storage.Collection(poolCollection).RemoveAll(nil)
+	coll := s.storage.Collection(schedulerCollection)
+	err = coll.Insert(
+		node{ID: "server0", Address: server0.URL(), Team: "tsuruteam", Pool: "staging"},
+		node{ID: "server1", Address: server1.URL(), Team: "tsuruteam", Pool: "production"},
+	)
+	c.Assert(err, gocheck.IsNil)
+	defer coll.RemoveAll(nil)
+	var scheduler segregatedScheduler
+	config := docker.Config{Cmd: []string{"/usr/sbin/sshd", "-D"}, Image: "tsuru/impius"}
+	for i := 0; i < 5; i++ {
+		node, _, err := scheduler.Schedule(&config)
+		c.Assert(err, gocheck.IsNil)
+		c.Check(node, gocheck.Equals, "server0")
+	}
+	config = docker.Config{Cmd: []string{"/usr/sbin/sshd", "-D"}, Image: "tsuru/mirror"}
+	for i := 0; i < 5; i++ {
+		node, _, err := scheduler.Schedule(&config)
+		c.Assert(err, gocheck.IsNil)
+		c.Check(node, gocheck.Equals, "server1")
+	}
+}
+
+func (s *SchedulerSuite) TestSchedulerPrefersTeamNodesToTheDefaultPool(c *gocheck.C) {
+	server0, err := testing.NewServer(nil)
+	c.Assert(err, gocheck.IsNil)
+	defer server0.Stop()
+	server1, err := testing.NewServer(nil)
+	c.Assert(err, gocheck.IsNil)
+	defer server1.Stop()
+	var buf bytes.Buffer
+	for _, server := range []*testing.DockerServer{server0, server1} {
+		client, _ := dcli.NewClient(server.URL())
+		client.PullImage(dcli.PullImageOptions{Repository: "tsuru/mirror"}, &buf)
+		client.PullImage(dcli.PullImageOptions{Repository: "tsuru/dedication"}, &buf)
+	}
+	a1 := app.App{Name: "mirror", Teams: []string{"tsuruteam"}}
+	a2 := app.App{Name: "dedication", Teams: []string{"nodockerforme"}}
+	err = s.storage.Apps().Insert(a1, a2)
+	c.Assert(err, gocheck.IsNil)
+	defer s.storage.Apps().Remove(bson.M{"name": bson.M{"$in": []string{a1.Name, a2.Name}}})
+	err = s.storage.Collection(poolCollection).Insert(pool{Name: "shared", Default: true})
+	c.Assert(err, gocheck.IsNil)
+	defer s.storage.Collection(poolCollection).RemoveAll(nil)
+	coll := s.storage.Collection(schedulerCollection)
+	err = coll.Insert(
+		node{ID: "server0", Address: server0.URL(), Team: "tsuruteam"},
+		node{ID: "server1", Address: server1.URL(), Pool: "shared"},
+	)
+	c.Assert(err, gocheck.IsNil)
+	defer coll.RemoveAll(nil)
+	var scheduler segregatedScheduler
+	config := docker.Config{Cmd: []string{"/usr/sbin/sshd", "-D"}, Image: "tsuru/mirror"}
+	for i := 0; i < 5; i++ {
+		node, _, err := scheduler.Schedule(&config)
+		c.Assert(err, gocheck.IsNil)
+		c.Check(node, gocheck.Equals, "server0")
+	}
+	config = docker.Config{Cmd: []string{"/usr/sbin/sshd", "-D"}, Image: "tsuru/dedication"}
+	for i := 0; i < 5; i++ {
+		node, _, err := scheduler.Schedule(&config)
+		c.Assert(err, gocheck.IsNil)
+		c.Check(node, gocheck.Equals, "server1")
+	}
+}
+
+func (s *SchedulerSuite) TestSchedulersKeepAppsWithoutPoolOutOfPooledNodes(c *gocheck.C) {
+	server0, err := testing.NewServer(nil)
+	c.Assert(err, gocheck.IsNil)
+	defer server0.Stop()
+	var buf bytes.Buffer
+	client, _ := dcli.NewClient(server0.URL())
+	client.PullImage(dcli.PullImageOptions{Repository: "tsuru/mirror"}, &buf)
+	a := app.App{Name: "mirror", Teams: []string{"tsuruteam"}}
+	err = s.storage.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.storage.Apps().Remove(bson.M{"name": a.Name})
+	coll := s.storage.Collection(schedulerCollection)
+	err = coll.Insert(
+		node{ID: "server0", Address: server0.URL()},
+		node{ID: "server1", Address: "http://10.10.10.2:4243", Pool: "production"},
+	)
+	c.Assert(err, gocheck.IsNil)
+	defer coll.RemoveAll(nil)
+	config := docker.Config{Cmd: []string{"/usr/sbin/sshd", "-D"}, Image: "tsuru/mirror"}
+	schedulers := []cluster.Scheduler{segregatedScheduler{}, nodeScheduler{}}
+	for _, scheduler := range schedulers {
+		for i := 0; i < 5; i++ {
+			node, _, err := scheduler.Schedule(&config)
+			c.Assert(err, gocheck.IsNil)
+			c.Check(node, gocheck.Equals, "server0")
+		}
+	}
+	err = coll.RemoveId("server0")
+	c.Assert(err, gocheck.IsNil)
+	_, _, err = nodeScheduler{}.Schedule(&config)
+	c.Assert(err, gocheck.Equals, errNoHealthyNodes)
+	_, _, err = segregatedScheduler{}.Schedule(&config)
+	c.Assert(err, gocheck.Equals, errNoFallback)
+}
+
+func (s *SchedulerSuite) TestSchedulerPoolWithoutNodes(c *gocheck.C) {
+	a := app.App{Name: "impius", Teams: []string{"tsuruteam"}, Pool: "staging"}
+	err := s.storage.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.storage.Apps().Remove(bson.M{"name": a.Name})
+	coll := s.storage.Collection(schedulerCollection)
+	err = coll.Insert(
+		node{ID: "server0", Address: "http://10.10.10.1:4243", Pool: "staging", Status: provision.NodeUnhealthy},
+		node{ID: "server1", Address: "http://10.10.10.2:4243"},
+	)
+	c.Assert(err, gocheck.IsNil)
+	defer coll.RemoveAll(nil)
+	config := docker.Config{Cmd: []string{"/usr/sbin/sshd", "-D"}, Image: "tsuru/impius"}
+	var scheduler segregatedScheduler
+	node, container, err := scheduler.Schedule(&config)
+	c.Assert(node, gocheck.Equals, "")
+	c.Assert(container, gocheck.IsNil)
+	c.Assert(err, gocheck.ErrorMatches, `No healthy nodes available in the pool "staging"`)
+}
+
+func (s *SchedulerSuite) TestSchedulerFindsThePoolOfTaggedAndPlatformImages(c *gocheck.C) {
+	a := app.App{Name: "impius", Teams: []string{"tsuruteam"}, Pool: "staging"}
+	err := s.storage.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.storage.Apps().Remove(bson.M{"name": a.Name})
+	coll := s.storage.Collection(schedulerCollection)
+	err = coll.Insert(node{ID: "server1", Address: "http://10.10.10.2:4243"})
+	c.Assert(err, gocheck.IsNil)
+	defer coll.RemoveAll(nil)
+	configs := []docker.Config{
+		{Image: "tsuru/impius:v2"},
+		{Image: "registry.example.com:5000/tsuru/impius:v2"},
+		{Image: "tsuru/python", Env: []string{"TSURU_APP_NAME=impius"}},
+	}
+	schedulers := []cluster.Scheduler{segregatedScheduler{}, nodeScheduler{}}
+	for _, scheduler := range schedulers {
+		for _, config := range configs {
+			node, _, err := scheduler.Schedule(&config)
+			c.Check(node, gocheck.Equals, "")
+			c.Check(err, gocheck.ErrorMatches, `No healthy nodes available in the pool "staging"`)
+		}
+	}
+}
+
+func (s *SchedulerSuite) TestImageAppName(c *gocheck.C) {
+	var tests = []struct {
+		image    string
+		expected string
+	}{
+		{"tsuru/impius", "impius"},
+		{"tsuru/impius:v2", "impius"},
+		{"registry.example.com:5000/tsuru/impius:v2", "impius"},
+		{"other/impius", ""},
+		{"impius", ""},
+		{"", ""},
+	}
+	for _, t := range tests {
+		c.Check(imageAppName(t.image, "tsuru"), gocheck.Equals, t.expected)
+	}
+}
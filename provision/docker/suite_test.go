@@ -68,12 +68,18 @@ func (s *S) SetUpSuite(c *gocheck.C) {
 	f.Close()
 	s.server, err = dtesting.NewServer(nil)
 	c.Assert(err, gocheck.IsNil)
+	// The fake docker server does not run the commands of the containers,
+	// so the health check is taken from the app instead of the image.
+	imageHealthCheck = func(a provision.App, imageId string) (*provision.HealthCheck, error) {
+		return a.HealthCheck()
+	}
 	dCluster, _ = cluster.New(nil,
 		cluster.Node{ID: "server", Address: s.server.URL()},
 	)
 }
 
 func (s *S) TearDownSuite(c *gocheck.C) {
+	imageHealthCheck = readImageHealthCheck
 	s.conn.Collection(s.collName).Database.DropDatabase()
 	fsystem = nil
 }
@@ -0,0 +1,98 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package provision
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	defaultHealthCheckStatus  = http.StatusOK
+	defaultHealthCheckTimeout = 60
+)
+
+// healthCheckInterval is the interval between two requests performed by
+// HealthCheck.Wait.
+var healthCheckInterval = time.Second
+
+// HealthCheck describes how to check whether a unit of an app is ready to
+// receive requests. It's defined in the healthcheck section of the app.yaml
+// file:
+//
+//	healthcheck:
+//	  path: /healthcheck
+//	  status: 200
+//	  timeout: 60
+type HealthCheck struct {
+	// Path is the path requested in the unit.
+	Path string
+
+	// Status is the status code expected in the response. Defaults to
+	// 200.
+	Status int
+
+	// Timeout is the maximum number of seconds Wait waits for the unit to
+	// pass the check. Defaults to 60.
+	Timeout int
+}
+
+func (hc *HealthCheck) status() int {
+	if hc.Status == 0 {
+		return defaultHealthCheckStatus
+	}
+	return hc.Status
+}
+
+func (hc *HealthCheck) timeout() time.Duration {
+	if hc.Timeout <= 0 {
+		return defaultHealthCheckTimeout * time.Second
+	}
+	return time.Duration(hc.Timeout) * time.Second
+}
+
+// Check requests the health check path in the unit listening in the given
+// address (e.g.: http://10.10.10.10:8080) once, returning an error if the
+// unit does not respond with the expected status.
+func (hc *HealthCheck) Check(address string) error {
+	timeout := hc.timeout()
+	client := http.Client{
+		Transport: &http.Transport{
+			Dial: func(network, addr string) (net.Conn, error) {
+				return net.DialTimeout(network, addr, timeout)
+			},
+			ResponseHeaderTimeout: timeout,
+		},
+	}
+	url := strings.TrimRight(address, "/") + "/" + strings.TrimLeft(hc.Path, "/")
+	resp, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != hc.status() {
+		return fmt.Errorf("health check failed: %s returned %d, expected %d", url, resp.StatusCode, hc.status())
+	}
+	return nil
+}
+
+// Wait checks the unit listening in the given address until it passes the
+// health check, returning an error if it does not pass within the timeout.
+func (hc *HealthCheck) Wait(address string) error {
+	deadline := time.Now().Add(hc.timeout())
+	for {
+		err := hc.Check(address)
+		if err == nil {
+			return nil
+		}
+		if time.Now().Add(healthCheckInterval).After(deadline) {
+			return fmt.Errorf("unit at %s did not pass the health check within %s: %s", address, hc.timeout(), err)
+		}
+		time.Sleep(healthCheckInterval)
+	}
+}
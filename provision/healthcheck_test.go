@@ -0,0 +1,81 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package provision
+
+import (
+	"launchpad.net/gocheck"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"time"
+)
+
+func (ProvisionSuite) TestHealthCheckDefaults(c *gocheck.C) {
+	hc := HealthCheck{Path: "/healthcheck"}
+	c.Assert(hc.status(), gocheck.Equals, http.StatusOK)
+	c.Assert(hc.timeout(), gocheck.Equals, 60*time.Second)
+	hc = HealthCheck{Path: "/healthcheck", Status: http.StatusNoContent, Timeout: 10}
+	c.Assert(hc.status(), gocheck.Equals, http.StatusNoContent)
+	c.Assert(hc.timeout(), gocheck.Equals, 10*time.Second)
+}
+
+func (ProvisionSuite) TestHealthCheckCheck(c *gocheck.C) {
+	var path string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	hc := HealthCheck{Path: "healthcheck"}
+	err := hc.Check(server.URL)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(path, gocheck.Equals, "/healthcheck")
+}
+
+func (ProvisionSuite) TestHealthCheckCheckUnexpectedStatus(c *gocheck.C) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	hc := HealthCheck{Path: "/healthcheck", Status: http.StatusNoContent}
+	err := hc.Check(server.URL)
+	c.Assert(err, gocheck.ErrorMatches, "health check failed: .* returned 200, expected 204")
+}
+
+func (ProvisionSuite) TestHealthCheckWait(c *gocheck.C) {
+	old := healthCheckInterval
+	healthCheckInterval = 10 * time.Millisecond
+	defer func() {
+		healthCheckInterval = old
+	}()
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	hc := HealthCheck{Path: "/healthcheck", Timeout: 5}
+	err := hc.Wait(server.URL)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(atomic.LoadInt32(&calls), gocheck.Equals, int32(3))
+}
+
+func (ProvisionSuite) TestHealthCheckWaitTimeout(c *gocheck.C) {
+	old := healthCheckInterval
+	healthCheckInterval = 100 * time.Millisecond
+	defer func() {
+		healthCheckInterval = old
+	}()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	hc := HealthCheck{Path: "/healthcheck", Timeout: 1}
+	err := hc.Wait(server.URL)
+	c.Assert(err, gocheck.ErrorMatches, "unit at .* did not pass the health check within 1s: .*")
+}
@@ -102,6 +102,14 @@ func (p *JujuProvisioner) enqueueUnits(app string, units ...string) {
 	})
 }
 
+// charmName returns the name of the charm used by the given platform.
+func charmName(platform string) string {
+	if p, err := app.GetPlatform(platform); err == nil {
+		return p.CharmName()
+	}
+	return platform
+}
+
 func (p *JujuProvisioner) Provision(app provision.App) error {
 	var buf bytes.Buffer
 	charms, err := config.GetString("juju:charms-path")
@@ -110,7 +118,7 @@ func (p *JujuProvisioner) Provision(app provision.App) error {
 	}
 	args := []string{
 		"deploy", "--repository", charms,
-		"local:" + app.GetPlatform(), app.GetName(),
+		"local:" + charmName(app.GetPlatform()), app.GetName(),
 	}
 	err = runCmd(false, &buf, &buf, args...)
 	out := buf.String()
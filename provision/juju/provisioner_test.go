@@ -9,6 +9,7 @@ import (
 	"errors"
 	"github.com/globocom/commandmocker"
 	"github.com/globocom/config"
+	"github.com/globocom/tsuru/app"
 	etesting "github.com/globocom/tsuru/exec/testing"
 	"github.com/globocom/tsuru/provision"
 	"github.com/globocom/tsuru/repository"
@@ -73,6 +74,27 @@ func (s *S) TestProvision(c *gocheck.C) {
 	c.Assert(fexec.ExecutedCmd("juju", args), gocheck.Equals, true)
 }
 
+func (s *S) TestProvisionUsesTheCharmOfThePlatform(c *gocheck.C) {
+	fexec := &etesting.FakeExecutor{}
+	execut = fexec
+	defer func() {
+		execut = nil
+	}()
+	config.Set("juju:charms-path", "/etc/juju/charms")
+	defer config.Unset("juju:charms-path")
+	err := s.conn.Platforms().Insert(app.Platform{Name: "django", Charm: "python"})
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Platforms().RemoveId("django")
+	a := testing.NewFakeApp("trace", "django", 0)
+	p := JujuProvisioner{}
+	err = p.Provision(a)
+	c.Assert(err, gocheck.IsNil)
+	args := []string{
+		"deploy", "--repository", "/etc/juju/charms", "local:python", "trace",
+	}
+	c.Assert(fexec.ExecutedCmd("juju", args), gocheck.Equals, true)
+}
+
 func (s *S) TestProvisionUndefinedCharmsPath(c *gocheck.C) {
 	config.Unset("juju:charms-path")
 	p := JujuProvisioner{}
@@ -5,16 +5,23 @@
 package juju
 
 import (
+	"github.com/globocom/tsuru/app"
 	"github.com/globocom/tsuru/log"
 	"github.com/globocom/tsuru/provision"
 	"github.com/globocom/tsuru/queue"
 	"sort"
+	"strings"
 	"sync"
 )
 
 const (
 	addUnitToLoadBalancer = "add-unit-to-lb"
 	queueName             = "tsuru-provision-juju"
+
+	// maxHealthCheckAttempts is the number of times, one second apart,
+	// units that fail the health check of the app are checked before
+	// giving up on adding them to the load balancer.
+	maxHealthCheckAttempts = 60
 )
 
 type qApp struct {
@@ -56,38 +63,78 @@ func handle(msg *queue.Message) {
 			msg.Delete()
 			return
 		}
-		var noID []string
+		var notReady []string
 		var ok []provision.Unit
 		for _, u := range units {
 			if u.InstanceId == "pending" || u.InstanceId == "" {
-				noID = append(noID, u.Name)
+				notReady = append(notReady, u.Name)
 			} else {
 				ok = append(ok, u)
 			}
 		}
-		if len(noID) == len(units) {
-			getQueue(queueName).Release(msg, 0)
-		} else {
-			router, _ := Router()
-			for _, u := range units {
-				router.AddRoute(a.GetName(), u.InstanceId)
-			}
-			msg.Delete()
-			if len(noID) > 0 {
-				args := []string{a.name}
-				args = append(args, noID...)
-				msg := queue.Message{
-					Action: msg.Action,
-					Args:   args,
+		if len(notReady) == len(units) {
+			// The message is not deleted, so the queue handler retries it
+			// after the backoff of the action.
+			return
+		}
+		router, _ := Router()
+		hc := healthCheck(a.name)
+		var unhealthy []string
+		for _, u := range ok {
+			if hc != nil {
+				if err := hc.Check("http://" + u.Ip); err != nil {
+					log.Printf("Unit %q is not ready to receive requests: %s.", u.Name, err)
+					unhealthy = append(unhealthy, u.Name)
+					continue
 				}
-				getQueue(queueName).Put(&msg, 1e9)
 			}
+			router.AddRoute(a.GetName(), u.InstanceId)
+		}
+		msg.Delete()
+		if len(notReady) > 0 {
+			args := []string{a.name}
+			args = append(args, notReady...)
+			msg := queue.Message{
+				Action: msg.Action,
+				Args:   args,
+			}
+			getQueue(queueName).Put(&msg, 1e9)
+		}
+		if len(unhealthy) > 0 {
+			if msg.Attempts >= maxHealthCheckAttempts {
+				log.Printf("Giving up adding the units %s to the load balancer: they did not pass the health check after %d attempts.", strings.Join(unhealthy, ", "), msg.Attempts)
+				return
+			}
+			args := []string{a.name}
+			args = append(args, unhealthy...)
+			msg := queue.Message{
+				Action:   msg.Action,
+				Args:     args,
+				Attempts: msg.Attempts,
+			}
+			getQueue(queueName).Put(&msg, 1e9)
 		}
 	} else {
 		msg.Delete()
 	}
 }
 
+// healthCheck returns the health check of the given app, or nil if the app
+// does not define one. Units of the app are added to the load balancer only
+// after passing the health check.
+func healthCheck(appName string) *provision.HealthCheck {
+	a := app.App{Name: appName}
+	if err := a.Get(); err != nil {
+		return nil
+	}
+	hc, err := a.HealthCheck()
+	if err != nil {
+		log.Printf("Failed to load the health check of the app %q: %s.", appName, err)
+		return nil
+	}
+	return hc
+}
+
 var (
 	qfactory queue.QFactory
 	_handler queue.Handler
@@ -132,10 +132,13 @@ func (s *ELBSuite) TestHandleMessagesAllPendingUnits(c *gocheck.C) {
 	c.Assert(resp.LoadBalancerDescriptions, gocheck.HasLen, 1)
 	instances := resp.LoadBalancerDescriptions[0].Instances
 	c.Assert(instances, gocheck.HasLen, 0)
+	// The message is retried by the queue handler, the handler itself
+	// doesn't put it back in the queue.
 	got, err := getQueue(queueName).Get(1e6)
-	c.Assert(err, gocheck.IsNil)
-	c.Assert(*got, gocheck.DeepEquals, msg)
-	got.Delete()
+	if err == nil {
+		got.Delete()
+		c.Fatalf("Expected no message in the queue, got %#v.", got)
+	}
 }
 
 func (s *ELBSuite) TestEnqueuePutMessagesInSpecificQueue(c *gocheck.C) {
@@ -151,3 +154,7 @@ func (s *ELBSuite) TestEnqueuePutMessagesInSpecificQueue(c *gocheck.C) {
 	c.Assert(msg.Action, gocheck.Equals, "clean-everything")
 	msg.Delete()
 }
+
+func (s *ELBSuite) TestHealthCheckUnknownApp(c *gocheck.C) {
+	c.Assert(healthCheck("unknown-app"), gocheck.IsNil)
+}
@@ -0,0 +1,25 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package provision
+
+import "github.com/globocom/tsuru/metrics"
+
+var provisionerErrors = metrics.NewCounter(
+	"tsuru_provisioner_errors_total",
+	"Number of errors returned by the provisioner, by operation.",
+	"operation",
+)
+
+// CountError counts the error, when it's not nil, as a failure of the given
+// operation of the provisioner. It returns the error, so it may wrap calls to
+// the provisioner:
+//
+//	err := provision.CountError("restart", Provisioner.Restart(app))
+func CountError(operation string, err error) error {
+	if err != nil {
+		provisionerErrors.Inc(operation)
+	}
+	return err
+}
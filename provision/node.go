@@ -0,0 +1,98 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package provision
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	// ErrNodeAlreadyExists is returned by NodeManager.AddNode when there's
+	// already a node with the given id.
+	ErrNodeAlreadyExists = errors.New("Node already exists.")
+
+	// ErrNodeNotFound is returned by NodeManager.RemoveNode when the node
+	// is not registered.
+	ErrNodeNotFound = errors.New("Node not found.")
+
+	// ErrNodeNotEmpty is returned by NodeManager.RemoveNode when there are
+	// units running in the node.
+	ErrNodeNotEmpty = errors.New("Node still has units.")
+)
+
+// NodeStatus is the health of a node, as seen by the last health check.
+type NodeStatus string
+
+const (
+	// NodeUnknown is the status of the nodes not checked yet.
+	NodeUnknown   = NodeStatus("")
+	NodeHealthy   = NodeStatus("healthy")
+	NodeUnhealthy = NodeStatus("unhealthy")
+)
+
+// Node is a host where a provisioner runs the units of apps.
+type Node struct {
+	ID      string
+	Address string
+	Pool    string            `json:",omitempty"`
+	Labels  map[string]string `json:",omitempty"`
+
+	// Status of the node, and the time and error of the last health
+	// check.
+	Status    NodeStatus
+	LastCheck time.Time `json:",omitempty"`
+	Error     string    `json:",omitempty"`
+}
+
+// NodeManager is a provisioner that manages the nodes where the units of apps
+// run. Units are not placed in nodes whose last health check failed.
+type NodeManager interface {
+	AddNode(n Node) error
+	RemoveNode(id string) error
+	ListNodes() ([]Node, error)
+
+	// CheckNodes checks the health of all nodes, updating their status.
+	// It's called periodically by the collector.
+	CheckNodes() error
+}
+
+var (
+	// ErrPoolAlreadyExists is returned by PoolManager.AddPool when there's
+	// already a pool with the given name.
+	ErrPoolAlreadyExists = errors.New("Pool already exists.")
+
+	// ErrPoolNotFound is returned by the methods of PoolManager, and by
+	// NodeManager.AddNode, when the pool doesn't exist.
+	ErrPoolNotFound = errors.New("Pool not found.")
+
+	// ErrPoolNotEmpty is returned by PoolManager.RemovePool when there are
+	// nodes in the pool.
+	ErrPoolNotEmpty = errors.New("Pool still has nodes.")
+)
+
+// Pool is a named set of nodes. The units of an app run only in the nodes of
+// its pool: the one chosen on the creation of the app, the first pool
+// assigned to one of its teams or the default pool.
+type Pool struct {
+	Name    string
+	Teams   []string `json:",omitempty"`
+	Default bool     `json:",omitempty"`
+}
+
+// PoolManager is a node manager that groups its nodes in pools, assigned to
+// teams.
+type PoolManager interface {
+	// AddPool adds a pool. Adding a default pool replaces the previous
+	// default pool.
+	AddPool(p Pool) error
+
+	// RemovePool removes a pool, if it has no nodes.
+	RemovePool(name string) error
+
+	ListPools() ([]Pool, error)
+	AddTeamsToPool(pool string, teams []string) error
+	RemoveTeamsFromPool(pool string, teams []string) error
+}
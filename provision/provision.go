@@ -65,6 +65,14 @@ type App interface {
 	// to the Unit `Type` field.
 	GetPlatform() string
 
+	// GetMemory returns the memory limit of each unit of the app, in
+	// megabytes. Zero means no limit.
+	GetMemory() int
+
+	// GetCpuShares returns the relative CPU weight of each unit of the
+	// app. Zero means the provisioner default.
+	GetCpuShares() int
+
 	ProvisionedUnits() []AppUnit
 	RemoveUnit(id string) error
 
@@ -79,6 +87,11 @@ type App interface {
 
 	// Ready marks the app as ready for deployment.
 	Ready() error
+
+	// HealthCheck returns the health check that new units of the app must
+	// pass before receiving requests, or nil if the app does not define
+	// one.
+	HealthCheck() (*HealthCheck, error)
 }
 
 type CNameManager interface {
@@ -86,6 +99,34 @@ type CNameManager interface {
 	UnsetCName(app App, cname string) error
 }
 
+// Rollbacker is a provisioner that builds an image in each deploy, and is
+// able to deploy a previously built image again, without rebuilding it.
+type Rollbacker interface {
+	// ImageDeploy works like Provisioner.Deploy, but returns the image
+	// built for the given version of the app.
+	ImageDeploy(app App, version string, w io.Writer) (string, error)
+
+	// Rollback deploys an image previously returned by ImageDeploy,
+	// logging progress in the given writer.
+	Rollback(app App, image string, w io.Writer) error
+}
+
+// PlatformManager is a provisioner that manages the base images of platforms.
+// The args of PlatformAdd and PlatformUpdate contain either the "dockerfile"
+// or the "image" of the platform.
+type PlatformManager interface {
+	// PlatformAdd builds the base image of a new platform, logging the
+	// build output in the given writer.
+	PlatformAdd(name string, args map[string]string, w io.Writer) error
+
+	// PlatformUpdate rebuilds the base image of the platform. Apps use
+	// the new image in their next deploy.
+	PlatformUpdate(name string, args map[string]string, w io.Writer) error
+
+	// PlatformRemove removes the base image of the platform.
+	PlatformRemove(name string) error
+}
+
 // Provisioner is the basic interface of this package.
 //
 // Any tsuru provisioner must implement this interface in order to provision
@@ -7,13 +7,12 @@ package queue
 import (
 	"bytes"
 	"encoding/gob"
-	"errors"
 	"fmt"
 	"github.com/globocom/config"
-	"github.com/globocom/tsuru/log"
 	"github.com/kr/beanstalk"
 	"io"
 	"regexp"
+	"strconv"
 	"sync"
 	"time"
 )
@@ -49,33 +48,34 @@ func (b *beanstalkdQ) Put(m *Message, delay time.Duration) error {
 	tube := beanstalk.Tube{Conn: conn, Name: b.name}
 	id, err := tube.Put(buf.Bytes(), 1, delay, ttr)
 	m.id = id
+	m.queue = b.name
 	return err
 }
 
 func (b *beanstalkdQ) Delete(m *Message) error {
 	if m.id == 0 {
-		return errors.New("Unknown message.")
+		return errUnknownMessage
 	}
 	conn, err := connection()
 	if err != nil {
 		return err
 	}
 	if err = conn.Delete(m.id); err != nil && notFoundRegexp.MatchString(err.Error()) {
-		return errors.New("Message not found.")
+		return errMessageNotFound
 	}
 	return err
 }
 
 func (b *beanstalkdQ) Release(m *Message, delay time.Duration) error {
 	if m.id == 0 {
-		return errors.New("Unknown message.")
+		return errUnknownMessage
 	}
 	conn, err := connection()
 	if err != nil {
 		return err
 	}
 	if err = conn.Release(m.id, 1, delay); err != nil && notFoundRegexp.MatchString(err.Error()) {
-		return errors.New("Message not found.")
+		return errMessageNotFound
 	}
 	return err
 }
@@ -83,28 +83,36 @@ func (b *beanstalkdQ) Release(m *Message, delay time.Duration) error {
 type beanstalkdFactory struct{}
 
 func (b beanstalkdFactory) Get(name string) (Q, error) {
+	useQueue(name, beanstalkdDepth)
 	return &beanstalkdQ{name: name}, nil
 }
 
 func (b beanstalkdFactory) Handler(f func(*Message), name ...string) (Handler, error) {
-	return &executor{
-		inner: func() {
-			if message, err := get(5e9, name...); err == nil {
-				log.Printf("Dispatching %q message to handler function.", message.Action)
-				go func(m *Message) {
-					f(m)
-					q := beanstalkdQ{}
-					if m.delete {
-						q.Delete(m)
-					} else {
-						q.Release(m, 0)
-					}
-				}(message)
-			} else {
-				log.Printf("Failed to get message from the queue: %s. Trying again...", err)
-			}
-		},
-	}, nil
+	for _, n := range name {
+		useQueue(n, beanstalkdDepth)
+	}
+	get := func(timeout time.Duration) (*Message, error) {
+		return get(timeout, name...)
+	}
+	return messageExecutor(get, b, f), nil
+}
+
+// beanstalkdDepth returns the number of ready messages in the tube.
+func beanstalkdDepth(name string) (int, error) {
+	conn, err := connection()
+	if err != nil {
+		return 0, err
+	}
+	tube := beanstalk.Tube{Conn: conn, Name: name}
+	stats, err := tube.Stats()
+	if err != nil {
+		if notFoundRegexp.MatchString(err.Error()) {
+			// The tube does not exist until a message is put in it.
+			return 0, nil
+		}
+		return 0, err
+	}
+	return strconv.Atoi(stats["current-jobs-ready"])
 }
 
 func connection() (*beanstalk.Conn, error) {
@@ -143,7 +151,7 @@ func get(timeout time.Duration, queues ...string) (*Message, error) {
 	id, body, err := ts.Reserve(timeout)
 	if err != nil {
 		if timeoutRegexp.MatchString(err.Error()) {
-			return nil, fmt.Errorf("Timed out waiting for message after %s.", timeout)
+			return nil, timeoutError(timeout)
 		}
 		return nil, err
 	}
@@ -154,5 +162,16 @@ func get(timeout time.Duration, queues ...string) (*Message, error) {
 		return nil, fmt.Errorf("Invalid message: %q", body)
 	}
 	msg.id = id
+	msg.queue = queues[0]
+	// The job counts its reservations, so deliveries whose handler died
+	// before finishing the message are counted too.
+	reserves := 1
+	if stats, err := conn.StatsJob(id); err == nil {
+		msg.queue = stats["tube"]
+		if n, err := strconv.Atoi(stats["reserves"]); err == nil && n > 0 {
+			reserves = n
+		}
+	}
+	msg.Attempts += reserves
 	return &msg, nil
 }
@@ -8,7 +8,10 @@ import (
 	"bytes"
 	"encoding/gob"
 	"github.com/globocom/config"
+	"github.com/globocom/tsuru/metrics"
 	"launchpad.net/gocheck"
+	"strconv"
+	"strings"
 	"sync/atomic"
 	"time"
 )
@@ -315,25 +318,77 @@ func (s *BeanstalkSuite) TestBeanstalkFactoryHandlerDeleteMessage(c *gocheck.C)
 	c.Assert(err, gocheck.NotNil)
 }
 
-func (s *BeanstalkSuite) TestBeanstalkFactoryHandlerReleaseMessage(c *gocheck.C) {
+func (s *BeanstalkSuite) TestBeanstalkFactoryHandlerRetryMessage(c *gocheck.C) {
+	SetRetryPolicy("retry-app", RetryPolicy{MaxRetries: 3, Backoff: 1e6})
 	var factory beanstalkdFactory
 	msg := Message{
-		Action: "create-app",
+		Action: "retry-app",
 		Args:   []string{"something"},
-		id:     837826742,
 	}
 	q := beanstalkdQ{name: "default"}
 	q.Put(&msg, 0)
-	defer q.Delete(&msg)
-	handler, err := factory.Handler(func(m *Message) { time.Sleep(1e3) }, "default")
+	defer q.Delete(&msg) // sanity
+	done := make(chan bool, 1)
+	handler, err := factory.Handler(func(m *Message) { done <- true }, "default")
 	c.Assert(err, gocheck.IsNil)
 	handler.(*executor).inner()
-	time.Sleep(1e6)
-	cn, err := connection()
-	c.Assert(err, gocheck.IsNil)
-	id, _, err := cn.Reserve(1e6)
+	<-done
+	retry, err := q.Get(1e9)
+	c.Assert(err, gocheck.IsNil)
+	defer q.Delete(retry)
+	c.Assert(retry.id, gocheck.Not(gocheck.Equals), msg.id)
+	c.Assert(retry.Action, gocheck.Equals, "retry-app")
+	c.Assert(retry.Args, gocheck.DeepEquals, []string{"something"})
+	c.Assert(retry.Attempts, gocheck.Equals, 2)
+}
+
+func sampleValue(c *gocheck.C, sample string) float64 {
+	var buf bytes.Buffer
+	err := metrics.Write(&buf)
+	c.Assert(err, gocheck.IsNil)
+	for _, line := range strings.Split(buf.String(), "\n") {
+		if strings.HasPrefix(line, sample+" ") {
+			value, err := strconv.ParseFloat(line[len(sample)+1:], 64)
+			c.Assert(err, gocheck.IsNil)
+			return value
+		}
+	}
+	return 0
+}
+
+func (s *BeanstalkSuite) TestBeanstalkFactoryHandlerCountsHandledMessages(c *gocheck.C) {
+	sample := `tsuru_queue_messages_handled_total{action="count-me",result="deleted"}`
+	before := sampleValue(c, sample)
+	var factory beanstalkdFactory
+	msg := Message{Action: "count-me"}
+	q := beanstalkdQ{name: "default"}
+	q.Put(&msg, 0)
+	defer q.Delete(&msg) // sanity
+	done := make(chan bool, 1)
+	handler, err := factory.Handler(func(m *Message) {
+		m.Delete()
+		done <- true
+	}, "default")
 	c.Assert(err, gocheck.IsNil)
-	c.Assert(id, gocheck.Equals, msg.id)
+	handler.(*executor).inner()
+	<-done
+	for i := 0; i < 100 && sampleValue(c, sample) == before; i++ {
+		time.Sleep(1e6)
+	}
+	c.Assert(sampleValue(c, sample), gocheck.Equals, before+1)
+}
+
+func (s *BeanstalkSuite) TestQueueDepth(c *gocheck.C) {
+	var factory beanstalkdFactory
+	q, err := factory.Get("tsuru-depth")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(sampleValue(c, `tsuru_queue_depth{queue="tsuru-depth"}`), gocheck.Equals, 0.0)
+	first, second := Message{Action: "a"}, Message{Action: "b"}
+	q.Put(&first, 0)
+	defer q.Delete(&first)
+	q.Put(&second, 0)
+	defer q.Delete(&second)
+	c.Assert(sampleValue(c, `tsuru_queue_depth{queue="tsuru-depth"}`), gocheck.Equals, 2.0)
 }
 
 func (s *BeanstalkSuite) TestBeanstalkFactoryIsInFactoriesMap(c *gocheck.C) {
@@ -0,0 +1,308 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package queue
+
+import (
+	"fmt"
+	"github.com/globocom/config"
+	"launchpad.net/gocheck"
+	"time"
+)
+
+// ConformanceSuite is the suite that every implementation of Q must pass.
+// Each backend registers an instance of the suite with its factory.
+type ConformanceSuite struct {
+	factory QFactory
+	// fixedVisibility indicates that the backend does not support the
+	// queue-visibility-timeout setting.
+	fixedVisibility bool
+	name            string
+	n               int
+}
+
+var _ = gocheck.Suite(&ConformanceSuite{factory: beanstalkdFactory{}, fixedVisibility: true})
+var _ = gocheck.Suite(&ConformanceSuite{factory: redisFactory{}})
+var _ = gocheck.Suite(&ConformanceSuite{factory: memoryFactory{}})
+
+func (s *ConformanceSuite) SetUpSuite(c *gocheck.C) {
+	config.Set("queue-server", "127.0.0.1:11300")
+	config.Set("redis-queue:host", "127.0.0.1")
+	config.Set("redis-queue:port", "6379")
+}
+
+// SetUpTest picks a new queue for each test, so messages left by a test don't
+// affect the others.
+func (s *ConformanceSuite) SetUpTest(c *gocheck.C) {
+	s.n++
+	s.name = fmt.Sprintf("conformance-%d-%d", time.Now().UnixNano(), s.n)
+}
+
+func (s *ConformanceSuite) queue(c *gocheck.C) Q {
+	q, err := s.factory.Get(s.name)
+	c.Assert(err, gocheck.IsNil)
+	return q
+}
+
+func (s *ConformanceSuite) TestPutAndGet(c *gocheck.C) {
+	q := s.queue(c)
+	msg := Message{Action: "regenerate-apprc", Args: []string{"myapp", "yourapp"}}
+	err := q.Put(&msg, 0)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(msg.id, gocheck.Not(gocheck.Equals), uint64(0))
+	defer q.Delete(&msg)
+	got, err := q.Get(1e9)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(got.id, gocheck.Equals, msg.id)
+	c.Assert(got.Action, gocheck.Equals, "regenerate-apprc")
+	c.Assert(got.Args, gocheck.DeepEquals, []string{"myapp", "yourapp"})
+}
+
+func (s *ConformanceSuite) TestGetInOrder(c *gocheck.C) {
+	q := s.queue(c)
+	for _, action := range []string{"first", "second", "third"} {
+		msg := Message{Action: action}
+		err := q.Put(&msg, 0)
+		c.Assert(err, gocheck.IsNil)
+		defer q.Delete(&msg)
+	}
+	for _, action := range []string{"first", "second", "third"} {
+		got, err := q.Get(1e9)
+		c.Assert(err, gocheck.IsNil)
+		c.Assert(got.Action, gocheck.Equals, action)
+	}
+}
+
+func (s *ConformanceSuite) TestGetFromEmptyQueue(c *gocheck.C) {
+	q := s.queue(c)
+	msg, err := q.Get(1e6)
+	c.Assert(msg, gocheck.IsNil)
+	c.Assert(err, gocheck.NotNil)
+	c.Assert(err.Error(), gocheck.Equals, "Timed out waiting for message after 1ms.")
+}
+
+func (s *ConformanceSuite) TestGetFromAnotherQueue(c *gocheck.C) {
+	q := s.queue(c)
+	msg := Message{Action: "do-something"}
+	err := q.Put(&msg, 0)
+	c.Assert(err, gocheck.IsNil)
+	defer q.Delete(&msg)
+	other, err := s.factory.Get(s.name + "-other")
+	c.Assert(err, gocheck.IsNil)
+	_, err = other.Get(1e6)
+	c.Assert(err, gocheck.NotNil)
+}
+
+func (s *ConformanceSuite) TestPutWithDelay(c *gocheck.C) {
+	q := s.queue(c)
+	msg := Message{Action: "do-something"}
+	err := q.Put(&msg, 1e9)
+	c.Assert(err, gocheck.IsNil)
+	defer q.Delete(&msg)
+	_, err = q.Get(1e6)
+	c.Assert(err, gocheck.NotNil)
+	got, err := q.Get(3e9)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(got.id, gocheck.Equals, msg.id)
+}
+
+func (s *ConformanceSuite) TestDelete(c *gocheck.C) {
+	q := s.queue(c)
+	msg := Message{Action: "do-something"}
+	err := q.Put(&msg, 0)
+	c.Assert(err, gocheck.IsNil)
+	got, err := q.Get(1e9)
+	c.Assert(err, gocheck.IsNil)
+	err = q.Delete(got)
+	c.Assert(err, gocheck.IsNil)
+	_, err = q.Get(1e6)
+	c.Assert(err, gocheck.NotNil)
+	err = q.Delete(got)
+	c.Assert(err, gocheck.NotNil)
+	c.Assert(err.Error(), gocheck.Equals, "Message not found.")
+}
+
+func (s *ConformanceSuite) TestDeleteReadyMessage(c *gocheck.C) {
+	q := s.queue(c)
+	msg := Message{Action: "do-something"}
+	err := q.Put(&msg, 0)
+	c.Assert(err, gocheck.IsNil)
+	err = q.Delete(&msg)
+	c.Assert(err, gocheck.IsNil)
+	_, err = q.Get(1e6)
+	c.Assert(err, gocheck.NotNil)
+}
+
+func (s *ConformanceSuite) TestDeleteMessageWithoutID(c *gocheck.C) {
+	q := s.queue(c)
+	err := q.Delete(&Message{Action: "do-something"})
+	c.Assert(err, gocheck.NotNil)
+	c.Assert(err.Error(), gocheck.Equals, "Unknown message.")
+}
+
+func (s *ConformanceSuite) TestRelease(c *gocheck.C) {
+	q := s.queue(c)
+	msg := Message{Action: "do-something"}
+	err := q.Put(&msg, 0)
+	c.Assert(err, gocheck.IsNil)
+	defer q.Delete(&msg)
+	got, err := q.Get(1e9)
+	c.Assert(err, gocheck.IsNil)
+	err = q.Release(got, 0)
+	c.Assert(err, gocheck.IsNil)
+	got, err = q.Get(1e9)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(got.id, gocheck.Equals, msg.id)
+}
+
+func (s *ConformanceSuite) TestGetCountsDeliveries(c *gocheck.C) {
+	q := s.queue(c)
+	msg := Message{Action: "do-something"}
+	err := q.Put(&msg, 0)
+	c.Assert(err, gocheck.IsNil)
+	defer q.Delete(&msg)
+	got, err := q.Get(1e9)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(got.Attempts, gocheck.Equals, 1)
+	err = q.Release(got, 0)
+	c.Assert(err, gocheck.IsNil)
+	got, err = q.Get(1e9)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(got.Attempts, gocheck.Equals, 2)
+}
+
+func (s *ConformanceSuite) TestReleaseWithDelay(c *gocheck.C) {
+	q := s.queue(c)
+	msg := Message{Action: "do-something"}
+	err := q.Put(&msg, 0)
+	c.Assert(err, gocheck.IsNil)
+	defer q.Delete(&msg)
+	got, err := q.Get(1e9)
+	c.Assert(err, gocheck.IsNil)
+	err = q.Release(got, 1e9)
+	c.Assert(err, gocheck.IsNil)
+	_, err = q.Get(1e6)
+	c.Assert(err, gocheck.NotNil)
+	got, err = q.Get(3e9)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(got.id, gocheck.Equals, msg.id)
+}
+
+func (s *ConformanceSuite) TestReleaseMessageNotReserved(c *gocheck.C) {
+	q := s.queue(c)
+	msg := Message{Action: "do-something"}
+	err := q.Put(&msg, 0)
+	c.Assert(err, gocheck.IsNil)
+	defer q.Delete(&msg)
+	err = q.Release(&msg, 0)
+	c.Assert(err, gocheck.NotNil)
+	c.Assert(err.Error(), gocheck.Equals, "Message not found.")
+}
+
+func (s *ConformanceSuite) TestReleaseMessageWithoutID(c *gocheck.C) {
+	q := s.queue(c)
+	err := q.Release(&Message{Action: "do-something"}, 0)
+	c.Assert(err, gocheck.NotNil)
+	c.Assert(err.Error(), gocheck.Equals, "Unknown message.")
+}
+
+func (s *ConformanceSuite) TestVisibilityTimeout(c *gocheck.C) {
+	if s.fixedVisibility {
+		c.Skip("the visibility timeout of this queue is fixed")
+	}
+	config.Set("queue-visibility-timeout", 1)
+	defer config.Unset("queue-visibility-timeout")
+	q := s.queue(c)
+	msg := Message{Action: "do-something"}
+	err := q.Put(&msg, 0)
+	c.Assert(err, gocheck.IsNil)
+	defer q.Delete(&msg)
+	_, err = q.Get(1e9)
+	c.Assert(err, gocheck.IsNil)
+	_, err = q.Get(1e6)
+	c.Assert(err, gocheck.NotNil)
+	got, err := q.Get(3e9)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(got.id, gocheck.Equals, msg.id)
+}
+
+func (s *ConformanceSuite) TestHandlerDeletesMessages(c *gocheck.C) {
+	q := s.queue(c)
+	msg := Message{Action: "do-something"}
+	err := q.Put(&msg, 0)
+	c.Assert(err, gocheck.IsNil)
+	defer q.Delete(&msg)
+	handled := make(chan *Message, 1)
+	handler, err := s.factory.Handler(func(m *Message) {
+		m.Delete()
+		handled <- m
+	}, s.name)
+	c.Assert(err, gocheck.IsNil)
+	handler.(*executor).inner()
+	got := <-handled
+	c.Assert(got.id, gocheck.Equals, msg.id)
+	time.Sleep(1e8)
+	_, err = q.Get(1e6)
+	c.Assert(err, gocheck.NotNil)
+}
+
+func (s *ConformanceSuite) TestHandlerRetriesMessages(c *gocheck.C) {
+	SetRetryPolicy("retry-something", RetryPolicy{MaxRetries: 3, Backoff: 1e6})
+	q := s.queue(c)
+	msg := Message{Action: "retry-something", Args: []string{"a"}}
+	err := q.Put(&msg, 0)
+	c.Assert(err, gocheck.IsNil)
+	defer q.Delete(&msg)
+	handled := make(chan int, 1)
+	handler, err := s.factory.Handler(func(m *Message) { handled <- m.Attempts }, s.name)
+	c.Assert(err, gocheck.IsNil)
+	handler.(*executor).inner()
+	c.Assert(<-handled, gocheck.Equals, 1)
+	got, err := q.Get(2e9)
+	c.Assert(err, gocheck.IsNil)
+	defer q.Delete(got)
+	c.Assert(got.Action, gocheck.Equals, "retry-something")
+	c.Assert(got.Args, gocheck.DeepEquals, []string{"a"})
+	c.Assert(got.Attempts, gocheck.Equals, 2)
+}
+
+func (s *ConformanceSuite) TestHandlerRetriesMessagesWhoseHandlerPanics(c *gocheck.C) {
+	SetRetryPolicy("panic-something", RetryPolicy{MaxRetries: 3, Backoff: 1e6})
+	q := s.queue(c)
+	msg := Message{Action: "panic-something"}
+	err := q.Put(&msg, 0)
+	c.Assert(err, gocheck.IsNil)
+	defer q.Delete(&msg)
+	handler, err := s.factory.Handler(func(m *Message) {
+		m.Delete()
+		panic("something went wrong")
+	}, s.name)
+	c.Assert(err, gocheck.IsNil)
+	exec := handler.(*executor)
+	exec.inner()
+	exec.handling.Wait()
+	got, err := q.Get(2e9)
+	c.Assert(err, gocheck.IsNil)
+	defer q.Delete(got)
+	c.Assert(got.Action, gocheck.Equals, "panic-something")
+	c.Assert(got.Attempts, gocheck.Equals, 2)
+}
+
+func (s *ConformanceSuite) TestHandlerGetsFromManyQueues(c *gocheck.C) {
+	other, err := s.factory.Get(s.name + "-other")
+	c.Assert(err, gocheck.IsNil)
+	msg := Message{Action: "do-something"}
+	err = other.Put(&msg, 0)
+	c.Assert(err, gocheck.IsNil)
+	defer other.Delete(&msg)
+	handled := make(chan *Message, 1)
+	handler, err := s.factory.Handler(func(m *Message) {
+		m.Delete()
+		handled <- m
+	}, s.name, s.name+"-other")
+	c.Assert(err, gocheck.IsNil)
+	handler.(*executor).inner()
+	got := <-handled
+	c.Assert(got.id, gocheck.Equals, msg.id)
+}
@@ -0,0 +1,97 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package queue
+
+import (
+	"errors"
+	"github.com/globocom/tsuru/db"
+	"labix.org/v2/mgo/bson"
+	"time"
+)
+
+// ErrDeadLetterNotFound is returned when replaying a message that is not in
+// the dead-letter queue.
+var ErrDeadLetterNotFound = errors.New("Message not found in the dead-letter queue.")
+
+// DeadLetter is a message that exceeded the maximum number of retries of its
+// action. Dead letters are stored in the database until an admin replays
+// them.
+type DeadLetter struct {
+	ID       bson.ObjectId `bson:"_id"`
+	Queue    string
+	Action   string
+	Args     []string
+	Attempts int
+	Date     time.Time
+}
+
+// deadLetter moves the message to the dead-letter queue.
+func deadLetter(m *Message) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	l := DeadLetter{
+		ID:       bson.NewObjectId(),
+		Queue:    m.queue,
+		Action:   m.Action,
+		Args:     m.Args,
+		Attempts: m.Attempts,
+		Date:     time.Now().In(time.UTC),
+	}
+	return conn.DeadLetters().Insert(l)
+}
+
+// DeadLetters returns the messages in the dead-letter queue, the most recent
+// first. If queue is not empty, only messages from that queue are returned.
+func DeadLetters(queue string) ([]DeadLetter, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	query := bson.M{}
+	if queue != "" {
+		query["queue"] = queue
+	}
+	var letters []DeadLetter
+	err = conn.DeadLetters().Find(query).Sort("-date").All(&letters)
+	if err != nil {
+		return nil, err
+	}
+	return letters, nil
+}
+
+// ReplayDeadLetter puts the message with the given id back in its queue,
+// with the attempts reset, and removes it from the dead-letter queue.
+func ReplayDeadLetter(id string) (*DeadLetter, error) {
+	if !bson.IsObjectIdHex(id) {
+		return nil, ErrDeadLetterNotFound
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	var l DeadLetter
+	err = conn.DeadLetters().FindId(bson.ObjectIdHex(id)).One(&l)
+	if err != nil {
+		return nil, ErrDeadLetterNotFound
+	}
+	factory, err := Factory()
+	if err != nil {
+		return nil, err
+	}
+	q, err := factory.Get(l.Queue)
+	if err != nil {
+		return nil, err
+	}
+	err = q.Put(&Message{Action: l.Action, Args: l.Args}, 0)
+	if err != nil {
+		return nil, err
+	}
+	return &l, conn.DeadLetters().RemoveId(l.ID)
+}
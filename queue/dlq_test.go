@@ -0,0 +1,110 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package queue
+
+import (
+	"github.com/globocom/config"
+	"github.com/globocom/tsuru/db"
+	"launchpad.net/gocheck"
+	"time"
+)
+
+type DeadLetterSuite struct{}
+
+var _ = gocheck.Suite(&DeadLetterSuite{})
+
+func (s *DeadLetterSuite) SetUpSuite(c *gocheck.C) {
+	config.Set("database:url", "127.0.0.1:27017")
+	config.Set("database:name", "tsuru_queue_test")
+}
+
+func (s *DeadLetterSuite) TearDownSuite(c *gocheck.C) {
+	conn, err := db.Conn()
+	c.Assert(err, gocheck.IsNil)
+	defer conn.Close()
+	conn.Apps().Database.DropDatabase()
+}
+
+func (s *DeadLetterSuite) TearDownTest(c *gocheck.C) {
+	conn, err := db.Conn()
+	c.Assert(err, gocheck.IsNil)
+	defer conn.Close()
+	conn.DeadLetters().RemoveAll(nil)
+}
+
+func (s *DeadLetterSuite) TestHandlerMovesMessageToDeadLetterQueue(c *gocheck.C) {
+	SetRetryPolicy("poison", RetryPolicy{MaxRetries: 1, Backoff: 1e6})
+	var factory memoryFactory
+	q, err := factory.Get("dlq-handler")
+	c.Assert(err, gocheck.IsNil)
+	err = q.Put(&Message{Action: "poison", Args: []string{"x"}}, 0)
+	c.Assert(err, gocheck.IsNil)
+	handled := make(chan int, 2)
+	handler, err := factory.Handler(func(m *Message) { handled <- m.Attempts }, "dlq-handler")
+	c.Assert(err, gocheck.IsNil)
+	exec := handler.(*executor)
+	exec.inner()
+	c.Assert(<-handled, gocheck.Equals, 1)
+	exec.inner()
+	c.Assert(<-handled, gocheck.Equals, 2)
+	var letters []DeadLetter
+	for i := 0; i < 100 && len(letters) == 0; i++ {
+		time.Sleep(1e6)
+		letters, err = DeadLetters("dlq-handler")
+		c.Assert(err, gocheck.IsNil)
+	}
+	c.Assert(letters, gocheck.HasLen, 1)
+	c.Assert(letters[0].Queue, gocheck.Equals, "dlq-handler")
+	c.Assert(letters[0].Action, gocheck.Equals, "poison")
+	c.Assert(letters[0].Args, gocheck.DeepEquals, []string{"x"})
+	c.Assert(letters[0].Attempts, gocheck.Equals, 2)
+	_, err = q.Get(1e8)
+	c.Assert(err, gocheck.NotNil)
+}
+
+func (s *DeadLetterSuite) TestDeadLetters(c *gocheck.C) {
+	err := deadLetter(&Message{Action: "first", Attempts: 3, queue: "tsuru-app"})
+	c.Assert(err, gocheck.IsNil)
+	err = deadLetter(&Message{Action: "second", Attempts: 3, queue: "other"})
+	c.Assert(err, gocheck.IsNil)
+	letters, err := DeadLetters("")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(letters, gocheck.HasLen, 2)
+	letters, err = DeadLetters("tsuru-app")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(letters, gocheck.HasLen, 1)
+	c.Assert(letters[0].Action, gocheck.Equals, "first")
+}
+
+func (s *DeadLetterSuite) TestReplayDeadLetter(c *gocheck.C) {
+	config.Set("queue", "memory")
+	defer config.Unset("queue")
+	err := deadLetter(&Message{Action: "replay-me", Args: []string{"a"}, Attempts: 11, queue: "dlq-replay"})
+	c.Assert(err, gocheck.IsNil)
+	letters, err := DeadLetters("dlq-replay")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(letters, gocheck.HasLen, 1)
+	replayed, err := ReplayDeadLetter(letters[0].ID.Hex())
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(replayed.Action, gocheck.Equals, "replay-me")
+	q, err := memoryFactory{}.Get("dlq-replay")
+	c.Assert(err, gocheck.IsNil)
+	msg, err := q.Get(1e6)
+	c.Assert(err, gocheck.IsNil)
+	defer q.Delete(msg)
+	c.Assert(msg.Action, gocheck.Equals, "replay-me")
+	c.Assert(msg.Args, gocheck.DeepEquals, []string{"a"})
+	c.Assert(msg.Attempts, gocheck.Equals, 1)
+	letters, err = DeadLetters("dlq-replay")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(letters, gocheck.HasLen, 0)
+}
+
+func (s *DeadLetterSuite) TestReplayDeadLetterNotFound(c *gocheck.C) {
+	_, err := ReplayDeadLetter("520a1a5d3ba5c2a2b6000001")
+	c.Assert(err, gocheck.Equals, ErrDeadLetterNotFound)
+	_, err = ReplayDeadLetter("invalid")
+	c.Assert(err, gocheck.Equals, ErrDeadLetterNotFound)
+}
@@ -8,6 +8,7 @@ import (
 	"crypto/rand"
 	"errors"
 	"fmt"
+	"github.com/globocom/tsuru/log"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -25,6 +26,9 @@ type executor struct {
 	inner func()
 	state int32
 	id    string
+	// handling tracks the messages being handled by goroutines started by
+	// the inner function.
+	handling sync.WaitGroup
 }
 
 func (e *executor) Start() {
@@ -42,11 +46,13 @@ func (e *executor) Stop() error {
 	return nil
 }
 
-// Wait blocks until the handler is stopped.
+// Wait blocks until the handler is stopped, and the messages it got from the
+// queue are handled.
 func (e *executor) Wait() {
 	for atomic.LoadInt32(&e.state) != stopped {
 		time.Sleep(1e3)
 	}
+	e.handling.Wait()
 }
 
 func (e *executor) loop() {
@@ -56,6 +62,78 @@ func (e *executor) loop() {
 	atomic.StoreInt32(&e.state, stopped)
 }
 
+// messageExecutor returns an executor that gets messages with the given
+// function and calls f with each message in a new goroutine. After f returns,
+// the message is finished in the queue of the factory where it came from.
+func messageExecutor(get func(time.Duration) (*Message, error), factory QFactory, f func(*Message)) *executor {
+	e := &executor{}
+	e.inner = func() {
+		if message, err := get(5e9); err == nil {
+			log.Printf("Dispatching %q message to handler function.", message.Action)
+			e.handling.Add(1)
+			go func(m *Message) {
+				defer e.handling.Done()
+				call(f, m)
+				finish(factory, m)
+			}(message)
+		} else {
+			log.Printf("Failed to get message from the queue: %s. Trying again...", err)
+		}
+	}
+	return e
+}
+
+// call calls the handler with the message. If the handler panics, the panic is
+// recovered and the message is finished as a failure, so it's retried or moved
+// to the dead-letter queue.
+func call(f func(*Message), m *Message) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Errorf("The handler of the %q message panicked: %v", m.Action, r)
+			m.delete = false
+		}
+	}()
+	f(m)
+}
+
+// finish deletes the message, if the handler called Delete on it. Otherwise
+// the message is put back in the queue, to be retried after the backoff of
+// its action, or moved to the dead-letter queue when its retries are over.
+func finish(factory QFactory, m *Message) {
+	q, err := factory.Get(m.queue)
+	if err != nil {
+		log.Errorf("Failed to get the queue %q: %s", m.queue, err)
+		return
+	}
+	if m.delete {
+		q.Delete(m)
+		handledMessages.Inc(m.Action, "deleted")
+		return
+	}
+	policy := retryPolicy(m.Action)
+	if policy.exhausted(m.Attempts) {
+		if err := deadLetter(m); err != nil {
+			log.Errorf("Failed to move the %q message to the dead-letter queue: %s", m.Action, err)
+			q.Release(m, policy.MaxBackoff)
+			handledMessages.Inc(m.Action, "released")
+			return
+		}
+		log.Warnf("Moved the %q message to the dead-letter queue after %d attempts.", m.Action, m.Attempts)
+		q.Delete(m)
+		handledMessages.Inc(m.Action, "dead-lettered")
+		return
+	}
+	retry := Message{Action: m.Action, Args: m.Args, Attempts: m.Attempts}
+	if err := q.Put(&retry, policy.delay(m.Attempts)); err != nil {
+		log.Errorf("Failed to retry the %q message: %s", m.Action, err)
+		q.Release(m, 0)
+		handledMessages.Inc(m.Action, "released")
+		return
+	}
+	q.Delete(m)
+	handledMessages.Inc(m.Action, "retried")
+}
+
 // registry stores references to all running handlers.
 type registry struct {
 	mut      sync.Mutex
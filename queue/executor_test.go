@@ -51,3 +51,35 @@ func (s *ExecutorSuite) TestStopNotRunningExecutor(c *gocheck.C) {
 func (s *ExecutorSuite) TestExecutorImplementsHandler(c *gocheck.C) {
 	var _ Handler = &executor{}
 }
+
+func (s *ExecutorSuite) TestPreemptWaitsForMessagesBeingHandled(c *gocheck.C) {
+	var factory memoryFactory
+	q, err := factory.Get("preempt-handling")
+	c.Assert(err, gocheck.IsNil)
+	err = q.Put(&Message{Action: "slow"}, 0)
+	c.Assert(err, gocheck.IsNil)
+	started := make(chan bool)
+	finish := make(chan bool)
+	handler, err := factory.Handler(func(m *Message) {
+		started <- true
+		<-finish
+		m.Delete()
+	}, "preempt-handling")
+	c.Assert(err, gocheck.IsNil)
+	handler.Start()
+	<-started
+	preempted := make(chan bool)
+	go func() {
+		Preempt()
+		preempted <- true
+	}()
+	select {
+	case <-preempted:
+		c.Fatal("Preempt returned before the message was handled.")
+	case <-time.After(1e8):
+	}
+	finish <- true
+	<-preempted
+	_, err = q.Get(1e6)
+	c.Assert(err, gocheck.NotNil)
+}
@@ -0,0 +1,255 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package queue
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// memoryEntry is a message stored in the memory queue. Messages that are not
+// ready, either delayed or reserved, become ready at the given time.
+type memoryEntry struct {
+	msg      Message
+	queue    string
+	ready    bool
+	reserved bool
+	readyAt  time.Time
+	// deliveries is the number of times the message was reserved by get.
+	deliveries int
+}
+
+type byReadyAt []*memoryEntry
+
+func (l byReadyAt) Len() int      { return len(l) }
+func (l byReadyAt) Swap(i, j int) { l[i], l[j] = l[j], l[i] }
+func (l byReadyAt) Less(i, j int) bool {
+	if l[i].readyAt.Equal(l[j].readyAt) {
+		return l[i].msg.id < l[j].msg.id
+	}
+	return l[i].readyAt.Before(l[j].readyAt)
+}
+
+// memoryBroker holds the messages of all memory queues in the process.
+type memoryBroker struct {
+	mut     sync.Mutex
+	lastID  uint64
+	entries map[uint64]*memoryEntry
+	// ready holds the ids of ready messages of each queue, in order.
+	ready map[string][]uint64
+	// changed is closed, and replaced, whenever a message becomes ready,
+	// waking up every Get.
+	changed chan struct{}
+}
+
+var broker = newMemoryBroker()
+
+func newMemoryBroker() *memoryBroker {
+	return &memoryBroker{
+		entries: make(map[uint64]*memoryEntry),
+		ready:   make(map[string][]uint64),
+		changed: make(chan struct{}),
+	}
+}
+
+// copyMessage returns a copy of the message, that doesn't share the
+// arguments with it.
+func copyMessage(m *Message) Message {
+	c := *m
+	c.Args = append([]string(nil), m.Args...)
+	c.delete = false
+	return c
+}
+
+// schedule makes the entry ready after the given delay. It must be called
+// with the lock held.
+func (b *memoryBroker) schedule(e *memoryEntry, delay time.Duration) {
+	e.reserved = false
+	if delay > 0 {
+		e.ready = false
+		e.readyAt = time.Now().Add(delay)
+		return
+	}
+	e.ready = true
+	b.ready[e.queue] = append(b.ready[e.queue], e.msg.id)
+	close(b.changed)
+	b.changed = make(chan struct{})
+}
+
+// promote makes ready the entries of the given queues whose time has come,
+// returning when the next entry becomes ready, or the zero time if there's
+// none. It must be called with the lock held.
+func (b *memoryBroker) promote(now time.Time, queues []string) time.Time {
+	var (
+		next time.Time
+		due  []*memoryEntry
+	)
+	for _, e := range b.entries {
+		if e.ready || !contains(queues, e.queue) {
+			continue
+		}
+		if !e.readyAt.After(now) {
+			due = append(due, e)
+		} else if next.IsZero() || e.readyAt.Before(next) {
+			next = e.readyAt
+		}
+	}
+	sort.Sort(byReadyAt(due))
+	for _, e := range due {
+		e.ready = true
+		e.reserved = false
+		b.ready[e.queue] = append(b.ready[e.queue], e.msg.id)
+	}
+	return next
+}
+
+func contains(queues []string, name string) bool {
+	for _, q := range queues {
+		if q == name {
+			return true
+		}
+	}
+	return false
+}
+
+// removeReady removes the id from the ready messages of the queue. It must be
+// called with the lock held.
+func (b *memoryBroker) removeReady(queue string, id uint64) {
+	ids := b.ready[queue]
+	for i, readyID := range ids {
+		if readyID == id {
+			b.ready[queue] = append(ids[:i], ids[i+1:]...)
+			return
+		}
+	}
+}
+
+func (b *memoryBroker) put(queue string, m *Message, delay time.Duration) {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+	b.lastID++
+	m.id = b.lastID
+	m.queue = queue
+	e := &memoryEntry{msg: copyMessage(m), queue: queue}
+	b.entries[m.id] = e
+	b.schedule(e, delay)
+}
+
+// get returns the first ready message in the given queues, waiting for it up
+// to the given timeout. The message is reserved until it's deleted or
+// released, or until the visibility timeout expires.
+func (b *memoryBroker) get(timeout time.Duration, queues ...string) (*Message, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		b.mut.Lock()
+		now := time.Now()
+		next := b.promote(now, queues)
+		for _, name := range queues {
+			if ids := b.ready[name]; len(ids) > 0 {
+				e := b.entries[ids[0]]
+				b.ready[name] = ids[1:]
+				e.ready = false
+				e.reserved = true
+				e.readyAt = now.Add(visibilityTimeout())
+				e.deliveries++
+				m := copyMessage(&e.msg)
+				m.Attempts += e.deliveries
+				b.mut.Unlock()
+				return &m, nil
+			}
+		}
+		changed := b.changed
+		b.mut.Unlock()
+		if !now.Before(deadline) {
+			return nil, timeoutError(timeout)
+		}
+		if next.IsZero() || next.After(deadline) {
+			next = deadline
+		}
+		timer := time.NewTimer(next.Sub(now))
+		select {
+		case <-changed:
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+}
+
+func (b *memoryBroker) delete(m *Message) error {
+	if m.id == 0 {
+		return errUnknownMessage
+	}
+	b.mut.Lock()
+	defer b.mut.Unlock()
+	e, ok := b.entries[m.id]
+	if !ok {
+		return errMessageNotFound
+	}
+	if e.ready {
+		b.removeReady(e.queue, e.msg.id)
+	}
+	delete(b.entries, m.id)
+	return nil
+}
+
+func (b *memoryBroker) release(m *Message, delay time.Duration) error {
+	if m.id == 0 {
+		return errUnknownMessage
+	}
+	b.mut.Lock()
+	defer b.mut.Unlock()
+	e, ok := b.entries[m.id]
+	if !ok || !e.reserved {
+		return errMessageNotFound
+	}
+	b.schedule(e, delay)
+	return nil
+}
+
+func (b *memoryBroker) depth(queue string) (int, error) {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+	b.promote(time.Now(), []string{queue})
+	return len(b.ready[queue]), nil
+}
+
+type memoryQ struct {
+	name string
+}
+
+func (q *memoryQ) Get(timeout time.Duration) (*Message, error) {
+	return broker.get(timeout, q.name)
+}
+
+func (q *memoryQ) Put(m *Message, delay time.Duration) error {
+	broker.put(q.name, m, delay)
+	return nil
+}
+
+func (q *memoryQ) Delete(m *Message) error {
+	return broker.delete(m)
+}
+
+func (q *memoryQ) Release(m *Message, delay time.Duration) error {
+	return broker.release(m, delay)
+}
+
+type memoryFactory struct{}
+
+func (memoryFactory) Get(name string) (Q, error) {
+	useQueue(name, broker.depth)
+	return &memoryQ{name: name}, nil
+}
+
+func (m memoryFactory) Handler(f func(*Message), name ...string) (Handler, error) {
+	for _, n := range name {
+		useQueue(n, broker.depth)
+	}
+	get := func(timeout time.Duration) (*Message, error) {
+		return broker.get(timeout, name...)
+	}
+	return messageExecutor(get, m, f), nil
+}
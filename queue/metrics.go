@@ -0,0 +1,59 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package queue
+
+import (
+	"github.com/globocom/tsuru/log"
+	"github.com/globocom/tsuru/metrics"
+	"sync"
+)
+
+var (
+	queueDepth = metrics.NewGauge(
+		"tsuru_queue_depth",
+		"Number of messages ready in the queue.",
+		"queue",
+	)
+	handledMessages = metrics.NewCounter(
+		"tsuru_queue_messages_handled_total",
+		"Number of messages handled, by action and result: deleted, retried, dead-lettered or released back to the queue.",
+		"action", "result",
+	)
+)
+
+// usedQueues holds the queues used by this process, along with the functions
+// that return their depth, which is exposed in the metrics.
+var usedQueues = struct {
+	sync.Mutex
+	depth map[string]func(string) (int, error)
+}{depth: make(map[string]func(string) (int, error))}
+
+func init() {
+	metrics.OnCollect(collectDepth)
+}
+
+func useQueue(name string, depth func(string) (int, error)) {
+	usedQueues.Lock()
+	usedQueues.depth[name] = depth
+	usedQueues.Unlock()
+}
+
+// collectDepth updates the depth of the queues used by this process.
+func collectDepth() {
+	usedQueues.Lock()
+	depths := make(map[string]func(string) (int, error), len(usedQueues.depth))
+	for name, depth := range usedQueues.depth {
+		depths[name] = depth
+	}
+	usedQueues.Unlock()
+	for name, depth := range depths {
+		n, err := depth(name)
+		if err != nil {
+			log.Warnf("Failed to get the depth of the queue %s: %s", name, err)
+			continue
+		}
+		queueDepth.Set(float64(n), name)
+	}
+}
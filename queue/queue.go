@@ -14,11 +14,17 @@
 package queue
 
 import (
+	"errors"
 	"fmt"
 	"github.com/globocom/config"
 	"time"
 )
 
+var (
+	errUnknownMessage  = errors.New("Unknown message.")
+	errMessageNotFound = errors.New("Message not found.")
+)
+
 // Q represents a queue. A queue is a type that supports the set of
 // operations described by this interface.
 type Q interface {
@@ -71,6 +77,8 @@ type QFactory interface {
 
 var factories = map[string]QFactory{
 	"beanstalkd": beanstalkdFactory{},
+	"redis":      redisFactory{},
+	"memory":     memoryFactory{},
 }
 
 // Register registers a new queue factory. This is how one would add a new
@@ -83,6 +91,10 @@ func Register(name string, factory QFactory) {
 // configuration to find the currently used queue system (for example,
 // beanstalkd) and returns an instance of the configured system, if it's
 // registered. Otherwise it will return an error.
+//
+// The queues available are "beanstalkd" (the default), "redis" and "memory".
+// The memory queue lives in the process, and is suited only for installs that
+// run the API server and the queue handlers in a single process.
 func Factory() (QFactory, error) {
 	name, err := config.GetString("queue")
 	if err != nil {
@@ -101,14 +113,37 @@ func Factory() (QFactory, error) {
 //
 // For example, the action "regenerate apprc" could receive one argument: the
 // name of the app for which the apprc file will be regenerate.
+//
+// Attempts is the number of times the message was delivered by Get. It's
+// counted by the queue server, so deliveries whose handler died before
+// finishing the message count too. A message that is not deleted by the
+// handler is retried, according to the retry policy of its action (see
+// SetRetryPolicy).
 type Message struct {
-	Action string
-	Args   []string
-	id     uint64
-	delete bool
+	Action   string
+	Args     []string
+	Attempts int
+	id       uint64
+	queue    string
+	delete   bool
 }
 
 // Delete deletes the message from the queue.
 func (m *Message) Delete() {
 	m.delete = true
 }
+
+// visibilityTimeout returns how long a message stays reserved after Get,
+// before it's delivered again, unless it's deleted or released. It's defined
+// by the setting queue-visibility-timeout, in seconds, and defaults to the
+// time to run of beanstalkd messages. The beanstalkd queue ignores it.
+func visibilityTimeout() time.Duration {
+	if t, err := config.GetInt("queue-visibility-timeout"); err == nil && t > 0 {
+		return time.Duration(t) * time.Second
+	}
+	return ttr
+}
+
+func timeoutError(timeout time.Duration) error {
+	return fmt.Errorf("Timed out waiting for message after %s.", timeout)
+}
@@ -34,6 +34,24 @@ func (s *S) TestFactory(c *gocheck.C) {
 	c.Assert(ok, gocheck.Equals, true)
 }
 
+func (s *S) TestFactoryRedis(c *gocheck.C) {
+	config.Set("queue", "redis")
+	defer config.Unset("queue")
+	f, err := Factory()
+	c.Assert(err, gocheck.IsNil)
+	_, ok := f.(redisFactory)
+	c.Assert(ok, gocheck.Equals, true)
+}
+
+func (s *S) TestFactoryMemory(c *gocheck.C) {
+	config.Set("queue", "memory")
+	defer config.Unset("queue")
+	f, err := Factory()
+	c.Assert(err, gocheck.IsNil)
+	_, ok := f.(memoryFactory)
+	c.Assert(ok, gocheck.Equals, true)
+}
+
 func (s *S) TestFactoryConfigUndefined(c *gocheck.C) {
 	f, err := Factory()
 	c.Assert(err, gocheck.IsNil)
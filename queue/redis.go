@@ -0,0 +1,306 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package queue
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"github.com/garyburd/redigo/redis"
+	"github.com/globocom/config"
+	"sync"
+	"time"
+)
+
+// The redis queue stores each message in a hash, by id, and keeps the ids of
+// ready messages in a list. The number of deliveries of each message is kept
+// in another hash. Delayed messages and messages reserved by Get are
+// kept in sorted sets, scored by the time they become ready again, and are
+// moved back to the list by Get.
+//
+// All operations that touch more than one key run in Lua scripts, so they're
+// atomic.
+
+var (
+	redisPool *redis.Pool
+	redisMut  sync.Mutex
+)
+
+// redisPollInterval is the maximum interval between two attempts of Get to
+// find a ready message.
+const redisPollInterval = 100 * time.Millisecond
+
+var redisPutScript = redis.NewScript(6, `
+local id = redis.call("incr", KEYS[6])
+redis.call("hset", KEYS[4], id, ARGV[1])
+if tonumber(ARGV[2]) > 0 then
+	redis.call("zadd", KEYS[2], ARGV[2], id)
+else
+	redis.call("lpush", KEYS[1], id)
+end
+return id
+`)
+
+var redisGetScript = redis.NewScript(5, `
+local function promote(set)
+	local ids = redis.call("zrangebyscore", set, "-inf", ARGV[1])
+	for _, id in ipairs(ids) do
+		redis.call("zrem", set, id)
+		redis.call("lpush", KEYS[1], id)
+	end
+end
+promote(KEYS[2])
+promote(KEYS[3])
+local id = redis.call("rpop", KEYS[1])
+if not id then
+	return false
+end
+local body = redis.call("hget", KEYS[4], id)
+if not body then
+	return false
+end
+redis.call("zadd", KEYS[3], ARGV[2], id)
+local deliveries = redis.call("hincrby", KEYS[5], id, 1)
+return {id, body, deliveries}
+`)
+
+var redisDeleteScript = redis.NewScript(5, `
+if redis.call("hdel", KEYS[4], ARGV[1]) == 0 then
+	return 0
+end
+redis.call("hdel", KEYS[5], ARGV[1])
+redis.call("lrem", KEYS[1], 0, ARGV[1])
+redis.call("zrem", KEYS[2], ARGV[1])
+redis.call("zrem", KEYS[3], ARGV[1])
+return 1
+`)
+
+var redisReleaseScript = redis.NewScript(3, `
+if redis.call("zrem", KEYS[3], ARGV[1]) == 0 then
+	return 0
+end
+if tonumber(ARGV[2]) > 0 then
+	redis.call("zadd", KEYS[2], ARGV[2], ARGV[1])
+else
+	redis.call("lpush", KEYS[1], ARGV[1])
+end
+return 1
+`)
+
+// redisConn returns a connection from the pool, which is created in the
+// first call, using the settings redis-queue:host, redis-queue:port,
+// redis-queue:password and redis-queue:db.
+func redisConn() redis.Conn {
+	redisMut.Lock()
+	defer redisMut.Unlock()
+	if redisPool == nil {
+		host, err := config.GetString("redis-queue:host")
+		if err != nil {
+			host = "localhost"
+		}
+		port, err := config.GetString("redis-queue:port")
+		if err != nil {
+			port = "6379"
+		}
+		password, _ := config.GetString("redis-queue:password")
+		db, _ := config.GetInt("redis-queue:db")
+		addr := host + ":" + port
+		redisPool = &redis.Pool{
+			MaxIdle:     10,
+			IdleTimeout: 5 * time.Minute,
+			Dial: func() (redis.Conn, error) {
+				conn, err := redis.Dial("tcp", addr)
+				if err != nil {
+					return nil, err
+				}
+				if password != "" {
+					if _, err := conn.Do("AUTH", password); err != nil {
+						conn.Close()
+						return nil, err
+					}
+				}
+				if db != 0 {
+					if _, err := conn.Do("SELECT", db); err != nil {
+						conn.Close()
+						return nil, err
+					}
+				}
+				return conn, nil
+			},
+		}
+	}
+	return redisPool.Get()
+}
+
+// redisKeys returns the keys of the queue: the list of ready messages, the
+// sets of delayed and reserved messages, the hash of messages and the hash of
+// deliveries.
+func redisKeys(name string) []interface{} {
+	prefix := "tsuru:queue:" + name
+	return []interface{}{prefix, prefix + ":delayed", prefix + ":reserved", prefix + ":messages", prefix + ":deliveries"}
+}
+
+// redisTime returns the time after the given duration, in milliseconds, as
+// used in the scores of the sets.
+func redisTime(d time.Duration) int64 {
+	return time.Now().Add(d).UnixNano() / int64(time.Millisecond)
+}
+
+type redisQ struct {
+	name string
+}
+
+// queueName returns the name of the queue of the message, which is the
+// receiver, unless the message comes from another queue of the same factory.
+func (q *redisQ) queueName(m *Message) string {
+	if m.queue != "" {
+		return m.queue
+	}
+	return q.name
+}
+
+func (q *redisQ) Get(timeout time.Duration) (*Message, error) {
+	return redisGet(timeout, q.name)
+}
+
+func (q *redisQ) Put(m *Message, delay time.Duration) error {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(m); err != nil {
+		return err
+	}
+	var readyAt int64
+	if delay > 0 {
+		readyAt = redisTime(delay)
+	}
+	conn := redisConn()
+	defer conn.Close()
+	args := append(redisKeys(q.name), "tsuru:queue:ids", buf.Bytes(), readyAt)
+	id, err := redis.Int64(redisPutScript.Do(conn, args...))
+	if err != nil {
+		return err
+	}
+	m.id = uint64(id)
+	m.queue = q.name
+	return nil
+}
+
+func (q *redisQ) Delete(m *Message) error {
+	if m.id == 0 {
+		return errUnknownMessage
+	}
+	conn := redisConn()
+	defer conn.Close()
+	args := append(redisKeys(q.queueName(m)), m.id)
+	deleted, err := redis.Int(redisDeleteScript.Do(conn, args...))
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return errMessageNotFound
+	}
+	return nil
+}
+
+func (q *redisQ) Release(m *Message, delay time.Duration) error {
+	if m.id == 0 {
+		return errUnknownMessage
+	}
+	var readyAt int64
+	if delay > 0 {
+		readyAt = redisTime(delay)
+	}
+	conn := redisConn()
+	defer conn.Close()
+	args := append(redisKeys(q.queueName(m))[:3], m.id, readyAt)
+	released, err := redis.Int(redisReleaseScript.Do(conn, args...))
+	if err != nil {
+		return err
+	}
+	if released == 0 {
+		return errMessageNotFound
+	}
+	return nil
+}
+
+// redisGet returns the first ready message in the given queues, waiting for
+// it up to the given timeout. The message is reserved until it's deleted or
+// released, or until the visibility timeout expires.
+func redisGet(timeout time.Duration, queues ...string) (*Message, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		for _, name := range queues {
+			m, err := redisReserve(name)
+			if err != nil || m != nil {
+				return m, err
+			}
+		}
+		remaining := deadline.Sub(time.Now())
+		if remaining <= 0 {
+			return nil, timeoutError(timeout)
+		}
+		if remaining > redisPollInterval {
+			remaining = redisPollInterval
+		}
+		time.Sleep(remaining)
+	}
+}
+
+// redisReserve reserves the next ready message in the queue, returning nil
+// if there's none.
+func redisReserve(name string) (*Message, error) {
+	conn := redisConn()
+	defer conn.Close()
+	args := append(redisKeys(name), redisTime(0), redisTime(visibilityTimeout()))
+	values, err := redis.Values(redisGetScript.Do(conn, args...))
+	if err == redis.ErrNil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var (
+		id         int64
+		body       []byte
+		deliveries int
+	)
+	if _, err := redis.Scan(values, &id, &body, &deliveries); err != nil {
+		return nil, err
+	}
+	var msg Message
+	if err := gob.NewDecoder(bytes.NewReader(body)).Decode(&msg); err != nil {
+		conn.Do("HDEL", redisKeys(name)[3], id)
+		conn.Do("HDEL", redisKeys(name)[4], id)
+		conn.Do("ZREM", redisKeys(name)[2], id)
+		return nil, fmt.Errorf("Invalid message: %q", body)
+	}
+	msg.id = uint64(id)
+	msg.queue = name
+	msg.Attempts += deliveries
+	return &msg, nil
+}
+
+// redisDepth returns the number of ready messages in the queue.
+func redisDepth(name string) (int, error) {
+	conn := redisConn()
+	defer conn.Close()
+	return redis.Int(conn.Do("LLEN", redisKeys(name)[0]))
+}
+
+type redisFactory struct{}
+
+func (redisFactory) Get(name string) (Q, error) {
+	useQueue(name, redisDepth)
+	return &redisQ{name: name}, nil
+}
+
+func (r redisFactory) Handler(f func(*Message), name ...string) (Handler, error) {
+	for _, n := range name {
+		useQueue(n, redisDepth)
+	}
+	get := func(timeout time.Duration) (*Message, error) {
+		return redisGet(timeout, name...)
+	}
+	return messageExecutor(get, r, f), nil
+}
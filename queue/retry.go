@@ -0,0 +1,76 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package queue
+
+import (
+	"github.com/globocom/config"
+	"sync"
+	"time"
+)
+
+// RetryPolicy defines how a message that is not deleted by the handler is
+// retried. The message is put back in the queue after the backoff, which
+// doubles after each attempt, up to MaxBackoff. After MaxRetries retries, the
+// message is moved to the dead-letter queue. A negative MaxRetries retries
+// the message forever.
+type RetryPolicy struct {
+	MaxRetries int
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+// delay returns how long to wait before delivering the message again, after
+// the given number of attempts.
+func (p RetryPolicy) delay(attempts int) time.Duration {
+	d := p.Backoff
+	for i := 1; i < attempts && d < p.MaxBackoff; i++ {
+		d *= 2
+	}
+	if d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	return d
+}
+
+// exhausted checks whether the message was already retried the maximum
+// number of times.
+func (p RetryPolicy) exhausted(attempts int) bool {
+	return p.MaxRetries >= 0 && attempts > p.MaxRetries
+}
+
+var policies = struct {
+	sync.RWMutex
+	m map[string]RetryPolicy
+}{m: make(map[string]RetryPolicy)}
+
+// SetRetryPolicy defines the retry policy of messages with the given action.
+// Zero Backoff and MaxBackoff fall back to the default values.
+func SetRetryPolicy(action string, p RetryPolicy) {
+	policies.Lock()
+	policies.m[action] = p
+	policies.Unlock()
+}
+
+// retryPolicy returns the retry policy of the action. Actions without a
+// policy are retried up to queue-max-retries times, defaulting to 10, with a
+// backoff that starts in one second and goes up to five minutes.
+func retryPolicy(action string) RetryPolicy {
+	policies.RLock()
+	p, ok := policies.m[action]
+	policies.RUnlock()
+	if !ok {
+		p.MaxRetries = 10
+		if n, err := config.GetInt("queue-max-retries"); err == nil {
+			p.MaxRetries = n
+		}
+	}
+	if p.Backoff <= 0 {
+		p.Backoff = time.Second
+	}
+	if p.MaxBackoff <= 0 {
+		p.MaxBackoff = 5 * time.Minute
+	}
+	return p
+}
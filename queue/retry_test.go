@@ -0,0 +1,57 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package queue
+
+import (
+	"github.com/globocom/config"
+	"launchpad.net/gocheck"
+	"time"
+)
+
+func (s *S) TestRetryPolicyDelay(c *gocheck.C) {
+	p := RetryPolicy{Backoff: time.Second, MaxBackoff: 10 * time.Second}
+	var tests = []struct {
+		attempts int
+		expected time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{3, 4 * time.Second},
+		{4, 8 * time.Second},
+		{5, 10 * time.Second},
+		{100, 10 * time.Second},
+	}
+	for _, t := range tests {
+		c.Check(p.delay(t.attempts), gocheck.Equals, t.expected, gocheck.Commentf("%d attempts", t.attempts))
+	}
+}
+
+func (s *S) TestRetryPolicyExhausted(c *gocheck.C) {
+	p := RetryPolicy{MaxRetries: 2}
+	c.Assert(p.exhausted(1), gocheck.Equals, false)
+	c.Assert(p.exhausted(2), gocheck.Equals, false)
+	c.Assert(p.exhausted(3), gocheck.Equals, true)
+	p = RetryPolicy{MaxRetries: -1}
+	c.Assert(p.exhausted(1000), gocheck.Equals, false)
+}
+
+func (s *S) TestRetryPolicyDefault(c *gocheck.C) {
+	p := retryPolicy("unknown-action")
+	expected := RetryPolicy{MaxRetries: 10, Backoff: time.Second, MaxBackoff: 5 * time.Minute}
+	c.Assert(p, gocheck.DeepEquals, expected)
+}
+
+func (s *S) TestRetryPolicyMaxRetriesFromConfig(c *gocheck.C) {
+	config.Set("queue-max-retries", 3)
+	defer config.Unset("queue-max-retries")
+	c.Assert(retryPolicy("unknown-action").MaxRetries, gocheck.Equals, 3)
+}
+
+func (s *S) TestSetRetryPolicy(c *gocheck.C) {
+	SetRetryPolicy("set-policy", RetryPolicy{MaxRetries: 2, Backoff: time.Minute})
+	p := retryPolicy("set-policy")
+	expected := RetryPolicy{MaxRetries: 2, Backoff: time.Minute, MaxBackoff: 5 * time.Minute}
+	c.Assert(p, gocheck.DeepEquals, expected)
+}
@@ -0,0 +1,197 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rec
+
+import (
+	"errors"
+	"github.com/globocom/tsuru/db"
+	"labix.org/v2/mgo/bson"
+	"time"
+)
+
+// DefaultEventLimit is the maximum number of events returned by ListEvents
+// when the filter does not define a limit.
+const DefaultEventLimit = 100
+
+var (
+	// Error returned when the kind is not provided to NewEvent.
+	ErrMissingKind = errors.New("Missing kind")
+
+	// Error returned when the event is not found.
+	ErrEventNotFound = errors.New("Event not found")
+)
+
+// Target is the resource affected by an event, like an app, a team or a
+// service.
+type Target struct {
+	Type string
+	Name string `bson:",omitempty" json:",omitempty"`
+}
+
+// Event is a structured record of an action done by a user. Events are
+// created when the action starts, and are marked as done when it finishes.
+type Event struct {
+	ID        bson.ObjectId `bson:"_id"`
+	Kind      string
+	Target    Target
+	Owner     string
+	StartTime time.Time
+	EndTime   time.Time `bson:",omitempty"`
+	Error     string    `bson:",omitempty" json:",omitempty"`
+	Payload   string    `bson:",omitempty" json:",omitempty"`
+	Steps     []Step    `bson:",omitempty" json:",omitempty"`
+}
+
+// Step is a step of the action of an event, like the creation of the
+// repository of an app. The phase of the step is "forward", or "backward" when
+// the action is rolling back.
+type Step struct {
+	Name     string
+	Phase    string
+	Attempts int `bson:",omitempty" json:",omitempty"`
+	Duration time.Duration
+	Error    string `bson:",omitempty" json:",omitempty"`
+}
+
+// Running checks whether the action of the event is still running.
+func (e *Event) Running() bool {
+	return e.EndTime.IsZero()
+}
+
+// Success checks whether the action of the event finished without errors.
+func (e *Event) Success() bool {
+	return !e.Running() && e.Error == ""
+}
+
+// NewEvent stores a new event, that starts now. The event must be marked as
+// done when the action finishes.
+func NewEvent(kind string, target Target, owner, payload string) (*Event, error) {
+	if owner == "" {
+		return nil, ErrMissingUser
+	}
+	if kind == "" {
+		return nil, ErrMissingKind
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	e := Event{
+		ID:        bson.NewObjectId(),
+		Kind:      kind,
+		Target:    target,
+		Owner:     owner,
+		StartTime: time.Now().In(time.UTC),
+		Payload:   payload,
+	}
+	if err := conn.Events().Insert(e); err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// Done marks the event as finished, storing the error of the action, if any.
+func (e *Event) Done(actionErr error) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	e.EndTime = time.Now().In(time.UTC)
+	if actionErr != nil {
+		e.Error = actionErr.Error()
+	}
+	return conn.Events().UpdateId(e.ID, e)
+}
+
+// AddStep records a step of the action of the event.
+func (e *Event) AddStep(step Step) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	e.Steps = append(e.Steps, step)
+	return conn.Events().UpdateId(e.ID, bson.M{"$push": bson.M{"steps": step}})
+}
+
+// EventFilter filters the events returned by ListEvents. Empty fields are
+// ignored.
+type EventFilter struct {
+	Target Target
+	Owner  string
+	Kind   string
+	Since  time.Time
+	Until  time.Time
+	Limit  int
+}
+
+func (f *EventFilter) query() bson.M {
+	query := bson.M{}
+	if f.Target.Type != "" {
+		query["target.type"] = f.Target.Type
+	}
+	if f.Target.Name != "" {
+		query["target.name"] = f.Target.Name
+	}
+	if f.Owner != "" {
+		query["owner"] = f.Owner
+	}
+	if f.Kind != "" {
+		query["kind"] = f.Kind
+	}
+	startTime := bson.M{}
+	if !f.Since.IsZero() {
+		startTime["$gte"] = f.Since
+	}
+	if !f.Until.IsZero() {
+		startTime["$lte"] = f.Until
+	}
+	if len(startTime) > 0 {
+		query["starttime"] = startTime
+	}
+	return query
+}
+
+// ListEvents returns the events that match the filter, the most recent first.
+func ListEvents(f *EventFilter) ([]Event, error) {
+	if f == nil {
+		f = &EventFilter{}
+	}
+	limit := f.Limit
+	if limit <= 0 {
+		limit = DefaultEventLimit
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	var events []Event
+	err = conn.Events().Find(f.query()).Sort("-starttime").Limit(limit).All(&events)
+	if err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// GetEvent returns the event with the given id.
+func GetEvent(id string) (*Event, error) {
+	if !bson.IsObjectIdHex(id) {
+		return nil, ErrEventNotFound
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	var e Event
+	err = conn.Events().FindId(bson.ObjectIdHex(id)).One(&e)
+	if err != nil {
+		return nil, ErrEventNotFound
+	}
+	return &e, nil
+}
@@ -0,0 +1,131 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rec
+
+import (
+	"errors"
+	"github.com/globocom/tsuru/db"
+	"labix.org/v2/mgo/bson"
+	"launchpad.net/gocheck"
+	"time"
+)
+
+func (RecSuite) TearDownTest(c *gocheck.C) {
+	conn, err := db.Conn()
+	c.Assert(err, gocheck.IsNil)
+	defer conn.Close()
+	conn.Events().RemoveAll(nil)
+}
+
+func (RecSuite) TestNewEvent(c *gocheck.C) {
+	target := Target{Type: "app", Name: "myapp"}
+	e, err := NewEvent("app-restart", target, "user@tsuru.io", `{"force":true}`)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(e.Running(), gocheck.Equals, true)
+	c.Assert(e.Success(), gocheck.Equals, false)
+	stored, err := GetEvent(e.ID.Hex())
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(stored.Kind, gocheck.Equals, "app-restart")
+	c.Assert(stored.Target, gocheck.DeepEquals, target)
+	c.Assert(stored.Owner, gocheck.Equals, "user@tsuru.io")
+	c.Assert(stored.Payload, gocheck.Equals, `{"force":true}`)
+	c.Assert(stored.Running(), gocheck.Equals, true)
+}
+
+func (RecSuite) TestNewEventValidation(c *gocheck.C) {
+	_, err := NewEvent("app-restart", Target{Type: "app"}, "", "")
+	c.Assert(err, gocheck.Equals, ErrMissingUser)
+	_, err = NewEvent("", Target{Type: "app"}, "user@tsuru.io", "")
+	c.Assert(err, gocheck.Equals, ErrMissingKind)
+}
+
+func (RecSuite) TestEventDone(c *gocheck.C) {
+	e, err := NewEvent("app-restart", Target{Type: "app", Name: "myapp"}, "user@tsuru.io", "")
+	c.Assert(err, gocheck.IsNil)
+	err = e.Done(nil)
+	c.Assert(err, gocheck.IsNil)
+	stored, err := GetEvent(e.ID.Hex())
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(stored.Running(), gocheck.Equals, false)
+	c.Assert(stored.Success(), gocheck.Equals, true)
+	c.Assert(stored.EndTime.Before(stored.StartTime), gocheck.Equals, false)
+}
+
+func (RecSuite) TestEventDoneWithError(c *gocheck.C) {
+	e, err := NewEvent("app-restart", Target{Type: "app", Name: "myapp"}, "user@tsuru.io", "")
+	c.Assert(err, gocheck.IsNil)
+	err = e.Done(errors.New("restart failed"))
+	c.Assert(err, gocheck.IsNil)
+	stored, err := GetEvent(e.ID.Hex())
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(stored.Success(), gocheck.Equals, false)
+	c.Assert(stored.Error, gocheck.Equals, "restart failed")
+}
+
+func (RecSuite) TestGetEventNotFound(c *gocheck.C) {
+	_, err := GetEvent("invalid")
+	c.Assert(err, gocheck.Equals, ErrEventNotFound)
+	_, err = GetEvent("52b4c0a8e9d8a26a7e000001")
+	c.Assert(err, gocheck.Equals, ErrEventNotFound)
+}
+
+func (RecSuite) TestListEvents(c *gocheck.C) {
+	conn, err := db.Conn()
+	c.Assert(err, gocheck.IsNil)
+	defer conn.Close()
+	now := time.Date(2013, 12, 10, 15, 0, 0, 0, time.UTC)
+	events := []Event{
+		{Kind: "app-create", Target: Target{Type: "app", Name: "myapp"}, Owner: "user@tsuru.io", StartTime: now.Add(-2 * time.Hour)},
+		{Kind: "app-restart", Target: Target{Type: "app", Name: "myapp"}, Owner: "other@tsuru.io", StartTime: now.Add(-time.Hour)},
+		{Kind: "team-create", Target: Target{Type: "team", Name: "myteam"}, Owner: "user@tsuru.io", StartTime: now},
+	}
+	for _, e := range events {
+		e.ID = bson.NewObjectId()
+		err := conn.Events().Insert(e)
+		c.Assert(err, gocheck.IsNil)
+	}
+	var tests = []struct {
+		filter   *EventFilter
+		expected []string
+	}{
+		{nil, []string{"team-create", "app-restart", "app-create"}},
+		{&EventFilter{Target: Target{Type: "app", Name: "myapp"}}, []string{"app-restart", "app-create"}},
+		{&EventFilter{Owner: "user@tsuru.io"}, []string{"team-create", "app-create"}},
+		{&EventFilter{Kind: "app-restart"}, []string{"app-restart"}},
+		{&EventFilter{Limit: 1}, []string{"team-create"}},
+		{&EventFilter{Since: now.Add(-time.Hour)}, []string{"team-create", "app-restart"}},
+		{&EventFilter{Until: now.Add(-time.Hour)}, []string{"app-restart", "app-create"}},
+		{&EventFilter{Since: now.Add(time.Hour)}, nil},
+	}
+	for _, t := range tests {
+		events, err := ListEvents(t.filter)
+		c.Check(err, gocheck.IsNil)
+		var kinds []string
+		for _, e := range events {
+			kinds = append(kinds, e.Kind)
+		}
+		c.Check(kinds, gocheck.DeepEquals, t.expected)
+	}
+}
+
+func (RecSuite) TestEventAddStep(c *gocheck.C) {
+	e, err := NewEvent("app-create", Target{Type: "app", Name: "myapp"}, "user@tsuru.io", "")
+	c.Assert(err, gocheck.IsNil)
+	steps := []Step{
+		{Name: "insert-app", Phase: "forward", Attempts: 1, Duration: time.Second},
+		{Name: "create-repository", Phase: "forward", Attempts: 2, Duration: time.Second, Error: "gandalf is down"},
+		{Name: "insert-app", Phase: "backward", Duration: time.Millisecond},
+	}
+	for _, step := range steps {
+		err = e.AddStep(step)
+		c.Assert(err, gocheck.IsNil)
+	}
+	c.Assert(e.Steps, gocheck.DeepEquals, steps)
+	err = e.Done(errors.New("gandalf is down"))
+	c.Assert(err, gocheck.IsNil)
+	stored, err := GetEvent(e.ID.Hex())
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(stored.Steps, gocheck.DeepEquals, steps)
+}
@@ -0,0 +1,77 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package shutdown provides the graceful shutdown of tsuru processes: they
+// stop taking new work when they receive SIGTERM or SIGINT, and wait for the
+// work in progress to finish, up to a timeout.
+package shutdown
+
+import (
+	"errors"
+	"github.com/globocom/config"
+	"github.com/globocom/tsuru/action"
+	"github.com/globocom/tsuru/queue"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// ErrTimeout is returned by Drain when the work in progress doesn't finish
+// before the deadline.
+var ErrTimeout = errors.New("Timed out waiting for the work in progress to finish.")
+
+// DefaultTimeout is used when the setting shutdown-timeout is not defined.
+const DefaultTimeout = 5 * time.Minute
+
+// pollInterval is the interval between two checks of the running pipelines.
+const pollInterval = 100 * time.Millisecond
+
+// Notify returns a channel that receives the first SIGTERM or SIGINT sent to
+// the process. After the first signal, the signals are no longer captured, so
+// a second one terminates the process without waiting for the shutdown.
+func Notify() <-chan os.Signal {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGTERM, os.Interrupt)
+	ch := make(chan os.Signal, 1)
+	go func() {
+		sig := <-sigs
+		signal.Stop(sigs)
+		ch <- sig
+	}()
+	return ch
+}
+
+// Timeout returns how long the process waits for the work in progress when
+// shutting down. It's defined by the setting shutdown-timeout, in seconds.
+func Timeout() time.Duration {
+	if t, err := config.GetInt("shutdown-timeout"); err == nil && t > 0 {
+		return time.Duration(t) * time.Second
+	}
+	return DefaultTimeout
+}
+
+// Drain stops the queue handlers of the process, and waits for them and for
+// the running action pipelines to finish, until the deadline.
+func Drain(deadline time.Time) error {
+	preempted := make(chan bool, 1)
+	go func() {
+		queue.Preempt()
+		preempted <- true
+	}()
+	timer := time.NewTimer(deadline.Sub(time.Now()))
+	defer timer.Stop()
+	select {
+	case <-preempted:
+	case <-timer.C:
+		return ErrTimeout
+	}
+	for action.Running() > 0 {
+		if !time.Now().Before(deadline) {
+			return ErrTimeout
+		}
+		time.Sleep(pollInterval)
+	}
+	return nil
+}
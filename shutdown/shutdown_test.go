@@ -0,0 +1,103 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package shutdown
+
+import (
+	"github.com/globocom/config"
+	"github.com/globocom/tsuru/action"
+	"launchpad.net/gocheck"
+	"os"
+	"os/signal"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func Test(t *testing.T) { gocheck.TestingT(t) }
+
+type S struct{}
+
+var _ = gocheck.Suite(&S{})
+
+func (s *S) TestTimeout(c *gocheck.C) {
+	c.Assert(Timeout(), gocheck.Equals, DefaultTimeout)
+	config.Set("shutdown-timeout", 30)
+	defer config.Unset("shutdown-timeout")
+	c.Assert(Timeout(), gocheck.Equals, 30*time.Second)
+}
+
+func (s *S) TestNotify(c *gocheck.C) {
+	ch := Notify()
+	syscall.Kill(syscall.Getpid(), syscall.SIGTERM)
+	select {
+	case sig := <-ch:
+		c.Assert(sig, gocheck.Equals, syscall.SIGTERM)
+	case <-time.After(2e9):
+		c.Fatal("Did not receive the signal.")
+	}
+}
+
+func (s *S) TestNotifyStopsCapturingAfterTheFirstSignal(c *gocheck.C) {
+	ch := Notify()
+	syscall.Kill(syscall.Getpid(), syscall.SIGTERM)
+	select {
+	case <-ch:
+	case <-time.After(2e9):
+		c.Fatal("Did not receive the signal.")
+	}
+	guard := make(chan os.Signal, 1)
+	signal.Notify(guard, syscall.SIGTERM)
+	defer signal.Stop(guard)
+	syscall.Kill(syscall.Getpid(), syscall.SIGTERM)
+	select {
+	case <-guard:
+	case <-time.After(2e9):
+		c.Fatal("Did not receive the signal.")
+	}
+	select {
+	case sig := <-ch:
+		c.Fatalf("Received %s after the first signal.", sig)
+	case <-time.After(1e8):
+	}
+}
+
+// runPipeline starts a pipeline that runs until finish is closed.
+func runPipeline(finish chan bool) {
+	started := make(chan bool)
+	pipeline := action.NewPipeline(&action.Action{
+		Name: "wait",
+		Forward: func(ctx action.FWContext) (action.Result, error) {
+			started <- true
+			<-finish
+			return nil, nil
+		},
+	})
+	go pipeline.Execute()
+	<-started
+}
+
+func (s *S) TestDrainWaitsForPipelines(c *gocheck.C) {
+	finish := make(chan bool)
+	runPipeline(finish)
+	drained := make(chan error)
+	go func() {
+		drained <- Drain(time.Now().Add(5e9))
+	}()
+	select {
+	case <-drained:
+		c.Fatal("Drain returned before the pipeline finished.")
+	case <-time.After(3e8):
+	}
+	close(finish)
+	c.Assert(<-drained, gocheck.IsNil)
+}
+
+func (s *S) TestDrainTimeout(c *gocheck.C) {
+	finish := make(chan bool)
+	defer close(finish)
+	runPipeline(finish)
+	err := Drain(time.Now().Add(2e8))
+	c.Assert(err, gocheck.Equals, ErrTimeout)
+}
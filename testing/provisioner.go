@@ -10,6 +10,7 @@ import (
 	"github.com/globocom/tsuru/cmd"
 	"github.com/globocom/tsuru/provision"
 	"io"
+	"sort"
 	"strconv"
 	"sync"
 	"sync/atomic"
@@ -53,14 +54,17 @@ func (u *FakeUnit) GetIp() string {
 
 // Fake implementation for provision.App.
 type FakeApp struct {
-	name     string
-	platform string
-	units    []provision.AppUnit
-	logs     []string
-	logMut   sync.Mutex
-	Commands []string
-	commMut  sync.Mutex
-	ready    bool
+	name      string
+	platform  string
+	units     []provision.AppUnit
+	logs      []string
+	logMut    sync.Mutex
+	Commands  []string
+	commMut   sync.Mutex
+	ready     bool
+	hc        *provision.HealthCheck
+	Memory    int
+	CpuShares int
 }
 
 func NewFakeApp(name, platform string, units int) *FakeApp {
@@ -117,6 +121,15 @@ func (a *FakeApp) Ready() error {
 	return nil
 }
 
+// SetHealthCheck defines the health check returned by HealthCheck.
+func (a *FakeApp) SetHealthCheck(hc *provision.HealthCheck) {
+	a.hc = hc
+}
+
+func (a *FakeApp) HealthCheck() (*provision.HealthCheck, error) {
+	return a.hc, nil
+}
+
 func (a *FakeApp) Log(message, source string) error {
 	a.logMut.Lock()
 	a.logs = append(a.logs, source+message)
@@ -132,6 +145,14 @@ func (a *FakeApp) GetPlatform() string {
 	return a.platform
 }
 
+func (a *FakeApp) GetMemory() int {
+	return a.Memory
+}
+
+func (a *FakeApp) GetCpuShares() int {
+	return a.CpuShares
+}
+
 func (a *FakeApp) ProvisionedUnits() []provision.AppUnit {
 	return a.units
 }
@@ -199,12 +220,16 @@ type failure struct {
 
 // Fake implementation for provision.Provisioner.
 type FakeProvisioner struct {
-	cmds     []Cmd
-	cmdMut   sync.Mutex
-	outputs  chan []byte
-	failures chan failure
-	apps     map[string]provisionedApp
-	mut      sync.RWMutex
+	cmds      []Cmd
+	cmdMut    sync.Mutex
+	outputs   chan []byte
+	failures  chan failure
+	apps      map[string]provisionedApp
+	platforms map[string]map[string]string
+	nodes     map[string]provision.Node
+	pools     map[string]provision.Pool
+	checks    int
+	mut       sync.RWMutex
 }
 
 func NewFakeProvisioner() *FakeProvisioner {
@@ -212,6 +237,9 @@ func NewFakeProvisioner() *FakeProvisioner {
 	p.outputs = make(chan []byte, 8)
 	p.failures = make(chan failure, 8)
 	p.apps = make(map[string]provisionedApp)
+	p.platforms = make(map[string]map[string]string)
+	p.nodes = make(map[string]provision.Node)
+	p.pools = make(map[string]provision.Pool)
 	return &p
 }
 
@@ -279,6 +307,13 @@ func (p *FakeProvisioner) Version(app provision.App) string {
 	return p.apps[app.GetName()].version
 }
 
+// Image returns the last image deployed for a given app.
+func (p *FakeProvisioner) Image(app provision.App) string {
+	p.mut.RLock()
+	defer p.mut.RUnlock()
+	return p.apps[app.GetName()].image
+}
+
 // PrepareOutput sends the given slice of bytes to a queue of outputs.
 //
 // Each prepared output will be used in the ExecuteCommand. It might be sent to
@@ -308,6 +343,10 @@ func (p *FakeProvisioner) Reset() {
 
 	p.mut.Lock()
 	p.apps = make(map[string]provisionedApp)
+	p.platforms = make(map[string]map[string]string)
+	p.nodes = make(map[string]provision.Node)
+	p.pools = make(map[string]provision.Pool)
+	p.checks = 0
 	p.mut.Unlock()
 
 	for {
@@ -340,6 +379,274 @@ func (p *FakeProvisioner) Deploy(app provision.App, version string, w io.Writer)
 	return nil
 }
 
+// ImageDeploy calls Deploy, returning a fake image name built from the name
+// of the app and the given version.
+func (p *FakeProvisioner) ImageDeploy(app provision.App, version string, w io.Writer) (string, error) {
+	if err := p.Deploy(app, version, w); err != nil {
+		return "", err
+	}
+	image := fmt.Sprintf("tsuru/%s:%s", app.GetName(), version)
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	pApp := p.apps[app.GetName()]
+	pApp.image = image
+	p.apps[app.GetName()] = pApp
+	return image, nil
+}
+
+func (p *FakeProvisioner) Rollback(app provision.App, image string, w io.Writer) error {
+	if err := p.getError("Rollback"); err != nil {
+		return err
+	}
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	pApp, ok := p.apps[app.GetName()]
+	if !ok {
+		return errNotProvisioned
+	}
+	w.Write([]byte("Rollback called"))
+	pApp.image = image
+	p.apps[app.GetName()] = pApp
+	return nil
+}
+
+// Platform returns the args of the given platform, and whether the platform
+// is known by the provisioner.
+func (p *FakeProvisioner) Platform(name string) (map[string]string, bool) {
+	p.mut.RLock()
+	defer p.mut.RUnlock()
+	args, ok := p.platforms[name]
+	return args, ok
+}
+
+func (p *FakeProvisioner) PlatformAdd(name string, args map[string]string, w io.Writer) error {
+	if err := p.getError("PlatformAdd"); err != nil {
+		return err
+	}
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	if p.platforms == nil {
+		p.platforms = make(map[string]map[string]string)
+	}
+	if _, ok := p.platforms[name]; ok {
+		return errors.New("duplicate platform")
+	}
+	p.platforms[name] = args
+	w.Write([]byte("PlatformAdd called"))
+	return nil
+}
+
+func (p *FakeProvisioner) PlatformUpdate(name string, args map[string]string, w io.Writer) error {
+	if err := p.getError("PlatformUpdate"); err != nil {
+		return err
+	}
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	if _, ok := p.platforms[name]; !ok {
+		return errors.New("platform not found")
+	}
+	p.platforms[name] = args
+	w.Write([]byte("PlatformUpdate called"))
+	return nil
+}
+
+func (p *FakeProvisioner) PlatformRemove(name string) error {
+	if err := p.getError("PlatformRemove"); err != nil {
+		return err
+	}
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	if _, ok := p.platforms[name]; !ok {
+		return errors.New("platform not found")
+	}
+	delete(p.platforms, name)
+	return nil
+}
+
+func (p *FakeProvisioner) AddNode(n provision.Node) error {
+	if err := p.getError("AddNode"); err != nil {
+		return err
+	}
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	if p.nodes == nil {
+		p.nodes = make(map[string]provision.Node)
+	}
+	if _, ok := p.nodes[n.ID]; ok {
+		return provision.ErrNodeAlreadyExists
+	}
+	p.nodes[n.ID] = n
+	return nil
+}
+
+func (p *FakeProvisioner) RemoveNode(id string) error {
+	if err := p.getError("RemoveNode"); err != nil {
+		return err
+	}
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	if _, ok := p.nodes[id]; !ok {
+		return provision.ErrNodeNotFound
+	}
+	delete(p.nodes, id)
+	return nil
+}
+
+type nodeList []provision.Node
+
+func (l nodeList) Len() int           { return len(l) }
+func (l nodeList) Less(i, j int) bool { return l[i].ID < l[j].ID }
+func (l nodeList) Swap(i, j int)      { l[i], l[j] = l[j], l[i] }
+
+// ListNodes returns the nodes added to the provisioner, sorted by id.
+func (p *FakeProvisioner) ListNodes() ([]provision.Node, error) {
+	if err := p.getError("ListNodes"); err != nil {
+		return nil, err
+	}
+	p.mut.RLock()
+	defer p.mut.RUnlock()
+	nodes := make(nodeList, 0, len(p.nodes))
+	for _, n := range p.nodes {
+		nodes = append(nodes, n)
+	}
+	sort.Sort(nodes)
+	return nodes, nil
+}
+
+// CheckNodes marks all nodes as healthy.
+func (p *FakeProvisioner) CheckNodes() error {
+	if err := p.getError("CheckNodes"); err != nil {
+		return err
+	}
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	p.checks++
+	for id, n := range p.nodes {
+		n.Status = provision.NodeHealthy
+		p.nodes[id] = n
+	}
+	return nil
+}
+
+// NodeChecks returns the number of calls to CheckNodes.
+func (p *FakeProvisioner) NodeChecks() int {
+	p.mut.RLock()
+	defer p.mut.RUnlock()
+	return p.checks
+}
+
+// AddPool adds a pool. Adding a default pool replaces the previous default
+// pool.
+func (p *FakeProvisioner) AddPool(pool provision.Pool) error {
+	if err := p.getError("AddPool"); err != nil {
+		return err
+	}
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	if p.pools == nil {
+		p.pools = make(map[string]provision.Pool)
+	}
+	if _, ok := p.pools[pool.Name]; ok {
+		return provision.ErrPoolAlreadyExists
+	}
+	if pool.Default {
+		for name, pl := range p.pools {
+			pl.Default = false
+			p.pools[name] = pl
+		}
+	}
+	p.pools[pool.Name] = pool
+	return nil
+}
+
+func (p *FakeProvisioner) RemovePool(name string) error {
+	if err := p.getError("RemovePool"); err != nil {
+		return err
+	}
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	if _, ok := p.pools[name]; !ok {
+		return provision.ErrPoolNotFound
+	}
+	for _, n := range p.nodes {
+		if n.Pool == name {
+			return provision.ErrPoolNotEmpty
+		}
+	}
+	delete(p.pools, name)
+	return nil
+}
+
+type poolList []provision.Pool
+
+func (l poolList) Len() int           { return len(l) }
+func (l poolList) Less(i, j int) bool { return l[i].Name < l[j].Name }
+func (l poolList) Swap(i, j int)      { l[i], l[j] = l[j], l[i] }
+
+// ListPools returns the pools added to the provisioner, sorted by name.
+func (p *FakeProvisioner) ListPools() ([]provision.Pool, error) {
+	if err := p.getError("ListPools"); err != nil {
+		return nil, err
+	}
+	p.mut.RLock()
+	defer p.mut.RUnlock()
+	pools := make(poolList, 0, len(p.pools))
+	for _, pl := range p.pools {
+		pools = append(pools, pl)
+	}
+	sort.Sort(pools)
+	return pools, nil
+}
+
+func (p *FakeProvisioner) AddTeamsToPool(name string, teams []string) error {
+	if err := p.getError("AddTeamsToPool"); err != nil {
+		return err
+	}
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	pool, ok := p.pools[name]
+	if !ok {
+		return provision.ErrPoolNotFound
+	}
+	for _, team := range teams {
+		if !hasString(pool.Teams, team) {
+			pool.Teams = append(pool.Teams, team)
+		}
+	}
+	p.pools[name] = pool
+	return nil
+}
+
+func (p *FakeProvisioner) RemoveTeamsFromPool(name string, teams []string) error {
+	if err := p.getError("RemoveTeamsFromPool"); err != nil {
+		return err
+	}
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	pool, ok := p.pools[name]
+	if !ok {
+		return provision.ErrPoolNotFound
+	}
+	var remaining []string
+	for _, team := range pool.Teams {
+		if !hasString(teams, team) {
+			remaining = append(remaining, team)
+		}
+	}
+	pool.Teams = remaining
+	p.pools[name] = pool
+	return nil
+}
+
+func hasString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
 func (p *FakeProvisioner) Provision(app provision.App) error {
 	if err := p.getError("Provision"); err != nil {
 		return err
@@ -598,6 +905,7 @@ type provisionedApp struct {
 	restarts    int
 	installDeps int
 	version     string
+	image       string
 	cname       string
 	unitLen     int
 }
@@ -44,6 +44,17 @@ func (s *S) TestFakeAppReady(c *gocheck.C) {
 	c.Assert(app.IsReady(), gocheck.Equals, true)
 }
 
+func (s *S) TestFakeAppHealthCheck(c *gocheck.C) {
+	app := NewFakeApp("sou", "otm", 0)
+	hc, err := app.HealthCheck()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(hc, gocheck.IsNil)
+	app.SetHealthCheck(&provision.HealthCheck{Path: "/health"})
+	hc, err = app.HealthCheck()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(hc.Path, gocheck.Equals, "/health")
+}
+
 func (s *S) TestFakeAppRestart(c *gocheck.C) {
 	var buf bytes.Buffer
 	app := NewFakeApp("sou", "otm", 0)
@@ -185,6 +196,42 @@ func (s *S) TestDeployWithPreparedFailure(c *gocheck.C) {
 	c.Assert(e, gocheck.Equals, err)
 }
 
+func (s *S) TestImageDeploy(c *gocheck.C) {
+	var buf bytes.Buffer
+	app := NewFakeApp("soul", "arch", 1)
+	p := NewFakeProvisioner()
+	p.Provision(app)
+	image, err := p.ImageDeploy(app, "1.0", &buf)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(image, gocheck.Equals, "tsuru/soul:1.0")
+	c.Assert(buf.String(), gocheck.Equals, "Deploy called")
+	c.Assert(p.Version(app), gocheck.Equals, "1.0")
+	c.Assert(p.Image(app), gocheck.Equals, "tsuru/soul:1.0")
+}
+
+func (s *S) TestRollback(c *gocheck.C) {
+	var buf bytes.Buffer
+	app := NewFakeApp("soul", "arch", 1)
+	p := NewFakeProvisioner()
+	p.Provision(app)
+	err := p.Rollback(app, "tsuru/soul:0.9", &buf)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(buf.String(), gocheck.Equals, "Rollback called")
+	c.Assert(p.Image(app), gocheck.Equals, "tsuru/soul:0.9")
+}
+
+func (s *S) TestRollbackUnknownApp(c *gocheck.C) {
+	var buf bytes.Buffer
+	app := NewFakeApp("soul", "arch", 1)
+	p := NewFakeProvisioner()
+	err := p.Rollback(app, "tsuru/soul:0.9", &buf)
+	c.Assert(err, gocheck.Equals, errNotProvisioned)
+}
+
+func (s *S) TestFakeProvisionerIsRollbacker(c *gocheck.C) {
+	var _ provision.Rollbacker = &FakeProvisioner{}
+}
+
 func (s *S) TestProvision(c *gocheck.C) {
 	app := NewFakeApp("kid-gloves", "rush", 1)
 	p := NewFakeProvisioner()
@@ -553,3 +600,106 @@ func (s *S) TestCommandableProvisioner(c *gocheck.C) {
 	commands2 := p.Commands()
 	c.Assert(commands[0], gocheck.Equals, commands2[0])
 }
+
+func (s *S) TestAddNode(c *gocheck.C) {
+	p := NewFakeProvisioner()
+	err := p.AddNode(provision.Node{ID: "node2", Address: "http://10.0.0.2:4243"})
+	c.Assert(err, gocheck.IsNil)
+	err = p.AddNode(provision.Node{ID: "node1", Address: "http://10.0.0.1:4243"})
+	c.Assert(err, gocheck.IsNil)
+	err = p.AddNode(provision.Node{ID: "node1", Address: "http://10.0.0.3:4243"})
+	c.Assert(err, gocheck.Equals, provision.ErrNodeAlreadyExists)
+	nodes, err := p.ListNodes()
+	c.Assert(err, gocheck.IsNil)
+	expected := []provision.Node{
+		{ID: "node1", Address: "http://10.0.0.1:4243"},
+		{ID: "node2", Address: "http://10.0.0.2:4243"},
+	}
+	c.Assert(nodes, gocheck.DeepEquals, expected)
+}
+
+func (s *S) TestRemoveNode(c *gocheck.C) {
+	p := NewFakeProvisioner()
+	p.AddNode(provision.Node{ID: "node1", Address: "http://10.0.0.1:4243"})
+	err := p.RemoveNode("node1")
+	c.Assert(err, gocheck.IsNil)
+	nodes, err := p.ListNodes()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(nodes, gocheck.HasLen, 0)
+	err = p.RemoveNode("node1")
+	c.Assert(err, gocheck.Equals, provision.ErrNodeNotFound)
+}
+
+func (s *S) TestCheckNodes(c *gocheck.C) {
+	p := NewFakeProvisioner()
+	p.AddNode(provision.Node{ID: "node1", Address: "http://10.0.0.1:4243"})
+	err := p.CheckNodes()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(p.NodeChecks(), gocheck.Equals, 1)
+	nodes, _ := p.ListNodes()
+	c.Assert(nodes[0].Status, gocheck.Equals, provision.NodeHealthy)
+}
+
+func (s *S) TestCheckNodesWithFailure(c *gocheck.C) {
+	p := NewFakeProvisioner()
+	p.PrepareFailure("CheckNodes", errors.New("unreachable"))
+	err := p.CheckNodes()
+	c.Assert(err, gocheck.NotNil)
+	c.Assert(err.Error(), gocheck.Equals, "unreachable")
+	c.Assert(p.NodeChecks(), gocheck.Equals, 0)
+}
+
+func (s *S) TestFakeProvisionerIsNodeManager(c *gocheck.C) {
+	var _ provision.NodeManager = &FakeProvisioner{}
+}
+
+func (s *S) TestAddPool(c *gocheck.C) {
+	p := NewFakeProvisioner()
+	err := p.AddPool(provision.Pool{Name: "staging", Default: true})
+	c.Assert(err, gocheck.IsNil)
+	err = p.AddPool(provision.Pool{Name: "production", Teams: []string{"ops"}, Default: true})
+	c.Assert(err, gocheck.IsNil)
+	err = p.AddPool(provision.Pool{Name: "staging"})
+	c.Assert(err, gocheck.Equals, provision.ErrPoolAlreadyExists)
+	pools, err := p.ListPools()
+	c.Assert(err, gocheck.IsNil)
+	expected := []provision.Pool{
+		{Name: "production", Teams: []string{"ops"}, Default: true},
+		{Name: "staging"},
+	}
+	c.Assert(pools, gocheck.DeepEquals, expected)
+}
+
+func (s *S) TestRemovePool(c *gocheck.C) {
+	p := NewFakeProvisioner()
+	p.AddPool(provision.Pool{Name: "staging"})
+	p.AddNode(provision.Node{ID: "node1", Address: "http://10.0.0.1:4243", Pool: "staging"})
+	err := p.RemovePool("staging")
+	c.Assert(err, gocheck.Equals, provision.ErrPoolNotEmpty)
+	p.RemoveNode("node1")
+	err = p.RemovePool("staging")
+	c.Assert(err, gocheck.IsNil)
+	err = p.RemovePool("staging")
+	c.Assert(err, gocheck.Equals, provision.ErrPoolNotFound)
+}
+
+func (s *S) TestPoolTeams(c *gocheck.C) {
+	p := NewFakeProvisioner()
+	p.AddPool(provision.Pool{Name: "staging", Teams: []string{"ops"}})
+	err := p.AddTeamsToPool("staging", []string{"ops", "devs", "qa"})
+	c.Assert(err, gocheck.IsNil)
+	pools, _ := p.ListPools()
+	c.Assert(pools[0].Teams, gocheck.DeepEquals, []string{"ops", "devs", "qa"})
+	err = p.RemoveTeamsFromPool("staging", []string{"ops", "qa"})
+	c.Assert(err, gocheck.IsNil)
+	pools, _ = p.ListPools()
+	c.Assert(pools[0].Teams, gocheck.DeepEquals, []string{"devs"})
+	err = p.AddTeamsToPool("production", []string{"ops"})
+	c.Assert(err, gocheck.Equals, provision.ErrPoolNotFound)
+	err = p.RemoveTeamsFromPool("production", []string{"ops"})
+	c.Assert(err, gocheck.Equals, provision.ErrPoolNotFound)
+}
+
+func (s *S) TestFakeProvisionerIsPoolManager(c *gocheck.C) {
+	var _ provision.PoolManager = &FakeProvisioner{}
+}